@@ -3,16 +3,37 @@ package main
 import (
 	"context"
 	"fmt"
+	"io"
 	"log"
+	"log/slog"
 	"net/http"
+	"os"
 	"os/signal"
 	"syscall"
 	"time"
 
+	"github.com/raziel-aleman/go-starter/internal/database"
+	"github.com/raziel-aleman/go-starter/internal/database/fixtures"
 	"github.com/raziel-aleman/go-starter/internal/server"
 )
 
-func gracefulShutdown(apiServer *http.Server, done chan bool) {
+// shutdownTimeout reads SHUTDOWN_TIMEOUT, how long the requests in flight are
+// drained for on shutdown (default 5s).
+func shutdownTimeout() (time.Duration, error) {
+	value := os.Getenv("SHUTDOWN_TIMEOUT")
+	if value == "" {
+		return 5 * time.Second, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid SHUTDOWN_TIMEOUT %q", value)
+	}
+	return d, nil
+}
+
+// gracefulShutdown waits for SIGINT or SIGTERM, drains the requests in flight
+// for up to timeout, then closes the services.
+func gracefulShutdown(apiServer *http.Server, services io.Closer, timeout time.Duration, done chan bool) {
 	// Create context that listens for the interrupt signal from the OS.
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer stop()
@@ -20,39 +41,126 @@ func gracefulShutdown(apiServer *http.Server, done chan bool) {
 	// Listen for the interrupt signal.
 	<-ctx.Done()
 
-	log.Println("shutting down gracefully, press Ctrl+C again to force")
+	slog.Info("Shutting down gracefully, press Ctrl+C again to force")
 	stop() // Allow Ctrl+C to force shutdown
 
-	// The context is used to inform the server it has 5 seconds to finish
-	// the request it is currently handling
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	// The context is used to inform the server how long it has to finish
+	// the requests it is currently handling
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
 	if err := apiServer.Shutdown(ctx); err != nil {
-		log.Printf("Server forced to shutdown with error: %v", err)
+		slog.Error("Server forced to shutdown", "err", err)
 	}
 
-	log.Println("Server exiting")
+	// No handler uses the sessions nor the database anymore
+	if err := services.Close(); err != nil {
+		slog.Error("Failed to close services", "err", err)
+	}
+
+	slog.Info("Server exiting")
 
 	// Notify the main goroutine that the shutdown is complete
 	done <- true
 }
 
+// backup writes a snapshot of the SQLite database to path, e.g. from a cron
+// job while the server is running: main backup /var/backups/app.db
+func backup(path string) error {
+	db, err := database.New()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	return db.Backup(ctx, path)
+}
+
+// rotateKeys re-encrypts the encrypted columns with the active key, after a
+// new key is prepended to BLUEPRINT_DB_ENCRYPTION_KEYS: main rotate-keys
+func rotateKeys() (int64, error) {
+	db, err := database.New()
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	return db.RotateEncryptionKeys(ctx)
+}
+
+// seed loads fixture files into the database, e.g. sample data for local
+// development: main seed fixtures/users.yaml fixtures/posts.json
+func seed(paths []string) error {
+	sets := make([]fixtures.Set, 0, len(paths))
+	for _, path := range paths {
+		set, err := fixtures.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		sets = append(sets, set)
+	}
+
+	db, err := database.New()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	return db.LoadFixtures(ctx, sets...)
+}
+
 func main() {
+	if len(os.Args) == 2 && os.Args[1] == "rotate-keys" {
+		n, err := rotateKeys()
+		if err != nil {
+			log.Fatalf("key rotation failed: %v", err)
+		}
+		slog.Info("Re-encrypted values with the active key", "count", n)
+		return
+	}
+	if len(os.Args) >= 3 && os.Args[1] == "seed" {
+		if err := seed(os.Args[2:]); err != nil {
+			log.Fatalf("seeding failed: %v", err)
+		}
+		slog.Info("Loaded fixture files", "count", len(os.Args)-2)
+		return
+	}
+	if len(os.Args) == 3 && os.Args[1] == "backup" {
+		if err := backup(os.Args[2]); err != nil {
+			log.Fatalf("backup failed: %v", err)
+		}
+		slog.Info("Database backed up", "path", os.Args[2])
+		return
+	}
 
-	server := server.NewServer()
+	timeout, err := shutdownTimeout()
+	if err != nil {
+		log.Fatal(err)
+	}
+	server, services := server.NewServer()
 
 	// Create a done channel to signal when the shutdown is complete
 	done := make(chan bool, 1)
 
 	// Run graceful shutdown in a separate goroutine
-	go gracefulShutdown(server, done)
+	go gracefulShutdown(server, services, timeout, done)
 
-	err := server.ListenAndServe()
+	if server.TLSConfig != nil {
+		// The certificates are already loaded in the TLS config
+		err = server.ListenAndServeTLS("", "")
+	} else {
+		err = server.ListenAndServe()
+	}
 	if err != nil && err != http.ErrServerClosed {
 		panic(fmt.Sprintf("http server error: %s", err))
 	}
 
 	// Wait for the graceful shutdown to complete
 	<-done
-	log.Println("Graceful shutdown complete.")
+	slog.Info("Graceful shutdown complete")
 }
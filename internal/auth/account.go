@@ -0,0 +1,49 @@
+package auth
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/raziel-aleman/go-starter/internal/database"
+	"github.com/raziel-aleman/go-starter/internal/session"
+)
+
+// DeleteAccount deletes the logged-in user after checking its password, and
+// its second factor if enabled. Every session of the user is destroyed,
+// including the current one.
+func DeleteAccount(
+	r *http.Request,
+	srw *session.SessionResponseWriter,
+	dbService database.Service,
+	password string,
+	code string,
+) (string, error) {
+	username, _ := session.GetSession(r).Get("username").(string)
+
+	if _, err := VerifyCredentials(r.Context(), dbService, User{Username: username, Password: []byte(password)}); err != nil {
+		slog.InfoContext(r.Context(), "Account deletion denied", "username", username, "err", err)
+		return username, ErrWrongPassword
+	}
+
+	required, err := TwoFactorRequired(r.Context(), dbService, username)
+	if err != nil {
+		return username, fmt.Errorf("error checking two-factor authentication: %w", err)
+	}
+	if required {
+		if err := VerifySecondFactor(r.Context(), dbService, username, code); err != nil {
+			return username, err
+		}
+	}
+
+	if err := dbService.DeleteUser(r.Context(), username); err != nil {
+		return username, fmt.Errorf("error deleting user %s: %w", username, err)
+	}
+
+	// The user is gone, sessions must not keep acting on its behalf
+	if _, err := RevokeUserSessions(r, srw.Manager, username, ""); err != nil {
+		slog.ErrorContext(r.Context(), "Failed to revoke the sessions of a deleted user", "username", username, "err", err)
+	}
+
+	return username, Logout(r, srw)
+}
@@ -0,0 +1,138 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/raziel-aleman/go-starter/internal/database"
+	"github.com/raziel-aleman/go-starter/internal/session"
+)
+
+var (
+	// ErrAccountDisabled is returned when a disabled or banned user tries to log in.
+	ErrAccountDisabled = errors.New("account disabled")
+	// ErrAccountBanned is returned when a banned user tries to log in. It
+	// matches ErrAccountDisabled.
+	ErrAccountBanned = fmt.Errorf("%w: banned", ErrAccountDisabled)
+)
+
+// statusError returns the error for users with a status other than active.
+func statusError(status database.UserStatus) error {
+	switch status {
+	case database.StatusActive:
+		return nil
+	case database.StatusBanned:
+		return ErrAccountBanned
+	default:
+		return ErrAccountDisabled
+	}
+}
+
+// ensureEnabled returns ErrAccountDisabled if the user has been disabled or banned.
+func ensureEnabled(ctx context.Context, users database.UserRepository, username string) error {
+	status, err := users.AccountStatus(ctx, username)
+	if err != nil {
+		return fmt.Errorf("error checking account status of %s: %w", username, err)
+	}
+	return statusError(status.Status)
+}
+
+// EnsureEnabled returns a function returning ErrAccountDisabled for users who
+// are disabled, banned or deleted, e.g. to reject their refresh tokens.
+func EnsureEnabled(users database.UserRepository) func(ctx context.Context, username string) error {
+	return func(ctx context.Context, username string) error {
+		err := ensureEnabled(ctx, users, username)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrAccountDisabled
+		}
+		return err
+	}
+}
+
+// DisableUser disables a user and logs out all its sessions.
+func DisableUser(r *http.Request, manager *session.SessionManager, dbService database.Service, username string) error {
+	return setStatus(r, manager, dbService, username, database.StatusDisabled)
+}
+
+// BanUser bans a user and logs out all its sessions.
+func BanUser(r *http.Request, manager *session.SessionManager, dbService database.Service, username string) error {
+	return setStatus(r, manager, dbService, username, database.StatusBanned)
+}
+
+// EnableUser re-activates a disabled or banned user.
+func EnableUser(ctx context.Context, users database.UserRepository, username string) error {
+	if err := users.SetUserStatus(ctx, username, database.StatusActive); err != nil {
+		return fmt.Errorf("error enabling %s: %w", username, err)
+	}
+	return nil
+}
+
+// setStatus changes the status of a user, revoking its sessions, refresh
+// tokens and API keys right away instead of waiting for their next use.
+func setStatus(
+	r *http.Request,
+	manager *session.SessionManager,
+	dbService database.Service,
+	username string,
+	status database.UserStatus,
+) error {
+	if err := dbService.SetUserStatus(r.Context(), username, status); err != nil {
+		return fmt.Errorf("error setting status of %s to %s: %w", username, status, err)
+	}
+	if _, err := RevokeUserSessions(r, manager, username, ""); err != nil {
+		return fmt.Errorf("error revoking sessions of %s: %w", username, err)
+	}
+	if err := dbService.RevokeUserRefreshTokens(r.Context(), username); err != nil {
+		return fmt.Errorf("error revoking refresh tokens of %s: %w", username, err)
+	}
+	if err := dbService.RevokeUserAPIKeys(r.Context(), username); err != nil {
+		return fmt.Errorf("error revoking API keys of %s: %w", username, err)
+	}
+	return nil
+}
+
+// ForcePasswordReset requires a user to change its password before using the
+// account again, and logs out all its sessions.
+func ForcePasswordReset(r *http.Request, manager *session.SessionManager, dbService database.Service, username string) error {
+	if err := dbService.RequirePasswordReset(r.Context(), username); err != nil {
+		return fmt.Errorf("error requiring password reset of %s: %w", username, err)
+	}
+	if _, err := RevokeUserSessions(r, manager, username, ""); err != nil {
+		return fmt.Errorf("error revoking sessions of %s: %w", username, err)
+	}
+	return nil
+}
+
+// DeleteUser soft-deletes a user and logs out all its sessions. The user can
+// be restored until it is purged.
+func DeleteUser(r *http.Request, manager *session.SessionManager, dbService database.Service, username string) error {
+	if err := dbService.DeleteUser(r.Context(), username); err != nil {
+		return fmt.Errorf("error deleting %s: %w", username, err)
+	}
+	if _, err := RevokeUserSessions(r, manager, username, ""); err != nil {
+		return fmt.Errorf("error revoking sessions of %s: %w", username, err)
+	}
+	return nil
+}
+
+// RestoreUser reverts the soft deletion of a user.
+func RestoreUser(ctx context.Context, users database.UserRepository, username string) error {
+	if err := users.RestoreUser(ctx, username); err != nil {
+		return fmt.Errorf("error restoring %s: %w", username, err)
+	}
+	return nil
+}
+
+// PurgeUser permanently removes a user, deleted or not, and logs out all its sessions.
+func PurgeUser(r *http.Request, manager *session.SessionManager, dbService database.Service, username string) error {
+	if err := dbService.PurgeUser(r.Context(), username); err != nil {
+		return fmt.Errorf("error purging %s: %w", username, err)
+	}
+	if _, err := RevokeUserSessions(r, manager, username, ""); err != nil {
+		return fmt.Errorf("error revoking sessions of %s: %w", username, err)
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/raziel-aleman/go-starter/internal/database"
+)
+
+// apiKeyPrefix identifies API keys issued by this service, e.g. in secret scanners.
+const apiKeyPrefix = "gs_"
+
+// CreateAPIKey issues a new API key for a user, restricted to the scopes if
+// any. The returned key is shown to the user once: only its hash is stored.
+func CreateAPIKey(
+	ctx context.Context,
+	dbService database.Service,
+	username string,
+	name string,
+	scopes []string,
+) (string, int64, error) {
+	if err := ValidateScopes(scopes); err != nil {
+		return "", 0, err
+	}
+
+	token, _, err := newToken()
+	if err != nil {
+		return "", 0, err
+	}
+	key := apiKeyPrefix + token
+
+	id, err := dbService.CreateAPIKey(ctx, username, name, key[:len(apiKeyPrefix)+6], hashToken(key), scopes)
+	if err != nil {
+		return "", 0, fmt.Errorf("error storing API key: %v", err)
+	}
+
+	return key, id, nil
+}
+
+// APIKeyMiddleware authenticates machine-to-machine clients by the key in the
+// "Authorization: ApiKey" header and stores the key owner and principal in the request context.
+func APIKeyMiddleware(dbService database.Service, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		scheme, key, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+		if !ok || !strings.EqualFold(scheme, "ApiKey") || key == "" {
+			w.Header().Set("WWW-Authenticate", `ApiKey`)
+			http.Error(w, "Unauthenticated", http.StatusUnauthorized)
+			return
+		}
+
+		username, scopes, err := dbService.AuthenticateAPIKey(r.Context(), hashToken(key))
+		if errors.Is(err, sql.ErrNoRows) {
+			w.Header().Set("WWW-Authenticate", `ApiKey error="invalid_key"`)
+			http.Error(w, "Unauthenticated", http.StatusUnauthorized)
+			return
+		}
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Failed to verify API key", "err", err)
+			http.Error(w, "Failed to verify API key", http.StatusInternalServerError)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), apiKeyUserKey, username)
+		ctx = withPrincipal(ctx, &Principal{Username: username, Method: MethodAPIKey, Scopes: scopes})
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// APIKeyUserFromContext returns the owner of the API key authenticated by APIKeyMiddleware.
+func APIKeyUserFromContext(ctx context.Context) (string, bool) {
+	username, ok := ctx.Value(apiKeyUserKey).(string)
+	return username, ok
+}
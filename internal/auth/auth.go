@@ -1,8 +1,11 @@
 package auth
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"log/slog"
 	"net/http"
 
 	"github.com/raziel-aleman/go-starter/internal/database"
@@ -12,48 +15,81 @@ import (
 
 // Exmample user struct.
 type User struct {
-	Username string `json:"username"`
-	Password []byte `json:"-"`
+	Username    string `json:"username"`
+	Email       string `json:"email,omitempty"`
+	DisplayName string `json:"display_name,omitempty"`
+	AvatarURL   string `json:"avatar_url,omitempty"`
+	Verified    bool   `json:"verified,omitempty"`
+	Password    []byte `json:"-"`
+	InviteCode  string `json:"-"` // Invitation code used to register, if any
 }
 
 // Register uses database service to register new user
-// by inserting new record in the database.
+// by inserting new record in the database. The password must meet the policy,
+// otherwise a *PasswordPolicyError is returned. In invite-only mode the user
+// must have a valid invitation code, which is used up by the registration.
+// The OnRegister hooks run on success.
 func Register(
+	ctx context.Context,
 	dbService database.Service,
+	mode RegistrationMode,
+	policy PasswordPolicy,
 	user User,
-) (int64, error) {
-	hashedPassword, err := bcrypt.GenerateFromPassword(
-		[]byte(user.Password),
-		bcrypt.DefaultCost,
-	)
-	if err != nil {
-		return 0, fmt.Errorf("error hashing user password while registering: %v", err)
+) (string, error) {
+	if mode == InviteOnlyRegistration && user.InviteCode == "" {
+		return "", ErrInvitationRequired
+	}
+
+	if err := policy.ValidateContext(ctx, user.Username, string(user.Password)); err != nil {
+		return "", err
 	}
 
-	result, err := dbService.RegisterUser(user.Username, hashedPassword)
+	hashedPassword, err := hashPassword(user.Password)
 	if err != nil {
-		return 0, fmt.Errorf("error registering user: %v", err)
+		return "", fmt.Errorf("error hashing user password while registering: %v", err)
 	}
 
-	id, err := result.LastInsertId()
+	var id string
+	if user.InviteCode != "" {
+		id, err = dbService.RegisterInvitedUser(ctx, hashToken(user.InviteCode), user.Username, user.Email, hashedPassword)
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", ErrInvalidInvitation
+		}
+	} else {
+		id, err = dbService.RegisterUser(ctx, user.Username, user.Email, hashedPassword)
+	}
 	if err != nil {
-		return 0, fmt.Errorf("error retreiving inserted row id: %v", err)
+		return "", fmt.Errorf("error registering user: %v", err)
 	}
 
+	runHooks(func(h Hooks) {
+		if h.OnRegister != nil {
+			h.OnRegister(ctx, User{Username: user.Username, Email: user.Email})
+		}
+	})
+
 	return id, nil
 }
 
 // VerifyCredentials uses database service to retrive hashed password and
-// then compare it with submitted password.
+// then compare it with submitted password. The username may also be the email
+// address of the user, the actual username is returned. Hashes with an outdated
+// cost are replaced by a hash with the current BcryptCost. Rejected credentials
+// run the OnFailedLogin hooks.
 func VerifyCredentials(
-	dbService database.Service,
+	ctx context.Context,
+	users database.UserRepository,
 	user User,
-) error {
-	var passwordInDB []byte
-
-	passwordInDB, err := dbService.VerifyCredentials(user.Username)
+) (string, error) {
+	username, passwordInDB, err := users.VerifyCredentials(ctx, user.Username)
+	if errors.Is(err, sql.ErrNoRows) {
+		// Hash anyway, so unknown logins take as long to reject as wrong passwords
+		bcrypt.CompareHashAndPassword(dummyHash(), user.Password)
+	}
 	if err != nil {
-		return fmt.Errorf("invalid username: %w", err)
+		err = fmt.Errorf("invalid username: %w", err)
+		failedLogin(ctx, user.Username, err)
+		return "", err
 	}
 
 	err = bcrypt.CompareHashAndPassword(
@@ -61,15 +97,74 @@ func VerifyCredentials(
 		user.Password,
 	)
 	if err != nil {
-		return fmt.Errorf("invalid password: %w", err)
+		err = fmt.Errorf("invalid password: %w", err)
+		failedLogin(ctx, username, err)
+		return "", err
+	}
+
+	if err := ensureEnabled(ctx, users, username); err != nil {
+		return "", err
 	}
 
+	// The plain text password is only available now, upgrade the hash while we have it
+	if needsRehash(passwordInDB) {
+		user.Username = username
+		if err := rehashPassword(ctx, users, user, passwordInDB); err != nil {
+			slog.ErrorContext(ctx, "Failed to upgrade password hash", "username", username, "err", err)
+		}
+	}
+
+	return username, nil
+}
+
+// failedLogin runs the OnFailedLogin hooks.
+func failedLogin(ctx context.Context, username string, err error) {
+	runHooks(func(h Hooks) {
+		if h.OnFailedLogin != nil {
+			h.OnFailedLogin(ctx, username, err)
+		}
+	})
+}
+
+// rehashPassword replaces the stored hash of a user with a hash using the
+// current cost, unless the password changed in the meantime.
+func rehashPassword(ctx context.Context, users database.UserRepository, user User, oldHash []byte) error {
+	newHash, err := hashPassword(user.Password)
+	if err != nil {
+		return fmt.Errorf("error rehashing password of %s: %v", user.Username, err)
+	}
+	if err := users.UpdatePasswordHash(ctx, user.Username, oldHash, newHash); err != nil {
+		return fmt.Errorf("error updating password hash of %s: %v", user.Username, err)
+	}
 	return nil
 }
 
-// Login migrates the session by calling the session manager in the session response writer
-// and updates the username value in the session.
+// Login starts an authenticated session for the user, see startSession, and
+// records its last login time.
 func Login(
+	r *http.Request,
+	srw *session.SessionResponseWriter,
+	users database.UserRepository,
+	user User,
+) error {
+	if err := startSession(r, srw, user); err != nil {
+		return err
+	}
+
+	// A failure to record the time does not fail the login
+	if err := users.RecordLogin(r.Context(), user.Username); err != nil {
+		slog.ErrorContext(r.Context(), "Failed to record login", "username", user.Username, "err", err)
+	}
+	return nil
+}
+
+// startSession migrates the session by calling the session manager in the session response writer
+// and updates the username value in the session. The client IP and user agent
+// are recorded to describe the session to the user, with the time of the
+// authentication for RequireRecentAuth. The domain data of a guest
+// session is merged by the registered MergeFuncs first, the login fails if they do.
+// The OnLogin hooks run on success.
+func startSession(
 	r *http.Request,
 	srw *session.SessionResponseWriter,
 	user User,
@@ -79,20 +174,33 @@ func Login(
 		return fmt.Errorf("session not found")
 	}
 
-	newSession, err := srw.Manager.Migrate(session)
+	if err := mergeGuest(r, session, user); err != nil {
+		return err
+	}
+
+	newSession, err := srw.Manager.Migrate(r.Context(), session)
 	if err != nil {
 		return fmt.Errorf("failed to migrate session: %w", err)
 	}
 
 	newSession.Put("username", user.Username)
+	newSession.Put(clientIPKey, ClientIP(r))
+	newSession.Put(userAgentKey, r.UserAgent())
+	markAuthenticated(newSession)
 
 	srw.Session = newSession
 
+	runHooks(func(h Hooks) {
+		if h.OnLogin != nil {
+			h.OnLogin(r.Context(), user)
+		}
+	})
+
 	return nil
 }
 
 // Logout destroys the session in the session manager and
-// sets the session destroyed flag in the session response writer.
+// sets the session destroyed flag in the session response writer, then runs the OnLogout hooks.
 func Logout(
 	r *http.Request,
 	srw *session.SessionResponseWriter,
@@ -104,20 +212,27 @@ func Logout(
 	}
 
 	// Destroy the session in the store
-	if err := srw.Manager.Store.Destroy(session.ID); err != nil {
+	if err := srw.Manager.Store.Destroy(r.Context(), session.ID); err != nil {
 		return fmt.Errorf("error destroying session %s: %v", session.ID, err)
 	}
 
 	srw.SessionDestroyed = true
 	srw.Session = nil
 
+	username, _ := session.Get("username").(string)
+	runHooks(func(h Hooks) {
+		if h.OnLogout != nil {
+			h.OnLogout(r.Context(), username)
+		}
+	})
+
 	return nil
 }
 
 // AuthMiddleware checks the username in the request session, if it is "guest" the user
 // is not authenticated, if it is different,it will then check against the database that
-// the user is registered.
-func AuthMiddleware(dbservice database.Service, next http.Handler) http.Handler {
+// the user is registered. The user is stored as the principal in the request context.
+func AuthMiddleware(users database.UserRepository, next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		session := session.GetSession(r)
 
@@ -127,12 +242,41 @@ func AuthMiddleware(dbservice database.Service, next http.Handler) http.Handler
 			return
 		}
 
-		err := dbservice.UserExists(username)
+		// A database failure is not the user's fault, so it is not reported
+		// as a missing user, which would log them out of a valid session
+		exists, err := users.UserExists(r.Context(), username)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Failed to check user", "username", username, "err", err)
+			http.Error(w, "Failed to check user", http.StatusServiceUnavailable)
+			return
+		}
+		if !exists {
+			http.Error(w, "Unauthenticated", http.StatusForbidden)
+			return
+		}
+
+		status, err := users.AccountStatus(r.Context(), username)
 		if err == sql.ErrNoRows {
 			http.Error(w, "Unauthenticated", http.StatusForbidden)
 			return
 		}
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Failed to check account status", "username", username, "err", err)
+			http.Error(w, "Failed to check account status", http.StatusServiceUnavailable)
+			return
+		}
+		// Disabled and banned users are rejected even with a valid session
+		if err := statusError(status.Status); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		// Only the password change is allowed until a required reset is done
+		if status.PasswordResetRequired && r.URL.Path != "/password/change" {
+			http.Error(w, "Password change required", http.StatusForbidden)
+			return
+		}
 
-		next.ServeHTTP(w, r)
+		ctx := withPrincipal(r.Context(), &Principal{Username: username, Method: MethodSession})
+		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
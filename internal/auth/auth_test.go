@@ -0,0 +1,53 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/raziel-aleman/go-starter/internal/database"
+	"github.com/raziel-aleman/go-starter/internal/database/fake"
+	"github.com/raziel-aleman/go-starter/internal/session"
+	"github.com/raziel-aleman/go-starter/internal/store"
+)
+
+// unavailable is a user repository whose database is down.
+type unavailable struct {
+	*fake.Service
+}
+
+func (unavailable) UserExists(context.Context, string) (bool, error) {
+	return false, errors.New("database is locked")
+}
+
+func TestAuthMiddleware(t *testing.T) {
+	db := fake.New()
+	db.RegisterUser(context.Background(), "alice", "", []byte("hash"))
+	sm := session.NewSessionManager(store.NewInMemorySessionStore(), "GOSESSID", time.Minute, time.Hour)
+
+	tests := []struct {
+		username string
+		users    database.UserRepository
+		status   int
+	}{
+		{"alice", db, http.StatusOK},
+		{"bob", db, http.StatusForbidden},
+		{"guest", db, http.StatusForbidden},
+		{"alice", unavailable{db}, http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		handler := sm.SessionMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			session.GetSession(r).Put("username", tt.username)
+			AuthMiddleware(tt.users, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).ServeHTTP(w, r)
+		}))
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+		if rec.Code != tt.status {
+			t.Errorf("%s: expected status %d; got %d", tt.username, tt.status, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/raziel-aleman/go-starter/internal/database"
+	"github.com/raziel-aleman/go-starter/internal/jwt"
+)
+
+// ErrInvalidBearerToken is returned by token validators for tokens they do not accept.
+var ErrInvalidBearerToken = errors.New("invalid bearer token")
+
+// Authentication methods of a Principal.
+const (
+	MethodSession     = "session"
+	MethodJWT         = "jwt"
+	MethodAPIKey      = "apikey"
+	MethodBasic       = "basic"
+	MethodCertificate = "certificate"
+)
+
+// Principal is the authenticated caller of a request, whatever the
+// authentication method. The auth middlewares store it in the request context.
+type Principal struct {
+	Username string
+	Method   string
+	Scopes   []string // Scopes granted to the token, none means unrestricted
+	ClientID string   // OAuth client the token was issued to, if any
+}
+
+// PrincipalFromContext returns the principal stored by the auth middlewares.
+func PrincipalFromContext(ctx context.Context) (*Principal, bool) {
+	principal, ok := ctx.Value(principalKey).(*Principal)
+	return principal, ok
+}
+
+// withPrincipal stores the principal in the context.
+func withPrincipal(ctx context.Context, principal *Principal) context.Context {
+	return context.WithValue(ctx, principalKey, principal)
+}
+
+// TokenValidator validates bearer tokens and returns their principal. Tokens
+// it does not accept return ErrInvalidBearerToken.
+type TokenValidator interface {
+	ValidateToken(ctx context.Context, token string) (*Principal, error)
+}
+
+// TokenValidatorFunc adapts a function to the TokenValidator interface.
+type TokenValidatorFunc func(ctx context.Context, token string) (*Principal, error)
+
+// ValidateToken calls f.
+func (f TokenValidatorFunc) ValidateToken(ctx context.Context, token string) (*Principal, error) {
+	return f(ctx, token)
+}
+
+// JWTValidator accepts access tokens issued by the token manager.
+func JWTValidator(tokens *jwt.Manager) TokenValidator {
+	return TokenValidatorFunc(func(ctx context.Context, token string) (*Principal, error) {
+		claims, err := tokens.Verify(token)
+		if err != nil {
+			return nil, ErrInvalidBearerToken
+		}
+		return &Principal{Username: claims.Subject, Method: MethodJWT, Scopes: strings.Fields(claims.Scope), ClientID: claims.ClientID}, nil
+	})
+}
+
+// APIKeyValidator accepts API keys as opaque bearer tokens.
+func APIKeyValidator(dbService database.Service) TokenValidator {
+	return TokenValidatorFunc(func(ctx context.Context, token string) (*Principal, error) {
+		username, scopes, err := dbService.AuthenticateAPIKey(ctx, hashToken(token))
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrInvalidBearerToken
+		}
+		if err != nil {
+			return nil, err
+		}
+		return &Principal{Username: username, Method: MethodAPIKey, Scopes: scopes}, nil
+	})
+}
+
+// EnabledValidator accepts the tokens accepted by the validator, unless their
+// user is disabled, banned or deleted: access tokens stop working right away
+// instead of when they expire.
+func EnabledValidator(users database.UserRepository, validator TokenValidator) TokenValidator {
+	return TokenValidatorFunc(func(ctx context.Context, token string) (*Principal, error) {
+		principal, err := validator.ValidateToken(ctx, token)
+		if err != nil {
+			return nil, err
+		}
+		err = ensureEnabled(ctx, users, principal.Username)
+		if errors.Is(err, ErrAccountDisabled) || errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrInvalidBearerToken
+		}
+		if err != nil {
+			return nil, err
+		}
+		return principal, nil
+	})
+}
+
+// AnyValidator accepts the tokens accepted by any of the validators, tried in order.
+func AnyValidator(validators ...TokenValidator) TokenValidator {
+	return TokenValidatorFunc(func(ctx context.Context, token string) (*Principal, error) {
+		for _, validator := range validators {
+			principal, err := validator.ValidateToken(ctx, token)
+			if !errors.Is(err, ErrInvalidBearerToken) {
+				return principal, err
+			}
+		}
+		return nil, ErrInvalidBearerToken
+	})
+}
+
+// BearerMiddleware authenticates the "Authorization: Bearer" token of the
+// request with the validator and stores the principal in the request context.
+// It is the token counterpart of AuthMiddleware.
+func BearerMiddleware(validator TokenValidator, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := bearerToken(r)
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Bearer`)
+			http.Error(w, "Unauthenticated", http.StatusUnauthorized)
+			return
+		}
+
+		principal, err := validator.ValidateToken(r.Context(), token)
+		if errors.Is(err, ErrInvalidBearerToken) {
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			http.Error(w, "Unauthenticated", http.StatusUnauthorized)
+			return
+		}
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Failed to verify token", "err", err)
+			http.Error(w, "Failed to verify token", http.StatusInternalServerError)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(withPrincipal(r.Context(), principal)))
+	})
+}
@@ -0,0 +1,146 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/raziel-aleman/go-starter/internal/database/fake"
+	"github.com/raziel-aleman/go-starter/internal/jwt"
+	"github.com/raziel-aleman/go-starter/internal/session"
+	"github.com/raziel-aleman/go-starter/internal/store"
+)
+
+func TestBearerMiddleware(t *testing.T) {
+	tokens := jwt.NewManager([]byte("secret"), time.Minute, time.Hour, jwt.NewInMemoryRefreshStore())
+	pair, err := tokens.Issue(context.Background(), "alice")
+	if err != nil {
+		t.Fatalf("error issuing tokens. Err: %v", err)
+	}
+	opaque := TokenValidatorFunc(func(_ context.Context, token string) (*Principal, error) {
+		if token != "opaque" {
+			return nil, ErrInvalidBearerToken
+		}
+		return &Principal{Username: "bob", Method: "opaque"}, nil
+	})
+
+	var principal *Principal
+	handler := BearerMiddleware(AnyValidator(JWTValidator(tokens), opaque), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, _ = PrincipalFromContext(r.Context())
+	}))
+
+	tests := []struct {
+		header   string
+		status   int
+		username string
+	}{
+		{"Bearer " + pair.AccessToken, http.StatusOK, "alice"},
+		{"Bearer opaque", http.StatusOK, "bob"},
+		{"Bearer invalid", http.StatusUnauthorized, ""},
+		{"", http.StatusUnauthorized, ""},
+	}
+	for _, tt := range tests {
+		principal = nil
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Authorization", tt.header)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		if rec.Code != tt.status {
+			t.Errorf("%q: expected status %d; got %d", tt.header, tt.status, rec.Code)
+		}
+		if tt.username != "" && (principal == nil || principal.Username != tt.username) {
+			t.Errorf("%q: expected principal %s; got %+v", tt.header, tt.username, principal)
+		}
+	}
+}
+
+func TestRequireScope(t *testing.T) {
+	tokens := jwt.NewManager([]byte("secret"), time.Minute, time.Hour, jwt.NewInMemoryRefreshStore())
+	handler := BearerMiddleware(JWTValidator(tokens), RequireScope("users:read", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+
+	tests := []struct {
+		scopes []string
+		status int
+	}{
+		{nil, http.StatusOK},
+		{[]string{"users:read", "sessions:write"}, http.StatusOK},
+		{[]string{"sessions:write"}, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		pair, err := tokens.Issue(context.Background(), "alice", tt.scopes...)
+		if err != nil {
+			t.Fatalf("error issuing tokens. Err: %v", err)
+		}
+		// Refreshed tokens keep the scopes of the family
+		pair, err = tokens.Refresh(context.Background(), pair.RefreshToken)
+		if err != nil {
+			t.Fatalf("error refreshing tokens. Err: %v", err)
+		}
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Authorization", "Bearer "+pair.AccessToken)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != tt.status {
+			t.Errorf("%v: expected status %d; got %d", tt.scopes, tt.status, rec.Code)
+		}
+	}
+}
+
+func TestDisabledUserCredentials(t *testing.T) {
+	ctx := context.Background()
+	db := fake.New()
+	db.RegisterUser(ctx, "alice", "", []byte("hash"))
+	sm := session.NewSessionManager(store.NewInMemorySessionStore(), "GOSESSID", time.Minute, time.Hour)
+	tokens := jwt.NewManager([]byte("secret"), time.Minute, time.Hour, jwt.NewDatabaseRefreshStore(db))
+	tokens.Authorize = EnsureEnabled(db)
+
+	pair, err := tokens.Issue(ctx, "alice")
+	if err != nil {
+		t.Fatalf("error issuing tokens. Err: %v", err)
+	}
+	key, _, err := CreateAPIKey(ctx, db, "alice", "ci", nil)
+	if err != nil {
+		t.Fatalf("error creating API key. Err: %v", err)
+	}
+	handler := BearerMiddleware(
+		EnabledValidator(db, AnyValidator(JWTValidator(tokens), APIKeyValidator(db))),
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}),
+	)
+	status := func(token string) int {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	for _, token := range []string{pair.AccessToken, key} {
+		if code := status(token); code != http.StatusOK {
+			t.Fatalf("expected status %d before the ban; got %d", http.StatusOK, code)
+		}
+	}
+
+	if err := BanUser(httptest.NewRequest(http.MethodPost, "/", nil), sm, db, "alice"); err != nil {
+		t.Fatalf("error banning user. Err: %v", err)
+	}
+	for _, token := range []string{pair.AccessToken, key} {
+		if code := status(token); code != http.StatusUnauthorized {
+			t.Errorf("expected status %d after the ban; got %d", http.StatusUnauthorized, code)
+		}
+	}
+	if _, err := tokens.Refresh(ctx, pair.RefreshToken); !errors.Is(err, jwt.ErrInvalidRefreshToken) {
+		t.Errorf("expected the refresh token to be revoked; got %v", err)
+	}
+
+	// Re-enabling the user does not bring its credentials back
+	if err := EnableUser(ctx, db, "alice"); err != nil {
+		t.Fatalf("error enabling user. Err: %v", err)
+	}
+	if code := status(key); code != http.StatusUnauthorized {
+		t.Errorf("expected the API key to stay revoked; got status %d", code)
+	}
+}
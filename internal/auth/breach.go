@@ -0,0 +1,67 @@
+package auth
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// BreachChecker checks passwords against the Have I Been Pwned range API. Only
+// the first 5 characters of the SHA-1 hash leave the server (k-anonymity).
+type BreachChecker struct {
+	Client   *http.Client
+	Endpoint string        // Range API URL, the hash prefix is appended
+	Timeout  time.Duration // Checks taking longer are skipped (fail-open)
+	Reject   bool          // Reject breached passwords instead of only logging a warning
+}
+
+// NewBreachChecker creates a checker for the public Have I Been Pwned API.
+func NewBreachChecker(reject bool) *BreachChecker {
+	return &BreachChecker{
+		Client:   http.DefaultClient,
+		Endpoint: "https://api.pwnedpasswords.com/range/",
+		Timeout:  2 * time.Second,
+		Reject:   reject,
+	}
+}
+
+// Breached returns how many times the password appears in known breaches.
+func (c *BreachChecker) Breached(ctx context.Context, password string) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.Timeout)
+	defer cancel()
+
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:5], hash[5:]
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.Endpoint+prefix, nil)
+	if err != nil {
+		return 0, err
+	}
+	// Padding hides the number of matching suffixes from observers of the response size
+	req.Header.Set("Add-Padding", "true")
+
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("error querying breached passwords: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("unexpected status from breached passwords API: %s", resp.Status)
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		candidate, count, ok := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if ok && candidate == suffix {
+			return strconv.Atoi(count)
+		}
+	}
+	return 0, scanner.Err()
+}
@@ -0,0 +1,43 @@
+package captcha
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSiteVerify(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("secret") != "secret" {
+			http.Error(w, "bad secret", http.StatusBadRequest)
+			return
+		}
+		switch r.FormValue("response") {
+		case "human":
+			fmt.Fprint(w, `{"success": true}`)
+		case "bot":
+			fmt.Fprint(w, `{"success": true, "score": 0.1}`)
+		default:
+			fmt.Fprint(w, `{"success": false, "error-codes": ["invalid-input-response"]}`)
+		}
+	}))
+	defer server.Close()
+
+	c := NewReCAPTCHA("secret", 0.5)
+	c.Endpoint = server.URL
+
+	tests := map[string]error{
+		"human":   nil,
+		"bot":     ErrFailed,
+		"invalid": ErrFailed,
+		"":        ErrFailed,
+	}
+	for response, expected := range tests {
+		if err := c.Verify(context.Background(), response, "203.0.113.1"); !errors.Is(err, expected) {
+			t.Errorf("%q: expected %v; got %v", response, expected, err)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package auth
+
+import (
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/raziel-aleman/go-starter/internal/database"
+)
+
+// Authentication audit log event types.
+const (
+	EventLoginSuccess          = "login_success"
+	EventLoginFailure          = "login_failure"
+	EventLogout                = "logout"
+	EventRegister              = "register"
+	EventPasswordChange        = "password_change"
+	EventSessionRevoked        = "session_revoked"
+	EventAccountDeleted        = "account_deleted"
+	EventAccountRestored       = "account_restored"
+	EventAccountPurged         = "account_purged"
+	EventAccountDisabled       = "account_disabled"
+	EventAccountEnabled        = "account_enabled"
+	EventAccountBanned         = "account_banned"
+	EventPasswordResetRequired = "password_reset_required"
+	EventImpersonationStart    = "impersonation_start"
+	EventImpersonationStop     = "impersonation_stop"
+	EventInvitationCreated     = "invitation_created"
+	EventIdentityLinked        = "identity_linked"
+	EventIdentityUnlinked      = "identity_unlinked"
+	EventOAuthClientCreated    = "oauth_client_created"
+)
+
+// RecordEvent appends an event for a user to the audit log with the client IP
+// and user agent of the request. Events during an impersonation name the
+// impersonating admin in the detail. Failing to record an event is logged but does
+// not fail the request.
+func RecordEvent(
+	r *http.Request,
+	dbService database.Service,
+	eventType string,
+	username string,
+	detail string,
+) {
+	if impersonator := Impersonator(r); impersonator != "" {
+		detail = strings.TrimSpace(detail + " impersonated by " + impersonator)
+	}
+
+	err := dbService.RecordAuthEvent(r.Context(), database.AuthEvent{
+		Type:      eventType,
+		Username:  username,
+		IP:        ClientIP(r),
+		UserAgent: r.UserAgent(),
+		Detail:    detail,
+	})
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to record auth event", "type", eventType, "username", username, "err", err)
+	}
+}
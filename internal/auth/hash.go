@@ -0,0 +1,53 @@
+package auth
+
+import (
+	"fmt"
+	"sync"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// BcryptCost is the cost of new password hashes. Stored hashes with a
+// different cost are upgraded on the next successful login.
+var BcryptCost = bcrypt.DefaultCost
+
+// SetBcryptCost validates and sets the cost of new password hashes.
+func SetBcryptCost(cost int) error {
+	if cost < bcrypt.MinCost || cost > bcrypt.MaxCost {
+		return fmt.Errorf("bcrypt cost must be between %d and %d, got %d", bcrypt.MinCost, bcrypt.MaxCost, cost)
+	}
+	BcryptCost = cost
+	return nil
+}
+
+// hashPassword hashes a password with the configured cost.
+func hashPassword(password []byte) ([]byte, error) {
+	return bcrypt.GenerateFromPassword(password, BcryptCost)
+}
+
+// needsRehash reports whether a stored hash was created with an outdated cost.
+func needsRehash(hash []byte) bool {
+	cost, err := bcrypt.Cost(hash)
+	return err != nil || cost != BcryptCost
+}
+
+// dummy caches a hash with the current BcryptCost, compared against when a
+// login does not exist.
+var dummy struct {
+	sync.Mutex
+	cost int
+	hash []byte
+}
+
+// dummyHash returns a fixed password hash with the current BcryptCost, so
+// comparing against it takes as long as comparing against a stored hash.
+func dummyHash() []byte {
+	dummy.Lock()
+	defer dummy.Unlock()
+	if dummy.hash == nil || dummy.cost != BcryptCost {
+		// The error is impossible with a cost validated by SetBcryptCost
+		dummy.hash, _ = bcrypt.GenerateFromPassword([]byte("dummy password"), BcryptCost)
+		dummy.cost = BcryptCost
+	}
+	return dummy.hash
+}
@@ -0,0 +1,43 @@
+package auth
+
+import (
+	"context"
+	"sync"
+)
+
+// Hooks are callbacks run on authentication events, e.g. to send a welcome
+// email, update the last seen time, or feed a SIEM. They run synchronously in
+// the request, slow work should be moved to a goroutine. Nil callbacks are skipped.
+type Hooks struct {
+	// OnLogin runs after a user logged in.
+	OnLogin func(ctx context.Context, user User)
+	// OnLogout runs after a user logged out.
+	OnLogout func(ctx context.Context, username string)
+	// OnRegister runs after a user registered.
+	OnRegister func(ctx context.Context, user User)
+	// OnFailedLogin runs when the credentials of a user are rejected.
+	OnFailedLogin func(ctx context.Context, username string, err error)
+}
+
+// hooks holds the registered Hooks.
+var hooks struct {
+	sync.RWMutex
+	registered []Hooks
+}
+
+// RegisterHooks registers callbacks run on authentication events, after the
+// ones registered before.
+func RegisterHooks(h Hooks) {
+	hooks.Lock()
+	defer hooks.Unlock()
+	hooks.registered = append(hooks.registered, h)
+}
+
+// runHooks calls fn for every registered Hooks.
+func runHooks(fn func(h Hooks)) {
+	hooks.RLock()
+	defer hooks.RUnlock()
+	for _, h := range hooks.registered {
+		fn(h)
+	}
+}
@@ -0,0 +1,96 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/raziel-aleman/go-starter/internal/auth/oauth"
+	"github.com/raziel-aleman/go-starter/internal/database"
+)
+
+var (
+	// ErrIdentityLinked is returned when linking an identity already linked to
+	// an account, or a provider the user already linked.
+	ErrIdentityLinked = errors.New("identity already linked to an account")
+	// ErrEmailConflict is returned when a new external identity has the email
+	// of an existing user, who must log in and link the provider instead. The
+	// account is not linked automatically, the provider might not own the email.
+	ErrEmailConflict = errors.New("an account with this email already exists, log in to link the provider")
+	// ErrLastIdentity is returned when unlinking the only identity the user can
+	// log in with.
+	ErrLastIdentity = errors.New("cannot unlink the only login method of the account")
+)
+
+// LinkIdentity links an external identity to a user, so the user can log in
+// through the provider.
+func LinkIdentity(
+	ctx context.Context,
+	dbService database.Service,
+	username string,
+	identity *oauth.Identity,
+) error {
+	linked, err := dbService.FindIdentity(ctx, identity.Provider, identity.Subject)
+	if err == nil {
+		if linked.Username == username {
+			return nil
+		}
+		return ErrIdentityLinked
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("error retrieving %s identity: %v", identity.Provider, err)
+	}
+
+	identities, err := dbService.UserIdentities(ctx, username)
+	if err != nil {
+		return fmt.Errorf("error retrieving identities of %s: %v", username, err)
+	}
+	for _, i := range identities {
+		if i.Provider == identity.Provider {
+			return ErrIdentityLinked
+		}
+	}
+
+	return linkIdentity(ctx, dbService, username, identity)
+}
+
+// UnlinkIdentity removes the identity of a provider from a user. Users created
+// through the provider only have a random password, their identity can only
+// be unlinked while another one is linked. It returns sql.ErrNoRows if the user
+// has no identity of the provider.
+func UnlinkIdentity(
+	ctx context.Context,
+	dbService database.Service,
+	username string,
+	provider string,
+) error {
+	identities, err := dbService.UserIdentities(ctx, username)
+	if err != nil {
+		return fmt.Errorf("error retrieving identities of %s: %v", username, err)
+	}
+	for _, identity := range identities {
+		if identity.Provider == provider && username == provider+":"+identity.Subject && len(identities) == 1 {
+			return ErrLastIdentity
+		}
+	}
+
+	if err := dbService.UnlinkIdentity(ctx, username, provider); err != nil {
+		return fmt.Errorf("error unlinking %s identity of %s: %w", provider, username, err)
+	}
+	return nil
+}
+
+// linkIdentity stores the link between an identity and a user.
+func linkIdentity(ctx context.Context, dbService database.Service, username string, identity *oauth.Identity) error {
+	err := dbService.LinkIdentity(ctx, database.Identity{
+		Provider: identity.Provider,
+		Subject:  identity.Subject,
+		Username: username,
+		Email:    identity.Email,
+	})
+	if err != nil {
+		return fmt.Errorf("error linking %s identity to %s: %v", identity.Provider, username, err)
+	}
+	return nil
+}
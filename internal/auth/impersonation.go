@@ -0,0 +1,105 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/raziel-aleman/go-starter/internal/database"
+	"github.com/raziel-aleman/go-starter/internal/session"
+)
+
+// impersonatorKey is the reserved session key holding the username of the
+// admin while impersonating another user.
+const impersonatorKey = "impersonator"
+
+var (
+	// ErrCannotImpersonate is returned when the target user may not be impersonated.
+	ErrCannotImpersonate = errors.New("user cannot be impersonated")
+	// ErrNotImpersonating is returned when stopping without an impersonation in progress.
+	ErrNotImpersonating = errors.New("not impersonating a user")
+	// ErrImpersonating is returned for actions not allowed while impersonating.
+	ErrImpersonating = errors.New("not allowed while impersonating")
+)
+
+// Impersonator returns the username of the admin impersonating the logged-in
+// user, or "" if the session is not an impersonation. It is meant to show a
+// banner while impersonating.
+func Impersonator(r *http.Request) string {
+	s := session.GetSession(r)
+	if s == nil {
+		return ""
+	}
+	impersonator, _ := s.Get(impersonatorKey).(string)
+	return impersonator
+}
+
+// StartImpersonation logs the admin of the session in as another user,
+// keeping the admin identity in the session until StopImpersonation. Admins
+// and disabled users cannot be impersonated. It returns the admin username.
+func StartImpersonation(
+	r *http.Request,
+	srw *session.SessionResponseWriter,
+	dbService database.Service,
+	username string,
+) (string, error) {
+	admin, _ := session.GetSession(r).Get("username").(string)
+	if Impersonator(r) != "" {
+		return admin, ErrImpersonating
+	}
+	if username == admin {
+		return admin, ErrCannotImpersonate
+	}
+
+	if err := ensureEnabled(r.Context(), dbService, username); err != nil {
+		return admin, err
+	}
+	isAdmin, err := dbService.HasRole(r.Context(), username, RoleAdmin)
+	if err != nil {
+		return admin, fmt.Errorf("error checking roles of %s: %v", username, err)
+	}
+	if isAdmin {
+		return admin, ErrCannotImpersonate
+	}
+
+	if err := startSession(r, srw, User{Username: username}); err != nil {
+		return admin, err
+	}
+	srw.Session.Put(impersonatorKey, admin)
+	// The user never authenticated in this session
+	srw.Session.Delete(authenticatedAtKey)
+	return admin, nil
+}
+
+// StopImpersonation logs the admin back in as itself. It returns the admin
+// and the impersonated usernames.
+func StopImpersonation(
+	r *http.Request,
+	srw *session.SessionResponseWriter,
+) (string, string, error) {
+	admin := Impersonator(r)
+	username, _ := session.GetSession(r).Get("username").(string)
+	if admin == "" {
+		return "", username, ErrNotImpersonating
+	}
+
+	if err := startSession(r, srw, User{Username: admin}); err != nil {
+		return admin, username, err
+	}
+	srw.Session.Delete(impersonatorKey)
+	// Switching back is not a proof of identity, sensitive actions need a reauthentication
+	srw.Session.Delete(authenticatedAtKey)
+	return admin, username, nil
+}
+
+// DenyImpersonation rejects requests made while impersonating, for actions
+// like changing credentials that an admin must not take on behalf of a user.
+func DenyImpersonation(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if Impersonator(r) != "" {
+			http.Error(w, ErrImpersonating.Error(), http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
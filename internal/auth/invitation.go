@@ -0,0 +1,69 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/raziel-aleman/go-starter/internal/database"
+)
+
+// RegistrationMode controls who can register.
+type RegistrationMode int
+
+const (
+	// OpenRegistration lets anyone register.
+	OpenRegistration RegistrationMode = iota
+	// InviteOnlyRegistration requires a valid invitation code to register.
+	InviteOnlyRegistration
+)
+
+var (
+	// ErrInvitationRequired is returned when registering without an invitation in invite-only mode.
+	ErrInvitationRequired = errors.New("an invitation is required to register")
+	// ErrInvalidInvitation is returned for unknown, expired, or used up invitations.
+	ErrInvalidInvitation = errors.New("invalid or expired invitation")
+)
+
+// Invitation is a newly created invitation. The code is only available here.
+type Invitation struct {
+	Code      string    `json:"code"`
+	MaxUses   int       `json:"max_uses"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// CreateInvitation creates an invitation code, created by an admin, that can
+// register up to maxUses users within ttl.
+func CreateInvitation(
+	ctx context.Context,
+	dbService database.Service,
+	createdBy string,
+	maxUses int,
+	ttl time.Duration,
+) (Invitation, error) {
+	if maxUses < 1 || ttl <= 0 {
+		return Invitation{}, fmt.Errorf("invitation must allow at least one use for a positive duration")
+	}
+
+	code, hash, err := newToken()
+	if err != nil {
+		return Invitation{}, err
+	}
+
+	invitation := Invitation{
+		Code:      code,
+		MaxUses:   maxUses,
+		ExpiresAt: time.Now().Add(ttl).UTC().Truncate(time.Second),
+	}
+	err = dbService.CreateInvitation(ctx, hash, database.Invitation{
+		CreatedBy: createdBy,
+		MaxUses:   maxUses,
+		ExpiresAt: invitation.ExpiresAt,
+	})
+	if err != nil {
+		return Invitation{}, fmt.Errorf("error storing invitation: %v", err)
+	}
+
+	return invitation, nil
+}
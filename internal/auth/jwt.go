@@ -0,0 +1,109 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/raziel-aleman/go-starter/internal/database"
+	"github.com/raziel-aleman/go-starter/internal/jwt"
+)
+
+// authContextKey is a type for context keys to avoid collisions.
+type authContextKey int
+
+const (
+	claimsKey authContextKey = iota
+	apiKeyUserKey
+	principalKey
+)
+
+// TokenLogin verifies the user credentials, by username or email, and the two-factor code if the user
+// enabled 2FA, then issues an access and refresh token pair restricted to the
+// scopes if any. It returns ErrPasswordExpired instead if the password is
+// older than the policy allows.
+func TokenLogin(
+	ctx context.Context,
+	dbService database.Service,
+	tokens *jwt.Manager,
+	policy PasswordPolicy,
+	user User,
+	code string,
+	scopes []string,
+) (*jwt.TokenPair, error) {
+	if err := ValidateScopes(scopes); err != nil {
+		return nil, err
+	}
+
+	username, err := VerifyCredentials(ctx, dbService, user)
+	if err != nil {
+		return nil, err
+	}
+	user.Username = username
+
+	required, err := TwoFactorRequired(ctx, dbService, user.Username)
+	if err != nil {
+		return nil, fmt.Errorf("error checking two-factor authentication: %w", err)
+	}
+	if required {
+		if err := VerifySecondFactor(ctx, dbService, user.Username, code); err != nil {
+			return nil, err
+		}
+	}
+
+	// Tokens cannot be limited to the change password flow like sessions
+	expired, err := passwordExpired(ctx, dbService, policy, user.Username)
+	if err != nil {
+		return nil, err
+	}
+	if expired {
+		return nil, ErrPasswordExpired
+	}
+
+	pair, err := tokens.Issue(ctx, user.Username, scopes...)
+	if err != nil {
+		return nil, fmt.Errorf("error issuing tokens: %w", err)
+	}
+
+	return pair, nil
+}
+
+// JWTMiddleware validates the access token in the "Authorization: Bearer" header
+// and stores its claims and principal in the request context.
+func JWTMiddleware(tokens *jwt.Manager, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := bearerToken(r)
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Bearer`)
+			http.Error(w, "Unauthenticated", http.StatusUnauthorized)
+			return
+		}
+
+		claims, err := tokens.Verify(token)
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			http.Error(w, "Unauthenticated", http.StatusUnauthorized)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), claimsKey, claims)
+		ctx = withPrincipal(ctx, &Principal{Username: claims.Subject, Method: MethodJWT, Scopes: strings.Fields(claims.Scope)})
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// ClaimsFromContext returns the access token claims stored by JWTMiddleware.
+func ClaimsFromContext(ctx context.Context) (*jwt.Claims, bool) {
+	claims, ok := ctx.Value(claimsKey).(*jwt.Claims)
+	return claims, ok
+}
+
+// bearerToken extracts the token from the "Authorization: Bearer" header.
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") || token == "" {
+		return "", false
+	}
+	return token, true
+}
@@ -0,0 +1,98 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/raziel-aleman/go-starter/internal/database"
+	"github.com/raziel-aleman/go-starter/internal/mail"
+)
+
+const (
+	// magicLinkTTL is how long a login link stays valid.
+	magicLinkTTL = 15 * time.Minute
+	// magicLinkLimit is the number of login links a user can request per magicLinkTTL.
+	magicLinkLimit = 3
+)
+
+var (
+	// ErrInvalidMagicLink is returned for unknown, used, or expired login links.
+	ErrInvalidMagicLink = errors.New("invalid or expired login link")
+	// ErrMagicLinkThrottled is returned when a user requested too many login links.
+	ErrMagicLinkThrottled = errors.New("too many login links requested")
+)
+
+// RequestMagicLink emails a single-use login link to the /login/magic endpoint
+// under baseURL. Unknown emails are ignored so callers cannot probe which
+// addresses have an account.
+func RequestMagicLink(
+	ctx context.Context,
+	dbService database.Service,
+	mailer mail.Mailer,
+	email string,
+	baseURL string,
+) error {
+	profile, err := dbService.FindUserByEmail(ctx, email)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error retrieving user by email: %v", err)
+	}
+	username := profile.Username
+
+	count, err := dbService.CountMagicLinks(ctx, username, time.Now().Add(-magicLinkTTL))
+	if err != nil {
+		return fmt.Errorf("error counting login links: %v", err)
+	}
+	if count >= magicLinkLimit {
+		return ErrMagicLinkThrottled
+	}
+
+	token, hash, err := newToken()
+	if err != nil {
+		return err
+	}
+
+	if err := dbService.CreateMagicLink(ctx, username, hash, time.Now().Add(magicLinkTTL)); err != nil {
+		return fmt.Errorf("error storing login link: %v", err)
+	}
+
+	link := baseURL + "/login/magic?token=" + url.QueryEscape(token)
+	err = mailer.Send(ctx, mail.Message{
+		To:      email,
+		Subject: "Your login link",
+		Body: "Open the following link to log in. It expires in " + magicLinkTTL.String() +
+			" and can only be used once:\n\n" + link + "\n",
+	})
+	if err != nil {
+		return fmt.Errorf("error sending login link: %v", err)
+	}
+
+	return nil
+}
+
+// VerifyMagicLink consumes a login link token and returns its user.
+func VerifyMagicLink(
+	ctx context.Context,
+	dbService database.Service,
+	token string,
+) (User, error) {
+	username, err := dbService.ConsumeMagicLink(ctx, hashToken(token))
+	if errors.Is(err, sql.ErrNoRows) {
+		return User{}, ErrInvalidMagicLink
+	}
+	if err != nil {
+		return User{}, fmt.Errorf("error verifying login link: %v", err)
+	}
+
+	if err := ensureEnabled(ctx, dbService, username); err != nil {
+		return User{}, err
+	}
+
+	return User{Username: username}, nil
+}
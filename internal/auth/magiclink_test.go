@@ -0,0 +1,110 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/raziel-aleman/go-starter/internal/database/fake"
+	"github.com/raziel-aleman/go-starter/internal/mail"
+)
+
+// outbox is a mailer keeping the messages it sends.
+type outbox []mail.Message
+
+func (o *outbox) Send(_ context.Context, msg mail.Message) error {
+	*o = append(*o, msg)
+	return nil
+}
+
+// magicLinkToken returns the token of the login link in a message.
+func magicLinkToken(t *testing.T, msg mail.Message) string {
+	t.Helper()
+	_, link, ok := strings.Cut(msg.Body, "http://localhost/login/magic?")
+	if !ok {
+		t.Fatalf("expected a login link in %q", msg.Body)
+	}
+	query, err := url.ParseQuery(strings.TrimSpace(link))
+	if err != nil {
+		t.Fatalf("error parsing login link. Err: %v", err)
+	}
+	return query.Get("token")
+}
+
+func TestMagicLink(t *testing.T) {
+	ctx := context.Background()
+	db := fake.New()
+	db.RegisterUser(ctx, "alice", "alice@example.com", []byte("hash"))
+	var sent outbox
+
+	if err := RequestMagicLink(ctx, db, &sent, "alice@example.com", "http://localhost"); err != nil {
+		t.Fatalf("error requesting login link. Err: %v", err)
+	}
+	if len(sent) != 1 || sent[0].To != "alice@example.com" {
+		t.Fatalf("expected a login link sent to alice; got %+v", sent)
+	}
+	token := magicLinkToken(t, sent[0])
+
+	user, err := VerifyMagicLink(ctx, db, token)
+	if err != nil {
+		t.Fatalf("error verifying login link. Err: %v", err)
+	}
+	if user.Username != "alice" {
+		t.Errorf("expected user alice; got %q", user.Username)
+	}
+
+	// Links are single-use
+	if _, err := VerifyMagicLink(ctx, db, token); !errors.Is(err, ErrInvalidMagicLink) {
+		t.Errorf("expected ErrInvalidMagicLink on reuse; got %v", err)
+	}
+	if _, err := VerifyMagicLink(ctx, db, "unknown"); !errors.Is(err, ErrInvalidMagicLink) {
+		t.Errorf("expected ErrInvalidMagicLink for an unknown token; got %v", err)
+	}
+}
+
+func TestMagicLinkExpired(t *testing.T) {
+	ctx := context.Background()
+	db := fake.New()
+	db.RegisterUser(ctx, "alice", "alice@example.com", []byte("hash"))
+	token, hash, err := newToken()
+	if err != nil {
+		t.Fatalf("error generating token. Err: %v", err)
+	}
+	if err := db.CreateMagicLink(ctx, "alice", hash, time.Now().Add(-time.Second)); err != nil {
+		t.Fatalf("error storing login link. Err: %v", err)
+	}
+
+	if _, err := VerifyMagicLink(ctx, db, token); !errors.Is(err, ErrInvalidMagicLink) {
+		t.Errorf("expected ErrInvalidMagicLink for an expired link; got %v", err)
+	}
+}
+
+func TestMagicLinkThrottle(t *testing.T) {
+	ctx := context.Background()
+	db := fake.New()
+	db.RegisterUser(ctx, "alice", "alice@example.com", []byte("hash"))
+	var sent outbox
+
+	for i := 0; i < magicLinkLimit; i++ {
+		if err := RequestMagicLink(ctx, db, &sent, "alice@example.com", "http://localhost"); err != nil {
+			t.Fatalf("error requesting login link %d. Err: %v", i+1, err)
+		}
+	}
+	if err := RequestMagicLink(ctx, db, &sent, "alice@example.com", "http://localhost"); !errors.Is(err, ErrMagicLinkThrottled) {
+		t.Errorf("expected ErrMagicLinkThrottled; got %v", err)
+	}
+	if len(sent) != magicLinkLimit {
+		t.Errorf("expected %d login links sent; got %d", magicLinkLimit, len(sent))
+	}
+
+	// Unknown addresses are not revealed
+	if err := RequestMagicLink(ctx, db, &sent, "nobody@example.com", "http://localhost"); err != nil {
+		t.Errorf("expected no error for an unknown email; got %v", err)
+	}
+	if len(sent) != magicLinkLimit {
+		t.Errorf("expected no login link sent to an unknown email; got %d", len(sent)-magicLinkLimit)
+	}
+}
@@ -0,0 +1,54 @@
+package auth
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/raziel-aleman/go-starter/internal/database"
+	"github.com/raziel-aleman/go-starter/internal/session"
+)
+
+// MergeFunc merges the domain data of a guest into the user logging in, e.g.
+// the cart rows of the guest session into the cart of the user. It runs in the
+// transaction tx, shared by every registered MergeFunc.
+type MergeFunc func(tx database.Tx, guest *session.Session, user User) error
+
+// merges holds the registered MergeFuncs and the database running them.
+var merges struct {
+	sync.RWMutex
+	dbService database.Service
+	funcs     []MergeFunc
+}
+
+// RegisterMergeFunc registers a function run by Login when a guest session
+// logs in. Every function runs in a single transaction of dbService, which
+// must be the same for all registrations.
+func RegisterMergeFunc(dbService database.Service, fn MergeFunc) {
+	merges.Lock()
+	defer merges.Unlock()
+	merges.dbService = dbService
+	merges.funcs = append(merges.funcs, fn)
+}
+
+// mergeGuest runs the registered MergeFuncs for a guest session. Nothing is
+// merged when the session already belongs to a user.
+func mergeGuest(r *http.Request, guest *session.Session, user User) error {
+	merges.RLock()
+	defer merges.RUnlock()
+	if len(merges.funcs) == 0 {
+		return nil
+	}
+	if username, _ := guest.Get("username").(string); username != "" && username != "guest" {
+		return nil
+	}
+
+	return merges.dbService.WithTx(r.Context(), func(tx database.Tx) error {
+		for _, fn := range merges.funcs {
+			if err := fn(tx, guest, user); err != nil {
+				return fmt.Errorf("error merging guest data into %s: %w", user.Username, err)
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,79 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestClientCertAuth(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("error generating key. Err: %v", err)
+	}
+	newCert := func(commonName string, uris ...string) *x509.Certificate {
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(1),
+			Subject:      pkix.Name{CommonName: commonName},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+		}
+		for _, u := range uris {
+			parsed, _ := url.Parse(u)
+			template.URIs = append(template.URIs, parsed)
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+		if err != nil {
+			t.Fatalf("error creating certificate. Err: %v", err)
+		}
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			t.Fatalf("error parsing certificate. Err: %v", err)
+		}
+		return cert
+	}
+
+	var principal *Principal
+	handler := ClientCertAuth(map[string]string{
+		"spiffe://example.com/billing": "billing",
+		"backup.internal":              "backup",
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, _ = PrincipalFromContext(r.Context())
+	}))
+
+	tests := []struct {
+		cert     *x509.Certificate
+		status   int
+		username string
+	}{
+		{newCert("ignored", "spiffe://example.com/billing"), http.StatusOK, "billing"},
+		{newCert("backup.internal"), http.StatusOK, "backup"},
+		{newCert("unknown.internal"), http.StatusForbidden, ""},
+		{nil, http.StatusUnauthorized, ""},
+	}
+	for _, tt := range tests {
+		principal = nil
+		r := httptest.NewRequest(http.MethodGet, "/internal", nil)
+		if tt.cert != nil {
+			r.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{tt.cert}}}
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+
+		if w.Code != tt.status {
+			t.Errorf("expected status %d; got %d", tt.status, w.Code)
+		}
+		if tt.username != "" && (principal == nil || principal.Username != tt.username || principal.Method != MethodCertificate) {
+			t.Errorf("expected principal %s; got %+v", tt.username, principal)
+		}
+	}
+}
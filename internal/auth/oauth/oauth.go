@@ -0,0 +1,115 @@
+package oauth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+
+	"golang.org/x/oauth2"
+
+	"github.com/raziel-aleman/go-starter/internal/session"
+)
+
+// ErrInvalidState is returned when the callback state does not match the one
+// stored in the session when the login started.
+var ErrInvalidState = errors.New("invalid oauth state")
+
+// Identity is the user identity returned by a provider.
+type Identity struct {
+	Provider string `json:"provider"`
+	Subject  string `json:"subject"` // Stable user id at the provider
+	Email    string `json:"email"`
+	Name     string `json:"name"`
+}
+
+// Provider is an OAuth2 / OIDC identity provider.
+type Provider interface {
+	// Name is the provider name used in routes, e.g. "google".
+	Name() string
+	// Config returns the OAuth2 client configuration.
+	Config() *oauth2.Config
+	// Identity fetches the authenticated user's identity with the access token.
+	Identity(ctx context.Context, token *oauth2.Token) (*Identity, error)
+}
+
+// Registry holds the enabled providers by name.
+type Registry map[string]Provider
+
+// NewRegistry creates a registry from the given providers.
+func NewRegistry(providers ...Provider) Registry {
+	r := make(Registry, len(providers))
+	for _, p := range providers {
+		r[p.Name()] = p
+	}
+	return r
+}
+
+// sessionNamespace is the session namespace holding the pending login state.
+const sessionNamespace = "oauth"
+
+// BeginLogin generates the state and PKCE verifier for a login, stores them in
+// the session, and returns the provider URL to redirect the user to.
+func BeginLogin(s *session.Session, provider Provider) (string, error) {
+	state, err := randomString()
+	if err != nil {
+		return "", err
+	}
+	verifier := oauth2.GenerateVerifier()
+
+	// The state must survive the round trip to the provider
+	s.Persist()
+	ns := s.Namespace(sessionNamespace)
+	ns.Put("provider", provider.Name())
+	ns.Put("state", state)
+	ns.Put("verifier", verifier)
+
+	return provider.Config().AuthCodeURL(state, oauth2.S256ChallengeOption(verifier)), nil
+}
+
+// CompleteLogin checks the callback state, exchanges the code using the PKCE
+// verifier from the session, and fetches the user identity.
+func CompleteLogin(
+	ctx context.Context,
+	s *session.Session,
+	provider Provider,
+	state,
+	code string,
+) (*Identity, error) {
+	ns := s.Namespace(sessionNamespace)
+	expected, _ := ns.Get("state").(string)
+	verifier, _ := ns.Get("verifier").(string)
+	name, _ := ns.Get("provider").(string)
+	// The pending login can only be completed once
+	ns.Clear()
+
+	if expected == "" || name != provider.Name() ||
+		subtle.ConstantTimeCompare([]byte(state), []byte(expected)) != 1 {
+		return nil, ErrInvalidState
+	}
+
+	token, err := provider.Config().Exchange(ctx, code, oauth2.VerifierOption(verifier))
+	if err != nil {
+		return nil, fmt.Errorf("error exchanging %s authorization code: %w", provider.Name(), err)
+	}
+
+	identity, err := provider.Identity(ctx, token)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching %s identity: %w", provider.Name(), err)
+	}
+	identity.Provider = provider.Name()
+
+	return identity, nil
+}
+
+// randomString generates a random URL-safe string with 256 bits of entropy.
+func randomString() (string, error) {
+	b := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, b); err != nil {
+		return "", fmt.Errorf("error generating oauth state: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
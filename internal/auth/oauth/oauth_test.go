@@ -0,0 +1,123 @@
+package oauth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"golang.org/x/oauth2"
+
+	"github.com/raziel-aleman/go-starter/internal/session"
+)
+
+// testProvider is a provider whose token endpoint is a test server.
+type testProvider struct {
+	name   string
+	config *oauth2.Config
+}
+
+func (p *testProvider) Name() string           { return p.name }
+func (p *testProvider) Config() *oauth2.Config { return p.config }
+func (p *testProvider) Identity(ctx context.Context, token *oauth2.Token) (*Identity, error) {
+	return &Identity{Subject: token.AccessToken, Email: "alice@example.com"}, nil
+}
+
+// newTestProvider returns a provider issuing the access token "alice" for the
+// code "code" exchanged with a PKCE verifier.
+func newTestProvider(t *testing.T, name string) *testProvider {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("code") != "code" || r.FormValue("code_verifier") == "" {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"access_token":"alice","token_type":"Bearer"}`))
+	}))
+	t.Cleanup(server.Close)
+	return &testProvider{name: name, config: &oauth2.Config{
+		ClientID: "client",
+		Endpoint: oauth2.Endpoint{AuthURL: server.URL + "/authorize", TokenURL: server.URL + "/token"},
+	}}
+}
+
+// beginLogin starts a login and returns its session and state.
+func beginLogin(t *testing.T, provider Provider) (*session.Session, string) {
+	t.Helper()
+	s, err := session.NewSession()
+	if err != nil {
+		t.Fatalf("error creating session. Err: %v", err)
+	}
+	authURL, err := BeginLogin(s, provider)
+	if err != nil {
+		t.Fatalf("error beginning login. Err: %v", err)
+	}
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatalf("error parsing authorization URL. Err: %v", err)
+	}
+	if u.Query().Get("code_challenge_method") != "S256" {
+		t.Errorf("expected a S256 PKCE challenge; got %q", u.RawQuery)
+	}
+	return s, u.Query().Get("state")
+}
+
+func TestCompleteLogin(t *testing.T) {
+	ctx := context.Background()
+	provider := newTestProvider(t, "test")
+	s, state := beginLogin(t, provider)
+
+	identity, err := CompleteLogin(ctx, s, provider, state, "code")
+	if err != nil {
+		t.Fatalf("error completing login. Err: %v", err)
+	}
+	if identity.Provider != "test" || identity.Subject != "alice" {
+		t.Errorf("expected the identity of alice at test; got %+v", identity)
+	}
+
+	// The pending login is cleared once completed
+	if _, err := CompleteLogin(ctx, s, provider, state, "code"); !errors.Is(err, ErrInvalidState) {
+		t.Errorf("expected ErrInvalidState on replay; got %v", err)
+	}
+}
+
+func TestCompleteLoginInvalidState(t *testing.T) {
+	ctx := context.Background()
+	provider := newTestProvider(t, "test")
+	other := newTestProvider(t, "other")
+
+	tests := []struct {
+		name     string
+		provider Provider
+		state    func(state string) string
+	}{
+		{"mismatched state", provider, func(string) string { return "forged" }},
+		{"empty state", provider, func(string) string { return "" }},
+		{"other provider", other, func(state string) string { return state }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, state := beginLogin(t, provider)
+			if _, err := CompleteLogin(ctx, s, tt.provider, tt.state(state), "code"); !errors.Is(err, ErrInvalidState) {
+				t.Fatalf("expected ErrInvalidState; got %v", err)
+			}
+			// A failed attempt also ends the pending login
+			if _, err := CompleteLogin(ctx, s, provider, state, "code"); !errors.Is(err, ErrInvalidState) {
+				t.Errorf("expected ErrInvalidState after a failed attempt; got %v", err)
+			}
+		})
+	}
+
+	t.Run("no pending login", func(t *testing.T) {
+		s, err := session.NewSession()
+		if err != nil {
+			t.Fatalf("error creating session. Err: %v", err)
+		}
+		if _, err := CompleteLogin(ctx, s, provider, "", "code"); !errors.Is(err, ErrInvalidState) {
+			t.Errorf("expected ErrInvalidState; got %v", err)
+		}
+	})
+}
@@ -0,0 +1,122 @@
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/endpoints"
+)
+
+// Google is the Google OpenID Connect provider.
+type Google struct {
+	config *oauth2.Config
+}
+
+// NewGoogle creates a Google provider.
+func NewGoogle(clientID, clientSecret, redirectURL string) *Google {
+	return &Google{config: &oauth2.Config{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		RedirectURL:  redirectURL,
+		Endpoint:     endpoints.Google,
+		Scopes:       []string{"openid", "email", "profile"},
+	}}
+}
+
+// Name returns "google".
+func (g *Google) Name() string { return "google" }
+
+// Config returns the OAuth2 client configuration.
+func (g *Google) Config() *oauth2.Config { return g.config }
+
+// Identity fetches the user from the OpenID Connect userinfo endpoint.
+func (g *Google) Identity(ctx context.Context, token *oauth2.Token) (*Identity, error) {
+	var info struct {
+		Subject       string `json:"sub"`
+		Email         string `json:"email"`
+		EmailVerified bool   `json:"email_verified"`
+		Name          string `json:"name"`
+	}
+	client := g.config.Client(ctx, token)
+	if err := getJSON(client, "https://openidconnect.googleapis.com/v1/userinfo", &info); err != nil {
+		return nil, err
+	}
+	identity := &Identity{Subject: info.Subject, Name: info.Name}
+	if info.EmailVerified {
+		identity.Email = info.Email
+	}
+	return identity, nil
+}
+
+// GitHub is the GitHub OAuth2 provider.
+type GitHub struct {
+	config *oauth2.Config
+}
+
+// NewGitHub creates a GitHub provider.
+func NewGitHub(clientID, clientSecret, redirectURL string) *GitHub {
+	return &GitHub{config: &oauth2.Config{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		RedirectURL:  redirectURL,
+		Endpoint:     endpoints.GitHub,
+		Scopes:       []string{"read:user", "user:email"},
+	}}
+}
+
+// Name returns "github".
+func (g *GitHub) Name() string { return "github" }
+
+// Config returns the OAuth2 client configuration.
+func (g *GitHub) Config() *oauth2.Config { return g.config }
+
+// Identity fetches the user profile and its primary verified email from the GitHub API.
+func (g *GitHub) Identity(ctx context.Context, token *oauth2.Token) (*Identity, error) {
+	client := g.config.Client(ctx, token)
+
+	var user struct {
+		ID    int64  `json:"id"`
+		Login string `json:"login"`
+		Name  string `json:"name"`
+	}
+	if err := getJSON(client, "https://api.github.com/user", &user); err != nil {
+		return nil, err
+	}
+
+	var emails []struct {
+		Email    string `json:"email"`
+		Primary  bool   `json:"primary"`
+		Verified bool   `json:"verified"`
+	}
+	if err := getJSON(client, "https://api.github.com/user/emails", &emails); err != nil {
+		return nil, err
+	}
+
+	identity := &Identity{Subject: strconv.FormatInt(user.ID, 10), Name: user.Name}
+	if identity.Name == "" {
+		identity.Name = user.Login
+	}
+	for _, e := range emails {
+		if e.Primary && e.Verified {
+			identity.Email = e.Email
+		}
+	}
+	return identity, nil
+}
+
+// getJSON fetches url with the authenticated client and decodes the JSON response into v.
+func getJSON(client *http.Client, url string, v any) error {
+	resp, err := client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status from %s: %s", url, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
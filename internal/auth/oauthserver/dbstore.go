@@ -0,0 +1,79 @@
+package oauthserver
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/raziel-aleman/go-starter/internal/database"
+)
+
+// Ensure DatabaseStore satisfies the Store interface.
+var _ Store = (*DatabaseStore)(nil)
+
+// DatabaseStore keeps clients and authorization codes in the database, so
+// they survive restarts. Code usernames must be registered users.
+type DatabaseStore struct {
+	db database.Service
+}
+
+// NewDatabaseStore creates a new DatabaseStore.
+func NewDatabaseStore(db database.Service) *DatabaseStore {
+	return &DatabaseStore{db: db}
+}
+
+// CreateClient registers a client.
+func (s *DatabaseStore) CreateClient(ctx context.Context, client Client) error {
+	return s.db.CreateOAuthClient(ctx, database.OAuthClient{
+		ID:           client.ID,
+		Name:         client.Name,
+		SecretHash:   client.SecretHash,
+		RedirectURIs: client.RedirectURIs,
+		Scopes:       client.Scopes,
+		CreatedBy:    client.CreatedBy,
+	})
+}
+
+// Client returns a client by id.
+func (s *DatabaseStore) Client(ctx context.Context, id string) (Client, error) {
+	client, err := s.db.OAuthClient(ctx, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Client{}, ErrUnknownClient
+	}
+	return Client{
+		ID:           client.ID,
+		Name:         client.Name,
+		SecretHash:   client.SecretHash,
+		RedirectURIs: client.RedirectURIs,
+		Scopes:       client.Scopes,
+		CreatedBy:    client.CreatedBy,
+	}, err
+}
+
+// SaveCode records an authorization code digest.
+func (s *DatabaseStore) SaveCode(ctx context.Context, hash string, code AuthorizationCode) error {
+	return s.db.SaveOAuthCode(ctx, hash, database.OAuthCode{
+		ClientID:      code.ClientID,
+		Username:      code.Username,
+		RedirectURI:   code.RedirectURI,
+		Scopes:        code.Scopes,
+		CodeChallenge: code.CodeChallenge,
+		ExpiresAt:     code.ExpiresAt,
+	})
+}
+
+// UseCode removes an authorization code digest and returns the code.
+func (s *DatabaseStore) UseCode(ctx context.Context, hash string) (AuthorizationCode, error) {
+	code, err := s.db.UseOAuthCode(ctx, hash)
+	if errors.Is(err, sql.ErrNoRows) {
+		return AuthorizationCode{}, ErrInvalidCode
+	}
+	return AuthorizationCode{
+		ClientID:      code.ClientID,
+		Username:      code.Username,
+		RedirectURI:   code.RedirectURI,
+		Scopes:        code.Scopes,
+		CodeChallenge: code.CodeChallenge,
+		ExpiresAt:     code.ExpiresAt,
+	}, err
+}
@@ -0,0 +1,456 @@
+// Package oauthserver implements an OAuth 2.0 authorization server, so
+// third-party clients can obtain access tokens on behalf of the users of this
+// app. It supports the authorization code grant with mandatory PKCE (S256)
+// and the refresh token grant. Users log in and consent with their existing
+// session, and access tokens are issued by the jwt.Manager. Tokens are bound
+// to the client they were issued to: the manager should have an audience of
+// its own, so they are not accepted as first-party tokens.
+package oauthserver
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/raziel-aleman/go-starter/internal/jwt"
+	sm "github.com/raziel-aleman/go-starter/internal/session"
+)
+
+var (
+	// ErrUnknownClient is returned when a client id is not registered.
+	ErrUnknownClient = errors.New("unknown oauth client")
+	// ErrInvalidCode is returned when an authorization code is unknown, already used, or expired.
+	ErrInvalidCode = errors.New("invalid authorization code")
+)
+
+// Error is an OAuth 2.0 error response (RFC 6749 section 4.1.2.1 and 5.2).
+type Error struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+}
+
+func (e *Error) Error() string {
+	if e.Description == "" {
+		return e.Code
+	}
+	return e.Code + ": " + e.Description
+}
+
+// Server issues authorization codes and tokens to registered clients.
+type Server struct {
+	Store  Store
+	Tokens *jwt.Manager
+	// Lifetime of authorization codes, which are exchanged right after the redirect
+	CodeTTL time.Duration
+	// Name of the consent form field carrying the session CSRF token
+	CSRFFieldName string
+}
+
+// New creates a Server storing clients and codes in store and issuing tokens with tokens.
+func New(store Store, tokens *jwt.Manager) *Server {
+	return &Server{
+		Store:         store,
+		Tokens:        tokens,
+		CodeTTL:       time.Minute,
+		CSRFFieldName: "csrf_token",
+	}
+}
+
+// RegisterClient registers a client allowed to redirect users to
+// redirectURIs and to request scopes. Confidential clients get a secret,
+// returned only here; public clients get none.
+func (s *Server) RegisterClient(
+	ctx context.Context,
+	name string,
+	redirectURIs []string,
+	scopes []string,
+	confidential bool,
+	createdBy string,
+) (Client, string, error) {
+	if name == "" || len(redirectURIs) == 0 || len(scopes) == 0 {
+		return Client{}, "", errors.New("a client needs a name, redirect URIs and scopes")
+	}
+	for _, uri := range redirectURIs {
+		u, err := url.Parse(uri)
+		if err != nil || !u.IsAbs() || u.Fragment != "" {
+			return Client{}, "", fmt.Errorf("invalid redirect URI %q", uri)
+		}
+	}
+
+	id, err := randomToken()
+	if err != nil {
+		return Client{}, "", err
+	}
+	client := Client{
+		ID:           id,
+		Name:         name,
+		RedirectURIs: redirectURIs,
+		Scopes:       scopes,
+		CreatedBy:    createdBy,
+	}
+	var secret string
+	if confidential {
+		if secret, err = randomToken(); err != nil {
+			return Client{}, "", err
+		}
+		client.SecretHash = hashToken(secret)
+	}
+
+	if err := s.Store.CreateClient(ctx, client); err != nil {
+		return Client{}, "", fmt.Errorf("error storing oauth client: %v", err)
+	}
+	return client, secret, nil
+}
+
+// authorizationRequest is a validated authorization request.
+type authorizationRequest struct {
+	Client        Client
+	RedirectURI   string
+	RedirectGiven bool // Whether redirect_uri was in the request rather than defaulted
+	Scopes        []string
+	State         string
+	CodeChallenge string
+}
+
+// parseAuthorizationRequest validates the authorization request parameters.
+// Errors about the client or redirect URI must not be redirected to the
+// client, so they are returned as redirect false.
+func (s *Server) parseAuthorizationRequest(r *http.Request) (req authorizationRequest, redirect bool, err error) {
+	client, err := s.Store.Client(r.Context(), r.FormValue("client_id"))
+	if errors.Is(err, ErrUnknownClient) {
+		return req, false, &Error{Code: "invalid_request", Description: "unknown client"}
+	}
+	if err != nil {
+		return req, false, fmt.Errorf("error loading oauth client: %v", err)
+	}
+	req.Client = client
+
+	req.RedirectURI = r.FormValue("redirect_uri")
+	req.RedirectGiven = req.RedirectURI != ""
+	if !req.RedirectGiven && len(client.RedirectURIs) == 1 {
+		req.RedirectURI = client.RedirectURIs[0]
+	}
+	if !slices.Contains(client.RedirectURIs, req.RedirectURI) {
+		return req, false, &Error{Code: "invalid_request", Description: "redirect_uri is not registered"}
+	}
+	req.State = r.FormValue("state")
+
+	if r.FormValue("response_type") != "code" {
+		return req, true, &Error{Code: "unsupported_response_type"}
+	}
+
+	req.Scopes = strings.Fields(r.FormValue("scope"))
+	if len(req.Scopes) == 0 {
+		req.Scopes = client.Scopes
+	}
+	for _, scope := range req.Scopes {
+		if !slices.Contains(client.Scopes, scope) {
+			return req, true, &Error{Code: "invalid_scope", Description: "scope " + scope + " is not allowed"}
+		}
+	}
+
+	// PKCE is required of every client, the plain method is not supported
+	req.CodeChallenge = r.FormValue("code_challenge")
+	if req.CodeChallenge == "" || r.FormValue("code_challenge_method") != "S256" {
+		return req, true, &Error{Code: "invalid_request", Description: "code_challenge with method S256 is required"}
+	}
+
+	return req, true, nil
+}
+
+// AuthorizeHandler implements the authorization endpoint. GET shows the user
+// a consent screen for the client, POST records the decision and redirects
+// back to the client with a code or an access_denied error. The user must be
+// logged in, so it must be wrapped in an authentication middleware.
+func (s *Server) AuthorizeHandler(w http.ResponseWriter, r *http.Request) {
+	session := sm.GetSession(r)
+	username, _ := session.Get("username").(string)
+	if username == "" {
+		http.Error(w, "Unauthenticated", http.StatusUnauthorized)
+		return
+	}
+
+	req, redirect, err := s.parseAuthorizationRequest(r)
+	if err != nil {
+		var oauthErr *Error
+		if !errors.As(err, &oauthErr) {
+			slog.ErrorContext(r.Context(), "Failed to process authorization request", "err", err)
+			http.Error(w, "Failed to process authorization request", http.StatusInternalServerError)
+			return
+		}
+		if !redirect {
+			http.Error(w, oauthErr.Error(), http.StatusBadRequest)
+			return
+		}
+		s.redirectError(w, r, req, oauthErr)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		s.renderConsent(w, r, req)
+	case http.MethodPost:
+		if r.FormValue("decision") != "allow" {
+			s.redirectError(w, r, req, &Error{Code: "access_denied"})
+			return
+		}
+		code, err := s.issueCode(r, req, username)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Failed to issue authorization code", "client_id", req.Client.ID, "err", err)
+			s.redirectError(w, r, req, &Error{Code: "server_error"})
+			return
+		}
+		s.redirect(w, r, req, url.Values{"code": {code}})
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// issueCode stores a new authorization code for the request and returns it.
+func (s *Server) issueCode(r *http.Request, req authorizationRequest, username string) (string, error) {
+	code, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+	// The token request must repeat redirect_uri only if the authorization
+	// request included it (RFC 6749 section 4.1.3)
+	var redirectURI string
+	if req.RedirectGiven {
+		redirectURI = req.RedirectURI
+	}
+	err = s.Store.SaveCode(r.Context(), hashToken(code), AuthorizationCode{
+		ClientID:      req.Client.ID,
+		Username:      username,
+		RedirectURI:   redirectURI,
+		Scopes:        req.Scopes,
+		CodeChallenge: req.CodeChallenge,
+		ExpiresAt:     time.Now().Add(s.CodeTTL),
+	})
+	if err != nil {
+		return "", fmt.Errorf("error storing authorization code: %v", err)
+	}
+	return code, nil
+}
+
+// redirect sends the user back to the client with params and the request state.
+func (s *Server) redirect(w http.ResponseWriter, r *http.Request, req authorizationRequest, params url.Values) {
+	if req.State != "" {
+		params.Set("state", req.State)
+	}
+	target, _ := url.Parse(req.RedirectURI)
+	query := target.Query()
+	for key, values := range params {
+		query[key] = values
+	}
+	target.RawQuery = query.Encode()
+	http.Redirect(w, r, target.String(), http.StatusSeeOther)
+}
+
+// redirectError sends the user back to the client with an error.
+func (s *Server) redirectError(w http.ResponseWriter, r *http.Request, req authorizationRequest, oauthErr *Error) {
+	params := url.Values{"error": {oauthErr.Code}}
+	if oauthErr.Description != "" {
+		params.Set("error_description", oauthErr.Description)
+	}
+	s.redirect(w, r, req, params)
+}
+
+// consentTemplate is the consent screen. The form posts the authorization
+// request back, so it is validated again along with the decision.
+var consentTemplate = template.Must(template.New("consent").Parse(`<!DOCTYPE html>
+<html>
+<head><title>Authorize {{.Client.Name}}</title></head>
+<body>
+<h1>Authorize {{.Client.Name}}</h1>
+<p>{{.Client.Name}} is requesting access to your account{{if .Scopes}} with the following permissions{{end}}:</p>
+<ul>{{range .Scopes}}<li>{{.}}</li>{{end}}</ul>
+<form method="post" action="{{.Action}}">
+<input type="hidden" name="{{.CSRFFieldName}}" value="{{.CSRFToken}}">
+{{range $name, $values := .Params}}{{range $values}}<input type="hidden" name="{{$name}}" value="{{.}}">
+{{end}}{{end}}<button type="submit" name="decision" value="allow">Allow</button>
+<button type="submit" name="decision" value="deny">Deny</button>
+</form>
+</body>
+</html>
+`))
+
+// renderConsent shows the consent screen of a validated authorization request.
+func (s *Server) renderConsent(w http.ResponseWriter, r *http.Request, req authorizationRequest) {
+	params := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {req.Client.ID},
+		"redirect_uri":          {req.RedirectURI},
+		"scope":                 {strings.Join(req.Scopes, " ")},
+		"code_challenge":        {req.CodeChallenge},
+		"code_challenge_method": {"S256"},
+	}
+	if req.State != "" {
+		params.Set("state", req.State)
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	// The consent screen must not be framed, or users could be tricked into clicking Allow
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.Header().Set("Content-Security-Policy", "frame-ancestors 'none'")
+	err := consentTemplate.Execute(w, map[string]any{
+		"Client":        req.Client,
+		"Scopes":        req.Scopes,
+		"Action":        r.URL.Path,
+		"CSRFFieldName": s.CSRFFieldName,
+		"CSRFToken":     sm.CSRFToken(r),
+		"Params":        params,
+	})
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to render consent page", "err", err)
+	}
+}
+
+// TokenHandler implements the token endpoint for the authorization_code and
+// refresh_token grants. Confidential clients authenticate with HTTP Basic
+// authentication or the client_secret parameter, public clients only send
+// their client_id.
+func (s *Server) TokenHandler(w http.ResponseWriter, r *http.Request) {
+	client, err := s.authenticateClient(r)
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+
+	var pair *jwt.TokenPair
+	switch r.PostFormValue("grant_type") {
+	case "authorization_code":
+		pair, err = s.exchangeCode(r, client)
+	case "refresh_token":
+		pair, err = s.Tokens.RefreshClient(r.Context(), client.ID, r.PostFormValue("refresh_token"))
+		if errors.Is(err, jwt.ErrInvalidRefreshToken) {
+			err = &Error{Code: "invalid_grant", Description: "invalid refresh token"}
+		}
+	default:
+		err = &Error{Code: "unsupported_grant_type"}
+	}
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, pair)
+}
+
+// authenticateClient returns the client making a token request.
+func (s *Server) authenticateClient(r *http.Request) (Client, error) {
+	id, secret, basic := r.BasicAuth()
+	if !basic {
+		id, secret = r.PostFormValue("client_id"), r.PostFormValue("client_secret")
+	}
+	invalid := &Error{Code: "invalid_client"}
+	if id == "" {
+		return Client{}, invalid
+	}
+
+	client, err := s.Store.Client(r.Context(), id)
+	if errors.Is(err, ErrUnknownClient) {
+		return Client{}, invalid
+	}
+	if err != nil {
+		return Client{}, fmt.Errorf("error loading oauth client: %v", err)
+	}
+	if client.Confidential() && subtle.ConstantTimeCompare([]byte(hashToken(secret)), []byte(client.SecretHash)) != 1 {
+		return Client{}, invalid
+	}
+	return client, nil
+}
+
+// exchangeCode redeems an authorization code issued to client for tokens.
+func (s *Server) exchangeCode(r *http.Request, client Client) (*jwt.TokenPair, error) {
+	invalid := &Error{Code: "invalid_grant", Description: "invalid authorization code"}
+
+	code, err := s.Store.UseCode(r.Context(), hashToken(r.PostFormValue("code")))
+	if errors.Is(err, ErrInvalidCode) {
+		return nil, invalid
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error redeeming authorization code: %v", err)
+	}
+	if code.ClientID != client.ID || time.Now().After(code.ExpiresAt) {
+		return nil, invalid
+	}
+	if code.RedirectURI != "" && code.RedirectURI != r.PostFormValue("redirect_uri") {
+		return nil, invalid
+	}
+	if !verifyCodeChallenge(r.PostFormValue("code_verifier"), code.CodeChallenge) {
+		return nil, &Error{Code: "invalid_grant", Description: "code_verifier does not match the code challenge"}
+	}
+
+	pair, err := s.Tokens.IssueClient(r.Context(), client.ID, code.Username, code.Scopes...)
+	if err != nil {
+		return nil, fmt.Errorf("error issuing tokens: %v", err)
+	}
+	return pair, nil
+}
+
+// verifyCodeChallenge checks a PKCE code verifier against an S256 challenge.
+func verifyCodeChallenge(verifier, challenge string) bool {
+	if len(verifier) < 43 || len(verifier) > 128 {
+		return false
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	computed := base64.RawURLEncoding.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(computed), []byte(challenge)) == 1
+}
+
+// writeError writes a token endpoint error response.
+func (s *Server) writeError(w http.ResponseWriter, err error) {
+	var oauthErr *Error
+	if !errors.As(err, &oauthErr) {
+		slog.Error("Token request failed", "err", err)
+		oauthErr = &Error{Code: "server_error"}
+	}
+	status := http.StatusBadRequest
+	switch oauthErr.Code {
+	case "invalid_client":
+		w.Header().Set("WWW-Authenticate", `Basic realm="oauth"`)
+		status = http.StatusUnauthorized
+	case "server_error":
+		status = http.StatusInternalServerError
+	}
+	writeJSON(w, status, oauthErr)
+}
+
+// writeJSON writes v as a JSON token endpoint response, which must not be cached.
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Error("Failed to write response", "err", err)
+	}
+}
+
+// randomToken generates a random URL-safe token with 256 bits of entropy.
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, b); err != nil {
+		return "", fmt.Errorf("error generating token: %v", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashToken returns the base64 encoded SHA-256 digest of a token.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
@@ -0,0 +1,215 @@
+package oauthserver
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/raziel-aleman/go-starter/internal/jwt"
+)
+
+func TestTokenHandlerAuthorizationCode(t *testing.T) {
+	tokens := jwt.NewManager([]byte("secret"), time.Minute, time.Hour, jwt.NewInMemoryRefreshStore())
+	s := New(NewInMemoryStore(), tokens)
+	ctx := context.Background()
+
+	client, secret, err := s.RegisterClient(ctx, "app", []string{"https://app.example.com/callback"}, []string{"read"}, true, "admin")
+	if err != nil {
+		t.Fatalf("error registering client. Err: %v", err)
+	}
+
+	verifier := strings.Repeat("v", 43)
+	sum := sha256.Sum256([]byte(verifier))
+	saveCode := func(code string) {
+		err := s.Store.SaveCode(ctx, hashToken(code), AuthorizationCode{
+			ClientID:      client.ID,
+			Username:      "alice",
+			RedirectURI:   "https://app.example.com/callback",
+			Scopes:        []string{"read"},
+			CodeChallenge: base64.RawURLEncoding.EncodeToString(sum[:]),
+			ExpiresAt:     time.Now().Add(time.Minute),
+		})
+		if err != nil {
+			t.Fatalf("error saving code. Err: %v", err)
+		}
+	}
+	exchange := func(code, verifier, secret string) *httptest.ResponseRecorder {
+		form := url.Values{
+			"grant_type":    {"authorization_code"},
+			"code":          {code},
+			"redirect_uri":  {"https://app.example.com/callback"},
+			"code_verifier": {verifier},
+		}
+		r := httptest.NewRequest(http.MethodPost, "/oauth/token", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.SetBasicAuth(client.ID, secret)
+		w := httptest.NewRecorder()
+		s.TokenHandler(w, r)
+		return w
+	}
+
+	saveCode("code")
+	w := exchange("code", verifier, secret)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d; got %d: %s", http.StatusOK, w.Code, w.Body)
+	}
+	var pair jwt.TokenPair
+	if err := json.NewDecoder(w.Body).Decode(&pair); err != nil {
+		t.Fatalf("error decoding token response. Err: %v", err)
+	}
+	claims, err := tokens.Verify(pair.AccessToken)
+	if err != nil {
+		t.Fatalf("error verifying access token. Err: %v", err)
+	}
+	if claims.Subject != "alice" || claims.Scope != "read" {
+		t.Errorf("expected subject alice with scope read; got %s with %s", claims.Subject, claims.Scope)
+	}
+
+	// Codes can only be exchanged once
+	if w := exchange("code", verifier, secret); w.Code != http.StatusBadRequest {
+		t.Errorf("expected reused code to be rejected; got %d", w.Code)
+	}
+
+	saveCode("wrong-verifier")
+	if w := exchange("wrong-verifier", strings.Repeat("x", 43), secret); w.Code != http.StatusBadRequest {
+		t.Errorf("expected wrong code verifier to be rejected; got %d", w.Code)
+	}
+
+	saveCode("wrong-secret")
+	if w := exchange("wrong-secret", verifier, "wrong"); w.Code != http.StatusUnauthorized {
+		t.Errorf("expected wrong client secret to be rejected; got %d", w.Code)
+	}
+}
+
+func TestTokenHandlerDefaultedRedirectURI(t *testing.T) {
+	tokens := jwt.NewManager([]byte("secret"), time.Minute, time.Hour, jwt.NewInMemoryRefreshStore())
+	s := New(NewInMemoryStore(), tokens)
+	ctx := context.Background()
+
+	client, _, err := s.RegisterClient(ctx, "app", []string{"https://app.example.com/callback"}, []string{"read"}, false, "admin")
+	if err != nil {
+		t.Fatalf("error registering client. Err: %v", err)
+	}
+
+	verifier := strings.Repeat("v", 43)
+	sum := sha256.Sum256([]byte(verifier))
+	authorize := func(redirectURI string) string {
+		query := url.Values{
+			"client_id":             {client.ID},
+			"response_type":         {"code"},
+			"code_challenge":        {base64.RawURLEncoding.EncodeToString(sum[:])},
+			"code_challenge_method": {"S256"},
+		}
+		if redirectURI != "" {
+			query.Set("redirect_uri", redirectURI)
+		}
+		r := httptest.NewRequest(http.MethodGet, "/oauth/authorize?"+query.Encode(), nil)
+		req, _, err := s.parseAuthorizationRequest(r)
+		if err != nil {
+			t.Fatalf("error parsing authorization request. Err: %v", err)
+		}
+		code, err := s.issueCode(r, req, "alice")
+		if err != nil {
+			t.Fatalf("error issuing code. Err: %v", err)
+		}
+		return code
+	}
+	exchange := func(code, redirectURI string) *httptest.ResponseRecorder {
+		form := url.Values{
+			"grant_type":    {"authorization_code"},
+			"client_id":     {client.ID},
+			"code":          {code},
+			"code_verifier": {verifier},
+		}
+		if redirectURI != "" {
+			form.Set("redirect_uri", redirectURI)
+		}
+		r := httptest.NewRequest(http.MethodPost, "/oauth/token", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		s.TokenHandler(w, r)
+		return w
+	}
+
+	// redirect_uri was defaulted to the only registered URI, so the token
+	// request does not need to repeat it
+	if w := exchange(authorize(""), ""); w.Code != http.StatusOK {
+		t.Errorf("expected status %d for a defaulted redirect_uri; got %d: %s", http.StatusOK, w.Code, w.Body)
+	}
+
+	// redirect_uri was supplied, so the token request must match it
+	if w := exchange(authorize("https://app.example.com/callback"), ""); w.Code != http.StatusBadRequest {
+		t.Errorf("expected missing redirect_uri to be rejected; got %d", w.Code)
+	}
+	if w := exchange(authorize("https://app.example.com/callback"), "https://app.example.com/callback"); w.Code != http.StatusOK {
+		t.Errorf("expected status %d for a matching redirect_uri; got %d: %s", http.StatusOK, w.Code, w.Body)
+	}
+}
+
+func TestTokenHandlerRefreshToken(t *testing.T) {
+	store := jwt.NewInMemoryRefreshStore()
+	firstParty := jwt.NewManager([]byte("secret"), time.Minute, time.Hour, store)
+	tokens := jwt.NewManager([]byte("secret"), time.Minute, time.Hour, store)
+	tokens.Audience = "oauth"
+	s := New(NewInMemoryStore(), tokens)
+	ctx := context.Background()
+
+	app, _, err := s.RegisterClient(ctx, "app", []string{"https://app.example.com/callback"}, []string{"read"}, false, "admin")
+	if err != nil {
+		t.Fatalf("error registering client. Err: %v", err)
+	}
+	other, _, err := s.RegisterClient(ctx, "other", []string{"https://other.example.com/callback"}, []string{"read"}, false, "admin")
+	if err != nil {
+		t.Fatalf("error registering client. Err: %v", err)
+	}
+	issued, err := tokens.IssueClient(ctx, app.ID, "alice", "read")
+	if err != nil {
+		t.Fatalf("error issuing tokens. Err: %v", err)
+	}
+	session, err := firstParty.Issue(ctx, "alice")
+	if err != nil {
+		t.Fatalf("error issuing tokens. Err: %v", err)
+	}
+	refresh := func(clientID, refreshToken string) *httptest.ResponseRecorder {
+		form := url.Values{"grant_type": {"refresh_token"}, "refresh_token": {refreshToken}, "client_id": {clientID}}
+		r := httptest.NewRequest(http.MethodPost, "/oauth/token", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		s.TokenHandler(w, r)
+		return w
+	}
+
+	// Refresh tokens can only be redeemed by the client they were issued to
+	if w := refresh(other.ID, issued.RefreshToken); w.Code != http.StatusBadRequest {
+		t.Errorf("expected the token of another client to be rejected; got %d", w.Code)
+	}
+	if w := refresh(app.ID, session.RefreshToken); w.Code != http.StatusBadRequest {
+		t.Errorf("expected a first-party token to be rejected; got %d", w.Code)
+	}
+	if _, err := firstParty.Refresh(ctx, session.RefreshToken); err != nil {
+		t.Errorf("expected the first-party token to stay usable; got %v", err)
+	}
+	w := refresh(app.ID, issued.RefreshToken)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d; got %d: %s", http.StatusOK, w.Code, w.Body)
+	}
+
+	// Access tokens carry the client and are not first-party tokens
+	var pair jwt.TokenPair
+	if err := json.NewDecoder(w.Body).Decode(&pair); err != nil {
+		t.Fatalf("error decoding token response. Err: %v", err)
+	}
+	if claims, err := tokens.Verify(pair.AccessToken); err != nil || claims.ClientID != app.ID {
+		t.Errorf("expected an access token of the client; got %+v, %v", claims, err)
+	}
+	if _, err := firstParty.Verify(pair.AccessToken); err == nil {
+		t.Errorf("expected the access token to be rejected as a first-party token")
+	}
+}
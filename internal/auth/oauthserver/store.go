@@ -0,0 +1,109 @@
+package oauthserver
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Client is a third-party application registered to request access on behalf
+// of users. Public clients, such as single-page or mobile apps, have no secret
+// and rely on PKCE alone.
+type Client struct {
+	ID           string
+	Name         string
+	SecretHash   string   // Digest of the client secret, empty for public clients
+	RedirectURIs []string // Exact redirect URIs the client may use
+	Scopes       []string // Scopes the client may request
+	CreatedBy    string
+}
+
+// Confidential reports whether the client must authenticate with a secret.
+func (c Client) Confidential() bool {
+	return c.SecretHash != ""
+}
+
+// AuthorizationCode is a short-lived grant of a user to a client, exchanged
+// once for tokens at the token endpoint.
+type AuthorizationCode struct {
+	ClientID      string
+	Username      string
+	RedirectURI   string // Empty if the authorization request omitted it
+	Scopes        []string
+	CodeChallenge string // S256 PKCE challenge the code verifier must match
+	ExpiresAt     time.Time
+}
+
+// Store persists clients and authorization code digests.
+type Store interface {
+	// CreateClient registers a client.
+	CreateClient(ctx context.Context, client Client) error
+	// Client returns a client by id. It returns ErrUnknownClient if the id is unknown.
+	Client(ctx context.Context, id string) (Client, error)
+	// SaveCode records an authorization code digest.
+	SaveCode(ctx context.Context, hash string, code AuthorizationCode) error
+	// UseCode removes an authorization code digest and returns the code, so it
+	// can only be exchanged once. It returns ErrInvalidCode if the digest is unknown.
+	UseCode(ctx context.Context, hash string) (AuthorizationCode, error)
+}
+
+// InMemoryStore is a simple in-memory implementation of Store.
+// NOT suitable for production due to lack of persistence and scalability.
+type InMemoryStore struct {
+	clients map[string]Client
+	codes   map[string]AuthorizationCode
+	sync.Mutex
+}
+
+// NewInMemoryStore creates a new InMemoryStore.
+func NewInMemoryStore() *InMemoryStore {
+	return &InMemoryStore{
+		clients: make(map[string]Client),
+		codes:   make(map[string]AuthorizationCode),
+	}
+}
+
+// CreateClient registers a client.
+func (s *InMemoryStore) CreateClient(_ context.Context, client Client) error {
+	s.Lock()
+	defer s.Unlock()
+	s.clients[client.ID] = client
+	return nil
+}
+
+// Client returns a client by id.
+func (s *InMemoryStore) Client(_ context.Context, id string) (Client, error) {
+	s.Lock()
+	defer s.Unlock()
+	client, ok := s.clients[id]
+	if !ok {
+		return client, ErrUnknownClient
+	}
+	return client, nil
+}
+
+// SaveCode records an authorization code digest. Expired codes are removed at the same time.
+func (s *InMemoryStore) SaveCode(_ context.Context, hash string, code AuthorizationCode) error {
+	s.Lock()
+	defer s.Unlock()
+	now := time.Now()
+	for h, c := range s.codes {
+		if now.After(c.ExpiresAt) {
+			delete(s.codes, h)
+		}
+	}
+	s.codes[hash] = code
+	return nil
+}
+
+// UseCode removes an authorization code digest and returns the code.
+func (s *InMemoryStore) UseCode(_ context.Context, hash string) (AuthorizationCode, error) {
+	s.Lock()
+	defer s.Unlock()
+	code, ok := s.codes[hash]
+	if !ok {
+		return code, ErrInvalidCode
+	}
+	delete(s.codes, hash)
+	return code, nil
+}
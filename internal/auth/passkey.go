@@ -0,0 +1,97 @@
+package auth
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/raziel-aleman/go-starter/internal/auth/webauthn"
+	"github.com/raziel-aleman/go-starter/internal/database"
+	"github.com/raziel-aleman/go-starter/internal/session"
+)
+
+// ErrUnknownPasskey is returned when a login uses a passkey that is not registered.
+var ErrUnknownPasskey = errors.New("unknown passkey")
+
+// BeginPasskeyRegistration starts registering a passkey for the logged-in user.
+func BeginPasskeyRegistration(
+	r *http.Request,
+	dbService database.Service,
+	rp *webauthn.RelyingParty,
+	username string,
+) (*webauthn.CreationOptions, error) {
+	stored, err := dbService.WebAuthnCredentials(r.Context(), username)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving passkeys: %v", err)
+	}
+
+	existing := make([]webauthn.Credential, 0, len(stored))
+	for _, c := range stored {
+		existing = append(existing, webauthn.Credential{ID: c.ID, PublicKey: c.PublicKey, SignCount: c.SignCount})
+	}
+
+	return rp.BeginRegistration(session.GetSession(r), username, existing)
+}
+
+// FinishPasskeyRegistration verifies the new passkey and stores it.
+func FinishPasskeyRegistration(
+	r *http.Request,
+	dbService database.Service,
+	rp *webauthn.RelyingParty,
+	resp *webauthn.RegistrationResponse,
+) error {
+	credential, username, err := rp.FinishRegistration(session.GetSession(r), resp)
+	if err != nil {
+		return err
+	}
+
+	err = dbService.AddWebAuthnCredential(r.Context(), database.WebAuthnCredential{
+		ID:        credential.ID,
+		Username:  username,
+		PublicKey: credential.PublicKey,
+		SignCount: credential.SignCount,
+	})
+	if err != nil {
+		return fmt.Errorf("error storing passkey: %v", err)
+	}
+
+	return nil
+}
+
+// FinishPasskeyLogin verifies a passkey assertion and logs its owner in by migrating the session.
+func FinishPasskeyLogin(
+	r *http.Request,
+	srw *session.SessionResponseWriter,
+	dbService database.Service,
+	rp *webauthn.RelyingParty,
+	resp *webauthn.AssertionResponse,
+) (User, error) {
+	stored, err := dbService.FindWebAuthnCredential(r.Context(), resp.RawID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return User{}, ErrUnknownPasskey
+	}
+	if err != nil {
+		return User{}, fmt.Errorf("error retrieving passkey: %v", err)
+	}
+
+	if err := ensureEnabled(r.Context(), dbService, stored.Username); err != nil {
+		return User{}, err
+	}
+
+	credential := &webauthn.Credential{ID: stored.ID, PublicKey: stored.PublicKey, SignCount: stored.SignCount}
+	signCount, err := rp.FinishLogin(session.GetSession(r), resp, credential)
+	if err != nil {
+		return User{}, err
+	}
+
+	if err := dbService.UpdateWebAuthnSignCount(r.Context(), stored.ID, signCount); err != nil {
+		return User{}, fmt.Errorf("error updating passkey counter: %v", err)
+	}
+
+	user := User{Username: stored.Username}
+	if err := Login(r, srw, dbService, user); err != nil {
+		return User{}, err
+	}
+	return user, nil
+}
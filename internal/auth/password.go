@@ -0,0 +1,152 @@
+package auth
+
+import (
+	"context"
+	_ "embed"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+//go:embed common_passwords.txt
+var commonPasswordList string
+
+// commonPasswords is the set of banned common passwords, in lower case.
+var commonPasswords = func() map[string]struct{} {
+	set := make(map[string]struct{})
+	for _, p := range strings.Fields(commonPasswordList) {
+		set[strings.ToLower(p)] = struct{}{}
+	}
+	return set
+}()
+
+// PasswordPolicy defines the requirements for new passwords.
+type PasswordPolicy struct {
+	MinLength     int  // Minimum number of characters
+	MaxLength     int  // Maximum number of bytes, bcrypt ignores anything after 72
+	RequireUpper  bool // At least one upper case letter
+	RequireLower  bool // At least one lower case letter
+	RequireDigit  bool // At least one digit
+	RequireSymbol bool // At least one character that is not a letter or digit
+	BanCommon     bool // Reject well-known passwords and the username
+	// Optional check against known breaches, performed by ValidateContext
+	Breaches *BreachChecker
+	// Age after which passwords must be changed on login, zero if they never expire
+	MaxAge time.Duration
+}
+
+// DefaultPasswordPolicy follows NIST SP 800-63B: length over composition rules.
+var DefaultPasswordPolicy = PasswordPolicy{
+	MinLength: 8,
+	MaxLength: 72,
+	BanCommon: true,
+}
+
+// PasswordViolation is a requirement of the policy that a password does not meet.
+type PasswordViolation struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// PasswordPolicyError lists every requirement a password does not meet, so
+// clients can show them all at once.
+type PasswordPolicyError struct {
+	Violations []PasswordViolation `json:"violations"`
+}
+
+func (e *PasswordPolicyError) Error() string {
+	messages := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		messages[i] = v.Message
+	}
+	return "password does not meet the policy: " + strings.Join(messages, "; ")
+}
+
+// Validate checks a password for a user against the policy. It returns a
+// *PasswordPolicyError listing the violations, or nil if the password is valid.
+func (p PasswordPolicy) Validate(username string, password string) error {
+	var violations []PasswordViolation
+	violate := func(code string, format string, args ...any) {
+		violations = append(violations, PasswordViolation{Code: code, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if n := utf8.RuneCountInString(password); n < p.MinLength {
+		violate("too_short", "must be at least %d characters long", p.MinLength)
+	}
+	if p.MaxLength > 0 && len(password) > p.MaxLength {
+		violate("too_long", "must be at most %d bytes long", p.MaxLength)
+	}
+
+	var upper, lower, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			symbol = true
+		}
+	}
+	if p.RequireUpper && !upper {
+		violate("missing_upper", "must contain an upper case letter")
+	}
+	if p.RequireLower && !lower {
+		violate("missing_lower", "must contain a lower case letter")
+	}
+	if p.RequireDigit && !digit {
+		violate("missing_digit", "must contain a digit")
+	}
+	if p.RequireSymbol && !symbol {
+		violate("missing_symbol", "must contain a symbol")
+	}
+
+	if p.BanCommon {
+		lowered := strings.ToLower(password)
+		if _, ok := commonPasswords[lowered]; ok {
+			violate("too_common", "must not be a commonly used password")
+		} else if username != "" && strings.Contains(lowered, strings.ToLower(username)) {
+			violate("contains_username", "must not contain the username")
+		}
+	}
+
+	if len(violations) > 0 {
+		return &PasswordPolicyError{Violations: violations}
+	}
+	return nil
+}
+
+// ValidateContext checks a password like Validate and, if a BreachChecker is
+// set, against known breaches. Breach checks fail open: if the API cannot be
+// reached in time, the password is accepted.
+func (p PasswordPolicy) ValidateContext(ctx context.Context, username string, password string) error {
+	err := p.Validate(username, password)
+	if p.Breaches == nil {
+		return err
+	}
+
+	count, breachErr := p.Breaches.Breached(ctx, password)
+	if breachErr != nil {
+		slog.WarnContext(ctx, "Password breach check failed", "err", breachErr)
+		return err
+	}
+	if count == 0 {
+		return err
+	}
+	if !p.Breaches.Reject {
+		slog.WarnContext(ctx, "Password appears in known breaches", "username", username, "breaches", count)
+		return err
+	}
+
+	violation := PasswordViolation{Code: "breached", Message: "must not appear in a known data breach"}
+	if policyErr, ok := err.(*PasswordPolicyError); ok {
+		policyErr.Violations = append(policyErr.Violations, violation)
+		return policyErr
+	}
+	return &PasswordPolicyError{Violations: []PasswordViolation{violation}}
+}
@@ -0,0 +1,88 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/raziel-aleman/go-starter/internal/database"
+	"github.com/raziel-aleman/go-starter/internal/session"
+)
+
+// ErrWrongPassword is returned when the current password does not match.
+var ErrWrongPassword = errors.New("current password is incorrect")
+
+// ChangePassword replaces the password of the logged-in user after checking
+// the current one. The session is migrated to a new ID and every other
+// session of the user is destroyed, so a stolen session cannot outlive the
+// password change. New passwords failing the policy return *PasswordPolicyError.
+func ChangePassword(
+	r *http.Request,
+	srw *session.SessionResponseWriter,
+	dbService database.Service,
+	policy PasswordPolicy,
+	currentPassword string,
+	newPassword string,
+) error {
+	username, _ := session.GetSession(r).Get("username").(string)
+
+	user := User{Username: username, Password: []byte(currentPassword)}
+	if _, err := VerifyCredentials(r.Context(), dbService, user); err != nil {
+		slog.InfoContext(r.Context(), "Password change denied", "username", username, "err", err)
+		return ErrWrongPassword
+	}
+
+	if err := policy.ValidateContext(r.Context(), username, newPassword); err != nil {
+		return err
+	}
+
+	hash, err := hashPassword([]byte(newPassword))
+	if err != nil {
+		return fmt.Errorf("error hashing new password: %v", err)
+	}
+	if err := dbService.SetPasswordHash(r.Context(), username, hash); err != nil {
+		return fmt.Errorf("error updating password: %v", err)
+	}
+
+	// Rotate the session ID, the old session is destroyed by the migration
+	if err := startSession(r, srw, User{Username: username}); err != nil {
+		return err
+	}
+	srw.Session.Delete(mustChangePasswordKey)
+
+	revoked, err := RevokeUserSessions(r, srw.Manager, username, srw.Session.ID)
+	if err != nil {
+		return fmt.Errorf("error revoking other sessions: %w", err)
+	}
+	if revoked > 0 {
+		RecordEvent(r, dbService, EventSessionRevoked, username, fmt.Sprintf("%d sessions after password change", revoked))
+	}
+
+	return nil
+}
+
+// RevokeUserSessions destroys every session of a user except the one with
+// keepID, and returns how many were destroyed.
+func RevokeUserSessions(
+	r *http.Request,
+	manager *session.SessionManager,
+	username string,
+	keepID string,
+) (int, error) {
+	sessions, err := manager.UserSessions(r.Context(), username)
+	if err != nil {
+		return 0, err
+	}
+	revoked := 0
+	for _, s := range sessions {
+		if s.ID == keepID {
+			continue
+		}
+		if err := manager.Store.Destroy(r.Context(), s.ID); err != nil {
+			return revoked, err
+		}
+		revoked++
+	}
+	return revoked, nil
+}
@@ -0,0 +1,152 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/raziel-aleman/go-starter/internal/database/databasetest"
+	"github.com/raziel-aleman/go-starter/internal/database/fake"
+	"github.com/raziel-aleman/go-starter/internal/session"
+	"github.com/raziel-aleman/go-starter/internal/store"
+)
+
+func TestChangePasswordRevokesSessions(t *testing.T) {
+	ctx := context.Background()
+	db := fake.New()
+	hash, err := hashPassword([]byte("old-password-1"))
+	if err != nil {
+		t.Fatalf("error hashing password. Err: %v", err)
+	}
+	db.RegisterUser(ctx, "alice", "", hash)
+	st := store.NewInMemorySessionStore()
+	sm := session.NewSessionManager(st, "GOSESSID", time.Minute, time.Hour)
+	defer sm.Close()
+	sm.CSRFMethods = nil
+
+	// loggedIn stores a session of a user
+	loggedIn := func(username string) *session.Session {
+		s, err := session.NewSession()
+		if err != nil {
+			t.Fatalf("error creating session. Err: %v", err)
+		}
+		s.Put("username", username)
+		if err := st.Write(ctx, s); err != nil {
+			t.Fatalf("error storing session. Err: %v", err)
+		}
+		return s
+	}
+	current, other, bob := loggedIn("alice"), loggedIn("alice"), loggedIn("bob")
+
+	var changeErr error
+	handler := sm.SessionMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		changeErr = ChangePassword(r, w.(*session.SessionResponseWriter), db, PasswordPolicy{}, "old-password-1", "new-password-2")
+	}))
+	req := httptest.NewRequest(http.MethodPost, "/password/change", nil)
+	req.AddCookie(&http.Cookie{Name: "GOSESSID", Value: current.ID})
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if changeErr != nil {
+		t.Fatalf("error changing password. Err: %v", changeErr)
+	}
+	var rotated string
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == "GOSESSID" {
+			rotated = c.Value
+		}
+	}
+	if rotated == "" || rotated == current.ID {
+		t.Fatalf("expected a new session ID; got %q", rotated)
+	}
+	s, err := st.Read(ctx, rotated)
+	if err != nil {
+		t.Fatalf("error reading the new session. Err: %v", err)
+	}
+	if username, _ := s.Get("username").(string); username != "alice" {
+		t.Errorf("expected the new session to belong to alice; got %q", username)
+	}
+	for name, id := range map[string]string{"previous": current.ID, "other": other.ID} {
+		if _, err := st.Read(ctx, id); err == nil {
+			t.Errorf("expected the %s session of alice to be destroyed", name)
+		}
+	}
+	if _, err := st.Read(ctx, bob.ID); err != nil {
+		t.Errorf("expected the session of bob to be kept. Err: %v", err)
+	}
+
+	// The old password no longer works
+	if _, err := VerifyCredentials(ctx, db, User{Username: "alice", Password: []byte("old-password-1")}); err == nil {
+		t.Errorf("expected the old password to be rejected")
+	}
+}
+
+func TestChangePasswordWrongPassword(t *testing.T) {
+	ctx := context.Background()
+	db := fake.New()
+	hash, err := hashPassword([]byte("old-password-1"))
+	if err != nil {
+		t.Fatalf("error hashing password. Err: %v", err)
+	}
+	db.RegisterUser(ctx, "alice", "", hash)
+	sm := session.NewSessionManager(store.NewInMemorySessionStore(), "GOSESSID", time.Minute, time.Hour)
+	defer sm.Close()
+	sm.CSRFMethods = nil
+
+	var changeErr error
+	handler := sm.SessionMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		session.GetSession(r).Put("username", "alice")
+		changeErr = ChangePassword(r, w.(*session.SessionResponseWriter), db, PasswordPolicy{}, "wrong-password", "new-password-2")
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/password/change", nil))
+
+	if !errors.Is(changeErr, ErrWrongPassword) {
+		t.Errorf("expected ErrWrongPassword; got %v", changeErr)
+	}
+}
+
+func TestRevokeUserSessionsSQLStore(t *testing.T) {
+	ctx := context.Background()
+	st := store.NewSQLSessionStore(databasetest.New(t), nil)
+	sm := session.NewSessionManager(st, "GOSESSID", time.Minute, time.Hour)
+	defer sm.Close()
+	st.ExpiresAt = sm.ExpiresAt
+
+	var alice []string
+	for _, username := range []string{"alice", "alice", "alice", "bob"} {
+		s, err := session.NewSession()
+		if err != nil {
+			t.Fatalf("error creating session. Err: %v", err)
+		}
+		s.Put("username", username)
+		if err := st.Write(ctx, s); err != nil {
+			t.Fatalf("error storing session. Err: %v", err)
+		}
+		if username == "alice" {
+			alice = append(alice, s.ID)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/", nil)
+	revoked, err := RevokeUserSessions(req, sm, "alice", alice[0])
+	if err != nil {
+		t.Fatalf("error revoking sessions. Err: %v", err)
+	}
+	if revoked != 2 {
+		t.Errorf("expected 2 revoked sessions; got %d", revoked)
+	}
+	if _, err := st.Read(ctx, alice[0]); err != nil {
+		t.Errorf("expected the kept session of alice to remain. Err: %v", err)
+	}
+	for _, id := range alice[1:] {
+		if _, err := st.Read(ctx, id); err == nil {
+			t.Errorf("expected session %s of alice to be destroyed", id)
+		}
+	}
+	if sessions, err := sm.UserSessions(ctx, "bob"); err != nil || len(sessions) != 1 {
+		t.Errorf("expected the session of bob to be kept; got %d, %v", len(sessions), err)
+	}
+}
@@ -0,0 +1,92 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/raziel-aleman/go-starter/internal/database"
+	"github.com/raziel-aleman/go-starter/internal/session"
+)
+
+// ErrPasswordExpired is returned when tokens are requested with a password
+// older than the policy allows, which must be changed first.
+var ErrPasswordExpired = errors.New("password expired, change it to continue")
+
+// mustChangePasswordKey is the reserved session key flagging a session whose
+// user logged in with an expired password.
+const mustChangePasswordKey = "must_change_password"
+
+// Expired reports whether a password changed at changedAt is older than the
+// maximum age of the policy.
+func (p PasswordPolicy) Expired(changedAt time.Time) bool {
+	return p.MaxAge > 0 && time.Since(changedAt) > p.MaxAge
+}
+
+// CheckPasswordExpiry flags the session of a user who just logged in with a
+// password older than the policy allows, so RequirePasswordChange sends it
+// to the change password flow. It reports whether the password expired.
+func CheckPasswordExpiry(
+	ctx context.Context,
+	s *session.Session,
+	users database.UserRepository,
+	policy PasswordPolicy,
+	username string,
+) (bool, error) {
+	expired, err := passwordExpired(ctx, users, policy, username)
+	if err != nil || !expired {
+		return false, err
+	}
+
+	s.Put(mustChangePasswordKey, true)
+	return true, nil
+}
+
+// passwordExpired reports whether the password of a user is older than the
+// policy allows.
+func passwordExpired(ctx context.Context, users database.UserRepository, policy PasswordPolicy, username string) (bool, error) {
+	if policy.MaxAge <= 0 {
+		return false, nil
+	}
+
+	status, err := users.AccountStatus(ctx, username)
+	if err != nil {
+		return false, fmt.Errorf("error checking password age of %s: %w", username, err)
+	}
+	return policy.Expired(status.PasswordChangedAt), nil
+}
+
+// PasswordChangeRequired reports whether a session was flagged by
+// CheckPasswordExpiry and must change its password.
+func PasswordChangeRequired(s *session.Session) bool {
+	flagged, _ := s.Get(mustChangePasswordKey).(bool)
+	return flagged
+}
+
+// RequirePasswordChange returns a middleware redirecting sessions flagged by
+// CheckPasswordExpiry to changePath until the password is changed. Requests
+// that are not GET are rejected with 403 Forbidden instead. The changePath and
+// allowed paths, like the logout, are always served.
+func RequirePasswordChange(changePath string, allowed ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			flagged := false
+			if s := session.GetSession(r); s != nil {
+				flagged = PasswordChangeRequired(s)
+			}
+			if !flagged || r.URL.Path == changePath || slices.Contains(allowed, r.URL.Path) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if r.Method == http.MethodGet || r.Method == http.MethodHead {
+				http.Redirect(w, r, changePath, http.StatusSeeOther)
+				return
+			}
+			http.Error(w, "Password expired, change it to continue", http.StatusForbidden)
+		})
+	}
+}
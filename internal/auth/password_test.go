@@ -0,0 +1,94 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPasswordPolicy(t *testing.T) {
+	policy := PasswordPolicy{MinLength: 10, MaxLength: 72, RequireDigit: true, RequireSymbol: true, BanCommon: true}
+
+	tests := []struct {
+		password string
+		codes    []string
+	}{
+		{"correct-horse-7", nil},
+		{"short1!", []string{"too_short"}},
+		{"longenoughpassword", []string{"missing_digit", "missing_symbol"}},
+		{"alice-secret-1", []string{"contains_username"}},
+		{"Password123", []string{"missing_symbol", "too_common"}},
+	}
+
+	for _, tt := range tests {
+		err := policy.Validate("alice", tt.password)
+		var policyErr *PasswordPolicyError
+		if tt.codes == nil {
+			if err != nil {
+				t.Errorf("expected %q to be valid; got %v", tt.password, err)
+			}
+			continue
+		}
+		if !errors.As(err, &policyErr) {
+			t.Fatalf("expected policy error for %q; got %v", tt.password, err)
+		}
+		if len(policyErr.Violations) != len(tt.codes) {
+			t.Fatalf("expected violations %v for %q; got %v", tt.codes, tt.password, policyErr.Violations)
+		}
+		for i, code := range tt.codes {
+			if policyErr.Violations[i].Code != code {
+				t.Errorf("expected violation %s for %q; got %s", code, tt.password, policyErr.Violations[i].Code)
+			}
+		}
+	}
+}
+
+func TestPasswordPolicyBreaches(t *testing.T) {
+	// SHA-1 of "correct-horse-7" starts with the prefix requested from the API
+	sum := sha1.Sum([]byte("correct-horse-7"))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/range/"+hash[:5] {
+			t.Errorf("expected range request for %s; got %s", hash[:5], r.URL.Path)
+		}
+		fmt.Fprintf(w, "0000000000000000000000000000000000A:0\r\n%s:42\r\n", hash[5:])
+	}))
+	defer server.Close()
+
+	checker := NewBreachChecker(true)
+	checker.Endpoint = server.URL + "/range/"
+	policy := PasswordPolicy{MinLength: 8, Breaches: checker}
+
+	err := policy.ValidateContext(context.Background(), "alice", "correct-horse-7")
+	var policyErr *PasswordPolicyError
+	if !errors.As(err, &policyErr) || policyErr.Violations[0].Code != "breached" {
+		t.Fatalf("expected breached violation; got %v", err)
+	}
+
+	// Fail open when the API is unreachable
+	server.Close()
+	if err := policy.ValidateContext(context.Background(), "alice", "correct-horse-7"); err != nil {
+		t.Errorf("expected password to be accepted when the API is down; got %v", err)
+	}
+}
+
+func TestPasswordPolicyExpired(t *testing.T) {
+	policy := PasswordPolicy{MaxAge: 24 * time.Hour}
+	if policy.Expired(time.Now().Add(-time.Hour)) {
+		t.Error("expected recent password not to be expired")
+	}
+	if !policy.Expired(time.Now().Add(-48 * time.Hour)) {
+		t.Error("expected old password to be expired")
+	}
+	if (PasswordPolicy{}).Expired(time.Time{}) {
+		t.Error("expected passwords not to expire without a maximum age")
+	}
+}
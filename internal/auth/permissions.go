@@ -0,0 +1,71 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/raziel-aleman/go-starter/internal/database"
+	"github.com/raziel-aleman/go-starter/internal/session"
+)
+
+// Can reports whether a user may perform an action on a resource, e.g.
+// Can(db, "alice", "delete", "post"). Permissions are granted to roles.
+func Can(ctx context.Context, dbService database.Service, username string, action string, resource string) (bool, error) {
+	if username == "" || username == "guest" {
+		return false, nil
+	}
+
+	allowed, err := dbService.UserHasPermission(ctx, username, database.Permission{Action: action, Resource: resource})
+	if err != nil {
+		return false, fmt.Errorf("error checking permission %s on %s: %v", action, resource, err)
+	}
+	return allowed, nil
+}
+
+// CanRequest reports whether the user of the request session may perform an
+// action on a resource, for checks inside handlers.
+func CanRequest(r *http.Request, dbService database.Service, action string, resource string) (bool, error) {
+	username, _ := session.GetSession(r).Get("username").(string)
+	return Can(r.Context(), dbService, username, action, resource)
+}
+
+// RequirePermission only lets users allowed to perform the action on the
+// resource through. It must be composed after AuthMiddleware so the session
+// user is authenticated.
+func RequirePermission(dbService database.Service, action string, resource string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		allowed, err := CanRequest(r, dbService, action, resource)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Failed to check permission", "action", action, "resource", resource, "err", err)
+			http.Error(w, "Failed to check permission", http.StatusInternalServerError)
+			return
+		}
+		if !allowed {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// GrantPermission allows a role to perform an action on a resource.
+func GrantPermission(ctx context.Context, dbService database.Service, role string, action string, resource string) error {
+	if role == "" || action == "" || resource == "" {
+		return fmt.Errorf("role, action and resource must not be empty")
+	}
+	if err := dbService.GrantPermission(ctx, role, database.Permission{Action: action, Resource: resource}); err != nil {
+		return fmt.Errorf("error granting %s on %s to %s: %v", action, resource, role, err)
+	}
+	return nil
+}
+
+// RevokePermission removes a permission from a role.
+func RevokePermission(ctx context.Context, dbService database.Service, role string, action string, resource string) error {
+	if err := dbService.RevokePermission(ctx, role, database.Permission{Action: action, Resource: resource}); err != nil {
+		return fmt.Errorf("error revoking %s on %s from %s: %v", action, resource, role, err)
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+package auth
+
+import (
+	"context"
+	"testing"
+
+	"github.com/raziel-aleman/go-starter/internal/database/fake"
+)
+
+func TestCan(t *testing.T) {
+	ctx := context.Background()
+	db := fake.New()
+	db.RegisterUser(ctx, "alice", "", []byte("hash"))
+	db.RegisterUser(ctx, "bob", "", []byte("hash"))
+	if err := AssignRole(ctx, db, "alice", RoleAdmin); err != nil {
+		t.Fatalf("error assigning role. Err: %v", err)
+	}
+	AssignRole(ctx, db, "bob", "editor")
+	if err := GrantPermission(ctx, db, "editor", "edit", "post"); err != nil {
+		t.Fatalf("error granting permission. Err: %v", err)
+	}
+
+	tests := []struct {
+		username string
+		action   string
+		want     bool
+	}{
+		{"alice", "delete", true},
+		{"bob", "edit", true},
+		{"bob", "delete", false},
+		{"guest", "edit", false},
+		{"", "edit", false},
+	}
+	for _, tt := range tests {
+		allowed, err := Can(ctx, db, tt.username, tt.action, "post")
+		if err != nil || allowed != tt.want {
+			t.Errorf("%q %s post: expected %v; got %v, %v", tt.username, tt.action, tt.want, allowed, err)
+		}
+	}
+}
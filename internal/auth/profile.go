@@ -0,0 +1,110 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"net/mail"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/raziel-aleman/go-starter/internal/database"
+)
+
+// ProfileError maps the invalid profile fields to the reason they were rejected.
+type ProfileError struct {
+	Fields map[string]string `json:"fields"`
+}
+
+func (e *ProfileError) Error() string {
+	reasons := make([]string, 0, len(e.Fields))
+	for field, reason := range e.Fields {
+		reasons = append(reasons, field+" "+reason)
+	}
+	return "invalid profile: " + strings.Join(reasons, "; ")
+}
+
+// ProfileUpdate holds the profile fields to change, nil fields are left as is.
+type ProfileUpdate struct {
+	Email       *string `json:"email"`
+	DisplayName *string `json:"display_name"`
+	AvatarURL   *string `json:"avatar_url"`
+}
+
+// Validate checks the fields of the update and normalizes them in place. It
+// returns a *ProfileError listing the invalid fields.
+func (u *ProfileUpdate) Validate() error {
+	fields := make(map[string]string)
+
+	if u.Email != nil {
+		email := strings.TrimSpace(*u.Email)
+		if email != "" {
+			addr, err := mail.ParseAddress(email)
+			if err != nil || addr.Address != email {
+				fields["email"] = "must be a valid email address"
+			}
+		}
+		u.Email = &email
+	}
+
+	if u.DisplayName != nil {
+		name := strings.TrimSpace(*u.DisplayName)
+		if utf8.RuneCountInString(name) > 100 {
+			fields["display_name"] = "must be at most 100 characters long"
+		}
+		u.DisplayName = &name
+	}
+
+	if u.AvatarURL != nil {
+		avatar := strings.TrimSpace(*u.AvatarURL)
+		if avatar != "" {
+			parsed, err := url.Parse(avatar)
+			if err != nil || (parsed.Scheme != "https" && parsed.Scheme != "http") || parsed.Host == "" {
+				fields["avatar_url"] = "must be an absolute http or https URL"
+			} else if len(avatar) > 2048 {
+				fields["avatar_url"] = "must be at most 2048 characters long"
+			}
+		}
+		u.AvatarURL = &avatar
+	}
+
+	if len(fields) > 0 {
+		return &ProfileError{Fields: fields}
+	}
+	return nil
+}
+
+// GetProfile returns the user with its profile fields.
+func GetProfile(ctx context.Context, users database.UserRepository, username string) (User, error) {
+	profile, err := users.UserProfile(ctx, username)
+	if err != nil {
+		return User{}, fmt.Errorf("error retrieving profile of %s: %w", username, err)
+	}
+	return User{
+		Username:    profile.Username,
+		Email:       profile.Email,
+		DisplayName: profile.DisplayName,
+		AvatarURL:   profile.AvatarURL,
+		Verified:    profile.Verified,
+	}, nil
+}
+
+// UpdateProfile validates and applies a profile update, then returns the
+// updated user. Invalid fields return *ProfileError.
+func UpdateProfile(ctx context.Context, users database.UserRepository, username string, update ProfileUpdate) (User, error) {
+	if err := update.Validate(); err != nil {
+		return User{}, err
+	}
+
+	err := users.UpdateUserProfile(ctx, username, database.ProfileUpdate{
+		Email:       update.Email,
+		DisplayName: update.DisplayName,
+		AvatarURL:   update.AvatarURL,
+	})
+	if err != nil {
+		return User{}, fmt.Errorf("error updating profile of %s: %w", username, err)
+	}
+
+	// The profile may be read from a replica, which could miss the update
+	return GetProfile(database.WithPrimary(ctx), users, username)
+}
@@ -0,0 +1,135 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/raziel-aleman/go-starter/internal/auth/oauth"
+	"github.com/raziel-aleman/go-starter/internal/auth/saml"
+	"github.com/raziel-aleman/go-starter/internal/database"
+)
+
+// ProvisionOAuthUser returns the local user linked to an external identity.
+// Unknown identities get a new user named "<provider>:<subject>" with a random
+// password, so it can only sign in through the provider, unless the email of
+// the identity belongs to an existing user, which returns ErrEmailConflict.
+func ProvisionOAuthUser(
+	ctx context.Context,
+	dbService database.Service,
+	identity *oauth.Identity,
+) (User, error) {
+	linked, err := dbService.FindIdentity(ctx, identity.Provider, identity.Subject)
+	if err == nil {
+		if err := ensureEnabled(ctx, dbService, linked.Username); err != nil {
+			return User{}, err
+		}
+		return User{Username: linked.Username}, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return User{}, fmt.Errorf("error retrieving %s identity: %v", identity.Provider, err)
+	}
+
+	// Users provisioned before identities were linked are named after them
+	username := identity.Provider + ":" + identity.Subject
+	_, err = dbService.CanonicalUsername(ctx, username)
+	if errors.Is(err, sql.ErrNoRows) && identity.Email != "" {
+		_, err = dbService.FindUserByEmail(ctx, identity.Email)
+		if err == nil {
+			return User{}, ErrEmailConflict
+		}
+	}
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return User{}, fmt.Errorf("error checking existing users: %v", err)
+	}
+
+	user, err := provisionUser(ctx, dbService, username)
+	if err != nil {
+		return user, err
+	}
+	if err := linkIdentity(ctx, dbService, user.Username, identity); err != nil {
+		return user, err
+	}
+
+	return user, nil
+}
+
+// SAMLAttributes names the assertion attributes mapped to user fields. An
+// empty Username maps the NameID of the assertion.
+type SAMLAttributes struct {
+	Username    string
+	Email       string
+	DisplayName string
+}
+
+// ProvisionSAMLUser makes sure a local user named "saml:<username>" exists
+// for a verified assertion and returns it. The email and display name are
+// taken from the assertion when the user has none yet.
+func ProvisionSAMLUser(
+	ctx context.Context,
+	dbService database.Service,
+	assertion *saml.Assertion,
+	attributes SAMLAttributes,
+) (User, error) {
+	subject := assertion.NameID
+	if attributes.Username != "" {
+		subject = assertion.Attribute(attributes.Username)
+	}
+	if subject == "" {
+		return User{}, fmt.Errorf("saml assertion has no %s attribute", attributes.Username)
+	}
+
+	user, err := provisionUser(ctx, dbService, "saml:"+subject)
+	if err != nil {
+		return user, err
+	}
+
+	profile, err := dbService.UserProfile(ctx, user.Username)
+	if err != nil {
+		return user, fmt.Errorf("error retrieving profile of %s: %v", user.Username, err)
+	}
+	var update database.ProfileUpdate
+	if email := assertion.Attribute(attributes.Email); profile.Email == "" && email != "" {
+		update.Email = &email
+	}
+	if name := assertion.Attribute(attributes.DisplayName); profile.DisplayName == "" && name != "" {
+		update.DisplayName = &name
+	}
+	if err := dbService.UpdateUserProfile(ctx, user.Username, update); err != nil {
+		return user, fmt.Errorf("error updating profile of %s: %v", user.Username, err)
+	}
+
+	return user, nil
+}
+
+// provisionUser creates the user with a random password, so it can only sign
+// in through an external identity provider, unless it already exists.
+func provisionUser(ctx context.Context, dbService database.Service, username string) (User, error) {
+	user := User{Username: username}
+
+	password := make([]byte, 32)
+	if _, err := rand.Read(password); err != nil {
+		return user, fmt.Errorf("error generating password while provisioning user: %v", err)
+	}
+	hashedPassword, err := hashPassword(password)
+	if err != nil {
+		return user, fmt.Errorf("error hashing user password while provisioning: %v", err)
+	}
+
+	if err := dbService.ProvisionUser(ctx, user.Username, hashedPassword); err != nil {
+		return user, fmt.Errorf("error provisioning user: %v", err)
+	}
+
+	// An existing user may differ in case
+	if user.Username, err = dbService.CanonicalUsername(ctx, username); err != nil {
+		return user, fmt.Errorf("error retrieving provisioned user: %v", err)
+	}
+
+	if err := ensureEnabled(ctx, dbService, user.Username); err != nil {
+		return user, err
+	}
+
+	return user, nil
+}
@@ -0,0 +1,90 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/raziel-aleman/go-starter/internal/database"
+	"github.com/raziel-aleman/go-starter/internal/session"
+)
+
+// authenticatedAtKey is the reserved session key holding when the user last
+// proved its identity, by logging in or reauthenticating.
+const authenticatedAtKey = "authenticated_at"
+
+// ErrReauthenticationRequired is returned when the last authentication of the
+// user is too old for a sensitive action.
+var ErrReauthenticationRequired = errors.New("recent authentication required")
+
+// Reauthenticate confirms the identity of the logged-in user with its password
+// or, if two-factor authentication is enabled, a second factor code, and
+// records the time in the session for RequireRecentAuth.
+func Reauthenticate(
+	r *http.Request,
+	dbService database.Service,
+	password string,
+	code string,
+) error {
+	s := session.GetSession(r)
+	username, _ := s.Get("username").(string)
+
+	switch {
+	case password != "":
+		if _, err := VerifyCredentials(r.Context(), dbService, User{Username: username, Password: []byte(password)}); err != nil {
+			return fmt.Errorf("%w: %v", ErrWrongPassword, err)
+		}
+	case code != "":
+		enabled, err := TwoFactorRequired(r.Context(), dbService, username)
+		if err != nil {
+			return fmt.Errorf("error checking two-factor authentication: %w", err)
+		}
+		if !enabled {
+			return ErrInvalidTwoFactorCode
+		}
+		if err := VerifySecondFactor(r.Context(), dbService, username, code); err != nil {
+			return err
+		}
+	default:
+		return ErrWrongPassword
+	}
+
+	markAuthenticated(s)
+	return nil
+}
+
+// RequireRecentAuth returns a middleware rejecting requests with 403 Forbidden
+// unless the user authenticated within maxAge, so a stolen or unattended
+// session cannot be used for sensitive actions without the credentials. It
+// must run after the AuthMiddleware.
+func RequireRecentAuth(maxAge time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !authenticatedWithin(session.GetSession(r), maxAge) {
+				http.Error(w, ErrReauthenticationRequired.Error(), http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// markAuthenticated records that the user of the session just authenticated.
+func markAuthenticated(s *session.Session) {
+	s.Put(authenticatedAtKey, time.Now().UTC().Format(time.RFC3339))
+}
+
+// authenticatedWithin reports whether the user of the session authenticated
+// within maxAge.
+func authenticatedWithin(s *session.Session, maxAge time.Duration) bool {
+	if s == nil {
+		return false
+	}
+	value, _ := s.Get(authenticatedAtKey).(string)
+	authenticatedAt, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return false
+	}
+	return time.Since(authenticatedAt) <= maxAge
+}
@@ -0,0 +1,54 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/raziel-aleman/go-starter/internal/database"
+	"github.com/raziel-aleman/go-starter/internal/session"
+)
+
+// RoleAdmin is the role of users allowed to manage other users.
+const RoleAdmin = "admin"
+
+// AssignRole grants a role to a user.
+func AssignRole(ctx context.Context, dbService database.Service, username string, role string) error {
+	if role == "" {
+		return fmt.Errorf("role must not be empty")
+	}
+	if err := dbService.AssignRole(ctx, username, role); err != nil {
+		return fmt.Errorf("error assigning role %s to %s: %v", role, username, err)
+	}
+	return nil
+}
+
+// RemoveRole revokes a role from a user.
+func RemoveRole(ctx context.Context, dbService database.Service, username string, role string) error {
+	if err := dbService.RemoveRole(ctx, username, role); err != nil {
+		return fmt.Errorf("error removing role %s from %s: %v", role, username, err)
+	}
+	return nil
+}
+
+// RequireRole only lets users with the given role through. It must be
+// composed after AuthMiddleware so the session user is authenticated.
+func RequireRole(dbService database.Service, role string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		username, _ := session.GetSession(r).Get("username").(string)
+
+		ok, err := dbService.HasRole(r.Context(), username, role)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Failed to check user role", "username", username, "role", role, "err", err)
+			http.Error(w, "Failed to check user role", http.StatusInternalServerError)
+			return
+		}
+		if !ok {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,432 @@
+// Package saml implements a SAML 2.0 service provider for the Web Browser SSO
+// profile, with authentication requests sent over the HTTP-Redirect binding
+// and signed responses received over the HTTP-POST binding.
+package saml
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SAML namespaces, bindings and status codes.
+const (
+	nsAssertion = "urn:oasis:names:tc:SAML:2.0:assertion"
+	nsProtocol  = "urn:oasis:names:tc:SAML:2.0:protocol"
+
+	bindingHTTPPost   = "urn:oasis:names:tc:SAML:2.0:bindings:HTTP-POST"
+	statusSuccess     = "urn:oasis:names:tc:SAML:2.0:status:Success"
+	confirmBearer     = "urn:oasis:names:tc:SAML:2.0:cm:bearer"
+	nameIDUnspecified = "urn:oasis:names:tc:SAML:1.1:nameid-format:unspecified"
+)
+
+// ErrInvalidResponse is returned when a SAML response fails validation.
+var ErrInvalidResponse = errors.New("invalid saml response")
+
+// Config configures the service provider.
+type Config struct {
+	EntityID       string            // Entity ID of the service provider, usually its metadata URL
+	ACSURL         string            // Assertion consumer service URL receiving responses
+	IdPEntityID    string            // Entity ID of the identity provider
+	IdPSSOURL      string            // Single sign-on URL of the identity provider
+	IdPCertificate *x509.Certificate // Certificate signing the identity provider responses
+	Key            []byte            // Secret key signing the relay state
+	ClockSkew      time.Duration     // Tolerated clock difference with the identity provider
+	RequestTimeout time.Duration     // Time the user has to complete a login at the identity provider
+}
+
+// Assertion is the verified identity asserted by the identity provider.
+type Assertion struct {
+	ID           string
+	NameID       string
+	SessionIndex string
+	Attributes   map[string][]string
+}
+
+// Attribute returns the first value of an attribute, or "" if it is missing.
+func (a *Assertion) Attribute(name string) string {
+	if values := a.Attributes[name]; len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// ServiceProvider creates authentication requests and validates the responses
+// of a single identity provider.
+type ServiceProvider struct {
+	config Config
+
+	mu   sync.Mutex
+	seen map[string]time.Time // Consumed assertion IDs and when they can be forgotten
+}
+
+// New creates a ServiceProvider.
+func New(config Config) (*ServiceProvider, error) {
+	if config.EntityID == "" || config.ACSURL == "" || config.IdPSSOURL == "" {
+		return nil, errors.New("saml entity ID, ACS URL and IdP SSO URL are required")
+	}
+	if config.IdPCertificate == nil {
+		return nil, errors.New("saml IdP certificate is required")
+	}
+	if len(config.Key) == 0 {
+		return nil, errors.New("saml relay state key is required")
+	}
+	if config.ClockSkew == 0 {
+		config.ClockSkew = 2 * time.Minute
+	}
+	if config.RequestTimeout == 0 {
+		config.RequestTimeout = 10 * time.Minute
+	}
+	return &ServiceProvider{config: config, seen: map[string]time.Time{}}, nil
+}
+
+// metadata is the EntityDescriptor published by the service provider.
+type metadata struct {
+	XMLName         xml.Name `xml:"urn:oasis:names:tc:SAML:2.0:metadata EntityDescriptor"`
+	EntityID        string   `xml:"entityID,attr"`
+	SPSSODescriptor struct {
+		AuthnRequestsSigned      bool   `xml:"AuthnRequestsSigned,attr"`
+		WantAssertionsSigned     bool   `xml:"WantAssertionsSigned,attr"`
+		ProtocolSupport          string `xml:"protocolSupportEnumeration,attr"`
+		AssertionConsumerService struct {
+			Binding  string `xml:"Binding,attr"`
+			Location string `xml:"Location,attr"`
+			Index    int    `xml:"index,attr"`
+		}
+	}
+}
+
+// Metadata returns the service provider metadata to register at the identity provider.
+func (sp *ServiceProvider) Metadata() ([]byte, error) {
+	var md metadata
+	md.EntityID = sp.config.EntityID
+	md.SPSSODescriptor.WantAssertionsSigned = true
+	md.SPSSODescriptor.ProtocolSupport = nsProtocol
+	md.SPSSODescriptor.AssertionConsumerService.Binding = bindingHTTPPost
+	md.SPSSODescriptor.AssertionConsumerService.Location = sp.config.ACSURL
+
+	out, err := xml.MarshalIndent(md, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("error encoding saml metadata: %v", err)
+	}
+	return append([]byte(xml.Header), out...), nil
+}
+
+// authnRequest is the AuthnRequest sent to the identity provider.
+type authnRequest struct {
+	XMLName         xml.Name `xml:"urn:oasis:names:tc:SAML:2.0:protocol AuthnRequest"`
+	ID              string   `xml:"ID,attr"`
+	Version         string   `xml:"Version,attr"`
+	IssueInstant    string   `xml:"IssueInstant,attr"`
+	Destination     string   `xml:"Destination,attr"`
+	ACSURL          string   `xml:"AssertionConsumerServiceURL,attr"`
+	ProtocolBinding string   `xml:"ProtocolBinding,attr"`
+	Issuer          struct {
+		XMLName xml.Name `xml:"urn:oasis:names:tc:SAML:2.0:assertion Issuer"`
+		Value   string   `xml:",chardata"`
+	}
+	NameIDPolicy struct {
+		XMLName     xml.Name `xml:"urn:oasis:names:tc:SAML:2.0:protocol NameIDPolicy"`
+		Format      string   `xml:"Format,attr"`
+		AllowCreate bool     `xml:"AllowCreate,attr"`
+	}
+}
+
+// LoginURL returns the identity provider URL starting a login, using the
+// HTTP-Redirect binding. The request ID is carried in a signed RelayState
+// instead of the session, because the session cookie is not sent with the
+// cross-site POST of the response.
+func (sp *ServiceProvider) LoginURL() (string, error) {
+	id, err := newID()
+	if err != nil {
+		return "", err
+	}
+
+	req := authnRequest{
+		ID:              id,
+		Version:         "2.0",
+		IssueInstant:    time.Now().UTC().Format(time.RFC3339),
+		Destination:     sp.config.IdPSSOURL,
+		ACSURL:          sp.config.ACSURL,
+		ProtocolBinding: bindingHTTPPost,
+	}
+	req.Issuer.Value = sp.config.EntityID
+	req.NameIDPolicy.Format = nameIDUnspecified
+	req.NameIDPolicy.AllowCreate = true
+
+	out, err := xml.Marshal(req)
+	if err != nil {
+		return "", fmt.Errorf("error encoding saml request: %v", err)
+	}
+
+	var deflated bytes.Buffer
+	w, _ := flate.NewWriter(&deflated, flate.BestCompression)
+	w.Write(out)
+	if err := w.Close(); err != nil {
+		return "", fmt.Errorf("error compressing saml request: %v", err)
+	}
+
+	u, err := url.Parse(sp.config.IdPSSOURL)
+	if err != nil {
+		return "", fmt.Errorf("error parsing saml IdP SSO URL: %v", err)
+	}
+	q := u.Query()
+	q.Set("SAMLRequest", base64.StdEncoding.EncodeToString(deflated.Bytes()))
+	q.Set("RelayState", sp.relayState(id, time.Now().Add(sp.config.RequestTimeout)))
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// relayState signs the request ID and its expiry.
+func (sp *ServiceProvider) relayState(id string, expires time.Time) string {
+	payload := id + "." + strconv.FormatInt(expires.Unix(), 10)
+	return payload + "." + base64.RawURLEncoding.EncodeToString(sp.mac(payload))
+}
+
+// requestID returns the request ID of a relay state, if its signature is
+// valid and it has not expired.
+func (sp *ServiceProvider) requestID(relayState string, now time.Time) (string, error) {
+	parts := strings.Split(relayState, ".")
+	if len(parts) != 3 {
+		return "", errors.New("malformed relay state")
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || !hmac.Equal(mac, sp.mac(parts[0]+"."+parts[1])) {
+		return "", errors.New("invalid relay state signature")
+	}
+	expires, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil || now.After(time.Unix(expires, 0)) {
+		return "", errors.New("expired relay state")
+	}
+	return parts[0], nil
+}
+
+func (sp *ServiceProvider) mac(payload string) []byte {
+	h := hmac.New(sha256.New, sp.config.Key)
+	h.Write([]byte(payload))
+	return h.Sum(nil)
+}
+
+// ParseResponse validates a base64 encoded SAML response received on the
+// assertion consumer service, with its relay state, and returns the asserted
+// identity. Each assertion is only accepted once.
+func (sp *ServiceProvider) ParseResponse(samlResponse, relayState string) (*Assertion, error) {
+	assertion, expires, err := sp.parseResponse(samlResponse, relayState, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidResponse, err)
+	}
+	if err := sp.consume(assertion.ID, expires); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidResponse, err)
+	}
+	return assertion, nil
+}
+
+// parseResponse validates the response and returns its assertion along with
+// the time after which it is no longer valid.
+func (sp *ServiceProvider) parseResponse(samlResponse, relayState string, now time.Time) (*Assertion, time.Time, error) {
+	var expires time.Time
+
+	requestID, err := sp.requestID(relayState, now)
+	if err != nil {
+		return nil, expires, err
+	}
+
+	data, err := decodeBase64(samlResponse)
+	if err != nil {
+		return nil, expires, fmt.Errorf("error decoding response: %v", err)
+	}
+	root, err := parseXML(data)
+	if err != nil {
+		return nil, expires, fmt.Errorf("error parsing response: %v", err)
+	}
+	if err := checkUniqueIDs(root); err != nil {
+		return nil, expires, err
+	}
+
+	if !root.is(nsProtocol, "Response") {
+		return nil, expires, errors.New("document is not a response")
+	}
+	if root.attr("Version") != "2.0" {
+		return nil, expires, errors.New("unsupported version")
+	}
+	if dest := root.attr("Destination"); dest != "" && dest != sp.config.ACSURL {
+		return nil, expires, fmt.Errorf("unexpected destination %q", dest)
+	}
+	if root.attr("InResponseTo") != requestID {
+		return nil, expires, errors.New("response does not answer the pending request")
+	}
+	if issuer := root.child(nsAssertion, "Issuer"); issuer != nil && issuer.text() != sp.config.IdPEntityID {
+		return nil, expires, fmt.Errorf("unexpected issuer %q", issuer.text())
+	}
+	status := root.child(nsProtocol, "Status").child(nsProtocol, "StatusCode").attr("Value")
+	if status != statusSuccess {
+		return nil, expires, fmt.Errorf("identity provider returned status %q", status)
+	}
+
+	if len(root.childElements(nsAssertion, "EncryptedAssertion")) > 0 {
+		return nil, expires, errors.New("encrypted assertions are not supported")
+	}
+	assertions := root.childElements(nsAssertion, "Assertion")
+	if len(assertions) != 1 {
+		return nil, expires, errors.New("response must contain exactly one assertion")
+	}
+	a := assertions[0]
+
+	// Either the whole response or the assertion itself must be signed
+	err = verifySignature(root, sp.config.IdPCertificate)
+	if errors.Is(err, errNotSigned) {
+		err = verifySignature(a, sp.config.IdPCertificate)
+	}
+	if err != nil {
+		return nil, expires, err
+	}
+
+	return sp.checkAssertion(a, requestID, now)
+}
+
+// checkAssertion validates the issuer, subject and conditions of a signed assertion.
+func (sp *ServiceProvider) checkAssertion(a *element, requestID string, now time.Time) (*Assertion, time.Time, error) {
+	var expires time.Time
+	skew := sp.config.ClockSkew
+
+	if a.attr("ID") == "" {
+		return nil, expires, errors.New("assertion has no ID")
+	}
+	if issuer := a.child(nsAssertion, "Issuer").text(); issuer != sp.config.IdPEntityID {
+		return nil, expires, fmt.Errorf("unexpected assertion issuer %q", issuer)
+	}
+
+	subject := a.child(nsAssertion, "Subject")
+	nameID := subject.child(nsAssertion, "NameID").text()
+	if nameID == "" {
+		return nil, expires, errors.New("assertion has no subject")
+	}
+
+	// A bearer confirmation for this service provider and request is required
+	confirmed := false
+	for _, confirmation := range subject.childElements(nsAssertion, "SubjectConfirmation") {
+		if confirmation.attr("Method") != confirmBearer {
+			continue
+		}
+		data := confirmation.child(nsAssertion, "SubjectConfirmationData")
+		if data.attr("Recipient") != sp.config.ACSURL || data.attr("InResponseTo") != requestID {
+			continue
+		}
+		notOnOrAfter, err := time.Parse(time.RFC3339, data.attr("NotOnOrAfter"))
+		if err != nil || !now.Before(notOnOrAfter.Add(skew)) {
+			continue
+		}
+		confirmed = true
+		expires = notOnOrAfter.Add(skew)
+	}
+	if !confirmed {
+		return nil, expires, errors.New("assertion has no valid bearer confirmation")
+	}
+
+	conditions := a.child(nsAssertion, "Conditions")
+	if conditions == nil {
+		return nil, expires, errors.New("assertion has no conditions")
+	}
+	if v := conditions.attr("NotBefore"); v != "" {
+		notBefore, err := time.Parse(time.RFC3339, v)
+		if err != nil || now.Add(skew).Before(notBefore) {
+			return nil, expires, errors.New("assertion is not yet valid")
+		}
+	}
+	if v := conditions.attr("NotOnOrAfter"); v != "" {
+		notOnOrAfter, err := time.Parse(time.RFC3339, v)
+		if err != nil || !now.Before(notOnOrAfter.Add(skew)) {
+			return nil, expires, errors.New("assertion has expired")
+		}
+		if notOnOrAfter.Add(skew).After(expires) {
+			expires = notOnOrAfter.Add(skew)
+		}
+	}
+	// Every audience restriction must include this service provider
+	for _, restriction := range conditions.childElements(nsAssertion, "AudienceRestriction") {
+		allowed := false
+		for _, audience := range restriction.childElements(nsAssertion, "Audience") {
+			allowed = allowed || audience.text() == sp.config.EntityID
+		}
+		if !allowed {
+			return nil, expires, errors.New("assertion is not intended for this service provider")
+		}
+	}
+
+	assertion := &Assertion{
+		ID:         a.attr("ID"),
+		NameID:     nameID,
+		Attributes: map[string][]string{},
+	}
+	if statement := a.child(nsAssertion, "AuthnStatement"); statement != nil {
+		assertion.SessionIndex = statement.attr("SessionIndex")
+	}
+	for _, statement := range a.childElements(nsAssertion, "AttributeStatement") {
+		for _, attribute := range statement.childElements(nsAssertion, "Attribute") {
+			name := attribute.attr("Name")
+			for _, value := range attribute.childElements(nsAssertion, "AttributeValue") {
+				assertion.Attributes[name] = append(assertion.Attributes[name], value.text())
+			}
+		}
+	}
+	return assertion, expires, nil
+}
+
+// consume records an assertion ID until it expires, failing if it was
+// already seen.
+func (sp *ServiceProvider) consume(id string, expires time.Time) error {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+
+	now := time.Now()
+	for seenID, until := range sp.seen {
+		if now.After(until) {
+			delete(sp.seen, seenID)
+		}
+	}
+	if _, ok := sp.seen[id]; ok {
+		return errors.New("assertion was already used")
+	}
+	sp.seen[id] = expires
+	return nil
+}
+
+// checkUniqueIDs rejects documents with duplicate IDs, which could make a
+// signature reference resolve to a different element than the one consumed.
+func checkUniqueIDs(root *element) error {
+	ids := map[string]bool{}
+	var err error
+	root.walk(func(e *element) {
+		id := e.attr("ID")
+		if id == "" {
+			return
+		}
+		if ids[id] {
+			err = fmt.Errorf("duplicate ID %q", id)
+		}
+		ids[id] = true
+	})
+	return err
+}
+
+// newID returns a random identifier, starting with a letter as required for xs:ID.
+func newID() (string, error) {
+	b := make([]byte, 20)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("error generating saml request ID: %v", err)
+	}
+	return "_" + hex.EncodeToString(b), nil
+}
@@ -0,0 +1,226 @@
+package saml
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCanonicalize(t *testing.T) {
+	doc := `<a:Root xmlns:a="urn:a" xmlns:b="urn:b" z="1" a:y="2"><a:Child   b:x="&lt;&quot;" >text &amp; more</a:Child><Empty xmlns="urn:c"/></a:Root>`
+	root, err := parseXML([]byte(doc))
+	if err != nil {
+		t.Fatalf("error parsing document. Err: %v", err)
+	}
+
+	expected := `<a:Child xmlns:a="urn:a" xmlns:b="urn:b" b:x="&lt;&quot;">text &amp; more</a:Child>`
+	if got := string(canonicalize(root.child("urn:a", "Child"), nil, nil)); got != expected {
+		t.Errorf("expected %s; got %s", expected, got)
+	}
+	expected = `<a:Root xmlns:a="urn:a" z="1" a:y="2"><a:Child xmlns:b="urn:b" b:x="&lt;&quot;">text &amp; more</a:Child><Empty xmlns="urn:c"></Empty></a:Root>`
+	if got := string(canonicalize(root, nil, nil)); got != expected {
+		t.Errorf("expected %s; got %s", expected, got)
+	}
+}
+
+func TestParseXMLRejectsDTD(t *testing.T) {
+	_, err := parseXML([]byte(`<!DOCTYPE r [<!ENTITY x "y">]><r>&x;</r>`))
+	if err == nil {
+		t.Fatal("expected document with a DTD to be rejected")
+	}
+}
+
+// testIdP signs responses like an identity provider would.
+type testIdP struct {
+	key  *rsa.PrivateKey
+	cert *x509.Certificate
+}
+
+func newTestIdP(t *testing.T) *testIdP {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("error generating key. Err: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "idp"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("error creating certificate. Err: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("error parsing certificate. Err: %v", err)
+	}
+	return &testIdP{key: key, cert: cert}
+}
+
+// sign inserts an enveloped signature of the element with the given ID right
+// after its Issuer.
+func (idp *testIdP) sign(t *testing.T, doc, id string) string {
+	t.Helper()
+	root, err := parseXML([]byte(doc))
+	if err != nil {
+		t.Fatalf("error parsing document. Err: %v", err)
+	}
+	var signed *element
+	root.walk(func(e *element) {
+		if e.attr("ID") == id {
+			signed = e
+		}
+	})
+	digest := sha256.Sum256(canonicalize(signed, nil, nil))
+
+	signature := fmt.Sprintf(`<ds:Signature xmlns:ds="http://www.w3.org/2000/09/xmldsig#"><ds:SignedInfo>`+
+		`<ds:CanonicalizationMethod Algorithm="%s"/><ds:SignatureMethod Algorithm="%s"/>`+
+		`<ds:Reference URI="#%s"><ds:Transforms><ds:Transform Algorithm="%s"/><ds:Transform Algorithm="%s"/></ds:Transforms>`+
+		`<ds:DigestMethod Algorithm="%s"/><ds:DigestValue>%s</ds:DigestValue></ds:Reference>`+
+		`</ds:SignedInfo><ds:SignatureValue></ds:SignatureValue></ds:Signature>`,
+		algExcC14N, algRSASHA256, id, algEnveloped, algExcC14N, algSHA256,
+		base64.StdEncoding.EncodeToString(digest[:]))
+
+	// The signature goes after the Issuer of the signed element
+	marker := `ID="` + id + `"`
+	start := strings.Index(doc, marker)
+	end := strings.Index(doc[start:], "</saml:Issuer>") + start + len("</saml:Issuer>")
+	doc = doc[:end] + signature + doc[end:]
+
+	root, err = parseXML([]byte(doc))
+	if err != nil {
+		t.Fatalf("error parsing signed document. Err: %v", err)
+	}
+	var signedInfo *element
+	root.walk(func(e *element) {
+		if e.is(nsDSig, "SignedInfo") {
+			signedInfo = e
+		}
+	})
+	hashed := sha256.Sum256(canonicalize(signedInfo, nil, nil))
+	value, err := rsa.SignPKCS1v15(rand.Reader, idp.key, crypto.SHA256, hashed[:])
+	if err != nil {
+		t.Fatalf("error signing document. Err: %v", err)
+	}
+	return strings.Replace(doc, "<ds:SignatureValue></ds:SignatureValue>",
+		"<ds:SignatureValue>"+base64.StdEncoding.EncodeToString(value)+"</ds:SignatureValue>", 1)
+}
+
+const testResponse = `<samlp:Response xmlns:samlp="urn:oasis:names:tc:SAML:2.0:protocol" xmlns:saml="urn:oasis:names:tc:SAML:2.0:assertion" ID="_response" Version="2.0" IssueInstant="{{now}}" Destination="https://sp.example.com/saml/acs" InResponseTo="{{request}}">` +
+	`<saml:Issuer>https://idp.example.com</saml:Issuer>` +
+	`<samlp:Status><samlp:StatusCode Value="urn:oasis:names:tc:SAML:2.0:status:Success"/></samlp:Status>` +
+	`<saml:Assertion ID="_assertion" Version="2.0" IssueInstant="{{now}}">` +
+	`<saml:Issuer>https://idp.example.com</saml:Issuer>` +
+	`<saml:Subject><saml:NameID>{{subject}}</saml:NameID>` +
+	`<saml:SubjectConfirmation Method="urn:oasis:names:tc:SAML:2.0:cm:bearer">` +
+	`<saml:SubjectConfirmationData Recipient="https://sp.example.com/saml/acs" InResponseTo="{{request}}" NotOnOrAfter="{{expires}}"/>` +
+	`</saml:SubjectConfirmation></saml:Subject>` +
+	`<saml:Conditions NotBefore="{{now}}" NotOnOrAfter="{{expires}}">` +
+	`<saml:AudienceRestriction><saml:Audience>https://sp.example.com/saml/metadata</saml:Audience></saml:AudienceRestriction>` +
+	`</saml:Conditions>` +
+	`<saml:AuthnStatement AuthnInstant="{{now}}" SessionIndex="_session"/>` +
+	`<saml:AttributeStatement><saml:Attribute Name="email"><saml:AttributeValue>alice@example.com</saml:AttributeValue></saml:Attribute></saml:AttributeStatement>` +
+	`</saml:Assertion></samlp:Response>`
+
+func newTestResponse(requestID, subject string) string {
+	now := time.Now().UTC()
+	return strings.NewReplacer(
+		"{{now}}", now.Format(time.RFC3339),
+		"{{expires}}", now.Add(5*time.Minute).Format(time.RFC3339),
+		"{{request}}", requestID,
+		"{{subject}}", subject,
+	).Replace(testResponse)
+}
+
+func newTestServiceProvider(t *testing.T, idp *testIdP) *ServiceProvider {
+	t.Helper()
+	sp, err := New(Config{
+		EntityID:       "https://sp.example.com/saml/metadata",
+		ACSURL:         "https://sp.example.com/saml/acs",
+		IdPEntityID:    "https://idp.example.com",
+		IdPSSOURL:      "https://idp.example.com/sso",
+		IdPCertificate: idp.cert,
+		Key:            []byte("relay-state-key"),
+	})
+	if err != nil {
+		t.Fatalf("error creating service provider. Err: %v", err)
+	}
+	return sp
+}
+
+func TestParseResponse(t *testing.T) {
+	idp := newTestIdP(t)
+	sp := newTestServiceProvider(t, idp)
+	relayState := sp.relayState("_request", time.Now().Add(time.Minute))
+	encode := func(doc string) string { return base64.StdEncoding.EncodeToString([]byte(doc)) }
+
+	signed := idp.sign(t, newTestResponse("_request", "alice"), "_assertion")
+	assertion, err := sp.ParseResponse(encode(signed), relayState)
+	if err != nil {
+		t.Fatalf("error parsing signed response. Err: %v", err)
+	}
+	if assertion.NameID != "alice" || assertion.Attribute("email") != "alice@example.com" || assertion.SessionIndex != "_session" {
+		t.Errorf("unexpected assertion %+v", assertion)
+	}
+
+	// The same assertion cannot be used twice
+	if _, err := sp.ParseResponse(encode(signed), relayState); !errors.Is(err, ErrInvalidResponse) {
+		t.Errorf("expected replayed assertion to be rejected; got %v", err)
+	}
+
+	// A signature over the whole response is accepted too
+	sp = newTestServiceProvider(t, idp)
+	if _, err := sp.ParseResponse(encode(idp.sign(t, newTestResponse("_request", "alice"), "_response")), relayState); err != nil {
+		t.Errorf("error parsing response with signed envelope. Err: %v", err)
+	}
+
+	tests := map[string]struct {
+		response   string
+		relayState string
+	}{
+		"unsigned": {
+			response:   newTestResponse("_request", "alice"),
+			relayState: relayState,
+		},
+		"tampered": {
+			response:   strings.Replace(signed, "<saml:NameID>alice", "<saml:NameID>admin", 1),
+			relayState: relayState,
+		},
+		"other request": {
+			response:   idp.sign(t, newTestResponse("_other", "alice"), "_assertion"),
+			relayState: relayState,
+		},
+		"forged relay state": {
+			response:   signed,
+			relayState: "_request.9999999999.AAAA",
+		},
+		"expired relay state": {
+			response:   signed,
+			relayState: sp.relayState("_request", time.Now().Add(-time.Minute)),
+		},
+		"wrapped": {
+			// A second, unsigned assertion with the signed one's ID
+			response: strings.Replace(signed, "<saml:Assertion ",
+				`<saml:Assertion ID="_assertion"><saml:Issuer>https://idp.example.com</saml:Issuer></saml:Assertion><saml:Assertion `, 1),
+			relayState: relayState,
+		},
+	}
+	for name, tt := range tests {
+		sp := newTestServiceProvider(t, idp)
+		if _, err := sp.ParseResponse(encode(tt.response), tt.relayState); !errors.Is(err, ErrInvalidResponse) {
+			t.Errorf("%s: expected response to be rejected; got %v", name, err)
+		}
+	}
+}
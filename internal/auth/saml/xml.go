@@ -0,0 +1,314 @@
+package saml
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// xmlNamespace is the namespace bound to the reserved "xml" prefix.
+const xmlNamespace = "http://www.w3.org/XML/1998/namespace"
+
+// element is a node of a parsed XML document. Names keep their original
+// prefixes, which are needed for canonicalization, and are resolved to
+// namespaces on demand.
+type element struct {
+	prefix   string
+	local    string
+	attrs    []xml.Attr // Name.Space holds the prefix, not the namespace
+	children []any      // *element or xml.CharData
+	parent   *element
+}
+
+// parseXML parses a document into a tree. DTDs are rejected, so entity
+// expansion attacks are not possible, and every prefix must be declared.
+func parseXML(data []byte) (*element, error) {
+	d := xml.NewDecoder(bytes.NewReader(data))
+	d.Strict = true
+
+	var root, cur *element
+	for {
+		tok, err := d.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			e := &element{prefix: t.Name.Space, local: t.Name.Local, parent: cur}
+			e.attrs = append(e.attrs, t.Attr...)
+			if cur == nil {
+				if root != nil {
+					return nil, errors.New("multiple root elements")
+				}
+				root = e
+			} else {
+				cur.children = append(cur.children, e)
+			}
+			cur = e
+		case xml.EndElement:
+			// RawToken does not check that start and end tags match
+			if cur == nil || t.Name.Space != cur.prefix || t.Name.Local != cur.local {
+				return nil, fmt.Errorf("unexpected end element %s", t.Name.Local)
+			}
+			cur = cur.parent
+		case xml.CharData:
+			if cur != nil {
+				cur.children = append(cur.children, t.Copy())
+			} else if len(bytes.TrimSpace(t)) > 0 {
+				return nil, errors.New("text outside of the root element")
+			}
+		case xml.Directive:
+			return nil, errors.New("DTDs are not allowed")
+		}
+	}
+	if root == nil || cur != nil {
+		return nil, io.ErrUnexpectedEOF
+	}
+	if err := root.checkPrefixes(); err != nil {
+		return nil, err
+	}
+	return root, nil
+}
+
+// checkPrefixes makes sure every prefix used in the subtree is declared.
+func (e *element) checkPrefixes() error {
+	if _, ok := e.lookupNamespace(e.prefix); !ok {
+		return fmt.Errorf("undeclared prefix %q", e.prefix)
+	}
+	for _, a := range e.attrs {
+		if !isNamespaceDecl(a) && a.Name.Space != "" {
+			if _, ok := e.lookupNamespace(a.Name.Space); !ok {
+				return fmt.Errorf("undeclared prefix %q", a.Name.Space)
+			}
+		}
+	}
+	for _, c := range e.children {
+		if child, ok := c.(*element); ok {
+			if err := child.checkPrefixes(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// isNamespaceDecl reports whether an attribute declares a namespace.
+func isNamespaceDecl(a xml.Attr) bool {
+	return a.Name.Space == "xmlns" || (a.Name.Space == "" && a.Name.Local == "xmlns")
+}
+
+// lookupNamespace resolves a prefix, "" being the default namespace, in the
+// scope of the element.
+func (e *element) lookupNamespace(prefix string) (string, bool) {
+	if prefix == "xml" {
+		return xmlNamespace, true
+	}
+	for el := e; el != nil; el = el.parent {
+		for _, a := range el.attrs {
+			if prefix == "" && a.Name.Space == "" && a.Name.Local == "xmlns" {
+				return a.Value, true
+			}
+			if prefix != "" && a.Name.Space == "xmlns" && a.Name.Local == prefix {
+				return a.Value, true
+			}
+		}
+	}
+	// Without a declaration, unprefixed names have no namespace
+	return "", prefix == ""
+}
+
+// is reports whether the element has the given namespace and local name.
+func (e *element) is(namespace, local string) bool {
+	uri, _ := e.lookupNamespace(e.prefix)
+	return e.local == local && uri == namespace
+}
+
+// childElements returns the child elements with the given namespace and local name.
+func (e *element) childElements(namespace, local string) []*element {
+	var found []*element
+	for _, c := range e.children {
+		if child, ok := c.(*element); ok && child.is(namespace, local) {
+			found = append(found, child)
+		}
+	}
+	return found
+}
+
+// child returns the first child element with the given namespace and local
+// name, or nil.
+func (e *element) child(namespace, local string) *element {
+	if e == nil {
+		return nil
+	}
+	if found := e.childElements(namespace, local); len(found) > 0 {
+		return found[0]
+	}
+	return nil
+}
+
+// attr returns the value of an unqualified attribute.
+func (e *element) attr(local string) string {
+	if e == nil {
+		return ""
+	}
+	for _, a := range e.attrs {
+		if a.Name.Space == "" && a.Name.Local == local {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// text returns the trimmed text content of the element.
+func (e *element) text() string {
+	if e == nil {
+		return ""
+	}
+	var b strings.Builder
+	for _, c := range e.children {
+		if data, ok := c.(xml.CharData); ok {
+			b.Write(data)
+		}
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// walk calls fn for the element and all its descendants.
+func (e *element) walk(fn func(*element)) {
+	fn(e)
+	for _, c := range e.children {
+		if child, ok := c.(*element); ok {
+			child.walk(fn)
+		}
+	}
+}
+
+// canonicalize serializes the subtree of e with Exclusive XML Canonicalization
+// without comments. The exclude element, e.g. an enveloped signature, is
+// left out. Prefixes in inclusive are treated as in inclusive canonicalization.
+func canonicalize(e *element, exclude *element, inclusive []string) []byte {
+	var b bytes.Buffer
+	writeCanonical(&b, e, exclude, map[string]string{}, inclusive)
+	return b.Bytes()
+}
+
+func writeCanonical(b *bytes.Buffer, e *element, exclude *element, rendered map[string]string, inclusive []string) {
+	// Namespaces visibly utilized by the element and its attributes
+	needed := map[string]bool{e.prefix: true}
+	var attrs []xml.Attr
+	for _, a := range e.attrs {
+		if isNamespaceDecl(a) {
+			continue
+		}
+		attrs = append(attrs, a)
+		if a.Name.Space != "" && a.Name.Space != "xml" {
+			needed[a.Name.Space] = true
+		}
+	}
+	for _, prefix := range inclusive {
+		if prefix == "#default" {
+			prefix = ""
+		}
+		if _, ok := e.lookupNamespace(prefix); ok {
+			needed[prefix] = true
+		}
+	}
+
+	prefixes := make([]string, 0, len(needed))
+	for prefix := range needed {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Strings(prefixes)
+
+	scope := rendered
+	var decls []string
+	for _, prefix := range prefixes {
+		uri, ok := e.lookupNamespace(prefix)
+		if !ok || prefix == "xml" {
+			continue
+		}
+		prev, seen := rendered[prefix]
+		if prefix == "" && uri == "" {
+			// xmlns="" is only output to undeclare a default namespace
+			if !seen || prev == "" {
+				continue
+			}
+		} else if seen && prev == uri {
+			continue
+		}
+		if len(decls) == 0 {
+			scope = make(map[string]string, len(rendered)+1)
+			for k, v := range rendered {
+				scope[k] = v
+			}
+		}
+		scope[prefix] = uri
+		if prefix == "" {
+			decls = append(decls, ` xmlns="`+escapeAttr(uri)+`"`)
+		} else {
+			decls = append(decls, ` xmlns:`+prefix+`="`+escapeAttr(uri)+`"`)
+		}
+	}
+
+	// Attributes are sorted by namespace, then local name
+	attrNamespace := func(a xml.Attr) string {
+		if a.Name.Space == "" {
+			return ""
+		}
+		uri, _ := e.lookupNamespace(a.Name.Space)
+		return uri
+	}
+	sort.SliceStable(attrs, func(i, j int) bool {
+		ni, nj := attrNamespace(attrs[i]), attrNamespace(attrs[j])
+		if ni != nj {
+			return ni < nj
+		}
+		return attrs[i].Name.Local < attrs[j].Name.Local
+	})
+
+	name := qualifiedName(e.prefix, e.local)
+	b.WriteString("<" + name)
+	for _, decl := range decls {
+		b.WriteString(decl)
+	}
+	for _, a := range attrs {
+		b.WriteString(" " + qualifiedName(a.Name.Space, a.Name.Local) + `="` + escapeAttr(a.Value) + `"`)
+	}
+	b.WriteString(">")
+
+	for _, c := range e.children {
+		switch child := c.(type) {
+		case *element:
+			if child != exclude {
+				writeCanonical(b, child, exclude, scope, inclusive)
+			}
+		case xml.CharData:
+			b.WriteString(escapeText(string(child)))
+		}
+	}
+	b.WriteString("</" + name + ">")
+}
+
+func qualifiedName(prefix, local string) string {
+	if prefix == "" {
+		return local
+	}
+	return prefix + ":" + local
+}
+
+var (
+	textEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", "\r", "&#xD;")
+	attrEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", `"`, "&quot;", "\t", "&#x9;", "\n", "&#xA;", "\r", "&#xD;")
+)
+
+func escapeText(s string) string { return textEscaper.Replace(s) }
+
+func escapeAttr(s string) string { return attrEscaper.Replace(s) }
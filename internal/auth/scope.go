@@ -0,0 +1,50 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+)
+
+// ErrInvalidScope is returned for scopes not of the form "resource:action".
+var ErrInvalidScope = errors.New("invalid scope")
+
+// scopePattern matches scopes like "users:read" or "sessions:write".
+var scopePattern = regexp.MustCompile(`^[a-z][a-z0-9_-]*:[a-z][a-z0-9_-]*$`)
+
+// ValidateScopes checks that every scope is of the form "resource:action".
+func ValidateScopes(scopes []string) error {
+	for _, scope := range scopes {
+		if !scopePattern.MatchString(scope) {
+			return fmt.Errorf("%w: %q", ErrInvalidScope, scope)
+		}
+	}
+	return nil
+}
+
+// HasScope reports whether the principal was granted the scope. Principals
+// without scopes, like sessions and unscoped tokens, are unrestricted.
+func (p *Principal) HasScope(scope string) bool {
+	return len(p.Scopes) == 0 || slices.Contains(p.Scopes, scope)
+}
+
+// RequireScope is a middleware that checks that the principal stored by the
+// auth middlewares was granted the scope. It must be wrapped by one of them.
+func RequireScope(scope string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, ok := PrincipalFromContext(r.Context())
+		if !ok {
+			http.Error(w, "Unauthenticated", http.StatusUnauthorized)
+			return
+		}
+		if !principal.HasScope(scope) {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer error="insufficient_scope", scope=%q`, scope))
+			http.Error(w, "Insufficient scope", http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,102 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/raziel-aleman/go-starter/internal/session"
+)
+
+// Session values describing the device of a session, recorded on login.
+const (
+	clientIPKey  = "client_ip"
+	userAgentKey = "user_agent"
+)
+
+var (
+	// ErrSessionNotFound is returned when a user has no session with the given ID.
+	ErrSessionNotFound = errors.New("session not found")
+	// ErrCurrentSession is returned when revoking the session of the request,
+	// which is done by logging out instead.
+	ErrCurrentSession = errors.New("cannot revoke the current session, log out instead")
+)
+
+// SessionInfo describes an active session of a user. The ID is derived from
+// the session ID, which is never exposed since it is the cookie value.
+type SessionInfo struct {
+	ID         string    `json:"id"`
+	Current    bool      `json:"current"`
+	IP         string    `json:"ip,omitempty"`
+	UserAgent  string    `json:"user_agent,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastActive time.Time `json:"last_active"`
+}
+
+// ListSessions returns the active sessions of the logged-in user, the most
+// recently active first.
+func ListSessions(r *http.Request, manager *session.SessionManager) ([]SessionInfo, error) {
+	current := session.GetSession(r)
+	username, _ := current.Get("username").(string)
+
+	sessions, err := manager.UserSessions(r.Context(), username)
+	if err != nil {
+		return nil, fmt.Errorf("error listing sessions of %s: %w", username, err)
+	}
+
+	infos := make([]SessionInfo, 0, len(sessions))
+	for _, s := range sessions {
+		// Expired sessions may linger until the next garbage collection
+		if time.Now().After(manager.ExpiresAt(s)) {
+			continue
+		}
+		ip, _ := s.Get(clientIPKey).(string)
+		userAgent, _ := s.Get(userAgentKey).(string)
+		infos = append(infos, SessionInfo{
+			ID:         sessionHandle(s.ID),
+			Current:    s.ID == current.ID,
+			IP:         ip,
+			UserAgent:  userAgent,
+			CreatedAt:  s.CreatedAt,
+			LastActive: s.LastActive,
+		})
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].LastActive.After(infos[j].LastActive)
+	})
+	return infos, nil
+}
+
+// RevokeSession destroys the session of the logged-in user with the given
+// SessionInfo ID.
+func RevokeSession(r *http.Request, manager *session.SessionManager, id string) error {
+	current := session.GetSession(r)
+	username, _ := current.Get("username").(string)
+	if id == sessionHandle(current.ID) {
+		return ErrCurrentSession
+	}
+
+	sessions, err := manager.UserSessions(r.Context(), username)
+	if err != nil {
+		return fmt.Errorf("error listing sessions of %s: %w", username, err)
+	}
+	for _, s := range sessions {
+		if sessionHandle(s.ID) == id {
+			if err := manager.Store.Destroy(r.Context(), s.ID); err != nil {
+				return fmt.Errorf("error destroying session of %s: %v", username, err)
+			}
+			return nil
+		}
+	}
+	return ErrSessionNotFound
+}
+
+// sessionHandle derives the public ID of a session from its secret ID.
+func sessionHandle(id string) string {
+	sum := sha256.Sum256([]byte(id))
+	return base64.RawURLEncoding.EncodeToString(sum[:12])
+}
@@ -0,0 +1,139 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/raziel-aleman/go-starter/internal/database"
+	"github.com/raziel-aleman/go-starter/internal/ratelimit"
+)
+
+// ErrTooManyAttempts is returned when a client or account exceeded its login attempts.
+type ErrTooManyAttempts struct {
+	RetryAfter time.Duration
+}
+
+func (e *ErrTooManyAttempts) Error() string {
+	return fmt.Sprintf("too many login attempts, retry in %s", e.RetryAfter.Round(time.Second))
+}
+
+// LoginLimiter limits login attempts per client IP, against credential
+// stuffing, and per username, against targeted guessing.
+type LoginLimiter struct {
+	PerIP   *ratelimit.Limiter
+	PerUser *ratelimit.Limiter
+	// Attempts per username allowed before a CAPTCHA is required, nil if never required
+	ChallengeAfter *ratelimit.Limiter
+	// Second factor codes per username allowed while logging in, counted in
+	// the store so that concurrent requests share the count
+	SecondFactor *ratelimit.Limiter
+}
+
+// NewLoginLimiter creates a limiter allowing ipLimit attempts per client IP and
+// userLimit attempts per username in every window, and maxSecondFactorAttempts
+// second factor codes per username while logging in.
+func NewLoginLimiter(store ratelimit.Store, ipLimit, userLimit int, window time.Duration) *LoginLimiter {
+	return &LoginLimiter{
+		PerIP:        ratelimit.NewLimiter(store, "login:ip:", ipLimit, window),
+		PerUser:      ratelimit.NewLimiter(store, "login:user:", userLimit, window),
+		SecondFactor: ratelimit.NewLimiter(store, "login:2fa:", maxSecondFactorAttempts, pendingLoginTTL),
+	}
+}
+
+// LoginKey returns the key counting the attempts of a login, which may be the
+// username or the email address of a user. Both resolve to the username, so
+// alternating them does not give an account more attempts. Unknown logins are
+// counted by themselves.
+func LoginKey(ctx context.Context, users database.UserRepository, login string) (string, error) {
+	username, err := users.CanonicalUsername(ctx, login)
+	if errors.Is(err, sql.ErrNoRows) {
+		var profile database.UserProfile
+		profile, err = users.FindUserByEmail(ctx, login)
+		username = profile.Username
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		return strings.ToLower(login), nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("error resolving login: %v", err)
+	}
+	return strings.ToLower(username), nil
+}
+
+// Check records a login attempt and returns *ErrTooManyAttempts if the client
+// IP or the account exceeded its limit. key is the account as returned by
+// LoginKey. It must run before the credentials are verified.
+func (l *LoginLimiter) Check(ctx context.Context, r *http.Request, key string) error {
+	checks := []struct {
+		limiter *ratelimit.Limiter
+		key     string
+	}{
+		{l.PerIP, ClientIP(r)},
+		{l.PerUser, key},
+	}
+	for _, c := range checks {
+		allowed, retryAfter, err := c.limiter.Allow(ctx, c.key)
+		if err != nil {
+			return fmt.Errorf("error checking login rate limit: %v", err)
+		}
+		if !allowed {
+			return &ErrTooManyAttempts{RetryAfter: retryAfter}
+		}
+	}
+	return nil
+}
+
+// NeedsChallenge records a login attempt and reports whether the account
+// failed to log in often enough that a CAPTCHA is required.
+func (l *LoginLimiter) NeedsChallenge(ctx context.Context, key string) (bool, error) {
+	if l.ChallengeAfter == nil {
+		return false, nil
+	}
+	allowed, _, err := l.ChallengeAfter.Allow(ctx, key)
+	if err != nil {
+		return false, fmt.Errorf("error checking login attempts: %v", err)
+	}
+	return !allowed, nil
+}
+
+// Succeeded clears the attempts of an account after a successful login, so
+// failed attempts by its owner do not add up over time.
+func (l *LoginLimiter) Succeeded(ctx context.Context, key string) error {
+	if l.ChallengeAfter != nil {
+		if err := l.ChallengeAfter.Reset(ctx, key); err != nil {
+			return err
+		}
+	}
+	return l.PerUser.Reset(ctx, key)
+}
+
+// WriteTooManyAttempts responds 429 Too Many Requests with a Retry-After
+// header if err is *ErrTooManyAttempts, and reports whether it did.
+func WriteTooManyAttempts(w http.ResponseWriter, err error) bool {
+	var tooMany *ErrTooManyAttempts
+	if !errors.As(err, &tooMany) {
+		return false
+	}
+	seconds := int(tooMany.RetryAfter.Seconds() + 0.5)
+	if seconds < 1 {
+		seconds = 1
+	}
+	w.Header().Set("Retry-After", fmt.Sprint(seconds))
+	http.Error(w, "Too many login attempts", http.StatusTooManyRequests)
+	return true
+}
+
+// ClientIP returns the IP address of the client connection.
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
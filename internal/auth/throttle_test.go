@@ -0,0 +1,56 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/raziel-aleman/go-starter/internal/database/fake"
+	"github.com/raziel-aleman/go-starter/internal/ratelimit"
+)
+
+func TestLoginLimiterUsernameAndEmail(t *testing.T) {
+	ctx := context.Background()
+	db := fake.New()
+	db.RegisterUser(ctx, "Alice", "alice@example.com", []byte("hash"))
+	limiter := NewLoginLimiter(ratelimit.NewMemoryStore(), 100, 4, time.Minute)
+	r := httptest.NewRequest(http.MethodPost, "/login", nil)
+
+	// Alternating the username and the email counts against the same account
+	logins := []string{"alice", "ALICE@example.com", "Alice", "alice@example.com"}
+	for i, login := range logins {
+		key, err := LoginKey(ctx, db, login)
+		if err != nil {
+			t.Fatalf("error resolving login %q. Err: %v", login, err)
+		}
+		if key != "alice" {
+			t.Errorf("expected login %q keyed as alice; got %q", login, key)
+		}
+		if err := limiter.Check(ctx, r, key); err != nil {
+			t.Fatalf("expected attempt %d to be allowed; got %v", i+1, err)
+		}
+	}
+	key, err := LoginKey(ctx, db, "alice@example.com")
+	if err != nil {
+		t.Fatalf("error resolving login. Err: %v", err)
+	}
+	var tooMany *ErrTooManyAttempts
+	if err := limiter.Check(ctx, r, key); !errors.As(err, &tooMany) {
+		t.Errorf("expected *ErrTooManyAttempts; got %v", err)
+	}
+
+	// Unknown logins are counted by themselves
+	key, err = LoginKey(ctx, db, "Nobody")
+	if err != nil {
+		t.Fatalf("error resolving login. Err: %v", err)
+	}
+	if key != "nobody" {
+		t.Errorf("expected unknown login keyed as nobody; got %q", key)
+	}
+	if err := limiter.Check(ctx, r, key); err != nil {
+		t.Errorf("expected unknown login to be allowed; got %v", err)
+	}
+}
@@ -0,0 +1,96 @@
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// Period is the time step of the codes, as expected by authenticator apps.
+	Period = 30 * time.Second
+	// Digits is the length of the codes.
+	Digits = 6
+	// skew is the number of adjacent time steps accepted to tolerate clock drift.
+	skew = 1
+)
+
+// encoding is the base32 alphabet used by authenticator apps, without padding.
+var encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateSecret generates a random 160-bit secret encoded in base32.
+func GenerateSecret() (string, error) {
+	b := make([]byte, 20)
+	if _, err := io.ReadFull(rand.Reader, b); err != nil {
+		return "", fmt.Errorf("error generating TOTP secret: %w", err)
+	}
+	return encoding.EncodeToString(b), nil
+}
+
+// URL returns the otpauth:// provisioning URL of a secret, which authenticator
+// apps import directly or through a QR code rendered by the client.
+func URL(issuer, account, secret string) string {
+	v := url.Values{}
+	v.Set("secret", secret)
+	v.Set("issuer", issuer)
+	v.Set("algorithm", "SHA1")
+	v.Set("digits", fmt.Sprint(Digits))
+	v.Set("period", fmt.Sprint(int(Period.Seconds())))
+	label := url.PathEscape(issuer + ":" + account)
+	return "otpauth://totp/" + label + "?" + v.Encode()
+}
+
+// Code computes the code of a secret at the given time (RFC 6238).
+func Code(secret string, t time.Time) (string, error) {
+	key, err := encoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return "", fmt.Errorf("error decoding TOTP secret: %w", err)
+	}
+	return code(key, uint64(t.Unix())/uint64(Period.Seconds())), nil
+}
+
+// Validate checks a code against a secret, accepting adjacent time steps.
+func Validate(secret, passcode string, t time.Time) bool {
+	_, valid := ValidateStep(secret, passcode, t)
+	return valid
+}
+
+// ValidateStep checks a code against a secret like Validate, and returns the
+// time step it matched. Callers reject the codes of steps at or before the
+// last one they accepted, so a code cannot be replayed.
+func ValidateStep(secret, passcode string, t time.Time) (int64, bool) {
+	key, err := encoding.DecodeString(strings.ToUpper(secret))
+	if err != nil || len(passcode) != Digits {
+		return 0, false
+	}
+	counter := uint64(t.Unix()) / uint64(Period.Seconds())
+	var step int64
+	valid := false
+	for i := -skew; i <= skew; i++ {
+		if subtle.ConstantTimeCompare([]byte(code(key, counter+uint64(i))), []byte(passcode)) == 1 {
+			step, valid = int64(counter+uint64(i)), true
+		}
+	}
+	return step, valid
+}
+
+// code computes the HOTP value of a counter (RFC 4226).
+func code(key []byte, counter uint64) string {
+	msg := make([]byte, 8)
+	binary.BigEndian.PutUint64(msg, counter)
+	h := hmac.New(sha1.New, key)
+	h.Write(msg)
+	sum := h.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", Digits, value%1000000)
+}
@@ -0,0 +1,59 @@
+package totp
+
+import (
+	"encoding/base32"
+	"testing"
+	"time"
+)
+
+func TestCodeMatchesRFC6238Vectors(t *testing.T) {
+	// RFC 6238 appendix B, SHA-1 secret "12345678901234567890", truncated to 6 digits
+	secret := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+	vectors := map[int64]string{
+		59:         "287082",
+		1111111109: "081804",
+		1234567890: "005924",
+		2000000000: "279037",
+	}
+	for unix, expected := range vectors {
+		got, err := Code(secret, time.Unix(unix, 0))
+		if err != nil {
+			t.Fatalf("error computing code. Err: %v", err)
+		}
+		if got != expected {
+			t.Errorf("at %d expected %s; got %s", unix, expected, got)
+		}
+	}
+}
+
+func TestValidateAcceptsAdjacentSteps(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatalf("error generating secret. Err: %v", err)
+	}
+	now := time.Now()
+	previous, _ := Code(secret, now.Add(-Period))
+	if !Validate(secret, previous, now) {
+		t.Errorf("expected previous code to be accepted")
+	}
+	old, _ := Code(secret, now.Add(-3*Period))
+	if Validate(secret, old, now) {
+		t.Errorf("expected old code to be rejected")
+	}
+}
+
+func TestValidateStep(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatalf("error generating secret. Err: %v", err)
+	}
+	now := time.Unix(1700000000, 0)
+	current := now.Unix() / int64(Period.Seconds())
+	previous, _ := Code(secret, now.Add(-Period))
+	if step, ok := ValidateStep(secret, previous, now); !ok || step != current-1 {
+		t.Errorf("expected step %d; got %d, %v", current-1, step, ok)
+	}
+	if _, ok := ValidateStep(secret, "000000x", now); ok {
+		t.Errorf("expected malformed code to be rejected")
+	}
+}
@@ -0,0 +1,247 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/raziel-aleman/go-starter/internal/auth/totp"
+	"github.com/raziel-aleman/go-starter/internal/database"
+	"github.com/raziel-aleman/go-starter/internal/session"
+)
+
+const (
+	// recoveryCodeCount is the number of recovery codes issued when enabling 2FA.
+	recoveryCodeCount = 10
+	// pendingLoginTTL is how long a user has to enter the second factor after the password.
+	pendingLoginTTL = 5 * time.Minute
+	// twoFactorNamespace is the session namespace holding the pending 2FA login.
+	twoFactorNamespace = "2fa"
+	// maxSecondFactorAttempts is the number of codes a user can submit per
+	// pendingLoginTTL. Further attempts drop the pending login, and the
+	// password must be entered again.
+	maxSecondFactorAttempts = 5
+)
+
+var (
+	// ErrInvalidTwoFactorCode is returned for wrong TOTP or recovery codes.
+	ErrInvalidTwoFactorCode = errors.New("invalid two-factor code")
+	// ErrNoPendingLogin is returned when no password login awaits a second factor.
+	ErrNoPendingLogin = errors.New("no pending two-factor login")
+)
+
+// BeginTOTPEnrollment generates and stores a new pending TOTP secret for the
+// user and returns it with its otpauth:// provisioning URL. The secret is only
+// used once a code is confirmed with EnableTOTP. Users who already have
+// two-factor authentication enabled must prove it with a current TOTP or
+// recovery code, or get ErrInvalidTwoFactorCode; their secret stays in use
+// until the new one is confirmed.
+func BeginTOTPEnrollment(
+	ctx context.Context,
+	dbService database.Service,
+	username string,
+	issuer string,
+	currentCode string,
+) (string, string, error) {
+	enabled, err := TwoFactorRequired(ctx, dbService, username)
+	if err != nil {
+		return "", "", fmt.Errorf("error checking two-factor status: %v", err)
+	}
+	if enabled {
+		if err := VerifySecondFactor(ctx, dbService, username, currentCode); err != nil {
+			return "", "", err
+		}
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return "", "", err
+	}
+
+	if err := dbService.SetTOTPSecret(ctx, username, secret); err != nil {
+		return "", "", fmt.Errorf("error storing TOTP secret: %v", err)
+	}
+
+	return secret, totp.URL(issuer, username, secret), nil
+}
+
+// EnableTOTP confirms the enrollment with a code of the pending secret from
+// the authenticator app and returns single-use recovery codes, which are only
+// stored hashed.
+func EnableTOTP(
+	ctx context.Context,
+	dbService database.Service,
+	username string,
+	code string,
+) ([]string, error) {
+	secret, err := dbService.PendingTOTPSecret(ctx, username)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving TOTP secret: %v", err)
+	}
+	if secret == "" {
+		return nil, ErrInvalidTwoFactorCode
+	}
+	step, ok := totp.ValidateStep(secret, code, time.Now())
+	if !ok {
+		return nil, ErrInvalidTwoFactorCode
+	}
+
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		codes[i], err = newRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		hashes[i] = hashToken(codes[i])
+	}
+
+	if err := dbService.EnableTOTP(ctx, username, hashes); err != nil {
+		return nil, fmt.Errorf("error enabling TOTP: %v", err)
+	}
+	// The confirmation code cannot be replayed to log in
+	if _, err := dbService.UseTOTPStep(ctx, username, step); err != nil {
+		return nil, fmt.Errorf("error recording TOTP code: %v", err)
+	}
+
+	return codes, nil
+}
+
+// TwoFactorRequired reports whether the user has two-factor authentication enabled.
+func TwoFactorRequired(ctx context.Context, dbService database.Service, username string) (bool, error) {
+	_, enabled, err := dbService.TOTPSecret(ctx, username)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	return enabled, err
+}
+
+// VerifySecondFactor checks a TOTP code or, failing that, consumes a recovery
+// code. A TOTP code is only accepted once, as are the codes of earlier time
+// steps.
+func VerifySecondFactor(
+	ctx context.Context,
+	dbService database.Service,
+	username string,
+	code string,
+) error {
+	secret, enabled, err := dbService.TOTPSecret(ctx, username)
+	if err != nil {
+		return fmt.Errorf("error retrieving TOTP secret: %v", err)
+	}
+	if step, ok := totp.ValidateStep(secret, code, time.Now()); enabled && ok {
+		fresh, err := dbService.UseTOTPStep(ctx, username, step)
+		if err != nil {
+			return fmt.Errorf("error recording TOTP code: %v", err)
+		}
+		if !fresh {
+			return ErrInvalidTwoFactorCode
+		}
+		return nil
+	}
+
+	used, err := dbService.UseRecoveryCode(ctx, username, hashToken(normalizeRecoveryCode(code)))
+	if err != nil {
+		return fmt.Errorf("error checking recovery code: %v", err)
+	}
+	if !used {
+		return ErrInvalidTwoFactorCode
+	}
+	return nil
+}
+
+// BeginPendingLogin records in the session that the user passed the first
+// factor, e.g. "password", and must now provide a second factor. The session
+// stays unauthenticated.
+func BeginPendingLogin(r *http.Request, user User, method string) {
+	s := session.GetSession(r)
+	// The pending login must survive until the code is submitted
+	s.Persist()
+	ns := s.Namespace(twoFactorNamespace)
+	ns.Put("user", user.Username)
+	ns.Put("method", method)
+	ns.Put("started_at", time.Now().Unix())
+}
+
+// PendingLoginUser returns the username of the pending login, if any.
+func PendingLoginUser(r *http.Request) string {
+	username, _ := session.GetSession(r).Namespace(twoFactorNamespace).Get("user").(string)
+	return username
+}
+
+// PendingLoginMethod returns the first factor of the pending login, if any.
+func PendingLoginMethod(r *http.Request) string {
+	method, _ := session.GetSession(r).Namespace(twoFactorNamespace).Get("method").(string)
+	return method
+}
+
+// CompletePendingLogin verifies the second factor of the pending login and,
+// on success, logs the user in by migrating the session. Attempts are counted
+// per user by the SecondFactor limiter of limiter, not in the session, so
+// parallel requests cannot each get their own attempts. Past the limit, the
+// pending login is dropped and *ErrTooManyAttempts returned.
+func CompletePendingLogin(
+	r *http.Request,
+	srw *session.SessionResponseWriter,
+	dbService database.Service,
+	limiter *LoginLimiter,
+	code string,
+) (User, error) {
+	ns := session.GetSession(r).Namespace(twoFactorNamespace)
+	username, _ := ns.Get("user").(string)
+	startedAt, _ := ns.Get("started_at").(int64)
+	if username == "" || time.Since(time.Unix(startedAt, 0)) > pendingLoginTTL {
+		ns.Clear()
+		return User{}, ErrNoPendingLogin
+	}
+
+	// Every attempt is recorded before the code is checked
+	allowed, retryAfter, err := limiter.SecondFactor.Allow(r.Context(), strings.ToLower(username))
+	if err != nil {
+		return User{}, fmt.Errorf("error checking two-factor attempts: %v", err)
+	}
+	if !allowed {
+		ns.Clear()
+		return User{}, &ErrTooManyAttempts{RetryAfter: retryAfter}
+	}
+
+	if err := VerifySecondFactor(r.Context(), dbService, username, code); err != nil {
+		return User{}, err
+	}
+	if err := limiter.SecondFactor.Reset(r.Context(), strings.ToLower(username)); err != nil {
+		return User{}, fmt.Errorf("error resetting two-factor attempts: %v", err)
+	}
+
+	ns.Clear()
+	user := User{Username: username}
+	if err := Login(r, srw, dbService, user); err != nil {
+		return User{}, err
+	}
+	return user, nil
+}
+
+// newRecoveryCode generates a recovery code formatted as "xxxxx-xxxxx".
+func newRecoveryCode() (string, error) {
+	b := make([]byte, 10)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("error generating recovery code: %v", err)
+	}
+	code := strings.ToLower(base32.StdEncoding.EncodeToString(b))[:10]
+	return code[:5] + "-" + code[5:], nil
+}
+
+// normalizeRecoveryCode lowercases a recovery code and restores its dash,
+// so codes typed without it or in uppercase still match.
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+	if len(code) != 10 {
+		return code
+	}
+	return code[:5] + "-" + code[5:]
+}
@@ -0,0 +1,130 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/raziel-aleman/go-starter/internal/auth/totp"
+	"github.com/raziel-aleman/go-starter/internal/database/fake"
+	"github.com/raziel-aleman/go-starter/internal/ratelimit"
+	"github.com/raziel-aleman/go-starter/internal/session"
+	"github.com/raziel-aleman/go-starter/internal/store"
+)
+
+// enrollTOTP enables two-factor authentication for a user and returns its secret.
+func enrollTOTP(t *testing.T, db *fake.Service, username string, currentCode string) string {
+	t.Helper()
+	ctx := context.Background()
+	secret, _, err := BeginTOTPEnrollment(ctx, db, username, "test", currentCode)
+	if err != nil {
+		t.Fatalf("error beginning enrollment. Err: %v", err)
+	}
+	code, _ := totp.Code(secret, time.Now())
+	if _, err := EnableTOTP(ctx, db, username, code); err != nil {
+		t.Fatalf("error enabling TOTP. Err: %v", err)
+	}
+	return secret
+}
+
+func TestTOTPReenrollment(t *testing.T) {
+	ctx := context.Background()
+	db := fake.New()
+	db.RegisterUser(ctx, "alice", "", []byte("hash"))
+	secret := enrollTOTP(t, db, "alice", "")
+
+	// Re-enrolling without a current code leaves 2FA enabled with the same secret
+	if _, _, err := BeginTOTPEnrollment(ctx, db, "alice", "test", ""); !errors.Is(err, ErrInvalidTwoFactorCode) {
+		t.Fatalf("expected ErrInvalidTwoFactorCode; got %v", err)
+	}
+	if current, enabled, _ := db.TOTPSecret(ctx, "alice"); current != secret || !enabled {
+		t.Errorf("expected 2FA to stay enabled with the same secret")
+	}
+
+	// With a code of the next step, as the enrollment code was already used
+	next, _ := totp.Code(secret, time.Now().Add(totp.Period))
+	if _, _, err := BeginTOTPEnrollment(ctx, db, "alice", "test", next); err != nil {
+		t.Fatalf("error re-enrolling. Err: %v", err)
+	}
+	if current, enabled, _ := db.TOTPSecret(ctx, "alice"); current != secret || !enabled {
+		t.Errorf("expected the old secret to stay in use until the new one is confirmed")
+	}
+}
+
+func TestTOTPReplay(t *testing.T) {
+	ctx := context.Background()
+	db := fake.New()
+	db.RegisterUser(ctx, "alice", "", []byte("hash"))
+	secret := enrollTOTP(t, db, "alice", "")
+
+	// The enrollment code cannot be used to log in
+	code, _ := totp.Code(secret, time.Now())
+	if err := VerifySecondFactor(ctx, db, "alice", code); !errors.Is(err, ErrInvalidTwoFactorCode) {
+		t.Errorf("expected the enrollment code to be rejected; got %v", err)
+	}
+
+	next, _ := totp.Code(secret, time.Now().Add(totp.Period))
+	if err := VerifySecondFactor(ctx, db, "alice", next); err != nil {
+		t.Fatalf("expected a fresh code to be accepted; got %v", err)
+	}
+	if err := VerifySecondFactor(ctx, db, "alice", next); !errors.Is(err, ErrInvalidTwoFactorCode) {
+		t.Errorf("expected a replayed code to be rejected; got %v", err)
+	}
+}
+
+func TestPendingLoginAttempts(t *testing.T) {
+	ctx := context.Background()
+	db := fake.New()
+	db.RegisterUser(ctx, "alice", "", []byte("hash"))
+	enrollTOTP(t, db, "alice", "")
+	sm := session.NewSessionManager(store.NewInMemorySessionStore(), "GOSESSID", time.Minute, time.Hour)
+	defer sm.Close()
+	sm.CSRFMethods = nil
+	limiter := NewLoginLimiter(ratelimit.NewMemoryStore(), 20, 5, time.Minute)
+
+	// Each pending login has its own session, as have parallel requests, but
+	// they share the attempts of the user
+	var pending []string
+	handler := sm.SessionMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		srw := w.(*session.SessionResponseWriter)
+		if PendingLoginUser(r) == "" {
+			BeginPendingLogin(r, User{Username: "alice"}, "password")
+			pending = append(pending, srw.Session.ID)
+			return
+		}
+		_, err := CompletePendingLogin(r, srw, db, limiter, "000000")
+		attempt := r.URL.Query().Get("attempt")
+		var tooMany *ErrTooManyAttempts
+		switch {
+		case attempt == "last" && !errors.As(err, &tooMany):
+			t.Errorf("expected *ErrTooManyAttempts; got %v", err)
+		case attempt != "last" && !errors.Is(err, ErrInvalidTwoFactorCode):
+			t.Errorf("attempt %s: expected ErrInvalidTwoFactorCode; got %v", attempt, err)
+		}
+		// The password must be entered again
+		if attempt == "last" && PendingLoginUser(r) != "" {
+			t.Errorf("expected the pending login to be dropped")
+		}
+	}))
+	serve := func(id, attempt string) {
+		req := httptest.NewRequest(http.MethodPost, "/2fa/verify?attempt="+attempt, nil)
+		if id != "" {
+			req.AddCookie(&http.Cookie{Name: "GOSESSID", Value: id})
+		}
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	serve("", "")
+	serve("", "")
+
+	for i := 0; i < maxSecondFactorAttempts; i++ {
+		serve(pending[i%2], fmt.Sprint(i+1))
+	}
+	serve(pending[1], "last")
+	if len(pending) != 2 {
+		t.Errorf("expected 2 pending logins; got %d", len(pending))
+	}
+}
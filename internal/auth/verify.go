@@ -0,0 +1,96 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/raziel-aleman/go-starter/internal/database"
+	"github.com/raziel-aleman/go-starter/internal/mail"
+	"github.com/raziel-aleman/go-starter/internal/session"
+)
+
+// verificationTTL is how long an email verification link stays valid.
+const verificationTTL = 24 * time.Hour
+
+// ErrInvalidVerificationToken is returned for unknown, used, or expired verification tokens.
+var ErrInvalidVerificationToken = errors.New("invalid or expired verification token")
+
+// RequestEmailVerification stores a new verification token for the user and
+// emails a link to the /verify endpoint under baseURL.
+func RequestEmailVerification(
+	ctx context.Context,
+	dbService database.Service,
+	mailer mail.Mailer,
+	user User,
+	baseURL string,
+) error {
+	if user.Email == "" {
+		return fmt.Errorf("user %s has no email to verify", user.Username)
+	}
+
+	token, hash, err := newToken()
+	if err != nil {
+		return err
+	}
+
+	if err := dbService.CreateVerificationToken(ctx, user.Username, hash, time.Now().Add(verificationTTL)); err != nil {
+		return fmt.Errorf("error storing verification token: %v", err)
+	}
+
+	link := baseURL + "/verify?token=" + url.QueryEscape(token)
+	err = mailer.Send(ctx, mail.Message{
+		To:      user.Email,
+		Subject: "Verify your email address",
+		Body:    "Open the following link to verify your email address:\n\n" + link + "\n",
+	})
+	if err != nil {
+		return fmt.Errorf("error sending verification email: %v", err)
+	}
+
+	return nil
+}
+
+// VerifyEmail consumes a verification token and marks the email of its user as verified.
+// It returns the username of the verified user.
+func VerifyEmail(
+	ctx context.Context,
+	dbService database.Service,
+	token string,
+) (string, error) {
+	username, err := dbService.ConsumeVerificationToken(ctx, hashToken(token))
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrInvalidVerificationToken
+	}
+	if err != nil {
+		return "", fmt.Errorf("error verifying email: %v", err)
+	}
+
+	return username, nil
+}
+
+// RequireVerified only lets users with a verified email through. It must be
+// composed after AuthMiddleware so the session user is authenticated.
+func RequireVerified(dbService database.Service, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		username, _ := session.GetSession(r).Get("username").(string)
+
+		verified, err := dbService.IsVerified(r.Context(), username)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			slog.ErrorContext(r.Context(), "Failed to check email verification", "username", username, "err", err)
+			http.Error(w, "Failed to check email verification", http.StatusInternalServerError)
+			return
+		}
+		if !verified {
+			http.Error(w, "Email not verified", http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,411 @@
+package webauthn
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"slices"
+	"time"
+
+	"github.com/raziel-aleman/go-starter/internal/session"
+)
+
+var (
+	// ErrNoCeremony is returned when no ceremony was started in the session.
+	ErrNoCeremony = errors.New("no pending webauthn ceremony")
+	// ErrVerification is returned when a ceremony response fails verification.
+	ErrVerification = errors.New("webauthn verification failed")
+)
+
+const (
+	// sessionNamespace is the session namespace holding the pending ceremony.
+	sessionNamespace = "webauthn"
+	// algES256 is the COSE identifier of ECDSA with P-256 and SHA-256,
+	// the only algorithm supported by this package.
+	algES256 = -7
+	// Authenticator data flags.
+	flagUserPresent  = 0x01
+	flagUserVerified = 0x04
+	flagAttested     = 0x40
+)
+
+// Credential is a public key credential registered by a user.
+type Credential struct {
+	ID        []byte
+	PublicKey []byte // COSE encoded public key
+	SignCount uint32
+}
+
+// Config configures the relying party.
+type Config struct {
+	RPID    string        // Domain of the relying party, e.g. "example.com"
+	RPName  string        // Human readable name shown by authenticators
+	Origins []string      // Allowed origins of the browser client, e.g. "https://example.com"
+	Timeout time.Duration // Time the user has to complete a ceremony
+}
+
+// RelyingParty runs the WebAuthn registration and assertion ceremonies.
+type RelyingParty struct {
+	config Config
+}
+
+// New creates a RelyingParty.
+func New(config Config) *RelyingParty {
+	if config.Timeout == 0 {
+		config.Timeout = 5 * time.Minute
+	}
+	return &RelyingParty{config: config}
+}
+
+// URLEncodedBytes is a byte slice encoded as unpadded base64url in JSON, the
+// encoding used by the WebAuthn JSON serialization.
+type URLEncodedBytes []byte
+
+// MarshalJSON encodes the bytes as base64url.
+func (b URLEncodedBytes) MarshalJSON() ([]byte, error) {
+	return json.Marshal(base64.RawURLEncoding.EncodeToString(b))
+}
+
+// UnmarshalJSON decodes base64url, tolerating padding.
+func (b *URLEncodedBytes) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	decoded, err := base64.RawURLEncoding.DecodeString(string(bytes.TrimRight([]byte(s), "=")))
+	if err != nil {
+		return err
+	}
+	*b = decoded
+	return nil
+}
+
+// CredentialDescriptor identifies a credential in ceremony options.
+type CredentialDescriptor struct {
+	Type string          `json:"type"`
+	ID   URLEncodedBytes `json:"id"`
+}
+
+// CreationOptions are passed to navigator.credentials.create().
+type CreationOptions struct {
+	Challenge URLEncodedBytes `json:"challenge"`
+	RP        struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"rp"`
+	User struct {
+		ID          URLEncodedBytes `json:"id"`
+		Name        string          `json:"name"`
+		DisplayName string          `json:"displayName"`
+	} `json:"user"`
+	PubKeyCredParams []struct {
+		Type string `json:"type"`
+		Alg  int    `json:"alg"`
+	} `json:"pubKeyCredParams"`
+	Timeout                int64                  `json:"timeout"`
+	Attestation            string                 `json:"attestation"`
+	ExcludeCredentials     []CredentialDescriptor `json:"excludeCredentials"`
+	AuthenticatorSelection struct {
+		ResidentKey      string `json:"residentKey"`
+		UserVerification string `json:"userVerification"`
+	} `json:"authenticatorSelection"`
+}
+
+// RequestOptions are passed to navigator.credentials.get().
+type RequestOptions struct {
+	Challenge        URLEncodedBytes        `json:"challenge"`
+	RPID             string                 `json:"rpId"`
+	Timeout          int64                  `json:"timeout"`
+	AllowCredentials []CredentialDescriptor `json:"allowCredentials"`
+	UserVerification string                 `json:"userVerification"`
+}
+
+// RegistrationResponse is the JSON serialization of the credential returned by
+// navigator.credentials.create().
+type RegistrationResponse struct {
+	ID       string          `json:"id"`
+	RawID    URLEncodedBytes `json:"rawId"`
+	Type     string          `json:"type"`
+	Response struct {
+		ClientDataJSON    URLEncodedBytes `json:"clientDataJSON"`
+		AttestationObject URLEncodedBytes `json:"attestationObject"`
+	} `json:"response"`
+}
+
+// AssertionResponse is the JSON serialization of the credential returned by
+// navigator.credentials.get().
+type AssertionResponse struct {
+	ID       string          `json:"id"`
+	RawID    URLEncodedBytes `json:"rawId"`
+	Type     string          `json:"type"`
+	Response struct {
+		ClientDataJSON    URLEncodedBytes `json:"clientDataJSON"`
+		AuthenticatorData URLEncodedBytes `json:"authenticatorData"`
+		Signature         URLEncodedBytes `json:"signature"`
+		UserHandle        URLEncodedBytes `json:"userHandle"`
+	} `json:"response"`
+}
+
+// UserHandle derives the opaque WebAuthn user handle of a username, so the
+// username itself is not stored on authenticators.
+func UserHandle(username string) []byte {
+	sum := sha256.Sum256([]byte("webauthn:" + username))
+	return sum[:16]
+}
+
+// BeginRegistration starts a registration ceremony for the user and returns
+// the options for the browser. Existing credentials are excluded so the same
+// authenticator is not registered twice.
+func (rp *RelyingParty) BeginRegistration(s *session.Session, username string, existing []Credential) (*CreationOptions, error) {
+	challenge, err := rp.begin(s, "registration", username)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := &CreationOptions{
+		Challenge:          challenge,
+		Timeout:            rp.config.Timeout.Milliseconds(),
+		Attestation:        "none",
+		ExcludeCredentials: descriptors(existing),
+	}
+	opts.RP.ID = rp.config.RPID
+	opts.RP.Name = rp.config.RPName
+	opts.User.ID = UserHandle(username)
+	opts.User.Name = username
+	opts.User.DisplayName = username
+	opts.PubKeyCredParams = append(opts.PubKeyCredParams, struct {
+		Type string `json:"type"`
+		Alg  int    `json:"alg"`
+	}{"public-key", algES256})
+	opts.AuthenticatorSelection.ResidentKey = "preferred"
+	opts.AuthenticatorSelection.UserVerification = "preferred"
+	return opts, nil
+}
+
+// FinishRegistration verifies the response of a registration ceremony and
+// returns the new credential with the username it was registered for.
+func (rp *RelyingParty) FinishRegistration(s *session.Session, resp *RegistrationResponse) (*Credential, string, error) {
+	challenge, username, err := rp.finish(s, "registration")
+	if err != nil {
+		return nil, "", err
+	}
+	if err := rp.verifyClientData(resp.Response.ClientDataJSON, "webauthn.create", challenge); err != nil {
+		return nil, "", err
+	}
+
+	object, _, err := decodeCBOR(resp.Response.AttestationObject)
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: %v", ErrVerification, err)
+	}
+	attestation, ok := object.(map[any]any)
+	if !ok {
+		return nil, "", fmt.Errorf("%w: malformed attestation object", ErrVerification)
+	}
+	authData, ok := attestation["authData"].([]byte)
+	if !ok {
+		return nil, "", fmt.Errorf("%w: missing authenticator data", ErrVerification)
+	}
+	// Attestation statements are not verified: the relying party requests "none"
+	// conveyance and trusts the authenticator the user chose.
+
+	flags, signCount, rest, err := rp.parseAuthData(authData)
+	if err != nil {
+		return nil, "", err
+	}
+	if flags&flagAttested == 0 || len(rest) < 18 {
+		return nil, "", fmt.Errorf("%w: missing attested credential data", ErrVerification)
+	}
+	// Attested credential data: AAGUID (16), credential id length (2), credential id, COSE key
+	idLen := int(binary.BigEndian.Uint16(rest[16:18]))
+	rest = rest[18:]
+	if len(rest) < idLen {
+		return nil, "", fmt.Errorf("%w: truncated credential id", ErrVerification)
+	}
+	credentialID := rest[:idLen]
+	_, extra, err := decodeCBOR(rest[idLen:])
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: %v", ErrVerification, err)
+	}
+	publicKey := rest[idLen : len(rest)-len(extra)]
+	if _, err := parsePublicKey(publicKey); err != nil {
+		return nil, "", err
+	}
+	if !bytes.Equal(credentialID, resp.RawID) {
+		return nil, "", fmt.Errorf("%w: credential id mismatch", ErrVerification)
+	}
+
+	return &Credential{
+		ID:        append([]byte(nil), credentialID...),
+		PublicKey: append([]byte(nil), publicKey...),
+		SignCount: signCount,
+	}, username, nil
+}
+
+// BeginLogin starts an assertion ceremony. With no allowed credentials the
+// browser offers the discoverable passkeys it holds for the relying party.
+func (rp *RelyingParty) BeginLogin(s *session.Session, allowed []Credential) (*RequestOptions, error) {
+	challenge, err := rp.begin(s, "login", "")
+	if err != nil {
+		return nil, err
+	}
+	return &RequestOptions{
+		Challenge:        challenge,
+		RPID:             rp.config.RPID,
+		Timeout:          rp.config.Timeout.Milliseconds(),
+		AllowCredentials: descriptors(allowed),
+		UserVerification: "preferred",
+	}, nil
+}
+
+// FinishLogin verifies the response of an assertion ceremony against the stored
+// credential and returns the new signature counter to persist.
+func (rp *RelyingParty) FinishLogin(s *session.Session, resp *AssertionResponse, credential *Credential) (uint32, error) {
+	challenge, _, err := rp.finish(s, "login")
+	if err != nil {
+		return 0, err
+	}
+	if !bytes.Equal(credential.ID, resp.RawID) {
+		return 0, fmt.Errorf("%w: credential id mismatch", ErrVerification)
+	}
+	if err := rp.verifyClientData(resp.Response.ClientDataJSON, "webauthn.get", challenge); err != nil {
+		return 0, err
+	}
+
+	_, signCount, _, err := rp.parseAuthData(resp.Response.AuthenticatorData)
+	if err != nil {
+		return 0, err
+	}
+
+	key, err := parsePublicKey(credential.PublicKey)
+	if err != nil {
+		return 0, err
+	}
+	clientDataHash := sha256.Sum256(resp.Response.ClientDataJSON)
+	digest := sha256.Sum256(append(append([]byte(nil), resp.Response.AuthenticatorData...), clientDataHash[:]...))
+	if !ecdsa.VerifyASN1(key, digest[:], resp.Response.Signature) {
+		return 0, fmt.Errorf("%w: invalid signature", ErrVerification)
+	}
+
+	// A counter that does not increase indicates a cloned authenticator.
+	// Authenticators that do not implement counters always report zero.
+	if (signCount != 0 || credential.SignCount != 0) && signCount <= credential.SignCount {
+		return 0, fmt.Errorf("%w: signature counter did not increase", ErrVerification)
+	}
+	return signCount, nil
+}
+
+// begin stores a new challenge for a ceremony in the session.
+func (rp *RelyingParty) begin(s *session.Session, ceremony, username string) ([]byte, error) {
+	challenge := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, challenge); err != nil {
+		return nil, fmt.Errorf("error generating webauthn challenge: %w", err)
+	}
+
+	// The challenge must survive until the ceremony completes
+	s.Persist()
+	ns := s.Namespace(sessionNamespace)
+	ns.Put("ceremony", ceremony)
+	ns.Put("challenge", base64.RawURLEncoding.EncodeToString(challenge))
+	ns.Put("username", username)
+	ns.Put("expires_at", time.Now().Add(rp.config.Timeout).Unix())
+	return challenge, nil
+}
+
+// finish returns the pending challenge of a ceremony and clears it, so each
+// challenge is only used once.
+func (rp *RelyingParty) finish(s *session.Session, ceremony string) (string, string, error) {
+	ns := s.Namespace(sessionNamespace)
+	pending, _ := ns.Get("ceremony").(string)
+	challenge, _ := ns.Get("challenge").(string)
+	username, _ := ns.Get("username").(string)
+	expiresAt, _ := ns.Get("expires_at").(int64)
+	ns.Clear()
+
+	if pending != ceremony || challenge == "" || time.Now().Unix() > expiresAt {
+		return "", "", ErrNoCeremony
+	}
+	return challenge, username, nil
+}
+
+// verifyClientData checks the type, challenge, and origin of the client data.
+func (rp *RelyingParty) verifyClientData(raw []byte, ceremonyType, challenge string) error {
+	var clientData struct {
+		Type      string `json:"type"`
+		Challenge string `json:"challenge"`
+		Origin    string `json:"origin"`
+	}
+	if err := json.Unmarshal(raw, &clientData); err != nil {
+		return fmt.Errorf("%w: malformed client data", ErrVerification)
+	}
+	if clientData.Type != ceremonyType {
+		return fmt.Errorf("%w: unexpected client data type %q", ErrVerification, clientData.Type)
+	}
+	if clientData.Challenge != challenge {
+		return fmt.Errorf("%w: challenge mismatch", ErrVerification)
+	}
+	if !slices.Contains(rp.config.Origins, clientData.Origin) {
+		return fmt.Errorf("%w: unexpected origin %q", ErrVerification, clientData.Origin)
+	}
+	return nil
+}
+
+// parseAuthData checks the relying party hash and user presence of the
+// authenticator data and returns its flags, counter, and remaining bytes.
+func (rp *RelyingParty) parseAuthData(authData []byte) (byte, uint32, []byte, error) {
+	if len(authData) < 37 {
+		return 0, 0, nil, fmt.Errorf("%w: truncated authenticator data", ErrVerification)
+	}
+	rpIDHash := sha256.Sum256([]byte(rp.config.RPID))
+	if !bytes.Equal(authData[:32], rpIDHash[:]) {
+		return 0, 0, nil, fmt.Errorf("%w: relying party mismatch", ErrVerification)
+	}
+	flags := authData[32]
+	if flags&flagUserPresent == 0 {
+		return 0, 0, nil, fmt.Errorf("%w: user not present", ErrVerification)
+	}
+	return flags, binary.BigEndian.Uint32(authData[33:37]), authData[37:], nil
+}
+
+// parsePublicKey decodes a COSE EC2 P-256 public key.
+func parsePublicKey(cose []byte) (*ecdsa.PublicKey, error) {
+	decoded, _, err := decodeCBOR(cose)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrVerification, err)
+	}
+	key, ok := decoded.(map[any]any)
+	if !ok {
+		return nil, fmt.Errorf("%w: malformed public key", ErrVerification)
+	}
+	// COSE key parameters: 1 kty, 3 alg, -1 crv, -2 x, -3 y
+	x, _ := key[int64(-2)].([]byte)
+	y, _ := key[int64(-3)].([]byte)
+	if key[int64(1)] != int64(2) || key[int64(3)] != int64(algES256) || key[int64(-1)] != int64(1) ||
+		len(x) != 32 || len(y) != 32 {
+		return nil, fmt.Errorf("%w: unsupported public key, only ES256 is supported", ErrVerification)
+	}
+
+	// Validates that the point is on the curve
+	if _, err := ecdh.P256().NewPublicKey(append(append([]byte{4}, x...), y...)); err != nil {
+		return nil, fmt.Errorf("%w: invalid public key: %v", ErrVerification, err)
+	}
+	return &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+}
+
+// descriptors lists credentials for ceremony options.
+func descriptors(credentials []Credential) []CredentialDescriptor {
+	list := make([]CredentialDescriptor, 0, len(credentials))
+	for _, c := range credentials {
+		list = append(list, CredentialDescriptor{Type: "public-key", ID: c.ID})
+	}
+	return list
+}
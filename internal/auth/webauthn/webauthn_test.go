@@ -0,0 +1,147 @@
+package webauthn
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/raziel-aleman/go-starter/internal/session"
+)
+
+// cborHead encodes a CBOR initial byte and argument.
+func cborHead(major byte, n int) []byte {
+	if n < 24 {
+		return []byte{major<<5 | byte(n)}
+	}
+	return []byte{major<<5 | 25, byte(n >> 8), byte(n)}
+}
+
+func cborBytes(b []byte) []byte { return append(cborHead(2, len(b)), b...) }
+func cborText(s string) []byte  { return append(cborHead(3, len(s)), s...) }
+func cborInt(n int) []byte {
+	if n < 0 {
+		return cborHead(1, -1-n)
+	}
+	return cborHead(0, n)
+}
+
+// authenticator simulates a platform authenticator holding one ES256 credential.
+type authenticator struct {
+	key   *ecdsa.PrivateKey
+	id    []byte
+	count uint32
+}
+
+func (a *authenticator) coseKey() []byte {
+	x := make([]byte, 32)
+	y := make([]byte, 32)
+	a.key.X.FillBytes(x)
+	a.key.Y.FillBytes(y)
+	key := cborHead(5, 5)
+	key = append(key, cborInt(1)...)
+	key = append(key, cborInt(2)...)
+	key = append(key, cborInt(3)...)
+	key = append(key, cborInt(-7)...)
+	key = append(key, cborInt(-1)...)
+	key = append(key, cborInt(1)...)
+	key = append(key, cborInt(-2)...)
+	key = append(key, cborBytes(x)...)
+	key = append(key, cborInt(-3)...)
+	key = append(key, cborBytes(y)...)
+	return key
+}
+
+func (a *authenticator) authData(rpID string, attested bool) []byte {
+	hash := sha256.Sum256([]byte(rpID))
+	data := append([]byte(nil), hash[:]...)
+	flags := byte(flagUserPresent | flagUserVerified)
+	if attested {
+		flags |= flagAttested
+	}
+	data = append(data, flags)
+	data = binary.BigEndian.AppendUint32(data, a.count)
+	if attested {
+		data = append(data, make([]byte, 16)...)
+		data = binary.BigEndian.AppendUint16(data, uint16(len(a.id)))
+		data = append(data, a.id...)
+		data = append(data, a.coseKey()...)
+	}
+	return data
+}
+
+func clientData(t *testing.T, typ string, challenge []byte, origin string) []byte {
+	data, err := json.Marshal(map[string]string{
+		"type":      typ,
+		"challenge": base64.RawURLEncoding.EncodeToString(challenge),
+		"origin":    origin,
+	})
+	if err != nil {
+		t.Fatalf("error marshalling client data. Err: %v", err)
+	}
+	return data
+}
+
+func TestRegistrationAndLogin(t *testing.T) {
+	rp := New(Config{RPID: "localhost", RPName: "go-starter", Origins: []string{"http://localhost:5173"}})
+	s, _ := session.NewSession()
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	auth := &authenticator{key: key, id: []byte("credential-1")}
+
+	// Registration ceremony
+	creation, err := rp.BeginRegistration(s, "user123", nil)
+	if err != nil {
+		t.Fatalf("error beginning registration. Err: %v", err)
+	}
+	object := cborHead(5, 3)
+	object = append(object, cborText("fmt")...)
+	object = append(object, cborText("none")...)
+	object = append(object, cborText("attStmt")...)
+	object = append(object, cborHead(5, 0)...)
+	object = append(object, cborText("authData")...)
+	object = append(object, cborBytes(auth.authData("localhost", true))...)
+
+	var reg RegistrationResponse
+	reg.RawID = auth.id
+	reg.Response.ClientDataJSON = clientData(t, "webauthn.create", creation.Challenge, "http://localhost:5173")
+	reg.Response.AttestationObject = object
+	credential, username, err := rp.FinishRegistration(s, &reg)
+	if err != nil {
+		t.Fatalf("error finishing registration. Err: %v", err)
+	}
+	if username != "user123" {
+		t.Errorf("expected username user123; got %s", username)
+	}
+
+	// Assertion ceremony
+	request, err := rp.BeginLogin(s, nil)
+	if err != nil {
+		t.Fatalf("error beginning login. Err: %v", err)
+	}
+	auth.count = 1
+	var assertion AssertionResponse
+	assertion.RawID = auth.id
+	assertion.Response.ClientDataJSON = clientData(t, "webauthn.get", request.Challenge, "http://localhost:5173")
+	assertion.Response.AuthenticatorData = auth.authData("localhost", false)
+	clientDataHash := sha256.Sum256(assertion.Response.ClientDataJSON)
+	digest := sha256.Sum256(append(append([]byte(nil), assertion.Response.AuthenticatorData...), clientDataHash[:]...))
+	assertion.Response.Signature, _ = ecdsa.SignASN1(rand.Reader, key, digest[:])
+
+	count, err := rp.FinishLogin(s, &assertion, credential)
+	if err != nil {
+		t.Fatalf("error finishing login. Err: %v", err)
+	}
+	if count != 1 {
+		t.Errorf("expected sign count 1; got %d", count)
+	}
+
+	// The challenge can only be used once
+	if _, err := rp.FinishLogin(s, &assertion, credential); !errors.Is(err, ErrNoCeremony) {
+		t.Errorf("expected ErrNoCeremony on replay; got %v", err)
+	}
+}
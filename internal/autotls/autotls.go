@@ -0,0 +1,380 @@
+// Package autotls obtains and renews certificates from an ACME certificate
+// authority such as Let's Encrypt, so small deployments can serve HTTPS
+// without a reverse proxy. It covers what golang.org/x/crypto/acme/autocert
+// does for a single server, HTTP-01 challenges, a directory cache and a host
+// policy, without the golang.org/x/net dependency of autocert.
+package autotls
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/acme"
+)
+
+// accountKeyFile is the name of the account key in the cache directory, which
+// cannot collide with a host name.
+const accountKeyFile = "acme_account+key"
+
+// Manager obtains a certificate for each allowed host on its first TLS
+// handshake, and renews it before it expires.
+type Manager struct {
+	Cache        string        // Directory keeping the account key and certificates
+	Hosts        []string      // Host policy: the names certificates may be obtained for
+	Email        string        // Optional contact of the ACME account, for expiry notices
+	DirectoryURL string        // ACME directory, defaults to Let's Encrypt production
+	RenewBefore  time.Duration // How long before expiry certificates are renewed
+
+	mu       sync.Mutex
+	client   *acme.Client
+	certs    map[string]*tls.Certificate
+	hosts    map[string]*sync.Mutex // Serializes obtaining the certificate of a host
+	renewing map[string]bool
+	tokens   map[string]string // HTTP-01 key authorizations by challenge path
+}
+
+// New creates a manager caching certificates in dir, for the given hosts.
+func New(dir, email string, hosts []string) *Manager {
+	allowed := make([]string, len(hosts))
+	for i, host := range hosts {
+		allowed[i] = strings.ToLower(strings.TrimSpace(host))
+	}
+	return &Manager{
+		Cache:        dir,
+		Hosts:        allowed,
+		Email:        email,
+		DirectoryURL: acme.LetsEncryptURL,
+		RenewBefore:  30 * 24 * time.Hour,
+	}
+}
+
+// TLSConfig returns a server TLS config using the certificates of the manager.
+func (m *Manager) TLSConfig() *tls.Config {
+	return &tls.Config{
+		GetCertificate: m.GetCertificate,
+		MinVersion:     tls.VersionTLS12,
+	}
+}
+
+// GetCertificate returns the certificate of the server name of a handshake,
+// from memory, the cache directory, or the certificate authority.
+func (m *Manager) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	name := strings.ToLower(strings.TrimSuffix(hello.ServerName, "."))
+	if name == "" {
+		return nil, errors.New("autotls: missing server name")
+	}
+	if !slices.Contains(m.Hosts, name) {
+		return nil, fmt.Errorf("autotls: host %q not allowed", name)
+	}
+
+	if cert := m.cached(name); cert != nil {
+		m.renewIfExpiring(name, cert)
+		return cert, nil
+	}
+
+	// Other handshakes for the host wait for the certificate being obtained
+	lock := m.hostLock(name)
+	lock.Lock()
+	defer lock.Unlock()
+	if cert := m.cached(name); cert != nil {
+		return cert, nil
+	}
+	if cert, err := m.load(name); err == nil && time.Now().Before(cert.Leaf.NotAfter) {
+		m.store(name, cert)
+		m.renewIfExpiring(name, cert)
+		return cert, nil
+	}
+
+	ctx, cancel := context.WithTimeout(hello.Context(), 5*time.Minute)
+	defer cancel()
+	cert, err := m.obtain(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	m.store(name, cert)
+	return cert, nil
+}
+
+// HTTPHandler answers the HTTP-01 challenges of the certificate authority,
+// and passes other requests to fallback. A nil fallback redirects them to
+// HTTPS.
+func (m *Manager) HTTPHandler(fallback http.Handler) http.Handler {
+	if fallback == nil {
+		fallback = http.HandlerFunc(redirectHTTPS)
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/.well-known/acme-challenge/") {
+			fallback.ServeHTTP(w, r)
+			return
+		}
+		m.mu.Lock()
+		response, ok := m.tokens[r.URL.Path]
+		m.mu.Unlock()
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte(response))
+	})
+}
+
+// redirectHTTPS redirects GET and HEAD requests to the same URL over HTTPS.
+func redirectHTTPS(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Use HTTPS", http.StatusBadRequest)
+		return
+	}
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusFound)
+}
+
+func (m *Manager) cached(name string) *tls.Certificate {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.certs[name]
+}
+
+func (m *Manager) store(name string, cert *tls.Certificate) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.certs == nil {
+		m.certs = map[string]*tls.Certificate{}
+	}
+	m.certs[name] = cert
+}
+
+func (m *Manager) hostLock(name string) *sync.Mutex {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.hosts == nil {
+		m.hosts = map[string]*sync.Mutex{}
+	}
+	if m.hosts[name] == nil {
+		m.hosts[name] = &sync.Mutex{}
+	}
+	return m.hosts[name]
+}
+
+// renewIfExpiring obtains a new certificate in the background when cert
+// expires within RenewBefore. The current one is served meanwhile.
+func (m *Manager) renewIfExpiring(name string, cert *tls.Certificate) {
+	if time.Until(cert.Leaf.NotAfter) > m.RenewBefore {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.renewing[name] {
+		return
+	}
+	if m.renewing == nil {
+		m.renewing = map[string]bool{}
+	}
+	m.renewing[name] = true
+
+	go func() {
+		defer func() {
+			m.mu.Lock()
+			delete(m.renewing, name)
+			m.mu.Unlock()
+		}()
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+		defer cancel()
+		renewed, err := m.obtain(ctx, name)
+		if err != nil {
+			slog.Error("Failed to renew certificate", "host", name, "err", err)
+			return
+		}
+		m.store(name, renewed)
+	}()
+}
+
+// load reads the certificate of a host from the cache directory, where it is
+// kept as its private key followed by its chain, in PEM.
+func (m *Manager) load(name string) (*tls.Certificate, error) {
+	data, err := os.ReadFile(filepath.Join(m.Cache, name))
+	if err != nil {
+		return nil, err
+	}
+	// Each call skips the blocks of the other type
+	cert, err := tls.X509KeyPair(data, data)
+	if err != nil {
+		return nil, err
+	}
+	return &cert, nil
+}
+
+// obtain orders a certificate for a host, answering its HTTP-01 challenges,
+// and writes it to the cache directory.
+func (m *Manager) obtain(ctx context.Context, name string) (*tls.Certificate, error) {
+	client, err := m.acmeClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	order, err := client.AuthorizeOrder(ctx, acme.DomainIDs(name))
+	if err != nil {
+		return nil, fmt.Errorf("autotls: error ordering a certificate for %s: %v", name, err)
+	}
+	for _, url := range order.AuthzURLs {
+		if err := m.authorize(ctx, client, url); err != nil {
+			return nil, fmt.Errorf("autotls: error authorizing %s: %v", name, err)
+		}
+	}
+	if order, err = client.WaitOrder(ctx, order.URI); err != nil {
+		return nil, fmt.Errorf("autotls: error ordering a certificate for %s: %v", name, err)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{DNSNames: []string{name}}, key)
+	if err != nil {
+		return nil, err
+	}
+	chain, _, err := client.CreateOrderCert(ctx, order.FinalizeURL, csr, true)
+	if err != nil {
+		return nil, fmt.Errorf("autotls: error issuing the certificate of %s: %v", name, err)
+	}
+	leaf, err := x509.ParseCertificate(chain[0])
+	if err != nil {
+		return nil, err
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	data := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	for _, der := range chain {
+		data = append(data, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})...)
+	}
+	if err := writeFile(m.Cache, name, data); err != nil {
+		slog.Error("Failed to cache certificate", "host", name, "err", err)
+	}
+	return &tls.Certificate{Certificate: chain, PrivateKey: key, Leaf: leaf}, nil
+}
+
+// authorize proves control of the host of an authorization with its HTTP-01
+// challenge, served by HTTPHandler until the authorization completes.
+func (m *Manager) authorize(ctx context.Context, client *acme.Client, url string) error {
+	authz, err := client.GetAuthorization(ctx, url)
+	if err != nil {
+		return err
+	}
+	if authz.Status == acme.StatusValid {
+		return nil
+	}
+	i := slices.IndexFunc(authz.Challenges, func(c *acme.Challenge) bool { return c.Type == "http-01" })
+	if i < 0 {
+		return errors.New("no http-01 challenge offered")
+	}
+	challenge := authz.Challenges[i]
+
+	response, err := client.HTTP01ChallengeResponse(challenge.Token)
+	if err != nil {
+		return err
+	}
+	path := client.HTTP01ChallengePath(challenge.Token)
+	m.mu.Lock()
+	if m.tokens == nil {
+		m.tokens = map[string]string{}
+	}
+	m.tokens[path] = response
+	m.mu.Unlock()
+	defer func() {
+		m.mu.Lock()
+		delete(m.tokens, path)
+		m.mu.Unlock()
+	}()
+
+	if _, err := client.Accept(ctx, challenge); err != nil {
+		return err
+	}
+	_, err = client.WaitAuthorization(ctx, authz.URI)
+	return err
+}
+
+// acmeClient returns the client of the ACME account, registering the account
+// on first use with a key kept in the cache directory.
+func (m *Manager) acmeClient(ctx context.Context) (*acme.Client, error) {
+	m.mu.Lock()
+	client := m.client
+	m.mu.Unlock()
+	if client != nil {
+		return client, nil
+	}
+
+	key, err := m.accountKey()
+	if err != nil {
+		return nil, fmt.Errorf("autotls: error loading the account key: %v", err)
+	}
+	client = &acme.Client{Key: key, DirectoryURL: m.DirectoryURL}
+	account := &acme.Account{}
+	if m.Email != "" {
+		account.Contact = []string{"mailto:" + m.Email}
+	}
+	if _, err := client.Register(ctx, account, acme.AcceptTOS); err != nil && !errors.Is(err, acme.ErrAccountAlreadyExists) {
+		return nil, fmt.Errorf("autotls: error registering the account: %v", err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.client == nil {
+		m.client = client
+	}
+	return m.client, nil
+}
+
+// accountKey reads the account key from the cache directory, or generates it.
+func (m *Manager) accountKey() (crypto.Signer, error) {
+	data, err := os.ReadFile(filepath.Join(m.Cache, accountKeyFile))
+	if err == nil {
+		block, _ := pem.Decode(data)
+		if block == nil {
+			return nil, errors.New("invalid PEM")
+		}
+		return x509.ParseECPrivateKey(block.Bytes)
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return key, writeFile(m.Cache, accountKeyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}))
+}
+
+// writeFile writes a private file of the cache directory, creating it.
+func writeFile(dir, name string, data []byte) error {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, name), data, 0o600)
+}
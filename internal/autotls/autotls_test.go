@@ -0,0 +1,90 @@
+package autotls
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// writeCert caches a self-signed certificate for host, expiring in validity.
+func writeCert(t *testing.T, dir, host string, validity time.Duration) {
+	t.Helper()
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		DNSNames:     []string{host},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(validity),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("error creating certificate. Err: %v", err)
+	}
+	keyDER, _ := x509.MarshalECPrivateKey(key)
+	data := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	data = append(data, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})...)
+	if err := writeFile(dir, host, data); err != nil {
+		t.Fatalf("error writing certificate. Err: %v", err)
+	}
+}
+
+func TestGetCertificate(t *testing.T) {
+	dir := t.TempDir()
+	writeCert(t, dir, "example.com", 60*24*time.Hour)
+	m := New(dir, "", []string{" Example.com"})
+
+	cert, err := m.GetCertificate(&tls.ClientHelloInfo{ServerName: "EXAMPLE.com."})
+	if err != nil {
+		t.Fatalf("error getting the cached certificate. Err: %v", err)
+	}
+	if cert.Leaf.DNSNames[0] != "example.com" {
+		t.Errorf("expected the certificate of example.com; got %v", cert.Leaf.DNSNames)
+	}
+	if m.renewing["example.com"] {
+		t.Errorf("expected a certificate valid for 60 days not to be renewed")
+	}
+
+	for _, name := range []string{"", "other.com"} {
+		if _, err := m.GetCertificate(&tls.ClientHelloInfo{ServerName: name}); err == nil {
+			t.Errorf("expected an error for server name %q", name)
+		}
+	}
+}
+
+func TestHTTPHandler(t *testing.T) {
+	m := New(t.TempDir(), "", []string{"example.com"})
+	m.tokens = map[string]string{"/.well-known/acme-challenge/token": "token.thumbprint"}
+	handler := m.HTTPHandler(nil)
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "http://example.com/.well-known/acme-challenge/token", nil))
+	if rr.Code != http.StatusOK || rr.Body.String() != "token.thumbprint" {
+		t.Errorf("expected the key authorization; got %d %q", rr.Code, rr.Body.String())
+	}
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "http://example.com/.well-known/acme-challenge/unknown", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown token; got %d", rr.Code)
+	}
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "http://example.com:80/login?next=/", nil))
+	if location := rr.Header().Get("Location"); rr.Code != http.StatusFound || location != "https://example.com/login?next=/" {
+		t.Errorf("expected a redirect to HTTPS; got %d %q", rr.Code, location)
+	}
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "http://example.com/login", nil))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for a POST over HTTP; got %d", rr.Code)
+	}
+}
@@ -0,0 +1,209 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// UserQuery selects a page of users.
+type UserQuery struct {
+	Search string // Matches usernames and emails containing it, case-insensitively
+	Page          // Sorted by "username" (default, accepts a cursor), "email", "created_at", or "last_login_at"
+}
+
+// userSortColumns are the columns users can be listed by.
+var userSortColumns = map[string]sortColumn{
+	"username":      {column: "username", unique: true},
+	"email":         {column: "email"},
+	"created_at":    {column: "created_at"},
+	"last_login_at": {column: "last_login_at"},
+}
+
+// UserSummary is a user as listed to administrators.
+type UserSummary struct {
+	ID                    string     `json:"id,omitempty"`
+	Username              string     `json:"username"`
+	Email                 string     `json:"email,omitempty"`
+	DisplayName           string     `json:"display_name,omitempty"`
+	Verified              bool       `json:"verified"`
+	Status                UserStatus `json:"status"`
+	PasswordResetRequired bool       `json:"password_reset_required"`
+	CreatedAt             *time.Time `json:"created_at,omitempty"`
+	UpdatedAt             *time.Time `json:"updated_at,omitempty"`
+	LastLoginAt           *time.Time `json:"last_login_at,omitempty"`
+}
+
+// UserStatus tells whether a user can use its account.
+type UserStatus string
+
+const (
+	StatusActive   UserStatus = "active"
+	StatusDisabled UserStatus = "disabled" // Suspended until re-enabled
+	StatusBanned   UserStatus = "banned"
+)
+
+// AccountStatus holds the flags restricting the use of an account.
+type AccountStatus struct {
+	Status                UserStatus
+	PasswordResetRequired bool
+	PasswordChangedAt     time.Time
+}
+
+// ListUsers returns a page of users matching the query and the total number
+// of matches. It returns ErrInvalidPage if the page cannot be applied.
+func (s *service) ListUsers(ctx context.Context, query UserQuery) ([]UserSummary, int, error) {
+	ctx, cancel := s.db.readContext(ctx)
+	defer cancel()
+	conditions := []string{"deleted_at IS NULL"}
+	var args []any
+	if tenant, ok := TenantFromContext(ctx); ok {
+		conditions = append(conditions, "tenant_id = ?")
+		args = append(args, tenant)
+	}
+	if query.Search != "" {
+		// Escape LIKE wildcards so the search is a plain substring match
+		pattern := "%" + strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(query.Search) + "%"
+		conditions = append(conditions, "("+s.db.contains("username")+" OR "+s.db.contains("email")+")")
+		args = append(args, pattern, pattern)
+	}
+
+	var total int
+	count := "SELECT COUNT(*) FROM users WHERE " + strings.Join(conditions, " AND ")
+	if err := s.reader(ctx).QueryRowContext(ctx, count, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	list, args, err := paginate(
+		`SELECT id, uuid, username, email, display_name, verified_at IS NOT NULL, status, password_reset_required,
+		created_at, updated_at, last_login_at FROM users`,
+		conditions, args, query.Page, userSortColumns, "username",
+	)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := s.reader(ctx).QueryContext(ctx, list, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	users := []UserSummary{}
+	for rows.Next() {
+		var u UserSummary
+		var id int64
+		var uuid, email, displayName, createdAt, updatedAt, lastLoginAt sql.NullString
+		if err := rows.Scan(
+			&id, &uuid, &u.Username, &email, &displayName, &u.Verified, &u.Status, &u.PasswordResetRequired,
+			&createdAt, &updatedAt, &lastLoginAt,
+		); err != nil {
+			return nil, 0, err
+		}
+		u.ID, u.Email, u.DisplayName = userID(id, uuid), email.String, displayName.String
+		if u.CreatedAt, err = parseNullTime(createdAt); err != nil {
+			return nil, 0, err
+		}
+		if u.UpdatedAt, err = parseNullTime(updatedAt); err != nil {
+			return nil, 0, err
+		}
+		if u.LastLoginAt, err = parseNullTime(lastLoginAt); err != nil {
+			return nil, 0, err
+		}
+		users = append(users, u)
+	}
+	return users, total, rows.Err()
+}
+
+// AccountStatus returns the status of a user, whether it must change its
+// password, and when the password was last changed.
+func (s *service) AccountStatus(ctx context.Context, username string) (AccountStatus, error) {
+	ctx, cancel := s.db.readContext(ctx)
+	defer cancel()
+	var status AccountStatus
+	var changedAt sql.NullString
+	query, args := andTenant(ctx,
+		"SELECT status, password_reset_required, password_changed_at FROM users WHERE username = ? AND deleted_at IS NULL",
+		username,
+	)
+	err := s.db.prepared().QueryRowContext(ctx, query, args...).Scan(&status.Status, &status.PasswordResetRequired, &changedAt)
+	if err != nil {
+		return status, err
+	}
+	if changedAt.Valid {
+		if status.PasswordChangedAt, err = time.Parse(time.RFC3339, changedAt.String); err != nil {
+			return status, err
+		}
+	}
+	return status, nil
+}
+
+// SetUserStatus changes the status of a user, recording when it stopped being
+// active. It returns sql.ErrNoRows if the user does not exist.
+func (s *service) SetUserStatus(ctx context.Context, username string, status UserStatus) error {
+	var disabledAt any
+	if status != StatusActive {
+		disabledAt = time.Now().UTC().Format(time.RFC3339)
+	}
+	query, args := andTenant(ctx,
+		"UPDATE users SET status = ?, disabled_at = ?, updated_at = ? WHERE username = ? AND deleted_at IS NULL",
+		status,
+		disabledAt,
+		time.Now().UTC().Format(time.RFC3339),
+		username,
+	)
+	return s.execOne(ctx, query, args...)
+}
+
+// RecordLogin sets the last login time of a user to now.
+func (s *service) RecordLogin(ctx context.Context, username string) error {
+	query, args := andTenant(ctx,
+		"UPDATE users SET last_login_at = ? WHERE username = ? AND deleted_at IS NULL",
+		time.Now().UTC().Format(time.RFC3339),
+		username,
+	)
+	return s.execOne(ctx, query, args...)
+}
+
+// RequirePasswordReset forces a user to change its password before using the
+// account. It returns sql.ErrNoRows if the user does not exist.
+func (s *service) RequirePasswordReset(ctx context.Context, username string) error {
+	query, args := andTenant(ctx,
+		"UPDATE users SET password_reset_required = 1, updated_at = ? WHERE username = ? AND deleted_at IS NULL",
+		time.Now().UTC().Format(time.RFC3339),
+		username,
+	)
+	return s.execOne(ctx, query, args...)
+}
+
+// execOne executes a statement expected to affect a row, returning
+// sql.ErrNoRows if none matched.
+func (s *service) execOne(ctx context.Context, query string, args ...any) error {
+	return affectOne(ctx, s.db, query, args...)
+}
+
+// deleteOne executes a statement expected to affect a row on a connection
+// pool or in a transaction, returning sql.ErrNoRows if none matched.
+func affectOne(ctx context.Context, q queryer, query string, args ...any) error {
+	result, err := q.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// oneRow returns sql.ErrNoRows if a generated :execrows query affected no row.
+func oneRow(n int64, err error) error {
+	if err == nil && n == 0 {
+		return sql.ErrNoRows
+	}
+	return err
+}
@@ -0,0 +1,139 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// APIKey is the metadata of an API key. The key itself is only stored hashed.
+type APIKey struct {
+	ID         int64      `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"` // Leading characters of the key, to tell keys apart
+	Scopes     []string   `json:"scopes,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+// CreateAPIKey stores the hash of a new API key for a user and returns its id.
+// A key without scopes is unrestricted.
+func (s *service) CreateAPIKey(ctx context.Context, username string, name string, prefix string, keyHash string, scopes []string) (int64, error) {
+	return insertID(ctx, s.db, s.db.driver,
+		"INSERT INTO api_keys (username, name, prefix, key_hash, scopes, created_at) VALUES (?, ?, ?, ?, ?, ?)",
+		username,
+		name,
+		prefix,
+		keyHash,
+		strings.Join(scopes, " "),
+		time.Now().UTC().Format(time.RFC3339),
+	)
+}
+
+// APIKeys returns the API keys of a user, including revoked ones.
+func (s *service) APIKeys(ctx context.Context, username string) ([]APIKey, error) {
+	ctx, cancel := s.db.readContext(ctx)
+	defer cancel()
+	rows, err := s.reader(ctx).QueryContext(ctx,
+		"SELECT id, name, prefix, scopes, created_at, last_used_at, revoked_at FROM api_keys WHERE username = ? ORDER BY id",
+		username,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []APIKey{}
+	for rows.Next() {
+		var key APIKey
+		var scopes, createdAt string
+		var lastUsedAt, revokedAt sql.NullString
+		if err := rows.Scan(&key.ID, &key.Name, &key.Prefix, &scopes, &createdAt, &lastUsedAt, &revokedAt); err != nil {
+			return nil, err
+		}
+		key.Scopes = strings.Fields(scopes)
+		if key.CreatedAt, err = time.Parse(time.RFC3339, createdAt); err != nil {
+			return nil, err
+		}
+		if key.LastUsedAt, err = parseNullTime(lastUsedAt); err != nil {
+			return nil, err
+		}
+		if key.RevokedAt, err = parseNullTime(revokedAt); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// RevokeAPIKey revokes an API key owned by a user. It returns sql.ErrNoRows if
+// the user has no active key with that id.
+func (s *service) RevokeAPIKey(ctx context.Context, username string, id int64) error {
+	result, err := s.db.ExecContext(ctx,
+		"UPDATE api_keys SET revoked_at = ? WHERE id = ? AND username = ? AND revoked_at IS NULL",
+		time.Now().UTC().Format(time.RFC3339),
+		id,
+		username,
+	)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// RevokeUserAPIKeys revokes every active API key of a user, e.g. when it is
+// disabled or banned.
+func (s *service) RevokeUserAPIKeys(ctx context.Context, username string) error {
+	_, err := s.db.ExecContext(ctx,
+		"UPDATE api_keys SET revoked_at = ? WHERE username = ? AND revoked_at IS NULL",
+		time.Now().UTC().Format(time.RFC3339),
+		username,
+	)
+	return err
+}
+
+// AuthenticateAPIKey returns the owner and scopes of an active API key and
+// records its use. It returns sql.ErrNoRows for unknown or revoked keys, and
+// for the keys of users who are deleted, disabled or banned.
+func (s *service) AuthenticateAPIKey(ctx context.Context, keyHash string) (string, []string, error) {
+	ctx, cancel := s.db.readContext(ctx)
+	defer cancel()
+	query, args := andTenant(ctx,
+		`UPDATE api_keys SET last_used_at = ? WHERE key_hash = ? AND revoked_at IS NULL
+		AND username IN (SELECT username FROM users WHERE status = 'active' AND deleted_at IS NULL`,
+		time.Now().UTC().Format(time.RFC3339),
+		keyHash,
+	)
+	err := s.execOne(ctx, query+")", args...)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var username, scopes string
+	err = s.db.QueryRowContext(ctx,
+		"SELECT username, scopes FROM api_keys WHERE key_hash = ?",
+		keyHash,
+	).Scan(&username, &scopes)
+	return username, strings.Fields(scopes), err
+}
+
+// parseNullTime parses an optional RFC3339 column.
+func parseNullTime(value sql.NullString) (*time.Time, error) {
+	if !value.Valid {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, value.String)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
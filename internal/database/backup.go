@@ -0,0 +1,59 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// ErrBackupUnsupported is returned by Backup for server databases, which
+// are backed up with their own tools, like pg_dump or mysqldump.
+var ErrBackupUnsupported = errors.New("online backup is only supported for SQLite")
+
+// Backup writes a consistent snapshot of a SQLite database to a new file at
+// dst with the SQLite online backup API, while the database is in use. In
+// WAL mode the copy does not block writers. Remote libsql databases are
+// backed up by their provider.
+func (s *service) Backup(ctx context.Context, dst string) error {
+	if _, local := s.db.Driver().(*sqlite3.SQLiteDriver); !local {
+		return ErrBackupUnsupported
+	}
+	if _, err := os.Stat(dst); err == nil {
+		return fmt.Errorf("backup destination %s already exists", dst)
+	}
+
+	dstDB, err := sql.Open(DriverSQLite, dst)
+	if err != nil {
+		return err
+	}
+	defer dstDB.Close()
+	dstConn, err := dstDB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer dstConn.Close()
+	srcConn, err := s.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer srcConn.Close()
+
+	return dstConn.Raw(func(dstDriverConn any) error {
+		return srcConn.Raw(func(srcDriverConn any) error {
+			backup, err := dstDriverConn.(*sqlite3.SQLiteConn).Backup("main", srcDriverConn.(*sqlite3.SQLiteConn), "main")
+			if err != nil {
+				return fmt.Errorf("error starting backup: %v", err)
+			}
+			// Copy every page in one step, so the snapshot is consistent
+			if _, err := backup.Step(-1); err != nil {
+				backup.Close()
+				return fmt.Errorf("error copying database: %v", err)
+			}
+			return backup.Finish()
+		})
+	})
+}
@@ -0,0 +1,75 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// busyConfigFromEnv reads BLUEPRINT_DB_BUSY_TIMEOUT (default 5s, 0 to
+// disable), how long writes failing on a locked SQLite database are retried.
+func busyConfigFromEnv() (retryConfig, error) {
+	config := retryConfig{
+		Timeout:    5 * time.Second,
+		Backoff:    10 * time.Millisecond,
+		MaxBackoff: 500 * time.Millisecond,
+	}
+	if value := os.Getenv("BLUEPRINT_DB_BUSY_TIMEOUT"); value != "" {
+		timeout, err := time.ParseDuration(value)
+		if err != nil || timeout < 0 {
+			return config, fmt.Errorf("invalid BLUEPRINT_DB_BUSY_TIMEOUT %q", value)
+		}
+		config.Timeout = timeout
+	}
+	return config, nil
+}
+
+// isBusy reports whether a statement failed because another connection holds
+// the lock of the SQLite database. The busy timeout of the driver does not
+// cover every case: in WAL mode, a transaction that read before writing fails
+// at once if another one wrote in between.
+func isBusy(err error) bool {
+	if err == nil {
+		return false
+	}
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.Code == sqlite3.ErrBusy || sqliteErr.Code == sqlite3.ErrLocked
+	}
+	// libsql, and the transactions wrapping errors, only keep the message
+	return strings.Contains(err.Error(), "database is locked")
+}
+
+// retryBusy runs fn again while it fails on a locked database, until the
+// timeout of the config. The delay between attempts is random, up to a
+// backoff doubled after each attempt, so writers that collided do not
+// collide again. It returns the last error of fn.
+func retryBusy(ctx context.Context, config retryConfig, fn func() error) error {
+	err := fn()
+	if config.Timeout == 0 || !isBusy(err) {
+		return err
+	}
+
+	deadline := time.Now().Add(config.Timeout)
+	backoff := config.Backoff
+	for isBusy(err) {
+		delay := rand.N(backoff) + 1
+		if time.Until(deadline) < delay {
+			return err
+		}
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return err
+		}
+		backoff = min(backoff*2, config.MaxBackoff)
+		err = fn()
+	}
+	return err
+}
@@ -0,0 +1,117 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	sqldriver "database/sql/driver"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// busyDriver is a driver whose statements fail with its err until they were
+// attempted failures times, then succeed.
+type busyDriver struct {
+	err      error
+	failures int32
+	attempts atomic.Int32
+}
+
+func (d *busyDriver) Open(string) (sqldriver.Conn, error) { return busyConn{d}, nil }
+
+type busyConn struct{ d *busyDriver }
+
+func (c busyConn) Prepare(string) (sqldriver.Stmt, error) { return nil, errors.New("not supported") }
+func (c busyConn) Close() error                           { return nil }
+func (c busyConn) Begin() (sqldriver.Tx, error)           { return nil, errors.New("not supported") }
+
+func (c busyConn) ExecContext(context.Context, string, []sqldriver.NamedValue) (sqldriver.Result, error) {
+	if c.d.attempts.Add(1) <= c.d.failures {
+		return nil, c.d.err
+	}
+	return sqldriver.RowsAffected(1), nil
+}
+
+// testDrivers numbers the drivers registered by tests, whose names must be unique.
+var testDrivers atomic.Int32
+
+// openBusyDB returns a connection pool on a busyDriver retrying with config.
+func openBusyDB(t *testing.T, d *busyDriver, config retryConfig) *conn {
+	t.Helper()
+	name := fmt.Sprintf("busy%d", testDrivers.Add(1))
+	sql.Register(name, d)
+	db, err := sql.Open(name, "")
+	if err != nil {
+		t.Fatalf("error opening database. Err: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return &conn{DB: db, driver: DriverSQLite, busy: config}
+}
+
+func TestRetryBusy(t *testing.T) {
+	busy := sqlite3.Error{Code: sqlite3.ErrBusy}
+	config := retryConfig{Timeout: time.Second, Backoff: time.Millisecond, MaxBackoff: 5 * time.Millisecond}
+
+	tests := []struct {
+		name         string
+		err          error
+		failures     int32
+		config       retryConfig
+		wantErr      error
+		wantAttempts int32
+	}{
+		{"busy then success", busy, 3, config, nil, 4},
+		{"locked then success", sqlite3.Error{Code: sqlite3.ErrLocked}, 2, config, nil, 3},
+		{"busy message then success", errors.New("database is locked"), 2, config, nil, 3},
+		{"other error", sql.ErrConnDone, 3, config, sql.ErrConnDone, 1},
+		{"retries disabled", busy, 3, retryConfig{}, busy, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := &busyDriver{err: tt.err, failures: tt.failures}
+			c := openBusyDB(t, d, tt.config)
+
+			_, err := c.ExecContext(context.Background(), "UPDATE users SET status = ?", "active")
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("expected error %v; got %v", tt.wantErr, err)
+			}
+			if n := d.attempts.Load(); n != tt.wantAttempts {
+				t.Errorf("expected %d attempts; got %d", tt.wantAttempts, n)
+			}
+		})
+	}
+}
+
+func TestRetryBusyTimeout(t *testing.T) {
+	busy := sqlite3.Error{Code: sqlite3.ErrBusy}
+	d := &busyDriver{err: busy, failures: 1000}
+	c := openBusyDB(t, d, retryConfig{Timeout: 50 * time.Millisecond, Backoff: time.Millisecond, MaxBackoff: 10 * time.Millisecond})
+
+	// A database locked for longer than the timeout returns the busy error
+	start := time.Now()
+	_, err := c.ExecContext(context.Background(), "UPDATE users SET status = ?", "active")
+	if !errors.Is(err, busy) {
+		t.Errorf("expected the busy error; got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected retries to stop after the timeout; took %v", elapsed)
+	}
+	if n := d.attempts.Load(); n < 2 || n >= 1000 {
+		t.Errorf("expected a few attempts within the timeout; got %d", n)
+	}
+
+	// Retries stop when the context is done
+	d.attempts.Store(0)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := c.ExecContext(ctx, "UPDATE users SET status = ?", "active"); err == nil {
+		t.Errorf("expected an error with a canceled context")
+	}
+	if n := d.attempts.Load(); n > 1 {
+		t.Errorf("expected no retry with a canceled context; got %d attempts", n)
+	}
+}
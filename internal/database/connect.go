@@ -0,0 +1,73 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+)
+
+// retryConfig tells how long to wait for the database to accept connections.
+type retryConfig struct {
+	Timeout    time.Duration // Deadline of all the attempts
+	Backoff    time.Duration // Delay after the first failed attempt, doubled after each failure
+	MaxBackoff time.Duration // Upper bound of the delay
+}
+
+// retryConfigFromEnv reads BLUEPRINT_DB_CONNECT_TIMEOUT (default 30s, 0 for a
+// single attempt) and BLUEPRINT_DB_CONNECT_BACKOFF (default 500ms).
+func retryConfigFromEnv() (retryConfig, error) {
+	config := retryConfig{
+		Timeout:    30 * time.Second,
+		Backoff:    500 * time.Millisecond,
+		MaxBackoff: 10 * time.Second,
+	}
+	if value := os.Getenv("BLUEPRINT_DB_CONNECT_TIMEOUT"); value != "" {
+		timeout, err := time.ParseDuration(value)
+		if err != nil || timeout < 0 {
+			return config, fmt.Errorf("invalid BLUEPRINT_DB_CONNECT_TIMEOUT %q", value)
+		}
+		config.Timeout = timeout
+	}
+	if value := os.Getenv("BLUEPRINT_DB_CONNECT_BACKOFF"); value != "" {
+		backoff, err := time.ParseDuration(value)
+		if err != nil || backoff <= 0 {
+			return config, fmt.Errorf("invalid BLUEPRINT_DB_CONNECT_BACKOFF %q", value)
+		}
+		config.Backoff = backoff
+	}
+	return config, nil
+}
+
+// connect pings the database until it answers, waiting exponentially longer
+// between attempts. It returns the last error once the timeout is reached.
+func connect(ctx context.Context, db *sql.DB, config retryConfig, logger *slog.Logger) error {
+	if config.Timeout == 0 {
+		return db.PingContext(ctx)
+	}
+	ctx, cancel := context.WithTimeout(ctx, config.Timeout)
+	defer cancel()
+
+	backoff := config.Backoff
+	for attempt := 1; ; attempt++ {
+		err := db.PingContext(ctx)
+		if err == nil {
+			return nil
+		}
+
+		deadline, _ := ctx.Deadline()
+		if time.Until(deadline) < backoff {
+			return fmt.Errorf("database unreachable after %d attempts: %v", attempt, err)
+		}
+		logger.Warn("Database unreachable, retrying", "backoff", backoff, "err", err)
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return fmt.Errorf("database unreachable after %d attempts: %v", attempt, err)
+		}
+		backoff = min(backoff*2, config.MaxBackoff)
+	}
+}
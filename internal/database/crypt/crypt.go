@@ -0,0 +1,148 @@
+// Package crypt encrypts sensitive column values with AES-256-GCM. Every
+// ciphertext carries the id of its key, so keys can be rotated: new values
+// are encrypted with the active key, while the older keys of the keyring
+// still decrypt the values written before the rotation.
+//
+// Values are stored as "enc:<key id>:<base64 nonce and ciphertext>". Values
+// without the prefix are plaintext written before encryption was enabled,
+// and are returned as they are until they are re-encrypted.
+package crypt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// prefix marks encrypted values.
+const prefix = "enc:"
+
+var (
+	// ErrUnknownKey is returned when decrypting a value encrypted with a key
+	// missing from the keyring.
+	ErrUnknownKey = errors.New("crypt: value encrypted with an unknown key")
+
+	// ErrDecrypt is returned for corrupted values, or values moved to
+	// another column than the one they were encrypted for.
+	ErrDecrypt = errors.New("crypt: cannot decrypt value")
+)
+
+// keyID matches valid key ids, short enough for the ciphertext of a value
+// to fit the VARCHAR(255) columns of MySQL.
+var keyID = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,32}$`)
+
+// Keyring encrypts with its active key and decrypts with any of its keys.
+// A nil Keyring leaves values in plaintext.
+type Keyring struct {
+	active string
+	keys   map[string]cipher.AEAD
+}
+
+// NewKeyring returns a keyring of 32-byte keys by id, encrypting with the
+// active one. Keys kept by a KMS are decrypted by the caller and passed here.
+func NewKeyring(active string, keys map[string][]byte) (*Keyring, error) {
+	if _, ok := keys[active]; !ok {
+		return nil, fmt.Errorf("crypt: active key %q is not in the keyring", active)
+	}
+	k := &Keyring{active: active, keys: map[string]cipher.AEAD{}}
+	for id, key := range keys {
+		if !keyID.MatchString(id) {
+			return nil, fmt.Errorf("crypt: invalid key id %q, use up to 32 letters, digits, '.', '_' or '-'", id)
+		}
+		if len(key) != 32 {
+			return nil, fmt.Errorf("crypt: key %q must be 32 bytes, got %d", id, len(key))
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		if k.keys[id], err = cipher.NewGCM(block); err != nil {
+			return nil, err
+		}
+	}
+	return k, nil
+}
+
+// ParseKeyring parses a comma-separated list of "id:base64 key" pairs, the
+// first key being the active one. It returns a nil keyring for an empty list.
+func ParseKeyring(value string) (*Keyring, error) {
+	if strings.TrimSpace(value) == "" {
+		return nil, nil
+	}
+	var active string
+	keys := map[string][]byte{}
+	for _, pair := range strings.Split(value, ",") {
+		id, encoded, ok := strings.Cut(strings.TrimSpace(pair), ":")
+		if !ok {
+			return nil, fmt.Errorf("crypt: invalid key %q, use id:base64 key", id)
+		}
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("crypt: invalid base64 for key %q: %v", id, err)
+		}
+		if active == "" {
+			active = id
+		}
+		keys[id] = key
+	}
+	return NewKeyring(active, keys)
+}
+
+// Encrypt encrypts a value with the active key. The column, like
+// "users.totp_secret", is authenticated with the value, so a ciphertext
+// copied to another column does not decrypt.
+func (k *Keyring) Encrypt(plaintext string, column string) (string, error) {
+	if k == nil {
+		return plaintext, nil
+	}
+	aead := k.keys[k.active]
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(plaintext), []byte(column))
+	return prefix + k.active + ":" + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt decrypts a value encrypted for a column. Plaintext values are
+// returned as they are.
+func (k *Keyring) Decrypt(value string, column string) (string, error) {
+	rest, encrypted := strings.CutPrefix(value, prefix)
+	if !encrypted {
+		return value, nil
+	}
+	id, encoded, ok := strings.Cut(rest, ":")
+	if !ok {
+		return "", ErrDecrypt
+	}
+	if k == nil {
+		return "", ErrUnknownKey
+	}
+	aead, ok := k.keys[id]
+	if !ok {
+		return "", ErrUnknownKey
+	}
+	sealed, err := base64.RawStdEncoding.DecodeString(encoded)
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return "", ErrDecrypt
+	}
+	plaintext, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], []byte(column))
+	if err != nil {
+		return "", ErrDecrypt
+	}
+	return string(plaintext), nil
+}
+
+// Stale reports whether a value is not encrypted with the active key, and
+// must be re-encrypted to retire the older keys.
+func (k *Keyring) Stale(value string) bool {
+	if k == nil {
+		return false
+	}
+	return !strings.HasPrefix(value, prefix+k.active+":")
+}
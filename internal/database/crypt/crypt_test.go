@@ -0,0 +1,85 @@
+package crypt
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func key(b byte) string {
+	return base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{b}, 32))
+}
+
+func TestEncryptDecryptRoundTrip(t *testing.T) {
+	k, err := ParseKeyring("k1:" + key(1))
+	if err != nil {
+		t.Fatalf("error parsing keyring. Err: %v", err)
+	}
+	ciphertext, err := k.Encrypt("JBSWY3DPEHPK3PXP", "users.totp_secret")
+	if err != nil {
+		t.Fatalf("error encrypting. Err: %v", err)
+	}
+	if !strings.HasPrefix(ciphertext, "enc:k1:") || strings.Contains(ciphertext, "JBSWY3DPEHPK3PXP") {
+		t.Errorf("unexpected ciphertext %q", ciphertext)
+	}
+	if len(ciphertext) > 255 {
+		t.Errorf("expected the ciphertext to fit VARCHAR(255); got %d characters", len(ciphertext))
+	}
+
+	plaintext, err := k.Decrypt(ciphertext, "users.totp_secret")
+	if err != nil || plaintext != "JBSWY3DPEHPK3PXP" {
+		t.Errorf("expected the secret back; got %q, %v", plaintext, err)
+	}
+	if _, err := k.Decrypt(ciphertext, "users.email"); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("expected a value of another column to be rejected; got %v", err)
+	}
+}
+
+func TestDecryptAfterRotation(t *testing.T) {
+	old, _ := ParseKeyring("k1:" + key(1))
+	ciphertext, _ := old.Encrypt("secret", "c")
+
+	rotated, err := ParseKeyring("k2:" + key(2) + ",k1:" + key(1))
+	if err != nil {
+		t.Fatalf("error parsing keyring. Err: %v", err)
+	}
+	if !rotated.Stale(ciphertext) {
+		t.Errorf("expected a value of the old key to be stale")
+	}
+	if plaintext, err := rotated.Decrypt(ciphertext, "c"); err != nil || plaintext != "secret" {
+		t.Errorf("expected the old key to still decrypt; got %q, %v", plaintext, err)
+	}
+	reencrypted, _ := rotated.Encrypt("secret", "c")
+	if rotated.Stale(reencrypted) {
+		t.Errorf("expected a value of the active key not to be stale")
+	}
+
+	retired, _ := ParseKeyring("k2:" + key(2))
+	if _, err := retired.Decrypt(ciphertext, "c"); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("expected an unknown key error; got %v", err)
+	}
+}
+
+func TestPlaintextPassesThrough(t *testing.T) {
+	var k *Keyring
+	if value, err := k.Encrypt("secret", "c"); err != nil || value != "secret" {
+		t.Errorf("expected a nil keyring to keep plaintext; got %q, %v", value, err)
+	}
+	k, _ = ParseKeyring("k1:" + key(1))
+	if value, err := k.Decrypt("legacy", "c"); err != nil || value != "legacy" {
+		t.Errorf("expected plaintext written before encryption back; got %q, %v", value, err)
+	}
+	if !k.Stale("legacy") {
+		t.Errorf("expected plaintext to be stale")
+	}
+}
+
+func TestParseKeyringRejectsInvalidKeys(t *testing.T) {
+	for _, value := range []string{"k1", "k1:not base64", "k1:" + base64.StdEncoding.EncodeToString([]byte("short")), "bad id:" + key(1)} {
+		if _, err := ParseKeyring(value); err == nil {
+			t.Errorf("expected an error for %q", value)
+		}
+	}
+}
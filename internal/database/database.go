@@ -4,189 +4,751 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
-	"log"
+	"io"
+	"log/slog"
+	"net/url"
 	"os"
 	"strconv"
+	"strings"
+	"sync/atomic"
 	"time"
 
+	"github.com/raziel-aleman/go-starter/internal/database/crypt"
+	"github.com/raziel-aleman/go-starter/internal/database/fixtures"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
 	_ "github.com/joho/godotenv/autoload"
 	_ "github.com/mattn/go-sqlite3"
 )
 
 // Service represents a service that interacts with a database.
 type Service interface {
-	// Health returns a map of health status information.
-	// The keys and values in the map are service-specific.
-	Health() map[string]string
+	// Health checks the database and its connection pool. It reports
+	// problems in the returned status, and never terminates the program.
+	Health(ctx context.Context) HealthStatus
+
+	// WriteMetrics writes the connection pool statistics, and the counters
+	// and latency histograms of the queries, in the Prometheus text format.
+	WriteMetrics(w io.Writer) error
+
+	// Backup writes a consistent snapshot of a SQLite database to a new file
+	// while it is in use. It returns ErrBackupUnsupported for other databases.
+	Backup(ctx context.Context, dst string) error
+
+	// RotateEncryptionKeys re-encrypts the encrypted columns written with an
+	// older key, or in plaintext, with the active key, and returns the
+	// number of values updated. The older keys can be retired afterwards.
+	RotateEncryptionKeys(ctx context.Context) (int64, error)
+
+	// LoadFixtures inserts the rows of fixture sets in one transaction,
+	// ordering the tables by their foreign keys and hashing user passwords.
+	LoadFixtures(ctx context.Context, sets ...fixtures.Set) error
 
 	// Close terminates the database connection.
 	// It returns an error if the connection cannot be closed.
 	Close() error
 
-	// RegisterUser inserts a new user into the users table.
-	// It returns an error if a user cannot be inserted.
-	RegisterUser(string, []byte) (sql.Result, error)
+	// Migrate applies the pending schema migrations.
+	Migrate(ctx context.Context) error
+
+	// MigrateTo applies or reverts schema migrations until the schema is at version.
+	MigrateTo(ctx context.Context, version int) error
+
+	// CheckSchema compares the live schema with the one the applied
+	// migrations create, and returns their differences.
+	CheckSchema(ctx context.Context) ([]string, error)
+
+	// WithTx runs fn in a transaction, for application queries that must be
+	// atomic with each other. It commits if fn returns nil and rolls back otherwise.
+	// fn runs again if the transaction fails on a locked SQLite database.
+	WithTx(ctx context.Context, fn func(tx Tx) error) error
+
+	// UserRepository queries and updates user accounts.
+	UserRepository
+
+	// SessionRepository persists HTTP sessions.
+	SessionRepository
+
+	// CreateInvitation stores the hash of a new invitation code.
+	CreateInvitation(ctx context.Context, codeHash string, invitation Invitation) error
+
+	// RegisterInvitedUser uses an invitation and inserts the new user in the same transaction.
+	RegisterInvitedUser(ctx context.Context, codeHash string, username string, email string, hashedPassword []byte) (string, error)
+
+	// CreateVerificationToken stores the hash of an email verification token for a user.
+	CreateVerificationToken(ctx context.Context, username string, tokenHash string, expiresAt time.Time) error
+
+	// ConsumeVerificationToken deletes a verification token and marks the
+	// email of its user as verified. It returns the username.
+	ConsumeVerificationToken(ctx context.Context, tokenHash string) (string, error)
+
+	// IsVerified reports whether the email of a user has been verified.
+	IsVerified(ctx context.Context, username string) (bool, error)
+
+	// SetTOTPSecret stores a pending TOTP secret for a user, replacing any
+	// previous pending one. The enabled secret, if any, stays in use until
+	// the pending one is confirmed.
+	SetTOTPSecret(ctx context.Context, username string, secret string) error
+
+	// PendingTOTPSecret returns the pending TOTP secret of a user, "" if none.
+	PendingTOTPSecret(ctx context.Context, username string) (string, error)
+
+	// EnableTOTP replaces the TOTP secret of a user with the pending one,
+	// enables two-factor authentication and replaces the recovery code hashes.
+	EnableTOTP(ctx context.Context, username string, recoveryCodeHashes []string) error
+
+	// TOTPSecret returns the TOTP secret of a user and whether it is enabled.
+	TOTPSecret(ctx context.Context, username string) (string, bool, error)
+
+	// UseTOTPStep records the time step of an accepted TOTP code. It returns
+	// false if a code of that step or a later one was already accepted.
+	UseTOTPStep(ctx context.Context, username string, step int64) (bool, error)
+
+	// UseRecoveryCode deletes a recovery code of a user.
+	// It returns false if the code does not exist.
+	UseRecoveryCode(ctx context.Context, username string, codeHash string) (bool, error)
+
+	// CreateMagicLink stores the hash of a login link token for a user.
+	CreateMagicLink(ctx context.Context, username string, tokenHash string, expiresAt time.Time) error
+
+	// CountMagicLinks returns the number of login links created for a user since the given time.
+	CountMagicLinks(ctx context.Context, username string, since time.Time) (int, error)
+
+	// ConsumeMagicLink deletes a login link token and returns the username.
+	ConsumeMagicLink(ctx context.Context, tokenHash string) (string, error)
+
+	// AssignRole grants a role to an existing user. Assigning a role twice is a no-op.
+	AssignRole(ctx context.Context, username string, role string) error
+
+	// RemoveRole revokes a role from a user.
+	RemoveRole(ctx context.Context, username string, role string) error
+
+	// UserRoles returns the roles of a user.
+	UserRoles(ctx context.Context, username string) ([]string, error)
+
+	// HasRole reports whether a user has been granted a role.
+	HasRole(ctx context.Context, username string, role string) (bool, error)
+
+	// GrantPermission allows a role to perform an action on a resource.
+	GrantPermission(ctx context.Context, role string, permission Permission) error
+
+	// RevokePermission removes a permission from a role.
+	RevokePermission(ctx context.Context, role string, permission Permission) error
+
+	// RolePermissions returns the permissions granted to a role.
+	RolePermissions(ctx context.Context, role string) ([]Permission, error)
+
+	// UserHasPermission reports whether any role of a user grants the permission.
+	UserHasPermission(ctx context.Context, username string, permission Permission) (bool, error)
+
+	// CreateAPIKey stores the hash of a new API key for a user and returns its id.
+	CreateAPIKey(ctx context.Context, username string, name string, prefix string, keyHash string, scopes []string) (int64, error)
+
+	// APIKeys returns the API keys of a user, including revoked ones.
+	APIKeys(ctx context.Context, username string) ([]APIKey, error)
+
+	// RevokeAPIKey revokes an API key owned by a user.
+	RevokeAPIKey(ctx context.Context, username string, id int64) error
+
+	// RevokeUserAPIKeys revokes every active API key of a user.
+	RevokeUserAPIKeys(ctx context.Context, username string) error
+
+	// AuthenticateAPIKey returns the owner and scopes of an active API key and records its use.
+	AuthenticateAPIKey(ctx context.Context, keyHash string) (string, []string, error)
+
+	// SaveRefreshToken stores the hash of a refresh token.
+	SaveRefreshToken(ctx context.Context, tokenHash string, token RefreshToken) error
+
+	// UseRefreshToken marks a refresh token as used and returns it as it was before.
+	UseRefreshToken(ctx context.Context, tokenHash string) (RefreshToken, error)
+
+	// FindRefreshToken returns a refresh token by hash.
+	FindRefreshToken(ctx context.Context, tokenHash string) (RefreshToken, error)
+
+	// RevokeRefreshTokenFamily deletes every refresh token of a family.
+	RevokeRefreshTokenFamily(ctx context.Context, family string) error
+
+	// RevokeUserRefreshTokens deletes every refresh token of a user.
+	RevokeUserRefreshTokens(ctx context.Context, username string) error
+
+	// CreateOAuthClient registers an OAuth client.
+	CreateOAuthClient(ctx context.Context, client OAuthClient) error
+
+	// OAuthClient returns a registered OAuth client by id.
+	OAuthClient(ctx context.Context, id string) (OAuthClient, error)
+
+	// SaveOAuthCode stores the hash of an authorization code.
+	SaveOAuthCode(ctx context.Context, codeHash string, code OAuthCode) error
+
+	// UseOAuthCode deletes an authorization code and returns it.
+	UseOAuthCode(ctx context.Context, codeHash string) (OAuthCode, error)
+
+	// RecordAuthEvent appends an event to the authentication audit log.
+	RecordAuthEvent(ctx context.Context, event AuthEvent) error
+
+	// AuthEvents returns audit log events matching the filter, newest first.
+	AuthEvents(ctx context.Context, filter AuthEventFilter) ([]AuthEvent, error)
+
+	// LinkIdentity links an external identity to a user.
+	LinkIdentity(ctx context.Context, identity Identity) error
 
-	// VerifyCredentials checks a user exists in the users table
-	// and retrieves the hashed password.
-	VerifyCredentials(string) ([]byte, error)
+	// FindIdentity returns the identity of a provider subject, with the user it is linked to.
+	FindIdentity(ctx context.Context, provider string, subject string) (Identity, error)
 
-	// UserExists check a user exists in the users table.
-	UserExists(string) error
+	// UserIdentities returns the identities linked to a user.
+	UserIdentities(ctx context.Context, username string) ([]Identity, error)
+
+	// UnlinkIdentity removes the identity of a provider from a user.
+	UnlinkIdentity(ctx context.Context, username string, provider string) error
+
+	// AddWebAuthnCredential stores a passkey registered by a user.
+	AddWebAuthnCredential(ctx context.Context, credential WebAuthnCredential) error
+
+	// WebAuthnCredentials returns the passkeys of a user.
+	WebAuthnCredentials(ctx context.Context, username string) ([]WebAuthnCredential, error)
+
+	// FindWebAuthnCredential returns a passkey by credential id.
+	FindWebAuthnCredential(ctx context.Context, id []byte) (WebAuthnCredential, error)
+
+	// UpdateWebAuthnSignCount records the signature counter of a passkey after a login.
+	UpdateWebAuthnSignCount(ctx context.Context, id []byte, signCount uint32) error
 }
 
 type service struct {
-	db *sql.DB
+	db           *conn
+	replicas     []*replica // Read-only pools of the listings, see reader
+	nextReplica  atomic.Uint64
+	stopReplicas context.CancelFunc
+	stopUpkeep   context.CancelFunc // Stops the scheduled maintenance of SQLite files
+	keys         *crypt.Keyring     // Encrypts the sensitive columns, nil to store them in plaintext
 }
 
 var (
-	// db url parameters for WAL mode, timeout for concurrent writes, and for foreing key checking
-	dburl      = os.Getenv("BLUEPRINT_DB_URL") + "?_journal=WAL&_timeout=5000&_fk=true"
+	// Database driver, sqlite3 (default), libsql for Turso, pgx for PostgreSQL, or mysql for MySQL and MariaDB
+	driver = os.Getenv("BLUEPRINT_DB_DRIVER")
+	// File path for SQLite, connection URL for libsql and PostgreSQL, DSN for MySQL
+	dburl = os.Getenv("BLUEPRINT_DB_URL")
+	// User id type, integer (default) or uuid for UUIDv7 text ids, for apps exposing ids publicly
+	idType     = os.Getenv("BLUEPRINT_DB_ID_TYPE")
 	dbInstance *service
 )
 
-func New() Service {
+// New connects to the database, waiting for it to accept connections, and
+// brings its schema up to date. It returns an error if the configuration is
+// invalid, the database is still unreachable after BLUEPRINT_DB_CONNECT_TIMEOUT
+// (default 30s), or a migration fails.
+func New() (Service, error) {
 	// Reuse Connection
 	if dbInstance != nil {
-		return dbInstance
+		return dbInstance, nil
+	}
+
+	// The SQL dialect of the queries, libsql speaks SQLite
+	dsn, dialect := dburl, driver
+	switch driver {
+	case DriverPostgres:
+	case DriverMySQL:
+		var err error
+		if dsn, err = mysqlDSN(dburl); err != nil {
+			return nil, err
+		}
+	case "", DriverSQLite:
+		driver, dialect = DriverSQLite, DriverSQLite
+		// db url parameters for WAL mode, timeout for concurrent writes, for foreing key checking,
+		// and for new database files to return free pages on incremental vacuums
+		dsn = dburl + "?_journal=WAL&_timeout=5000&_fk=true&_auto_vacuum=incremental"
+	case DriverLibSQL:
+		dialect = DriverSQLite
+		var err error
+		if dsn, err = libsqlDSN(dburl, os.Getenv("BLUEPRINT_DB_AUTH_TOKEN")); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported database driver %q, use %s, %s, %s or %s", driver, DriverSQLite, DriverLibSQL, DriverPostgres, DriverMySQL)
+	}
+
+	switch idType {
+	case "", IDInteger, IDUUID:
+	default:
+		return nil, fmt.Errorf("unsupported id type %q, use %s or %s", idType, IDInteger, IDUUID)
+	}
+
+	retry, err := retryConfigFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	replicaConfig, err := replicaConfigFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	pool, err := poolConfigFromEnv(driver)
+	if err != nil {
+		return nil, err
+	}
+	maintenance, err := maintenanceConfigFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	busy, err := busyConfigFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	timeouts, err := timeoutConfigFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	keys, err := crypt.ParseKeyring(os.Getenv("BLUEPRINT_DB_ENCRYPTION_KEYS"))
+	if err != nil {
+		return nil, err
 	}
 
-	db, err := sql.Open("sqlite3", dburl)
+	// The default logger when the service is created, e.g. set by the server
+	logger := slog.Default().With("component", "database")
+
+	db, err := sql.Open(driver, dsn)
 	if err != nil {
 		// This will not be a connection error, but a DSN parse error or
 		// another initialization error.
-		log.Fatal(err)
+		return nil, err
 	}
+	pool.apply(db)
 
-	err = Init(db)
-	if err != nil {
-		log.Fatal(err)
+	// The database may start after the application, e.g. in containers
+	if err := connect(context.Background(), db, retry, logger); err != nil {
+		db.Close()
+		return nil, err
 	}
 
-	dbInstance = &service{
-		db: db,
+	s := &service{
+		db:   &conn{DB: db, driver: dialect, timeouts: timeouts, logger: logger},
+		keys: keys,
+	}
+	// Writers of SQLite databases wait for each other, other databases lock rows
+	if dialect == DriverSQLite {
+		s.db.busy = busy
 	}
-	return dbInstance
-}
 
-func Init(db *sql.DB) error {
-	// Users table initialization query if it does not exist
-	const createUsersTable string = `CREATE TABLE IF NOT EXISTS users (
-		id INTEGER NOT NULL PRIMARY KEY,
-		username TEXT NOT NULL UNIQUE,
-		password BLOB NOT NULL
-	);`
+	// Bring the schema up to date
+	if err := s.Migrate(context.Background()); err != nil {
+		db.Close()
+		return nil, err
+	}
 
-	// Execute initialization query
-	if _, err := db.Exec(createUsersTable); err != nil {
-		return fmt.Errorf("error creating User table: %v", err)
+	// Detect tables, columns and indexes changed by hand: warn (default), fail, or off
+	if mode := os.Getenv("BLUEPRINT_DB_SCHEMA_CHECK"); mode != "off" {
+		diff, err := s.CheckSchema(context.Background())
+		switch {
+		case err != nil:
+			logger.Warn("Schema drift check skipped", "err", err)
+		case len(diff) > 0 && mode == "fail":
+			db.Close()
+			return nil, fmt.Errorf("schema differs from the migrations:\n%s", strings.Join(diff, "\n"))
+		case len(diff) > 0:
+			logger.Warn("Schema differs from the migrations", "diff", strings.Join(diff, "\n"))
+		}
 	}
 
-	// Sessions table initializaiton query if it does not exist
-	const createSessionsTable string = `CREATE TABLE IF NOT EXISTS sessions (
-		id INTEGER NOT NULL PRIMARY KEY,
-		sessionId TEXT NOT NULL,
-		createdAt TEXT NOT NULL,
-		lastActive TEXT NOT NULL,
-		data BLOB NOT NULL
-	);`
+	// Listings are read from the replicas, if any, while their lag is acceptable
+	if s.replicas, err = openReplicas(dialect, replicaConfig, pool); err != nil {
+		db.Close()
+		return nil, err
+	}
+	for _, r := range s.replicas {
+		r.timeouts = timeouts
+		r.logger = logger.With("replica", r.name)
+	}
+	if len(s.replicas) > 0 {
+		ctx, cancel := context.WithCancel(context.Background())
+		s.stopReplicas = cancel
+		checkReplicas(ctx, s.replicas, replicaConfig.MaxLag)
+		go monitorReplicas(ctx, s.replicas, replicaConfig)
+	}
 
-	// Execute initialization query
-	if _, err := db.Exec(createSessionsTable); err != nil {
-		return fmt.Errorf("error creating Sessions table: %v", err)
+	// Keep the write-ahead log and free pages of SQLite files from growing unbounded
+	if driver == DriverSQLite && maintenance.Interval > 0 {
+		ctx, cancel := context.WithCancel(context.Background())
+		s.stopUpkeep = cancel
+		go runMaintenance(ctx, s.db, maintenance)
 	}
 
-	return nil
+	dbInstance = s
+	return dbInstance, nil
 }
 
-// Health checks the health of the database connection by pinging the database.
-// It returns a map with keys indicating various health statistics.
-func (s *service) Health() map[string]string {
-	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
-	defer cancel()
+// NewService creates a Service running queries on an open connection pool
+// of the given driver. Unlike New, it does not read the environment, wait for
+// the database, or migrate it.
+func NewService(db *sql.DB, driver string) Service {
+	if driver == DriverLibSQL {
+		driver = DriverSQLite
+	}
+	return &service{db: &conn{DB: db, driver: driver}}
+}
+
+// Close closes the database connection.
+// It logs a message indicating the disconnection from the specific database.
+// If the connection is successfully closed, it returns nil.
+// If an error occurs while closing the connection, it returns the error.
+func (s *service) Close() error {
+	dsn := redactURL(dburl)
+	if s.db.driver == DriverMySQL {
+		dsn = redactMySQLDSN(dburl)
+	}
+	if s.stopReplicas != nil {
+		s.stopReplicas()
+	}
+	if s.stopUpkeep != nil {
+		s.stopUpkeep()
+	}
+	closeReplicas(s.replicas)
+	s.db.log().Info("Disconnected from database", "dsn", dsn)
+	return s.db.Close()
+}
+
+// redactURL hides the password of a connection URL, so it can be logged.
+func redactURL(dsn string) string {
+	u, err := url.Parse(dsn)
+	if err != nil || u.User == nil {
+		return dsn
+	}
+	return u.Redacted()
+}
 
-	stats := make(map[string]string)
+// RegisterUser inserts a new user with an optional email into the users table
+// and returns its id. It returns an error if a user cannot be inserted.
+func (s *service) RegisterUser(ctx context.Context, username string, email string, hashedPassword []byte) (string, error) {
+	var id string
+	err := s.withTx(ctx, func(t *tx) error {
+		var err error
+		id, err = insertUser(ctx, t, username, email, hashedPassword)
+		return err
+	})
+	return id, err
+}
 
-	// Ping the database
-	err := s.db.PingContext(ctx)
+// insertUser inserts a new user with an optional email in a transaction and returns its id.
+// Every user gets a UUID, so the id type can be switched to uuid later.
+func insertUser(ctx context.Context, t *tx, username string, email string, hashedPassword []byte) (string, error) {
+	now := time.Now().UTC().Format(time.RFC3339)
+	uuid := NewUUIDv7()
+	id, err := insertID(ctx, t, t.driver,
+		"INSERT INTO users (tenant_id, uuid, username, email, password, password_changed_at, created_at, updated_at) VALUES (?, ?, ?, NULLIF(?, ''), ?, ?, ?, ?)",
+		tenantOf(ctx),
+		uuid,
+		username,
+		normalizeEmail(email),
+		hashedPassword,
+		now,
+		now,
+		now,
+	)
 	if err != nil {
-		stats["status"] = "down"
-		stats["error"] = fmt.Sprintf("db down: %v", err)
-		log.Fatalf("db down: %v", err) // Log the error and terminate the program
-		return stats
+		return "", err
 	}
+	return userID(id, sql.NullString{String: uuid, Valid: true}), nil
+}
 
-	// Database is up, add more statistics
-	stats["status"] = "up"
-	stats["message"] = "It's healthy"
+// userID returns the id of a user exposed by the service, its UUID with
+// BLUEPRINT_DB_ID_TYPE=uuid or its integer id otherwise. Users created before
+// the uuid column was added have none.
+func userID(id int64, uuid sql.NullString) string {
+	if idType == IDUUID {
+		return uuid.String
+	}
+	return strconv.FormatInt(id, 10)
+}
+
+// VerifyCredentials checks a user exists in the users table with the login
+// as username, in any case, or failing that as email address. If the user exists, it
+// retrieves the username and hashed password.
+func (s *service) VerifyCredentials(ctx context.Context, login string) (string, []byte, error) {
+	ctx, cancel := s.db.readContext(ctx)
+	defer cancel()
+	var username string
+	var passwordInDB []byte
+	query, args := andTenant(ctx,
+		"SELECT username, password FROM users WHERE ("+s.db.equalFold("username")+" OR email = ?) AND deleted_at IS NULL",
+		login,
+		normalizeEmail(login),
+	)
+	err := s.db.prepared().QueryRowContext(ctx,
+		query+" ORDER BY "+s.db.equalFold("username")+" DESC LIMIT 1",
+		append(args, login)...,
+	).Scan(&username, &passwordInDB)
 
-	// Get database stats (like open connections, in use, idle, etc.)
-	dbStats := s.db.Stats()
-	stats["open_connections"] = strconv.Itoa(dbStats.OpenConnections)
-	stats["in_use"] = strconv.Itoa(dbStats.InUse)
-	stats["idle"] = strconv.Itoa(dbStats.Idle)
-	stats["wait_count"] = strconv.FormatInt(dbStats.WaitCount, 10)
-	stats["wait_duration"] = dbStats.WaitDuration.String()
-	stats["max_idle_closed"] = strconv.FormatInt(dbStats.MaxIdleClosed, 10)
-	stats["max_lifetime_closed"] = strconv.FormatInt(dbStats.MaxLifetimeClosed, 10)
+	return username, passwordInDB, err
+}
+
+// CanonicalUsername returns a username as stored, matching it
+// case-insensitively. It returns sql.ErrNoRows if the user does not exist.
+func (s *service) CanonicalUsername(ctx context.Context, username string) (string, error) {
+	ctx, cancel := s.db.readContext(ctx)
+	defer cancel()
+	var canonical string
+	query, args := andTenant(ctx,
+		"SELECT username FROM users WHERE "+s.db.equalFold("username")+" AND deleted_at IS NULL",
+		username,
+	)
+	err := s.db.QueryRowContext(ctx, query, args...).Scan(&canonical)
+	return canonical, err
+}
+
+// normalizeEmail lowercases and trims an email address, so addresses are
+// stored and matched regardless of how they were typed.
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// UserExists reports whether a user exists in the users table. Deleted users
+// do not exist, and the error is only set when the database cannot be queried.
+func (s *service) UserExists(ctx context.Context, username string) (bool, error) {
+	ctx, cancel := s.db.readContext(ctx)
+	defer cancel()
+	var exists bool
+	query, args := andTenant(ctx,
+		"SELECT 1 FROM users WHERE username = ? AND deleted_at IS NULL",
+		username,
+	)
+	err := s.db.QueryRowContext(ctx, "SELECT EXISTS("+query+")", args...).Scan(&exists)
+	return exists, err
+}
 
-	// Evaluate stats to provide a health message
-	if dbStats.OpenConnections > 40 { // Assuming 50 is the max for this example
-		stats["message"] = "The database is experiencing heavy load."
+// SetPasswordHash replaces the password hash of a user, fulfilling any
+// required password reset.
+func (s *service) SetPasswordHash(ctx context.Context, username string, hash []byte) error {
+	now := time.Now().UTC().Format(time.RFC3339)
+	query, args := andTenant(ctx,
+		"UPDATE users SET password = ?, password_reset_required = 0, password_changed_at = ?, updated_at = ? WHERE username = ? AND deleted_at IS NULL",
+		hash,
+		now,
+		now,
+		username,
+	)
+	_, err := s.db.ExecContext(ctx, query, args...)
+	return err
+}
+
+// UpdatePasswordHash replaces the password hash of a user if it still matches
+// oldHash. The comparison and update happen in a single statement, so a
+// password changed concurrently is never overwritten.
+func (s *service) UpdatePasswordHash(ctx context.Context, username string, oldHash []byte, newHash []byte) error {
+	query, args := andTenant(ctx,
+		"UPDATE users SET password = ?, updated_at = ? WHERE username = ? AND password = ? AND deleted_at IS NULL",
+		newHash,
+		time.Now().UTC().Format(time.RFC3339),
+		username,
+		oldHash,
+	)
+	_, err := s.db.ExecContext(ctx, query, args...)
+	return err
+}
+
+// ProvisionUser inserts a user unless the username is already taken.
+func (s *service) ProvisionUser(ctx context.Context, username string, hashedPassword []byte) error {
+	now := time.Now().UTC().Format(time.RFC3339)
+	_, err := s.db.ExecContext(ctx,
+		"INSERT INTO users (tenant_id, uuid, username, password, password_changed_at, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?)"+s.db.ignoreConflict("username"),
+		tenantOf(ctx),
+		NewUUIDv7(),
+		username,
+		hashedPassword,
+		now,
+		now,
+		now,
+	)
+	return err
+}
+
+// CreateVerificationToken stores the hash of an email verification token for a user.
+func (s *service) CreateVerificationToken(ctx context.Context, username string, tokenHash string, expiresAt time.Time) error {
+	_, err := s.db.ExecContext(ctx,
+		"INSERT INTO email_verifications (token_hash, username, expires_at) VALUES (?, ?, ?)",
+		tokenHash,
+		username,
+		expiresAt.UTC().Format(time.RFC3339),
+	)
+	return err
+}
+
+// ConsumeVerificationToken deletes a verification token and marks the email of
+// its user as verified. Expired tokens are deleted and return sql.ErrNoRows.
+func (s *service) ConsumeVerificationToken(ctx context.Context, tokenHash string) (string, error) {
+	tx, err := s.db.BeginTx(ctx)
+	if err != nil {
+		return "", err
 	}
+	defer tx.Rollback()
 
-	if dbStats.WaitCount > 1000 {
-		stats["message"] = "The database has a high number of wait events, indicating potential bottlenecks."
+	var username, expiresAt string
+	err = tx.QueryRowContext(ctx,
+		"SELECT username, expires_at FROM email_verifications WHERE token_hash = ?",
+		tokenHash,
+	).Scan(&username, &expiresAt)
+	if err != nil {
+		return "", err
+	}
+	// Only one caller can delete the token, a concurrent consumer gets sql.ErrNoRows
+	if err := affectOne(ctx, tx, "DELETE FROM email_verifications WHERE token_hash = ?", tokenHash); err != nil {
+		return "", err
 	}
 
-	if dbStats.MaxIdleClosed > int64(dbStats.OpenConnections)/2 {
-		stats["message"] = "Many idle connections are being closed, consider revising the connection pool settings."
+	expiry, err := time.Parse(time.RFC3339, expiresAt)
+	if err != nil {
+		return "", err
+	}
+	if time.Now().After(expiry) {
+		// Commit the deletion of the expired token
+		if err := tx.Commit(); err != nil {
+			return "", err
+		}
+		return "", sql.ErrNoRows
 	}
 
-	if dbStats.MaxLifetimeClosed > int64(dbStats.OpenConnections)/2 {
-		stats["message"] = "Many connections are being closed due to max lifetime, consider increasing max lifetime or revising the connection usage pattern."
+	now := time.Now().UTC().Format(time.RFC3339)
+	query, args := andTenant(ctx,
+		"UPDATE users SET verified_at = ?, updated_at = ? WHERE username = ? AND deleted_at IS NULL",
+		now,
+		now,
+		username,
+	)
+	if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+		return "", err
 	}
 
-	return stats
+	return username, tx.Commit()
 }
 
-// Close closes the database connection.
-// It logs a message indicating the disconnection from the specific database.
-// If the connection is successfully closed, it returns nil.
-// If an error occurs while closing the connection, it returns the error.
-func (s *service) Close() error {
-	log.Printf("Disconnected from database: %s", dburl)
-	return s.db.Close()
+// IsVerified reports whether the email of a user has been verified.
+func (s *service) IsVerified(ctx context.Context, username string) (bool, error) {
+	ctx, cancel := s.db.readContext(ctx)
+	defer cancel()
+	var verified bool
+	query, args := andTenant(ctx,
+		"SELECT verified_at IS NOT NULL FROM users WHERE username = ? AND deleted_at IS NULL",
+		username,
+	)
+	err := s.db.QueryRowContext(ctx, query, args...).Scan(&verified)
+	return verified, err
 }
 
-// RegisterUser inserts a new user into the users table.
-// It returns an error if a user cannot be inserted.
-func (s *service) RegisterUser(username string, hashedPassword []byte) (sql.Result, error) {
-	result, err := s.db.Exec(
-		"INSERT INTO users (username, password) VALUES (?, ?)",
+// SetTOTPSecret stores a pending TOTP secret for a user, encrypted if
+// BLUEPRINT_DB_ENCRYPTION_KEYS is set. The enabled secret, if any, is left
+// untouched until EnableTOTP confirms the pending one.
+func (s *service) SetTOTPSecret(ctx context.Context, username string, secret string) error {
+	// Encrypted as the secret it becomes, so enabling it moves the ciphertext as is
+	secret, err := s.keys.Encrypt(secret, columnTOTPSecret)
+	if err != nil {
+		return err
+	}
+	query, args := andTenant(ctx,
+		"UPDATE users SET totp_pending_secret = ?, updated_at = ? WHERE username = ? AND deleted_at IS NULL",
+		secret,
+		time.Now().UTC().Format(time.RFC3339),
 		username,
-		hashedPassword,
 	)
-	return result, err
+	_, err = s.db.ExecContext(ctx, query, args...)
+	return err
 }
 
-// VerifyCredentials checks a user exists in the users table.
-// If the user exists, it retrieves the hashed password.
-func (s *service) VerifyCredentials(username string) ([]byte, error) {
-	var passwordInDB []byte
-	err := s.db.QueryRow(
-		"SELECT password FROM users WHERE username = ?",
+// PendingTOTPSecret returns the pending TOTP secret of a user, "" if none.
+func (s *service) PendingTOTPSecret(ctx context.Context, username string) (string, error) {
+	ctx, cancel := s.db.readContext(ctx)
+	defer cancel()
+	var secret sql.NullString
+	query, args := andTenant(ctx,
+		"SELECT totp_pending_secret FROM users WHERE username = ? AND deleted_at IS NULL",
+		username,
+	)
+	err := s.db.QueryRowContext(ctx, query, args...).Scan(&secret)
+	if err != nil || !secret.Valid {
+		return "", err
+	}
+	return s.keys.Decrypt(secret.String, columnTOTPSecret)
+}
+
+// EnableTOTP replaces the TOTP secret of a user with the pending one, enables
+// two-factor authentication and replaces the recovery code hashes in the same
+// transaction.
+func (s *service) EnableTOTP(ctx context.Context, username string, recoveryCodeHashes []string) error {
+	tx, err := s.db.BeginTx(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	query, args := andTenant(ctx,
+		`UPDATE users SET totp_secret = totp_pending_secret, totp_pending_secret = NULL, totp_enabled_at = ?, updated_at = ?
+		WHERE username = ? AND totp_pending_secret IS NOT NULL AND deleted_at IS NULL`,
+		now,
+		now,
 		username,
-	).Scan(&passwordInDB)
+	)
+	if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM recovery_codes WHERE username = ?", username); err != nil {
+		return err
+	}
+	for _, hash := range recoveryCodeHashes {
+		if _, err := tx.ExecContext(ctx,
+			"INSERT INTO recovery_codes (username, code_hash) VALUES (?, ?)",
+			username,
+			hash,
+		); err != nil {
+			return err
+		}
+	}
 
-	return passwordInDB, err
+	return tx.Commit()
 }
 
-// UserExists check a user exists in the users table.
-func (s *service) UserExists(username string) error {
-	err := s.db.QueryRow(
-		"SELECT EXISTS(SELECT 1 FROM users WHERE username = ?)",
+// TOTPSecret returns the TOTP secret of a user and whether it is enabled.
+func (s *service) TOTPSecret(ctx context.Context, username string) (string, bool, error) {
+	ctx, cancel := s.db.readContext(ctx)
+	defer cancel()
+	var secret sql.NullString
+	var enabled bool
+	query, args := andTenant(ctx,
+		"SELECT totp_secret, totp_enabled_at IS NOT NULL FROM users WHERE username = ? AND deleted_at IS NULL",
 		username,
-	).Scan()
-	return err
+	)
+	err := s.db.QueryRowContext(ctx, query, args...).Scan(&secret, &enabled)
+	if err != nil {
+		return "", false, err
+	}
+	plaintext, err := s.keys.Decrypt(secret.String, columnTOTPSecret)
+	return plaintext, enabled, err
+}
+
+// UseTOTPStep records the time step of an accepted TOTP code. Only one of
+// concurrent uses of a code can advance the step, the others get false.
+func (s *service) UseTOTPStep(ctx context.Context, username string, step int64) (bool, error) {
+	query, args := andTenant(ctx,
+		"UPDATE users SET totp_last_step = ? WHERE username = ? AND totp_last_step < ? AND deleted_at IS NULL",
+		step,
+		username,
+		step,
+	)
+	result, err := s.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+// UseRecoveryCode deletes a recovery code of a user.
+func (s *service) UseRecoveryCode(ctx context.Context, username string, codeHash string) (bool, error) {
+	result, err := s.db.ExecContext(ctx,
+		"DELETE FROM recovery_codes WHERE username = ? AND code_hash = ?",
+		username,
+		codeHash,
+	)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
 }
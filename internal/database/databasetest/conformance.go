@@ -0,0 +1,404 @@
+package databasetest
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/raziel-aleman/go-starter/internal/database"
+)
+
+// RunServiceTests checks that an implementation of database.Service behaves
+// like the SQL one, so tests may use either. open returns a new empty
+// service for every subtest.
+func RunServiceTests(t *testing.T, open func(t *testing.T) database.Service) {
+	ctx := context.Background()
+
+	t.Run("Users", func(t *testing.T) {
+		s := open(t)
+		id, err := s.RegisterUser(ctx, "Alice", "Alice@Example.com", []byte("hash"))
+		if err != nil || id == "" {
+			t.Fatalf("error registering user. Err: %v", err)
+		}
+		if _, err := s.RegisterUser(ctx, "alice", "other@example.com", []byte("hash")); err == nil {
+			t.Errorf("expected a username differing in case to be taken")
+		}
+		if _, err := s.RegisterUser(ctx, "bob", "alice@example.com", []byte("hash")); err == nil {
+			t.Errorf("expected an email differing in case to be taken")
+		}
+
+		for _, login := range []string{"Alice", "alice", "ALICE@example.com"} {
+			username, hash, err := s.VerifyCredentials(ctx, login)
+			if err != nil || username != "Alice" || string(hash) != "hash" {
+				t.Errorf("expected Alice for %q; got %q, %q, %v", login, username, hash, err)
+			}
+		}
+		if _, _, err := s.VerifyCredentials(ctx, "carol"); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("expected sql.ErrNoRows for an unknown user; got %v", err)
+		}
+		if username, err := s.CanonicalUsername(ctx, "aLiCe"); err != nil || username != "Alice" {
+			t.Errorf("expected the stored username; got %q, %v", username, err)
+		}
+		if exists, err := s.UserExists(ctx, "Alice"); err != nil || !exists {
+			t.Errorf("expected Alice to exist; got %v, %v", exists, err)
+		}
+		if exists, err := s.UserExists(ctx, "carol"); err != nil || exists {
+			t.Errorf("expected an unknown user not to exist; got %v, %v", exists, err)
+		}
+
+		if err := s.UpdatePasswordHash(ctx, "Alice", []byte("stale"), []byte("lost")); err != nil {
+			t.Fatalf("error updating password. Err: %v", err)
+		}
+		if err := s.UpdatePasswordHash(ctx, "Alice", []byte("hash"), []byte("new")); err != nil {
+			t.Fatalf("error updating password. Err: %v", err)
+		}
+		if _, hash, _ := s.VerifyCredentials(ctx, "Alice"); string(hash) != "new" {
+			t.Errorf("expected only the update of the current hash; got %q", hash)
+		}
+	})
+
+	t.Run("Profile", func(t *testing.T) {
+		s := open(t)
+		s.RegisterUser(ctx, "alice", "alice@example.com", []byte("hash"))
+		s.RegisterUser(ctx, "bob", "bob@example.com", []byte("hash"))
+
+		name := "Alice"
+		if err := s.UpdateUserProfile(ctx, "alice", database.ProfileUpdate{DisplayName: &name}); err != nil {
+			t.Fatalf("error updating profile. Err: %v", err)
+		}
+		if err := s.UpdateEmail(ctx, "alice", "BOB@example.com"); !errors.Is(err, database.ErrEmailTaken) {
+			t.Errorf("expected database.ErrEmailTaken; got %v", err)
+		}
+		profile, err := s.FindUserByEmail(ctx, "Alice@Example.com")
+		if err != nil || profile.Username != "alice" || profile.DisplayName != "Alice" {
+			t.Errorf("unexpected profile %+v, %v", profile, err)
+		}
+		if err := s.UpdateUserProfile(ctx, "carol", database.ProfileUpdate{DisplayName: &name}); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("expected sql.ErrNoRows for an unknown user; got %v", err)
+		}
+	})
+
+	t.Run("ListUsers", func(t *testing.T) {
+		s := open(t)
+		for _, username := range []string{"carol", "alice", "bob"} {
+			s.RegisterUser(ctx, username, username+"@example.com", []byte("hash"))
+		}
+
+		users, total, err := s.ListUsers(ctx, database.UserQuery{Page: database.Page{Limit: 2}})
+		if err != nil || total != 3 || len(users) != 2 || users[0].Username != "alice" || users[1].Username != "bob" {
+			t.Errorf("unexpected first page %+v, %d, %v", users, total, err)
+		}
+		users, _, err = s.ListUsers(ctx, database.UserQuery{Page: database.Page{Sort: "-username", Cursor: "carol"}})
+		if err != nil || len(users) != 2 || users[0].Username != "bob" {
+			t.Errorf("unexpected page after the cursor %+v, %v", users, err)
+		}
+		users, total, err = s.ListUsers(ctx, database.UserQuery{Search: "AL"})
+		if err != nil || total != 1 || len(users) != 1 || users[0].Username != "alice" {
+			t.Errorf("unexpected search results %+v, %d, %v", users, total, err)
+		}
+		if _, _, err := s.ListUsers(ctx, database.UserQuery{Page: database.Page{Sort: "password"}}); !errors.Is(err, database.ErrInvalidPage) {
+			t.Errorf("expected database.ErrInvalidPage; got %v", err)
+		}
+	})
+
+	t.Run("DeleteRestorePurge", func(t *testing.T) {
+		s := open(t)
+		s.RegisterUser(ctx, "alice", "alice@example.com", []byte("hash"))
+
+		if err := s.DeleteUser(ctx, "alice"); err != nil {
+			t.Fatalf("error deleting user. Err: %v", err)
+		}
+		if _, _, err := s.VerifyCredentials(ctx, "alice"); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("expected a deleted user to be hidden; got %v", err)
+		}
+		if exists, err := s.UserExists(ctx, "alice"); err != nil || exists {
+			t.Errorf("expected a deleted user not to exist; got %v, %v", exists, err)
+		}
+		if _, err := s.RegisterUser(ctx, "alice", "", []byte("hash")); err == nil {
+			t.Errorf("expected the username of a deleted user to stay taken")
+		}
+		if err := s.RestoreUser(ctx, "alice"); err != nil {
+			t.Fatalf("error restoring user. Err: %v", err)
+		}
+		if err := s.RestoreUser(ctx, "alice"); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("expected sql.ErrNoRows restoring an active user; got %v", err)
+		}
+
+		s.AssignRole(ctx, "alice", "editor")
+		if err := s.PurgeUser(ctx, "alice"); err != nil {
+			t.Fatalf("error purging user. Err: %v", err)
+		}
+		if _, err := s.RegisterUser(ctx, "alice", "alice@example.com", []byte("hash")); err != nil {
+			t.Errorf("expected the username of a purged user to be free; got %v", err)
+		}
+		if err := s.PurgeUser(ctx, "carol"); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("expected sql.ErrNoRows for an unknown user; got %v", err)
+		}
+
+		s.DeleteUser(ctx, "alice")
+		if n, err := s.PurgeDeletedUsers(ctx, time.Now().Add(time.Minute)); err != nil || n != 1 {
+			t.Errorf("expected one purged user; got %d, %v", n, err)
+		}
+	})
+
+	t.Run("Sessions", func(t *testing.T) {
+		s := open(t)
+		created := time.Now().Add(-time.Hour)
+		session := database.StoredSession{ID: "s1", CreatedAt: created, LastActive: created, Data: []byte("data")}
+		if err := s.SaveSession(ctx, session); err != nil {
+			t.Fatalf("error saving session. Err: %v", err)
+		}
+		session.LastActive, session.Data = time.Now(), []byte("updated")
+		if err := s.SaveSession(ctx, session); !errors.Is(err, database.ErrSessionConflict) {
+			t.Errorf("expected database.ErrSessionConflict saving an outdated version; got %v", err)
+		}
+		session.Version = 1
+		if err := s.SaveSession(ctx, session); err != nil {
+			t.Fatalf("error saving session. Err: %v", err)
+		}
+
+		stored, err := s.FindSession(ctx, "s1")
+		if err != nil || string(stored.Data) != "updated" || stored.Version != 2 || !stored.CreatedAt.Equal(created.Truncate(time.Second)) {
+			t.Errorf("unexpected session %+v, %v", stored, err)
+		}
+		if err := s.DeleteExpiredSessions(ctx, time.Now(), time.Now().Add(time.Minute)); err != nil {
+			t.Fatalf("error deleting sessions. Err: %v", err)
+		}
+		if _, err := s.FindSession(ctx, "s1"); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("expected the inactive session to be deleted; got %v", err)
+		}
+	})
+
+	t.Run("SessionOwnersAndExpiry", func(t *testing.T) {
+		s := open(t)
+		now := time.Now()
+		sessions := []database.StoredSession{
+			{ID: "s1", Username: "alice", ExpiresAt: now.Add(-time.Minute)},
+			{ID: "s2", Username: "alice", ExpiresAt: now.Add(time.Hour)},
+			{ID: "s3", Username: "bob", ExpiresAt: now.Add(time.Hour)},
+			{ID: "s4"}, // No recorded expiry
+		}
+		for _, session := range sessions {
+			session.CreatedAt, session.LastActive, session.Data = now.Add(-2*time.Hour), now.Add(-2*time.Hour), []byte("data")
+			if err := s.SaveSession(ctx, session); err != nil {
+				t.Fatalf("error saving session. Err: %v", err)
+			}
+		}
+
+		owned, err := s.FindUserSessions(ctx, "alice")
+		if err != nil || len(owned) != 2 {
+			t.Fatalf("expected 2 sessions of alice; got %+v, %v", owned, err)
+		}
+		for _, session := range owned {
+			if session.Username != "alice" || session.ExpiresAt.IsZero() {
+				t.Errorf("unexpected session %+v", session)
+			}
+		}
+
+		// Sessions idle for 2 hours are kept while their own expiry is ahead
+		if err := s.DeleteExpiredSessions(ctx, now, now.Add(-time.Hour)); err != nil {
+			t.Fatalf("error deleting sessions. Err: %v", err)
+		}
+		for id, kept := range map[string]bool{"s1": false, "s2": true, "s3": true, "s4": false} {
+			if _, err := s.FindSession(ctx, id); (err == nil) != kept {
+				t.Errorf("expected session %s kept %v; got %v", id, kept, err)
+			}
+		}
+	})
+
+	t.Run("RolesAndPermissions", func(t *testing.T) {
+		s := open(t)
+		s.RegisterUser(ctx, "alice", "", []byte("hash"))
+		s.RegisterUser(ctx, "bob", "", []byte("hash"))
+
+		if err := s.AssignRole(ctx, "alice", "admin"); err != nil {
+			t.Fatalf("error assigning role. Err: %v", err)
+		}
+		if err := s.AssignRole(ctx, "alice", "admin"); err != nil {
+			t.Errorf("expected assigning a role twice to succeed; got %v", err)
+		}
+		if err := s.AssignRole(ctx, "carol", "admin"); err == nil {
+			t.Errorf("expected an error assigning a role to an unknown user")
+		}
+		s.AssignRole(ctx, "bob", "editor")
+		s.GrantPermission(ctx, "editor", database.Permission{Action: "edit", Resource: "post"})
+
+		if roles, err := s.UserRoles(ctx, "alice"); err != nil || len(roles) != 1 || roles[0] != "admin" {
+			t.Errorf("unexpected roles %v, %v", roles, err)
+		}
+		for _, tc := range []struct {
+			username string
+			action   string
+			want     bool
+		}{
+			{"alice", "delete", true},
+			{"bob", "edit", true},
+			{"bob", "delete", false},
+			{"carol", "edit", false},
+		} {
+			got, err := s.UserHasPermission(ctx, tc.username, database.Permission{Action: tc.action, Resource: "post"})
+			if err != nil || got != tc.want {
+				t.Errorf("expected %s %s post to be %v; got %v, %v", tc.username, tc.action, tc.want, got, err)
+			}
+		}
+
+		s.RemoveRole(ctx, "alice", "admin")
+		if admin, err := s.HasRole(ctx, "alice", "admin"); err != nil || admin {
+			t.Errorf("expected the role to be removed; got %v, %v", admin, err)
+		}
+	})
+
+	t.Run("MagicLinks", func(t *testing.T) {
+		s := open(t)
+		s.RegisterUser(ctx, "alice", "", []byte("hash"))
+
+		if err := s.CreateMagicLink(ctx, "alice", "link", time.Now().Add(time.Hour)); err != nil {
+			t.Fatalf("error creating link. Err: %v", err)
+		}
+		if n, err := s.CountMagicLinks(ctx, "alice", time.Now().Add(-time.Minute)); err != nil || n != 1 {
+			t.Errorf("expected one link; got %d, %v", n, err)
+		}
+		if username, err := s.ConsumeMagicLink(ctx, "link"); err != nil || username != "alice" {
+			t.Errorf("expected alice; got %q, %v", username, err)
+		}
+		if _, err := s.ConsumeMagicLink(ctx, "link"); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("expected a link to be used once; got %v", err)
+		}
+	})
+
+	t.Run("TOTP", func(t *testing.T) {
+		s := open(t)
+		s.RegisterUser(ctx, "alice", "", []byte("hash"))
+
+		s.SetTOTPSecret(ctx, "alice", "FIRST")
+		if err := s.EnableTOTP(ctx, "alice", []string{"code"}); err != nil {
+			t.Fatalf("error enabling TOTP. Err: %v", err)
+		}
+		// A new pending secret leaves the enabled one in use until confirmed
+		s.SetTOTPSecret(ctx, "alice", "SECOND")
+		if secret, enabled, err := s.TOTPSecret(ctx, "alice"); err != nil || secret != "FIRST" || !enabled {
+			t.Errorf("expected the first secret to stay enabled; got %q, %v, %v", secret, enabled, err)
+		}
+		if pending, err := s.PendingTOTPSecret(ctx, "alice"); err != nil || pending != "SECOND" {
+			t.Errorf("expected the pending secret; got %q, %v", pending, err)
+		}
+		s.EnableTOTP(ctx, "alice", nil)
+		if secret, enabled, _ := s.TOTPSecret(ctx, "alice"); secret != "SECOND" || !enabled {
+			t.Errorf("expected the second secret to be enabled; got %q, %v", secret, enabled)
+		}
+		if pending, _ := s.PendingTOTPSecret(ctx, "alice"); pending != "" {
+			t.Errorf("expected no pending secret; got %q", pending)
+		}
+
+		// Time steps only move forward
+		if ok, err := s.UseTOTPStep(ctx, "alice", 100); err != nil || !ok {
+			t.Errorf("expected the step to be accepted; got %v, %v", ok, err)
+		}
+		for _, step := range []int64{100, 99} {
+			if ok, _ := s.UseTOTPStep(ctx, "alice", step); ok {
+				t.Errorf("expected step %d to be rejected", step)
+			}
+		}
+	})
+
+	t.Run("RefreshTokens", func(t *testing.T) {
+		s := open(t)
+		s.RegisterUser(ctx, "alice", "", []byte("hash"))
+
+		token := database.RefreshToken{Username: "alice", Family: "f1", ExpiresAt: time.Now().Add(time.Hour)}
+		if err := s.SaveRefreshToken(ctx, "t1", token); err != nil {
+			t.Fatalf("error saving token. Err: %v", err)
+		}
+		if used, err := s.UseRefreshToken(ctx, "t1"); err != nil || used.Used || used.Family != "f1" {
+			t.Errorf("expected the unused token; got %+v, %v", used, err)
+		}
+		if used, err := s.UseRefreshToken(ctx, "t1"); err != nil || !used.Used {
+			t.Errorf("expected the token to be marked used; got %+v, %v", used, err)
+		}
+		s.RevokeRefreshTokenFamily(ctx, "f1")
+		if _, err := s.FindRefreshToken(ctx, "t1"); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("expected the family to be revoked; got %v", err)
+		}
+
+		s.SaveRefreshToken(ctx, "t2", database.RefreshToken{Username: "alice", Family: "f2", ClientID: "app", ExpiresAt: time.Now().Add(time.Hour)})
+		if found, err := s.FindRefreshToken(ctx, "t2"); err != nil || found.ClientID != "app" {
+			t.Errorf("expected the token of the client; got %+v, %v", found, err)
+		}
+		s.SaveRefreshToken(ctx, "t3", database.RefreshToken{Username: "alice", Family: "f3", ExpiresAt: time.Now().Add(time.Hour)})
+		if err := s.RevokeUserRefreshTokens(ctx, "alice"); err != nil {
+			t.Fatalf("error revoking tokens. Err: %v", err)
+		}
+		for _, hash := range []string{"t2", "t3"} {
+			if _, err := s.FindRefreshToken(ctx, hash); !errors.Is(err, sql.ErrNoRows) {
+				t.Errorf("expected every family of the user to be revoked; got %v", err)
+			}
+		}
+	})
+
+	t.Run("APIKeys", func(t *testing.T) {
+		s := open(t)
+		s.RegisterUser(ctx, "alice", "", []byte("hash"))
+
+		id, err := s.CreateAPIKey(ctx, "alice", "ci", "sk_1", "key", []string{"read"})
+		if err != nil {
+			t.Fatalf("error creating key. Err: %v", err)
+		}
+		username, scopes, err := s.AuthenticateAPIKey(ctx, "key")
+		if err != nil || username != "alice" || len(scopes) != 1 {
+			t.Errorf("unexpected owner %q, %v, %v", username, scopes, err)
+		}
+		if err := s.RevokeAPIKey(ctx, "bob", id); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("expected sql.ErrNoRows revoking the key of another user; got %v", err)
+		}
+		s.RevokeAPIKey(ctx, "alice", id)
+		if _, _, err := s.AuthenticateAPIKey(ctx, "key"); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("expected a revoked key to be rejected; got %v", err)
+		}
+		if keys, err := s.APIKeys(ctx, "alice"); err != nil || len(keys) != 1 || keys[0].RevokedAt == nil {
+			t.Errorf("expected the revoked key to be listed; got %+v, %v", keys, err)
+		}
+
+		// The keys of disabled users are rejected, and revoked with the others
+		s.CreateAPIKey(ctx, "alice", "deploy", "sk_2", "key2", nil)
+		s.SetUserStatus(ctx, "alice", database.StatusDisabled)
+		if _, _, err := s.AuthenticateAPIKey(ctx, "key2"); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("expected the key of a disabled user to be rejected; got %v", err)
+		}
+		s.SetUserStatus(ctx, "alice", database.StatusActive)
+		if _, _, err := s.AuthenticateAPIKey(ctx, "key2"); err != nil {
+			t.Errorf("expected the key of a re-enabled user to be accepted; got %v", err)
+		}
+		if err := s.RevokeUserAPIKeys(ctx, "alice"); err != nil {
+			t.Fatalf("error revoking keys. Err: %v", err)
+		}
+		if _, _, err := s.AuthenticateAPIKey(ctx, "key2"); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("expected every key of the user to be revoked; got %v", err)
+		}
+	})
+
+	t.Run("IdentitiesAndPasskeys", func(t *testing.T) {
+		s := open(t)
+		s.RegisterUser(ctx, "alice", "", []byte("hash"))
+
+		if err := s.LinkIdentity(ctx, database.Identity{Provider: "github", Subject: "42", Username: "alice"}); err != nil {
+			t.Fatalf("error linking identity. Err: %v", err)
+		}
+		if identity, err := s.FindIdentity(ctx, "github", "42"); err != nil || identity.Username != "alice" {
+			t.Errorf("unexpected identity %+v, %v", identity, err)
+		}
+		if err := s.UnlinkIdentity(ctx, "alice", "google"); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("expected sql.ErrNoRows unlinking a missing identity; got %v", err)
+		}
+
+		credential := database.WebAuthnCredential{ID: []byte{1}, Username: "alice", PublicKey: []byte{2}}
+		if err := s.AddWebAuthnCredential(ctx, credential); err != nil {
+			t.Fatalf("error adding passkey. Err: %v", err)
+		}
+		s.UpdateWebAuthnSignCount(ctx, []byte{1}, 7)
+		if found, err := s.FindWebAuthnCredential(ctx, []byte{1}); err != nil || found.SignCount != 7 {
+			t.Errorf("unexpected passkey %+v, %v", found, err)
+		}
+	})
+}
@@ -0,0 +1,130 @@
+// Package databasetest provides databases for tests: every call to New opens
+// a private in-memory SQLite database, migrated to the latest schema and
+// loaded with fixtures, so tests never touch the database of the developer.
+//
+//	func TestLogin(t *testing.T) {
+//		db := databasetest.New(t, databasetest.User("alice", "secret"), databasetest.Role("alice", "admin"))
+//		...
+//	}
+package databasetest
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/raziel-aleman/go-starter/internal/database"
+	"github.com/raziel-aleman/go-starter/internal/database/fixtures"
+	"golang.org/x/crypto/bcrypt"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// Fixture loads data in a test database, through the service or, for
+// data without repository method, directly with SQL on the connection pool.
+type Fixture func(ctx context.Context, db *sql.DB, s database.Service) error
+
+// New returns a service on a new in-memory SQLite database with every
+// migration applied and the fixtures loaded in order. The database is
+// closed when the test ends, and the test fails if it cannot be set up.
+func New(tb testing.TB, fixtures ...Fixture) database.Service {
+	tb.Helper()
+	s, _ := Open(tb, fixtures...)
+	return s
+}
+
+// Open is like New, and also returns the connection pool of the database,
+// to inspect tables or set up data the service has no method for.
+func Open(tb testing.TB, fixtures ...Fixture) (database.Service, *sql.DB) {
+	tb.Helper()
+	db, err := sql.Open(database.DriverSQLite, ":memory:?_fk=true")
+	if err != nil {
+		tb.Fatalf("error opening test database. Err: %v", err)
+	}
+	// Every connection to :memory: opens a different database
+	db.SetMaxOpenConns(1)
+	db.SetConnMaxLifetime(0)
+	db.SetConnMaxIdleTime(0)
+	tb.Cleanup(func() { db.Close() })
+
+	ctx := context.Background()
+	s := database.NewService(db, database.DriverSQLite)
+	if err := s.Migrate(ctx); err != nil {
+		tb.Fatalf("error migrating test database. Err: %v", err)
+	}
+	for _, fixture := range fixtures {
+		if err := fixture(ctx, db, s); err != nil {
+			tb.Fatalf("error loading fixture. Err: %v", err)
+		}
+	}
+	return s, db
+}
+
+// User registers a user with a password and an optional email address.
+// Passwords are hashed at the minimum bcrypt cost to keep tests fast.
+func User(username string, password string, email ...string) Fixture {
+	return func(ctx context.Context, db *sql.DB, s database.Service) error {
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+		if err != nil {
+			return err
+		}
+		var address string
+		if len(email) > 0 {
+			address = email[0]
+		}
+		_, err = s.RegisterUser(ctx, username, address, hash)
+		return err
+	}
+}
+
+// InTenant loads the fixtures in a tenant, e.g. to register its users.
+func InTenant(tenant string, fixtures ...Fixture) Fixture {
+	return func(ctx context.Context, db *sql.DB, s database.Service) error {
+		ctx = database.WithTenant(ctx, tenant)
+		for _, fixture := range fixtures {
+			if err := fixture(ctx, db, s); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// Role grants roles to a user.
+func Role(username string, roles ...string) Fixture {
+	return func(ctx context.Context, db *sql.DB, s database.Service) error {
+		for _, role := range roles {
+			if err := s.AssignRole(ctx, username, role); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// Files loads fixture files, JSON or YAML, with LoadFixtures. Passwords are
+// hashed at the minimum bcrypt cost to keep tests fast.
+func Files(paths ...string) Fixture {
+	return func(ctx context.Context, db *sql.DB, s database.Service) error {
+		sets := make([]fixtures.Set, 0, len(paths))
+		for _, path := range paths {
+			set, err := fixtures.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			if err := set.HashPasswords(bcrypt.MinCost); err != nil {
+				return err
+			}
+			sets = append(sets, set)
+		}
+		return s.LoadFixtures(ctx, sets...)
+	}
+}
+
+// Exec runs a statement written for SQLite.
+func Exec(query string, args ...any) Fixture {
+	return func(ctx context.Context, db *sql.DB, s database.Service) error {
+		_, err := db.ExecContext(ctx, query, args...)
+		return err
+	}
+}
@@ -0,0 +1,69 @@
+package databasetest
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/raziel-aleman/go-starter/internal/database"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestNewLoadsFixtures(t *testing.T) {
+	s := New(t,
+		User("alice", "secret", "alice@example.com"),
+		Role("alice", "admin"),
+		Exec("INSERT INTO role_permissions (role, action, resource) VALUES (?, ?, ?)", "editor", "edit", "post"),
+	)
+
+	username, hash, err := s.VerifyCredentials(context.Background(), "alice@example.com")
+	if err != nil {
+		t.Fatalf("error verifying credentials. Err: %v", err)
+	}
+	if username != "alice" || bcrypt.CompareHashAndPassword(hash, []byte("secret")) != nil {
+		t.Errorf("unexpected credentials for %q", username)
+	}
+	if admin, err := s.HasRole(context.Background(), "alice", "admin"); err != nil || !admin {
+		t.Errorf("expected alice to be an admin; got %v, %v", admin, err)
+	}
+	permissions, err := s.RolePermissions(context.Background(), "editor")
+	if err != nil || len(permissions) != 1 {
+		t.Errorf("expected the editor permission; got %v, %v", permissions, err)
+	}
+}
+
+func TestDatabasesAreIsolated(t *testing.T) {
+	New(t, User("alice", "secret"))
+	s, db := Open(t)
+
+	if _, _, err := s.VerifyCredentials(context.Background(), "alice"); err != sql.ErrNoRows {
+		t.Errorf("expected no user in a new database; got %v", err)
+	}
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM users").Scan(&count); err != nil || count != 0 {
+		t.Errorf("expected an empty users table; got %d, %v", count, err)
+	}
+}
+
+func TestServiceConformance(t *testing.T) {
+	RunServiceTests(t, func(t *testing.T) database.Service { return New(t) })
+}
+
+func TestFilesLoadFixtures(t *testing.T) {
+	s := New(t, Files("testdata/users.yaml", "testdata/permissions.json"))
+	ctx := context.Background()
+
+	username, hash, err := s.VerifyCredentials(ctx, "alice@example.com")
+	if err != nil || username != "alice" || bcrypt.CompareHashAndPassword(hash, []byte("secret")) != nil {
+		t.Errorf("expected alice with a hashed password; got %q, %v", username, err)
+	}
+	if admin, err := s.HasRole(ctx, "alice", "admin"); err != nil || !admin {
+		t.Errorf("expected alice to be an admin; got %v, %v", admin, err)
+	}
+	if profile, err := s.UserProfile(ctx, "bob"); err != nil || profile.DisplayName != "Bob 'the builder'" {
+		t.Errorf("unexpected profile %+v, %v", profile, err)
+	}
+	if permissions, err := s.RolePermissions(ctx, "editor"); err != nil || len(permissions) != 1 {
+		t.Errorf("expected the editor permission; got %v, %v", permissions, err)
+	}
+}
@@ -0,0 +1,141 @@
+// Package dbutil scans query results into values without a Scan call per
+// column. Struct fields are matched to the result columns by their db tag:
+//
+//	type Permission struct {
+//		Action   string `db:"action"`
+//		Resource string `db:"resource"`
+//	}
+//
+//	permissions, err := dbutil.QueryMany[Permission](ctx, db, "SELECT action, resource FROM role_permissions")
+//
+// Fields without a db tag, or tagged "-", are left alone, and the fields of
+// embedded structs are matched like those of the struct. Other types, like
+// string, time.Time, or sql.Scanner implementations, scan the only column.
+package dbutil
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// Querier runs queries, like *sql.DB, *sql.Tx, or *sql.Conn.
+type Querier interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+// QueryOne runs a query and scans its first row into a T. It returns
+// sql.ErrNoRows if the query selects no row.
+func QueryOne[T any](ctx context.Context, q Querier, query string, args ...any) (T, error) {
+	var value T
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return value, err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return value, err
+		}
+		return value, sql.ErrNoRows
+	}
+	dest, err := destinations(rows, &value)
+	if err != nil {
+		return value, err
+	}
+	if err := rows.Scan(dest...); err != nil {
+		return value, err
+	}
+	return value, rows.Close()
+}
+
+// QueryMany runs a query and scans each row into a T. It returns an empty
+// slice if the query selects no row.
+func QueryMany[T any](ctx context.Context, q Querier, query string, args ...any) ([]T, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	values := []T{}
+	for rows.Next() {
+		var value T
+		dest, err := destinations(rows, &value)
+		if err != nil {
+			return nil, err
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, rows.Err()
+}
+
+var (
+	scannerType = reflect.TypeFor[sql.Scanner]()
+	timeType    = reflect.TypeFor[time.Time]()
+)
+
+// fieldsByType caches the field indexes of struct types by column name.
+var fieldsByType sync.Map // map[reflect.Type]map[string][]int
+
+// destinations returns the Scan destinations of the columns of rows in value.
+func destinations[T any](rows *sql.Rows, value *T) ([]any, error) {
+	v := reflect.ValueOf(value).Elem()
+	if !isStruct(v.Type()) {
+		return []any{value}, nil
+	}
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	fields := fieldsOf(v.Type())
+	dest := make([]any, len(columns))
+	for i, column := range columns {
+		index, ok := fields[column]
+		if !ok {
+			return nil, fmt.Errorf("dbutil: no field of %s is tagged db:%q", v.Type(), column)
+		}
+		dest[i] = v.FieldByIndex(index).Addr().Interface()
+	}
+	return dest, nil
+}
+
+// isStruct reports whether t is a struct scanned field by field.
+func isStruct(t reflect.Type) bool {
+	return t.Kind() == reflect.Struct && t != timeType && !reflect.PointerTo(t).Implements(scannerType)
+}
+
+// fieldsOf returns the field indexes of a struct type by column name.
+func fieldsOf(t reflect.Type) map[string][]int {
+	if fields, ok := fieldsByType.Load(t); ok {
+		return fields.(map[string][]int)
+	}
+	fields := map[string][]int{}
+	collectFields(t, nil, fields)
+	fieldsByType.Store(t, fields)
+	return fields
+}
+
+// collectFields adds the tagged fields of t, and of its embedded structs, to fields.
+func collectFields(t reflect.Type, parent []int, fields map[string][]int) {
+	for i := range t.NumField() {
+		field := t.Field(i)
+		index := append(append([]int{}, parent...), i)
+		column, tagged := field.Tag.Lookup("db")
+		switch {
+		case column == "-":
+		case tagged && field.IsExported():
+			fields[column] = index
+		case !tagged && field.Anonymous && field.Type.Kind() == reflect.Struct:
+			collectFields(field.Type, index, fields)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package dbutil
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+type base struct {
+	ID int64 `db:"id"`
+}
+
+type user struct {
+	base
+	Name    string  `db:"name"`
+	Email   *string `db:"email"`
+	Ignored string  `db:"-"`
+}
+
+func openDB(t *testing.T) *sql.DB {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("error opening database. Err: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	db.SetMaxOpenConns(1)
+	_, err = db.Exec(`CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT NOT NULL, email TEXT);
+		INSERT INTO users (name, email) VALUES ('alice', 'alice@example.com'), ('bob', NULL)`)
+	if err != nil {
+		t.Fatalf("error creating table. Err: %v", err)
+	}
+	return db
+}
+
+func TestQueryOneScansTaggedFields(t *testing.T) {
+	db := openDB(t)
+
+	u, err := QueryOne[user](context.Background(), db, "SELECT id, name, email FROM users WHERE name = ?", "alice")
+	if err != nil {
+		t.Fatalf("error querying. Err: %v", err)
+	}
+	if u.ID != 1 || u.Name != "alice" || u.Email == nil || *u.Email != "alice@example.com" {
+		t.Errorf("unexpected user %+v", u)
+	}
+
+	_, err = QueryOne[user](context.Background(), db, "SELECT id, name FROM users WHERE name = ?", "carol")
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected sql.ErrNoRows; got %v", err)
+	}
+}
+
+func TestQueryManyScansEveryRow(t *testing.T) {
+	db := openDB(t)
+
+	users, err := QueryMany[user](context.Background(), db, "SELECT id, name, email FROM users ORDER BY id")
+	if err != nil {
+		t.Fatalf("error querying. Err: %v", err)
+	}
+	if len(users) != 2 || users[0].Name != "alice" || users[1].Name != "bob" || users[1].Email != nil {
+		t.Errorf("unexpected users %+v", users)
+	}
+
+	names, err := QueryMany[string](context.Background(), db, "SELECT name FROM users WHERE id > ?", 5)
+	if err != nil || names == nil || len(names) != 0 {
+		t.Errorf("expected an empty slice; got %v, %v", names, err)
+	}
+}
+
+func TestQueryRejectsUnknownColumns(t *testing.T) {
+	db := openDB(t)
+
+	_, err := QueryOne[user](context.Background(), db, "SELECT id, name, email AS mail FROM users")
+	if err == nil {
+		t.Errorf("expected an error for a column without field")
+	}
+}
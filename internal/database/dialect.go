@@ -0,0 +1,234 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/mattn/go-sqlite3"
+	"github.com/raziel-aleman/go-starter/internal/database/libsql"
+)
+
+// Supported database drivers, selected with BLUEPRINT_DB_DRIVER.
+const (
+	DriverSQLite   = "sqlite3"
+	DriverLibSQL   = "libsql" // Remote libsql, e.g. Turso, queried in the SQLite dialect
+	DriverPostgres = "pgx"
+	DriverMySQL    = "mysql"
+)
+
+// queryer runs queries on a connection pool or in a transaction.
+type queryer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// conn is a connection pool running queries written with ? placeholders,
+// rewritten to $1, $2... for drivers using numbered placeholders.
+type conn struct {
+	*sql.DB
+	driver   string
+	cache    stmtCache
+	metrics  queryMetrics
+	busy     retryConfig   // Retries of the writes failing on a locked SQLite database, none if zero
+	timeouts timeoutConfig // Bounds of the statements, none if zero
+	logger   *slog.Logger  // Nil for the default logger
+}
+
+// log returns the logger of the connection pool.
+func (c *conn) log() *slog.Logger {
+	if c.logger == nil {
+		return slog.Default()
+	}
+	return c.logger
+}
+
+// ExecContext executes a statement, rewriting its placeholders for the driver.
+// A statement failing on a locked SQLite database is retried, within the
+// write timeout.
+func (c *conn) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	ctx, cancel := c.writeContext(ctx)
+	defer cancel()
+	start := time.Now()
+	var result sql.Result
+	err := retryBusy(ctx, c.busy, func() (err error) {
+		result, err = c.DB.ExecContext(ctx, rebind(c.driver, query), args...)
+		return err
+	})
+	c.metrics.observe(query, start, err)
+	return result, err
+}
+
+// QueryContext runs a query, rewriting its placeholders for the driver.
+func (c *conn) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	start := time.Now()
+	rows, err := c.DB.QueryContext(ctx, rebind(c.driver, query), args...)
+	c.metrics.observe(query, start, err)
+	return rows, err
+}
+
+// QueryRowContext runs a query returning at most one row, rewriting its placeholders for the driver.
+func (c *conn) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	start := time.Now()
+	row := c.DB.QueryRowContext(ctx, rebind(c.driver, query), args...)
+	c.metrics.observe(query, start, row.Err())
+	return row
+}
+
+// BeginTx starts a transaction bound to ctx whose queries are rewritten for the driver.
+func (c *conn) BeginTx(ctx context.Context) (*tx, error) {
+	t, err := c.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &tx{Tx: t, driver: c.driver, metrics: &c.metrics}, nil
+}
+
+// equalFold returns a condition matching a column to the next argument
+// regardless of case, using the case-insensitive username index.
+func (c *conn) equalFold(column string) string {
+	switch c.driver {
+	case DriverPostgres:
+		return "lower(" + column + ") = lower(?)"
+	case DriverMySQL:
+		// The column collation is already case-insensitive
+		return column + " = ?"
+	}
+	return column + " = ? COLLATE NOCASE"
+}
+
+// contains returns a condition matching a column to the next argument, a
+// LIKE pattern escaped with backslashes, regardless of case.
+func (c *conn) contains(column string) string {
+	switch c.driver {
+	case DriverPostgres:
+		return column + ` ILIKE ? ESCAPE '\'`
+	case DriverMySQL:
+		// Backslash is the default escape character, and escapes quotes in literals
+		return column + " LIKE ?"
+	}
+	return column + ` LIKE ? ESCAPE '\'`
+}
+
+// nullSafeEqual returns the comparison operator treating two NULLs as equal.
+func (c *conn) nullSafeEqual() string {
+	if c.driver == DriverMySQL {
+		return "<=>"
+	}
+	return "IS NOT DISTINCT FROM"
+}
+
+// ignoreConflict returns the clause appended to an insert to do nothing if
+// the row already exists. MySQL has no such clause, so column is assigned to
+// itself instead.
+func (c *conn) ignoreConflict(column string) string {
+	if c.driver == DriverMySQL {
+		return " ON DUPLICATE KEY UPDATE " + column + " = " + column
+	}
+	return " ON CONFLICT DO NOTHING"
+}
+
+// isUniqueViolation reports whether a statement failed because it would
+// duplicate a value of a unique index.
+func isUniqueViolation(err error) bool {
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.Code == "23505"
+	}
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		return mysqlErr.Number == 1062
+	}
+	var libsqlErr *libsql.Error
+	if errors.As(err, &libsqlErr) {
+		return libsqlErr.Code == "SQLITE_CONSTRAINT_UNIQUE"
+	}
+	return false
+}
+
+// insertID executes an insert into a table with an id column and returns the
+// generated id. Postgres has no LastInsertId, the statement returns the id instead.
+func insertID(ctx context.Context, q queryer, driver string, query string, args ...any) (int64, error) {
+	if driver == DriverPostgres {
+		var id int64
+		err := q.QueryRowContext(ctx, query+" RETURNING id", args...).Scan(&id)
+		return id, err
+	}
+	result, err := q.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// tx is a transaction running queries written with ? placeholders.
+type tx struct {
+	*sql.Tx
+	driver  string
+	metrics *queryMetrics
+}
+
+// ExecContext executes a statement, rewriting its placeholders for the driver.
+func (t *tx) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	start := time.Now()
+	result, err := t.Tx.ExecContext(ctx, rebind(t.driver, query), args...)
+	t.metrics.observe(query, start, err)
+	return result, err
+}
+
+// QueryContext runs a query, rewriting its placeholders for the driver.
+func (t *tx) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	start := time.Now()
+	rows, err := t.Tx.QueryContext(ctx, rebind(t.driver, query), args...)
+	t.metrics.observe(query, start, err)
+	return rows, err
+}
+
+// QueryRowContext runs a query returning at most one row, rewriting its placeholders for the driver.
+func (t *tx) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	start := time.Now()
+	row := t.Tx.QueryRowContext(ctx, rebind(t.driver, query), args...)
+	t.metrics.observe(query, start, row.Err())
+	return row
+}
+
+// rebind rewrites the ? placeholders of a query to $1, $2... for Postgres.
+// Question marks in string literals and quoted identifiers are left alone.
+func rebind(driver, query string) string {
+	if driver != DriverPostgres || !strings.Contains(query, "?") {
+		return query
+	}
+
+	var b strings.Builder
+	b.Grow(len(query) + 8)
+	n := 0
+	var quote byte
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '?':
+			n++
+			b.WriteByte('$')
+			b.WriteString(strconv.Itoa(n))
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
@@ -0,0 +1,217 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ErrDriftCheckUnsupported is returned when the schema of a driver cannot be
+// compared, because its DDL statements cannot be rolled back.
+var ErrDriftCheckUnsupported = errors.New("schema drift detection is not supported for this driver")
+
+// schema is the shape of a database: the definitions of the columns and
+// indexes of its tables, by name.
+type schema map[string]tableSchema
+
+type tableSchema struct {
+	columns map[string]string
+	indexes map[string]string
+}
+
+// rowsQueryer runs queries on a connection pool or in a transaction.
+type rowsQueryer interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+// CheckSchema compares the live schema with the one the applied migrations
+// create, and returns their differences. Tables, columns and indexes added or
+// changed by hand show up as "+" or "~", those dropped by hand as "-".
+func (s *service) CheckSchema(ctx context.Context) ([]string, error) {
+	applied, err := s.appliedMigrations(ctx)
+	if err != nil {
+		return nil, err
+	}
+	migrations, err := loadMigrations(s.db.driver)
+	if err != nil {
+		return nil, err
+	}
+	var scripts []string
+	for _, m := range migrations {
+		if applied[m.Version] {
+			scripts = append(scripts, m.Up)
+		}
+	}
+
+	var expected, actual schema
+	switch s.db.driver {
+	case DriverSQLite:
+		expected, err = expectedSQLiteSchema(ctx, scripts)
+		if err == nil {
+			actual, err = inspectSQLite(ctx, s.db.DB)
+		}
+	case DriverPostgres:
+		expected, err = s.expectedPostgresSchema(ctx, scripts)
+		if err == nil {
+			actual, err = inspectPostgres(ctx, s.db.DB)
+		}
+	default:
+		return nil, ErrDriftCheckUnsupported
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error inspecting schema: %v", err)
+	}
+
+	return diffSchemas(expected, actual), nil
+}
+
+// expectedSQLiteSchema runs the migration scripts on an in-memory database.
+func expectedSQLiteSchema(ctx context.Context, scripts []string) (schema, error) {
+	db, err := sql.Open(DriverSQLite, ":memory:")
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	// Every connection to :memory: is a different database
+	db.SetMaxOpenConns(1)
+
+	for _, script := range scripts {
+		for _, statement := range splitStatements(script) {
+			if _, err := db.ExecContext(ctx, statement); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return inspectSQLite(ctx, db)
+}
+
+// expectedPostgresSchema runs the migration scripts in a scratch schema,
+// inside a transaction that is rolled back.
+func (s *service) expectedPostgresSchema(ctx context.Context, scripts []string) (schema, error) {
+	tx, err := s.db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "CREATE SCHEMA schema_drift_check; SET LOCAL search_path TO schema_drift_check"); err != nil {
+		return nil, err
+	}
+	for _, script := range scripts {
+		for _, statement := range splitStatements(script) {
+			if _, err := tx.ExecContext(ctx, statement); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return inspectPostgres(ctx, tx)
+}
+
+// inspectSQLite reads the tables, columns and indexes of a SQLite database.
+// Indexes created implicitly for constraints are part of their table.
+func inspectSQLite(ctx context.Context, q rowsQueryer) (schema, error) {
+	return inspect(ctx, q,
+		`SELECT m.name, c.name, c.type || CASE WHEN c."notnull" THEN ' NOT NULL' ELSE '' END
+		FROM sqlite_master m JOIN pragma_table_info(m.name) c
+		WHERE m.type = 'table' AND m.name NOT LIKE 'sqlite_%' AND m.name != 'schema_migrations'`,
+		`SELECT tbl_name, name, sql FROM sqlite_master
+		WHERE type = 'index' AND sql IS NOT NULL AND tbl_name != 'schema_migrations'`,
+	)
+}
+
+// inspectPostgres reads the tables, columns and indexes of the current
+// PostgreSQL schema.
+func inspectPostgres(ctx context.Context, q rowsQueryer) (schema, error) {
+	return inspect(ctx, q,
+		`SELECT table_name, column_name, data_type || CASE WHEN is_nullable = 'NO' THEN ' NOT NULL' ELSE '' END
+		FROM information_schema.columns
+		WHERE table_schema = current_schema() AND table_name != 'schema_migrations'`,
+		`SELECT tablename, indexname, replace(indexdef, schemaname || '.', '')
+		FROM pg_indexes
+		WHERE schemaname = current_schema() AND tablename != 'schema_migrations'`,
+	)
+}
+
+// inspect builds a schema from a query listing the table, name and definition
+// of every column and one doing the same for every index.
+func inspect(ctx context.Context, q rowsQueryer, columnsQuery, indexesQuery string) (schema, error) {
+	result := make(schema)
+	table := func(name string) tableSchema {
+		t, ok := result[name]
+		if !ok {
+			t = tableSchema{columns: make(map[string]string), indexes: make(map[string]string)}
+			result[name] = t
+		}
+		return t
+	}
+
+	for i, query := range []string{columnsQuery, indexesQuery} {
+		rows, err := q.QueryContext(ctx, query)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var tableName, name, definition string
+			if err := rows.Scan(&tableName, &name, &definition); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			// Whitespace differs with how the statement was written
+			definition = strings.Join(strings.Fields(definition), " ")
+			if i == 0 {
+				table(tableName).columns[name] = definition
+			} else {
+				table(tableName).indexes[name] = definition
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// diffSchemas lists the differences of the actual schema from the expected one.
+func diffSchemas(expected, actual schema) []string {
+	var diff []string
+	for name, want := range expected {
+		got, ok := actual[name]
+		if !ok {
+			diff = append(diff, "- table "+name)
+			continue
+		}
+		diff = append(diff, diffDefinitions("column "+name+".", want.columns, got.columns)...)
+		diff = append(diff, diffDefinitions("index "+name+".", want.indexes, got.indexes)...)
+	}
+	for name := range actual {
+		if _, ok := expected[name]; !ok {
+			diff = append(diff, "+ table "+name)
+		}
+	}
+	sort.Slice(diff, func(i, j int) bool { return diff[i][2:] < diff[j][2:] })
+	return diff
+}
+
+// diffDefinitions lists the missing, unexpected and changed definitions.
+func diffDefinitions(prefix string, expected, actual map[string]string) []string {
+	var diff []string
+	for name, want := range expected {
+		got, ok := actual[name]
+		switch {
+		case !ok:
+			diff = append(diff, "- "+prefix+name+" "+want)
+		case got != want:
+			diff = append(diff, "~ "+prefix+name+" expected "+want+", got "+got)
+		}
+	}
+	for name, got := range actual {
+		if _, ok := expected[name]; !ok {
+			diff = append(diff, "+ "+prefix+name+" "+got)
+		}
+	}
+	return diff
+}
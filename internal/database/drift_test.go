@@ -0,0 +1,48 @@
+package database
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestCheckSchema(t *testing.T) {
+	s, db := openTestDB(t)
+	ctx := context.Background()
+	if err := s.Migrate(ctx); err != nil {
+		t.Fatalf("error migrating. Err: %v", err)
+	}
+	diff, err := s.CheckSchema(ctx)
+	if err != nil {
+		t.Fatalf("error checking schema. Err: %v", err)
+	}
+	if len(diff) != 0 {
+		t.Errorf("expected no drift after migrating; got %q", diff)
+	}
+
+	// Changes made by hand show up, sorted by what they change
+	for _, statement := range []string{
+		"ALTER TABLE users ADD COLUMN nickname TEXT",
+		"DROP INDEX sessions_username",
+		"DROP INDEX sessions_expires_at",
+		"CREATE INDEX sessions_expires_at ON sessions (expires_at, username)",
+		"CREATE TABLE notes (id INTEGER NOT NULL)",
+	} {
+		if _, err := db.ExecContext(ctx, statement); err != nil {
+			t.Fatalf("error changing schema. Err: %v", err)
+		}
+	}
+	diff, err = s.CheckSchema(ctx)
+	if err != nil {
+		t.Fatalf("error checking schema. Err: %v", err)
+	}
+	want := []string{
+		"+ column users.nickname TEXT",
+		"~ index sessions.sessions_expires_at expected CREATE INDEX sessions_expires_at ON sessions (expires_at), got CREATE INDEX sessions_expires_at ON sessions (expires_at, username)",
+		"- index sessions.sessions_username CREATE INDEX sessions_username ON sessions (username)",
+		"+ table notes",
+	}
+	if !reflect.DeepEqual(diff, want) {
+		t.Errorf("expected drift %q; got %q", want, diff)
+	}
+}
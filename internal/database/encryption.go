@@ -0,0 +1,84 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// Encrypted columns, named in the authenticated data of their values so a
+// value copied to another column does not decrypt.
+const (
+	columnTOTPSecret = "users.totp_secret"
+)
+
+// RotateEncryptionKeys re-encrypts the stale TOTP secrets, enabled or pending,
+// with the active key of BLUEPRINT_DB_ENCRYPTION_KEYS. A secret changed
+// concurrently is skipped, it is written with the active key already.
+func (s *service) RotateEncryptionKeys(ctx context.Context) (int64, error) {
+	if s.keys == nil {
+		return 0, errors.New("no encryption key configured, set BLUEPRINT_DB_ENCRYPTION_KEYS")
+	}
+
+	var rotated int64
+	// Pending secrets are encrypted as the secret they become
+	for _, column := range []string{"totp_secret", "totp_pending_secret"} {
+		n, err := s.rotateColumn(ctx, column, columnTOTPSecret)
+		rotated += n
+		if err != nil {
+			return rotated, err
+		}
+	}
+	return rotated, nil
+}
+
+// rotateColumn re-encrypts the stale values of a column of the users table,
+// authenticated with the name of the encrypted column.
+func (s *service) rotateColumn(ctx context.Context, column, encrypted string) (int64, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT username, "+column+" FROM users WHERE "+column+" IS NOT NULL")
+	if err != nil {
+		return 0, err
+	}
+	stale := map[string]string{}
+	for rows.Next() {
+		var username, secret string
+		if err := rows.Scan(&username, &secret); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		if s.keys.Stale(secret) {
+			stale[username] = secret
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	var rotated int64
+	for username, secret := range stale {
+		plaintext, err := s.keys.Decrypt(secret, encrypted)
+		if err != nil {
+			return rotated, fmt.Errorf("error decrypting the %s of %s: %w", column, username, err)
+		}
+		ciphertext, err := s.keys.Encrypt(plaintext, encrypted)
+		if err != nil {
+			return rotated, err
+		}
+		err = s.execOne(ctx,
+			"UPDATE users SET "+column+" = ? WHERE username = ? AND "+column+" = ?",
+			ciphertext,
+			username,
+			secret,
+		)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return rotated, err
+		}
+		rotated++
+	}
+	return rotated, nil
+}
@@ -0,0 +1,93 @@
+package database
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// AuthEvent is an entry of the authentication audit log.
+type AuthEvent struct {
+	ID        int64     `json:"id"`
+	Type      string    `json:"type"`
+	Username  string    `json:"username"`
+	IP        string    `json:"ip"`
+	UserAgent string    `json:"user_agent"`
+	Detail    string    `json:"detail,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// AuthEventFilter selects audit log events. Zero fields match everything.
+type AuthEventFilter struct {
+	Username string
+	Type     string
+	Before   int64 // Only events with a lower id, to page through the log
+	Limit    int   // Defaults to 100
+}
+
+// RecordAuthEvent appends an event to the authentication audit log.
+func (s *service) RecordAuthEvent(ctx context.Context, event AuthEvent) error {
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = time.Now()
+	}
+	_, err := s.db.ExecContext(ctx,
+		"INSERT INTO auth_events (type, username, ip, user_agent, detail, created_at) VALUES (?, ?, ?, ?, ?, ?)",
+		event.Type,
+		event.Username,
+		event.IP,
+		event.UserAgent,
+		event.Detail,
+		event.CreatedAt.UTC().Format(time.RFC3339),
+	)
+	return err
+}
+
+// AuthEvents returns audit log events matching the filter, newest first.
+func (s *service) AuthEvents(ctx context.Context, filter AuthEventFilter) ([]AuthEvent, error) {
+	ctx, cancel := s.db.readContext(ctx)
+	defer cancel()
+	var conditions []string
+	var args []any
+	if filter.Username != "" {
+		conditions = append(conditions, "username = ?")
+		args = append(args, filter.Username)
+	}
+	if filter.Type != "" {
+		conditions = append(conditions, "type = ?")
+		args = append(args, filter.Type)
+	}
+	if filter.Before > 0 {
+		conditions = append(conditions, "id < ?")
+		args = append(args, filter.Before)
+	}
+	if filter.Limit <= 0 {
+		filter.Limit = 100
+	}
+
+	query := "SELECT id, type, username, ip, user_agent, detail, created_at FROM auth_events"
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += " ORDER BY id DESC LIMIT ?"
+	args = append(args, filter.Limit)
+
+	rows, err := s.reader(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []AuthEvent{}
+	for rows.Next() {
+		var e AuthEvent
+		var createdAt string
+		if err := rows.Scan(&e.ID, &e.Type, &e.Username, &e.IP, &e.UserAgent, &e.Detail, &createdAt); err != nil {
+			return nil, err
+		}
+		if e.CreatedAt, err = time.Parse(time.RFC3339, createdAt); err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
@@ -0,0 +1,1348 @@
+// Package fake is an in-memory database.Service for tests that do not need
+// SQL, so they run without SQLite. It follows the documented behavior of the
+// real service, checked by the databasetest conformance suite: usernames are
+// matched case-insensitively, emails are unique, deleted users are hidden,
+// purging a user removes its data, and times are kept to the second.
+//
+// The fake has no SQL: WithTx and LoadFixtures return ErrNoSQL, tenants are ignored, and
+// Health, WriteMetrics, Migrate, and CheckSchema report an empty database.
+// Tests needing those use databasetest instead.
+package fake
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"errors"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/raziel-aleman/go-starter/internal/database"
+	"github.com/raziel-aleman/go-starter/internal/database/fixtures"
+)
+
+// Ensure the fake implements the whole service.
+var _ database.Service = (*Service)(nil)
+
+var (
+	// ErrNoSQL is returned by WithTx, the fake cannot run application queries.
+	ErrNoSQL = errors.New("fake: the fake database cannot run SQL, use databasetest")
+
+	// errUnique and errForeignKey stand for the constraint violations of the real database.
+	errUnique     = errors.New("fake: UNIQUE constraint failed")
+	errForeignKey = errors.New("fake: FOREIGN KEY constraint failed")
+)
+
+// user is a row of the users table.
+type user struct {
+	id                int64
+	username          string
+	password          []byte
+	email             string
+	verified          bool
+	totpSecret        string
+	totpPendingSecret string
+	totpEnabled       bool
+	totpLastStep      int64
+	displayName       string
+	avatarURL         string
+	status            database.UserStatus
+	resetRequired     bool
+	passwordChangedAt time.Time
+	createdAt         time.Time
+	updatedAt         time.Time
+	lastLoginAt       *time.Time
+	deletedAt         *time.Time
+	recoveryCodes     map[string]bool
+	roles             map[string]bool
+}
+
+// token is a hashed token of a user expiring at some point, like email
+// verifications and magic links.
+type token struct {
+	username  string
+	createdAt time.Time
+	expiresAt time.Time
+}
+
+// apiKey is a row of the api_keys table.
+type apiKey struct {
+	database.APIKey
+	username string
+	hash     string
+}
+
+// refreshToken is a row of the refresh_tokens table.
+type refreshToken struct {
+	database.RefreshToken
+	hash string
+}
+
+// invitation is a row of the invitations table.
+type invitation struct {
+	database.Invitation
+	uses int
+}
+
+// Service is an in-memory database.Service, safe for concurrent use.
+type Service struct {
+	mu            sync.Mutex
+	nextID        int64
+	users         []*user
+	verifications map[string]token
+	magicLinks    map[string]token
+	permissions   map[string]map[database.Permission]bool
+	apiKeys       []*apiKey
+	refreshTokens []*refreshToken
+	oauthClients  map[string]database.OAuthClient
+	oauthCodes    map[string]database.OAuthCode
+	invitations   map[string]*invitation
+	events        []database.AuthEvent
+	identities    []database.Identity
+	passkeys      []database.WebAuthnCredential
+	sessions      map[string]database.StoredSession
+}
+
+// New returns an empty fake database. Like the initial migration, it grants
+// every permission to the admin role.
+func New() *Service {
+	return &Service{
+		verifications: map[string]token{},
+		magicLinks:    map[string]token{},
+		permissions:   map[string]map[database.Permission]bool{"admin": {{Action: "*", Resource: "*"}: true}},
+		oauthClients:  map[string]database.OAuthClient{},
+		oauthCodes:    map[string]database.OAuthCode{},
+		invitations:   map[string]*invitation{},
+		sessions:      map[string]database.StoredSession{},
+	}
+}
+
+// now returns the current time as stored by the real database.
+func now() time.Time {
+	return time.Now().UTC().Truncate(time.Second)
+}
+
+// stored returns a time as stored by the real database.
+func stored(t time.Time) time.Time {
+	return t.UTC().Truncate(time.Second)
+}
+
+// normalizeEmail matches emails regardless of case and surrounding spaces.
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// find returns the user with a username, in any case, deleted or not.
+func (s *Service) find(username string) *user {
+	for _, u := range s.users {
+		if strings.EqualFold(u.username, username) {
+			return u
+		}
+	}
+	return nil
+}
+
+// active returns the user with exactly a username unless it is deleted.
+func (s *Service) active(username string) (*user, error) {
+	for _, u := range s.users {
+		if u.username == username && u.deletedAt == nil {
+			return u, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+// emailTaken reports whether another user than u has an email.
+func (s *Service) emailTaken(email string, u *user) bool {
+	for _, other := range s.users {
+		if other != u && email != "" && other.email == email {
+			return true
+		}
+	}
+	return false
+}
+
+// insertUser adds a user, failing like the unique constraints of the users table.
+func (s *Service) insertUser(username string, email string, hashedPassword []byte) (*user, error) {
+	email = normalizeEmail(email)
+	if s.find(username) != nil || s.emailTaken(email, nil) {
+		return nil, errUnique
+	}
+	s.nextID++
+	t := now()
+	u := &user{
+		id:                s.nextID,
+		username:          username,
+		password:          hashedPassword,
+		email:             email,
+		status:            database.StatusActive,
+		passwordChangedAt: t,
+		createdAt:         t,
+		updatedAt:         t,
+		recoveryCodes:     map[string]bool{},
+		roles:             map[string]bool{},
+	}
+	s.users = append(s.users, u)
+	return u, nil
+}
+
+// Health reports the fake database up.
+func (s *Service) Health(ctx context.Context) database.HealthStatus {
+	return database.HealthStatus{
+		Status: database.HealthUp,
+		Checks: map[string]database.HealthCheck{"ping": {Status: database.HealthUp}},
+	}
+}
+
+// WriteMetrics writes no metrics.
+func (s *Service) WriteMetrics(w io.Writer) error {
+	return nil
+}
+
+// Backup returns database.ErrBackupUnsupported.
+func (s *Service) Backup(ctx context.Context, dst string) error {
+	return database.ErrBackupUnsupported
+}
+
+// RotateEncryptionKeys has nothing to re-encrypt, the fake keeps plaintext.
+func (s *Service) RotateEncryptionKeys(ctx context.Context) (int64, error) {
+	return 0, nil
+}
+
+// LoadFixtures returns ErrNoSQL, fixtures are rows of SQL tables.
+func (s *Service) LoadFixtures(ctx context.Context, sets ...fixtures.Set) error {
+	return ErrNoSQL
+}
+
+// Close does nothing, the data stays readable.
+func (s *Service) Close() error {
+	return nil
+}
+
+// Migrate does nothing, the fake has no schema.
+func (s *Service) Migrate(ctx context.Context) error {
+	return nil
+}
+
+// MigrateTo does nothing, the fake has no schema.
+func (s *Service) MigrateTo(ctx context.Context, version int) error {
+	return nil
+}
+
+// CheckSchema reports no drift.
+func (s *Service) CheckSchema(ctx context.Context) ([]string, error) {
+	return nil, nil
+}
+
+// WithTx returns ErrNoSQL without calling fn.
+func (s *Service) WithTx(ctx context.Context, fn func(tx database.Tx) error) error {
+	return ErrNoSQL
+}
+
+// RegisterUser adds a user and returns its id.
+func (s *Service) RegisterUser(ctx context.Context, username string, email string, hashedPassword []byte) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, err := s.insertUser(username, email, hashedPassword)
+	if err != nil {
+		return "", err
+	}
+	return strconv.FormatInt(u.id, 10), nil
+}
+
+// VerifyCredentials returns the username and password hash of the user with
+// the login as username, in any case, or as email address.
+func (s *Service) VerifyCredentials(ctx context.Context, login string) (string, []byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if u := s.find(login); u != nil && u.deletedAt == nil {
+		return u.username, u.password, nil
+	}
+	for _, u := range s.users {
+		if u.email != "" && u.email == normalizeEmail(login) && u.deletedAt == nil {
+			return u.username, u.password, nil
+		}
+	}
+	return "", nil, sql.ErrNoRows
+}
+
+// CanonicalUsername returns a username as stored.
+func (s *Service) CanonicalUsername(ctx context.Context, username string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u := s.find(username)
+	if u == nil || u.deletedAt != nil {
+		return "", sql.ErrNoRows
+	}
+	return u.username, nil
+}
+
+// UserExists reports whether a user exists and is not deleted.
+func (s *Service) UserExists(ctx context.Context, username string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err := s.active(username)
+	return err == nil, nil
+}
+
+// SetPasswordHash replaces the password hash of a user, fulfilling any required password reset.
+func (s *Service) SetPasswordHash(ctx context.Context, username string, hash []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if u, err := s.active(username); err == nil {
+		u.password, u.resetRequired = hash, false
+		u.passwordChangedAt, u.updatedAt = now(), now()
+	}
+	return nil
+}
+
+// UpdatePasswordHash replaces the password hash of a user if it still matches oldHash.
+func (s *Service) UpdatePasswordHash(ctx context.Context, username string, oldHash []byte, newHash []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if u, err := s.active(username); err == nil && string(u.password) == string(oldHash) {
+		u.password, u.updatedAt = newHash, now()
+	}
+	return nil
+}
+
+// ProvisionUser adds a user unless the username is already taken.
+func (s *Service) ProvisionUser(ctx context.Context, username string, hashedPassword []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.find(username) != nil {
+		return nil
+	}
+	_, err := s.insertUser(username, "", hashedPassword)
+	return err
+}
+
+// FindUserByEmail returns the profile of the user with an email.
+func (s *Service) FindUserByEmail(ctx context.Context, email string) (database.UserProfile, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, u := range s.users {
+		if u.email != "" && u.email == normalizeEmail(email) && u.deletedAt == nil {
+			return profile(u), nil
+		}
+	}
+	return database.UserProfile{}, sql.ErrNoRows
+}
+
+// profile returns the profile of a user.
+func profile(u *user) database.UserProfile {
+	return database.UserProfile{
+		Username:    u.username,
+		Email:       u.email,
+		DisplayName: u.displayName,
+		AvatarURL:   u.avatarURL,
+		Verified:    u.verified,
+	}
+}
+
+// UserProfile returns the profile of a user.
+func (s *Service) UserProfile(ctx context.Context, username string) (database.UserProfile, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, err := s.active(username)
+	if err != nil {
+		return database.UserProfile{}, err
+	}
+	return profile(u), nil
+}
+
+// UpdateUserProfile changes the non-nil fields of a user profile.
+func (s *Service) UpdateUserProfile(ctx context.Context, username string, update database.ProfileUpdate) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if update == (database.ProfileUpdate{}) {
+		return nil
+	}
+	u, err := s.active(username)
+	if err != nil {
+		return err
+	}
+	if update.Email != nil {
+		email := normalizeEmail(*update.Email)
+		if s.emailTaken(email, u) {
+			return database.ErrEmailTaken
+		}
+		if email != u.email {
+			u.email, u.verified = email, false
+		}
+	}
+	if update.DisplayName != nil {
+		u.displayName = *update.DisplayName
+	}
+	if update.AvatarURL != nil {
+		u.avatarURL = *update.AvatarURL
+	}
+	u.updatedAt = now()
+	return nil
+}
+
+// UpdateEmail changes the email of a user.
+func (s *Service) UpdateEmail(ctx context.Context, username string, email string) error {
+	return s.UpdateUserProfile(ctx, username, database.ProfileUpdate{Email: &email})
+}
+
+// ListUsers returns a page of the users matching the query, and the number of matches.
+func (s *Service) ListUsers(ctx context.Context, query database.UserQuery) ([]database.UserSummary, int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	page := query.Page
+	if page.Limit <= 0 {
+		page.Limit = 50
+	}
+	if page.Sort == "" {
+		page.Sort = "username"
+	}
+	key := page.SortKey()
+	descending := strings.HasPrefix(page.Sort, "-")
+	if !slices.Contains([]string{"username", "email", "created_at", "last_login_at"}, key) || (page.Cursor != "" && key != "username") {
+		return nil, 0, database.ErrInvalidPage
+	}
+
+	search := strings.ToLower(query.Search)
+	var matches []*user
+	for _, u := range s.users {
+		if u.deletedAt != nil {
+			continue
+		}
+		if search != "" && !strings.Contains(strings.ToLower(u.username), search) && !strings.Contains(u.email, search) {
+			continue
+		}
+		matches = append(matches, u)
+	}
+	total := len(matches)
+
+	slices.SortStableFunc(matches, func(a, b *user) int {
+		var c int
+		switch key {
+		case "email":
+			c = cmp.Compare(a.email, b.email)
+		case "created_at":
+			c = a.createdAt.Compare(b.createdAt)
+		case "last_login_at":
+			c = compareNullTime(a.lastLoginAt, b.lastLoginAt)
+		}
+		if descending {
+			c = -c
+		}
+		if c == 0 {
+			// Users with the same value are in username order, in any direction
+			c = strings.Compare(strings.ToLower(a.username), strings.ToLower(b.username))
+			if key == "username" && descending {
+				c = -c
+			}
+		}
+		return c
+	})
+
+	if page.Cursor != "" {
+		cursor := strings.ToLower(page.Cursor)
+		matches = slices.DeleteFunc(matches, func(u *user) bool {
+			c := strings.Compare(strings.ToLower(u.username), cursor)
+			return (!descending && c <= 0) || (descending && c >= 0)
+		})
+	} else {
+		matches = matches[min(page.Offset, len(matches)):]
+	}
+	matches = matches[:min(page.Limit, len(matches))]
+
+	users := []database.UserSummary{}
+	for _, u := range matches {
+		createdAt, updatedAt := u.createdAt, u.updatedAt
+		users = append(users, database.UserSummary{
+			ID:                    strconv.FormatInt(u.id, 10),
+			Username:              u.username,
+			Email:                 u.email,
+			DisplayName:           u.displayName,
+			Verified:              u.verified,
+			Status:                u.status,
+			PasswordResetRequired: u.resetRequired,
+			CreatedAt:             &createdAt,
+			UpdatedAt:             &updatedAt,
+			LastLoginAt:           u.lastLoginAt,
+		})
+	}
+	return users, total, nil
+}
+
+// compareNullTime orders missing times first, like NULLs in SQLite.
+func compareNullTime(a, b *time.Time) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return -1
+	case b == nil:
+		return 1
+	}
+	return a.Compare(*b)
+}
+
+// AccountStatus returns the status of a user.
+func (s *Service) AccountStatus(ctx context.Context, username string) (database.AccountStatus, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, err := s.active(username)
+	if err != nil {
+		return database.AccountStatus{}, err
+	}
+	return database.AccountStatus{
+		Status:                u.status,
+		PasswordResetRequired: u.resetRequired,
+		PasswordChangedAt:     u.passwordChangedAt,
+	}, nil
+}
+
+// SetUserStatus activates, disables, or bans a user.
+func (s *Service) SetUserStatus(ctx context.Context, username string, status database.UserStatus) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, err := s.active(username)
+	if err != nil {
+		return err
+	}
+	u.status, u.updatedAt = status, now()
+	return nil
+}
+
+// RecordLogin sets the last login time of a user to now.
+func (s *Service) RecordLogin(ctx context.Context, username string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, err := s.active(username)
+	if err != nil {
+		return err
+	}
+	t := now()
+	u.lastLoginAt = &t
+	return nil
+}
+
+// RequirePasswordReset forces a user to change its password.
+func (s *Service) RequirePasswordReset(ctx context.Context, username string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, err := s.active(username)
+	if err != nil {
+		return err
+	}
+	u.resetRequired, u.updatedAt = true, now()
+	return nil
+}
+
+// DeleteUser soft-deletes a user and revokes its refresh tokens.
+func (s *Service) DeleteUser(ctx context.Context, username string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, err := s.active(username)
+	if err != nil {
+		return err
+	}
+	t := now()
+	u.deletedAt, u.updatedAt = &t, t
+	s.refreshTokens = slices.DeleteFunc(s.refreshTokens, func(r *refreshToken) bool { return r.Username == u.username })
+	return nil
+}
+
+// RestoreUser reverts the soft deletion of a user.
+func (s *Service) RestoreUser(ctx context.Context, username string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u := s.find(username)
+	if u == nil || u.deletedAt == nil {
+		return sql.ErrNoRows
+	}
+	u.deletedAt, u.updatedAt = nil, now()
+	return nil
+}
+
+// PurgeUser removes a user, deleted or not, and its data.
+func (s *Service) PurgeUser(ctx context.Context, username string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u := s.find(username)
+	if u == nil {
+		return sql.ErrNoRows
+	}
+	s.purge(u)
+	return nil
+}
+
+// PurgeDeletedUsers removes the users soft-deleted before a time.
+func (s *Service) PurgeDeletedUsers(ctx context.Context, before time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var n int64
+	for _, u := range slices.Clone(s.users) {
+		if u.deletedAt != nil && u.deletedAt.Before(stored(before)) {
+			s.purge(u)
+			n++
+		}
+	}
+	return n, nil
+}
+
+// purge removes a user and its data, like the foreign keys of the real database.
+func (s *Service) purge(u *user) {
+	s.users = slices.DeleteFunc(s.users, func(other *user) bool { return other == u })
+	owned := func(username string) bool { return username == u.username }
+	for hash, t := range s.verifications {
+		if owned(t.username) {
+			delete(s.verifications, hash)
+		}
+	}
+	for hash, t := range s.magicLinks {
+		if owned(t.username) {
+			delete(s.magicLinks, hash)
+		}
+	}
+	for hash, code := range s.oauthCodes {
+		if owned(code.Username) {
+			delete(s.oauthCodes, hash)
+		}
+	}
+	s.apiKeys = slices.DeleteFunc(s.apiKeys, func(k *apiKey) bool { return owned(k.username) })
+	s.refreshTokens = slices.DeleteFunc(s.refreshTokens, func(r *refreshToken) bool { return owned(r.Username) })
+	s.identities = slices.DeleteFunc(s.identities, func(i database.Identity) bool { return owned(i.Username) })
+	s.passkeys = slices.DeleteFunc(s.passkeys, func(c database.WebAuthnCredential) bool { return owned(c.Username) })
+}
+
+// SaveSession inserts a session or replaces the stored one with the same id,
+// returning database.ErrSessionConflict if it was saved since session.Version.
+func (s *Service) SaveSession(ctx context.Context, session database.StoredSession) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if existing, ok := s.sessions[session.ID]; ok {
+		if existing.Version != session.Version {
+			return database.ErrSessionConflict
+		}
+		session.CreatedAt = existing.CreatedAt
+	}
+	session.Version++
+	session.CreatedAt, session.LastActive = stored(session.CreatedAt), stored(session.LastActive)
+	if !session.ExpiresAt.IsZero() {
+		session.ExpiresAt = stored(session.ExpiresAt)
+	}
+	session.Data = slices.Clone(session.Data)
+	s.sessions[session.ID] = session
+	return nil
+}
+
+// FindSession returns a stored session by id.
+func (s *Service) FindSession(ctx context.Context, id string) (database.StoredSession, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	session, ok := s.sessions[id]
+	if !ok {
+		return database.StoredSession{}, sql.ErrNoRows
+	}
+	session.Data = slices.Clone(session.Data)
+	return session, nil
+}
+
+// DeleteSession removes a stored session.
+func (s *Service) DeleteSession(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.sessions, id)
+	return nil
+}
+
+// FindUserSessions returns the stored sessions of a user.
+func (s *Service) FindUserSessions(ctx context.Context, username string) ([]database.StoredSession, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var sessions []database.StoredSession
+	for _, session := range s.sessions {
+		if session.Username == username {
+			session.Data = slices.Clone(session.Data)
+			sessions = append(sessions, session)
+		}
+	}
+	return sessions, nil
+}
+
+// DeleteExpiredSessions removes the sessions expired at now, and those
+// without an expiry not active since inactiveSince.
+func (s *Service) DeleteExpiredSessions(ctx context.Context, now, inactiveSince time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, session := range s.sessions {
+		if session.ExpiresAt.IsZero() {
+			if session.LastActive.Before(stored(inactiveSince)) {
+				delete(s.sessions, id)
+			}
+		} else if session.ExpiresAt.Before(stored(now)) {
+			delete(s.sessions, id)
+		}
+	}
+	return nil
+}
+
+// CreateInvitation stores the hash of a new invitation code.
+func (s *Service) CreateInvitation(ctx context.Context, codeHash string, inv database.Invitation) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.invitations[codeHash]; ok {
+		return errUnique
+	}
+	inv.ExpiresAt = stored(inv.ExpiresAt)
+	s.invitations[codeHash] = &invitation{Invitation: inv}
+	return nil
+}
+
+// RegisterInvitedUser uses an invitation and adds the new user, or neither.
+func (s *Service) RegisterInvitedUser(ctx context.Context, codeHash string, username string, email string, hashedPassword []byte) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	inv, ok := s.invitations[codeHash]
+	if !ok || inv.uses >= inv.MaxUses || !inv.ExpiresAt.After(now()) {
+		return "", sql.ErrNoRows
+	}
+	u, err := s.insertUser(username, email, hashedPassword)
+	if err != nil {
+		return "", err
+	}
+	inv.uses++
+	return strconv.FormatInt(u.id, 10), nil
+}
+
+// CreateVerificationToken stores the hash of an email verification token for a user.
+func (s *Service) CreateVerificationToken(ctx context.Context, username string, tokenHash string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.find(username) == nil {
+		return errForeignKey
+	}
+	if _, ok := s.verifications[tokenHash]; ok {
+		return errUnique
+	}
+	s.verifications[tokenHash] = token{username: username, createdAt: now(), expiresAt: stored(expiresAt)}
+	return nil
+}
+
+// ConsumeVerificationToken deletes a verification token and marks the email
+// of its user as verified.
+func (s *Service) ConsumeVerificationToken(ctx context.Context, tokenHash string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.verifications[tokenHash]
+	if !ok {
+		return "", sql.ErrNoRows
+	}
+	delete(s.verifications, tokenHash)
+	if time.Now().After(t.expiresAt) {
+		return "", sql.ErrNoRows
+	}
+	if u, err := s.active(t.username); err == nil {
+		u.verified, u.updatedAt = true, now()
+	}
+	return t.username, nil
+}
+
+// IsVerified reports whether the email of a user has been verified.
+func (s *Service) IsVerified(ctx context.Context, username string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, err := s.active(username)
+	if err != nil {
+		return false, err
+	}
+	return u.verified, nil
+}
+
+// SetTOTPSecret stores a pending TOTP secret for a user.
+func (s *Service) SetTOTPSecret(ctx context.Context, username string, secret string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if u, err := s.active(username); err == nil {
+		u.totpPendingSecret, u.updatedAt = secret, now()
+	}
+	return nil
+}
+
+// PendingTOTPSecret returns the pending TOTP secret of a user, "" if none.
+func (s *Service) PendingTOTPSecret(ctx context.Context, username string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, err := s.active(username)
+	if err != nil {
+		return "", err
+	}
+	return u.totpPendingSecret, nil
+}
+
+// EnableTOTP replaces the TOTP secret with the pending one, enables
+// two-factor authentication and replaces the recovery code hashes.
+func (s *Service) EnableTOTP(ctx context.Context, username string, recoveryCodeHashes []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u := s.find(username)
+	if u == nil {
+		if len(recoveryCodeHashes) > 0 {
+			return errForeignKey
+		}
+		return nil
+	}
+	if u.totpPendingSecret != "" && u.deletedAt == nil {
+		u.totpSecret, u.totpPendingSecret, u.totpEnabled, u.updatedAt = u.totpPendingSecret, "", true, now()
+	}
+	u.recoveryCodes = map[string]bool{}
+	for _, hash := range recoveryCodeHashes {
+		u.recoveryCodes[hash] = true
+	}
+	return nil
+}
+
+// TOTPSecret returns the TOTP secret of a user and whether it is enabled.
+func (s *Service) TOTPSecret(ctx context.Context, username string) (string, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, err := s.active(username)
+	if err != nil {
+		return "", false, err
+	}
+	return u.totpSecret, u.totpEnabled, nil
+}
+
+// UseTOTPStep records the time step of an accepted TOTP code.
+func (s *Service) UseTOTPStep(ctx context.Context, username string, step int64) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, err := s.active(username)
+	if err != nil || step <= u.totpLastStep {
+		return false, nil
+	}
+	u.totpLastStep = step
+	return true, nil
+}
+
+// UseRecoveryCode deletes a recovery code of a user.
+func (s *Service) UseRecoveryCode(ctx context.Context, username string, codeHash string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, u := range s.users {
+		if u.username == username && u.recoveryCodes[codeHash] {
+			delete(u.recoveryCodes, codeHash)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// CreateMagicLink stores the hash of a login link token for a user, and
+// removes its expired links.
+func (s *Service) CreateMagicLink(ctx context.Context, username string, tokenHash string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.find(username) == nil {
+		return errForeignKey
+	}
+	if _, ok := s.magicLinks[tokenHash]; ok {
+		return errUnique
+	}
+	for hash, t := range s.magicLinks {
+		if t.username == username && !t.expiresAt.After(now()) {
+			delete(s.magicLinks, hash)
+		}
+	}
+	s.magicLinks[tokenHash] = token{username: username, createdAt: now(), expiresAt: stored(expiresAt)}
+	return nil
+}
+
+// CountMagicLinks returns the number of login links created for a user since a time.
+func (s *Service) CountMagicLinks(ctx context.Context, username string, since time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for _, t := range s.magicLinks {
+		if t.username == username && !t.createdAt.Before(stored(since)) {
+			n++
+		}
+	}
+	return n, nil
+}
+
+// ConsumeMagicLink deletes a login link token and returns the username.
+func (s *Service) ConsumeMagicLink(ctx context.Context, tokenHash string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.magicLinks[tokenHash]
+	if !ok {
+		return "", sql.ErrNoRows
+	}
+	delete(s.magicLinks, tokenHash)
+	if time.Now().After(t.expiresAt) {
+		return "", sql.ErrNoRows
+	}
+	return t.username, nil
+}
+
+// AssignRole grants a role to an existing user.
+func (s *Service) AssignRole(ctx context.Context, username string, role string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, u := range s.users {
+		if u.username == username {
+			u.roles[role] = true
+			return nil
+		}
+	}
+	return errForeignKey
+}
+
+// RemoveRole revokes a role from a user.
+func (s *Service) RemoveRole(ctx context.Context, username string, role string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, u := range s.users {
+		if u.username == username {
+			delete(u.roles, role)
+		}
+	}
+	return nil
+}
+
+// roles returns the roles of a user, deleted or not, sorted.
+func (s *Service) roles(username string) []string {
+	roles := []string{}
+	for _, u := range s.users {
+		if u.username == username {
+			for role := range u.roles {
+				roles = append(roles, role)
+			}
+		}
+	}
+	slices.Sort(roles)
+	return roles
+}
+
+// UserRoles returns the roles of a user.
+func (s *Service) UserRoles(ctx context.Context, username string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.roles(username), nil
+}
+
+// HasRole reports whether a user has been granted a role.
+func (s *Service) HasRole(ctx context.Context, username string, role string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Contains(s.roles(username), role), nil
+}
+
+// GrantPermission allows a role to perform an action on a resource.
+func (s *Service) GrantPermission(ctx context.Context, role string, permission database.Permission) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.permissions[role] == nil {
+		s.permissions[role] = map[database.Permission]bool{}
+	}
+	s.permissions[role][permission] = true
+	return nil
+}
+
+// RevokePermission removes a permission from a role.
+func (s *Service) RevokePermission(ctx context.Context, role string, permission database.Permission) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.permissions[role], permission)
+	return nil
+}
+
+// RolePermissions returns the permissions granted to a role, sorted by
+// resource and action.
+func (s *Service) RolePermissions(ctx context.Context, role string) ([]database.Permission, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	permissions := []database.Permission{}
+	for p := range s.permissions[role] {
+		permissions = append(permissions, p)
+	}
+	slices.SortFunc(permissions, func(a, b database.Permission) int {
+		return cmp.Or(cmp.Compare(a.Resource, b.Resource), cmp.Compare(a.Action, b.Action))
+	})
+	return permissions, nil
+}
+
+// UserHasPermission reports whether any role of a user grants the permission,
+// either exactly or through a "*" wildcard.
+func (s *Service) UserHasPermission(ctx context.Context, username string, permission database.Permission) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, role := range s.roles(username) {
+		for p := range s.permissions[role] {
+			if (p.Action == permission.Action || p.Action == "*") && (p.Resource == permission.Resource || p.Resource == "*") {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// CreateAPIKey stores the hash of a new API key for a user and returns its id.
+func (s *Service) CreateAPIKey(ctx context.Context, username string, name string, prefix string, keyHash string, scopes []string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.find(username) == nil {
+		return 0, errForeignKey
+	}
+	for _, k := range s.apiKeys {
+		if k.hash == keyHash {
+			return 0, errUnique
+		}
+	}
+	s.nextID++
+	s.apiKeys = append(s.apiKeys, &apiKey{
+		APIKey: database.APIKey{
+			ID:        s.nextID,
+			Name:      name,
+			Prefix:    prefix,
+			Scopes:    slices.Clone(scopes),
+			CreatedAt: now(),
+		},
+		username: username,
+		hash:     keyHash,
+	})
+	return s.nextID, nil
+}
+
+// APIKeys returns the API keys of a user, including revoked ones.
+func (s *Service) APIKeys(ctx context.Context, username string) ([]database.APIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keys := []database.APIKey{}
+	for _, k := range s.apiKeys {
+		if k.username == username {
+			key := k.APIKey
+			key.Scopes = slices.Clone(key.Scopes)
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+// RevokeAPIKey revokes an active API key owned by a user.
+func (s *Service) RevokeAPIKey(ctx context.Context, username string, id int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, k := range s.apiKeys {
+		if k.ID == id && k.username == username && k.RevokedAt == nil {
+			t := now()
+			k.RevokedAt = &t
+			return nil
+		}
+	}
+	return sql.ErrNoRows
+}
+
+// RevokeUserAPIKeys revokes every active API key of a user.
+func (s *Service) RevokeUserAPIKeys(ctx context.Context, username string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, k := range s.apiKeys {
+		if k.username == username && k.RevokedAt == nil {
+			t := now()
+			k.RevokedAt = &t
+		}
+	}
+	return nil
+}
+
+// AuthenticateAPIKey returns the owner and scopes of an active API key and records its use.
+func (s *Service) AuthenticateAPIKey(ctx context.Context, keyHash string) (string, []string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, k := range s.apiKeys {
+		if k.hash != keyHash || k.RevokedAt != nil {
+			continue
+		}
+		if u, err := s.active(k.username); err != nil || u.status != database.StatusActive {
+			break
+		}
+		t := now()
+		k.LastUsedAt = &t
+		return k.username, slices.Clone(k.Scopes), nil
+	}
+	return "", nil, sql.ErrNoRows
+}
+
+// findRefreshToken returns a refresh token by hash.
+func (s *Service) findRefreshToken(tokenHash string) *refreshToken {
+	for _, r := range s.refreshTokens {
+		if r.hash == tokenHash {
+			return r
+		}
+	}
+	return nil
+}
+
+// SaveRefreshToken stores the hash of a refresh token, and removes the
+// expired tokens of its user.
+func (s *Service) SaveRefreshToken(ctx context.Context, tokenHash string, t database.RefreshToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.find(t.Username) == nil {
+		return errForeignKey
+	}
+	if s.findRefreshToken(tokenHash) != nil {
+		return errUnique
+	}
+	s.refreshTokens = slices.DeleteFunc(s.refreshTokens, func(r *refreshToken) bool {
+		return r.Username == t.Username && !r.ExpiresAt.After(now())
+	})
+	t.Scopes, t.ExpiresAt, t.Used = slices.Clone(t.Scopes), stored(t.ExpiresAt), false
+	s.refreshTokens = append(s.refreshTokens, &refreshToken{RefreshToken: t, hash: tokenHash})
+	return nil
+}
+
+// UseRefreshToken marks a refresh token as used and returns it as it was before.
+func (s *Service) UseRefreshToken(ctx context.Context, tokenHash string) (database.RefreshToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r := s.findRefreshToken(tokenHash)
+	if r == nil {
+		return database.RefreshToken{}, sql.ErrNoRows
+	}
+	t := r.RefreshToken
+	t.Scopes = slices.Clone(t.Scopes)
+	r.Used = true
+	return t, nil
+}
+
+// FindRefreshToken returns a refresh token by hash.
+func (s *Service) FindRefreshToken(ctx context.Context, tokenHash string) (database.RefreshToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r := s.findRefreshToken(tokenHash)
+	if r == nil {
+		return database.RefreshToken{}, sql.ErrNoRows
+	}
+	t := r.RefreshToken
+	t.Scopes = slices.Clone(t.Scopes)
+	return t, nil
+}
+
+// RevokeRefreshTokenFamily deletes every refresh token of a family.
+func (s *Service) RevokeRefreshTokenFamily(ctx context.Context, family string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.refreshTokens = slices.DeleteFunc(s.refreshTokens, func(r *refreshToken) bool { return r.Family == family })
+	return nil
+}
+
+// RevokeUserRefreshTokens deletes every refresh token of a user.
+func (s *Service) RevokeUserRefreshTokens(ctx context.Context, username string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.refreshTokens = slices.DeleteFunc(s.refreshTokens, func(r *refreshToken) bool { return r.Username == username })
+	return nil
+}
+
+// CreateOAuthClient registers an OAuth client.
+func (s *Service) CreateOAuthClient(ctx context.Context, client database.OAuthClient) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.oauthClients[client.ID]; ok {
+		return errUnique
+	}
+	client.RedirectURIs, client.Scopes = slices.Clone(client.RedirectURIs), slices.Clone(client.Scopes)
+	s.oauthClients[client.ID] = client
+	return nil
+}
+
+// OAuthClient returns a registered OAuth client by id.
+func (s *Service) OAuthClient(ctx context.Context, id string) (database.OAuthClient, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	client, ok := s.oauthClients[id]
+	if !ok {
+		return database.OAuthClient{}, sql.ErrNoRows
+	}
+	client.RedirectURIs, client.Scopes = slices.Clone(client.RedirectURIs), slices.Clone(client.Scopes)
+	return client, nil
+}
+
+// SaveOAuthCode stores the hash of an authorization code, and removes the expired codes.
+func (s *Service) SaveOAuthCode(ctx context.Context, codeHash string, code database.OAuthCode) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.oauthClients[code.ClientID]; !ok || s.find(code.Username) == nil {
+		return errForeignKey
+	}
+	for hash, c := range s.oauthCodes {
+		if !c.ExpiresAt.After(now()) {
+			delete(s.oauthCodes, hash)
+		}
+	}
+	if _, ok := s.oauthCodes[codeHash]; ok {
+		return errUnique
+	}
+	code.Scopes, code.ExpiresAt = slices.Clone(code.Scopes), stored(code.ExpiresAt)
+	s.oauthCodes[codeHash] = code
+	return nil
+}
+
+// UseOAuthCode deletes an authorization code and returns it.
+func (s *Service) UseOAuthCode(ctx context.Context, codeHash string) (database.OAuthCode, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	code, ok := s.oauthCodes[codeHash]
+	if !ok {
+		return database.OAuthCode{}, sql.ErrNoRows
+	}
+	delete(s.oauthCodes, codeHash)
+	return code, nil
+}
+
+// RecordAuthEvent appends an event to the authentication audit log.
+func (s *Service) RecordAuthEvent(ctx context.Context, event database.AuthEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = time.Now()
+	}
+	event.ID, event.CreatedAt = int64(len(s.events)+1), stored(event.CreatedAt)
+	s.events = append(s.events, event)
+	return nil
+}
+
+// AuthEvents returns audit log events matching the filter, newest first.
+func (s *Service) AuthEvents(ctx context.Context, filter database.AuthEventFilter) ([]database.AuthEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if filter.Limit <= 0 {
+		filter.Limit = 100
+	}
+	events := []database.AuthEvent{}
+	for i := len(s.events) - 1; i >= 0 && len(events) < filter.Limit; i-- {
+		e := s.events[i]
+		if (filter.Username == "" || e.Username == filter.Username) &&
+			(filter.Type == "" || e.Type == filter.Type) &&
+			(filter.Before <= 0 || e.ID < filter.Before) {
+			events = append(events, e)
+		}
+	}
+	return events, nil
+}
+
+// LinkIdentity links an external identity to a user, which has at most one
+// identity per provider.
+func (s *Service) LinkIdentity(ctx context.Context, identity database.Identity) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.find(identity.Username) == nil {
+		return errForeignKey
+	}
+	for _, i := range s.identities {
+		if i.Provider == identity.Provider && (i.Subject == identity.Subject || i.Username == identity.Username) {
+			return errUnique
+		}
+	}
+	identity.Email, identity.CreatedAt = normalizeEmail(identity.Email), now()
+	s.identities = append(s.identities, identity)
+	return nil
+}
+
+// FindIdentity returns the identity of a provider subject.
+func (s *Service) FindIdentity(ctx context.Context, provider string, subject string) (database.Identity, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, i := range s.identities {
+		if i.Provider == provider && i.Subject == subject {
+			return i, nil
+		}
+	}
+	return database.Identity{}, sql.ErrNoRows
+}
+
+// UserIdentities returns the identities linked to a user, sorted by provider.
+func (s *Service) UserIdentities(ctx context.Context, username string) ([]database.Identity, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	identities := []database.Identity{}
+	for _, i := range s.identities {
+		if i.Username == username {
+			identities = append(identities, i)
+		}
+	}
+	slices.SortFunc(identities, func(a, b database.Identity) int { return cmp.Compare(a.Provider, b.Provider) })
+	return identities, nil
+}
+
+// UnlinkIdentity removes the identity of a provider from a user.
+func (s *Service) UnlinkIdentity(ctx context.Context, username string, provider string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := len(s.identities)
+	s.identities = slices.DeleteFunc(s.identities, func(i database.Identity) bool {
+		return i.Username == username && i.Provider == provider
+	})
+	if len(s.identities) == n {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// AddWebAuthnCredential stores a passkey registered by a user.
+func (s *Service) AddWebAuthnCredential(ctx context.Context, credential database.WebAuthnCredential) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.find(credential.Username) == nil {
+		return errForeignKey
+	}
+	for _, c := range s.passkeys {
+		if string(c.ID) == string(credential.ID) {
+			return errUnique
+		}
+	}
+	credential.ID, credential.PublicKey = slices.Clone(credential.ID), slices.Clone(credential.PublicKey)
+	s.passkeys = append(s.passkeys, credential)
+	return nil
+}
+
+// WebAuthnCredentials returns the passkeys of a user.
+func (s *Service) WebAuthnCredentials(ctx context.Context, username string) ([]database.WebAuthnCredential, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	credentials := []database.WebAuthnCredential{}
+	for _, c := range s.passkeys {
+		if c.Username == username {
+			credentials = append(credentials, c)
+		}
+	}
+	return credentials, nil
+}
+
+// FindWebAuthnCredential returns a passkey by credential id.
+func (s *Service) FindWebAuthnCredential(ctx context.Context, id []byte) (database.WebAuthnCredential, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, c := range s.passkeys {
+		if string(c.ID) == string(id) {
+			return c, nil
+		}
+	}
+	return database.WebAuthnCredential{}, sql.ErrNoRows
+}
+
+// UpdateWebAuthnSignCount records the signature counter of a passkey after a login.
+func (s *Service) UpdateWebAuthnSignCount(ctx context.Context, id []byte, signCount uint32) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, c := range s.passkeys {
+		if string(c.ID) == string(id) {
+			s.passkeys[i].SignCount = signCount
+		}
+	}
+	return nil
+}
@@ -0,0 +1,13 @@
+package fake_test
+
+import (
+	"testing"
+
+	"github.com/raziel-aleman/go-starter/internal/database"
+	"github.com/raziel-aleman/go-starter/internal/database/databasetest"
+	"github.com/raziel-aleman/go-starter/internal/database/fake"
+)
+
+func TestServiceConformance(t *testing.T) {
+	databasetest.RunServiceTests(t, func(t *testing.T) database.Service { return fake.New() })
+}
@@ -0,0 +1,174 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/raziel-aleman/go-starter/internal/database/fixtures"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// identifier matches the table and column names fixtures may insert into,
+// since they are written in the statements unquoted.
+var identifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// LoadFixtures inserts the rows of fixture sets in one transaction. Tables
+// are filled after the tables they reference, the plaintext passwords of
+// users are hashed, and users get the timestamps, UUID and tenant of users
+// created by RegisterUser unless the fixtures set them.
+func (s *service) LoadFixtures(ctx context.Context, sets ...fixtures.Set) error {
+	set := fixtures.Merge(sets...)
+	if err := set.HashPasswords(bcrypt.DefaultCost); err != nil {
+		return err
+	}
+	tables := make([]string, 0, len(set))
+	for table, rows := range set {
+		if !identifier.MatchString(table) {
+			return fmt.Errorf("fixtures: invalid table name %q", table)
+		}
+		for _, row := range rows {
+			for column := range row {
+				if !identifier.MatchString(column) {
+					return fmt.Errorf("fixtures: invalid column name %q in %s", column, table)
+				}
+			}
+		}
+		tables = append(tables, table)
+	}
+	slices.Sort(tables)
+
+	return s.withTx(ctx, func(t *tx) error {
+		ordered, err := orderByForeignKeys(ctx, t, tables)
+		if err != nil {
+			return err
+		}
+		for _, table := range ordered {
+			for i, row := range set[table] {
+				if table == "users" {
+					row = userFixture(ctx, row)
+				}
+				columns := make([]string, 0, len(row))
+				for column := range row {
+					columns = append(columns, column)
+				}
+				slices.Sort(columns)
+				args := make([]any, len(columns))
+				for j, column := range columns {
+					args[j] = fixtureValue(row[column])
+				}
+				query := "INSERT INTO " + table + " (" + strings.Join(columns, ", ") + ") VALUES (" + strings.Repeat(", ?", len(columns))[2:] + ")"
+				if _, err := t.ExecContext(ctx, query, args...); err != nil {
+					return fmt.Errorf("fixtures: error inserting %s[%d]: %v", table, i, err)
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// userFixture returns a users row with the values RegisterUser would set.
+func userFixture(ctx context.Context, row fixtures.Row) fixtures.Row {
+	now := time.Now().UTC().Format(time.RFC3339)
+	defaults := fixtures.Row{
+		"tenant_id":           tenantOf(ctx),
+		"uuid":                NewUUIDv7(),
+		"created_at":          now,
+		"updated_at":          now,
+		"password_changed_at": now,
+	}
+	user := fixtures.Row{}
+	for column, value := range defaults {
+		user[column] = value
+	}
+	for column, value := range row {
+		user[column] = value
+	}
+	if email, ok := user["email"].(string); ok {
+		user["email"] = normalizeEmail(email)
+	}
+	if password, ok := user["password"].(string); ok {
+		user["password"] = []byte(password)
+	}
+	return user
+}
+
+// fixtureValue converts a fixture value to a statement argument. No column
+// is boolean, true and false are stored as 1 and 0.
+func fixtureValue(value any) any {
+	if b, ok := value.(bool); ok {
+		if b {
+			return int64(1)
+		}
+		return int64(0)
+	}
+	return value
+}
+
+// orderByForeignKeys sorts tables so each comes after the tables it
+// references. Tables referencing each other cannot be ordered.
+func orderByForeignKeys(ctx context.Context, t *tx, tables []string) ([]string, error) {
+	var query string
+	switch t.driver {
+	case DriverPostgres:
+		query = `SELECT DISTINCT ccu.table_name FROM information_schema.table_constraints tc
+			JOIN information_schema.constraint_column_usage ccu ON ccu.constraint_schema = tc.constraint_schema AND ccu.constraint_name = tc.constraint_name
+			WHERE tc.constraint_type = 'FOREIGN KEY' AND tc.table_schema = current_schema() AND tc.table_name = ?`
+	case DriverMySQL:
+		query = `SELECT DISTINCT REFERENCED_TABLE_NAME FROM information_schema.KEY_COLUMN_USAGE
+			WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND REFERENCED_TABLE_NAME IS NOT NULL`
+	default:
+		query = `SELECT DISTINCT "table" FROM pragma_foreign_key_list(?)`
+	}
+
+	references := map[string][]string{}
+	for _, table := range tables {
+		rows, err := t.QueryContext(ctx, query, table)
+		if err != nil {
+			return nil, fmt.Errorf("fixtures: error reading the foreign keys of %s: %v", table, err)
+		}
+		for rows.Next() {
+			var referenced string
+			if err := rows.Scan(&referenced); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			if referenced != table && slices.Contains(tables, referenced) {
+				references[table] = append(references[table], referenced)
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	ordered := make([]string, 0, len(tables))
+	done := map[string]bool{}
+	var visit func(table string, path []string) error
+	visit = func(table string, path []string) error {
+		if done[table] {
+			return nil
+		}
+		if slices.Contains(path, table) {
+			return fmt.Errorf("fixtures: tables %s reference each other", strings.Join(append(path, table), " -> "))
+		}
+		for _, referenced := range references[table] {
+			if err := visit(referenced, append(path, table)); err != nil {
+				return err
+			}
+		}
+		done[table] = true
+		ordered = append(ordered, table)
+		return nil
+	}
+	for _, table := range tables {
+		if err := visit(table, nil); err != nil {
+			return nil, err
+		}
+	}
+	return ordered, nil
+}
@@ -0,0 +1,127 @@
+// Package fixtures reads declarative data files, listing the rows to insert
+// in each table, for tests and for seeding development databases:
+//
+//	users:
+//	  - username: alice
+//	    password: secret # Hashed when loaded
+//	    email: alice@example.com
+//	user_roles:
+//	  - username: alice
+//	    role: admin
+//
+// Files are JSON, or YAML limited to this shape: a mapping of table names to
+// sequences of rows, whose values are scalars. The rows are inserted by
+// database.Service.LoadFixtures, which orders the tables by their foreign keys.
+package fixtures
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Row is a row of a table: its values by column. Values are strings,
+// int64, float64, bool, or nil for NULL.
+type Row map[string]any
+
+// Set is the content of fixture files: rows by table.
+type Set map[string][]Row
+
+// ReadFile reads a fixture file, JSON if its extension is .json and YAML if
+// it is .yaml or .yml.
+func ReadFile(path string) (Set, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(path, data)
+}
+
+// Parse parses the content of a fixture file, its format given by the
+// extension of its name.
+func Parse(name string, data []byte) (Set, error) {
+	var set Set
+	var err error
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".json":
+		set, err = parseJSON(data)
+	case ".yaml", ".yml":
+		set, err = parseYAML(data)
+	default:
+		return nil, fmt.Errorf("fixtures: unsupported file %s, use .json, .yaml or .yml", name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("fixtures: %s: %v", name, err)
+	}
+	return set, nil
+}
+
+// parseJSON parses an object of arrays of flat objects.
+func parseJSON(data []byte) (Set, error) {
+	var raw map[string][]map[string]any
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&raw); err != nil {
+		return nil, err
+	}
+
+	set := Set{}
+	for table, rows := range raw {
+		set[table] = make([]Row, 0, len(rows))
+		for i, values := range rows {
+			row := Row{}
+			for column, value := range values {
+				switch v := value.(type) {
+				case json.Number:
+					if n, err := v.Int64(); err == nil {
+						row[column] = n
+					} else if row[column], err = v.Float64(); err != nil {
+						return nil, fmt.Errorf("%s[%d].%s: %v", table, i, column, err)
+					}
+				case string, bool, nil:
+					row[column] = v
+				default:
+					return nil, fmt.Errorf("%s[%d].%s: nested values are not supported, use a string", table, i, column)
+				}
+			}
+			set[table] = append(set[table], row)
+		}
+	}
+	return set, nil
+}
+
+// Merge returns the rows of every set.
+func Merge(sets ...Set) Set {
+	merged := Set{}
+	for _, set := range sets {
+		for table, rows := range set {
+			merged[table] = append(merged[table], rows...)
+		}
+	}
+	return merged
+}
+
+// HashPasswords replaces the plaintext passwords of the users rows by their
+// bcrypt hash of the given cost. Passwords already hashed are kept.
+func (s Set) HashPasswords(cost int) error {
+	for i, row := range s["users"] {
+		password, ok := row["password"].(string)
+		if !ok {
+			return fmt.Errorf("fixtures: users[%d]: password must be a string", i)
+		}
+		if _, err := bcrypt.Cost([]byte(password)); err == nil {
+			continue
+		}
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), cost)
+		if err != nil {
+			return fmt.Errorf("fixtures: users[%d]: %v", i, err)
+		}
+		row["password"] = string(hash)
+	}
+	return nil
+}
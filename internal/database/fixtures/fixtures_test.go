@@ -0,0 +1,84 @@
+package fixtures
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestParseYAMLAndJSON(t *testing.T) {
+	yaml := `---
+# Comments are ignored
+users:
+  - username: alice # Trailing comment
+    password: "p#ss"
+    age: 30
+    score: 1.5
+    active: true
+    bio: ~
+  -
+    username: 'it''s bob'
+posts: []
+`
+	json := `{
+	"users": [
+		{"username": "alice", "password": "p#ss", "age": 30, "score": 1.5, "active": true, "bio": null},
+		{"username": "it's bob"}
+	],
+	"posts": []
+}`
+	expected := Set{
+		"users": {
+			{"username": "alice", "password": "p#ss", "age": int64(30), "score": 1.5, "active": true, "bio": nil},
+			{"username": "it's bob"},
+		},
+		"posts": {},
+	}
+
+	for name, data := range map[string]string{"data.yaml": yaml, "data.json": json} {
+		set, err := Parse(name, []byte(data))
+		if err != nil {
+			t.Fatalf("error parsing %s. Err: %v", name, err)
+		}
+		if !reflect.DeepEqual(set, expected) {
+			t.Errorf("expected %v from %s; got %v", expected, name, set)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := map[string]string{
+		"data.yaml":  "  - username: alice\n",
+		"dup.yaml":   "users:\n  - a: 1\n    a: 2\n",
+		"flow.yaml":  "users:\n  - roles: [admin]\n",
+		"rows.yaml":  "users: alice\n",
+		"indent.yml": "users:\n  - a: 1\n      b: 2\n",
+		"data.json":  `{"users": [{"roles": ["admin"]}]}`,
+		"data.toml":  "",
+	}
+	for name, data := range tests {
+		if _, err := Parse(name, []byte(data)); err == nil || !strings.Contains(err.Error(), name) {
+			t.Errorf("expected an error naming %s; got %v", name, err)
+		}
+	}
+}
+
+func TestHashPasswords(t *testing.T) {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("kept"), bcrypt.MinCost)
+	set := Set{"users": {{"password": "secret"}, {"password": string(hash)}}}
+	if err := set.HashPasswords(bcrypt.MinCost); err != nil {
+		t.Fatalf("error hashing passwords. Err: %v", err)
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(set["users"][0]["password"].(string)), []byte("secret")); err != nil {
+		t.Errorf("expected the plaintext password to be hashed; got %v", err)
+	}
+	if set["users"][1]["password"] != string(hash) {
+		t.Errorf("expected the hashed password to be kept")
+	}
+
+	if err := (Set{"users": {{"password": int64(1)}}}).HashPasswords(bcrypt.MinCost); err == nil {
+		t.Errorf("expected an error for a password that is not a string")
+	}
+}
@@ -0,0 +1,170 @@
+package fixtures
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// parseYAML parses the subset of YAML describing a Set: a block mapping of
+// table names to block sequences of rows, each a block mapping of columns to
+// scalars. Comments, quoted scalars, and "[]" for a table without rows are
+// supported; anchors, flow collections, multi-line and nested values are not.
+func parseYAML(data []byte) (Set, error) {
+	set := Set{}
+	var (
+		table     string
+		row       Row
+		rowIndent int // Column of the keys of the current row, negative until known
+	)
+	for n, line := range strings.Split(string(data), "\n") {
+		fail := func(format string, args ...any) error {
+			return fmt.Errorf("line %d: %s", n+1, fmt.Sprintf(format, args...))
+		}
+		line = strings.TrimRight(stripComment(line), " \t\r")
+		content := strings.TrimLeft(line, " ")
+		indent := len(line) - len(content)
+		switch {
+		case content == "":
+			continue
+		case strings.HasPrefix(content, "\t"):
+			return nil, fail("tabs cannot indent YAML")
+		case content == "---" && indent == 0 && len(set) == 0:
+			continue
+		}
+
+		// A table, at the top level
+		if indent == 0 && !strings.HasPrefix(content, "-") {
+			key, value, err := splitPair(content)
+			if err != nil {
+				return nil, fail("%v", err)
+			}
+			if _, ok := set[key]; ok {
+				return nil, fail("duplicate table %q", key)
+			}
+			switch value {
+			case "":
+			case "[]":
+			default:
+				return nil, fail("table %q must be a sequence of rows", key)
+			}
+			table, row = key, nil
+			set[table] = []Row{}
+			continue
+		}
+		if table == "" {
+			return nil, fail("expected a table name")
+		}
+
+		// A row, starting with its first column
+		if content == "-" || strings.HasPrefix(content, "- ") {
+			row = Row{}
+			set[table] = append(set[table], row)
+			rest := strings.TrimLeft(strings.TrimPrefix(content, "-"), " ")
+			if rest == "" {
+				// The columns follow on the next lines, more indented
+				rowIndent = -(indent + 1)
+				continue
+			}
+			rowIndent = indent + len(content) - len(rest)
+			content, indent = rest, rowIndent
+		}
+
+		// A column of the current row
+		if row == nil {
+			return nil, fail("expected a row starting with \"- \"")
+		}
+		if rowIndent < 0 && indent >= -rowIndent {
+			rowIndent = indent
+		}
+		if indent != rowIndent {
+			return nil, fail("columns of a row must be aligned")
+		}
+		key, value, err := splitPair(content)
+		if err != nil {
+			return nil, fail("%v", err)
+		}
+		if _, ok := row[key]; ok {
+			return nil, fail("duplicate column %q", key)
+		}
+		if row[key], err = parseScalar(value); err != nil {
+			return nil, fail("column %q: %v", key, err)
+		}
+	}
+	return set, nil
+}
+
+// stripComment removes a comment from a line: a "#" starting the line or
+// following a space, outside quotes.
+func stripComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote == '"' && c == '\\':
+			i++
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// splitPair splits "key: value" into its key and value.
+func splitPair(content string) (string, string, error) {
+	key, value, ok := strings.Cut(content, ":")
+	if !ok || (value != "" && value[0] != ' ') {
+		return "", "", fmt.Errorf("expected \"key: value\", got %q", content)
+	}
+	key = strings.TrimSpace(key)
+	if unquoted, err := parseScalar(key); err == nil {
+		if s, ok := unquoted.(string); ok {
+			key = s
+		}
+	}
+	if key == "" {
+		return "", "", errors.New("empty key")
+	}
+	return key, strings.TrimSpace(value), nil
+}
+
+// parseScalar converts a YAML scalar to a string, int64, float64, bool, or
+// nil, as a YAML 1.2 core schema parser would.
+func parseScalar(value string) (any, error) {
+	switch {
+	case strings.HasPrefix(value, `"`):
+		var s string
+		if len(value) < 2 || !strings.HasSuffix(value, `"`) || json.Unmarshal([]byte(value), &s) != nil {
+			return nil, fmt.Errorf("invalid double-quoted string %s", value)
+		}
+		return s, nil
+	case strings.HasPrefix(value, "'"):
+		if len(value) < 2 || !strings.HasSuffix(value, "'") {
+			return nil, fmt.Errorf("invalid single-quoted string %s", value)
+		}
+		return strings.ReplaceAll(value[1:len(value)-1], "''", "'"), nil
+	case value == "", value == "~", value == "null", value == "Null", value == "NULL":
+		return nil, nil
+	case value == "true", value == "True", value == "TRUE":
+		return true, nil
+	case value == "false", value == "False", value == "FALSE":
+		return false, nil
+	case strings.ContainsAny(value[:1], "[{&*!|>%@`"):
+		return nil, fmt.Errorf("unsupported value %s, quote it or use a JSON file", value)
+	}
+	if n, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return n, nil
+	}
+	if f, err := strconv.ParseFloat(value, 64); err == nil && strings.ContainsAny(value, "0123456789") && !strings.ContainsAny(value, "xX_") {
+		return f, nil
+	}
+	return value, nil
+}
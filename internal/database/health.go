@@ -0,0 +1,109 @@
+package database
+
+import (
+	"context"
+	"strconv"
+	"time"
+)
+
+// Health states, from best to worst.
+const (
+	HealthUp       = "up"
+	HealthDegraded = "degraded" // Serving, with a problem worth looking at
+	HealthDown     = "down"     // Not serving
+)
+
+// HealthStatus is the overall state of the database, the worst of its checks.
+type HealthStatus struct {
+	Status string                 `json:"status"`
+	Checks map[string]HealthCheck `json:"checks"`
+}
+
+// HealthCheck is the state of one aspect of the database.
+type HealthCheck struct {
+	Status  string            `json:"status"`
+	Message string            `json:"message,omitempty"`
+	Details map[string]string `json:"details,omitempty"`
+}
+
+// add records a check, lowering the overall status to its state.
+func (h *HealthStatus) add(name string, check HealthCheck) {
+	h.Checks[name] = check
+	if healthRank(check.Status) > healthRank(h.Status) {
+		h.Status = check.Status
+	}
+}
+
+// healthRank orders health states from best to worst.
+func healthRank(status string) int {
+	switch status {
+	case HealthUp:
+		return 0
+	case HealthDegraded:
+		return 1
+	}
+	return 2
+}
+
+// Health pings the primary database and evaluates its connection pool
+// statistics and the replicas. An unreachable primary is down, pool pressure
+// and replicas out of use are degraded.
+func (s *service) Health(ctx context.Context) HealthStatus {
+	health := HealthStatus{Status: HealthUp, Checks: make(map[string]HealthCheck)}
+
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+	if err := s.db.PingContext(ctx); err != nil {
+		health.add("ping", HealthCheck{Status: HealthDown, Message: "db down: " + err.Error()})
+	} else {
+		health.add("ping", HealthCheck{Status: HealthUp})
+	}
+
+	health.add("pool", poolHealth(s.db))
+
+	for _, r := range s.replicas {
+		check := HealthCheck{Status: HealthUp}
+		if !r.healthy.Load() {
+			// Reads fall back to the primary, so the service still works
+			check = HealthCheck{Status: HealthDegraded, Message: "Replica unreachable or lagging, reads use the primary."}
+		}
+		health.add("replica "+r.name, check)
+	}
+	return health
+}
+
+// poolHealth evaluates the statistics of a connection pool.
+func poolHealth(db *conn) HealthCheck {
+	dbStats := db.Stats()
+	check := HealthCheck{
+		Status: HealthUp,
+		Details: map[string]string{
+			"open_connections":     strconv.Itoa(dbStats.OpenConnections),
+			"max_open_connections": strconv.Itoa(dbStats.MaxOpenConnections),
+			"in_use":               strconv.Itoa(dbStats.InUse),
+			"idle":                 strconv.Itoa(dbStats.Idle),
+			"wait_count":           strconv.FormatInt(dbStats.WaitCount, 10),
+			"wait_duration":        dbStats.WaitDuration.String(),
+			"max_idle_closed":      strconv.FormatInt(dbStats.MaxIdleClosed, 10),
+			"max_lifetime_closed":  strconv.FormatInt(dbStats.MaxLifetimeClosed, 10),
+		},
+	}
+
+	degraded := func(message string) {
+		check.Status = HealthDegraded
+		check.Message = message
+	}
+	if limit := dbStats.MaxOpenConnections; limit > 0 && dbStats.OpenConnections >= limit*4/5 {
+		degraded("The database is experiencing heavy load, consider raising BLUEPRINT_DB_MAX_OPEN_CONNS.")
+	}
+	if dbStats.WaitCount > 1000 {
+		degraded("The database has a high number of wait events, indicating potential bottlenecks.")
+	}
+	if dbStats.MaxIdleClosed > int64(dbStats.OpenConnections)/2 {
+		degraded("Many idle connections are being closed, consider raising BLUEPRINT_DB_MAX_IDLE_CONNS.")
+	}
+	if dbStats.MaxLifetimeClosed > int64(dbStats.OpenConnections)/2 {
+		degraded("Many connections are being closed due to max lifetime, consider increasing BLUEPRINT_DB_CONN_MAX_LIFETIME or revising the connection usage pattern.")
+	}
+	return check
+}
@@ -0,0 +1,92 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// Identity links an account at an external identity provider to a local user.
+type Identity struct {
+	Provider  string    `json:"provider"`
+	Subject   string    `json:"subject"` // Stable user id at the provider
+	Username  string    `json:"-"`
+	Email     string    `json:"email,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// LinkIdentity links an external identity to a user. A user has at most one
+// identity per provider.
+func (s *service) LinkIdentity(ctx context.Context, identity Identity) error {
+	_, err := s.db.ExecContext(ctx,
+		"INSERT INTO identities (provider, subject, username, email, created_at) VALUES (?, ?, ?, NULLIF(?, ''), ?)",
+		identity.Provider,
+		identity.Subject,
+		identity.Username,
+		normalizeEmail(identity.Email),
+		time.Now().UTC().Format(time.RFC3339),
+	)
+	return err
+}
+
+// FindIdentity returns the identity of a provider subject, with the user it
+// is linked to.
+func (s *service) FindIdentity(ctx context.Context, provider string, subject string) (Identity, error) {
+	identities, err := s.queryIdentities(ctx,
+		"SELECT provider, subject, username, email, created_at FROM identities WHERE provider = ? AND subject = ?",
+		provider,
+		subject,
+	)
+	if err != nil {
+		return Identity{}, err
+	}
+	if len(identities) == 0 {
+		return Identity{}, sql.ErrNoRows
+	}
+	return identities[0], nil
+}
+
+// UserIdentities returns the identities linked to a user.
+func (s *service) UserIdentities(ctx context.Context, username string) ([]Identity, error) {
+	return s.queryIdentities(ctx,
+		"SELECT provider, subject, username, email, created_at FROM identities WHERE username = ? ORDER BY provider",
+		username,
+	)
+}
+
+// UnlinkIdentity removes the identity of a provider from a user. It returns
+// sql.ErrNoRows if the user has none.
+func (s *service) UnlinkIdentity(ctx context.Context, username string, provider string) error {
+	return s.execOne(ctx,
+		"DELETE FROM identities WHERE username = ? AND provider = ?",
+		username,
+		provider,
+	)
+}
+
+// queryIdentities runs a query selecting identities.
+func (s *service) queryIdentities(ctx context.Context, query string, args ...any) ([]Identity, error) {
+	ctx, cancel := s.db.readContext(ctx)
+	defer cancel()
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	identities := []Identity{}
+	for rows.Next() {
+		var identity Identity
+		var email sql.NullString
+		var createdAt string
+		if err := rows.Scan(&identity.Provider, &identity.Subject, &identity.Username, &email, &createdAt); err != nil {
+			return nil, err
+		}
+		identity.Email = email.String
+		if identity.CreatedAt, err = time.Parse(time.RFC3339, createdAt); err != nil {
+			return nil, err
+		}
+		identities = append(identities, identity)
+	}
+	return identities, rows.Err()
+}
@@ -0,0 +1,47 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/raziel-aleman/go-starter/internal/database/queries"
+)
+
+// Invitation allows registering up to MaxUses users before it expires. The
+// code itself is only stored hashed.
+type Invitation struct {
+	CreatedBy string
+	MaxUses   int
+	ExpiresAt time.Time
+}
+
+// CreateInvitation stores the hash of a new invitation code.
+func (s *service) CreateInvitation(ctx context.Context, codeHash string, invitation Invitation) error {
+	return queries.New(s.db).CreateInvitation(ctx, queries.CreateInvitationParams{
+		CodeHash:  codeHash,
+		CreatedBy: invitation.CreatedBy,
+		MaxUses:   int64(invitation.MaxUses),
+		CreatedAt: time.Now().UTC().Format(time.RFC3339),
+		ExpiresAt: invitation.ExpiresAt.UTC().Format(time.RFC3339),
+	})
+}
+
+// RegisterInvitedUser uses an invitation and inserts the new user in the same
+// transaction, so a failed registration does not count as a use. Unknown,
+// expired, or used up invitations return sql.ErrNoRows.
+func (s *service) RegisterInvitedUser(ctx context.Context, codeHash string, username string, email string, hashedPassword []byte) (string, error) {
+	var id string
+	err := s.withTx(ctx, func(t *tx) error {
+		err := oneRow(queries.New(t).UseInvitation(ctx, queries.UseInvitationParams{
+			CodeHash:  codeHash,
+			ExpiresAt: time.Now().UTC().Format(time.RFC3339),
+		}))
+		if err != nil {
+			return err
+		}
+
+		id, err = insertUser(ctx, t, username, email, hashedPassword)
+		return err
+	})
+	return id, err
+}
@@ -0,0 +1,23 @@
+package database
+
+import (
+	"fmt"
+	"net/url"
+)
+
+// libsqlDSN adds the auth token and the foreign key enforcement the schema
+// relies on to a libsql URL such as "libsql://app-org.turso.io". The token
+// is kept out of BLUEPRINT_DB_URL, so it is never logged with it.
+func libsqlDSN(dsn string, authToken string) (string, error) {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return "", fmt.Errorf("error parsing libsql URL: %v", err)
+	}
+	query := u.Query()
+	if authToken != "" {
+		query.Set("authToken", authToken)
+	}
+	query.Set("_fk", "true")
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
@@ -0,0 +1,428 @@
+// Package libsql is a database/sql driver for remote libsql databases, like
+// Turso, speaking the Hrana protocol over HTTP. Importing it registers the
+// "libsql" driver, opened with the database URL, libsql://, https://, or
+// http:// for a local sqld, an optional authToken query parameter, and
+// _fk=true to enforce foreign keys like the go-sqlite3 parameter. Embedded
+// replicas need the libsql C library and are not supported.
+package libsql
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func init() {
+	sql.Register("libsql", &Driver{})
+}
+
+var (
+	_ driver.ExecerContext  = (*conn)(nil)
+	_ driver.QueryerContext = (*conn)(nil)
+	_ driver.ConnBeginTx    = (*conn)(nil)
+	_ driver.Pinger         = (*conn)(nil)
+)
+
+// Error is a statement error reported by the server, with its SQLite code,
+// like SQLITE_CONSTRAINT_UNIQUE.
+type Error struct {
+	Message string `json:"message"`
+	Code    string `json:"code"`
+}
+
+func (e *Error) Error() string {
+	if e.Code == "" {
+		return "libsql: " + e.Message
+	}
+	return "libsql: " + e.Message + " (" + e.Code + ")"
+}
+
+// Driver opens connections to a libsql server.
+type Driver struct {
+	// Client sends the requests, http.DefaultClient if nil.
+	Client *http.Client
+}
+
+// Open returns a connection to the database at the URL dsn.
+func (d *Driver) Open(dsn string) (driver.Conn, error) {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("libsql: invalid URL: %v", err)
+	}
+	query := u.Query()
+	token := query.Get("authToken")
+	foreignKeys := query.Get("_fk") == "true"
+	query.Del("authToken")
+	query.Del("_fk")
+	u.RawQuery = query.Encode()
+	switch u.Scheme {
+	case "libsql":
+		u.Scheme = "https"
+	case "https", "http":
+	default:
+		return nil, fmt.Errorf("libsql: unsupported URL scheme %q", u.Scheme)
+	}
+
+	client := d.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	c := &conn{client: client, baseURL: strings.TrimSuffix(u.String(), "/"), token: token}
+	if foreignKeys {
+		// Pragmas last as long as the stream, so they start each one
+		c.streamInit = append(c.streamInit, "PRAGMA foreign_keys = ON")
+	}
+	return c, nil
+}
+
+// conn is a connection to a libsql server. Statements outside transactions
+// run on a new stream each, transactions keep theirs with the baton returned
+// by the server.
+type conn struct {
+	client  *http.Client
+	baseURL string
+	token   string
+	baton   string // Stream of the open transaction, if any
+	inTx    bool
+	// Statements run first on each new stream
+	streamInit []string
+}
+
+// value is a SQLite value as encoded by the protocol.
+type value struct {
+	Type   string          `json:"type"`
+	Value  json.RawMessage `json:"value,omitempty"`
+	Base64 *string         `json:"base64,omitempty"`
+}
+
+// stmt is a statement with its positional arguments.
+type stmt struct {
+	SQL      string  `json:"sql"`
+	Args     []value `json:"args,omitempty"`
+	WantRows bool    `json:"want_rows"`
+}
+
+// streamRequest is a request of a pipeline, executing a statement or closing the stream.
+type streamRequest struct {
+	Type string `json:"type"`
+	Stmt *stmt  `json:"stmt,omitempty"`
+}
+
+// pipelineRequest is the body of /v2/pipeline.
+type pipelineRequest struct {
+	Baton    *string         `json:"baton"`
+	Requests []streamRequest `json:"requests"`
+}
+
+// executeResult is the result of a statement.
+type executeResult struct {
+	Cols []struct {
+		Name string `json:"name"`
+	} `json:"cols"`
+	Rows             [][]value `json:"rows"`
+	AffectedRowCount int64     `json:"affected_row_count"`
+	LastInsertRowID  *string   `json:"last_insert_rowid"`
+}
+
+// pipelineResponse is the response of /v2/pipeline.
+type pipelineResponse struct {
+	Baton   *string `json:"baton"`
+	BaseURL *string `json:"base_url"`
+	Results []struct {
+		Type     string `json:"type"`
+		Error    *Error `json:"error"`
+		Response *struct {
+			Result *executeResult `json:"result"`
+		} `json:"response"`
+	} `json:"results"`
+}
+
+// execute runs a statement, on the stream of the transaction if one is open,
+// and closes the stream unless the transaction goes on.
+func (c *conn) execute(ctx context.Context, query string, args []driver.NamedValue, keepStream bool) (*executeResult, error) {
+	s := &stmt{SQL: query, WantRows: true}
+	for _, arg := range args {
+		if arg.Name != "" {
+			return nil, errors.New("libsql: named arguments are not supported")
+		}
+		v, err := encode(arg.Value)
+		if err != nil {
+			return nil, err
+		}
+		s.Args = append(s.Args, v)
+	}
+
+	var request pipelineRequest
+	if c.baton != "" {
+		request.Baton = &c.baton
+	} else {
+		for _, init := range c.streamInit {
+			request.Requests = append(request.Requests, streamRequest{Type: "execute", Stmt: &stmt{SQL: init}})
+		}
+	}
+	first := len(request.Requests)
+	request.Requests = append(request.Requests, streamRequest{Type: "execute", Stmt: s})
+	if !keepStream {
+		request.Requests = append(request.Requests, streamRequest{Type: "close"})
+	}
+	body, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/v2/pipeline", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	res, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("libsql: %v", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+		return nil, fmt.Errorf("libsql: %s: %s", res.Status, bytes.TrimSpace(message))
+	}
+
+	var response pipelineResponse
+	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("libsql: invalid response: %v", err)
+	}
+	c.baton = ""
+	if keepStream && response.Baton != nil {
+		c.baton = *response.Baton
+	}
+	if response.BaseURL != nil && *response.BaseURL != "" {
+		c.baseURL = strings.TrimSuffix(*response.BaseURL, "/")
+	}
+	if len(response.Results) <= first {
+		return nil, errors.New("libsql: missing results")
+	}
+	for _, result := range response.Results[:first+1] {
+		if result.Type == "error" && result.Error != nil {
+			return nil, result.Error
+		}
+	}
+	result := response.Results[first]
+	if result.Response == nil || result.Response.Result == nil {
+		return nil, fmt.Errorf("libsql: unexpected %q result", result.Type)
+	}
+	return result.Response.Result, nil
+}
+
+// encode converts an argument to a protocol value.
+func encode(arg driver.Value) (value, error) {
+	switch v := arg.(type) {
+	case nil:
+		return value{Type: "null"}, nil
+	case int64:
+		return value{Type: "integer", Value: json.RawMessage(strconv.Quote(strconv.FormatInt(v, 10)))}, nil
+	case float64:
+		return value{Type: "float", Value: json.RawMessage(strconv.FormatFloat(v, 'g', -1, 64))}, nil
+	case bool:
+		if v {
+			return value{Type: "integer", Value: json.RawMessage(`"1"`)}, nil
+		}
+		return value{Type: "integer", Value: json.RawMessage(`"0"`)}, nil
+	case []byte:
+		encoded := base64.StdEncoding.EncodeToString(v)
+		return value{Type: "blob", Base64: &encoded}, nil
+	case string:
+		text, err := json.Marshal(v)
+		return value{Type: "text", Value: text}, err
+	case time.Time:
+		return value{Type: "text", Value: json.RawMessage(strconv.Quote(v.UTC().Format(time.RFC3339Nano)))}, nil
+	}
+	return value{}, fmt.Errorf("libsql: unsupported argument type %T", arg)
+}
+
+// decode converts a protocol value to a driver value.
+func decode(v value) (driver.Value, error) {
+	switch v.Type {
+	case "null":
+		return nil, nil
+	case "integer":
+		var s string
+		if err := json.Unmarshal(v.Value, &s); err != nil {
+			return nil, err
+		}
+		return strconv.ParseInt(s, 10, 64)
+	case "float":
+		var f float64
+		err := json.Unmarshal(v.Value, &f)
+		return f, err
+	case "text":
+		var s string
+		err := json.Unmarshal(v.Value, &s)
+		return s, err
+	case "blob":
+		if v.Base64 == nil {
+			return []byte{}, nil
+		}
+		return base64.StdEncoding.DecodeString(*v.Base64)
+	}
+	return nil, fmt.Errorf("libsql: unknown value type %q", v.Type)
+}
+
+// ExecContext runs a statement.
+func (c *conn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	r, err := c.execute(ctx, query, args, c.inTx)
+	if err != nil {
+		return nil, err
+	}
+	res := result{affected: r.AffectedRowCount}
+	if r.LastInsertRowID != nil {
+		res.lastInsertID, _ = strconv.ParseInt(*r.LastInsertRowID, 10, 64)
+	}
+	return res, nil
+}
+
+// QueryContext runs a query. The rows are read entirely before returning.
+func (c *conn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	r, err := c.execute(ctx, query, args, c.inTx)
+	if err != nil {
+		return nil, err
+	}
+	columns := make([]string, len(r.Cols))
+	for i, col := range r.Cols {
+		columns[i] = col.Name
+	}
+	return &rows{columns: columns, values: r.Rows}, nil
+}
+
+// Ping checks the server answers.
+func (c *conn) Ping(ctx context.Context) error {
+	_, err := c.execute(ctx, "SELECT 1", nil, c.inTx)
+	return err
+}
+
+// BeginTx starts a transaction on a stream kept until it ends.
+func (c *conn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if c.inTx {
+		return nil, errors.New("libsql: transaction already open")
+	}
+	if _, err := c.execute(ctx, "BEGIN", nil, true); err != nil {
+		return nil, err
+	}
+	c.inTx = true
+	return &tx{conn: c}, nil
+}
+
+// Begin starts a transaction.
+func (c *conn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+// Prepare returns a statement, sent with its arguments when run.
+func (c *conn) Prepare(query string) (driver.Stmt, error) {
+	return &preparedStmt{conn: c, query: query}, nil
+}
+
+// Close releases the connection. Streams outside transactions are already closed.
+func (c *conn) Close() error {
+	return nil
+}
+
+// tx is a transaction on the stream of a conn.
+type tx struct {
+	conn *conn
+}
+
+// Commit commits the transaction and closes its stream.
+func (t *tx) Commit() error {
+	return t.end("COMMIT")
+}
+
+// Rollback rolls the transaction back and closes its stream.
+func (t *tx) Rollback() error {
+	return t.end("ROLLBACK")
+}
+
+func (t *tx) end(statement string) error {
+	t.conn.inTx = false
+	_, err := t.conn.execute(context.Background(), statement, nil, false)
+	return err
+}
+
+// preparedStmt is a statement of a conn, which the protocol prepares on the server.
+type preparedStmt struct {
+	conn  *conn
+	query string
+}
+
+func (s *preparedStmt) Close() error  { return nil }
+func (s *preparedStmt) NumInput() int { return -1 }
+
+func (s *preparedStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	return s.conn.ExecContext(ctx, s.query, args)
+}
+
+func (s *preparedStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	return s.conn.QueryContext(ctx, s.query, args)
+}
+
+func (s *preparedStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return s.ExecContext(context.Background(), named(args))
+}
+
+func (s *preparedStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return s.QueryContext(context.Background(), named(args))
+}
+
+// named numbers positional arguments.
+func named(args []driver.Value) []driver.NamedValue {
+	values := make([]driver.NamedValue, len(args))
+	for i, arg := range args {
+		values[i] = driver.NamedValue{Ordinal: i + 1, Value: arg}
+	}
+	return values
+}
+
+// result is the outcome of a statement.
+type result struct {
+	lastInsertID int64
+	affected     int64
+}
+
+func (r result) LastInsertId() (int64, error) { return r.lastInsertID, nil }
+func (r result) RowsAffected() (int64, error) { return r.affected, nil }
+
+// rows iterates over the rows of a query result.
+type rows struct {
+	columns []string
+	values  [][]value
+}
+
+func (r *rows) Columns() []string { return r.columns }
+func (r *rows) Close() error      { return nil }
+
+func (r *rows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	row := r.values[0]
+	r.values = r.values[1:]
+	for i := range dest {
+		v, err := decode(row[i])
+		if err != nil {
+			return err
+		}
+		dest[i] = v
+	}
+	return nil
+}
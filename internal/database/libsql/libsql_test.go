@@ -0,0 +1,219 @@
+package libsql
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// newServer returns a Hrana server executing the statements on an in-memory
+// SQLite database, with a connection per stream.
+func newServer(t *testing.T, token string) *httptest.Server {
+	backend, err := sql.Open("sqlite3", "file:"+t.Name()+"?mode=memory&cache=shared")
+	if err != nil {
+		t.Fatalf("error opening backend. Err: %v", err)
+	}
+	t.Cleanup(func() { backend.Close() })
+
+	var mu sync.Mutex
+	streams := map[string]*sql.Conn{}
+	next := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.URL.Path != "/v2/pipeline" || r.Header.Get("Authorization") != "Bearer "+token {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		var request pipelineRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		var stream *sql.Conn
+		var baton string
+		if request.Baton != nil {
+			baton = *request.Baton
+			stream = streams[baton]
+		} else {
+			stream, _ = backend.Conn(r.Context())
+			next++
+			baton = strconv.Itoa(next)
+			streams[baton] = stream
+		}
+
+		var results []any
+		for _, req := range request.Requests {
+			if req.Type == "close" {
+				stream.Close()
+				delete(streams, baton)
+				baton = ""
+				results = append(results, map[string]any{"type": "ok", "response": map[string]any{"type": "close"}})
+				continue
+			}
+			args := make([]any, len(req.Stmt.Args))
+			for i, arg := range req.Stmt.Args {
+				args[i], _ = decode(arg)
+			}
+			results = append(results, execute(r.Context(), stream, req.Stmt.SQL, args))
+		}
+
+		response := map[string]any{"results": results, "baton": nil}
+		if baton != "" {
+			response["baton"] = baton
+		}
+		json.NewEncoder(w).Encode(response)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// execute runs a statement of the fake server and encodes its result.
+func execute(ctx context.Context, stream *sql.Conn, query string, args []any) any {
+	rows, err := stream.QueryContext(ctx, query, args...)
+	if err != nil {
+		return errorResult(err)
+	}
+	defer rows.Close()
+
+	columns, _ := rows.Columns()
+	cols := []map[string]any{}
+	for _, column := range columns {
+		cols = append(cols, map[string]any{"name": column})
+	}
+	values := [][]value{}
+	for rows.Next() {
+		dest := make([]any, len(columns))
+		pointers := make([]any, len(columns))
+		for i := range dest {
+			pointers[i] = &dest[i]
+		}
+		rows.Scan(pointers...)
+		row := make([]value, len(columns))
+		for i, v := range dest {
+			row[i], _ = encode(v)
+		}
+		values = append(values, row)
+	}
+	if err := rows.Err(); err != nil {
+		return errorResult(err)
+	}
+	var changes, lastID int64
+	stream.QueryRowContext(ctx, "SELECT changes(), last_insert_rowid()").Scan(&changes, &lastID)
+	result := map[string]any{"cols": cols, "rows": values, "affected_row_count": changes, "last_insert_rowid": strconv.FormatInt(lastID, 10)}
+	return map[string]any{"type": "ok", "response": map[string]any{"type": "execute", "result": result}}
+}
+
+// errorResult encodes a statement error of the fake server.
+func errorResult(err error) any {
+	code := ""
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique {
+		code = "SQLITE_CONSTRAINT_UNIQUE"
+	}
+	return map[string]any{"type": "error", "error": map[string]any{"message": err.Error(), "code": code}}
+}
+
+func TestExecAndQueryRoundTripValues(t *testing.T) {
+	server := newServer(t, "secret")
+	db, err := sql.Open("libsql", server.URL+"?authToken=secret")
+	if err != nil {
+		t.Fatalf("error opening database. Err: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.Ping(); err != nil {
+		t.Fatalf("error pinging. Err: %v", err)
+	}
+	if _, err := db.Exec("CREATE TABLE t (id INTEGER PRIMARY KEY, name TEXT, score REAL, data BLOB, note TEXT)"); err != nil {
+		t.Fatalf("error creating table. Err: %v", err)
+	}
+	result, err := db.Exec("INSERT INTO t (name, score, data, note) VALUES (?, ?, ?, ?)", "a \"quoted\" name", 1.5, []byte{0, 1, 2}, nil)
+	if err != nil {
+		t.Fatalf("error inserting. Err: %v", err)
+	}
+	if id, _ := result.LastInsertId(); id != 1 {
+		t.Errorf("expected last insert id 1; got %d", id)
+	}
+
+	var id int64
+	var name string
+	var score float64
+	var data []byte
+	var note sql.NullString
+	err = db.QueryRow("SELECT id, name, score, data, note FROM t WHERE id = ?", 1).Scan(&id, &name, &score, &data, &note)
+	if err != nil {
+		t.Fatalf("error querying. Err: %v", err)
+	}
+	if id != 1 || name != "a \"quoted\" name" || score != 1.5 || string(data) != "\x00\x01\x02" || note.Valid {
+		t.Errorf("unexpected row %d %q %v %v %v", id, name, score, data, note)
+	}
+}
+
+func TestTransactionsKeepTheirStream(t *testing.T) {
+	server := newServer(t, "secret")
+	db, _ := sql.Open("libsql", server.URL+"?authToken=secret")
+	defer db.Close()
+	db.Exec("CREATE TABLE t (name TEXT UNIQUE)")
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("error beginning transaction. Err: %v", err)
+	}
+	tx.Exec("INSERT INTO t (name) VALUES (?)", "rolled back")
+	if err := tx.Rollback(); err != nil {
+		t.Fatalf("error rolling back. Err: %v", err)
+	}
+
+	tx, _ = db.Begin()
+	tx.Exec("INSERT INTO t (name) VALUES (?)", "committed")
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("error committing. Err: %v", err)
+	}
+
+	var count int
+	db.QueryRow("SELECT COUNT(*) FROM t").Scan(&count)
+	if count != 1 {
+		t.Errorf("expected only the committed row; got %d rows", count)
+	}
+
+	_, err = db.Exec("INSERT INTO t (name) VALUES (?)", "committed")
+	var libsqlErr *Error
+	if !errors.As(err, &libsqlErr) || libsqlErr.Code != "SQLITE_CONSTRAINT_UNIQUE" {
+		t.Errorf("expected a unique constraint error; got %v", err)
+	}
+}
+
+func TestOpenRejectsWrongToken(t *testing.T) {
+	server := newServer(t, "secret")
+	db, _ := sql.Open("libsql", server.URL+"?authToken=wrong")
+	defer db.Close()
+	if err := db.Ping(); err == nil {
+		t.Errorf("expected an error with a wrong token")
+	}
+}
+
+func TestForeignKeysEnabledOnEachStream(t *testing.T) {
+	server := newServer(t, "secret")
+	db, _ := sql.Open("libsql", server.URL+"?authToken=secret&_fk=true")
+	defer db.Close()
+
+	for range 2 {
+		var enabled int
+		if err := db.QueryRow("PRAGMA foreign_keys").Scan(&enabled); err != nil {
+			t.Fatalf("error reading pragma. Err: %v", err)
+		}
+		if enabled != 1 {
+			t.Errorf("expected foreign keys to be enforced")
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/raziel-aleman/go-starter/internal/database/queries"
+)
+
+// CreateMagicLink stores the hash of a login link token for a user.
+// Expired links of the user are removed at the same time.
+func (s *service) CreateMagicLink(ctx context.Context, username string, tokenHash string, expiresAt time.Time) error {
+	return s.withTx(ctx, func(t *tx) error {
+		q := queries.New(t)
+		now := time.Now().UTC().Format(time.RFC3339)
+		if err := q.DeleteExpiredMagicLinks(ctx, queries.DeleteExpiredMagicLinksParams{
+			Username:  username,
+			ExpiresAt: now,
+		}); err != nil {
+			return err
+		}
+		return q.CreateMagicLink(ctx, queries.CreateMagicLinkParams{
+			TokenHash: tokenHash,
+			Username:  username,
+			CreatedAt: now,
+			ExpiresAt: expiresAt.UTC().Format(time.RFC3339),
+		})
+	})
+}
+
+// CountMagicLinks returns the number of login links created for a user since the given time.
+func (s *service) CountMagicLinks(ctx context.Context, username string, since time.Time) (int, error) {
+	ctx, cancel := s.db.readContext(ctx)
+	defer cancel()
+	count, err := queries.New(s.db).CountMagicLinks(ctx, queries.CountMagicLinksParams{
+		Username:  username,
+		CreatedAt: since.UTC().Format(time.RFC3339),
+	})
+	return int(count), err
+}
+
+// ConsumeMagicLink deletes a login link token and returns the username.
+// Expired tokens are deleted and return sql.ErrNoRows.
+func (s *service) ConsumeMagicLink(ctx context.Context, tokenHash string) (string, error) {
+	ctx, cancel := s.db.readContext(ctx)
+	defer cancel()
+	q := queries.New(s.db)
+	link, err := q.FindMagicLink(ctx, tokenHash)
+	if err != nil {
+		return "", err
+	}
+	// Only one caller can delete the token, a concurrent consumer gets sql.ErrNoRows
+	if err := oneRow(q.DeleteMagicLink(ctx, tokenHash)); err != nil {
+		return "", err
+	}
+
+	expiry, err := time.Parse(time.RFC3339, link.ExpiresAt)
+	if err != nil {
+		return "", err
+	}
+	if time.Now().After(expiry) {
+		return "", sql.ErrNoRows
+	}
+
+	return link.Username, nil
+}
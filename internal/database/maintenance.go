@@ -0,0 +1,99 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// maintenanceConfig schedules the upkeep of SQLite database files.
+type maintenanceConfig struct {
+	Interval      time.Duration // Zero disables the maintenance
+	VacuumPages   int           // Free pages returned to the file system per run
+	logAutoVacuum bool          // Whether to explain why free pages are not returned
+}
+
+// maintenanceConfigFromEnv reads BLUEPRINT_DB_MAINTENANCE_INTERVAL (default
+// 1h, "off" or 0 to disable) and BLUEPRINT_DB_VACUUM_PAGES (default 1000).
+func maintenanceConfigFromEnv() (maintenanceConfig, error) {
+	config := maintenanceConfig{Interval: time.Hour, VacuumPages: 1000, logAutoVacuum: true}
+	if value := os.Getenv("BLUEPRINT_DB_MAINTENANCE_INTERVAL"); value == "off" {
+		config.Interval = 0
+	} else if value != "" {
+		d, err := time.ParseDuration(value)
+		if err != nil || d < 0 {
+			return config, fmt.Errorf("invalid BLUEPRINT_DB_MAINTENANCE_INTERVAL %q", value)
+		}
+		config.Interval = d
+	}
+	if value := os.Getenv("BLUEPRINT_DB_VACUUM_PAGES"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return config, fmt.Errorf("invalid BLUEPRINT_DB_VACUUM_PAGES %q", value)
+		}
+		config.VacuumPages = n
+	}
+	return config, nil
+}
+
+// runMaintenance maintains the database every interval until ctx is done.
+func runMaintenance(ctx context.Context, c *conn, config maintenanceConfig) {
+	ticker := time.NewTicker(config.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := maintain(ctx, c, &config); err != nil && ctx.Err() == nil {
+				c.log().Error("Database maintenance failed", "err", err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// maintain copies the pages of the write-ahead log into the database file
+// and truncates the log, which otherwise grows as long as readers keep it
+// in use. It then returns free pages to the file system, when the database
+// was created with incremental auto-vacuum.
+func maintain(ctx context.Context, c *conn, config *maintenanceConfig) error {
+	// The columns are whether the checkpoint was blocked, the pages of the log, and those checkpointed
+	var busy, logPages, checkpointed int
+	if err := c.QueryRowContext(ctx, "PRAGMA wal_checkpoint(TRUNCATE)").Scan(&busy, &logPages, &checkpointed); err != nil {
+		return fmt.Errorf("error checkpointing the write-ahead log: %v", err)
+	}
+	if busy != 0 {
+		c.log().Warn("Database checkpoint incomplete, log pages in use", "checkpointed", checkpointed, "pages", logPages)
+	}
+
+	// Mode 2 is incremental, databases created before it was set need a full VACUUM to switch
+	var autoVacuum int
+	if err := c.QueryRowContext(ctx, "PRAGMA auto_vacuum").Scan(&autoVacuum); err != nil {
+		return err
+	}
+	if autoVacuum != 2 {
+		if config.logAutoVacuum {
+			c.log().Warn("Database free pages are kept: run PRAGMA auto_vacuum = INCREMENTAL; VACUUM; once to return them to the file system")
+			config.logAutoVacuum = false
+		}
+		return nil
+	}
+	if config.VacuumPages == 0 {
+		return nil
+	}
+	// Pragma arguments cannot be bound, and every step of the statement frees
+	// one page, so it is run until done rather than executed for one step
+	rows, err := c.QueryContext(ctx, fmt.Sprintf("PRAGMA incremental_vacuum(%d)", config.VacuumPages))
+	if err != nil {
+		return fmt.Errorf("error vacuuming: %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error vacuuming: %v", err)
+	}
+	return nil
+}
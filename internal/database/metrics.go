@@ -0,0 +1,157 @@
+package database
+
+import (
+	"bufio"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// latencyBuckets are the upper bounds, in seconds, of the query duration histogram.
+var latencyBuckets = []float64{0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5}
+
+// queryMetrics counts the queries of a connection pool and their latencies,
+// labeled by statement kind and table, e.g. "select users", so the number of
+// series stays bounded whatever the arguments.
+type queryMetrics struct {
+	mu      sync.Mutex
+	byLabel map[string]*queryStats
+	labels  sync.Map // Query to label
+}
+
+// queryStats are the counters of the queries with one label.
+type queryStats struct {
+	count   uint64
+	errors  uint64
+	buckets []uint64 // Cumulated when written
+	sum     float64
+}
+
+// observe records a query that started at start and failed with err, if not
+// nil. Missing rows are not failures.
+func (m *queryMetrics) observe(query string, start time.Time, err error) {
+	seconds := time.Since(start).Seconds()
+	label := m.label(query)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.byLabel == nil {
+		m.byLabel = make(map[string]*queryStats)
+	}
+	stats := m.byLabel[label]
+	if stats == nil {
+		stats = &queryStats{buckets: make([]uint64, len(latencyBuckets))}
+		m.byLabel[label] = stats
+	}
+	stats.count++
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		stats.errors++
+	}
+	stats.sum += seconds
+	for i, bound := range latencyBuckets {
+		if seconds <= bound {
+			stats.buckets[i]++
+			break
+		}
+	}
+}
+
+// label returns the statement kind and the first table of a query.
+func (m *queryMetrics) label(query string) string {
+	if label, ok := m.labels.Load(query); ok {
+		return label.(string)
+	}
+
+	// Skip the leading comments, like the names of the generated queries
+	statement := query
+	for strings.HasPrefix(strings.TrimSpace(statement), "--") {
+		_, statement, _ = strings.Cut(strings.TrimSpace(statement), "\n")
+	}
+	fields := strings.Fields(statement)
+	label := "other"
+	if len(fields) > 0 {
+		label = strings.ToLower(fields[0])
+		for i, field := range fields[:len(fields)-1] {
+			switch strings.ToUpper(field) {
+			case "FROM", "INTO", "UPDATE":
+				table, _, _ := strings.Cut(fields[i+1], "(")
+				label += " " + strings.ToLower(table)
+			default:
+				continue
+			}
+			break
+		}
+	}
+	m.labels.Store(query, label)
+	return label
+}
+
+// write writes the query metrics in the Prometheus text format.
+func (m *queryMetrics) write(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	labels := make([]string, 0, len(m.byLabel))
+	for label := range m.byLabel {
+		labels = append(labels, label)
+	}
+	sort.Strings(labels)
+
+	fmt.Fprintln(w, "# HELP db_queries_total Queries run, by statement kind and table.")
+	fmt.Fprintln(w, "# TYPE db_queries_total counter")
+	for _, label := range labels {
+		fmt.Fprintf(w, "db_queries_total{query=%q} %d\n", label, m.byLabel[label].count)
+	}
+	fmt.Fprintln(w, "# HELP db_query_errors_total Queries failed, by statement kind and table.")
+	fmt.Fprintln(w, "# TYPE db_query_errors_total counter")
+	for _, label := range labels {
+		fmt.Fprintf(w, "db_query_errors_total{query=%q} %d\n", label, m.byLabel[label].errors)
+	}
+	fmt.Fprintln(w, "# HELP db_query_duration_seconds Query latency, by statement kind and table.")
+	fmt.Fprintln(w, "# TYPE db_query_duration_seconds histogram")
+	for _, label := range labels {
+		stats := m.byLabel[label]
+		var cumulated uint64
+		for i, bound := range latencyBuckets {
+			cumulated += stats.buckets[i]
+			fmt.Fprintf(w, "db_query_duration_seconds_bucket{query=%q,le=\"%g\"} %d\n", label, bound, cumulated)
+		}
+		fmt.Fprintf(w, "db_query_duration_seconds_bucket{query=%q,le=\"+Inf\"} %d\n", label, stats.count)
+		fmt.Fprintf(w, "db_query_duration_seconds_sum{query=%q} %g\n", label, stats.sum)
+		fmt.Fprintf(w, "db_query_duration_seconds_count{query=%q} %d\n", label, stats.count)
+	}
+}
+
+// writePoolMetrics writes the statistics of a connection pool in the Prometheus text format.
+func writePoolMetrics(w io.Writer, stats sql.DBStats) {
+	for _, metric := range []struct {
+		name, kind, help string
+		value            float64
+	}{
+		{"db_max_open_connections", "gauge", "Maximum number of open connections.", float64(stats.MaxOpenConnections)},
+		{"db_open_connections", "gauge", "Established connections, in use and idle.", float64(stats.OpenConnections)},
+		{"db_in_use_connections", "gauge", "Connections in use.", float64(stats.InUse)},
+		{"db_idle_connections", "gauge", "Idle connections.", float64(stats.Idle)},
+		{"db_wait_count_total", "counter", "Connections waited for.", float64(stats.WaitCount)},
+		{"db_wait_duration_seconds_total", "counter", "Time blocked waiting for a connection.", stats.WaitDuration.Seconds()},
+		{"db_max_idle_closed_total", "counter", "Connections closed due to the idle connection limit.", float64(stats.MaxIdleClosed)},
+		{"db_max_idle_time_closed_total", "counter", "Connections closed due to the idle time limit.", float64(stats.MaxIdleTimeClosed)},
+		{"db_max_lifetime_closed_total", "counter", "Connections closed due to their maximum lifetime.", float64(stats.MaxLifetimeClosed)},
+	} {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s %g\n", metric.name, metric.help, metric.name, metric.kind, metric.name, metric.value)
+	}
+}
+
+// WriteMetrics writes the connection pool statistics and the query counters
+// and latency histograms in the Prometheus text exposition format.
+func (s *service) WriteMetrics(w io.Writer) error {
+	b := bufio.NewWriter(w)
+	writePoolMetrics(b, s.db.Stats())
+	s.db.metrics.write(b)
+	return b.Flush()
+}
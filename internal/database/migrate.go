@@ -0,0 +1,331 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// migrationFiles holds the numbered migrations of every driver, named
+// NNNN_name.up.sql and NNNN_name.down.sql.
+//
+//go:embed migrations
+var migrationFiles embed.FS
+
+// migrationDirs maps drivers to their migrations directory.
+var migrationDirs = map[string]string{
+	DriverSQLite:   "migrations/sqlite",
+	DriverPostgres: "migrations/postgres",
+	DriverMySQL:    "migrations/mysql",
+}
+
+// Migration is a numbered, reversible schema change.
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// loadMigrations returns the migrations of a driver ordered by version.
+func loadMigrations(driver string) ([]Migration, error) {
+	dir, ok := migrationDirs[driver]
+	if !ok {
+		return nil, fmt.Errorf("no migrations for database driver %q", driver)
+	}
+	return readMigrations(migrationFiles, dir)
+}
+
+// readMigrations reads the migrations of a directory ordered by version.
+func readMigrations(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, fmt.Errorf("error reading migrations: %v", err)
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		name, direction, ok := strings.Cut(strings.TrimSuffix(entry.Name(), ".sql"), ".")
+		number, label, found := strings.Cut(name, "_")
+		version, err := strconv.Atoi(number)
+		if !ok || !found || err != nil || (direction != "up" && direction != "down") {
+			return nil, fmt.Errorf("invalid migration file name %s", entry.Name())
+		}
+		content, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("error reading migration %s: %v", entry.Name(), err)
+		}
+
+		m := byVersion[version]
+		if m == nil {
+			m = &Migration{Version: version, Name: label}
+			byVersion[version] = m
+		} else if m.Name != label {
+			return nil, fmt.Errorf("migrations %04d_%s and %s share a version", version, m.Name, entry.Name())
+		}
+		if direction == "up" {
+			m.Up = string(content)
+		} else {
+			m.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %04d_%s needs both an up and a down file", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// Migrate applies the pending migrations, bringing the schema up to date.
+func (s *service) Migrate(ctx context.Context) error {
+	migrations, err := loadMigrations(s.db.driver)
+	if err != nil {
+		return err
+	}
+	if len(migrations) == 0 {
+		return nil
+	}
+	return s.MigrateTo(ctx, migrations[len(migrations)-1].Version)
+}
+
+// MigrateTo applies or reverts migrations until the schema is at version.
+// Version 0 reverts every migration.
+func (s *service) MigrateTo(ctx context.Context, version int) error {
+	migrations, err := loadMigrations(s.db.driver)
+	if err != nil {
+		return err
+	}
+	if err := s.prepareMigrations(ctx); err != nil {
+		return err
+	}
+	applied, err := s.appliedMigrations(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range migrations {
+		if m.Version <= version && !applied[m.Version] {
+			if err := s.runMigration(ctx, m, true); err != nil {
+				return err
+			}
+		}
+	}
+	for i := len(migrations) - 1; i >= 0; i-- {
+		if m := migrations[i]; m.Version > version && applied[m.Version] {
+			if err := s.runMigration(ctx, m, false); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// prepareMigrations creates the schema_migrations table. SQLite databases
+// created before migrations were introduced are upgraded to the first one.
+func (s *service) prepareMigrations(ctx context.Context) error {
+	if s.db.driver == DriverSQLite {
+		var tracked bool
+		if err := s.db.QueryRowContext(ctx,
+			"SELECT EXISTS(SELECT 1 FROM sqlite_master WHERE type = 'table' AND name = 'schema_migrations')",
+		).Scan(&tracked); err != nil {
+			return fmt.Errorf("error inspecting schema: %v", err)
+		}
+		if !tracked {
+			if err := upgradeLegacySQLite(s.db.DB); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Schema migrations table initialization query if it does not exist
+	const createMigrationsTable string = `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version BIGINT NOT NULL PRIMARY KEY,
+		name VARCHAR(255) NOT NULL,
+		applied_at VARCHAR(32) NOT NULL
+	)`
+
+	// Execute initialization query
+	if _, err := s.db.ExecContext(ctx, createMigrationsTable); err != nil {
+		return fmt.Errorf("error creating Schema migrations table: %v", err)
+	}
+	return nil
+}
+
+// appliedMigrations returns the versions of the applied migrations.
+func (s *service) appliedMigrations(ctx context.Context) (map[int]bool, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT version FROM schema_migrations")
+	if err != nil {
+		return nil, fmt.Errorf("error reading applied migrations: %v", err)
+	}
+	defer rows.Close()
+
+	applied := make(map[int]bool)
+	for rows.Next() {
+		var version int
+		if err := rows.Scan(&version); err != nil {
+			return nil, err
+		}
+		applied[version] = true
+	}
+	return applied, rows.Err()
+}
+
+// runMigration applies or reverts a migration and records it in the same
+// transaction. MySQL commits DDL statements implicitly, so a failed migration
+// may be partially applied there.
+func (s *service) runMigration(ctx context.Context, m Migration, up bool) error {
+	script, direction := m.Up, "applying"
+	if !up {
+		script, direction = m.Down, "reverting"
+	}
+
+	tx, err := s.db.BeginTx(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, statement := range splitStatements(script) {
+		if _, err := tx.ExecContext(ctx, statement); err != nil {
+			return fmt.Errorf("error %s migration %04d_%s: %v", direction, m.Version, m.Name, err)
+		}
+	}
+
+	if up {
+		_, err = tx.ExecContext(ctx,
+			"INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)",
+			m.Version,
+			m.Name,
+			time.Now().UTC().Format(time.RFC3339),
+		)
+	} else {
+		_, err = tx.ExecContext(ctx, "DELETE FROM schema_migrations WHERE version = ?", m.Version)
+	}
+	if err != nil {
+		return fmt.Errorf("error recording migration %04d_%s: %v", m.Version, m.Name, err)
+	}
+
+	return tx.Commit()
+}
+
+// splitStatements splits a migration script on the semicolons ending its
+// lines, so every driver runs one statement at a time. Statements must not
+// contain such semicolons themselves.
+func splitStatements(script string) []string {
+	var statements []string
+	var current strings.Builder
+	for _, line := range strings.SplitAfter(script, "\n") {
+		current.WriteString(line)
+		if strings.HasSuffix(strings.TrimSpace(line), ";") {
+			statements = appendStatement(statements, current.String())
+			current.Reset()
+		}
+	}
+	return appendStatement(statements, current.String())
+}
+
+// appendStatement appends a statement unless it only holds comments.
+func appendStatement(statements []string, statement string) []string {
+	for _, line := range strings.Split(statement, "\n") {
+		if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "--") {
+			return append(statements, strings.TrimSpace(statement))
+		}
+	}
+	return statements
+}
+
+// upgradeLegacySQLite adds the columns introduced before migrations to the
+// tables of an existing SQLite database, so the first migration finds them in
+// their current shape.
+func upgradeLegacySQLite(db *sql.DB) error {
+	columns := []struct {
+		table, column, definition string
+	}{
+		{"users", "email", "TEXT"},
+		{"users", "verified_at", "TEXT"},
+		{"users", "totp_secret", "TEXT"},
+		{"users", "totp_enabled_at", "TEXT"},
+		{"users", "display_name", "TEXT"},
+		{"users", "avatar_url", "TEXT"},
+		{"users", "disabled_at", "TEXT"},
+		// SQLite only adds NOT NULL columns with a default
+		{"users", "password_reset_required", "INTEGER NOT NULL DEFAULT 0"},
+		{"users", "status", "TEXT NOT NULL DEFAULT 'active'"},
+		{"users", "password_changed_at", "TEXT"},
+		// Space-separated scopes, keys without scopes are unrestricted
+		{"api_keys", "scopes", "TEXT NOT NULL DEFAULT ''"},
+		// Space-separated scopes granted to the token family
+		{"refresh_tokens", "scopes", "TEXT NOT NULL DEFAULT ''"},
+	}
+	for _, c := range columns {
+		if err := addColumnIfMissing(db, c.table, c.column, c.definition); err != nil {
+			return err
+		}
+	}
+
+	var hasUsers bool
+	if err := db.QueryRow(
+		"SELECT EXISTS(SELECT 1 FROM sqlite_master WHERE type = 'table' AND name = 'users')",
+	).Scan(&hasUsers); err != nil || !hasUsers {
+		return err
+	}
+
+	// Passwords set before their change time was recorded start their age now
+	if _, err := db.Exec(
+		"UPDATE users SET password_changed_at = ? WHERE password_changed_at IS NULL",
+		time.Now().UTC().Format(time.RFC3339),
+	); err != nil {
+		return fmt.Errorf("error initializing password change times: %v", err)
+	}
+
+	// Users disabled before the status column was introduced
+	if _, err := db.Exec(
+		"UPDATE users SET status = 'disabled' WHERE disabled_at IS NOT NULL AND status = 'active'",
+	); err != nil {
+		return fmt.Errorf("error migrating disabled users: %v", err)
+	}
+
+	// Emails are matched normalized, normalize those stored before
+	if _, err := db.Exec(
+		"UPDATE users SET email = lower(trim(email)) WHERE email != lower(trim(email))",
+	); err != nil {
+		return fmt.Errorf("error normalizing user emails: %v", err)
+	}
+	return nil
+}
+
+// addColumnIfMissing adds a column to an existing table, so databases created
+// before the column was introduced are upgraded in place. Missing tables are
+// left for the migrations to create.
+func addColumnIfMissing(db *sql.DB, table, column, definition string) error {
+	var tableExists, exists bool
+	err := db.QueryRow(
+		"SELECT EXISTS(SELECT 1 FROM sqlite_master WHERE type = 'table' AND name = ?), EXISTS(SELECT 1 FROM pragma_table_info(?) WHERE name = ?)",
+		table,
+		table,
+		column,
+	).Scan(&tableExists, &exists)
+	if err != nil {
+		return fmt.Errorf("error inspecting %s table: %v", table, err)
+	}
+	if !tableExists || exists {
+		return nil
+	}
+
+	if _, err := db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition)); err != nil {
+		return fmt.Errorf("error adding %s column to %s table: %v", column, table, err)
+	}
+	return nil
+}
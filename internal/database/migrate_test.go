@@ -0,0 +1,270 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// openTestDB returns a service on a new, empty in-memory SQLite database.
+func openTestDB(t *testing.T) (*service, *sql.DB) {
+	t.Helper()
+	db, err := sql.Open(DriverSQLite, ":memory:?_fk=true")
+	if err != nil {
+		t.Fatalf("error opening test database. Err: %v", err)
+	}
+	// Every connection to :memory: opens a different database
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+	return &service{db: &conn{DB: db, driver: DriverSQLite}}, db
+}
+
+// tableNames returns the tables of a SQLite database, schema_migrations aside.
+func tableNames(t *testing.T, db *sql.DB) []string {
+	t.Helper()
+	rows, err := db.Query("SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT IN ('schema_migrations', 'sqlite_sequence') ORDER BY name")
+	if err != nil {
+		t.Fatalf("error listing tables. Err: %v", err)
+	}
+	defer rows.Close()
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			t.Fatalf("error listing tables. Err: %v", err)
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+// schemaVersion returns the latest applied migration, 0 if there is none.
+func schemaVersion(t *testing.T, db *sql.DB) int {
+	t.Helper()
+	var version int
+	if err := db.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&version); err != nil {
+		t.Fatalf("error reading schema version. Err: %v", err)
+	}
+	return version
+}
+
+func TestMigrateUpDownUp(t *testing.T) {
+	ctx := context.Background()
+	s, db := openTestDB(t)
+	migrations, err := loadMigrations(DriverSQLite)
+	if err != nil {
+		t.Fatalf("error loading migrations. Err: %v", err)
+	}
+	latest := migrations[len(migrations)-1].Version
+
+	if err := s.Migrate(ctx); err != nil {
+		t.Fatalf("error applying migrations. Err: %v", err)
+	}
+	if v := schemaVersion(t, db); v != latest {
+		t.Fatalf("expected schema version %d; got %d", latest, v)
+	}
+	tables := tableNames(t, db)
+
+	if err := s.MigrateTo(ctx, 0); err != nil {
+		t.Fatalf("error reverting migrations. Err: %v", err)
+	}
+	if names := tableNames(t, db); len(names) != 0 {
+		t.Errorf("expected every table to be dropped; got %v", names)
+	}
+	if v := schemaVersion(t, db); v != 0 {
+		t.Errorf("expected schema version 0; got %d", v)
+	}
+
+	if err := s.Migrate(ctx); err != nil {
+		t.Fatalf("error reapplying migrations. Err: %v", err)
+	}
+	if names := tableNames(t, db); !reflect.DeepEqual(names, tables) {
+		t.Errorf("expected tables %v; got %v", tables, names)
+	}
+	if _, err := s.RegisterUser(ctx, "alice", "alice@example.com", []byte("hash")); err != nil {
+		t.Errorf("error registering user on the migrated schema. Err: %v", err)
+	}
+}
+
+func TestMigrateLegacySQLite(t *testing.T) {
+	legacy, err := os.ReadFile("testdata/legacy_sqlite.sql")
+	if err != nil {
+		t.Fatalf("error reading legacy schema. Err: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		schema string
+	}{
+		{"created by Init", string(legacy)},
+		{"created before the user columns", `CREATE TABLE users (
+			id INTEGER NOT NULL PRIMARY KEY,
+			username TEXT NOT NULL UNIQUE,
+			password BLOB NOT NULL
+		);
+		CREATE TABLE sessions (
+			id INTEGER NOT NULL PRIMARY KEY,
+			sessionId TEXT NOT NULL,
+			createdAt TEXT NOT NULL,
+			lastActive TEXT NOT NULL,
+			data BLOB NOT NULL
+		);
+		INSERT INTO users (username, password) VALUES ('alice', 'hash');`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			s, db := openTestDB(t)
+			for _, statement := range splitStatements(tt.schema) {
+				if _, err := db.Exec(statement); err != nil {
+					t.Fatalf("error creating legacy schema. Err: %v", err)
+				}
+			}
+
+			if err := s.Migrate(ctx); err != nil {
+				t.Fatalf("error upgrading legacy database. Err: %v", err)
+			}
+			if err := s.Migrate(ctx); err != nil {
+				t.Fatalf("error migrating upgraded database again. Err: %v", err)
+			}
+
+			var status, tenant string
+			var changedAt sql.NullString
+			if err := db.QueryRow(
+				"SELECT status, tenant_id, password_changed_at FROM users WHERE username = 'alice' AND deleted_at IS NULL",
+			).Scan(&status, &tenant, &changedAt); err != nil {
+				t.Fatalf("error reading upgraded user. Err: %v", err)
+			}
+			if status != string(StatusActive) || tenant != "" || !changedAt.Valid {
+				t.Errorf("expected an active user of the default tenant with a password change time; got %q, %q, %v", status, tenant, changedAt)
+			}
+			if _, err := s.RegisterUser(ctx, "carol", "carol@example.com", []byte("hash")); err != nil {
+				t.Errorf("error registering user on the upgraded schema. Err: %v", err)
+			}
+		})
+	}
+
+	t.Run("keeps data", func(t *testing.T) {
+		ctx := context.Background()
+		s, db := openTestDB(t)
+		for _, statement := range splitStatements(string(legacy)) {
+			if _, err := db.Exec(statement); err != nil {
+				t.Fatalf("error creating legacy schema. Err: %v", err)
+			}
+		}
+		if err := s.Migrate(ctx); err != nil {
+			t.Fatalf("error upgrading legacy database. Err: %v", err)
+		}
+
+		var status string
+		if err := db.QueryRow("SELECT status FROM users WHERE username = 'bob'").Scan(&status); err != nil {
+			t.Fatalf("error reading upgraded user. Err: %v", err)
+		}
+		if status != string(StatusDisabled) {
+			t.Errorf("expected the disabled user to keep its status; got %q", status)
+		}
+		roles, err := s.UserRoles(ctx, "alice")
+		if err != nil {
+			t.Fatalf("error reading roles. Err: %v", err)
+		}
+		if !reflect.DeepEqual(roles, []string{"admin"}) {
+			t.Errorf("expected the admin role to be kept; got %v", roles)
+		}
+	})
+}
+
+func TestSplitStatements(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		want   []string
+	}{
+		{
+			name:   "single line",
+			script: "CREATE INDEX a ON t (x);\nCREATE INDEX b ON t (y);\n",
+			want:   []string{"CREATE INDEX a ON t (x);", "CREATE INDEX b ON t (y);"},
+		},
+		{
+			name:   "multi-line",
+			script: "CREATE TABLE t (\n\tx TEXT,\n\ty TEXT\n);\n",
+			want:   []string{"CREATE TABLE t (\n\tx TEXT,\n\ty TEXT\n);"},
+		},
+		{
+			name:   "comments",
+			script: "-- Tables\n-- of the app\nCREATE TABLE t (x TEXT);\n\n-- Trailing comment\n",
+			want:   []string{"-- Tables\n-- of the app\nCREATE TABLE t (x TEXT);"},
+		},
+		{
+			name:   "semicolon inside a line",
+			script: "INSERT INTO t (x) VALUES ('a;b');\n",
+			want:   []string{"INSERT INTO t (x) VALUES ('a;b');"},
+		},
+		{
+			name:   "without final semicolon",
+			script: "CREATE TABLE t (x TEXT);\nDROP TABLE u",
+			want:   []string{"CREATE TABLE t (x TEXT);", "DROP TABLE u"},
+		},
+		{
+			name:   "empty",
+			script: "\n-- Nothing to do\n",
+			want:   nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := splitStatements(tt.script); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expected %q; got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestReadMigrations(t *testing.T) {
+	file := &fstest.MapFile{Data: []byte("SELECT 1;")}
+
+	tests := []struct {
+		name  string
+		files []string
+		err   string
+	}{
+		{"valid", []string{"0002_second.up.sql", "0002_second.down.sql", "0001_first.up.sql", "0001_first.down.sql"}, ""},
+		{"missing down", []string{"0001_first.up.sql"}, "needs both an up and a down file"},
+		{"missing name", []string{"0001.up.sql", "0001.down.sql"}, "invalid migration file name"},
+		{"invalid version", []string{"first_one.up.sql", "first_one.down.sql"}, "invalid migration file name"},
+		{"invalid direction", []string{"0001_first.sideways.sql"}, "invalid migration file name"},
+		{"missing direction", []string{"0001_first.sql"}, "invalid migration file name"},
+		{"shared version", []string{"0001_first.up.sql", "0001_other.down.sql"}, "share a version"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fsys := fstest.MapFS{}
+			for _, name := range tt.files {
+				fsys["migrations/"+name] = file
+			}
+
+			migrations, err := readMigrations(fsys, "migrations")
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("expected error %q; got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("error reading migrations. Err: %v", err)
+			}
+			if len(migrations) != 2 || migrations[0].Version != 1 || migrations[1].Name != "second" {
+				t.Errorf("expected migrations 0001_first and 0002_second in order; got %+v", migrations)
+			}
+		})
+	}
+
+	for driver := range migrationDirs {
+		if _, err := loadMigrations(driver); err != nil {
+			t.Errorf("error loading %s migrations. Err: %v", driver, err)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+-- Columns must have a bounded length to be keys. Values compare byte-wise,
+-- except usernames which are unique and matched regardless of case; the
+-- columns referencing them must share their collation.
+CREATE TABLE IF NOT EXISTS users (
+	id BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+	username VARCHAR(255) COLLATE utf8mb4_general_ci NOT NULL UNIQUE,
+	password BLOB NOT NULL,
+	email VARCHAR(255),
+	verified_at VARCHAR(32),
+	totp_secret VARCHAR(255),
+	totp_enabled_at VARCHAR(32),
+	display_name VARCHAR(255),
+	avatar_url TEXT,
+	disabled_at VARCHAR(32),
+	password_reset_required INTEGER NOT NULL DEFAULT 0,
+	status VARCHAR(16) NOT NULL DEFAULT 'active',
+	password_changed_at VARCHAR(32),
+	INDEX users_email (email)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
+CREATE TABLE IF NOT EXISTS email_verifications (
+	token_hash VARCHAR(255) NOT NULL PRIMARY KEY,
+	username VARCHAR(255) COLLATE utf8mb4_general_ci NOT NULL,
+	expires_at VARCHAR(32) NOT NULL,
+	FOREIGN KEY (username) REFERENCES users (username) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
+CREATE TABLE IF NOT EXISTS recovery_codes (
+	username VARCHAR(255) COLLATE utf8mb4_general_ci NOT NULL,
+	code_hash VARCHAR(255) NOT NULL,
+	PRIMARY KEY (username, code_hash),
+	FOREIGN KEY (username) REFERENCES users (username) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
+CREATE TABLE IF NOT EXISTS user_roles (
+	username VARCHAR(255) COLLATE utf8mb4_general_ci NOT NULL,
+	role VARCHAR(255) NOT NULL,
+	PRIMARY KEY (username, role),
+	FOREIGN KEY (username) REFERENCES users (username) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
+CREATE TABLE IF NOT EXISTS role_permissions (
+	role VARCHAR(255) NOT NULL,
+	action VARCHAR(255) NOT NULL,
+	resource VARCHAR(255) NOT NULL,
+	PRIMARY KEY (role, action, resource)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
+-- Admins are allowed every action on every resource
+INSERT INTO role_permissions (role, action, resource) VALUES ('admin', '*', '*')
+	ON DUPLICATE KEY UPDATE role = role;
+
+CREATE TABLE IF NOT EXISTS api_keys (
+	id BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+	username VARCHAR(255) COLLATE utf8mb4_general_ci NOT NULL,
+	name VARCHAR(255) NOT NULL,
+	prefix VARCHAR(255) NOT NULL,
+	key_hash VARCHAR(255) NOT NULL UNIQUE,
+	scopes VARCHAR(1024) NOT NULL DEFAULT '',
+	created_at VARCHAR(32) NOT NULL,
+	last_used_at VARCHAR(32),
+	revoked_at VARCHAR(32),
+	FOREIGN KEY (username) REFERENCES users (username) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
+CREATE TABLE IF NOT EXISTS magic_links (
+	token_hash VARCHAR(255) NOT NULL PRIMARY KEY,
+	username VARCHAR(255) COLLATE utf8mb4_general_ci NOT NULL,
+	created_at VARCHAR(32) NOT NULL,
+	expires_at VARCHAR(32) NOT NULL,
+	FOREIGN KEY (username) REFERENCES users (username) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+	token_hash VARCHAR(255) NOT NULL PRIMARY KEY,
+	username VARCHAR(255) COLLATE utf8mb4_general_ci NOT NULL,
+	family VARCHAR(255) NOT NULL,
+	scopes VARCHAR(1024) NOT NULL DEFAULT '',
+	expires_at VARCHAR(32) NOT NULL,
+	used_at VARCHAR(32),
+	INDEX refresh_tokens_family (family),
+	FOREIGN KEY (username) REFERENCES users (username) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
+CREATE TABLE IF NOT EXISTS invitations (
+	code_hash VARCHAR(255) NOT NULL PRIMARY KEY,
+	created_by VARCHAR(255) NOT NULL,
+	max_uses INTEGER NOT NULL,
+	uses INTEGER NOT NULL DEFAULT 0,
+	created_at VARCHAR(32) NOT NULL,
+	expires_at VARCHAR(32) NOT NULL
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
+CREATE TABLE IF NOT EXISTS oauth_clients (
+	id VARCHAR(255) NOT NULL PRIMARY KEY,
+	name VARCHAR(255) NOT NULL,
+	secret_hash VARCHAR(255),
+	redirect_uris TEXT NOT NULL,
+	scopes VARCHAR(1024) NOT NULL,
+	created_by VARCHAR(255) NOT NULL,
+	created_at VARCHAR(32) NOT NULL
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
+CREATE TABLE IF NOT EXISTS oauth_codes (
+	code_hash VARCHAR(255) NOT NULL PRIMARY KEY,
+	client_id VARCHAR(255) NOT NULL,
+	username VARCHAR(255) COLLATE utf8mb4_general_ci NOT NULL,
+	redirect_uri TEXT NOT NULL,
+	scopes VARCHAR(1024) NOT NULL,
+	code_challenge VARCHAR(255) NOT NULL,
+	expires_at VARCHAR(32) NOT NULL,
+	FOREIGN KEY (client_id) REFERENCES oauth_clients (id) ON DELETE CASCADE,
+	FOREIGN KEY (username) REFERENCES users (username) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
+CREATE TABLE IF NOT EXISTS auth_events (
+	id BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+	type VARCHAR(64) NOT NULL,
+	username VARCHAR(255) COLLATE utf8mb4_general_ci NOT NULL,
+	ip VARCHAR(64) NOT NULL,
+	user_agent TEXT NOT NULL,
+	detail TEXT NOT NULL,
+	created_at VARCHAR(32) NOT NULL,
+	INDEX auth_events_username (username, id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
+CREATE TABLE IF NOT EXISTS identities (
+	provider VARCHAR(64) NOT NULL,
+	subject VARCHAR(255) NOT NULL,
+	username VARCHAR(255) COLLATE utf8mb4_general_ci NOT NULL,
+	email VARCHAR(255),
+	created_at VARCHAR(32) NOT NULL,
+	PRIMARY KEY (provider, subject),
+	UNIQUE (username, provider),
+	FOREIGN KEY (username) REFERENCES users (username) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
+CREATE TABLE IF NOT EXISTS webauthn_credentials (
+	id VARBINARY(1023) NOT NULL PRIMARY KEY,
+	username VARCHAR(255) COLLATE utf8mb4_general_ci NOT NULL,
+	public_key BLOB NOT NULL,
+	sign_count BIGINT NOT NULL DEFAULT 0,
+	created_at VARCHAR(32) NOT NULL,
+	FOREIGN KEY (username) REFERENCES users (username) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
+CREATE TABLE IF NOT EXISTS sessions (
+	id BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+	sessionId VARCHAR(255) NOT NULL,
+	createdAt VARCHAR(32) NOT NULL,
+	lastActive VARCHAR(32) NOT NULL,
+	data LONGBLOB NOT NULL
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
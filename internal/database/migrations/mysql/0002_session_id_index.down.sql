@@ -0,0 +1 @@
+DROP INDEX sessions_session_id ON sessions;
@@ -0,0 +1,2 @@
+-- Look up stored sessions by id, which must be unique
+CREATE UNIQUE INDEX sessions_session_id ON sessions (sessionId);
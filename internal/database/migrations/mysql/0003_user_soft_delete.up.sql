@@ -0,0 +1,2 @@
+-- Deleted users are kept until purged, so their deletion can be reverted
+ALTER TABLE users ADD COLUMN deleted_at VARCHAR(32);
@@ -0,0 +1,2 @@
+DROP INDEX users_uuid ON users;
+ALTER TABLE users DROP COLUMN uuid;
@@ -0,0 +1,3 @@
+-- UUIDv7 ids of users, exposed instead of the integer id with BLUEPRINT_DB_ID_TYPE=uuid
+ALTER TABLE users ADD COLUMN uuid VARCHAR(36);
+CREATE UNIQUE INDEX users_uuid ON users (uuid);
@@ -0,0 +1,2 @@
+DROP INDEX users_email ON users;
+CREATE INDEX users_email ON users (email);
@@ -0,0 +1,4 @@
+-- An email address belongs to one user. Duplicate emails of existing users
+-- must be resolved before applying it
+DROP INDEX users_email ON users;
+CREATE UNIQUE INDEX users_email ON users (email);
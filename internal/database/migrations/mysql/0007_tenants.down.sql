@@ -0,0 +1,4 @@
+DROP INDEX users_email ON users;
+CREATE UNIQUE INDEX users_email ON users (email);
+ALTER TABLE sessions DROP COLUMN tenant_id;
+ALTER TABLE users DROP COLUMN tenant_id;
@@ -0,0 +1,6 @@
+-- Users and sessions belong to a tenant, '' outside multi-tenant setups.
+-- Usernames stay unique across tenants, emails are unique within one
+ALTER TABLE users ADD COLUMN tenant_id VARCHAR(63) NOT NULL DEFAULT '';
+ALTER TABLE sessions ADD COLUMN tenant_id VARCHAR(63) NOT NULL DEFAULT '';
+DROP INDEX users_email ON users;
+CREATE UNIQUE INDEX users_email ON users (tenant_id, email);
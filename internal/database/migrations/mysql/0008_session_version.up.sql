@@ -0,0 +1,3 @@
+-- Every write of a session increments its version, so a write based on an
+-- older version is detected instead of overwriting the data of another request
+ALTER TABLE sessions ADD COLUMN version BIGINT NOT NULL DEFAULT 0;
@@ -0,0 +1,4 @@
+DROP INDEX sessions_expires_at ON sessions;
+DROP INDEX sessions_username ON sessions;
+ALTER TABLE sessions DROP COLUMN expires_at;
+ALTER TABLE sessions DROP COLUMN username;
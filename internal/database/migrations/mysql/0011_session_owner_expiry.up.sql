@@ -0,0 +1,6 @@
+-- The owner of each session is recorded to find the sessions of a user, and
+-- the moment it expires under its own timeouts to collect it
+ALTER TABLE sessions ADD COLUMN username VARCHAR(255) NOT NULL DEFAULT '';
+ALTER TABLE sessions ADD COLUMN expires_at VARCHAR(32);
+CREATE INDEX sessions_username ON sessions (username);
+CREATE INDEX sessions_expires_at ON sessions (expires_at);
@@ -0,0 +1,146 @@
+CREATE TABLE IF NOT EXISTS users (
+	id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+	username TEXT NOT NULL UNIQUE,
+	password BYTEA NOT NULL,
+	email TEXT,
+	verified_at TEXT,
+	totp_secret TEXT,
+	totp_enabled_at TEXT,
+	display_name TEXT,
+	avatar_url TEXT,
+	disabled_at TEXT,
+	password_reset_required INTEGER NOT NULL DEFAULT 0,
+	status TEXT NOT NULL DEFAULT 'active',
+	password_changed_at TEXT
+);
+
+-- Usernames are unique regardless of case through an index on their lowercase
+-- form, the SQLite NOCASE collation has no equivalent
+CREATE UNIQUE INDEX IF NOT EXISTS users_username_lower ON users (lower(username));
+
+CREATE INDEX IF NOT EXISTS users_email ON users (email);
+
+CREATE TABLE IF NOT EXISTS email_verifications (
+	token_hash TEXT NOT NULL PRIMARY KEY,
+	username TEXT NOT NULL REFERENCES users (username) ON DELETE CASCADE,
+	expires_at TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS recovery_codes (
+	username TEXT NOT NULL REFERENCES users (username) ON DELETE CASCADE,
+	code_hash TEXT NOT NULL,
+	PRIMARY KEY (username, code_hash)
+);
+
+CREATE TABLE IF NOT EXISTS user_roles (
+	username TEXT NOT NULL REFERENCES users (username) ON DELETE CASCADE,
+	role TEXT NOT NULL,
+	PRIMARY KEY (username, role)
+);
+
+CREATE TABLE IF NOT EXISTS role_permissions (
+	role TEXT NOT NULL,
+	action TEXT NOT NULL,
+	resource TEXT NOT NULL,
+	PRIMARY KEY (role, action, resource)
+);
+
+-- Admins are allowed every action on every resource
+INSERT INTO role_permissions (role, action, resource) VALUES ('admin', '*', '*') ON CONFLICT DO NOTHING;
+
+CREATE TABLE IF NOT EXISTS api_keys (
+	id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+	username TEXT NOT NULL REFERENCES users (username) ON DELETE CASCADE,
+	name TEXT NOT NULL,
+	prefix TEXT NOT NULL,
+	key_hash TEXT NOT NULL UNIQUE,
+	scopes TEXT NOT NULL DEFAULT '',
+	created_at TEXT NOT NULL,
+	last_used_at TEXT,
+	revoked_at TEXT
+);
+
+CREATE TABLE IF NOT EXISTS magic_links (
+	token_hash TEXT NOT NULL PRIMARY KEY,
+	username TEXT NOT NULL REFERENCES users (username) ON DELETE CASCADE,
+	created_at TEXT NOT NULL,
+	expires_at TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+	token_hash TEXT NOT NULL PRIMARY KEY,
+	username TEXT NOT NULL REFERENCES users (username) ON DELETE CASCADE,
+	family TEXT NOT NULL,
+	scopes TEXT NOT NULL DEFAULT '',
+	expires_at TEXT NOT NULL,
+	used_at TEXT
+);
+
+CREATE INDEX IF NOT EXISTS refresh_tokens_family ON refresh_tokens (family);
+
+CREATE TABLE IF NOT EXISTS invitations (
+	code_hash TEXT NOT NULL PRIMARY KEY,
+	created_by TEXT NOT NULL,
+	max_uses INTEGER NOT NULL,
+	uses INTEGER NOT NULL DEFAULT 0,
+	created_at TEXT NOT NULL,
+	expires_at TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS oauth_clients (
+	id TEXT NOT NULL PRIMARY KEY,
+	name TEXT NOT NULL,
+	secret_hash TEXT,
+	redirect_uris TEXT NOT NULL,
+	scopes TEXT NOT NULL,
+	created_by TEXT NOT NULL,
+	created_at TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS oauth_codes (
+	code_hash TEXT NOT NULL PRIMARY KEY,
+	client_id TEXT NOT NULL REFERENCES oauth_clients (id) ON DELETE CASCADE,
+	username TEXT NOT NULL REFERENCES users (username) ON DELETE CASCADE,
+	redirect_uri TEXT NOT NULL,
+	scopes TEXT NOT NULL,
+	code_challenge TEXT NOT NULL,
+	expires_at TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS auth_events (
+	id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+	type TEXT NOT NULL,
+	username TEXT NOT NULL,
+	ip TEXT NOT NULL,
+	user_agent TEXT NOT NULL,
+	detail TEXT NOT NULL,
+	created_at TEXT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS auth_events_username ON auth_events (username, id);
+
+CREATE TABLE IF NOT EXISTS identities (
+	provider TEXT NOT NULL,
+	subject TEXT NOT NULL,
+	username TEXT NOT NULL REFERENCES users (username) ON DELETE CASCADE,
+	email TEXT,
+	created_at TEXT NOT NULL,
+	PRIMARY KEY (provider, subject),
+	UNIQUE (username, provider)
+);
+
+CREATE TABLE IF NOT EXISTS webauthn_credentials (
+	id BYTEA NOT NULL PRIMARY KEY,
+	username TEXT NOT NULL REFERENCES users (username) ON DELETE CASCADE,
+	public_key BYTEA NOT NULL,
+	sign_count BIGINT NOT NULL DEFAULT 0,
+	created_at TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS sessions (
+	id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+	sessionId TEXT NOT NULL,
+	createdAt TEXT NOT NULL,
+	lastActive TEXT NOT NULL,
+	data BYTEA NOT NULL
+);
@@ -0,0 +1,6 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS created_at TEXT;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS updated_at TEXT;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS last_login_at TEXT;
+
+-- Users created before the timestamps were recorded get the time of their last password change
+UPDATE users SET created_at = password_changed_at, updated_at = password_changed_at WHERE created_at IS NULL;
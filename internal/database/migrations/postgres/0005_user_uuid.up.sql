@@ -0,0 +1,3 @@
+-- UUIDv7 ids of users, exposed instead of the integer id with BLUEPRINT_DB_ID_TYPE=uuid
+ALTER TABLE users ADD COLUMN IF NOT EXISTS uuid TEXT;
+CREATE UNIQUE INDEX IF NOT EXISTS users_uuid ON users (uuid);
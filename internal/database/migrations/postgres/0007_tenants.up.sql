@@ -0,0 +1,6 @@
+-- Users and sessions belong to a tenant, '' outside multi-tenant setups.
+-- Usernames stay unique across tenants, emails are unique within one
+ALTER TABLE users ADD COLUMN IF NOT EXISTS tenant_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS tenant_id TEXT NOT NULL DEFAULT '';
+DROP INDEX IF EXISTS users_email;
+CREATE UNIQUE INDEX IF NOT EXISTS users_email ON users (tenant_id, email);
@@ -0,0 +1,5 @@
+-- Secrets being enrolled are kept apart until confirmed, so the secret in
+-- use keeps working meanwhile, and the last accepted time step of each user
+-- rejects replayed codes
+ALTER TABLE users ADD COLUMN IF NOT EXISTS totp_pending_secret TEXT;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS totp_last_step BIGINT NOT NULL DEFAULT 0;
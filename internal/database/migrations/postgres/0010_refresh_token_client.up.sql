@@ -0,0 +1,3 @@
+-- Refresh tokens issued to OAuth clients can only be redeemed by the same
+-- client, first-party tokens have no client
+ALTER TABLE refresh_tokens ADD COLUMN IF NOT EXISTS client_id TEXT NOT NULL DEFAULT '';
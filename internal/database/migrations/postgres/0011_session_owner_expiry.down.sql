@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS sessions_expires_at;
+DROP INDEX IF EXISTS sessions_username;
+ALTER TABLE sessions DROP COLUMN IF EXISTS expires_at;
+ALTER TABLE sessions DROP COLUMN IF EXISTS username;
@@ -0,0 +1,6 @@
+-- The owner of each session is recorded to find the sessions of a user, and
+-- the moment it expires under its own timeouts to collect it
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS username TEXT NOT NULL DEFAULT '';
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS expires_at TEXT;
+CREATE INDEX IF NOT EXISTS sessions_username ON sessions (username);
+CREATE INDEX IF NOT EXISTS sessions_expires_at ON sessions (expires_at);
@@ -0,0 +1,15 @@
+DROP TABLE IF EXISTS sessions;
+DROP TABLE IF EXISTS webauthn_credentials;
+DROP TABLE IF EXISTS identities;
+DROP TABLE IF EXISTS auth_events;
+DROP TABLE IF EXISTS oauth_codes;
+DROP TABLE IF EXISTS oauth_clients;
+DROP TABLE IF EXISTS invitations;
+DROP TABLE IF EXISTS refresh_tokens;
+DROP TABLE IF EXISTS magic_links;
+DROP TABLE IF EXISTS api_keys;
+DROP TABLE IF EXISTS role_permissions;
+DROP TABLE IF EXISTS user_roles;
+DROP TABLE IF EXISTS recovery_codes;
+DROP TABLE IF EXISTS email_verifications;
+DROP TABLE IF EXISTS users;
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS sessions_session_id;
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS users_email;
+CREATE INDEX IF NOT EXISTS users_email ON users (email);
@@ -0,0 +1,4 @@
+-- An email address belongs to one user. Duplicate emails of existing users
+-- must be resolved before applying it
+DROP INDEX IF EXISTS users_email;
+CREATE UNIQUE INDEX IF NOT EXISTS users_email ON users (email);
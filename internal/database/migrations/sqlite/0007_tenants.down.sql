@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS users_email;
+CREATE UNIQUE INDEX IF NOT EXISTS users_email ON users (email);
+ALTER TABLE sessions DROP COLUMN tenant_id;
+ALTER TABLE users DROP COLUMN tenant_id;
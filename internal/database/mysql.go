@@ -0,0 +1,31 @@
+package database
+
+import (
+	"fmt"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// mysqlDSN adds the parameters the queries rely on to a MySQL DSN such as
+// "user:password@tcp(localhost:3306)/app".
+func mysqlDSN(dsn string) (string, error) {
+	config, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		return "", fmt.Errorf("error parsing MySQL DSN: %v", err)
+	}
+	// Updates setting a column to its current value still count as affected
+	config.ClientFoundRows = true
+	return config.FormatDSN(), nil
+}
+
+// redactMySQLDSN hides the password of a MySQL DSN, so it can be logged.
+func redactMySQLDSN(dsn string) string {
+	config, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		return "invalid DSN"
+	}
+	if config.Passwd != "" {
+		config.Passwd = "xxxxx"
+	}
+	return config.FormatDSN()
+}
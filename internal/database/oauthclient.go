@@ -0,0 +1,104 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/raziel-aleman/go-starter/internal/database/queries"
+)
+
+// OAuthClient is a third-party application allowed to request access tokens
+// on behalf of users. The secret is only stored hashed, public clients have none.
+type OAuthClient struct {
+	ID           string
+	Name         string
+	SecretHash   string
+	RedirectURIs []string
+	Scopes       []string
+	CreatedBy    string
+}
+
+// OAuthCode is an authorization code granted by a user to a client.
+type OAuthCode struct {
+	ClientID      string
+	Username      string
+	RedirectURI   string
+	Scopes        []string
+	CodeChallenge string
+	ExpiresAt     time.Time
+}
+
+// CreateOAuthClient registers an OAuth client.
+func (s *service) CreateOAuthClient(ctx context.Context, client OAuthClient) error {
+	return queries.New(s.db).CreateOAuthClient(ctx, queries.CreateOAuthClientParams{
+		ID:           client.ID,
+		Name:         client.Name,
+		SecretHash:   sql.NullString{String: client.SecretHash, Valid: client.SecretHash != ""},
+		RedirectUris: strings.Join(client.RedirectURIs, " "),
+		Scopes:       strings.Join(client.Scopes, " "),
+		CreatedBy:    client.CreatedBy,
+		CreatedAt:    time.Now().UTC().Format(time.RFC3339),
+	})
+}
+
+// OAuthClient returns a registered OAuth client by id.
+func (s *service) OAuthClient(ctx context.Context, id string) (OAuthClient, error) {
+	ctx, cancel := s.db.readContext(ctx)
+	defer cancel()
+	row, err := queries.New(s.db).FindOAuthClient(ctx, id)
+	return OAuthClient{
+		ID:           row.ID,
+		Name:         row.Name,
+		SecretHash:   row.SecretHash.String,
+		RedirectURIs: strings.Fields(row.RedirectUris),
+		Scopes:       strings.Fields(row.Scopes),
+		CreatedBy:    row.CreatedBy,
+	}, err
+}
+
+// SaveOAuthCode stores the hash of an authorization code. Expired codes are
+// removed at the same time.
+func (s *service) SaveOAuthCode(ctx context.Context, codeHash string, code OAuthCode) error {
+	return s.withTx(ctx, func(t *tx) error {
+		q := queries.New(t)
+		if err := q.DeleteExpiredOAuthCodes(ctx, time.Now().UTC().Format(time.RFC3339)); err != nil {
+			return err
+		}
+		return q.CreateOAuthCode(ctx, queries.CreateOAuthCodeParams{
+			CodeHash:      codeHash,
+			ClientID:      code.ClientID,
+			Username:      code.Username,
+			RedirectUri:   code.RedirectURI,
+			Scopes:        strings.Join(code.Scopes, " "),
+			CodeChallenge: code.CodeChallenge,
+			ExpiresAt:     code.ExpiresAt.UTC().Format(time.RFC3339),
+		})
+	})
+}
+
+// UseOAuthCode deletes an authorization code and returns it, so it can only
+// be exchanged once. It returns sql.ErrNoRows for unknown codes.
+func (s *service) UseOAuthCode(ctx context.Context, codeHash string) (OAuthCode, error) {
+	ctx, cancel := s.db.readContext(ctx)
+	defer cancel()
+	q := queries.New(s.db)
+	row, err := q.FindOAuthCode(ctx, codeHash)
+	if err != nil {
+		return OAuthCode{}, err
+	}
+	// Only one caller can delete the code, a concurrent exchange gets sql.ErrNoRows
+	if err := oneRow(q.DeleteOAuthCode(ctx, codeHash)); err != nil {
+		return OAuthCode{}, err
+	}
+	code := OAuthCode{
+		ClientID:      row.ClientID,
+		Username:      row.Username,
+		RedirectURI:   row.RedirectUri,
+		Scopes:        strings.Fields(row.Scopes),
+		CodeChallenge: row.CodeChallenge,
+	}
+	code.ExpiresAt, err = time.Parse(time.RFC3339, row.ExpiresAt)
+	return code, err
+}
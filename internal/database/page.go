@@ -0,0 +1,78 @@
+package database
+
+import (
+	"errors"
+	"strings"
+)
+
+// ErrInvalidPage is returned when a page sorts by an unknown key or pages
+// by cursor on a column that is not unique.
+var ErrInvalidPage = errors.New("invalid page")
+
+// Page selects a slice of a list, either by offset or, to page through data
+// changing between requests, by keyset after the cursor of the previous page.
+type Page struct {
+	Limit  int    // Defaults to 50
+	Offset int    // Rows to skip, ignored with a cursor
+	Cursor string // Value of the sort column in the last row of the previous page
+	Sort   string // Sort key, prefixed with "-" for descending order
+}
+
+// SortKey returns the sort key of the page without its direction.
+func (p Page) SortKey() string {
+	return strings.TrimPrefix(p.Sort, "-")
+}
+
+// sortColumn is a column a list can be sorted by.
+type sortColumn struct {
+	column string // Column or expression of the query
+	unique bool   // Whether the list can be paged by cursor on it
+}
+
+// paginate appends the conditions, the order, and the limit of a page to a
+// query. Sort keys are looked up in columns, so client input never reaches
+// the SQL. An empty key sorts by defaultSort, which must be a unique column.
+func paginate(query string, conditions []string, args []any, page Page, columns map[string]sortColumn, defaultSort string) (string, []any, error) {
+	if page.Limit <= 0 {
+		page.Limit = 50
+	}
+	if page.Sort == "" {
+		page.Sort = defaultSort
+	}
+	sort, ok := columns[page.SortKey()]
+	if !ok {
+		return "", nil, ErrInvalidPage
+	}
+	descending := strings.HasPrefix(page.Sort, "-")
+
+	if page.Cursor != "" {
+		if !sort.unique {
+			return "", nil, ErrInvalidPage
+		}
+		if descending {
+			conditions = append(conditions, sort.column+" < ?")
+		} else {
+			conditions = append(conditions, sort.column+" > ?")
+		}
+		args = append(args, page.Cursor)
+	}
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	query += " ORDER BY " + sort.column
+	if descending {
+		query += " DESC"
+	}
+	if !sort.unique {
+		// Rows with the same value keep a stable order from page to page
+		query += ", " + columns[strings.TrimPrefix(defaultSort, "-")].column
+	}
+	query += " LIMIT ?"
+	args = append(args, page.Limit)
+	if page.Cursor == "" {
+		query += " OFFSET ?"
+		args = append(args, page.Offset)
+	}
+	return query, args, nil
+}
@@ -0,0 +1,66 @@
+package database
+
+import (
+	"context"
+
+	"github.com/raziel-aleman/go-starter/internal/database/dbutil"
+)
+
+// Permission allows an action on a resource, e.g. "delete" on "post".
+// Either may be "*" to match any action or resource.
+type Permission struct {
+	Action   string `json:"action" db:"action"`
+	Resource string `json:"resource" db:"resource"`
+}
+
+// GrantPermission allows a role to perform an action on a resource.
+// Granting a permission twice is a no-op.
+func (s *service) GrantPermission(ctx context.Context, role string, permission Permission) error {
+	_, err := s.db.ExecContext(ctx,
+		"INSERT INTO role_permissions (role, action, resource) VALUES (?, ?, ?)"+s.db.ignoreConflict("role"),
+		role,
+		permission.Action,
+		permission.Resource,
+	)
+	return err
+}
+
+// RevokePermission removes a permission from a role.
+func (s *service) RevokePermission(ctx context.Context, role string, permission Permission) error {
+	_, err := s.db.ExecContext(ctx,
+		"DELETE FROM role_permissions WHERE role = ? AND action = ? AND resource = ?",
+		role,
+		permission.Action,
+		permission.Resource,
+	)
+	return err
+}
+
+// RolePermissions returns the permissions granted to a role.
+func (s *service) RolePermissions(ctx context.Context, role string) ([]Permission, error) {
+	return dbutil.QueryMany[Permission](ctx, s.db,
+		"SELECT action, resource FROM role_permissions WHERE role = ? ORDER BY resource, action",
+		role,
+	)
+}
+
+// UserHasPermission reports whether any role of a user grants the permission,
+// either exactly or through a "*" wildcard.
+func (s *service) UserHasPermission(ctx context.Context, username string, permission Permission) (bool, error) {
+	ctx, cancel := s.db.readContext(ctx)
+	defer cancel()
+	var allowed bool
+	err := s.db.QueryRowContext(ctx,
+		`SELECT EXISTS(
+			SELECT 1 FROM user_roles ur
+			JOIN role_permissions rp ON rp.role = ur.role
+			WHERE ur.username = ?
+			AND rp.action IN (?, '*')
+			AND rp.resource IN (?, '*')
+		)`,
+		username,
+		permission.Action,
+		permission.Resource,
+	).Scan(&allowed)
+	return allowed, err
+}
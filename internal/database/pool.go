@@ -0,0 +1,61 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// poolConfig sizes the connection pool.
+type poolConfig struct {
+	MaxOpenConns    int           // 0 for no limit
+	MaxIdleConns    int           // Connections kept open between requests
+	ConnMaxLifetime time.Duration // 0 to reuse connections forever
+}
+
+// defaultPoolConfig returns the pool settings of a driver. Server databases
+// get connections recycled before servers or proxies drop them, SQLite files
+// keep theirs.
+func defaultPoolConfig(driver string) poolConfig {
+	if driver == DriverSQLite {
+		return poolConfig{MaxOpenConns: 10, MaxIdleConns: 10}
+	}
+	return poolConfig{MaxOpenConns: 25, MaxIdleConns: 25, ConnMaxLifetime: 5 * time.Minute}
+}
+
+// poolConfigFromEnv overrides the defaults of a driver with
+// BLUEPRINT_DB_MAX_OPEN_CONNS, BLUEPRINT_DB_MAX_IDLE_CONNS, and
+// BLUEPRINT_DB_CONN_MAX_LIFETIME.
+func poolConfigFromEnv(driver string) (poolConfig, error) {
+	config := defaultPoolConfig(driver)
+	for name, field := range map[string]*int{
+		"BLUEPRINT_DB_MAX_OPEN_CONNS": &config.MaxOpenConns,
+		"BLUEPRINT_DB_MAX_IDLE_CONNS": &config.MaxIdleConns,
+	} {
+		if value := os.Getenv(name); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 {
+				return config, fmt.Errorf("invalid %s %q", name, value)
+			}
+			*field = n
+		}
+	}
+	if value := os.Getenv("BLUEPRINT_DB_CONN_MAX_LIFETIME"); value != "" {
+		lifetime, err := time.ParseDuration(value)
+		if err != nil || lifetime < 0 {
+			return config, fmt.Errorf("invalid BLUEPRINT_DB_CONN_MAX_LIFETIME %q", value)
+		}
+		config.ConnMaxLifetime = lifetime
+	}
+	return config, nil
+}
+
+// apply sets the pool limits of db. Idle connections beyond the open limit
+// are reduced by database/sql itself.
+func (c poolConfig) apply(db *sql.DB) {
+	db.SetMaxOpenConns(c.MaxOpenConns)
+	db.SetMaxIdleConns(c.MaxIdleConns)
+	db.SetConnMaxLifetime(c.ConnMaxLifetime)
+}
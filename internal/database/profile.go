@@ -0,0 +1,162 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+// ErrEmailTaken is returned when an email address is already used by another user.
+var ErrEmailTaken = errors.New("email already in use")
+
+// UserProfile is the public information of a user.
+type UserProfile struct {
+	Username    string
+	Email       string
+	DisplayName string
+	AvatarURL   string
+	Verified    bool
+}
+
+// ProfileUpdate holds the profile fields to change. Nil fields are left as is,
+// empty strings clear the field.
+type ProfileUpdate struct {
+	Email       *string
+	DisplayName *string
+	AvatarURL   *string
+}
+
+// UserProfile returns the profile of a user.
+func (s *service) UserProfile(ctx context.Context, username string) (UserProfile, error) {
+	ctx, cancel := s.db.readContext(ctx)
+	defer cancel()
+	var p UserProfile
+	var email, displayName, avatarURL sql.NullString
+	query, args := andTenant(ctx,
+		"SELECT username, email, display_name, avatar_url, verified_at IS NOT NULL FROM users WHERE username = ? AND deleted_at IS NULL",
+		username,
+	)
+	err := s.reader(ctx).QueryRowContext(ctx, query, args...).Scan(&p.Username, &email, &displayName, &avatarURL, &p.Verified)
+	p.Email, p.DisplayName, p.AvatarURL = email.String, displayName.String, avatarURL.String
+	return p, err
+}
+
+// FindUserByEmail returns the profile of the user with the given email,
+// matched regardless of case and surrounding spaces.
+func (s *service) FindUserByEmail(ctx context.Context, email string) (UserProfile, error) {
+	ctx, cancel := s.db.readContext(ctx)
+	defer cancel()
+	var username string
+	query, args := andTenant(ctx,
+		"SELECT username FROM users WHERE email = ? AND deleted_at IS NULL",
+		normalizeEmail(email),
+	)
+	err := s.reader(ctx).QueryRowContext(ctx, query, args...).Scan(&username)
+	if err != nil {
+		return UserProfile{}, err
+	}
+	return s.UserProfile(ctx, username)
+}
+
+// UpdateEmail changes the email of a user, or clears it if empty, and marks
+// it as unverified if it changes. It returns ErrEmailTaken if another user
+// has the email, or sql.ErrNoRows if the user does not exist.
+func (s *service) UpdateEmail(ctx context.Context, username string, email string) error {
+	return s.UpdateUserProfile(ctx, username, ProfileUpdate{Email: &email})
+}
+
+// UpdateUserProfile changes the non-nil fields of a user profile. Changing
+// the email marks it as unverified. It returns ErrEmailTaken if another user
+// has the new email, or sql.ErrNoRows if the user does not exist.
+func (s *service) UpdateUserProfile(ctx context.Context, username string, update ProfileUpdate) error {
+	var assignments []string
+	var args []any
+	if update.Email != nil {
+		// Only reset the verification if the email actually changes
+		assignments = append(assignments,
+			"verified_at = CASE WHEN email "+s.db.nullSafeEqual()+" NULLIF(?, '') THEN verified_at ELSE NULL END",
+			"email = NULLIF(?, '')",
+		)
+		email := normalizeEmail(*update.Email)
+		args = append(args, email, email)
+	}
+	if update.DisplayName != nil {
+		assignments = append(assignments, "display_name = NULLIF(?, '')")
+		args = append(args, *update.DisplayName)
+	}
+	if update.AvatarURL != nil {
+		assignments = append(assignments, "avatar_url = NULLIF(?, '')")
+		args = append(args, *update.AvatarURL)
+	}
+	if len(assignments) == 0 {
+		return nil
+	}
+	assignments = append(assignments, "updated_at = ?")
+	args = append(args, time.Now().UTC().Format(time.RFC3339), username)
+
+	query, args := andTenant(ctx,
+		"UPDATE users SET "+strings.Join(assignments, ", ")+" WHERE username = ? AND deleted_at IS NULL",
+		args...,
+	)
+	err := s.execOne(ctx, query, args...)
+	if isUniqueViolation(err) {
+		return ErrEmailTaken
+	}
+	return err
+}
+
+// DeleteUser soft-deletes a user: it is excluded from every user query until
+// restored, and its refresh tokens are revoked. It returns sql.ErrNoRows if
+// the user does not exist or is already deleted.
+func (s *service) DeleteUser(ctx context.Context, username string) error {
+	now := time.Now().UTC().Format(time.RFC3339)
+	return s.withTx(ctx, func(t *tx) error {
+		query, args := andTenant(ctx,
+			"UPDATE users SET deleted_at = ?, updated_at = ? WHERE username = ? AND deleted_at IS NULL",
+			now,
+			now,
+			username,
+		)
+		err := affectOne(ctx, t, query, args...)
+		if err != nil {
+			return err
+		}
+		_, err = t.ExecContext(ctx, "DELETE FROM refresh_tokens WHERE username = ?", username)
+		return err
+	})
+}
+
+// RestoreUser reverts the soft deletion of a user, matching its username
+// case-insensitively. It returns sql.ErrNoRows if no deleted user matches.
+func (s *service) RestoreUser(ctx context.Context, username string) error {
+	query, args := andTenant(ctx,
+		"UPDATE users SET deleted_at = NULL, updated_at = ? WHERE "+s.db.equalFold("username")+" AND deleted_at IS NOT NULL",
+		time.Now().UTC().Format(time.RFC3339),
+		username,
+	)
+	return s.execOne(ctx, query, args...)
+}
+
+// PurgeUser removes a user, deleted or not, matching its username
+// case-insensitively, and through foreign keys its tokens, roles, and
+// credentials. It returns sql.ErrNoRows if the user does not exist.
+func (s *service) PurgeUser(ctx context.Context, username string) error {
+	query, args := andTenant(ctx, "DELETE FROM users WHERE "+s.db.equalFold("username"), username)
+	return s.execOne(ctx, query, args...)
+}
+
+// PurgeDeletedUsers removes the users soft-deleted before the given time and
+// returns how many were removed.
+func (s *service) PurgeDeletedUsers(ctx context.Context, before time.Time) (int64, error) {
+	query, args := andTenant(ctx,
+		"DELETE FROM users WHERE deleted_at IS NOT NULL AND deleted_at < ?",
+		before.UTC().Format(time.RFC3339),
+	)
+	result, err := s.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,11 @@
+// Package queries is the type-safe query layer generated by sqlc from the
+// .sql files of this directory and the SQLite migrations. New queries are
+// added to a .sql file and generated with `make sqlc`, never edited by hand.
+//
+// The queries use ? placeholders and run on every supported database through
+// the connection of package database, which rewrites the placeholders for
+// Postgres. Queries whose SQL differs between databases, like upserts,
+// case-insensitive matches, or dynamic filters, stay hand-written there.
+package queries
+
+//go:generate sqlc generate -f ../../../sqlc.yaml
@@ -0,0 +1,5 @@
+-- name: CreateInvitation :exec
+INSERT INTO invitations (code_hash, created_by, max_uses, created_at, expires_at) VALUES (?, ?, ?, ?, ?);
+
+-- name: UseInvitation :execrows
+UPDATE invitations SET uses = uses + 1 WHERE code_hash = ? AND uses < max_uses AND expires_at > ?;
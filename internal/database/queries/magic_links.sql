@@ -0,0 +1,14 @@
+-- name: DeleteExpiredMagicLinks :exec
+DELETE FROM magic_links WHERE username = ? AND expires_at <= ?;
+
+-- name: CreateMagicLink :exec
+INSERT INTO magic_links (token_hash, username, created_at, expires_at) VALUES (?, ?, ?, ?);
+
+-- name: CountMagicLinks :one
+SELECT COUNT(*) FROM magic_links WHERE username = ? AND created_at >= ?;
+
+-- name: FindMagicLink :one
+SELECT username, expires_at FROM magic_links WHERE token_hash = ?;
+
+-- name: DeleteMagicLink :execrows
+DELETE FROM magic_links WHERE token_hash = ?;
@@ -0,0 +1,17 @@
+-- name: CreateOAuthClient :exec
+INSERT INTO oauth_clients (id, name, secret_hash, redirect_uris, scopes, created_by, created_at) VALUES (?, ?, ?, ?, ?, ?, ?);
+
+-- name: FindOAuthClient :one
+SELECT id, name, secret_hash, redirect_uris, scopes, created_by FROM oauth_clients WHERE id = ?;
+
+-- name: DeleteExpiredOAuthCodes :exec
+DELETE FROM oauth_codes WHERE expires_at <= ?;
+
+-- name: CreateOAuthCode :exec
+INSERT INTO oauth_codes (code_hash, client_id, username, redirect_uri, scopes, code_challenge, expires_at) VALUES (?, ?, ?, ?, ?, ?, ?);
+
+-- name: FindOAuthCode :one
+SELECT client_id, username, redirect_uri, scopes, code_challenge, expires_at FROM oauth_codes WHERE code_hash = ?;
+
+-- name: DeleteOAuthCode :execrows
+DELETE FROM oauth_codes WHERE code_hash = ?;
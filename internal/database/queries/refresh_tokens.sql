@@ -0,0 +1,17 @@
+-- name: DeleteExpiredRefreshTokens :exec
+DELETE FROM refresh_tokens WHERE username = ? AND expires_at <= ?;
+
+-- name: CreateRefreshToken :exec
+INSERT INTO refresh_tokens (token_hash, username, family, scopes, client_id, expires_at) VALUES (?, ?, ?, ?, ?, ?);
+
+-- name: UseRefreshToken :execrows
+UPDATE refresh_tokens SET used_at = ? WHERE token_hash = ? AND used_at IS NULL;
+
+-- name: FindRefreshToken :one
+SELECT username, family, scopes, client_id, expires_at, used_at FROM refresh_tokens WHERE token_hash = ?;
+
+-- name: DeleteRefreshTokenFamily :exec
+DELETE FROM refresh_tokens WHERE family = ?;
+
+-- name: DeleteUserRefreshTokens :exec
+DELETE FROM refresh_tokens WHERE username = ?;
@@ -0,0 +1,11 @@
+-- name: CreateWebAuthnCredential :exec
+INSERT INTO webauthn_credentials (id, username, public_key, sign_count, created_at) VALUES (?, ?, ?, ?, ?);
+
+-- name: ListWebAuthnCredentials :many
+SELECT id, username, public_key, sign_count FROM webauthn_credentials WHERE username = ?;
+
+-- name: FindWebAuthnCredential :one
+SELECT id, username, public_key, sign_count FROM webauthn_credentials WHERE id = ?;
+
+-- name: UpdateWebAuthnSignCount :exec
+UPDATE webauthn_credentials SET sign_count = ? WHERE id = ?;
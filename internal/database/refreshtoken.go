@@ -0,0 +1,99 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/raziel-aleman/go-starter/internal/database/queries"
+)
+
+// RefreshToken is a refresh token of the JWT mode. Every token descends from
+// a login through rotations, and all of them share the family of that login.
+type RefreshToken struct {
+	Username  string
+	Family    string
+	Scopes    []string
+	ClientID  string // OAuth client the token was issued to, "" for first-party tokens
+	ExpiresAt time.Time
+	Used      bool
+}
+
+// SaveRefreshToken stores the hash of a refresh token. Expired tokens of the
+// user are removed at the same time.
+func (s *service) SaveRefreshToken(ctx context.Context, tokenHash string, token RefreshToken) error {
+	return s.withTx(ctx, func(t *tx) error {
+		q := queries.New(t)
+		if err := q.DeleteExpiredRefreshTokens(ctx, queries.DeleteExpiredRefreshTokensParams{
+			Username:  token.Username,
+			ExpiresAt: time.Now().UTC().Format(time.RFC3339),
+		}); err != nil {
+			return err
+		}
+		return q.CreateRefreshToken(ctx, queries.CreateRefreshTokenParams{
+			TokenHash: tokenHash,
+			Username:  token.Username,
+			Family:    token.Family,
+			Scopes:    strings.Join(token.Scopes, " "),
+			ClientID:  token.ClientID,
+			ExpiresAt: token.ExpiresAt.UTC().Format(time.RFC3339),
+		})
+	})
+}
+
+// UseRefreshToken marks a refresh token as used and returns it as it was
+// before, so Used reports whether it had already been used. It returns
+// sql.ErrNoRows if the token does not exist.
+func (s *service) UseRefreshToken(ctx context.Context, tokenHash string) (RefreshToken, error) {
+	ctx, cancel := s.db.readContext(ctx)
+	defer cancel()
+	// Only one caller can flip used_at, concurrent uses are seen as reuse
+	err := oneRow(queries.New(s.db).UseRefreshToken(ctx, queries.UseRefreshTokenParams{
+		UsedAt:    sql.NullString{String: time.Now().UTC().Format(time.RFC3339), Valid: true},
+		TokenHash: tokenHash,
+	}))
+	if errors.Is(err, sql.ErrNoRows) {
+		return s.FindRefreshToken(ctx, tokenHash)
+	}
+	if err != nil {
+		return RefreshToken{}, err
+	}
+
+	// The token was unused until this update
+	token, err := s.FindRefreshToken(ctx, tokenHash)
+	token.Used = false
+	return token, err
+}
+
+// FindRefreshToken returns a refresh token by hash.
+func (s *service) FindRefreshToken(ctx context.Context, tokenHash string) (RefreshToken, error) {
+	ctx, cancel := s.db.readContext(ctx)
+	defer cancel()
+	row, err := queries.New(s.db).FindRefreshToken(ctx, tokenHash)
+	if err != nil {
+		return RefreshToken{}, err
+	}
+
+	token := RefreshToken{
+		Username: row.Username,
+		Family:   row.Family,
+		Scopes:   strings.Fields(row.Scopes),
+		ClientID: row.ClientID,
+		Used:     row.UsedAt.Valid,
+	}
+	token.ExpiresAt, err = time.Parse(time.RFC3339, row.ExpiresAt)
+	return token, err
+}
+
+// RevokeRefreshTokenFamily deletes every refresh token of a family.
+func (s *service) RevokeRefreshTokenFamily(ctx context.Context, family string) error {
+	return queries.New(s.db).DeleteRefreshTokenFamily(ctx, family)
+}
+
+// RevokeUserRefreshTokens deletes every refresh token of a user, ending all
+// its token families, e.g. when it is disabled or banned.
+func (s *service) RevokeUserRefreshTokens(ctx context.Context, username string) error {
+	return queries.New(s.db).DeleteUserRefreshTokens(ctx, username)
+}
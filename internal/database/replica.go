@@ -0,0 +1,204 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// replica is a read-only connection pool, used while it answers and its
+// replication lag is within the limit.
+type replica struct {
+	*conn
+	name    string // Redacted DSN, for logs
+	healthy atomic.Bool
+}
+
+// replicaConfig lists the replicas and the lag they are used up to.
+type replicaConfig struct {
+	DSNs          []string
+	MaxLag        time.Duration
+	CheckInterval time.Duration
+}
+
+// replicaConfigFromEnv reads BLUEPRINT_DB_REPLICA_URLS, comma-separated
+// connection URLs or DSNs of the replicas, BLUEPRINT_DB_REPLICA_MAX_LAG
+// (default 5s), and BLUEPRINT_DB_REPLICA_CHECK_INTERVAL (default 5s).
+func replicaConfigFromEnv() (replicaConfig, error) {
+	config := replicaConfig{MaxLag: 5 * time.Second, CheckInterval: 5 * time.Second}
+	for _, dsn := range strings.Split(os.Getenv("BLUEPRINT_DB_REPLICA_URLS"), ",") {
+		if dsn = strings.TrimSpace(dsn); dsn != "" {
+			config.DSNs = append(config.DSNs, dsn)
+		}
+	}
+	for name, field := range map[string]*time.Duration{
+		"BLUEPRINT_DB_REPLICA_MAX_LAG":        &config.MaxLag,
+		"BLUEPRINT_DB_REPLICA_CHECK_INTERVAL": &config.CheckInterval,
+	} {
+		if value := os.Getenv(name); value != "" {
+			d, err := time.ParseDuration(value)
+			if err != nil || d <= 0 {
+				return config, fmt.Errorf("invalid %s %q", name, value)
+			}
+			*field = d
+		}
+	}
+	return config, nil
+}
+
+// openReplicas opens the connection pools of the replicas. They are not
+// connected yet, an unreachable replica is skipped until it answers.
+func openReplicas(driver string, config replicaConfig, pool poolConfig) ([]*replica, error) {
+	if len(config.DSNs) > 0 && driver == DriverSQLite {
+		return nil, fmt.Errorf("read replicas need %s or %s", DriverPostgres, DriverMySQL)
+	}
+
+	replicas := make([]*replica, 0, len(config.DSNs))
+	for _, dsn := range config.DSNs {
+		name := redactURL(dsn)
+		if driver == DriverMySQL {
+			var err error
+			name = redactMySQLDSN(dsn)
+			if dsn, err = mysqlDSN(dsn); err != nil {
+				closeReplicas(replicas)
+				return nil, err
+			}
+		}
+		db, err := sql.Open(driver, dsn)
+		if err != nil {
+			closeReplicas(replicas)
+			return nil, err
+		}
+		pool.apply(db)
+		replicas = append(replicas, &replica{conn: &conn{DB: db, driver: driver}, name: name})
+	}
+	return replicas, nil
+}
+
+// closeReplicas closes the connection pools of the replicas.
+func closeReplicas(replicas []*replica) {
+	for _, r := range replicas {
+		r.Close()
+	}
+}
+
+// monitorReplicas checks the replicas every interval until ctx is done.
+func monitorReplicas(ctx context.Context, replicas []*replica, config replicaConfig) {
+	ticker := time.NewTicker(config.CheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			checkReplicas(ctx, replicas, config.MaxLag)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// checkReplicas marks the replicas answering within maxLag as healthy, and
+// the others as unhealthy, logging the changes.
+func checkReplicas(ctx context.Context, replicas []*replica, maxLag time.Duration) {
+	for _, r := range replicas {
+		checkCtx, cancel := context.WithTimeout(ctx, time.Second)
+		lag, err := replicationLag(checkCtx, r.conn)
+		cancel()
+		if err == nil && lag > maxLag {
+			err = fmt.Errorf("replication lag %s exceeds %s", lag, maxLag)
+		}
+
+		healthy := err == nil
+		if r.healthy.Swap(healthy) != healthy {
+			if healthy {
+				r.log().Info("Database replica is back in use")
+			} else {
+				r.log().Warn("Database replica is out of use", "err", err)
+			}
+		}
+	}
+}
+
+// replicationLag returns how far a replica is behind its primary. A
+// database that is not a replica has no lag.
+func replicationLag(ctx context.Context, c *conn) (time.Duration, error) {
+	if c.driver == DriverMySQL {
+		return mysqlReplicationLag(ctx, c)
+	}
+
+	// A replica having replayed everything it received is not behind, even
+	// if the primary has not written for a while
+	var seconds float64
+	err := c.QueryRowContext(ctx, `SELECT COALESCE(CASE
+		WHEN pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() THEN 0
+		ELSE EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp())
+	END, 0)`).Scan(&seconds)
+	return time.Duration(seconds * float64(time.Second)), err
+}
+
+// mysqlReplicationLag reads Seconds_Behind_Source, or Seconds_Behind_Master
+// before MySQL 8.0.22, from the replica status.
+func mysqlReplicationLag(ctx context.Context, c *conn) (time.Duration, error) {
+	rows, err := c.QueryContext(ctx, "SHOW REPLICA STATUS")
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		return 0, rows.Err()
+	}
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return 0, err
+	}
+	values := make([]sql.NullString, len(columns))
+	dest := make([]any, len(columns))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	if err := rows.Scan(dest...); err != nil {
+		return 0, err
+	}
+	for i, column := range columns {
+		if column != "Seconds_Behind_Source" && column != "Seconds_Behind_Master" {
+			continue
+		}
+		if !values[i].Valid {
+			return 0, fmt.Errorf("replication is not running")
+		}
+		seconds, err := strconv.Atoi(values[i].String)
+		return time.Duration(seconds) * time.Second, err
+	}
+	return 0, fmt.Errorf("replica status has no lag column")
+}
+
+// primaryKey is the context key of WithPrimary.
+type primaryKey struct{}
+
+// WithPrimary returns a context whose reads go to the primary, for requests
+// that must see their own writes.
+func WithPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryKey{}, true)
+}
+
+// reader returns the connection pool of a read-only query: the next healthy
+// replica, or the primary if none is or ctx asks for it. Reads deciding
+// access, like credentials, status, and roles, always use the primary, so a
+// lagging replica cannot undo a revocation.
+func (s *service) reader(ctx context.Context) *conn {
+	if primary, _ := ctx.Value(primaryKey{}).(bool); primary || len(s.replicas) == 0 {
+		return s.db
+	}
+	start := s.nextReplica.Add(1)
+	for i := range uint64(len(s.replicas)) {
+		if r := s.replicas[(start+i)%uint64(len(s.replicas))]; r.healthy.Load() {
+			return r.conn
+		}
+	}
+	return s.db
+}
@@ -0,0 +1,121 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	sqldriver "database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestReader(t *testing.T) {
+	primary := &conn{}
+	replicas := []*replica{{conn: &conn{}, name: "a"}, {conn: &conn{}, name: "b"}}
+	s := &service{db: primary, replicas: replicas}
+	ctx := context.Background()
+
+	// Reads alternate between the healthy replicas
+	for _, r := range replicas {
+		r.healthy.Store(true)
+	}
+	seen := map[*conn]int{}
+	for range 4 {
+		seen[s.reader(ctx)]++
+	}
+	if seen[replicas[0].conn] != 2 || seen[replicas[1].conn] != 2 {
+		t.Errorf("expected reads spread over both replicas; got %d and %d", seen[replicas[0].conn], seen[replicas[1].conn])
+	}
+	if c := s.reader(WithPrimary(ctx)); c != primary {
+		t.Errorf("expected WithPrimary to read from the primary")
+	}
+
+	// An unhealthy replica is skipped
+	replicas[0].healthy.Store(false)
+	for range 4 {
+		if c := s.reader(ctx); c != replicas[1].conn {
+			t.Errorf("expected reads from the healthy replica")
+		}
+	}
+
+	// Without healthy replica, or any replica, reads go to the primary
+	replicas[1].healthy.Store(false)
+	if c := s.reader(ctx); c != primary {
+		t.Errorf("expected reads from the primary when every replica is unhealthy")
+	}
+	if c := (&service{db: primary}).reader(ctx); c != primary {
+		t.Errorf("expected reads from the primary without replicas")
+	}
+}
+
+// lagDriver is a PostgreSQL stand-in whose replication lag query returns
+// lag seconds, or fails with err.
+type lagDriver struct {
+	lag float64
+	err error
+}
+
+func (d *lagDriver) Open(string) (sqldriver.Conn, error) { return lagConn{d}, nil }
+
+type lagConn struct{ d *lagDriver }
+
+func (c lagConn) Prepare(string) (sqldriver.Stmt, error) { return nil, errors.New("not supported") }
+func (c lagConn) Close() error                           { return nil }
+func (c lagConn) Begin() (sqldriver.Tx, error)           { return nil, errors.New("not supported") }
+
+func (c lagConn) QueryContext(context.Context, string, []sqldriver.NamedValue) (sqldriver.Rows, error) {
+	if c.d.err != nil {
+		return nil, c.d.err
+	}
+	return &lagRows{lag: c.d.lag}, nil
+}
+
+type lagRows struct {
+	lag  float64
+	done bool
+}
+
+func (r *lagRows) Columns() []string { return []string{"lag"} }
+func (r *lagRows) Close() error      { return nil }
+func (r *lagRows) Next(dest []sqldriver.Value) error {
+	if r.done {
+		return io.EOF
+	}
+	r.done = true
+	dest[0] = r.lag
+	return nil
+}
+
+func TestCheckReplicas(t *testing.T) {
+	tests := []struct {
+		name        string
+		lag         float64
+		err         error
+		healthy     bool
+		wantHealthy bool
+	}{
+		{"within lag", 1, nil, false, true},
+		{"beyond lag", 10, nil, true, false},
+		{"failing", 0, sql.ErrConnDone, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name := fmt.Sprintf("lag%d", testDrivers.Add(1))
+			sql.Register(name, &lagDriver{lag: tt.lag, err: tt.err})
+			db, err := sql.Open(name, "")
+			if err != nil {
+				t.Fatalf("error opening database. Err: %v", err)
+			}
+			t.Cleanup(func() { db.Close() })
+			r := &replica{conn: &conn{DB: db, driver: DriverPostgres}, name: name}
+			r.healthy.Store(tt.healthy)
+
+			checkReplicas(context.Background(), []*replica{r}, 5*time.Second)
+			if r.healthy.Load() != tt.wantHealthy {
+				t.Errorf("expected healthy %t; got %t", tt.wantHealthy, r.healthy.Load())
+			}
+		})
+	}
+}
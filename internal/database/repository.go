@@ -0,0 +1,108 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// UserRepository queries and updates user accounts. Handlers needing only
+// users depend on it instead of Service, so tests can mock just these methods.
+type UserRepository interface {
+	// RegisterUser inserts a new user with an optional email into the users table
+	// and returns its id. It returns an error if a user cannot be inserted.
+	RegisterUser(context.Context, string, string, []byte) (string, error)
+
+	// VerifyCredentials checks a user exists in the users table with the
+	// username or email address, and retrieves its username and hashed password.
+	VerifyCredentials(context.Context, string) (string, []byte, error)
+
+	// CanonicalUsername returns a username as stored, matching it case-insensitively.
+	CanonicalUsername(ctx context.Context, username string) (string, error)
+
+	// UserExists reports whether a user exists in the users table.
+	UserExists(ctx context.Context, username string) (bool, error)
+
+	// SetPasswordHash replaces the password hash of a user, fulfilling any required password reset.
+	SetPasswordHash(ctx context.Context, username string, hash []byte) error
+
+	// UpdatePasswordHash replaces the password hash of a user if it still matches oldHash.
+	UpdatePasswordHash(ctx context.Context, username string, oldHash []byte, newHash []byte) error
+
+	// ProvisionUser inserts a user unless the username is already taken,
+	// e.g. for users signing in through an external identity provider.
+	ProvisionUser(context.Context, string, []byte) error
+
+	// FindUserByEmail returns the profile of the user with the given email.
+	FindUserByEmail(ctx context.Context, email string) (UserProfile, error)
+
+	// UserProfile returns the profile of a user.
+	UserProfile(ctx context.Context, username string) (UserProfile, error)
+
+	// UpdateUserProfile changes the non-nil fields of a user profile. Changing
+	// the email marks it as unverified.
+	UpdateUserProfile(ctx context.Context, username string, update ProfileUpdate) error
+
+	// UpdateEmail changes the email of a user and marks it as unverified if it changes.
+	UpdateEmail(ctx context.Context, username string, email string) error
+
+	// ListUsers returns a page of users matching the query, and the total number of matches.
+	ListUsers(ctx context.Context, query UserQuery) ([]UserSummary, int, error)
+
+	// AccountStatus returns the status of a user and whether it must change its password.
+	AccountStatus(ctx context.Context, username string) (AccountStatus, error)
+
+	// SetUserStatus activates, disables, or bans a user.
+	SetUserStatus(ctx context.Context, username string, status UserStatus) error
+
+	// RecordLogin sets the last login time of a user to now.
+	RecordLogin(ctx context.Context, username string) error
+
+	// RequirePasswordReset forces a user to change its password before using the account.
+	RequirePasswordReset(ctx context.Context, username string) error
+
+	// DeleteUser soft-deletes a user, hiding it from every user query until restored.
+	DeleteUser(ctx context.Context, username string) error
+
+	// RestoreUser reverts the soft deletion of a user.
+	RestoreUser(ctx context.Context, username string) error
+
+	// PurgeUser removes a user and, through foreign keys, its tokens, roles, and credentials.
+	PurgeUser(ctx context.Context, username string) error
+
+	// PurgeDeletedUsers removes the users soft-deleted before the given time.
+	PurgeDeletedUsers(ctx context.Context, before time.Time) (int64, error)
+}
+
+// NewUserRepository creates a UserRepository running queries on a shared
+// connection pool opened with the given driver.
+func NewUserRepository(db *sql.DB, driver string) UserRepository {
+	return &service{db: &conn{DB: db, driver: driver}}
+}
+
+// SessionRepository persists HTTP sessions, encoded by the session store, in
+// the sessions table.
+type SessionRepository interface {
+	// SaveSession inserts a session or replaces the stored one with the same id,
+	// returning ErrSessionConflict if it was saved since session.Version.
+	SaveSession(ctx context.Context, session StoredSession) error
+
+	// FindSession returns a stored session by id.
+	FindSession(ctx context.Context, id string) (StoredSession, error)
+
+	// FindUserSessions returns the stored sessions of a user.
+	FindUserSessions(ctx context.Context, username string) ([]StoredSession, error)
+
+	// DeleteSession removes a stored session. Deleting an unknown session is a no-op.
+	DeleteSession(ctx context.Context, id string) error
+
+	// DeleteExpiredSessions removes the sessions expired at now, and the
+	// sessions without a recorded expiry not active since inactiveSince.
+	DeleteExpiredSessions(ctx context.Context, now, inactiveSince time.Time) error
+}
+
+// NewSessionRepository creates a SessionRepository running queries on a
+// shared connection pool opened with the given driver.
+func NewSessionRepository(db *sql.DB, driver string) SessionRepository {
+	return &service{db: &conn{DB: db, driver: driver}}
+}
@@ -0,0 +1,53 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/raziel-aleman/go-starter/internal/database/dbutil"
+)
+
+// AssignRole grants a role to an existing user. Assigning a role twice is a no-op.
+// The foreign key constraint rejects unknown users.
+func (s *service) AssignRole(ctx context.Context, username string, role string) error {
+	_, err := s.db.ExecContext(ctx,
+		"INSERT INTO user_roles (username, role) VALUES (?, ?)"+s.db.ignoreConflict("role"),
+		username,
+		role,
+	)
+	return err
+}
+
+// RemoveRole revokes a role from a user.
+func (s *service) RemoveRole(ctx context.Context, username string, role string) error {
+	_, err := s.db.ExecContext(ctx,
+		"DELETE FROM user_roles WHERE username = ? AND role = ?",
+		username,
+		role,
+	)
+	return err
+}
+
+// UserRoles returns the roles of a user.
+func (s *service) UserRoles(ctx context.Context, username string) ([]string, error) {
+	return dbutil.QueryMany[string](ctx, s.db,
+		"SELECT role FROM user_roles WHERE username = ? ORDER BY role",
+		username,
+	)
+}
+
+// HasRole reports whether a user has been granted a role.
+func (s *service) HasRole(ctx context.Context, username string, role string) (bool, error) {
+	ctx, cancel := s.db.readContext(ctx)
+	defer cancel()
+	var one int
+	err := s.db.QueryRowContext(ctx,
+		"SELECT 1 FROM user_roles WHERE username = ? AND role = ?",
+		username,
+		role,
+	).Scan(&one)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return err == nil, err
+}
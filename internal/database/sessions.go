@@ -0,0 +1,144 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// ErrSessionConflict is returned when saving a session another request saved
+// since it was read.
+var ErrSessionConflict = errors.New("session modified concurrently")
+
+// StoredSession is a session as kept in the sessions table, its data encoded
+// by the session store.
+type StoredSession struct {
+	ID         string
+	CreatedAt  time.Time
+	LastActive time.Time
+	Data       []byte
+	Version    int64     // Incremented on every save, 0 for a session never saved
+	Username   string    // Owner of the session, empty for anonymous sessions
+	ExpiresAt  time.Time // Zero if unknown, the session then expires once inactive
+}
+
+// SaveSession inserts a session or replaces the data, owner, activity and
+// expiry times of the stored one with the same id, if it is still at the version the session was
+// read at. The stored version is then incremented. Saving a session stored
+// with another version returns ErrSessionConflict, so concurrent requests do
+// not silently overwrite each other's data.
+func (s *service) SaveSession(ctx context.Context, session StoredSession) error {
+	err := affectOne(ctx, s.db.prepared(),
+		"UPDATE sessions SET lastActive = ?, data = ?, username = ?, expires_at = ?, version = version + 1 WHERE sessionId = ? AND version = ?",
+		session.LastActive.UTC().Format(time.RFC3339),
+		session.Data,
+		session.Username,
+		sessionExpiry(session),
+		session.ID,
+		session.Version,
+	)
+	if !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	// Either the session is new, or the unique session id reveals another version
+	_, err = s.db.ExecContext(ctx,
+		"INSERT INTO sessions (tenant_id, sessionId, createdAt, lastActive, data, version, username, expires_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+		tenantOf(ctx),
+		session.ID,
+		session.CreatedAt.UTC().Format(time.RFC3339),
+		session.LastActive.UTC().Format(time.RFC3339),
+		session.Data,
+		session.Version+1,
+		session.Username,
+		sessionExpiry(session),
+	)
+	if isUniqueViolation(err) {
+		return ErrSessionConflict
+	}
+	return err
+}
+
+// sessionExpiry returns the expires_at column of a session, NULL if unknown.
+func sessionExpiry(session StoredSession) sql.NullString {
+	if session.ExpiresAt.IsZero() {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: session.ExpiresAt.UTC().Format(time.RFC3339), Valid: true}
+}
+
+// sessionColumns are the columns read by scanSession.
+const sessionColumns = "sessionId, createdAt, lastActive, data, version, username, expires_at"
+
+// scanSession reads a stored session selected with sessionColumns.
+func scanSession(row interface{ Scan(...any) error }) (StoredSession, error) {
+	var session StoredSession
+	var createdAt, lastActive string
+	var expiresAt sql.NullString
+	err := row.Scan(&session.ID, &createdAt, &lastActive, &session.Data, &session.Version, &session.Username, &expiresAt)
+	if err != nil {
+		return StoredSession{}, err
+	}
+
+	if session.CreatedAt, err = time.Parse(time.RFC3339, createdAt); err != nil {
+		return StoredSession{}, err
+	}
+	if session.LastActive, err = time.Parse(time.RFC3339, lastActive); err != nil {
+		return StoredSession{}, err
+	}
+	if expiry, err := parseNullTime(expiresAt); err != nil {
+		return StoredSession{}, err
+	} else if expiry != nil {
+		session.ExpiresAt = *expiry
+	}
+	return session, nil
+}
+
+// FindSession returns a stored session by id, or sql.ErrNoRows if unknown.
+func (s *service) FindSession(ctx context.Context, id string) (StoredSession, error) {
+	ctx, cancel := s.db.readContext(ctx)
+	defer cancel()
+	// Sessions of another tenant are unknown
+	query, args := andTenant(ctx, "SELECT "+sessionColumns+" FROM sessions WHERE sessionId = ?", id)
+	return scanSession(s.db.prepared().QueryRowContext(ctx, query, args...))
+}
+
+// FindUserSessions returns the stored sessions of a user.
+func (s *service) FindUserSessions(ctx context.Context, username string) ([]StoredSession, error) {
+	ctx, cancel := s.db.readContext(ctx)
+	defer cancel()
+	query, args := andTenant(ctx, "SELECT "+sessionColumns+" FROM sessions WHERE username = ?", username)
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []StoredSession
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, rows.Err()
+}
+
+// DeleteSession removes a stored session.
+func (s *service) DeleteSession(ctx context.Context, id string) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM sessions WHERE sessionId = ?", id)
+	return err
+}
+
+// DeleteExpiredSessions removes the sessions expired at now, and the sessions
+// without a recorded expiry not active since inactiveSince.
+func (s *service) DeleteExpiredSessions(ctx context.Context, now, inactiveSince time.Time) error {
+	_, err := s.db.ExecContext(ctx,
+		"DELETE FROM sessions WHERE expires_at < ? OR (expires_at IS NULL AND lastActive < ?)",
+		now.UTC().Format(time.RFC3339),
+		inactiveSince.UTC().Format(time.RFC3339),
+	)
+	return err
+}
@@ -0,0 +1,88 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"time"
+)
+
+// stmtCache holds the prepared statements of a connection pool by query.
+// database/sql prepares a statement again on each connection it runs on, so
+// hot queries are parsed once per connection instead of once per call.
+type stmtCache struct {
+	stmts sync.Map // Rebound query to *sql.Stmt
+}
+
+// prepare returns the cached statement of a query rebound for the driver,
+// preparing it on first use.
+func (c *conn) prepare(ctx context.Context, query string) (*sql.Stmt, error) {
+	query = rebind(c.driver, query)
+	if stmt, ok := c.cache.stmts.Load(query); ok {
+		return stmt.(*sql.Stmt), nil
+	}
+
+	stmt, err := c.DB.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	if cached, loaded := c.cache.stmts.LoadOrStore(query, stmt); loaded {
+		// Prepared concurrently by another caller
+		stmt.Close()
+		return cached.(*sql.Stmt), nil
+	}
+	return stmt, nil
+}
+
+// Close closes the cached statements, then the connection pool.
+func (c *conn) Close() error {
+	c.cache.stmts.Range(func(query, stmt any) bool {
+		stmt.(*sql.Stmt).Close()
+		c.cache.stmts.Delete(query)
+		return true
+	})
+	return c.DB.Close()
+}
+
+// prepared returns a queryer running its queries as cached prepared
+// statements, for the hot queries of logins and session reads.
+func (c *conn) prepared() queryer {
+	return preparedConn{c}
+}
+
+// preparedConn runs queries as cached prepared statements of a conn.
+type preparedConn struct {
+	c *conn
+}
+
+// ExecContext executes a statement, preparing it on first use.
+func (p preparedConn) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	stmt, err := p.c.prepare(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := p.c.writeContext(ctx)
+	defer cancel()
+	start := time.Now()
+	var result sql.Result
+	err = retryBusy(ctx, p.c.busy, func() (err error) {
+		result, err = stmt.ExecContext(ctx, args...)
+		return err
+	})
+	p.c.metrics.observe(query, start, err)
+	return result, err
+}
+
+// QueryRowContext runs a query returning at most one row, preparing it on
+// first use. A statement failing to prepare is run unprepared, so its error
+// is reported by Scan.
+func (p preparedConn) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	stmt, err := p.c.prepare(ctx, query)
+	if err != nil {
+		return p.c.QueryRowContext(ctx, query, args...)
+	}
+	start := time.Now()
+	row := stmt.QueryRowContext(ctx, args...)
+	p.c.metrics.observe(query, start, row.Err())
+	return row
+}
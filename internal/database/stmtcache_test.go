@@ -0,0 +1,137 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	sqldriver "database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+)
+
+// cacheLen returns the number of statements cached by a connection pool.
+func cacheLen(c *conn) int {
+	n := 0
+	c.cache.stmts.Range(func(any, any) bool {
+		n++
+		return true
+	})
+	return n
+}
+
+func TestPreparedReusesStatements(t *testing.T) {
+	s, _ := openTestDB(t)
+	ctx := context.Background()
+	if err := s.Migrate(ctx); err != nil {
+		t.Fatalf("error migrating. Err: %v", err)
+	}
+	if _, err := s.RegisterUser(ctx, "alice", "", []byte("hash")); err != nil {
+		t.Fatalf("error registering user. Err: %v", err)
+	}
+
+	query := "SELECT username FROM users WHERE username = ?"
+	first, err := s.db.prepare(ctx, query)
+	if err != nil {
+		t.Fatalf("error preparing statement. Err: %v", err)
+	}
+	for range 3 {
+		var username string
+		if err := s.db.prepared().QueryRowContext(ctx, query, "alice").Scan(&username); err != nil || username != "alice" {
+			t.Fatalf("expected alice; got %q, Err: %v", username, err)
+		}
+	}
+	second, err := s.db.prepare(ctx, query)
+	if err != nil {
+		t.Fatalf("error preparing statement. Err: %v", err)
+	}
+	if first != second || cacheLen(s.db) != 1 {
+		t.Errorf("expected one statement reused; got %d cached", cacheLen(s.db))
+	}
+}
+
+func TestPreparedTenantQueries(t *testing.T) {
+	s, _ := openTestDB(t)
+	ctx := context.Background()
+	if err := s.Migrate(ctx); err != nil {
+		t.Fatalf("error migrating. Err: %v", err)
+	}
+	if _, err := s.RegisterUser(WithTenant(ctx, "acme"), "alice", "", []byte("hash")); err != nil {
+		t.Fatalf("error registering user. Err: %v", err)
+	}
+
+	// The tenant condition and its argument are part of the statement, so
+	// queries with and without tenant are cached apart and see their rows
+	tests := []struct {
+		name    string
+		ctx     context.Context
+		wantErr error
+	}{
+		{"same tenant", WithTenant(ctx, "acme"), nil},
+		{"other tenant", WithTenant(ctx, "beta"), sql.ErrNoRows},
+		{"without tenant", ctx, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := s.AccountStatus(tt.ctx, "alice"); !errors.Is(err, tt.wantErr) {
+				t.Errorf("expected error %v; got %v", tt.wantErr, err)
+			}
+		})
+	}
+	if n := cacheLen(s.db); n != 2 {
+		t.Errorf("expected 2 statements cached; got %d", n)
+	}
+}
+
+// unpreparedDriver is a driver failing to prepare statements, which it only
+// runs directly, returning a row with a single "direct" column.
+type unpreparedDriver struct{}
+
+func (unpreparedDriver) Open(string) (sqldriver.Conn, error) { return unpreparedConn{}, nil }
+
+type unpreparedConn struct{}
+
+func (unpreparedConn) Prepare(string) (sqldriver.Stmt, error) {
+	return nil, errors.New("prepare not supported")
+}
+func (unpreparedConn) Close() error                 { return nil }
+func (unpreparedConn) Begin() (sqldriver.Tx, error) { return nil, errors.New("not supported") }
+
+func (unpreparedConn) QueryContext(context.Context, string, []sqldriver.NamedValue) (sqldriver.Rows, error) {
+	return &directRows{}, nil
+}
+
+type directRows struct{ done bool }
+
+func (r *directRows) Columns() []string { return []string{"value"} }
+func (r *directRows) Close() error      { return nil }
+func (r *directRows) Next(dest []sqldriver.Value) error {
+	if r.done {
+		return io.EOF
+	}
+	r.done = true
+	dest[0] = "direct"
+	return nil
+}
+
+func TestPreparedFallsBackToDirectQuery(t *testing.T) {
+	name := fmt.Sprintf("unprepared%d", testDrivers.Add(1))
+	sql.Register(name, unpreparedDriver{})
+	db, err := sql.Open(name, "")
+	if err != nil {
+		t.Fatalf("error opening database. Err: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	c := &conn{DB: db, driver: DriverSQLite}
+
+	var value string
+	if err := c.prepared().QueryRowContext(context.Background(), "SELECT value FROM items WHERE id = ?", 1).Scan(&value); err != nil {
+		t.Fatalf("error querying. Err: %v", err)
+	}
+	if value != "direct" {
+		t.Errorf("expected the query to run directly; got %q", value)
+	}
+	if n := cacheLen(c); n != 0 {
+		t.Errorf("expected no statement cached; got %d", n)
+	}
+}
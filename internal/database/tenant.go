@@ -0,0 +1,36 @@
+package database
+
+import "context"
+
+// tenantKey is the context key of WithTenant.
+type tenantKey struct{}
+
+// WithTenant returns a context whose queries only see the users and sessions
+// of a tenant, and create them in it. The empty tenant is the default one of
+// users created without tenant.
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenant)
+}
+
+// TenantFromContext returns the tenant of a context, and false if queries
+// run with it are not scoped, like those of background jobs.
+func TenantFromContext(ctx context.Context) (string, bool) {
+	tenant, ok := ctx.Value(tenantKey{}).(string)
+	return tenant, ok
+}
+
+// andTenant appends the tenant condition of ctx to a query ending with a
+// WHERE clause, so the queries on users and sessions run with a tenant only
+// see the rows of the tenant. Queries without tenant are returned unchanged.
+func andTenant(ctx context.Context, query string, args ...any) (string, []any) {
+	if tenant, ok := TenantFromContext(ctx); ok {
+		return query + " AND tenant_id = ?", append(args, tenant)
+	}
+	return query, args
+}
+
+// tenantOf returns the tenant new rows are created in.
+func tenantOf(ctx context.Context) string {
+	tenant, _ := TenantFromContext(ctx)
+	return tenant
+}
@@ -0,0 +1,118 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestAndTenant(t *testing.T) {
+	tests := []struct {
+		name      string
+		ctx       context.Context
+		wantQuery string
+		wantArgs  []any
+	}{
+		{
+			name:      "without tenant",
+			ctx:       context.Background(),
+			wantQuery: "SELECT id FROM users WHERE username = ? AND deleted_at IS NULL",
+			wantArgs:  []any{"alice"},
+		},
+		{
+			name:      "with tenant",
+			ctx:       WithTenant(context.Background(), "acme"),
+			wantQuery: "SELECT id FROM users WHERE username = ? AND deleted_at IS NULL AND tenant_id = ?",
+			wantArgs:  []any{"alice", "acme"},
+		},
+		{
+			name:      "default tenant",
+			ctx:       WithTenant(context.Background(), ""),
+			wantQuery: "SELECT id FROM users WHERE username = ? AND deleted_at IS NULL AND tenant_id = ?",
+			wantArgs:  []any{"alice", ""},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, args := andTenant(tt.ctx, "SELECT id FROM users WHERE username = ? AND deleted_at IS NULL", "alice")
+			if query != tt.wantQuery {
+				t.Errorf("expected query %q; got %q", tt.wantQuery, query)
+			}
+			if !reflect.DeepEqual(args, tt.wantArgs) {
+				t.Errorf("expected arguments %v; got %v", tt.wantArgs, args)
+			}
+		})
+	}
+}
+
+func TestUserQueriesAreScopedToTenant(t *testing.T) {
+	s, _ := openTestDB(t)
+	ctx := context.Background()
+	if err := s.Migrate(ctx); err != nil {
+		t.Fatalf("error migrating. Err: %v", err)
+	}
+	acme, beta := WithTenant(ctx, "acme"), WithTenant(ctx, "beta")
+	if _, err := s.RegisterUser(acme, "alice", "alice@example.com", []byte("hash")); err != nil {
+		t.Fatalf("error registering user. Err: %v", err)
+	}
+
+	// Every lookup finds alice in its tenant and without tenant, not in another
+	lookups := map[string]func(ctx context.Context) error{
+		"VerifyCredentials": func(ctx context.Context) error {
+			_, _, err := s.VerifyCredentials(ctx, "alice@example.com")
+			return err
+		},
+		"CanonicalUsername": func(ctx context.Context) error {
+			_, err := s.CanonicalUsername(ctx, "ALICE")
+			return err
+		},
+		"UserExists": func(ctx context.Context) error {
+			if exists, err := s.UserExists(ctx, "alice"); err != nil || !exists {
+				return sql.ErrNoRows
+			}
+			return nil
+		},
+		"FindUserByEmail": func(ctx context.Context) error {
+			_, err := s.FindUserByEmail(ctx, "alice@example.com")
+			return err
+		},
+		"AccountStatus": func(ctx context.Context) error {
+			_, err := s.AccountStatus(ctx, "alice")
+			return err
+		},
+		"RecordLogin": func(ctx context.Context) error {
+			return s.RecordLogin(ctx, "alice")
+		},
+		"ListUsers": func(ctx context.Context) error {
+			if _, total, err := s.ListUsers(ctx, UserQuery{}); err != nil || total != 1 {
+				return sql.ErrNoRows
+			}
+			return nil
+		},
+	}
+	for name, lookup := range lookups {
+		t.Run(name, func(t *testing.T) {
+			if err := lookup(acme); err != nil {
+				t.Errorf("expected alice in its tenant; got %v", err)
+			}
+			if err := lookup(ctx); err != nil {
+				t.Errorf("expected alice without tenant; got %v", err)
+			}
+			if err := lookup(beta); !errors.Is(err, sql.ErrNoRows) {
+				t.Errorf("expected sql.ErrNoRows in another tenant; got %v", err)
+			}
+		})
+	}
+
+	if err := s.DeleteUser(beta, "alice"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected alice not to be deleted from another tenant; got %v", err)
+	}
+	if err := s.DeleteUser(acme, "alice"); err != nil {
+		t.Fatalf("error deleting user. Err: %v", err)
+	}
+	if err := s.RestoreUser(beta, "alice"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected alice not to be restored from another tenant; got %v", err)
+	}
+}
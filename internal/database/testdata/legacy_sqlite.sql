@@ -0,0 +1,148 @@
+-- Schema created by Init before versioned migrations were introduced
+CREATE TABLE users (
+	id INTEGER NOT NULL PRIMARY KEY,
+	username TEXT NOT NULL UNIQUE COLLATE NOCASE,
+	password BLOB NOT NULL,
+	email TEXT,
+	verified_at TEXT,
+	totp_secret TEXT,
+	totp_enabled_at TEXT,
+	display_name TEXT,
+	avatar_url TEXT,
+	disabled_at TEXT,
+	password_reset_required INTEGER NOT NULL DEFAULT 0,
+	status TEXT NOT NULL DEFAULT 'active',
+	password_changed_at TEXT
+);
+
+CREATE UNIQUE INDEX users_username_nocase ON users (username COLLATE NOCASE);
+
+CREATE INDEX users_email ON users (email);
+
+CREATE TABLE email_verifications (
+	token_hash TEXT NOT NULL PRIMARY KEY,
+	username TEXT NOT NULL REFERENCES users (username) ON DELETE CASCADE,
+	expires_at TEXT NOT NULL
+);
+
+CREATE TABLE recovery_codes (
+	username TEXT NOT NULL REFERENCES users (username) ON DELETE CASCADE,
+	code_hash TEXT NOT NULL,
+	PRIMARY KEY (username, code_hash)
+);
+
+CREATE TABLE user_roles (
+	username TEXT NOT NULL REFERENCES users (username) ON DELETE CASCADE,
+	role TEXT NOT NULL,
+	PRIMARY KEY (username, role)
+);
+
+CREATE TABLE role_permissions (
+	role TEXT NOT NULL,
+	action TEXT NOT NULL,
+	resource TEXT NOT NULL,
+	PRIMARY KEY (role, action, resource)
+);
+
+INSERT INTO role_permissions (role, action, resource) VALUES ('admin', '*', '*');
+
+CREATE TABLE api_keys (
+	id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+	username TEXT NOT NULL REFERENCES users (username) ON DELETE CASCADE,
+	name TEXT NOT NULL,
+	prefix TEXT NOT NULL,
+	key_hash TEXT NOT NULL UNIQUE,
+	created_at TEXT NOT NULL,
+	last_used_at TEXT,
+	revoked_at TEXT,
+	scopes TEXT NOT NULL DEFAULT ''
+);
+
+CREATE TABLE magic_links (
+	token_hash TEXT NOT NULL PRIMARY KEY,
+	username TEXT NOT NULL REFERENCES users (username) ON DELETE CASCADE,
+	created_at TEXT NOT NULL,
+	expires_at TEXT NOT NULL
+);
+
+CREATE TABLE refresh_tokens (
+	token_hash TEXT NOT NULL PRIMARY KEY,
+	username TEXT NOT NULL REFERENCES users (username) ON DELETE CASCADE,
+	family TEXT NOT NULL,
+	expires_at TEXT NOT NULL,
+	used_at TEXT,
+	scopes TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX refresh_tokens_family ON refresh_tokens (family);
+
+CREATE TABLE invitations (
+	code_hash TEXT NOT NULL PRIMARY KEY,
+	created_by TEXT NOT NULL,
+	max_uses INTEGER NOT NULL,
+	uses INTEGER NOT NULL DEFAULT 0,
+	created_at TEXT NOT NULL,
+	expires_at TEXT NOT NULL
+);
+
+CREATE TABLE oauth_clients (
+	id TEXT NOT NULL PRIMARY KEY,
+	name TEXT NOT NULL,
+	secret_hash TEXT,
+	redirect_uris TEXT NOT NULL,
+	scopes TEXT NOT NULL,
+	created_by TEXT NOT NULL,
+	created_at TEXT NOT NULL
+);
+
+CREATE TABLE oauth_codes (
+	code_hash TEXT NOT NULL PRIMARY KEY,
+	client_id TEXT NOT NULL REFERENCES oauth_clients (id) ON DELETE CASCADE,
+	username TEXT NOT NULL REFERENCES users (username) ON DELETE CASCADE,
+	redirect_uri TEXT NOT NULL,
+	scopes TEXT NOT NULL,
+	code_challenge TEXT NOT NULL,
+	expires_at TEXT NOT NULL
+);
+
+CREATE TABLE auth_events (
+	id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+	type TEXT NOT NULL,
+	username TEXT NOT NULL,
+	ip TEXT NOT NULL,
+	user_agent TEXT NOT NULL,
+	detail TEXT NOT NULL,
+	created_at TEXT NOT NULL
+);
+
+CREATE INDEX auth_events_username ON auth_events (username, id);
+
+CREATE TABLE identities (
+	provider TEXT NOT NULL,
+	subject TEXT NOT NULL,
+	username TEXT NOT NULL REFERENCES users (username) ON DELETE CASCADE,
+	email TEXT,
+	created_at TEXT NOT NULL,
+	PRIMARY KEY (provider, subject),
+	UNIQUE (username, provider)
+);
+
+CREATE TABLE webauthn_credentials (
+	id BLOB NOT NULL PRIMARY KEY,
+	username TEXT NOT NULL REFERENCES users (username) ON DELETE CASCADE,
+	public_key BLOB NOT NULL,
+	sign_count INTEGER NOT NULL DEFAULT 0,
+	created_at TEXT NOT NULL
+);
+
+CREATE TABLE sessions (
+	id INTEGER NOT NULL PRIMARY KEY,
+	sessionId TEXT NOT NULL,
+	createdAt TEXT NOT NULL,
+	lastActive TEXT NOT NULL,
+	data BLOB NOT NULL
+);
+
+INSERT INTO users (username, password, email, disabled_at, password_changed_at) VALUES ('alice', 'hash', 'alice@example.com', NULL, '2024-01-01T00:00:00Z');
+INSERT INTO users (username, password, email, disabled_at, password_changed_at) VALUES ('bob', 'hash', NULL, '2024-01-01T00:00:00Z', '2024-01-01T00:00:00Z');
+INSERT INTO user_roles (username, role) VALUES ('alice', 'admin');
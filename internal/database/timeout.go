@@ -0,0 +1,53 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+)
+
+// timeoutConfig bounds the duration of statements, so a stuck query fails
+// instead of holding its handler until the server write timeout.
+type timeoutConfig struct {
+	Read  time.Duration // Of queries, zero for none
+	Write time.Duration // Of statements and transactions, zero for none
+}
+
+// timeoutConfigFromEnv reads BLUEPRINT_DB_READ_TIMEOUT (default 5s) and
+// BLUEPRINT_DB_WRITE_TIMEOUT (default 10s), 0 to disable either. A context
+// with an earlier deadline keeps it.
+func timeoutConfigFromEnv() (timeoutConfig, error) {
+	config := timeoutConfig{Read: 5 * time.Second, Write: 10 * time.Second}
+	for name, field := range map[string]*time.Duration{
+		"BLUEPRINT_DB_READ_TIMEOUT":  &config.Read,
+		"BLUEPRINT_DB_WRITE_TIMEOUT": &config.Write,
+	} {
+		if value := os.Getenv(name); value != "" {
+			d, err := time.ParseDuration(value)
+			if err != nil || d < 0 {
+				return config, fmt.Errorf("invalid %s %q", name, value)
+			}
+			*field = d
+		}
+	}
+	return config, nil
+}
+
+// readContext bounds the queries of a repository method by the read timeout.
+// Rows are scanned after a query returns, so the methods scanning them apply
+// it and cancel it once done.
+func (c *conn) readContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if c.timeouts.Read <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, c.timeouts.Read)
+}
+
+// writeContext bounds a statement or a transaction by the write timeout.
+func (c *conn) writeContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if c.timeouts.Write <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, c.timeouts.Write)
+}
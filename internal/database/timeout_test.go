@@ -0,0 +1,29 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestReadTimeout(t *testing.T) {
+	s, _ := openTestDB(t)
+	ctx := context.Background()
+	if err := s.Migrate(ctx); err != nil {
+		t.Fatalf("error migrating. Err: %v", err)
+	}
+	if _, err := s.RegisterUser(ctx, "alice", "", []byte("hash")); err != nil {
+		t.Fatalf("error registering user. Err: %v", err)
+	}
+
+	s.db.timeouts.Read = time.Minute
+	if _, err := s.CanonicalUsername(ctx, "ALICE"); err != nil {
+		t.Errorf("expected the user within the read timeout; got %v", err)
+	}
+
+	s.db.timeouts.Read = time.Nanosecond
+	if _, err := s.CanonicalUsername(ctx, "ALICE"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected context.DeadlineExceeded after the read timeout; got %v", err)
+	}
+}
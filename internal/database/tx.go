@@ -0,0 +1,58 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// Ensure the transactions of WithTx satisfy the Tx interface.
+var _ Tx = (*tx)(nil)
+
+// Tx is a transaction run by WithTx, for application queries that must be
+// atomic with each other. Queries are written with ? placeholders, which are
+// rewritten for the driver.
+type Tx interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// WithTx runs fn in a transaction, committed if fn returns nil and rolled back
+// if it returns an error or panics. A panic is propagated after the rollback.
+// A transaction failing on a locked SQLite database is retried from the
+// start, so fn may run more than once. The attempts are bounded by the write
+// timeout.
+func (s *service) WithTx(ctx context.Context, fn func(tx Tx) error) error {
+	return s.withTx(ctx, func(t *tx) error { return fn(t) })
+}
+
+// withTx runs fn in a transaction like WithTx, exposing the methods of the
+// package transactions.
+func (s *service) withTx(ctx context.Context, fn func(t *tx) error) error {
+	ctx, cancel := s.db.writeContext(ctx)
+	defer cancel()
+	return retryBusy(ctx, s.db.busy, func() error { return s.runTx(ctx, fn) })
+}
+
+// runTx runs fn in a transaction once.
+func (s *service) runTx(ctx context.Context, fn func(t *tx) error) (err error) {
+	t, err := s.db.BeginTx(ctx)
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			t.Rollback()
+			panic(p)
+		}
+		if err != nil {
+			t.Rollback()
+		}
+	}()
+
+	if err = fn(t); err != nil {
+		return err
+	}
+	return t.Commit()
+}
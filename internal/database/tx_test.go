@@ -0,0 +1,69 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestWithTx(t *testing.T) {
+	errFailed := errors.New("failed")
+
+	tests := []struct {
+		name  string
+		fn    func(tx Tx) error
+		err   error
+		panic any
+		rows  int
+	}{
+		{
+			name: "commit",
+			fn:   func(tx Tx) error { return nil },
+			rows: 1,
+		},
+		{
+			name: "rollback on error",
+			fn:   func(tx Tx) error { return errFailed },
+			err:  errFailed,
+		},
+		{
+			name:  "rollback on panic",
+			fn:    func(tx Tx) error { panic("boom") },
+			panic: "boom",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			s, db := openTestDB(t)
+			if _, err := db.Exec("CREATE TABLE items (name TEXT NOT NULL)"); err != nil {
+				t.Fatalf("error creating table. Err: %v", err)
+			}
+
+			var recovered any
+			err := func() error {
+				defer func() { recovered = recover() }()
+				return s.WithTx(ctx, func(tx Tx) error {
+					if _, err := tx.ExecContext(ctx, "INSERT INTO items (name) VALUES (?)", "first"); err != nil {
+						t.Fatalf("error inserting row. Err: %v", err)
+					}
+					return tt.fn(tx)
+				})
+			}()
+
+			if !errors.Is(err, tt.err) {
+				t.Errorf("expected error %v; got %v", tt.err, err)
+			}
+			if recovered != tt.panic {
+				t.Errorf("expected panic %v; got %v", tt.panic, recovered)
+			}
+			var rows int
+			if err := db.QueryRow("SELECT COUNT(*) FROM items").Scan(&rows); err != nil {
+				t.Fatalf("error counting rows. Err: %v", err)
+			}
+			if rows != tt.rows {
+				t.Errorf("expected %d rows; got %d", tt.rows, rows)
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package database
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// Types of user ids, selected with BLUEPRINT_DB_ID_TYPE.
+const (
+	IDInteger = "integer" // Autoincremented integers
+	IDUUID    = "uuid"    // UUIDv7 text, which does not reveal the number of users
+)
+
+// uuidClock remembers the last timestamp and counter of NewUUIDv7.
+var uuidClock struct {
+	sync.Mutex
+	millis  int64
+	counter uint16
+}
+
+// NewUUIDv7 returns a version 7 UUID (RFC 9562), a Unix millisecond timestamp
+// followed by random bits. UUIDs generated by the process are strictly
+// increasing, the 12 bits after the timestamp counting the UUIDs of the same
+// millisecond, so new rows are appended to the end of an index on them.
+func NewUUIDv7() string {
+	var b [16]byte
+	rand.Read(b[:])
+
+	uuidClock.Lock()
+	millis := time.Now().UnixMilli()
+	if millis <= uuidClock.millis {
+		// Same millisecond or clock moved back: count from the last UUID,
+		// borrowing the next millisecond when the counter is exhausted
+		millis = uuidClock.millis
+		uuidClock.counter++
+		if uuidClock.counter > 0xfff {
+			millis++
+			uuidClock.counter = 0
+		}
+	} else {
+		// Random start, leaving room to count up
+		uuidClock.counter = binary.BigEndian.Uint16(b[6:8]) & 0x7ff
+	}
+	uuidClock.millis = millis
+	counter := uuidClock.counter
+	uuidClock.Unlock()
+
+	binary.BigEndian.PutUint64(b[0:8], uint64(millis)<<16)
+	binary.BigEndian.PutUint16(b[6:8], 0x7000|counter)
+	b[8] = b[8]&0x3f | 0x80
+
+	var s [36]byte
+	hex.Encode(s[0:8], b[0:4])
+	s[8] = '-'
+	hex.Encode(s[9:13], b[4:6])
+	s[13] = '-'
+	hex.Encode(s[14:18], b[6:8])
+	s[18] = '-'
+	hex.Encode(s[19:23], b[8:10])
+	s[23] = '-'
+	hex.Encode(s[24:], b[10:])
+	return string(s[:])
+}
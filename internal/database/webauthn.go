@@ -0,0 +1,68 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/raziel-aleman/go-starter/internal/database/queries"
+)
+
+// WebAuthnCredential is a passkey registered by a user.
+type WebAuthnCredential struct {
+	ID        []byte
+	Username  string
+	PublicKey []byte // COSE encoded public key
+	SignCount uint32
+}
+
+// AddWebAuthnCredential stores a passkey registered by a user.
+func (s *service) AddWebAuthnCredential(ctx context.Context, credential WebAuthnCredential) error {
+	return queries.New(s.db).CreateWebAuthnCredential(ctx, queries.CreateWebAuthnCredentialParams{
+		ID:        credential.ID,
+		Username:  credential.Username,
+		PublicKey: credential.PublicKey,
+		SignCount: int64(credential.SignCount),
+		CreatedAt: time.Now().UTC().Format(time.RFC3339),
+	})
+}
+
+// WebAuthnCredentials returns the passkeys of a user.
+func (s *service) WebAuthnCredentials(ctx context.Context, username string) ([]WebAuthnCredential, error) {
+	ctx, cancel := s.db.readContext(ctx)
+	defer cancel()
+	rows, err := queries.New(s.db).ListWebAuthnCredentials(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+	credentials := make([]WebAuthnCredential, len(rows))
+	for i, row := range rows {
+		credentials[i] = webAuthnCredential(queries.FindWebAuthnCredentialRow(row))
+	}
+	return credentials, nil
+}
+
+// FindWebAuthnCredential returns a passkey by credential id.
+func (s *service) FindWebAuthnCredential(ctx context.Context, id []byte) (WebAuthnCredential, error) {
+	ctx, cancel := s.db.readContext(ctx)
+	defer cancel()
+	row, err := queries.New(s.db).FindWebAuthnCredential(ctx, id)
+	return webAuthnCredential(row), err
+}
+
+// webAuthnCredential converts a selected passkey row.
+func webAuthnCredential(row queries.FindWebAuthnCredentialRow) WebAuthnCredential {
+	return WebAuthnCredential{
+		ID:        row.ID,
+		Username:  row.Username,
+		PublicKey: row.PublicKey,
+		SignCount: uint32(row.SignCount),
+	}
+}
+
+// UpdateWebAuthnSignCount records the signature counter of a passkey after a login.
+func (s *service) UpdateWebAuthnSignCount(ctx context.Context, id []byte, signCount uint32) error {
+	return queries.New(s.db).UpdateWebAuthnSignCount(ctx, queries.UpdateWebAuthnSignCountParams{
+		SignCount: int64(signCount),
+		ID:        id,
+	})
+}
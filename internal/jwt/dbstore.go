@@ -0,0 +1,64 @@
+package jwt
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/raziel-aleman/go-starter/internal/database"
+)
+
+// Ensure DatabaseRefreshStore satisfies the RefreshStore interface.
+var _ RefreshStore = (*DatabaseRefreshStore)(nil)
+
+// DatabaseRefreshStore keeps refresh tokens in the database, so they survive
+// restarts. Subjects must be usernames of registered users.
+type DatabaseRefreshStore struct {
+	db database.Service
+}
+
+// NewDatabaseRefreshStore creates a new DatabaseRefreshStore.
+func NewDatabaseRefreshStore(db database.Service) *DatabaseRefreshStore {
+	return &DatabaseRefreshStore{db: db}
+}
+
+// Save records a refresh token digest.
+func (s *DatabaseRefreshStore) Save(ctx context.Context, hash string, token RefreshToken) error {
+	return s.db.SaveRefreshToken(ctx, hash, database.RefreshToken{
+		Username:  token.Subject,
+		Family:    token.Family,
+		Scopes:    token.Scopes,
+		ClientID:  token.ClientID,
+		ExpiresAt: token.ExpiresAt,
+	})
+}
+
+// Use marks a refresh token digest as used and returns the token as it was before.
+func (s *DatabaseRefreshStore) Use(ctx context.Context, hash string) (RefreshToken, error) {
+	return fromDatabase(s.db.UseRefreshToken(ctx, hash))
+}
+
+// Find returns a refresh token by digest.
+func (s *DatabaseRefreshStore) Find(ctx context.Context, hash string) (RefreshToken, error) {
+	return fromDatabase(s.db.FindRefreshToken(ctx, hash))
+}
+
+// RevokeFamily removes every refresh token of a family.
+func (s *DatabaseRefreshStore) RevokeFamily(ctx context.Context, family string) error {
+	return s.db.RevokeRefreshTokenFamily(ctx, family)
+}
+
+// fromDatabase converts a stored token, mapping unknown tokens to ErrInvalidRefreshToken.
+func fromDatabase(token database.RefreshToken, err error) (RefreshToken, error) {
+	if errors.Is(err, sql.ErrNoRows) {
+		return RefreshToken{}, ErrInvalidRefreshToken
+	}
+	return RefreshToken{
+		Subject:   token.Username,
+		Family:    token.Family,
+		Scopes:    token.Scopes,
+		ClientID:  token.ClientID,
+		ExpiresAt: token.ExpiresAt,
+		Used:      token.Used,
+	}, err
+}
@@ -0,0 +1,117 @@
+package jwt
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSignAndParse(t *testing.T) {
+	secret := []byte("secret")
+	token, err := Sign(Claims{Subject: "user123", ExpiresAt: time.Now().Add(time.Minute).Unix()}, secret)
+	if err != nil {
+		t.Fatalf("error signing token. Err: %v", err)
+	}
+
+	claims, err := Parse(token, secret)
+	if err != nil {
+		t.Fatalf("error parsing token. Err: %v", err)
+	}
+	if claims.Subject != "user123" {
+		t.Errorf("expected subject user123; got %s", claims.Subject)
+	}
+
+	if _, err := Parse(token, []byte("other")); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("expected ErrInvalidToken for a wrong secret; got %v", err)
+	}
+
+	expired, _ := Sign(Claims{Subject: "user123", ExpiresAt: time.Now().Add(-time.Minute).Unix()}, secret)
+	if _, err := Parse(expired, secret); !errors.Is(err, ErrExpiredToken) {
+		t.Errorf("expected ErrExpiredToken; got %v", err)
+	}
+}
+
+func TestRefreshRotation(t *testing.T) {
+	ctx := context.Background()
+	m := NewManager([]byte("secret"), time.Minute, time.Hour, NewInMemoryRefreshStore())
+
+	pair, err := m.Issue(ctx, "user123")
+	if err != nil {
+		t.Fatalf("error issuing tokens. Err: %v", err)
+	}
+	if _, err := m.Verify(pair.AccessToken); err != nil {
+		t.Errorf("expected access token to be valid; got %v", err)
+	}
+
+	rotated, err := m.Refresh(ctx, pair.RefreshToken)
+	if err != nil {
+		t.Fatalf("error refreshing tokens. Err: %v", err)
+	}
+	if rotated.RefreshToken == pair.RefreshToken {
+		t.Errorf("expected a new refresh token")
+	}
+	if _, err := m.Refresh(ctx, pair.RefreshToken); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("expected used refresh token to be rejected; got %v", err)
+	}
+}
+
+func TestRefreshReuseRevokesFamily(t *testing.T) {
+	ctx := context.Background()
+	m := NewManager([]byte("secret"), time.Minute, time.Hour, NewInMemoryRefreshStore())
+
+	pair, err := m.Issue(ctx, "user123")
+	if err != nil {
+		t.Fatalf("error issuing tokens. Err: %v", err)
+	}
+	other, err := m.Issue(ctx, "user123")
+	if err != nil {
+		t.Fatalf("error issuing tokens. Err: %v", err)
+	}
+	rotated, err := m.Refresh(ctx, pair.RefreshToken)
+	if err != nil {
+		t.Fatalf("error refreshing tokens. Err: %v", err)
+	}
+
+	// A stolen token is replayed after the legitimate client rotated it
+	if _, err := m.Refresh(ctx, pair.RefreshToken); !errors.Is(err, ErrRefreshTokenReused) {
+		t.Fatalf("expected ErrRefreshTokenReused; got %v", err)
+	}
+	if _, err := m.Refresh(ctx, rotated.RefreshToken); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("expected rotated token to be revoked with its family; got %v", err)
+	}
+	if _, err := m.Refresh(ctx, other.RefreshToken); err != nil {
+		t.Errorf("expected token of another family to remain valid; got %v", err)
+	}
+}
+
+func TestRefreshAuthorize(t *testing.T) {
+	ctx := context.Background()
+	m := NewManager([]byte("secret"), time.Minute, time.Hour, NewInMemoryRefreshStore())
+	disabled := errors.New("account disabled")
+	m.Authorize = func(_ context.Context, subject string) error {
+		if subject == "mallory" {
+			return disabled
+		}
+		return nil
+	}
+
+	pair, err := m.Issue(ctx, "mallory")
+	if err != nil {
+		t.Fatalf("error issuing tokens. Err: %v", err)
+	}
+	if _, err := m.Refresh(ctx, pair.RefreshToken); !errors.Is(err, ErrInvalidRefreshToken) || !errors.Is(err, disabled) {
+		t.Errorf("expected the subject to be rejected; got %v", err)
+	}
+	if _, err := m.Store.Find(ctx, hashToken(pair.RefreshToken)); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("expected the family to be revoked; got %v", err)
+	}
+
+	pair, err = m.Issue(ctx, "alice")
+	if err != nil {
+		t.Fatalf("error issuing tokens. Err: %v", err)
+	}
+	if _, err := m.Refresh(ctx, pair.RefreshToken); err != nil {
+		t.Errorf("expected the subject to be authorized; got %v", err)
+	}
+}
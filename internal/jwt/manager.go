@@ -0,0 +1,211 @@
+package jwt
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrInvalidRefreshToken is returned when a refresh token is unknown, already used, or expired.
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	// ErrRefreshTokenReused is returned when an already used refresh token is
+	// presented again. The token may have been stolen, so its whole family is revoked.
+	ErrRefreshTokenReused = fmt.Errorf("%w: token reused, family revoked", ErrInvalidRefreshToken)
+)
+
+// TokenPair is returned to clients on login and on refresh.
+type TokenPair struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`      // Access token lifetime in seconds
+	Scope        string `json:"scope,omitempty"` // Granted scopes, if restricted
+}
+
+// Manager issues short-lived access tokens and single-use refresh tokens.
+// Refresh tokens rotate within a family: presenting a used token revokes
+// every token of its family.
+type Manager struct {
+	secret []byte
+	Issuer string
+	// Audience of the access tokens. Managers sharing a secret only accept
+	// the tokens of their own audience, e.g. first-party and OAuth tokens.
+	Audience   string
+	AccessTTL  time.Duration
+	RefreshTTL time.Duration
+	Store      RefreshStore
+	// Authorize, if set, is called on refresh and rejects the subjects it
+	// returns an error for, e.g. disabled users, revoking their token family.
+	Authorize func(ctx context.Context, subject string) error
+}
+
+// NewManager creates a new Manager signing access tokens with secret.
+func NewManager(
+	secret []byte,
+	accessTTL,
+	refreshTTL time.Duration,
+	store RefreshStore) *Manager {
+	return &Manager{
+		secret:     secret,
+		AccessTTL:  accessTTL,
+		RefreshTTL: refreshTTL,
+		Store:      store,
+	}
+}
+
+// Issue creates a new access and refresh token pair for the subject, typically
+// on login, restricted to the scopes if any. The refresh token starts a new family.
+func (m *Manager) Issue(ctx context.Context, subject string, scopes ...string) (*TokenPair, error) {
+	return m.IssueClient(ctx, "", subject, scopes...)
+}
+
+// IssueClient is like Issue for tokens issued to an OAuth client, which carry
+// its id. Their refresh tokens can only be redeemed by the same client.
+func (m *Manager) IssueClient(ctx context.Context, clientID, subject string, scopes ...string) (*TokenPair, error) {
+	family, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+	return m.issue(ctx, RefreshToken{Subject: subject, Family: family, Scopes: scopes, ClientID: clientID})
+}
+
+// issue creates a token pair whose refresh token belongs to the family of parent.
+func (m *Manager) issue(ctx context.Context, parent RefreshToken) (*TokenPair, error) {
+	subject, scopes := parent.Subject, parent.Scopes
+	now := time.Now()
+	id, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+	access, err := Sign(Claims{
+		Subject:   subject,
+		Issuer:    m.Issuer,
+		Audience:  m.Audience,
+		ClientID:  parent.ClientID,
+		ID:        id,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(m.AccessTTL).Unix(),
+		Scope:     strings.Join(scopes, " "),
+	}, m.secret)
+	if err != nil {
+		return nil, err
+	}
+
+	refresh, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+	token := RefreshToken{
+		Subject:   subject,
+		Family:    parent.Family,
+		Scopes:    scopes,
+		ClientID:  parent.ClientID,
+		ExpiresAt: now.Add(m.RefreshTTL),
+	}
+	if err := m.Store.Save(ctx, hashToken(refresh), token); err != nil {
+		return nil, fmt.Errorf("error saving refresh token: %w", err)
+	}
+
+	return &TokenPair{
+		AccessToken:  access,
+		RefreshToken: refresh,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(m.AccessTTL.Seconds()),
+		Scope:        strings.Join(scopes, " "),
+	}, nil
+}
+
+// Refresh consumes a first-party refresh token and issues a new pair in the
+// same family, so every refresh token can only be used once. Reusing a token
+// revokes its family and returns ErrRefreshTokenReused. Subjects rejected by
+// Authorize get ErrInvalidRefreshToken.
+func (m *Manager) Refresh(ctx context.Context, refreshToken string) (*TokenPair, error) {
+	return m.RefreshClient(ctx, "", refreshToken)
+}
+
+// RefreshClient is like Refresh for the refresh tokens issued to an OAuth
+// client. Tokens issued to another client, or first-party tokens, get
+// ErrInvalidRefreshToken and stay usable by their owner.
+func (m *Manager) RefreshClient(ctx context.Context, clientID, refreshToken string) (*TokenPair, error) {
+	hash := hashToken(refreshToken)
+	// Checked before use, so a token presented by another client is not burnt
+	owned, err := m.Store.Find(ctx, hash)
+	if err != nil {
+		return nil, err
+	}
+	if owned.ClientID != clientID {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	token, err := m.Store.Use(ctx, hash)
+	if err != nil {
+		return nil, err
+	}
+	if token.Used {
+		if err := m.Store.RevokeFamily(ctx, token.Family); err != nil {
+			return nil, fmt.Errorf("error revoking refresh token family: %w", err)
+		}
+		return nil, ErrRefreshTokenReused
+	}
+	if time.Now().After(token.ExpiresAt) {
+		return nil, ErrInvalidRefreshToken
+	}
+	if m.Authorize != nil {
+		if err := m.Authorize(ctx, token.Subject); err != nil {
+			if err := m.Store.RevokeFamily(ctx, token.Family); err != nil {
+				return nil, fmt.Errorf("error revoking refresh token family: %w", err)
+			}
+			return nil, fmt.Errorf("%w: %w", ErrInvalidRefreshToken, err)
+		}
+	}
+	return m.issue(ctx, token)
+}
+
+// Revoke invalidates a refresh token and its family, typically on logout.
+func (m *Manager) Revoke(ctx context.Context, refreshToken string) error {
+	token, err := m.Store.Find(ctx, hashToken(refreshToken))
+	if errors.Is(err, ErrInvalidRefreshToken) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return m.Store.RevokeFamily(ctx, token.Family)
+}
+
+// Verify validates an access token and returns its claims.
+func (m *Manager) Verify(accessToken string) (*Claims, error) {
+	claims, err := Parse(accessToken, m.secret)
+	if err != nil {
+		return nil, err
+	}
+	if m.Issuer != "" && claims.Issuer != m.Issuer {
+		return nil, ErrInvalidToken
+	}
+	if claims.Audience != m.Audience {
+		return nil, ErrInvalidToken
+	}
+	return claims, nil
+}
+
+// randomToken generates a random URL-safe token with 256 bits of entropy.
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, b); err != nil {
+		return "", fmt.Errorf("error generating token: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashToken hashes a refresh token so only digests are kept at rest.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
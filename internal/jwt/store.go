@@ -0,0 +1,98 @@
+package jwt
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// RefreshToken is a stored refresh token. Tokens obtained by rotating a
+// refresh token share its family, so a family covers a whole login.
+type RefreshToken struct {
+	Subject   string
+	Family    string
+	Scopes    []string
+	ClientID  string // OAuth client the token was issued to, "" for first-party tokens
+	ExpiresAt time.Time
+	Used      bool
+}
+
+// RefreshStore persists refresh token digests. Used tokens must be kept until
+// they expire, so their reuse can be detected.
+type RefreshStore interface {
+	// Save records a refresh token digest.
+	Save(ctx context.Context, hash string, token RefreshToken) error
+	// Use marks a refresh token digest as used and returns the token as it was
+	// before. It returns ErrInvalidRefreshToken if the digest is unknown.
+	Use(ctx context.Context, hash string) (RefreshToken, error)
+	// Find returns a refresh token by digest. It returns ErrInvalidRefreshToken
+	// if the digest is unknown.
+	Find(ctx context.Context, hash string) (RefreshToken, error)
+	// RevokeFamily removes every refresh token of a family.
+	RevokeFamily(ctx context.Context, family string) error
+}
+
+// InMemoryRefreshStore is a simple in-memory implementation of RefreshStore.
+// NOT suitable for production due to lack of persistence and scalability.
+type InMemoryRefreshStore struct {
+	tokens map[string]RefreshToken
+	sync.Mutex
+}
+
+// NewInMemoryRefreshStore creates a new InMemoryRefreshStore.
+func NewInMemoryRefreshStore() *InMemoryRefreshStore {
+	return &InMemoryRefreshStore{
+		tokens: make(map[string]RefreshToken),
+	}
+}
+
+// Save records a refresh token digest. Expired tokens are removed at the same time.
+func (s *InMemoryRefreshStore) Save(_ context.Context, hash string, token RefreshToken) error {
+	s.Lock()
+	defer s.Unlock()
+	now := time.Now()
+	for h, t := range s.tokens {
+		if now.After(t.ExpiresAt) {
+			delete(s.tokens, h)
+		}
+	}
+	s.tokens[hash] = token
+	return nil
+}
+
+// Use marks a refresh token digest as used and returns the token as it was before.
+func (s *InMemoryRefreshStore) Use(_ context.Context, hash string) (RefreshToken, error) {
+	s.Lock()
+	defer s.Unlock()
+	token, ok := s.tokens[hash]
+	if !ok {
+		return token, ErrInvalidRefreshToken
+	}
+	used := token
+	used.Used = true
+	s.tokens[hash] = used
+	return token, nil
+}
+
+// Find returns a refresh token by digest.
+func (s *InMemoryRefreshStore) Find(_ context.Context, hash string) (RefreshToken, error) {
+	s.Lock()
+	defer s.Unlock()
+	token, ok := s.tokens[hash]
+	if !ok {
+		return token, ErrInvalidRefreshToken
+	}
+	return token, nil
+}
+
+// RevokeFamily removes every refresh token of a family.
+func (s *InMemoryRefreshStore) RevokeFamily(_ context.Context, family string) error {
+	s.Lock()
+	defer s.Unlock()
+	for hash, token := range s.tokens {
+		if token.Family == family {
+			delete(s.tokens, hash)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,251 @@
+// Package openapi documents the routes of a ServeMux in an OpenAPI 3
+// document. Routes are registered through a Registry along with the
+// description of their operation, so the document cannot miss routes or
+// drift from them. Request and response bodies are described by Go values,
+// whose schema is derived from their type: the json tags name the
+// properties and the validate tags add their constraints.
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Version is the OpenAPI version of the generated documents.
+const Version = "3.0.3"
+
+// Operation describes the operation of a route.
+type Operation struct {
+	Summary     string
+	Description string
+	Tags        []string
+	// Value whose type describes the JSON request body, nil if there is none
+	Request any
+	// Responses by status code
+	Responses map[int]Response
+	// Names of the security schemes accepted by the route, none if it is public
+	Security []string
+}
+
+// Response describes a response of an operation.
+type Response struct {
+	Description string
+	// Value whose type describes the JSON response body, nil if there is none
+	Body any
+}
+
+// SecurityScheme is an OpenAPI security scheme, e.g. a bearer token.
+type SecurityScheme struct {
+	Type         string `json:"type"`
+	Scheme       string `json:"scheme,omitempty"`
+	BearerFormat string `json:"bearerFormat,omitempty"`
+	Name         string `json:"name,omitempty"`
+	In           string `json:"in,omitempty"`
+	Description  string `json:"description,omitempty"`
+}
+
+// Registry registers routes on a ServeMux and documents their operations.
+type Registry struct {
+	Title       string
+	Version     string
+	Description string
+	// Security schemes referenced by the operations, by name
+	SecuritySchemes map[string]SecurityScheme
+
+	mux *http.ServeMux
+	ops *operations // Shared with the registries returned by WithMux
+}
+
+// operations holds the documented operations.
+type operations struct {
+	mu     sync.Mutex
+	byPath map[string]map[string]Operation // By path, then lower case method
+}
+
+// NewRegistry returns a registry of the routes of mux.
+func NewRegistry(mux *http.ServeMux, title, version string) *Registry {
+	return &Registry{
+		Title:   title,
+		Version: version,
+		mux:     mux,
+		ops:     &operations{byPath: map[string]map[string]Operation{}},
+	}
+}
+
+// Handle registers handler for pattern on the mux and documents its operation.
+// Patterns without a method are documented as GET operations.
+func (reg *Registry) Handle(pattern string, handler http.Handler, op Operation) {
+	reg.mux.Handle(pattern, handler)
+	reg.Describe(pattern, op)
+}
+
+// WithMux returns a registry registering routes on another mux, e.g. one
+// mounted under a path prefix, and documenting them in the same document.
+func (reg *Registry) WithMux(mux *http.ServeMux) *Registry {
+	return &Registry{
+		Title:           reg.Title,
+		Version:         reg.Version,
+		Description:     reg.Description,
+		SecuritySchemes: reg.SecuritySchemes,
+		mux:             mux,
+		ops:             reg.ops,
+	}
+}
+
+// HandleFunc registers a handler function, see Handle.
+func (reg *Registry) HandleFunc(pattern string, handler func(http.ResponseWriter, *http.Request), op Operation) {
+	reg.Handle(pattern, http.HandlerFunc(handler), op)
+}
+
+// Describe documents the operation of a route registered elsewhere, e.g. one
+// answering several methods of which only some are part of the API.
+func (reg *Registry) Describe(pattern string, op Operation) {
+	method, path, found := strings.Cut(pattern, " ")
+	if !found {
+		method, path = http.MethodGet, pattern
+	}
+	// Patterns may include a host, which OpenAPI leaves to the servers
+	if i := strings.Index(path, "/"); i > 0 {
+		path = path[i:]
+	}
+
+	reg.ops.mu.Lock()
+	defer reg.ops.mu.Unlock()
+	path = wildcard.ReplaceAllString(strings.ReplaceAll(path, "{$}", ""), "{$1}")
+	if reg.ops.byPath[path] == nil {
+		reg.ops.byPath[path] = map[string]Operation{}
+	}
+	reg.ops.byPath[path][strings.ToLower(method)] = op
+}
+
+// wildcard matches the path wildcards of ServeMux patterns, e.g. {path...}.
+var wildcard = regexp.MustCompile(`\{([^}.]+)(?:\.\.\.)?\}`)
+
+// ServeHTTP serves the OpenAPI document in JSON.
+func (reg *Registry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	doc, err := json.Marshal(reg.Document())
+	if err != nil {
+		http.Error(w, "Failed to marshal OpenAPI document", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(doc)
+}
+
+// Document is an OpenAPI document, limited to the fields the registry uses.
+type Document struct {
+	OpenAPI    string                         `json:"openapi"`
+	Info       Info                           `json:"info"`
+	Paths      map[string]map[string]*opEntry `json:"paths"`
+	Components *Components                    `json:"components,omitempty"`
+}
+
+// Info describes the API.
+type Info struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+// Components holds the definitions referenced by the operations.
+type Components struct {
+	SecuritySchemes map[string]SecurityScheme `json:"securitySchemes,omitempty"`
+}
+
+type opEntry struct {
+	Summary     string                `json:"summary,omitempty"`
+	Description string                `json:"description,omitempty"`
+	Tags        []string              `json:"tags,omitempty"`
+	Parameters  []parameter           `json:"parameters,omitempty"`
+	RequestBody *requestBody          `json:"requestBody,omitempty"`
+	Responses   map[string]responseOf `json:"responses"`
+	Security    []map[string][]string `json:"security,omitempty"`
+}
+
+type parameter struct {
+	Name     string  `json:"name"`
+	In       string  `json:"in"`
+	Required bool    `json:"required"`
+	Schema   *Schema `json:"schema"`
+}
+
+type requestBody struct {
+	Required bool                 `json:"required"`
+	Content  map[string]mediaType `json:"content"`
+}
+
+type responseOf struct {
+	Description string               `json:"description"`
+	Content     map[string]mediaType `json:"content,omitempty"`
+}
+
+type mediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+// Document builds the OpenAPI document of the registered routes.
+func (reg *Registry) Document() *Document {
+	doc := &Document{
+		OpenAPI: Version,
+		Info:    Info{Title: reg.Title, Version: reg.Version, Description: reg.Description},
+		Paths:   map[string]map[string]*opEntry{},
+	}
+	if len(reg.SecuritySchemes) > 0 {
+		doc.Components = &Components{SecuritySchemes: reg.SecuritySchemes}
+	}
+
+	reg.ops.mu.Lock()
+	defer reg.ops.mu.Unlock()
+	for path, methods := range reg.ops.byPath {
+		item := map[string]*opEntry{}
+		for method, op := range methods {
+			item[method] = entryOf(path, op)
+		}
+		doc.Paths[path] = item
+	}
+	return doc
+}
+
+// entryOf converts an operation to its OpenAPI form.
+func entryOf(path string, op Operation) *opEntry {
+	entry := &opEntry{
+		Summary:     op.Summary,
+		Description: op.Description,
+		Tags:        op.Tags,
+		Responses:   map[string]responseOf{},
+	}
+	for _, match := range wildcard.FindAllStringSubmatch(path, -1) {
+		entry.Parameters = append(entry.Parameters, parameter{
+			Name: match[1], In: "path", Required: true, Schema: &Schema{Type: "string"},
+		})
+	}
+	if op.Request != nil {
+		entry.RequestBody = &requestBody{
+			Required: true,
+			Content:  map[string]mediaType{"application/json": {Schema: SchemaOf(op.Request)}},
+		}
+	}
+	for status, resp := range op.Responses {
+		description := resp.Description
+		if description == "" {
+			description = http.StatusText(status)
+		}
+		r := responseOf{Description: description}
+		if resp.Body != nil {
+			r.Content = map[string]mediaType{"application/json": {Schema: SchemaOf(resp.Body)}}
+		}
+		entry.Responses[fmt.Sprint(status)] = r
+	}
+	if len(entry.Responses) == 0 {
+		entry.Responses["default"] = responseOf{Description: "Response"}
+	}
+	// Alternative schemes are separate requirements, any of which is enough
+	for _, name := range op.Security {
+		entry.Security = append(entry.Security, map[string][]string{name: {}})
+	}
+	return entry
+}
@@ -0,0 +1,108 @@
+package openapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type itemRequest struct {
+	Name  string   `json:"name" validate:"required,max=20"`
+	Email string   `json:"email,omitempty" validate:"email"`
+	Tags  []string `json:"tags" validate:"max=3"`
+	Note  *string  `json:"note"`
+	Extra string   `json:"-"`
+}
+
+type itemResponse struct {
+	itemRequest
+	ID        int64     `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func TestRegistry(t *testing.T) {
+	mux := http.NewServeMux()
+	reg := NewRegistry(mux, "Test API", "1.0.0")
+	reg.HandleFunc("POST /items/{id}/copy", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	}, Operation{
+		Summary:   "Copy an item",
+		Request:   itemRequest{},
+		Responses: map[int]Response{201: {Body: itemResponse{}}, 404: {}},
+		Security:  []string{"bearer"},
+	})
+	reg.Describe("/files/{path...}", Operation{Summary: "Download a file"})
+
+	// Routes are registered on the mux
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/items/1/copy", nil))
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected status %d; got %d", http.StatusCreated, rr.Code)
+	}
+
+	rr = httptest.NewRecorder()
+	reg.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+	var doc Document
+	if err := json.Unmarshal(rr.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("error decoding document. Err: %v", err)
+	}
+	if doc.OpenAPI != Version || doc.Info.Title != "Test API" {
+		t.Errorf("unexpected document header %+v", doc)
+	}
+	if doc.Paths["/files/{path}"]["get"] == nil {
+		t.Errorf("expected GET /files/{path} to be documented; got %v", doc.Paths)
+	}
+
+	op := doc.Paths["/items/{id}/copy"]["post"]
+	if op == nil {
+		t.Fatalf("expected POST /items/{id}/copy to be documented; got %v", doc.Paths)
+	}
+	if len(op.Parameters) != 1 || op.Parameters[0].Name != "id" || op.Parameters[0].In != "path" {
+		t.Errorf("expected the id path parameter; got %+v", op.Parameters)
+	}
+	if _, ok := op.Responses["404"]; !ok || op.Responses["404"].Description != "Not Found" {
+		t.Errorf("expected a 404 response; got %+v", op.Responses)
+	}
+	if !reflect.DeepEqual(op.Security, []map[string][]string{{"bearer": {}}}) {
+		t.Errorf("unexpected security %v", op.Security)
+	}
+
+	created := op.Responses["201"].Content["application/json"].Schema
+	if created.Properties["name"] == nil || created.Properties["created_at"].Format != "date-time" || created.Properties["id"].Format != "int64" {
+		t.Errorf("expected embedded and own fields in the response schema; got %+v", created.Properties)
+	}
+}
+
+func TestSchemaOf(t *testing.T) {
+	s := SchemaOf(itemRequest{})
+	if !reflect.DeepEqual(s.Required, []string{"name"}) {
+		t.Errorf("expected name to be required; got %v", s.Required)
+	}
+	if _, ok := s.Properties["Extra"]; ok {
+		t.Errorf("expected fields ignored by encoding/json to be left out; got %v", s.Properties)
+	}
+	if name := s.Properties["name"]; name.Type != "string" || name.MaxLength == nil || *name.MaxLength != 20 {
+		t.Errorf("expected a string of at most 20 characters; got %+v", name)
+	}
+	if s.Properties["email"].Format != "email" {
+		t.Errorf("expected the email format; got %+v", s.Properties["email"])
+	}
+	if tags := s.Properties["tags"]; tags.Type != "array" || tags.Items.Type != "string" || tags.MaxItems == nil || *tags.MaxItems != 3 {
+		t.Errorf("expected an array of at most 3 strings; got %+v", tags)
+	}
+	if note := s.Properties["note"]; note.Type != "string" || !note.Nullable {
+		t.Errorf("expected a nullable string; got %+v", note)
+	}
+}
+
+func TestUIHandler(t *testing.T) {
+	rr := httptest.NewRecorder()
+	UIHandler("Test API", "/openapi.json").ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/docs", nil))
+	if !strings.Contains(rr.Body.String(), `url: "/openapi.json"`) || !strings.Contains(rr.Body.String(), "<title>Test API</title>") {
+		t.Errorf("expected the page to load the document; got %s", rr.Body.String())
+	}
+}
@@ -0,0 +1,30 @@
+package openapi
+
+import (
+	"bytes"
+	_ "embed"
+	"html/template"
+	"net/http"
+)
+
+//go:embed swagger.html
+var swaggerPage string
+
+var swaggerTemplate = template.Must(template.New("swagger").Parse(swaggerPage))
+
+// UIHandler serves a Swagger UI page exploring the document served at specURL.
+// The page loads Swagger UI itself from the unpkg CDN.
+func UIHandler(title, specURL string) http.Handler {
+	var buf bytes.Buffer
+	err := swaggerTemplate.Execute(&buf, struct{ Title, SpecURL string }{title, specURL})
+	if err != nil {
+		panic(err)
+	}
+	page := buf.Bytes()
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Content-Security-Policy", "frame-ancestors 'none'")
+		w.Write(page)
+	})
+}
@@ -0,0 +1,48 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"time"
+)
+
+// BucketStore keeps token buckets, refilled continuously, per key.
+type BucketStore interface {
+	// Take removes a token from the bucket of key, refilled with rate tokens
+	// per second up to burst, and reports whether one was available. If not,
+	// it also returns the time until one is.
+	Take(ctx context.Context, key string, rate float64, burst int) (bool, time.Duration, error)
+}
+
+// TokenBucket allows bursts of up to Burst hits per key, and Rate hits per
+// second on average. Unlike Limiter, a client exceeding it is not locked out
+// until the end of a window, it is allowed again as soon as a token is.
+type TokenBucket struct {
+	Store  BucketStore
+	Prefix string  // Prepended to keys, so buckets can share a store
+	Rate   float64 // Tokens added per second
+	Burst  int     // Capacity of the bucket
+}
+
+// NewTokenBucket creates a token bucket refilled at rate tokens per second,
+// holding up to burst tokens.
+func NewTokenBucket(store BucketStore, prefix string, rate float64, burst int) *TokenBucket {
+	return &TokenBucket{Store: store, Prefix: prefix, Rate: rate, Burst: burst}
+}
+
+// Allow takes a token for key and reports whether one was available. If not,
+// it also returns how long to wait before retrying.
+func (b *TokenBucket) Allow(ctx context.Context, key string) (bool, time.Duration, error) {
+	return b.Store.Take(ctx, b.Prefix+key, b.Rate, b.Burst)
+}
+
+// take refills a bucket holding tokens for the elapsed time, and takes a
+// token from it. It returns the tokens left, and the wait for a token if
+// none was available.
+func take(tokens float64, elapsed time.Duration, rate float64, burst int) (float64, bool, time.Duration) {
+	tokens = math.Min(float64(burst), tokens+elapsed.Seconds()*rate)
+	if tokens >= 1 {
+		return tokens - 1, true, 0
+	}
+	return tokens, false, time.Duration((1 - tokens) / rate * float64(time.Second))
+}
@@ -0,0 +1,113 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// window is the counter of a key in the current window.
+type window struct {
+	count   int
+	resetAt time.Time
+}
+
+// bucket is the token bucket of a key.
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	fullAt  time.Time // When the bucket is full again, and can be forgotten
+}
+
+// MemoryStore keeps counters and token buckets in memory. Limits are not
+// shared between server instances and are lost on restart.
+type MemoryStore struct {
+	mu              sync.Mutex
+	windows         map[string]*window
+	lastSweep       time.Time
+	buckets         map[string]*bucket
+	lastBucketSweep time.Time
+}
+
+// NewMemoryStore creates an empty in-memory store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{windows: make(map[string]*window), buckets: make(map[string]*bucket)}
+}
+
+// Hit increments the counter of key.
+func (s *MemoryStore) Hit(_ context.Context, key string, length time.Duration) (int, time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.sweep(now, length)
+
+	w, ok := s.windows[key]
+	if !ok || !now.Before(w.resetAt) {
+		w = &window{resetAt: now.Add(length)}
+		s.windows[key] = w
+	}
+	w.count++
+
+	return w.count, w.resetAt.Sub(now), nil
+}
+
+// Reset clears the counter of key.
+func (s *MemoryStore) Reset(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.windows, key)
+	return nil
+}
+
+// sweep removes expired windows at most once per window length, so the map
+// does not grow with every key ever seen.
+func (s *MemoryStore) sweep(now time.Time, length time.Duration) {
+	if now.Sub(s.lastSweep) < length {
+		return
+	}
+	s.lastSweep = now
+	for key, w := range s.windows {
+		if !now.Before(w.resetAt) {
+			delete(s.windows, key)
+		}
+	}
+}
+
+// Take removes a token from the bucket of key.
+func (s *MemoryStore) Take(_ context.Context, key string, rate float64, burst int) (bool, time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.sweepBuckets(now)
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(burst), updated: now}
+		s.buckets[key] = b
+	}
+	tokens, allowed, wait := take(b.tokens, now.Sub(b.updated), rate, burst)
+	b.tokens, b.updated = tokens, now
+	b.fullAt = now.Add(time.Duration((float64(burst) - tokens) / rate * float64(time.Second)))
+	return allowed, wait, nil
+}
+
+// sweepBuckets removes the buckets full again at most once a minute, since
+// a missing bucket is a full one.
+func (s *MemoryStore) sweepBuckets(now time.Time) {
+	if now.Sub(s.lastBucketSweep) < time.Minute {
+		return
+	}
+	s.lastBucketSweep = now
+	for key, b := range s.buckets {
+		if !now.Before(b.fullAt) {
+			delete(s.buckets, key)
+		}
+	}
+}
+
+var (
+	_ Store       = (*MemoryStore)(nil)
+	_ BucketStore = (*MemoryStore)(nil)
+)
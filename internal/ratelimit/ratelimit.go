@@ -0,0 +1,48 @@
+// Package ratelimit implements fixed window rate limiting with pluggable
+// counter stores, so limits can be shared between server instances.
+package ratelimit
+
+import (
+	"context"
+	"time"
+)
+
+// Store counts hits per key in fixed windows.
+type Store interface {
+	// Hit increments the counter of key, starting a new window if none is
+	// active, and returns the count and the time until the window resets.
+	Hit(ctx context.Context, key string, window time.Duration) (int, time.Duration, error)
+	// Reset clears the counter of key.
+	Reset(ctx context.Context, key string) error
+}
+
+// Limiter allows up to Limit hits per key in every Window.
+type Limiter struct {
+	Store  Store
+	Prefix string // Prepended to keys, so limiters can share a store
+	Limit  int
+	Window time.Duration
+}
+
+// NewLimiter creates a limiter allowing limit hits per window.
+func NewLimiter(store Store, prefix string, limit int, window time.Duration) *Limiter {
+	return &Limiter{Store: store, Prefix: prefix, Limit: limit, Window: window}
+}
+
+// Allow records a hit for key and reports whether it is within the limit.
+// If not, it also returns how long to wait before retrying.
+func (l *Limiter) Allow(ctx context.Context, key string) (bool, time.Duration, error) {
+	count, resetIn, err := l.Store.Hit(ctx, l.Prefix+key, l.Window)
+	if err != nil {
+		return false, 0, err
+	}
+	if count > l.Limit {
+		return false, resetIn, nil
+	}
+	return true, 0, nil
+}
+
+// Reset clears the hits of key, e.g. after a successful login.
+func (l *Limiter) Reset(ctx context.Context, key string) error {
+	return l.Store.Reset(ctx, l.Prefix+key)
+}
@@ -0,0 +1,186 @@
+package ratelimit
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"math"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLimiter(t *testing.T) {
+	ctx := context.Background()
+	limiter := NewLimiter(NewMemoryStore(), "login:", 2, time.Minute)
+
+	for i := range 2 {
+		allowed, _, err := limiter.Allow(ctx, "1.2.3.4")
+		if err != nil || !allowed {
+			t.Fatalf("expected hit %d to be allowed; got %v, Err: %v", i+1, allowed, err)
+		}
+	}
+
+	allowed, retryAfter, err := limiter.Allow(ctx, "1.2.3.4")
+	if err != nil || allowed {
+		t.Fatalf("expected third hit to be limited; got %v, Err: %v", allowed, err)
+	}
+	if retryAfter <= 0 || retryAfter > time.Minute {
+		t.Errorf("expected retry after within the window; got %v", retryAfter)
+	}
+
+	if allowed, _, _ := limiter.Allow(ctx, "5.6.7.8"); !allowed {
+		t.Errorf("expected other keys to be allowed")
+	}
+
+	limiter.Reset(ctx, "1.2.3.4")
+	if allowed, _, _ := limiter.Allow(ctx, "1.2.3.4"); !allowed {
+		t.Errorf("expected hit after reset to be allowed")
+	}
+}
+
+func TestReadReply(t *testing.T) {
+	r := bufio.NewReader(strings.NewReader("*2\r\n:3\r\n:59000\r\n"))
+	reply, err := readReply(r)
+	if err != nil {
+		t.Fatalf("error reading reply. Err: %v", err)
+	}
+	values := reply.([]any)
+	if values[0] != int64(3) || values[1] != int64(59000) {
+		t.Errorf("expected [3 59000]; got %v", values)
+	}
+
+	r = bufio.NewReader(strings.NewReader("-NOAUTH Authentication required.\r\n"))
+	if _, err := readReply(r); err == nil {
+		t.Errorf("expected error reply")
+	}
+}
+
+// slowRedis starts a server answering every command with the reply of a
+// successful Take after delay, and returns its address and the number of
+// connections it accepted.
+func slowRedis(t *testing.T, delay time.Duration) (string, *atomic.Int32) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("error listening. Err: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	var accepted atomic.Int32
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			accepted.Add(1)
+			go func() {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				for {
+					if _, err := readReply(r); err != nil {
+						return
+					}
+					time.Sleep(delay)
+					conn.Write([]byte("*2\r\n:1\r\n:0\r\n"))
+				}
+			}()
+		}
+	}()
+	return ln.Addr().String(), &accepted
+}
+
+func TestRedisStorePool(t *testing.T) {
+	ctx := context.Background()
+	delay := 50 * time.Millisecond
+	addr, accepted := slowRedis(t, delay)
+	s := NewRedisStore(addr, "")
+	s.PoolSize = 4
+	t.Cleanup(func() { s.Close() })
+
+	// Concurrent commands do not wait on a single connection
+	start := time.Now()
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if allowed, _, err := s.Take(ctx, "1.2.3.4", 1, 1); err != nil || !allowed {
+				t.Errorf("expected token to be taken; got %v, Err: %v", allowed, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if elapsed := time.Since(start); elapsed >= 8*delay {
+		t.Errorf("expected commands to run concurrently; took %v", elapsed)
+	}
+	if n := accepted.Load(); n > 4 {
+		t.Errorf("expected at most 4 connections; got %d", n)
+	}
+
+	// Idle connections are reused
+	n := accepted.Load()
+	if _, _, err := s.Take(ctx, "1.2.3.4", 1, 1); err != nil {
+		t.Fatalf("error taking token. Err: %v", err)
+	}
+	if accepted.Load() != n {
+		t.Errorf("expected an idle connection to be reused; got %d connections", accepted.Load())
+	}
+
+	s.Close()
+	if _, _, err := s.Take(ctx, "1.2.3.4", 1, 1); !errors.Is(err, ErrRedisClosed) {
+		t.Errorf("expected ErrRedisClosed after close; got %v", err)
+	}
+}
+
+func TestTokenBucket(t *testing.T) {
+	ctx := context.Background()
+	bucket := NewTokenBucket(NewMemoryStore(), "requests:", 10, 2)
+
+	for i := range 2 {
+		allowed, _, err := bucket.Allow(ctx, "1.2.3.4")
+		if err != nil || !allowed {
+			t.Fatalf("expected request %d of the burst to be allowed; got %v, Err: %v", i+1, allowed, err)
+		}
+	}
+	allowed, retryAfter, err := bucket.Allow(ctx, "1.2.3.4")
+	if err != nil || allowed {
+		t.Fatalf("expected request beyond the burst to be limited; got %v, Err: %v", allowed, err)
+	}
+	if retryAfter <= 0 || retryAfter > 100*time.Millisecond {
+		t.Errorf("expected retry after at most the time to refill a token; got %v", retryAfter)
+	}
+	if allowed, _, _ := bucket.Allow(ctx, "5.6.7.8"); !allowed {
+		t.Errorf("expected other keys to be allowed")
+	}
+
+	time.Sleep(retryAfter)
+	if allowed, _, _ := bucket.Allow(ctx, "1.2.3.4"); !allowed {
+		t.Errorf("expected a request to be allowed once a token is refilled")
+	}
+}
+
+func TestTake(t *testing.T) {
+	tests := []struct {
+		tokens  float64
+		elapsed time.Duration
+		left    float64
+		allowed bool
+		wait    time.Duration
+	}{
+		{2, 0, 1, true, 0},
+		{0, 50 * time.Millisecond, 0.5, false, 50 * time.Millisecond},
+		{0.5, 50 * time.Millisecond, 0, true, 0},
+		{1, time.Hour, 1, true, 0}, // Refilled up to the burst
+	}
+	for _, tt := range tests {
+		left, allowed, wait := take(tt.tokens, tt.elapsed, 10, 2)
+		if math.Abs(left-tt.left) > 1e-9 || allowed != tt.allowed || (wait-tt.wait).Abs() > time.Microsecond {
+			t.Errorf("take(%v, %v) = %v, %v, %v; expected %v, %v, %v", tt.tokens, tt.elapsed, left, allowed, wait, tt.left, tt.allowed, tt.wait)
+		}
+	}
+}
@@ -0,0 +1,303 @@
+package ratelimit
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// hitScript increments the counter and starts the window on the first hit,
+// atomically, returning the count and the remaining window in milliseconds.
+const hitScript = `local n = redis.call('INCR', KEYS[1])
+if n == 1 then redis.call('PEXPIRE', KEYS[1], ARGV[1]) end
+return {n, redis.call('PTTL', KEYS[1])}`
+
+// takeScript refills the bucket for the time elapsed since its last update,
+// by the clock of Redis so server instances need not agree on the time, and
+// takes a token. It returns whether one was taken and the wait in
+// milliseconds otherwise. Buckets expire once full again.
+const takeScript = `local rate, burst = tonumber(ARGV[1]), tonumber(ARGV[2])
+local time = redis.call('TIME')
+local now = tonumber(time[1]) * 1000 + math.floor(tonumber(time[2]) / 1000)
+local bucket = redis.call('HMGET', KEYS[1], 'tokens', 'updated')
+local tokens = tonumber(bucket[1]) or burst
+local updated = tonumber(bucket[2]) or now
+tokens = math.min(burst, tokens + math.max(0, now - updated) * rate / 1000)
+local allowed, wait = 0, 0
+if tokens >= 1 then
+  tokens, allowed = tokens - 1, 1
+else
+  wait = math.ceil((1 - tokens) * 1000 / rate)
+end
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'updated', now)
+redis.call('PEXPIRE', KEYS[1], math.ceil((burst - tokens) * 1000 / rate) + 1)
+return {allowed, wait}`
+
+// RedisStore keeps counters in Redis so limits are shared between server
+// instances. It speaks the Redis protocol over a pool of connections, so
+// concurrent requests checking their limits do not wait on each other.
+type RedisStore struct {
+	Addr     string
+	Password string // Optional, sent with AUTH on connect
+	Timeout  time.Duration
+	// Connections open at once at most, DefaultRedisPoolSize if zero. Commands
+	// wait up to Timeout for a connection when they are all in use.
+	PoolSize int
+
+	once   sync.Once
+	slots  chan struct{}   // Holds a value per open connection
+	idle   chan *redisConn // Open connections not in use
+	mu     sync.Mutex
+	closed bool
+}
+
+// DefaultRedisPoolSize is the default number of connections of a RedisStore.
+const DefaultRedisPoolSize = 10
+
+// ErrRedisClosed is returned by commands sent after the store was closed.
+var ErrRedisClosed = errors.New("redis store closed")
+
+// redisConn is a connection to Redis with its buffered reader.
+type redisConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+// NewRedisStore creates a store for the Redis server at addr.
+func NewRedisStore(addr, password string) *RedisStore {
+	return &RedisStore{Addr: addr, Password: password, Timeout: 2 * time.Second}
+}
+
+// Hit increments the counter of key.
+func (s *RedisStore) Hit(ctx context.Context, key string, length time.Duration) (int, time.Duration, error) {
+	reply, err := s.do(ctx, "EVAL", hitScript, "1", key, strconv.FormatInt(length.Milliseconds(), 10))
+	if err != nil {
+		return 0, 0, err
+	}
+	values, ok := reply.([]any)
+	if !ok || len(values) != 2 {
+		return 0, 0, fmt.Errorf("unexpected redis reply: %v", reply)
+	}
+	count, _ := values[0].(int64)
+	ttl, _ := values[1].(int64)
+	if ttl < 0 {
+		ttl = length.Milliseconds()
+	}
+	return int(count), time.Duration(ttl) * time.Millisecond, nil
+}
+
+// Reset clears the counter of key.
+func (s *RedisStore) Reset(ctx context.Context, key string) error {
+	_, err := s.do(ctx, "DEL", key)
+	return err
+}
+
+// Take removes a token from the bucket of key. It requires Redis 5 or later,
+// which replicates the effects of scripts reading the clock.
+func (s *RedisStore) Take(ctx context.Context, key string, rate float64, burst int) (bool, time.Duration, error) {
+	reply, err := s.do(ctx, "EVAL", takeScript, "1", key, strconv.FormatFloat(rate, 'f', -1, 64), strconv.Itoa(burst))
+	if err != nil {
+		return false, 0, err
+	}
+	values, ok := reply.([]any)
+	if !ok || len(values) != 2 {
+		return false, 0, fmt.Errorf("unexpected redis reply: %v", reply)
+	}
+	allowed, _ := values[0].(int64)
+	wait, _ := values[1].(int64)
+	return allowed == 1, time.Duration(wait) * time.Millisecond, nil
+}
+
+// Close closes the idle connections to Redis, and the others once their
+// commands complete. Later commands return ErrRedisClosed.
+func (s *RedisStore) Close() error {
+	s.setup()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	var err error
+	for {
+		select {
+		case conn := <-s.idle:
+			if closeErr := conn.Close(); err == nil {
+				err = closeErr
+			}
+			<-s.slots
+		default:
+			return err
+		}
+	}
+}
+
+// setup creates the pool on first use.
+func (s *RedisStore) setup() {
+	s.once.Do(func() {
+		size := s.PoolSize
+		if size <= 0 {
+			size = DefaultRedisPoolSize
+		}
+		s.slots = make(chan struct{}, size)
+		s.idle = make(chan *redisConn, size)
+	})
+}
+
+// do sends a command on a pooled connection and reads its reply. Connections
+// are dropped on errors other than error replies, so a later command
+// reconnects.
+func (s *RedisStore) do(ctx context.Context, args ...string) (any, error) {
+	conn, err := s.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	reply, err := s.roundTrip(ctx, conn, args)
+	var redisErr redisError
+	s.put(conn, err != nil && !errors.As(err, &redisErr))
+	return reply, err
+}
+
+// get returns an idle connection, or dials one if the pool is not full. It
+// waits up to Timeout for a connection to be returned otherwise.
+func (s *RedisStore) get(ctx context.Context) (*redisConn, error) {
+	s.setup()
+	s.mu.Lock()
+	closed := s.closed
+	s.mu.Unlock()
+	if closed {
+		return nil, ErrRedisClosed
+	}
+
+	select {
+	case conn := <-s.idle:
+		return conn, nil
+	default:
+	}
+
+	timer := time.NewTimer(s.Timeout)
+	defer timer.Stop()
+	select {
+	case conn := <-s.idle:
+		return conn, nil
+	case s.slots <- struct{}{}:
+		conn, err := s.connect(ctx)
+		if err != nil {
+			<-s.slots
+			return nil, err
+		}
+		return conn, nil
+	case <-timer.C:
+		return nil, errors.New("error connecting to redis: no connection available")
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// put returns a connection to the pool, or closes it if it is broken or the
+// store was closed.
+func (s *RedisStore) put(conn *redisConn, broken bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if broken || s.closed {
+		conn.Close()
+		<-s.slots
+		return
+	}
+	// Never blocks, there are no more connections than slots
+	s.idle <- conn
+}
+
+// connect dials Redis and authenticates if a password is set.
+func (s *RedisStore) connect(ctx context.Context) (*redisConn, error) {
+	dialer := net.Dialer{Timeout: s.Timeout}
+	netConn, err := dialer.DialContext(ctx, "tcp", s.Addr)
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to redis: %w", err)
+	}
+	conn := &redisConn{Conn: netConn, reader: bufio.NewReader(netConn)}
+
+	if s.Password != "" {
+		if _, err := s.roundTrip(ctx, conn, []string{"AUTH", s.Password}); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("error authenticating to redis: %w", err)
+		}
+	}
+	return conn, nil
+}
+
+// roundTrip writes a command as an array of bulk strings and reads the reply.
+func (s *RedisStore) roundTrip(ctx context.Context, conn *redisConn, args []string) (any, error) {
+	deadline := time.Now().Add(s.Timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	conn.SetDeadline(deadline)
+
+	buf := []byte("*" + strconv.Itoa(len(args)) + "\r\n")
+	for _, arg := range args {
+		buf = append(buf, "$"+strconv.Itoa(len(arg))+"\r\n"+arg+"\r\n"...)
+	}
+	if _, err := conn.Write(buf); err != nil {
+		return nil, err
+	}
+	return readReply(conn.reader)
+}
+
+// redisError is an error reply sent by the server.
+type redisError string
+
+func (e redisError) Error() string { return "redis: " + string(e) }
+
+// readReply reads a RESP2 reply: strings, errors, integers, bulk strings and arrays.
+func readReply(r *bufio.Reader) (any, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, fmt.Errorf("malformed redis reply %q", line)
+	}
+	kind, payload := line[0], line[1:len(line)-2]
+
+	switch kind {
+	case '+':
+		return payload, nil
+	case '-':
+		return nil, redisError(payload)
+	case ':':
+		return strconv.ParseInt(payload, 10, 64)
+	case '$':
+		n, err := strconv.Atoi(payload)
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		b := make([]byte, n+2)
+		if _, err := io.ReadFull(r, b); err != nil {
+			return nil, err
+		}
+		return string(b[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(payload)
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		values := make([]any, n)
+		for i := range values {
+			if values[i], err = readReply(r); err != nil {
+				return nil, err
+			}
+		}
+		return values, nil
+	}
+	return nil, fmt.Errorf("unknown redis reply type %q", kind)
+}
+
+var (
+	_ Store       = (*RedisStore)(nil)
+	_ BucketStore = (*RedisStore)(nil)
+)
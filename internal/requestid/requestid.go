@@ -0,0 +1,115 @@
+// Package requestid identifies requests for support correlation: the ID of a
+// request is returned in its response, added to its error responses, and
+// included in the log lines written with its context.
+package requestid
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+// Header is the request and response header carrying the request ID.
+const Header = "X-Request-ID"
+
+// maxLength bounds the IDs honored from incoming requests.
+const maxLength = 128
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying the request ID.
+func NewContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext returns the request ID of ctx, or "" if it has none.
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(contextKey{}).(string)
+	return id
+}
+
+// Middleware gives every request an ID, the one set by a proxy or client in
+// the X-Request-ID header if valid, and a random one otherwise.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(Header)
+		if !valid(id) {
+			id = rand.Text()
+		}
+		w.Header().Set(Header, id)
+		ew := &errorWriter{ResponseWriter: w}
+		next.ServeHTTP(ew, r.WithContext(NewContext(r.Context(), id)))
+
+		// The body of http.Error ends with a newline, the ID follows it
+		if ew.plainError {
+			fmt.Fprintf(w, "Request ID: %s\n", id)
+		}
+	})
+}
+
+// valid reports whether an incoming ID can be used: it is written to the
+// logs, so it is bounded and limited to characters that cannot forge lines.
+func valid(id string) bool {
+	if id == "" || len(id) > maxLength {
+		return false
+	}
+	return !strings.ContainsFunc(id, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("-_.:", r))
+	})
+}
+
+// errorWriter detects the plain text error responses written by http.Error.
+type errorWriter struct {
+	http.ResponseWriter
+	wroteHeader bool
+	plainError  bool
+}
+
+func (w *errorWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		w.plainError = status >= http.StatusBadRequest &&
+			strings.HasPrefix(w.Header().Get("Content-Type"), "text/plain")
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *errorWriter) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+	return w.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer, e.g. to flush.
+func (w *errorWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Handler is a slog.Handler adding the request ID of the context to the
+// records, so the lines logged with a request context can be correlated.
+type Handler struct {
+	slog.Handler
+}
+
+// NewHandler wraps h to add request IDs to its records.
+func NewHandler(h slog.Handler) *Handler {
+	return &Handler{Handler: h}
+}
+
+// Handle adds the request_id attribute when the context has a request ID.
+func (h *Handler) Handle(ctx context.Context, record slog.Record) error {
+	if id := FromContext(ctx); id != "" {
+		record.AddAttrs(slog.String("request_id", id))
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h *Handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &Handler{Handler: h.Handler.WithAttrs(attrs)}
+}
+
+func (h *Handler) WithGroup(name string) slog.Handler {
+	return &Handler{Handler: h.Handler.WithGroup(name)}
+}
@@ -0,0 +1,71 @@
+package requestid
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMiddleware(t *testing.T) {
+	var seen string
+	handler := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = FromContext(r.Context())
+		if r.URL.Path == "/fail" {
+			http.Error(w, "Failed to do it", http.StatusInternalServerError)
+		}
+	}))
+
+	tests := []struct {
+		name     string
+		incoming string
+		honored  bool
+	}{
+		{"generated", "", false},
+		{"honored", "lb-1234:abcd", true},
+		{"forged log line", "abc\nlevel=ERROR", false},
+		{"too long", strings.Repeat("a", maxLength+1), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set(Header, tt.incoming)
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			id := rr.Header().Get(Header)
+			if id == "" || id != seen {
+				t.Fatalf("expected the response header %q to match the context %q", id, seen)
+			}
+			if (id == tt.incoming) != tt.honored {
+				t.Errorf("expected the incoming ID honored to be %v; got ID %q", tt.honored, id)
+			}
+			if rr.Body.Len() != 0 {
+				t.Errorf("expected no body for a successful response; got %q", rr.Body.String())
+			}
+		})
+	}
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/fail", nil))
+	expected := "Failed to do it\nRequest ID: " + rr.Header().Get(Header) + "\n"
+	if rr.Body.String() != expected {
+		t.Errorf("expected error body %q; got %q", expected, rr.Body.String())
+	}
+}
+
+func TestHandler(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(NewHandler(slog.NewTextHandler(&buf, nil))).With("component", "test")
+
+	logger.InfoContext(NewContext(context.Background(), "req-1"), "Served")
+	logger.Info("Background")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[0], "component=test request_id=req-1") || strings.Contains(lines[1], "request_id") {
+		t.Errorf("expected the request ID on the request line only; got %q", lines)
+	}
+}
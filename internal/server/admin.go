@@ -0,0 +1,150 @@
+package server
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/raziel-aleman/go-starter/internal/auth"
+	"github.com/raziel-aleman/go-starter/internal/database"
+	sm "github.com/raziel-aleman/go-starter/internal/session"
+)
+
+// AdminUsersHandler lists users, optionally filtered by the q query parameter
+// matching usernames and emails, sorted by sort ("username", "email", "-" for
+// descending), and paginated with limit and offset or the cursor of the last page.
+func (s *Server) AdminUsersHandler(w http.ResponseWriter, r *http.Request) {
+	query := database.UserQuery{Search: r.URL.Query().Get("q")}
+	query.Limit, _ = strconv.Atoi(r.URL.Query().Get("limit"))
+	query.Offset, _ = strconv.Atoi(r.URL.Query().Get("offset"))
+	query.Sort = r.URL.Query().Get("sort")
+	query.Cursor = r.URL.Query().Get("cursor")
+	if query.Limit <= 0 || query.Limit > 200 {
+		query.Limit = 50
+	}
+	if query.Offset < 0 {
+		query.Offset = 0
+	}
+
+	users, total, err := s.db.ListUsers(r.Context(), query)
+	if errors.Is(err, database.ErrInvalidPage) {
+		http.Error(w, "Invalid sort or cursor", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		s.log().ErrorContext(r.Context(), "Failed to list users", "err", err)
+		http.Error(w, "Failed to list users", http.StatusInternalServerError)
+		return
+	}
+
+	response := map[string]any{
+		"users":  users,
+		"total":  total,
+		"limit":  query.Limit,
+		"offset": query.Offset,
+	}
+	// Pages sorted by username can be continued after the last one
+	if query.SortKey() == "" || query.SortKey() == "username" {
+		if len(users) == query.Limit {
+			response["next_cursor"] = users[len(users)-1].Username
+		}
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// AdminUserDisableHandler disables a user and logs out all its sessions.
+func (s *Server) AdminUserDisableHandler(w http.ResponseWriter, r *http.Request) {
+	s.adminUserAction(w, r, auth.EventAccountDisabled, func(username string) error {
+		return auth.DisableUser(r, s.sm, s.db, username)
+	})
+}
+
+// AdminUserBanHandler bans a user and logs out all its sessions.
+func (s *Server) AdminUserBanHandler(w http.ResponseWriter, r *http.Request) {
+	s.adminUserAction(w, r, auth.EventAccountBanned, func(username string) error {
+		return auth.BanUser(r, s.sm, s.db, username)
+	})
+}
+
+// AdminUserEnableHandler re-enables a disabled or banned user.
+func (s *Server) AdminUserEnableHandler(w http.ResponseWriter, r *http.Request) {
+	s.adminUserAction(w, r, auth.EventAccountEnabled, func(username string) error {
+		return auth.EnableUser(r.Context(), s.db, username)
+	})
+}
+
+// AdminUserPasswordResetHandler forces a user to change its password on next use.
+func (s *Server) AdminUserPasswordResetHandler(w http.ResponseWriter, r *http.Request) {
+	s.adminUserAction(w, r, auth.EventPasswordResetRequired, func(username string) error {
+		return auth.ForcePasswordReset(r, s.sm, s.db, username)
+	})
+}
+
+// AdminUserDeleteHandler soft-deletes a user and logs out all its sessions.
+func (s *Server) AdminUserDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	s.adminUserAction(w, r, auth.EventAccountDeleted, func(username string) error {
+		return auth.DeleteUser(r, s.sm, s.db, username)
+	})
+}
+
+// AdminUserRestoreHandler reverts the soft deletion of a user.
+func (s *Server) AdminUserRestoreHandler(w http.ResponseWriter, r *http.Request) {
+	// Deleted users are not found by pathUsername, the path is matched as is
+	s.runAdminUserAction(w, r, r.PathValue("username"), auth.EventAccountRestored, func(username string) error {
+		return auth.RestoreUser(r.Context(), s.db, username)
+	})
+}
+
+// AdminUserPurgeHandler permanently removes a user, deleted or not.
+func (s *Server) AdminUserPurgeHandler(w http.ResponseWriter, r *http.Request) {
+	s.runAdminUserAction(w, r, r.PathValue("username"), auth.EventAccountPurged, func(username string) error {
+		return auth.PurgeUser(r, s.sm, s.db, username)
+	})
+}
+
+// adminUserAction runs an action on the user of the request path and records
+// it in the audit log with the admin who performed it.
+func (s *Server) adminUserAction(w http.ResponseWriter, r *http.Request, event string, action func(username string) error) {
+	username, ok := s.pathUsername(w, r)
+	if !ok {
+		return
+	}
+	s.runAdminUserAction(w, r, username, event, action)
+}
+
+// runAdminUserAction runs an action on a user and records it in the audit
+// log with the admin who performed it.
+func (s *Server) runAdminUserAction(w http.ResponseWriter, r *http.Request, username string, event string, action func(username string) error) {
+	err := action(username)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		s.log().ErrorContext(r.Context(), "Admin user action failed", "username", username, "event", event, "err", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	admin, _ := sm.GetSession(r).Get("username").(string)
+	auth.RecordEvent(r, s.db, event, username, "by "+admin)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// pathUsername returns the username of the request path as stored, since
+// usernames match case-insensitively. It responds 404 Not Found and returns
+// false if the user does not exist.
+func (s *Server) pathUsername(w http.ResponseWriter, r *http.Request) (string, bool) {
+	username, err := s.db.CanonicalUsername(r.Context(), r.PathValue("username"))
+	if errors.Is(err, sql.ErrNoRows) {
+		http.NotFound(w, r)
+		return "", false
+	}
+	if err != nil {
+		s.log().ErrorContext(r.Context(), "Failed to find user", "err", err)
+		http.Error(w, "Failed to find user", http.StatusInternalServerError)
+		return "", false
+	}
+	return username, true
+}
@@ -0,0 +1,160 @@
+package server
+
+import (
+	"bytes"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/raziel-aleman/go-starter/internal/auth"
+	"github.com/raziel-aleman/go-starter/internal/requestid"
+	sm "github.com/raziel-aleman/go-starter/internal/session"
+)
+
+// apiPrefix is the path prefix of the versioned API routes. Unlike the
+// browser-facing routes, they only answer JSON, errors included, never
+// redirect to pages, and accept access tokens and API keys besides sessions.
+const apiPrefix = "/api/v1/"
+
+// apiError is the body of the error responses of the API routes.
+type apiError struct {
+	Error     string `json:"error"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// apiMiddleware is the middleware stack of the API routes: clients must
+// accept JSON, responses are not cached, and errors are written in JSON.
+func apiMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-store")
+
+		ew := &jsonErrorWriter{ResponseWriter: w, r: r}
+		defer ew.flush()
+
+		if !acceptsJSON(r) {
+			http.Error(ew, "The API only answers application/json", http.StatusNotAcceptable)
+			return
+		}
+		next.ServeHTTP(ew, r)
+	})
+}
+
+// acceptsJSON reports whether the Accept header of the request allows JSON,
+// as requests without one do.
+func acceptsJSON(r *http.Request) bool {
+	accept := r.Header.Get("Accept")
+	if accept == "" {
+		return true
+	}
+	for _, item := range strings.Split(accept, ",") {
+		mediaType, _, err := mime.ParseMediaType(item)
+		if err != nil {
+			continue
+		}
+		switch mediaType {
+		case "application/json", "application/*", "*/*":
+			return true
+		}
+	}
+	return false
+}
+
+// jsonErrorWriter rewrites the plain text error responses written by
+// http.Error, by the handlers and the auth middlewares alike, as apiError
+// bodies.
+type jsonErrorWriter struct {
+	http.ResponseWriter
+	r           *http.Request
+	wroteHeader bool
+	status      int // Status of the error being rewritten, 0 if none
+	message     bytes.Buffer
+}
+
+func (w *jsonErrorWriter) WriteHeader(status int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	if status >= http.StatusBadRequest && strings.HasPrefix(w.Header().Get("Content-Type"), "text/plain") {
+		w.status = status
+		return
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *jsonErrorWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.status != 0 {
+		return w.message.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer, e.g. to flush.
+func (w *jsonErrorWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// flush writes the error being rewritten, if any.
+func (w *jsonErrorWriter) flush() {
+	if w.status == 0 {
+		return
+	}
+	w.Header().Del("Content-Length")
+	writeJSON(w.ResponseWriter, w.status, apiError{
+		Error:     strings.TrimSpace(w.message.String()),
+		RequestID: requestid.FromContext(w.r.Context()),
+	})
+}
+
+// apiAuth authenticates the requests of API routes with an access token or
+// API key in the "Authorization: Bearer" header, or else with the session.
+func (s *Server) apiAuth(handler http.Handler) http.Handler {
+	bearer := auth.BearerMiddleware(s.bearerValidator(), handler)
+	session := auth.AuthMiddleware(s.db, handler)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isBearerRequest(r) {
+			bearer.ServeHTTP(w, r)
+			return
+		}
+		session.ServeHTTP(w, r)
+	})
+}
+
+// oauthAudience is the audience of the access tokens issued to OAuth clients.
+const oauthAudience = "oauth"
+
+// bearerValidator accepts the access tokens, first-party or issued to OAuth
+// clients, and the API keys of enabled users.
+func (s *Server) bearerValidator() auth.TokenValidator {
+	return auth.EnabledValidator(s.db, auth.AnyValidator(
+		auth.JWTValidator(s.tokens),
+		auth.JWTValidator(s.oauthServer.Tokens),
+		auth.APIKeyValidator(s.db),
+	))
+}
+
+// isBearerRequest reports whether the request carries a bearer token.
+func isBearerRequest(r *http.Request) bool {
+	scheme, _, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+	return strings.EqualFold(scheme, "Bearer")
+}
+
+// isAPIBearerRequest reports whether a request to the API routes is
+// authenticated with a bearer token, which browsers do not send by
+// themselves: such requests do not need a CSRF token.
+func isAPIBearerRequest(r *http.Request) bool {
+	return strings.HasPrefix(r.URL.Path, apiPrefix) && isBearerRequest(r)
+}
+
+// callerName returns the username of the principal stored by the auth
+// middlewares, or else of the session.
+func callerName(r *http.Request) string {
+	if principal, ok := auth.PrincipalFromContext(r.Context()); ok {
+		return principal.Username
+	}
+	username, _ := sm.GetSession(r).Get("username").(string)
+	return username
+}
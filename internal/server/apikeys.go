@@ -0,0 +1,93 @@
+package server
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/raziel-aleman/go-starter/internal/auth"
+	sm "github.com/raziel-aleman/go-starter/internal/session"
+)
+
+// APIKeysHandler lists the API keys of the logged-in user.
+func (s *Server) APIKeysHandler(w http.ResponseWriter, r *http.Request) {
+	username := callerName(r)
+
+	keys, err := s.db.APIKeys(r.Context(), username)
+	if err != nil {
+		s.log().ErrorContext(r.Context(), "Failed to list API keys", "err", err)
+		http.Error(w, "Failed to list API keys", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, keys)
+}
+
+// apiKeyRequest is the body of the API key creation endpoint.
+type apiKeyRequest struct {
+	Name   string   `json:"name" validate:"required"`
+	Scopes []string `json:"scopes,omitempty"`
+}
+
+// apiKeyResponse is a new API key, the only response including the key.
+type apiKeyResponse struct {
+	ID     int64    `json:"id"`
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+	Key    string   `json:"key"`
+}
+
+// APIKeyCreateHandler issues a new API key, optionally restricted to scopes.
+// The key is only returned in this response.
+func (s *Server) APIKeyCreateHandler(w http.ResponseWriter, r *http.Request) {
+	var body apiKeyRequest
+	if err := readJSON(r, &body); err != nil || body.Name == "" {
+		http.Error(w, "Name is required", http.StatusBadRequest)
+		return
+	}
+
+	username, _ := sm.GetSession(r).Get("username").(string)
+	key, id, err := auth.CreateAPIKey(r.Context(), s.db, username, body.Name, body.Scopes)
+	if errors.Is(err, auth.ErrInvalidScope) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		s.log().ErrorContext(r.Context(), "Failed to create API key", "err", err)
+		http.Error(w, "Failed to create API key", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, apiKeyResponse{ID: id, Name: body.Name, Scopes: body.Scopes, Key: key})
+}
+
+// APIKeyRevokeHandler revokes an API key of the logged-in user.
+func (s *Server) APIKeyRevokeHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	username := callerName(r)
+	err = s.db.RevokeAPIKey(r.Context(), username, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		s.log().ErrorContext(r.Context(), "Failed to revoke API key", "err", err)
+		http.Error(w, "Failed to revoke API key", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// APIKeyProtectedHandler is a simple route that will be wrapped with the APIKeyMiddleware.
+func (s *Server) APIKeyProtectedHandler(w http.ResponseWriter, r *http.Request) {
+	username, _ := auth.APIKeyUserFromContext(r.Context())
+	fmt.Fprintf(w, "Welcome, %s! This is an API key protected area.\n", username)
+}
@@ -0,0 +1,48 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/raziel-aleman/go-starter/internal/database"
+)
+
+// BackupHandler downloads a consistent snapshot of the SQLite database, taken
+// while the server keeps serving requests.
+func (s *Server) BackupHandler(w http.ResponseWriter, r *http.Request) {
+	dir, err := os.MkdirTemp("", "backup")
+	if err != nil {
+		s.log().ErrorContext(r.Context(), "Failed to back up the database", "err", err)
+		http.Error(w, "Failed to back up the database", http.StatusInternalServerError)
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "backup.db")
+	err = s.db.Backup(r.Context(), path)
+	if errors.Is(err, database.ErrBackupUnsupported) {
+		http.Error(w, "Backups are only supported for SQLite", http.StatusNotImplemented)
+		return
+	}
+	if err != nil {
+		s.log().ErrorContext(r.Context(), "Failed to back up the database", "err", err)
+		http.Error(w, "Failed to back up the database", http.StatusInternalServerError)
+		return
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		s.log().ErrorContext(r.Context(), "Failed to back up the database", "err", err)
+		http.Error(w, "Failed to back up the database", http.StatusInternalServerError)
+		return
+	}
+	defer file.Close()
+
+	name := "backup-" + time.Now().UTC().Format("20060102T150405Z") + ".db"
+	w.Header().Set("Content-Type", "application/vnd.sqlite3")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+name+`"`)
+	http.ServeContent(w, r, name, time.Now(), file)
+}
@@ -0,0 +1,29 @@
+package server
+
+import (
+	"errors"
+	"net"
+	"net/http"
+
+	"github.com/raziel-aleman/go-starter/internal/auth/captcha"
+)
+
+// verifyCaptcha checks the CAPTCHA response of the request and reports
+// whether it passed, responding with an error if it did not.
+func (s *Server) verifyCaptcha(w http.ResponseWriter, r *http.Request) bool {
+	remoteIP, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		remoteIP = r.RemoteAddr
+	}
+	err = s.captcha.Verify(r.Context(), captcha.Response(r, s.captcha), remoteIP)
+	if errors.Is(err, captcha.ErrFailed) {
+		http.Error(w, "CAPTCHA verification failed", http.StatusBadRequest)
+		return false
+	}
+	if err != nil {
+		s.log().ErrorContext(r.Context(), "CAPTCHA verification unavailable", "err", err)
+		http.Error(w, "CAPTCHA verification unavailable", http.StatusServiceUnavailable)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,112 @@
+package server
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// corsConfig is the policy of cross-origin requests from browsers.
+type corsConfig struct {
+	Origins     []string      // Allowed origins, "*" for any
+	Methods     []string      // Methods allowed in preflight requests
+	Headers     []string      // Request headers allowed in preflight requests
+	Expose      []string      // Response headers scripts may read
+	Credentials bool          // Whether requests may carry cookies
+	MaxAge      time.Duration // How long browsers cache preflight responses, zero for their default
+}
+
+// newCORSConfig reads CORS_ALLOWED_ORIGINS (default http://localhost:5173, the
+// frontend dev server), CORS_ALLOWED_METHODS, CORS_ALLOWED_HEADERS, and
+// CORS_EXPOSED_HEADERS, comma-separated, CORS_ALLOW_CREDENTIALS (default true)
+// and CORS_MAX_AGE, e.g. 10m. The headers the server reads are always allowed
+// and exposed, in addition to the configured ones.
+func newCORSConfig(headers ...string) (corsConfig, error) {
+	config := corsConfig{
+		Origins:     splitList(envOr("CORS_ALLOWED_ORIGINS", "http://localhost:5173")),
+		Methods:     splitList(envOr("CORS_ALLOWED_METHODS", "GET, POST, PUT, DELETE, OPTIONS, PATCH")),
+		Headers:     append(splitList(envOr("CORS_ALLOWED_HEADERS", "Accept, Authorization, Content-Type")), headers...),
+		Expose:      append(splitList(os.Getenv("CORS_EXPOSED_HEADERS")), headers...),
+		Credentials: true,
+	}
+	if value := os.Getenv("CORS_ALLOW_CREDENTIALS"); value != "" {
+		credentials, err := strconv.ParseBool(value)
+		if err != nil {
+			return config, fmt.Errorf("invalid CORS_ALLOW_CREDENTIALS %q", value)
+		}
+		config.Credentials = credentials
+	}
+	if value := os.Getenv("CORS_MAX_AGE"); value != "" {
+		maxAge, err := time.ParseDuration(value)
+		if err != nil || maxAge < 0 {
+			return config, fmt.Errorf("invalid CORS_MAX_AGE %q", value)
+		}
+		config.MaxAge = maxAge
+	}
+	if config.Credentials && slices.Contains(config.Origins, "*") {
+		slog.Warn("CORS allows credentials from any origin: any website can make requests with the cookies of its visitors")
+	}
+	return config, nil
+}
+
+// allows reports whether requests from origin are allowed.
+func (c corsConfig) allows(origin string) bool {
+	return slices.ContainsFunc(c.Origins, func(allowed string) bool {
+		return allowed == "*" || strings.EqualFold(allowed, origin)
+	})
+}
+
+// corsMiddleware sets the CORS headers of requests from allowed origins, and
+// answers preflight requests. Browsers reject credentialed responses allowing
+// "*", so the origin is echoed instead when credentials are allowed.
+func (s *Server) corsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Origin")
+		origin := r.Header.Get("Origin")
+		if origin != "" && s.cors.allows(origin) {
+			if slices.Contains(s.cors.Origins, "*") && !s.cors.Credentials {
+				w.Header().Set("Access-Control-Allow-Origin", "*")
+			} else {
+				w.Header().Set("Access-Control-Allow-Origin", origin)
+			}
+			if s.cors.Credentials {
+				w.Header().Set("Access-Control-Allow-Credentials", "true")
+			}
+			if r.Method == http.MethodOptions {
+				w.Header().Set("Access-Control-Allow-Methods", strings.Join(s.cors.Methods, ", "))
+				w.Header().Set("Access-Control-Allow-Headers", strings.Join(s.cors.Headers, ", "))
+				if s.cors.MaxAge > 0 {
+					w.Header().Set("Access-Control-Max-Age", strconv.Itoa(int(s.cors.MaxAge.Seconds())))
+				}
+			} else if len(s.cors.Expose) > 0 {
+				w.Header().Set("Access-Control-Expose-Headers", strings.Join(s.cors.Expose, ", "))
+			}
+		}
+
+		// Handle preflight OPTIONS requests, without CORS headers the browser
+		// rejects the request of a disallowed origin
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		// Proceed with the next handler
+		next.ServeHTTP(w, r)
+	})
+}
+
+// splitList splits a comma-separated list, trimming its items.
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
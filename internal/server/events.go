@@ -0,0 +1,32 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/raziel-aleman/go-starter/internal/database"
+)
+
+// AuthEventsHandler lists authentication audit log events, newest first. The
+// username, type, before, and limit query parameters filter and page the log.
+func (s *Server) AuthEventsHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := database.AuthEventFilter{
+		Username: query.Get("username"),
+		Type:     query.Get("type"),
+	}
+	filter.Before, _ = strconv.ParseInt(query.Get("before"), 10, 64)
+	filter.Limit, _ = strconv.Atoi(query.Get("limit"))
+	if filter.Limit > 1000 {
+		filter.Limit = 1000
+	}
+
+	events, err := s.db.AuthEvents(r.Context(), filter)
+	if err != nil {
+		s.log().ErrorContext(r.Context(), "Failed to list auth events", "err", err)
+		http.Error(w, "Failed to list auth events", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, events)
+}
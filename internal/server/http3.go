@@ -0,0 +1,36 @@
+package server
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+)
+
+// newHTTP3Server creates an experimental HTTP/3 server on the UDP port of
+// server, with its handler and TLS configuration. The handler of server is
+// wrapped to announce HTTP/3 to clients with an Alt-Svc header, and shutting
+// down server also shuts down the HTTP/3 server gracefully.
+func newHTTP3Server(server *http.Server) *http3.Server {
+	h3 := &http3.Server{
+		Addr:      server.Addr,
+		Handler:   server.Handler,
+		TLSConfig: server.TLSConfig,
+		// 0-RTT requests can be replayed by an attacker
+		QUICConfig:  &quic.Config{Allow0RTT: false},
+		IdleTimeout: server.IdleTimeout,
+	}
+
+	handler := server.Handler
+	server.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Fails until the UDP listener is up, clients then keep the TCP connection
+		_ = h3.SetQUICHeaders(w.Header())
+		handler.ServeHTTP(w, r)
+	})
+	server.RegisterOnShutdown(func() {
+		// Sends GOAWAY and waits for the requests in flight, until Close
+		go h3.Shutdown(context.Background())
+	})
+	return h3
+}
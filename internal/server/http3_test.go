@@ -0,0 +1,71 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/quic-go/quic-go/http3"
+)
+
+func TestHTTP3Server(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Proto))
+	})
+	// The TLS server provides a certificate for 127.0.0.1
+	tlsServer := httptest.NewTLSServer(ok)
+	defer tlsServer.Close()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("error listening on UDP. Err: %v", err)
+	}
+	defer conn.Close()
+	port := conn.LocalAddr().(*net.UDPAddr).Port
+
+	server := &http.Server{
+		Addr:      "127.0.0.1:" + strconv.Itoa(port),
+		Handler:   ok,
+		TLSConfig: &tls.Config{Certificates: tlsServer.TLS.Certificates},
+	}
+	h3 := newHTTP3Server(server)
+	go h3.Serve(conn)
+	defer h3.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(tlsServer.Certificate())
+	transport := &http3.Transport{TLSClientConfig: &tls.Config{RootCAs: roots}}
+	defer transport.Close()
+	client := &http.Client{Transport: transport, Timeout: 5 * time.Second}
+
+	resp, err := client.Get("https://" + server.Addr + "/")
+	if err != nil {
+		t.Fatalf("error sending HTTP/3 request. Err: %v", err)
+	}
+	resp.Body.Close()
+	if resp.ProtoMajor != 3 {
+		t.Errorf("expected an HTTP/3 response; got %s", resp.Proto)
+	}
+
+	// Responses over TCP announce the HTTP/3 port
+	rr := httptest.NewRecorder()
+	server.Handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+	if expected := `h3=":` + strconv.Itoa(port) + `"; ma=2592000`; rr.Header().Get("Alt-Svc") != expected {
+		t.Errorf("expected Alt-Svc %q; got %q", expected, rr.Header().Get("Alt-Svc"))
+	}
+}
+
+func TestNewProtocols(t *testing.T) {
+	protocols, serveHTTP3 := newProtocols("h2c,http3")
+	if !protocols.UnencryptedHTTP2() || protocols.HTTP1() || !serveHTTP3 {
+		t.Errorf("unexpected protocols %v, HTTP/3 %v", protocols, serveHTTP3)
+	}
+	if _, serveHTTP3 := newProtocols(""); serveHTTP3 {
+		t.Errorf("expected HTTP/3 to be disabled by default")
+	}
+}
@@ -0,0 +1,94 @@
+package server
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"github.com/raziel-aleman/go-starter/internal/auth"
+	"github.com/raziel-aleman/go-starter/internal/auth/oauth"
+	sm "github.com/raziel-aleman/go-starter/internal/session"
+)
+
+// IdentitiesHandler lists the external identities linked to the logged-in user.
+func (s *Server) IdentitiesHandler(w http.ResponseWriter, r *http.Request) {
+	username, _ := sm.GetSession(r).Get("username").(string)
+
+	identities, err := s.db.UserIdentities(r.Context(), username)
+	if err != nil {
+		s.log().ErrorContext(r.Context(), "Failed to list identities", "err", err)
+		http.Error(w, "Failed to list identities", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, identities)
+}
+
+// IdentityLinkHandler redirects the logged-in user to the identity provider,
+// whose callback links the identity to the user.
+func (s *Server) IdentityLinkHandler(w http.ResponseWriter, r *http.Request) {
+	provider, ok := s.oauth[r.PathValue("provider")]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	session := sm.GetSession(r)
+	authURL, err := oauth.BeginLogin(session, provider)
+	if err != nil {
+		s.log().ErrorContext(r.Context(), "Failed to start linking", "err", err)
+		http.Error(w, "Failed to start linking", http.StatusInternalServerError)
+		return
+	}
+	session.Put(oauthLinkKey, provider.Name())
+
+	http.Redirect(w, r, authURL, http.StatusSeeOther)
+}
+
+// IdentityUnlinkHandler unlinks the identity of a provider from the logged-in user.
+func (s *Server) IdentityUnlinkHandler(w http.ResponseWriter, r *http.Request) {
+	username, _ := sm.GetSession(r).Get("username").(string)
+	provider := r.PathValue("provider")
+
+	err := auth.UnlinkIdentity(r.Context(), s.db, username, provider)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.NotFound(w, r)
+		return
+	}
+	if errors.Is(err, auth.ErrLastIdentity) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		s.log().ErrorContext(r.Context(), "Failed to unlink identity", "err", err)
+		http.Error(w, "Failed to unlink identity", http.StatusInternalServerError)
+		return
+	}
+
+	auth.RecordEvent(r, s.db, auth.EventIdentityUnlinked, username, provider)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// linkIdentity completes the linking of an identity started by the
+// IdentityLinkHandler, once the provider authenticated it.
+func (s *Server) linkIdentity(w http.ResponseWriter, r *http.Request, identity *oauth.Identity) {
+	username, _ := sm.GetSession(r).Get("username").(string)
+	if username == "" || username == "guest" {
+		http.Error(w, "Unauthenticated", http.StatusForbidden)
+		return
+	}
+
+	err := auth.LinkIdentity(r.Context(), s.db, username, identity)
+	if errors.Is(err, auth.ErrIdentityLinked) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		s.log().ErrorContext(r.Context(), "Failed to link identity", "err", err)
+		http.Error(w, "Failed to link identity", http.StatusInternalServerError)
+		return
+	}
+
+	auth.RecordEvent(r, s.db, auth.EventIdentityLinked, username, identity.Provider)
+	http.Redirect(w, r, s.baseURL()+"/", http.StatusSeeOther)
+}
@@ -0,0 +1,71 @@
+package server
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/raziel-aleman/go-starter/internal/auth"
+	sm "github.com/raziel-aleman/go-starter/internal/session"
+)
+
+// ImpersonateHandler logs the admin in as the user of the request path, until
+// the impersonation is stopped.
+func (s *Server) ImpersonateHandler(w http.ResponseWriter, r *http.Request) {
+	srw, ok := w.(*sm.SessionResponseWriter)
+	if !ok {
+		http.Error(w, "Session not found", http.StatusInternalServerError)
+		return
+	}
+	username, ok := s.pathUsername(w, r)
+	if !ok {
+		return
+	}
+
+	admin, err := auth.StartImpersonation(r, srw, s.db, username)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.NotFound(w, r)
+		return
+	}
+	if errors.Is(err, auth.ErrCannotImpersonate) || errors.Is(err, auth.ErrImpersonating) || errors.Is(err, auth.ErrAccountDisabled) {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		s.log().ErrorContext(r.Context(), "Failed to impersonate user", "err", err)
+		http.Error(w, "Failed to impersonate user", http.StatusInternalServerError)
+		return
+	}
+
+	auth.RecordEvent(r, s.db, auth.EventImpersonationStart, username, "by "+admin)
+	s.log().InfoContext(r.Context(), "Admin is impersonating user", "admin", admin, "username", username)
+	srw.StatusCode = http.StatusSeeOther
+	srw.ResponseWriter.Header().Set("Location", "http://localhost:"+strconv.Itoa(s.port)+"/")
+}
+
+// ImpersonateStopHandler ends the impersonation and logs the admin back in.
+func (s *Server) ImpersonateStopHandler(w http.ResponseWriter, r *http.Request) {
+	srw, ok := w.(*sm.SessionResponseWriter)
+	if !ok {
+		http.Error(w, "Session not found", http.StatusInternalServerError)
+		return
+	}
+
+	admin, username, err := auth.StopImpersonation(r, srw)
+	if errors.Is(err, auth.ErrNotImpersonating) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		s.log().ErrorContext(r.Context(), "Failed to stop impersonation", "err", err)
+		http.Error(w, "Failed to stop impersonation", http.StatusInternalServerError)
+		return
+	}
+
+	// The request session still names the admin as impersonator in the event detail
+	auth.RecordEvent(r, s.db, auth.EventImpersonationStop, username, "")
+	s.log().InfoContext(r.Context(), "Admin stopped impersonating user", "admin", admin, "username", username)
+	srw.StatusCode = http.StatusSeeOther
+	srw.ResponseWriter.Header().Set("Location", "http://localhost:"+strconv.Itoa(s.port)+"/")
+}
@@ -0,0 +1,112 @@
+package server
+
+import (
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/raziel-aleman/go-starter/internal/auth"
+	"github.com/raziel-aleman/go-starter/internal/database/databasetest"
+	sm "github.com/raziel-aleman/go-starter/internal/session"
+	"github.com/raziel-aleman/go-starter/internal/store"
+)
+
+// accountTestServer serves the impersonation routes, and routes guarded like
+// the credential routes, to clients logging in with POST /login/{username}.
+type accountTestServer struct {
+	*httptest.Server
+	store *store.InMemorySessionStore
+}
+
+func newAccountTestServer(t *testing.T) *accountTestServer {
+	t.Helper()
+	st := store.NewInMemorySessionStore()
+	s := &Server{
+		sm: sm.NewSessionManager(st, "GOSESSID", time.Hour, time.Hour),
+		db: databasetest.New(t,
+			databasetest.User("admin", "password"),
+			databasetest.User("root", "password"),
+			databasetest.User("alice", "password"),
+			databasetest.Role("admin", auth.RoleAdmin),
+			databasetest.Role("root", auth.RoleAdmin),
+		),
+		recentAuthMaxAge: time.Minute,
+	}
+	t.Cleanup(s.sm.Close)
+	// CSRF protection is covered by the session package
+	s.sm.CSRFMethods = nil
+
+	ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNoContent) }
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /login/{username}", func(w http.ResponseWriter, r *http.Request) {
+		user := auth.User{Username: r.PathValue("username")}
+		if err := auth.Login(r, w.(*sm.SessionResponseWriter), s.db, user); err != nil {
+			t.Errorf("error logging in. Err: %v", err)
+		}
+	})
+	mux.Handle("POST /admin/users/{username}/impersonate", s.adminOnly(s.ImpersonateHandler))
+	mux.Handle("POST /impersonate/stop", auth.AuthMiddleware(s.db, http.HandlerFunc(s.ImpersonateStopHandler)))
+	mux.Handle("POST /owner", s.ownerOnly(ok))
+	mux.Handle("POST /sensitive", s.sensitive(ok))
+
+	server := httptest.NewServer(s.sm.SessionMiddleware(mux))
+	t.Cleanup(server.Close)
+	return &accountTestServer{Server: server, store: st}
+}
+
+// client returns a client keeping the session cookie and not following redirects.
+func (ts *accountTestServer) client(t *testing.T) *http.Client {
+	t.Helper()
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatalf("error creating cookie jar. Err: %v", err)
+	}
+	return &http.Client{
+		Jar: jar,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// post sends a POST request and returns the response status.
+func (ts *accountTestServer) post(t *testing.T, client *http.Client, path string) int {
+	t.Helper()
+	resp, err := client.Post(ts.URL+path, "", nil)
+	if err != nil {
+		t.Fatalf("error posting to %s. Err: %v", path, err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestImpersonation(t *testing.T) {
+	ts := newAccountTestServer(t)
+	client := ts.client(t)
+	ts.post(t, client, "/login/admin")
+
+	steps := []struct {
+		name   string
+		path   string
+		status int
+	}{
+		{"admin is impersonated", "/admin/users/root/impersonate", http.StatusForbidden},
+		{"admin itself is impersonated", "/admin/users/admin/impersonate", http.StatusForbidden},
+		{"unknown user is impersonated", "/admin/users/nobody/impersonate", http.StatusNotFound},
+		{"user is impersonated", "/admin/users/alice/impersonate", http.StatusSeeOther},
+		{"impersonated user reaches admin routes", "/admin/users/alice/impersonate", http.StatusForbidden},
+		{"owner route while impersonating", "/owner", http.StatusForbidden},
+		{"sensitive route while impersonating", "/sensitive", http.StatusForbidden},
+		{"impersonation stops", "/impersonate/stop", http.StatusSeeOther},
+		{"owner route after impersonating", "/owner", http.StatusNoContent},
+		{"sensitive route without reauthentication", "/sensitive", http.StatusForbidden},
+		{"impersonation stops again", "/impersonate/stop", http.StatusBadRequest},
+	}
+	for _, step := range steps {
+		if status := ts.post(t, client, step.path); status != step.status {
+			t.Fatalf("%s: expected status %d; got %d", step.name, step.status, status)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package server
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/raziel-aleman/go-starter/internal/auth"
+	sm "github.com/raziel-aleman/go-starter/internal/session"
+)
+
+// InvitationCreateHandler mints an invitation code, valid for max_uses
+// registrations (default 1) until expires_in elapses (a duration such as
+// "72h", default 7 days). The code is only returned in this response.
+func (s *Server) InvitationCreateHandler(w http.ResponseWriter, r *http.Request) {
+	body := struct {
+		MaxUses   int    `json:"max_uses"`
+		ExpiresIn string `json:"expires_in"`
+	}{MaxUses: 1, ExpiresIn: "168h"}
+	// An empty body keeps the defaults
+	if err := readJSON(r, &body); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	ttl, err := time.ParseDuration(body.ExpiresIn)
+	if err != nil || ttl <= 0 || body.MaxUses < 1 {
+		http.Error(w, "max_uses must be positive and expires_in a positive duration", http.StatusBadRequest)
+		return
+	}
+
+	admin, _ := sm.GetSession(r).Get("username").(string)
+	invitation, err := auth.CreateInvitation(r.Context(), s.db, admin, body.MaxUses, ttl)
+	if err != nil {
+		s.log().ErrorContext(r.Context(), "Failed to create invitation", "err", err)
+		http.Error(w, "Failed to create invitation", http.StatusInternalServerError)
+		return
+	}
+
+	auth.RecordEvent(r, s.db, auth.EventInvitationCreated, admin, "max_uses="+strconv.Itoa(invitation.MaxUses))
+
+	writeJSON(w, http.StatusCreated, map[string]any{
+		"code":       invitation.Code,
+		"link":       s.baseURL() + "/register?invite=" + url.QueryEscape(invitation.Code),
+		"max_uses":   invitation.MaxUses,
+		"expires_at": invitation.ExpiresAt,
+	})
+}
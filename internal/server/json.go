@@ -0,0 +1,52 @@
+package server
+
+import (
+	"encoding/json"
+	"log/slog"
+	"mime"
+	"net/http"
+
+	"github.com/raziel-aleman/go-starter/internal/validate"
+)
+
+// writeJSON marshals v and writes it with the given status code.
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	resp, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, "Failed to marshal response", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if _, err := w.Write(resp); err != nil {
+		slog.Error("Failed to write response", "err", err)
+	}
+}
+
+// readJSON decodes the request body into v, rejecting unknown fields.
+func readJSON(r *http.Request, v any) error {
+	dec := json.NewDecoder(http.MaxBytesReader(nil, r.Body, 1<<20))
+	dec.DisallowUnknownFields()
+	return dec.Decode(v)
+}
+
+// decodeValid reads a JSON body into v and validates it against the rules of
+// its validate tags. It answers 400 to malformed bodies and 422 with the
+// errors of each field to invalid ones, and reports whether v can be used.
+func decodeValid(w http.ResponseWriter, r *http.Request, v any) bool {
+	if err := readJSON(r, v); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return false
+	}
+	if err := validate.Struct(v); err != nil {
+		writeJSON(w, http.StatusUnprocessableEntity, err)
+		return false
+	}
+	return true
+}
+
+// hasJSONBody reports whether the request body is a JSON document.
+func hasJSONBody(r *http.Request) bool {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return mediaType == "application/json"
+}
@@ -0,0 +1,133 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/raziel-aleman/go-starter/internal/requestid"
+	sm "github.com/raziel-aleman/go-starter/internal/session"
+)
+
+// newLogger reads LOG_FORMAT, text (default) or json, and LOG_LEVEL, one of
+// debug, info (default), warn, or error.
+func newLogger() (*slog.Logger, error) {
+	var level slog.Level
+	if value := os.Getenv("LOG_LEVEL"); value != "" {
+		if err := level.UnmarshalText([]byte(value)); err != nil {
+			return nil, fmt.Errorf("invalid LOG_LEVEL %q", value)
+		}
+	}
+	options := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler
+	switch format := envOr("LOG_FORMAT", "text"); format {
+	case "text":
+		handler = slog.NewTextHandler(os.Stderr, options)
+	case "json":
+		handler = slog.NewJSONHandler(os.Stderr, options)
+	default:
+		return nil, fmt.Errorf("invalid LOG_FORMAT %q, use text or json", format)
+	}
+	// Lines logged with a request context carry its request ID
+	return slog.New(requestid.NewHandler(handler)), nil
+}
+
+// log returns the logger of the server, or the default logger if unset.
+func (s *Server) log() *slog.Logger {
+	if s.logger == nil {
+		return slog.Default()
+	}
+	return s.logger
+}
+
+// requestLogKey is the context key of the requestLog of a request.
+type requestLogKey struct{}
+
+// requestLog holds the fields of a request log entry that are only known
+// within the session middleware.
+type requestLog struct {
+	session string // Digest of the session ID, which is a credential
+	user    string
+}
+
+// logRequests logs every request with its method, path, status, duration,
+// session, and user once it is served.
+func (s *Server) logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		entry := &requestLog{}
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		r = r.WithContext(context.WithValue(r.Context(), requestLogKey{}, entry))
+
+		next.ServeHTTP(recorder, r)
+
+		attrs := []slog.Attr{
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.Int("status", recorder.status),
+			slog.Duration("duration", time.Since(start)),
+		}
+		if entry.session != "" {
+			attrs = append(attrs, slog.String("session", entry.session))
+		}
+		if entry.user != "" {
+			attrs = append(attrs, slog.String("user", entry.user))
+		}
+		level := slog.LevelInfo
+		if recorder.status >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+		s.log().LogAttrs(r.Context(), level, "Request", attrs...)
+	})
+}
+
+// annotateRequestLog records the session and user of a request for
+// logRequests, after the handler since it may log the user in or out.
+func annotateRequestLog(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r)
+
+		entry, ok := r.Context().Value(requestLogKey{}).(*requestLog)
+		if !ok {
+			return
+		}
+		session := sm.GetSession(r)
+		if srw, ok := w.(*sm.SessionResponseWriter); ok && srw.Session != nil {
+			session = srw.Session // Replaced on login and logout
+		}
+		if !session.Ephemeral() {
+			digest := sha256.Sum256([]byte(session.ID))
+			entry.session = hex.EncodeToString(digest[:6])
+		}
+		entry.user, _ = session.Get("username").(string)
+	})
+}
+
+// statusRecorder captures the status code of a response.
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (rec *statusRecorder) WriteHeader(status int) {
+	if !rec.wroteHeader {
+		rec.status, rec.wroteHeader = status, true
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *statusRecorder) Write(b []byte) (int, error) {
+	rec.wroteHeader = true
+	return rec.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer, e.g. to flush.
+func (rec *statusRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
@@ -0,0 +1,73 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/raziel-aleman/go-starter/internal/auth"
+	sm "github.com/raziel-aleman/go-starter/internal/session"
+)
+
+// MagicLinkRequestHandler emails a login link to the submitted address.
+// It always responds 202 Accepted so the response does not reveal which
+// emails have an account.
+func (s *Server) MagicLinkRequestHandler(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Email string `json:"email"`
+	}
+	if err := readJSON(r, &body); err != nil || body.Email == "" {
+		http.Error(w, "Email is required", http.StatusBadRequest)
+		return
+	}
+
+	err := auth.RequestMagicLink(r.Context(), s.db, s.mailer, body.Email, s.baseURL())
+	if err != nil && !errors.Is(err, auth.ErrMagicLinkThrottled) {
+		s.log().ErrorContext(r.Context(), "Failed to send login link", "err", err)
+		http.Error(w, "Failed to send login link", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusAccepted, map[string]string{"status": "sent"})
+}
+
+// MagicLinkLoginHandler consumes the login link token and logs the user in by
+// migrating the session.
+func (s *Server) MagicLinkLoginHandler(w http.ResponseWriter, r *http.Request) {
+	user, err := auth.VerifyMagicLink(r.Context(), s.db, r.URL.Query().Get("token"))
+	if errors.Is(err, auth.ErrAccountDisabled) {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if errors.Is(err, auth.ErrInvalidMagicLink) {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		s.log().ErrorContext(r.Context(), "Failed to verify login link", "err", err)
+		http.Error(w, "Failed to verify login link", http.StatusInternalServerError)
+		return
+	}
+
+	srw, ok := w.(*sm.SessionResponseWriter)
+	if !ok {
+		http.Error(w, "Session not found", http.StatusInternalServerError)
+		return
+	}
+
+	// Users with two-factor authentication must confirm a code on /2fa/verify
+	if s.beginSecondFactor(w, r, user, "magic_link") {
+		return
+	}
+
+	if err := auth.Login(r, srw, s.db, user); err != nil {
+		s.log().ErrorContext(r.Context(), "Failed to log in", "username", user.Username, "err", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	srw.StatusCode = http.StatusSeeOther
+	srw.ResponseWriter.Header().Set("Location", "http://localhost:"+strconv.Itoa(s.port)+"/")
+
+	auth.RecordEvent(r, s.db, auth.EventLoginSuccess, user.Username, "magic_link")
+	s.log().InfoContext(r.Context(), "User logged in with a login link", "username", user.Username)
+}
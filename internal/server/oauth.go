@@ -0,0 +1,104 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/raziel-aleman/go-starter/internal/auth"
+	"github.com/raziel-aleman/go-starter/internal/auth/oauth"
+	sm "github.com/raziel-aleman/go-starter/internal/session"
+)
+
+// oauthLinkKey is the session key holding the provider being linked to the
+// logged-in user, instead of logging in with it.
+const oauthLinkKey = "oauth_link"
+
+// OAuthLoginHandler redirects the user to the identity provider.
+func (s *Server) OAuthLoginHandler(w http.ResponseWriter, r *http.Request) {
+	provider, ok := s.oauth[r.PathValue("provider")]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	authURL, err := oauth.BeginLogin(sm.GetSession(r), provider)
+	if err != nil {
+		s.log().ErrorContext(r.Context(), "Failed to start login", "err", err)
+		http.Error(w, "Failed to start login", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// OAuthCallbackHandler completes the login with the identity provider,
+// provisions the local user if needed, and migrates the session. If the login
+// was started to link the provider, the identity is linked to the logged-in
+// user instead.
+func (s *Server) OAuthCallbackHandler(w http.ResponseWriter, r *http.Request) {
+	provider, ok := s.oauth[r.PathValue("provider")]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	if errParam := r.URL.Query().Get("error"); errParam != "" {
+		http.Error(w, "Login cancelled: "+errParam, http.StatusUnauthorized)
+		return
+	}
+
+	session := sm.GetSession(r)
+	linking := session.Get(oauthLinkKey) == provider.Name()
+	session.Delete(oauthLinkKey)
+
+	identity, err := oauth.CompleteLogin(r.Context(), session, provider, r.URL.Query().Get("state"), r.URL.Query().Get("code"))
+	if err != nil {
+		s.log().ErrorContext(r.Context(), "Login failed", "err", err)
+		http.Error(w, "Login failed", http.StatusUnauthorized)
+		return
+	}
+
+	if linking {
+		s.linkIdentity(w, r, identity)
+		return
+	}
+
+	user, err := auth.ProvisionOAuthUser(r.Context(), s.db, identity)
+	if errors.Is(err, auth.ErrAccountDisabled) {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if errors.Is(err, auth.ErrEmailConflict) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		s.log().ErrorContext(r.Context(), "Failed to provision OAuth user", "provider", provider.Name(), "err", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	s.completeExternalLogin(w, r, user, provider.Name())
+}
+
+// completeExternalLogin logs in a user authenticated by an identity provider,
+// unless they must first confirm a second factor like after a password.
+func (s *Server) completeExternalLogin(w http.ResponseWriter, r *http.Request, user auth.User, method string) {
+	if srw, ok := w.(*sm.SessionResponseWriter); ok {
+		// Users with two-factor authentication must confirm a code on /2fa/verify
+		if s.beginSecondFactor(w, r, user, method) {
+			return
+		}
+		if err := auth.Login(r, srw, s.db, user); err != nil {
+			s.log().ErrorContext(r.Context(), "Failed to log in", "username", user.Username, "err", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		srw.StatusCode = http.StatusSeeOther
+		srw.ResponseWriter.Header().Set("Location", "http://localhost:"+strconv.Itoa(s.port)+"/")
+	}
+
+	auth.RecordEvent(r, s.db, auth.EventLoginSuccess, user.Username, method)
+	s.log().InfoContext(r.Context(), "User logged in with an identity provider", "method", method, "username", user.Username)
+}
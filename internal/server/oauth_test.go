@@ -0,0 +1,137 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+
+	"github.com/raziel-aleman/go-starter/internal/auth"
+	"github.com/raziel-aleman/go-starter/internal/auth/oauth"
+	"github.com/raziel-aleman/go-starter/internal/auth/totp"
+	"github.com/raziel-aleman/go-starter/internal/database/databasetest"
+	"github.com/raziel-aleman/go-starter/internal/ratelimit"
+	sm "github.com/raziel-aleman/go-starter/internal/session"
+	"github.com/raziel-aleman/go-starter/internal/store"
+)
+
+// testProvider is a provider whose token endpoint is a test server, issuing
+// tokens for the identity "alice".
+type testProvider struct {
+	config *oauth2.Config
+}
+
+func (p *testProvider) Name() string           { return "test" }
+func (p *testProvider) Config() *oauth2.Config { return p.config }
+func (p *testProvider) Identity(ctx context.Context, token *oauth2.Token) (*oauth.Identity, error) {
+	return &oauth.Identity{Subject: token.AccessToken}, nil
+}
+
+func newTestProvider(t *testing.T) *testProvider {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"access_token":"alice","token_type":"Bearer"}`))
+	}))
+	t.Cleanup(server.Close)
+	return &testProvider{config: &oauth2.Config{
+		ClientID: "client",
+		Endpoint: oauth2.Endpoint{AuthURL: server.URL + "/authorize", TokenURL: server.URL + "/token"},
+	}}
+}
+
+func TestOAuthLoginRequiresSecondFactor(t *testing.T) {
+	s := &Server{
+		sm:           sm.NewSessionManager(store.NewInMemorySessionStore(), "GOSESSID", time.Hour, time.Hour),
+		db:           databasetest.New(t),
+		oauth:        oauth.NewRegistry(newTestProvider(t)),
+		loginLimiter: auth.NewLoginLimiter(ratelimit.NewMemoryStore(), 20, 5, time.Minute),
+	}
+	t.Cleanup(s.sm.Close)
+	s.sm.CSRFMethods = nil
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /auth/{provider}/login", s.OAuthLoginHandler)
+	mux.HandleFunc("GET /auth/{provider}/callback", s.OAuthCallbackHandler)
+	mux.HandleFunc("POST /2fa/verify", s.TwoFactorVerifyHandler)
+	mux.Handle("GET /me", auth.AuthMiddleware(s.db, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})))
+	server := httptest.NewServer(s.sm.SessionMiddleware(mux))
+	t.Cleanup(server.Close)
+
+	// login goes through the provider with a new client and returns it with
+	// the status of the callback
+	login := func() (*http.Client, int) {
+		jar, _ := cookiejar.New(nil)
+		client := &http.Client{Jar: jar, CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		}}
+		resp, err := client.Get(server.URL + "/auth/test/login")
+		if err != nil {
+			t.Fatalf("error starting login. Err: %v", err)
+		}
+		resp.Body.Close()
+		authURL, err := url.Parse(resp.Header.Get("Location"))
+		if err != nil {
+			t.Fatalf("error parsing authorization URL. Err: %v", err)
+		}
+		resp, err = client.Get(server.URL + "/auth/test/callback?code=code&state=" + url.QueryEscape(authURL.Query().Get("state")))
+		if err != nil {
+			t.Fatalf("error completing login. Err: %v", err)
+		}
+		resp.Body.Close()
+		return client, resp.StatusCode
+	}
+	loggedIn := func(client *http.Client) bool {
+		resp, err := client.Get(server.URL + "/me")
+		if err != nil {
+			t.Fatalf("error getting /me. Err: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode == http.StatusNoContent
+	}
+
+	// The first login provisions the user
+	client, status := login()
+	if status != http.StatusSeeOther || !loggedIn(client) {
+		t.Fatalf("expected to be logged in; got status %d", status)
+	}
+
+	ctx := context.Background()
+	secret, _, err := auth.BeginTOTPEnrollment(ctx, s.db, "test:alice", "test", "")
+	if err != nil {
+		t.Fatalf("error beginning enrollment. Err: %v", err)
+	}
+	code, _ := totp.Code(secret, time.Now())
+	if _, err := auth.EnableTOTP(ctx, s.db, "test:alice", code); err != nil {
+		t.Fatalf("error enabling TOTP. Err: %v", err)
+	}
+
+	// With two-factor authentication, the provider is not enough
+	client, status = login()
+	if status != http.StatusAccepted {
+		t.Fatalf("expected status %d; got %d", http.StatusAccepted, status)
+	}
+	if loggedIn(client) {
+		t.Fatalf("expected the login to await a second factor")
+	}
+
+	next, _ := totp.Code(secret, time.Now().Add(totp.Period))
+	body, _ := json.Marshal(map[string]string{"code": next})
+	resp, err := client.Post(server.URL+"/2fa/verify", "application/json", strings.NewReader(string(body)))
+	if err != nil {
+		t.Fatalf("error verifying code. Err: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !loggedIn(client) {
+		t.Errorf("expected to be logged in after the second factor; got status %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,53 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/raziel-aleman/go-starter/internal/auth"
+	sm "github.com/raziel-aleman/go-starter/internal/session"
+)
+
+// OAuthClientCreateHandler registers a third-party OAuth client. Confidential
+// clients get a secret, only returned in this response; public clients, such
+// as single-page or mobile apps, must rely on PKCE alone.
+func (s *Server) OAuthClientCreateHandler(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Name         string   `json:"name"`
+		RedirectURIs []string `json:"redirect_uris"`
+		Scopes       []string `json:"scopes"`
+		Confidential bool     `json:"confidential"`
+	}
+	if err := readJSON(r, &body); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if body.Name == "" || len(body.RedirectURIs) == 0 || len(body.Scopes) == 0 {
+		http.Error(w, "name, redirect_uris and scopes are required", http.StatusBadRequest)
+		return
+	}
+	if err := auth.ValidateScopes(body.Scopes); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	admin, _ := sm.GetSession(r).Get("username").(string)
+	client, secret, err := s.oauthServer.RegisterClient(r.Context(), body.Name, body.RedirectURIs, body.Scopes, body.Confidential, admin)
+	if err != nil {
+		s.log().ErrorContext(r.Context(), "Failed to register client", "err", err)
+		http.Error(w, "Failed to register client", http.StatusBadRequest)
+		return
+	}
+
+	auth.RecordEvent(r, s.db, auth.EventOAuthClientCreated, admin, "client="+client.ID)
+
+	response := map[string]any{
+		"client_id":     client.ID,
+		"name":          client.Name,
+		"redirect_uris": client.RedirectURIs,
+		"scopes":        client.Scopes,
+	}
+	if secret != "" {
+		response["client_secret"] = secret
+	}
+	writeJSON(w, http.StatusCreated, response)
+}
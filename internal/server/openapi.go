@@ -0,0 +1,99 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/raziel-aleman/go-starter/internal/database"
+	"github.com/raziel-aleman/go-starter/internal/jwt"
+	"github.com/raziel-aleman/go-starter/internal/openapi"
+	"github.com/raziel-aleman/go-starter/internal/validate"
+)
+
+// Security schemes of the documented operations.
+const (
+	sessionAuth = "session"
+	bearerAuth  = "bearer"
+	apiKeyAuth  = "apiKey"
+)
+
+// newAPIRegistry returns the registry documenting the API routes of mux.
+func (s *Server) newAPIRegistry(mux *http.ServeMux) *openapi.Registry {
+	api := openapi.NewRegistry(mux, "go-starter API", "1.0.0")
+	api.Description = "State-changing requests authenticated by the session cookie must send the CSRF token returned by GET /csrf-token in the " + s.sm.CSRFHeaderName + " header."
+	api.SecuritySchemes = map[string]openapi.SecurityScheme{
+		sessionAuth: {Type: "apiKey", In: "cookie", Name: s.sm.CookieName},
+		bearerAuth:  {Type: "http", Scheme: "bearer", Description: "Access token issued by POST /token, or API key"},
+		apiKeyAuth:  {Type: "apiKey", In: "header", Name: "Authorization", Description: `API key sent as "ApiKey <key>"`},
+	}
+	return api
+}
+
+// errorResponses describes the error responses of an operation, whose
+// bodies are plain text messages.
+func errorResponses(responses map[int]openapi.Response, statuses ...int) map[int]openapi.Response {
+	for _, status := range statuses {
+		responses[status] = openapi.Response{}
+	}
+	return responses
+}
+
+// Operations of the routes registered both for browsers and in the versioned
+// API, which accept different security schemes.
+var (
+	healthOperation = openapi.Operation{
+		Summary:   "Report the health of the database",
+		Tags:      []string{"health"},
+		Responses: map[int]openapi.Response{200: {Body: database.HealthStatus{}}, 503: {Body: database.HealthStatus{}}},
+	}
+
+	tokenOperation = openapi.Operation{
+		Summary: "Exchange credentials for an access and refresh token pair",
+		Tags:    []string{"tokens"},
+		Request: tokenRequest{},
+		Responses: errorResponses(map[int]openapi.Response{
+			200: {Body: jwt.TokenPair{}},
+			422: {Body: validate.Errors{}},
+		}, 400, 401, 403, 429),
+	}
+
+	tokenRefreshOperation = openapi.Operation{
+		Summary:   "Rotate a refresh token",
+		Tags:      []string{"tokens"},
+		Request:   refreshRequest{},
+		Responses: errorResponses(map[int]openapi.Response{200: {Body: jwt.TokenPair{}}}, 400, 401),
+	}
+
+	tokenRevokeOperation = openapi.Operation{
+		Summary:   "Revoke a refresh token and the tokens rotated from it",
+		Tags:      []string{"tokens"},
+		Request:   refreshRequest{},
+		Responses: errorResponses(map[int]openapi.Response{204: {}}, 400),
+	}
+
+	meOperation = openapi.Operation{
+		Description: "Scoped tokens require the users:read scope.",
+		Summary:     "Get the profile of the logged-in user",
+		Tags:        []string{"account"},
+		Responses:   errorResponses(map[int]openapi.Response{200: {Body: meResponse{}}}, 403),
+	}
+
+	apiKeysOperation = openapi.Operation{
+		Description: "Scoped tokens require the apikeys:read scope.",
+		Summary:     "List the API keys of the logged-in user",
+		Tags:        []string{"api keys"},
+		Responses:   errorResponses(map[int]openapi.Response{200: {Body: []database.APIKey{}}}, 403),
+	}
+
+	apiKeyRevokeOperation = openapi.Operation{
+		Description: "Scoped tokens require the apikeys:write scope.",
+		Summary:     "Revoke an API key of the logged-in user",
+		Tags:        []string{"api keys"},
+		Responses:   errorResponses(map[int]openapi.Response{204: {}}, 403, 404),
+	}
+)
+
+// withSecurity returns a copy of op accepting the security schemes.
+func withSecurity(op openapi.Operation, schemes ...string) openapi.Operation {
+	op.Security = schemes
+	return op
+}
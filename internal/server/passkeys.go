@@ -0,0 +1,92 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/raziel-aleman/go-starter/internal/auth"
+	"github.com/raziel-aleman/go-starter/internal/auth/webauthn"
+	sm "github.com/raziel-aleman/go-starter/internal/session"
+)
+
+// PasskeyRegisterBeginHandler returns the options to create a passkey for the logged-in user.
+func (s *Server) PasskeyRegisterBeginHandler(w http.ResponseWriter, r *http.Request) {
+	username, _ := sm.GetSession(r).Get("username").(string)
+
+	opts, err := auth.BeginPasskeyRegistration(r, s.db, s.webauthn, username)
+	if err != nil {
+		s.log().ErrorContext(r.Context(), "Failed to start passkey registration", "err", err)
+		http.Error(w, "Failed to start passkey registration", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{"publicKey": opts})
+}
+
+// PasskeyRegisterFinishHandler verifies and stores the passkey created by the browser.
+func (s *Server) PasskeyRegisterFinishHandler(w http.ResponseWriter, r *http.Request) {
+	var resp webauthn.RegistrationResponse
+	if err := readJSON(r, &resp); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	err := auth.FinishPasskeyRegistration(r, s.db, s.webauthn, &resp)
+	if errors.Is(err, webauthn.ErrNoCeremony) || errors.Is(err, webauthn.ErrVerification) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		s.log().ErrorContext(r.Context(), "Failed to register passkey", "err", err)
+		http.Error(w, "Failed to register passkey", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+}
+
+// PasskeyLoginBeginHandler returns the options to sign in with a discoverable passkey.
+func (s *Server) PasskeyLoginBeginHandler(w http.ResponseWriter, r *http.Request) {
+	opts, err := s.webauthn.BeginLogin(sm.GetSession(r), nil)
+	if err != nil {
+		s.log().ErrorContext(r.Context(), "Failed to start passkey login", "err", err)
+		http.Error(w, "Failed to start passkey login", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{"publicKey": opts})
+}
+
+// PasskeyLoginFinishHandler verifies the passkey assertion and logs the user in.
+func (s *Server) PasskeyLoginFinishHandler(w http.ResponseWriter, r *http.Request) {
+	var resp webauthn.AssertionResponse
+	if err := readJSON(r, &resp); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	srw, ok := w.(*sm.SessionResponseWriter)
+	if !ok {
+		http.Error(w, "Session not found", http.StatusInternalServerError)
+		return
+	}
+
+	user, err := auth.FinishPasskeyLogin(r, srw, s.db, s.webauthn, &resp)
+	if errors.Is(err, auth.ErrAccountDisabled) {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if errors.Is(err, auth.ErrUnknownPasskey) || errors.Is(err, webauthn.ErrNoCeremony) || errors.Is(err, webauthn.ErrVerification) {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		s.log().ErrorContext(r.Context(), "Failed to log in with a passkey", "err", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	auth.RecordEvent(r, s.db, auth.EventLoginSuccess, user.Username, "passkey")
+	s.log().InfoContext(r.Context(), "User logged in with a passkey", "username", user.Username)
+	writeJSON(w, http.StatusOK, user)
+}
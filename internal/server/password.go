@@ -0,0 +1,65 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/raziel-aleman/go-starter/internal/auth"
+	sm "github.com/raziel-aleman/go-starter/internal/session"
+)
+
+// passwordChangeRequest is the body of the change password endpoint.
+type passwordChangeRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+// passwordChangeStatus is the response of the change password status endpoint.
+type passwordChangeStatus struct {
+	PasswordExpired bool `json:"password_expired"`
+}
+
+// PasswordChangeStatusHandler reports whether the session must change its
+// password. Sessions with an expired password are redirected here.
+func (s *Server) PasswordChangeStatusHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, passwordChangeStatus{
+		PasswordExpired: auth.PasswordChangeRequired(sm.GetSession(r)),
+	})
+}
+
+// PasswordChangeHandler changes the password of the logged-in user, rotates
+// the session ID, and logs out every other session of the user.
+func (s *Server) PasswordChangeHandler(w http.ResponseWriter, r *http.Request) {
+	var req passwordChangeRequest
+	if err := readJSON(r, &req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	srw, ok := w.(*sm.SessionResponseWriter)
+	if !ok {
+		http.Error(w, "Session not found", http.StatusInternalServerError)
+		return
+	}
+
+	username, _ := sm.GetSession(r).Get("username").(string)
+	err := auth.ChangePassword(r, srw, s.db, s.passwordPolicy, req.CurrentPassword, req.NewPassword)
+	var policyErr *auth.PasswordPolicyError
+	if errors.As(err, &policyErr) {
+		writeJSON(w, http.StatusUnprocessableEntity, policyErr)
+		return
+	}
+	if errors.Is(err, auth.ErrWrongPassword) {
+		auth.RecordEvent(r, s.db, auth.EventLoginFailure, username, "password_change")
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		s.log().ErrorContext(r.Context(), "Failed to change password", "err", err)
+		http.Error(w, "Failed to change password", http.StatusInternalServerError)
+		return
+	}
+
+	auth.RecordEvent(r, s.db, auth.EventPasswordChange, username, "")
+	w.WriteHeader(http.StatusNoContent)
+}
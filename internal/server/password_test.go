@@ -0,0 +1,96 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/raziel-aleman/go-starter/internal/auth"
+	"github.com/raziel-aleman/go-starter/internal/auth/oauthserver"
+	"github.com/raziel-aleman/go-starter/internal/database/databasetest"
+	"github.com/raziel-aleman/go-starter/internal/jwt"
+	"github.com/raziel-aleman/go-starter/internal/ratelimit"
+	sm "github.com/raziel-aleman/go-starter/internal/session"
+	"github.com/raziel-aleman/go-starter/internal/store"
+)
+
+func TestExpiredPassword(t *testing.T) {
+	tokens := jwt.NewManager([]byte("secret"), time.Minute, time.Hour, jwt.NewInMemoryRefreshStore())
+	s := &Server{
+		sm:           sm.NewSessionManager(store.NewInMemorySessionStore(), "GOSESSID", time.Hour, time.Hour),
+		db:           databasetest.New(t, databasetest.User("alice", "password")),
+		tokens:       tokens,
+		oauthServer:  oauthserver.New(oauthserver.NewInMemoryStore(), tokens),
+		loginLimiter: auth.NewLoginLimiter(ratelimit.NewMemoryStore(), 20, 5, time.Minute),
+		// Every password is expired as soon as it is set
+		passwordPolicy: auth.PasswordPolicy{MaxAge: time.Nanosecond},
+	}
+	t.Cleanup(s.sm.Close)
+	s.sm.CSRFMethods = nil
+	server := httptest.NewServer(s.RegisterRoutes())
+	t.Cleanup(server.Close)
+
+	jar, _ := cookiejar.New(nil)
+	client := &http.Client{
+		Jar: jar,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	post := func(path, body string) *http.Response {
+		t.Helper()
+		resp, err := client.Post(server.URL+path, "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("error requesting %s. Err: %v", path, err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+
+	// Tokens are refused, they could not be limited to changing the password
+	for _, path := range []string{"/token", apiPrefix + "token"} {
+		if resp := post(path, `{"username":"alice","password":"password"}`); resp.StatusCode != http.StatusForbidden {
+			t.Errorf("expected status %d from %s; got %d", http.StatusForbidden, path, resp.StatusCode)
+		}
+	}
+
+	// The home page starts a guest session, which logs in
+	resp, err := client.Get(server.URL + "/")
+	if err != nil {
+		t.Fatalf("error requesting /. Err: %v", err)
+	}
+	resp.Body.Close()
+	if resp := post("/login", `{"username":"alice","password":"password"}`); resp.StatusCode != http.StatusSeeOther {
+		t.Fatalf("expected status %d from login; got %d", http.StatusSeeOther, resp.StatusCode)
+	}
+
+	// The versioned API redirects to the change password flow like the pages
+	for _, path := range []string{"/me", apiPrefix + "me", apiPrefix + "apikeys"} {
+		resp, err := client.Get(server.URL + path)
+		if err != nil {
+			t.Fatalf("error requesting %s. Err: %v", path, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusSeeOther || resp.Header.Get("Location") != "/password/change" {
+			t.Errorf("expected %s to redirect to /password/change; got %d to %q", path, resp.StatusCode, resp.Header.Get("Location"))
+		}
+	}
+
+	// The redirect lands on a route reporting the expired password
+	resp, err = client.Get(server.URL + "/password/change")
+	if err != nil {
+		t.Fatalf("error requesting /password/change. Err: %v", err)
+	}
+	defer resp.Body.Close()
+	var status passwordChangeStatus
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		t.Fatalf("error decoding password change status. Err: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK || !status.PasswordExpired {
+		t.Errorf("expected status %d with an expired password; got %d with %+v", http.StatusOK, resp.StatusCode, status)
+	}
+}
@@ -0,0 +1,43 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/raziel-aleman/go-starter/internal/auth"
+)
+
+// RolePermissionsHandler lists the permissions granted to a role.
+func (s *Server) RolePermissionsHandler(w http.ResponseWriter, r *http.Request) {
+	permissions, err := s.db.RolePermissions(r.Context(), r.PathValue("role"))
+	if err != nil {
+		s.log().ErrorContext(r.Context(), "Failed to list permissions", "err", err)
+		http.Error(w, "Failed to list permissions", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, permissions)
+}
+
+// RolePermissionGrantHandler allows a role to perform an action on a resource.
+func (s *Server) RolePermissionGrantHandler(w http.ResponseWriter, r *http.Request) {
+	err := auth.GrantPermission(r.Context(), s.db, r.PathValue("role"), r.PathValue("action"), r.PathValue("resource"))
+	if err != nil {
+		s.log().ErrorContext(r.Context(), "Failed to grant permission", "err", err)
+		http.Error(w, "Failed to grant permission", http.StatusBadRequest)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RolePermissionRevokeHandler removes a permission from a role.
+func (s *Server) RolePermissionRevokeHandler(w http.ResponseWriter, r *http.Request) {
+	err := auth.RevokePermission(r.Context(), s.db, r.PathValue("role"), r.PathValue("action"), r.PathValue("resource"))
+	if err != nil {
+		s.log().ErrorContext(r.Context(), "Failed to revoke permission", "err", err)
+		http.Error(w, "Failed to revoke permission", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,110 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/raziel-aleman/go-starter/internal/auth"
+	"github.com/raziel-aleman/go-starter/internal/database"
+	sm "github.com/raziel-aleman/go-starter/internal/session"
+)
+
+// meResponse is the profile of the logged-in user.
+type meResponse struct {
+	auth.User
+	ImpersonatedBy string `json:"impersonated_by,omitempty"`
+}
+
+// MeHandler returns the profile of the logged-in user, and the admin
+// impersonating it if any, so clients can show a banner.
+func (s *Server) MeHandler(w http.ResponseWriter, r *http.Request) {
+	username := callerName(r)
+
+	user, err := auth.GetProfile(r.Context(), s.db, username)
+	if err != nil {
+		s.log().ErrorContext(r.Context(), "Failed to retrieve profile", "err", err)
+		http.Error(w, "Failed to retrieve profile", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, meResponse{user, auth.Impersonator(r)})
+}
+
+// MeUpdateHandler changes the profile fields present in the request body. A
+// new email address must be verified again, a verification link is sent to it.
+func (s *Server) MeUpdateHandler(w http.ResponseWriter, r *http.Request) {
+	var update auth.ProfileUpdate
+	if err := readJSON(r, &update); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	username, _ := sm.GetSession(r).Get("username").(string)
+
+	before, err := auth.GetProfile(r.Context(), s.db, username)
+	if err != nil {
+		s.log().ErrorContext(r.Context(), "Failed to retrieve profile", "err", err)
+		http.Error(w, "Failed to retrieve profile", http.StatusInternalServerError)
+		return
+	}
+
+	user, err := auth.UpdateProfile(r.Context(), s.db, username, update)
+	var profileErr *auth.ProfileError
+	if errors.As(err, &profileErr) {
+		writeJSON(w, http.StatusUnprocessableEntity, profileErr)
+		return
+	}
+	if errors.Is(err, database.ErrEmailTaken) {
+		http.Error(w, "Email already in use", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		s.log().ErrorContext(r.Context(), "Failed to update profile", "err", err)
+		http.Error(w, "Failed to update profile", http.StatusInternalServerError)
+		return
+	}
+
+	if user.Email != "" && user.Email != before.Email {
+		if err := auth.RequestEmailVerification(r.Context(), s.db, s.mailer, user, s.baseURL()); err != nil {
+			s.log().ErrorContext(r.Context(), "Failed to send verification email", "username", user.Username, "err", err)
+		}
+	}
+
+	writeJSON(w, http.StatusOK, user)
+}
+
+// accountDeleteRequest is the body of the account deletion endpoint.
+type accountDeleteRequest struct {
+	Password string `json:"password"`
+	Code     string `json:"code,omitempty"` // Two-factor code, if enabled
+}
+
+// MeDeleteHandler deletes the account of the logged-in user and all its sessions.
+func (s *Server) MeDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	var req accountDeleteRequest
+	if err := readJSON(r, &req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	srw, ok := w.(*sm.SessionResponseWriter)
+	if !ok {
+		http.Error(w, "Session not found", http.StatusInternalServerError)
+		return
+	}
+
+	username, err := auth.DeleteAccount(r, srw, s.db, req.Password, req.Code)
+	if errors.Is(err, auth.ErrWrongPassword) || errors.Is(err, auth.ErrInvalidTwoFactorCode) {
+		auth.RecordEvent(r, s.db, auth.EventLoginFailure, username, "account_deletion")
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		s.log().ErrorContext(r.Context(), "Failed to delete account", "err", err)
+		http.Error(w, "Failed to delete account", http.StatusInternalServerError)
+		return
+	}
+
+	auth.RecordEvent(r, s.db, auth.EventAccountDeleted, username, "")
+	s.log().InfoContext(r.Context(), "Account deleted, sessions destroyed", "username", username)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,142 @@
+package server
+
+import (
+	"fmt"
+	"maps"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/raziel-aleman/go-starter/internal/auth"
+	"github.com/raziel-aleman/go-starter/internal/ratelimit"
+)
+
+// rateLimitStore keeps both the fixed windows of the login limits and the
+// token buckets of the request limits.
+type rateLimitStore interface {
+	ratelimit.Store
+	ratelimit.BucketStore
+}
+
+// newRequestLimiter reads RATE_LIMIT_RPS, the requests per second allowed
+// per client IP on average (default 20, 0 to disable), and RATE_LIMIT_BURST,
+// the requests allowed at once (default twice the rate).
+func newRequestLimiter(store ratelimit.BucketStore) (*ratelimit.TokenBucket, error) {
+	rate := 20.0
+	if value := os.Getenv("RATE_LIMIT_RPS"); value != "" {
+		var err error
+		if rate, err = strconv.ParseFloat(value, 64); err != nil || rate < 0 || math.IsInf(rate, 0) {
+			return nil, fmt.Errorf("invalid RATE_LIMIT_RPS %q", value)
+		}
+	}
+	if rate == 0 {
+		return nil, nil
+	}
+	burst := int(math.Ceil(2 * rate))
+	if value := os.Getenv("RATE_LIMIT_BURST"); value != "" {
+		var err error
+		if burst, err = strconv.Atoi(value); err != nil || burst < 1 {
+			return nil, fmt.Errorf("invalid RATE_LIMIT_BURST %q", value)
+		}
+	}
+	return ratelimit.NewTokenBucket(store, "requests:", rate, burst), nil
+}
+
+// routeLimit is the rate limit of a route per client IP.
+type routeLimit struct {
+	Rate  float64 // Requests per second on average
+	Burst int     // Requests allowed at once
+}
+
+// defaultRouteLimits are stricter than the request limit on the routes
+// checking credentials or sending email, by mux pattern.
+var defaultRouteLimits = map[string]routeLimit{
+	"/login":                      {Rate: 0.2, Burst: 5},
+	"/register":                   {Rate: 0.05, Burst: 3},
+	"POST /token":                 {Rate: 0.2, Burst: 5},
+	"POST /api/v1/token":          {Rate: 0.2, Burst: 5},
+	"POST /oauth/token":           {Rate: 1, Burst: 10},
+	"POST /2fa/verify":            {Rate: 0.2, Burst: 5},
+	"POST /login/magic":           {Rate: 0.05, Burst: 3},
+	"POST /webauthn/login/finish": {Rate: 0.2, Burst: 5},
+	"POST /reauth":                {Rate: 0.2, Burst: 5},
+}
+
+// newRouteLimiters creates the limiters of the routes, the defaults changed
+// by RATE_LIMIT_ROUTES: a comma-separated list of pattern=rate:burst, where
+// pattern is a route as registered, e.g. "POST /token=1:10", and a rate of 0
+// removes the limit of the route.
+func newRouteLimiters(store ratelimit.BucketStore) (map[string]*ratelimit.TokenBucket, error) {
+	limits := maps.Clone(defaultRouteLimits)
+	if value := os.Getenv("RATE_LIMIT_ROUTES"); value != "" {
+		for _, item := range splitList(value) {
+			i := strings.LastIndex(item, "=")
+			rate, burst, ok := strings.Cut(item[i+1:], ":")
+			limit := routeLimit{}
+			var rateErr, burstErr error
+			limit.Rate, rateErr = strconv.ParseFloat(rate, 64)
+			if ok {
+				limit.Burst, burstErr = strconv.Atoi(burst)
+			}
+			if i <= 0 || rateErr != nil || burstErr != nil || limit.Rate < 0 || math.IsInf(limit.Rate, 0) || (limit.Rate > 0 && limit.Burst < 1) {
+				return nil, fmt.Errorf("invalid RATE_LIMIT_ROUTES item %q, use pattern=rate:burst", item)
+			}
+			if limit.Rate == 0 {
+				delete(limits, strings.TrimSpace(item[:i]))
+				continue
+			}
+			limits[strings.TrimSpace(item[:i])] = limit
+		}
+	}
+
+	limiters := make(map[string]*ratelimit.TokenBucket, len(limits))
+	for pattern, limit := range limits {
+		limiters[pattern] = ratelimit.NewTokenBucket(store, "route:"+pattern+":", limit.Rate, limit.Burst)
+	}
+	return limiters, nil
+}
+
+// rateLimit responds 429 Too Many Requests with a Retry-After header to
+// clients exceeding the request rate of their IP address.
+func (s *Server) rateLimit(next http.Handler) http.Handler {
+	if s.requestLimiter == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.allowRequest(w, r, s.requestLimiter) {
+			next.ServeHTTP(w, r)
+		}
+	})
+}
+
+// rateLimitRoutes applies the limit of the route mux matches, if any, on top
+// of the request limit.
+func (s *Server) rateLimitRoutes(mux *http.ServeMux) http.Handler {
+	if len(s.routeLimiters) == 0 {
+		return mux
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, pattern := mux.Handler(r)
+		if limiter := s.routeLimiters[pattern]; limiter == nil || s.allowRequest(w, r, limiter) {
+			mux.ServeHTTP(w, r)
+		}
+	})
+}
+
+// allowRequest takes a token of the client IP from limiter, or responds 429
+// and reports false if there is none. Requests are let through when the
+// store fails, so an unavailable Redis does not take the whole server down.
+func (s *Server) allowRequest(w http.ResponseWriter, r *http.Request, limiter *ratelimit.TokenBucket) bool {
+	allowed, retryAfter, err := limiter.Allow(r.Context(), auth.ClientIP(r))
+	if err != nil {
+		s.log().ErrorContext(r.Context(), "Failed to check request rate limit", "err", err)
+		return true
+	}
+	if !allowed {
+		w.Header().Set("Retry-After", strconv.Itoa(max(1, int(math.Ceil(retryAfter.Seconds())))))
+		http.Error(w, "Too many requests", http.StatusTooManyRequests)
+	}
+	return allowed
+}
@@ -0,0 +1,41 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/raziel-aleman/go-starter/internal/auth"
+	sm "github.com/raziel-aleman/go-starter/internal/session"
+)
+
+// reauthRequest is the body of the reauthentication endpoint, with either the
+// password or a two-factor code.
+type reauthRequest struct {
+	Password string `json:"password,omitempty"`
+	Code     string `json:"code,omitempty"`
+}
+
+// ReauthHandler confirms the identity of the logged-in user before sensitive
+// actions guarded by RequireRecentAuth.
+func (s *Server) ReauthHandler(w http.ResponseWriter, r *http.Request) {
+	var req reauthRequest
+	if err := readJSON(r, &req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	username, _ := sm.GetSession(r).Get("username").(string)
+	err := auth.Reauthenticate(r, s.db, req.Password, req.Code)
+	if errors.Is(err, auth.ErrWrongPassword) || errors.Is(err, auth.ErrInvalidTwoFactorCode) {
+		auth.RecordEvent(r, s.db, auth.EventLoginFailure, username, "reauth")
+		http.Error(w, "Invalid credentials", http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		s.log().ErrorContext(r.Context(), "Failed to reauthenticate", "err", err)
+		http.Error(w, "Failed to reauthenticate", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,47 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestRequireRecentAuth(t *testing.T) {
+	ts := newAccountTestServer(t)
+	client := ts.client(t)
+	ts.post(t, client, "/login/alice")
+
+	if status := ts.post(t, client, "/sensitive"); status != http.StatusNoContent {
+		t.Fatalf("expected status %d after logging in; got %d", http.StatusNoContent, status)
+	}
+
+	// Age the authentication of the session past the maximum
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("error parsing server URL. Err: %v", err)
+	}
+	var id string
+	for _, c := range client.Jar.Cookies(u) {
+		if c.Name == "GOSESSID" {
+			id = c.Value
+		}
+	}
+	ctx := context.Background()
+	session, err := ts.store.Read(ctx, id)
+	if err != nil {
+		t.Fatalf("error reading session. Err: %v", err)
+	}
+	session.Put("authenticated_at", time.Now().Add(-time.Hour).UTC().Format(time.RFC3339))
+	if err := ts.store.Write(ctx, session); err != nil {
+		t.Fatalf("error writing session. Err: %v", err)
+	}
+
+	if status := ts.post(t, client, "/sensitive"); status != http.StatusForbidden {
+		t.Errorf("expected status %d with a stale authentication; got %d", http.StatusForbidden, status)
+	}
+	if status := ts.post(t, client, "/owner"); status != http.StatusNoContent {
+		t.Errorf("expected status %d on routes not requiring a recent authentication; got %d", http.StatusNoContent, status)
+	}
+}
@@ -0,0 +1,56 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/raziel-aleman/go-starter/internal/auth"
+)
+
+// UserRolesHandler lists the roles of a user.
+func (s *Server) UserRolesHandler(w http.ResponseWriter, r *http.Request) {
+	username, ok := s.pathUsername(w, r)
+	if !ok {
+		return
+	}
+
+	roles, err := s.db.UserRoles(r.Context(), username)
+	if err != nil {
+		s.log().ErrorContext(r.Context(), "Failed to list roles", "err", err)
+		http.Error(w, "Failed to list roles", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, roles)
+}
+
+// UserRoleAssignHandler grants a role to a user.
+func (s *Server) UserRoleAssignHandler(w http.ResponseWriter, r *http.Request) {
+	username, ok := s.pathUsername(w, r)
+	if !ok {
+		return
+	}
+
+	if err := auth.AssignRole(r.Context(), s.db, username, r.PathValue("role")); err != nil {
+		s.log().ErrorContext(r.Context(), "Failed to assign role", "err", err)
+		http.Error(w, "Failed to assign role", http.StatusBadRequest)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// UserRoleRemoveHandler revokes a role from a user.
+func (s *Server) UserRoleRemoveHandler(w http.ResponseWriter, r *http.Request) {
+	username, ok := s.pathUsername(w, r)
+	if !ok {
+		return
+	}
+
+	if err := auth.RemoveRole(r.Context(), s.db, username, r.PathValue("role")); err != nil {
+		s.log().ErrorContext(r.Context(), "Failed to remove role", "err", err)
+		http.Error(w, "Failed to remove role", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
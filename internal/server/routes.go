@@ -2,58 +2,323 @@ package server
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
 	"net/http"
 	"strconv"
 	"time"
 
 	"github.com/raziel-aleman/go-starter/internal/auth"
+	"github.com/raziel-aleman/go-starter/internal/database"
+	"github.com/raziel-aleman/go-starter/internal/openapi"
+	"github.com/raziel-aleman/go-starter/internal/requestid"
 	sm "github.com/raziel-aleman/go-starter/internal/session"
+	"github.com/raziel-aleman/go-starter/internal/validate"
 )
 
 func (s *Server) RegisterRoutes() http.Handler {
 	mux := http.NewServeMux()
 
+	// API routes are registered through the registry, which documents them
+	api := s.newAPIRegistry(mux)
+
+	mux.Handle("GET /openapi.json", api)
+
+	mux.Handle("GET /docs", openapi.UIHandler(api.Title, "/openapi.json"))
+
 	// Register public routes
 	mux.HandleFunc("/home", s.HelloWorldHandler)
 
-	mux.HandleFunc("/health", s.HealthHandler)
+	api.HandleFunc("/health", s.HealthHandler, healthOperation)
+
+	mux.Handle("GET /metrics", s.internalOnly(s.MetricsHandler))
 
 	mux.HandleFunc("/", s.HomeHandler)
 
 	mux.HandleFunc("/logout", s.LogoutHandler)
 
-	mux.HandleFunc("/debug", s.DebugSessionHandler)
+	mux.Handle("/debug", s.internalOnly(s.DebugSessionHandler))
 
 	mux.HandleFunc("/login", s.LoginHandler)
 
+	api.Describe("POST /login", openapi.Operation{
+		Summary: "Log in with a username or email address and a password",
+		Tags:    []string{"auth"},
+		Request: loginRequest{},
+		Responses: errorResponses(map[int]openapi.Response{
+			303: {Description: "Logged in"},
+			202: {Description: "Two-factor code required on /2fa/verify", Body: map[string]string{}},
+			422: {Body: validate.Errors{}},
+		}, 400, 429),
+	})
+
 	mux.HandleFunc("/register", s.RegisterHandler)
 
+	api.Describe("POST /register", openapi.Operation{
+		Summary: "Register a new user and log in",
+		Tags:    []string{"auth"},
+		Request: registerRequest{},
+		Responses: errorResponses(map[int]openapi.Response{
+			303: {Description: "Registered and logged in"},
+			422: {Description: "Invalid fields, or a password not meeting the policy", Body: validate.Errors{}},
+		}, 400, 403),
+	})
+
+	mux.HandleFunc("GET /verify", s.VerifyEmailHandler)
+
+	mux.HandleFunc("POST /session/touch", s.SessionTouchHandler)
+
+	// Register the WebSocket endpoint of logged-in users
+	mux.Handle("GET /ws", auth.AuthMiddleware(s.db, s.hub))
+	mux.Handle("GET /events", auth.AuthMiddleware(s.db, s.events))
+
+	api.HandleFunc("GET /csrf-token", s.CSRFTokenHandler, openapi.Operation{
+		Summary:   "Get the CSRF token of the session",
+		Tags:      []string{"auth"},
+		Responses: map[int]openapi.Response{200: {Body: map[string]string{}}},
+	})
+
+	api.HandleFunc("POST /consent", s.ConsentHandler, openapi.Operation{
+		Summary:     "Consent to cookies",
+		Description: "Stores the session of an anonymous visitor and returns its CSRF token, when consent is required.",
+		Tags:        []string{"auth"},
+		Responses:   errorResponses(map[int]openapi.Response{200: {Body: map[string]string{}}}, 403),
+	})
+
+	// Register token authentication routes
+	api.HandleFunc("POST /token", s.TokenHandler, tokenOperation)
+
+	api.HandleFunc("POST /token/refresh", s.TokenRefreshHandler, tokenRefreshOperation)
+
+	api.HandleFunc("POST /token/revoke", s.TokenRevokeHandler, tokenRevokeOperation)
+
+	// Register OAuth2 / OIDC login routes
+	mux.HandleFunc("GET /auth/{provider}/login", s.OAuthLoginHandler)
+
+	mux.HandleFunc("GET /auth/{provider}/callback", s.OAuthCallbackHandler)
+
+	// Register OAuth2 authorization server routes, for third-party clients
+	mux.Handle("GET /oauth/authorize", s.ownerOnly(s.oauthServer.AuthorizeHandler))
+
+	mux.Handle("POST /oauth/authorize", s.ownerOnly(s.oauthServer.AuthorizeHandler))
+
+	mux.HandleFunc("POST /oauth/token", s.oauthServer.TokenHandler)
+
+	// Register SAML login routes
+	mux.HandleFunc("GET /saml/metadata", s.SAMLMetadataHandler)
+
+	mux.HandleFunc("GET /saml/login", s.SAMLLoginHandler)
+
+	mux.HandleFunc("POST /saml/acs", s.SAMLACSHandler)
+
+	// Register two-factor authentication routes
+	mux.HandleFunc("POST /2fa/verify", s.TwoFactorVerifyHandler)
+
+	mux.Handle("POST /2fa/enable", s.sensitive(s.TwoFactorEnableHandler))
+
+	// Register account routes
+	api.Handle("GET /me", auth.AuthMiddleware(s.db, http.HandlerFunc(s.MeHandler)), withSecurity(meOperation, sessionAuth))
+
+	api.Handle("PATCH /me", s.sensitive(s.MeUpdateHandler), openapi.Operation{
+		Summary:     "Update the profile of the logged-in user",
+		Description: "Only the fields present are changed. Requires a recent authentication.",
+		Tags:        []string{"account"},
+		Request:     auth.ProfileUpdate{},
+		Responses: errorResponses(map[int]openapi.Response{
+			200: {Body: auth.User{}},
+			422: {Body: auth.ProfileError{}},
+		}, 400, 401, 403, 409),
+		Security: []string{sessionAuth},
+	})
+
+	api.Handle("DELETE /me", s.ownerOnly(s.MeDeleteHandler), openapi.Operation{
+		Summary:   "Delete the account of the logged-in user",
+		Tags:      []string{"account"},
+		Request:   accountDeleteRequest{},
+		Responses: errorResponses(map[int]openapi.Response{204: {}}, 400, 401, 403),
+		Security:  []string{sessionAuth},
+	})
+
+	api.Handle("GET /me/sessions", auth.AuthMiddleware(s.db, http.HandlerFunc(s.MeSessionsHandler)), openapi.Operation{
+		Summary:   "List the active sessions of the logged-in user",
+		Tags:      []string{"account"},
+		Responses: errorResponses(map[int]openapi.Response{200: {Body: []auth.SessionInfo{}}}, 403),
+		Security:  []string{sessionAuth},
+	})
+
+	api.Handle("DELETE /me/sessions/{id}", auth.AuthMiddleware(s.db, http.HandlerFunc(s.MeSessionRevokeHandler)), openapi.Operation{
+		Summary:   "Log out another session of the logged-in user",
+		Tags:      []string{"account"},
+		Responses: errorResponses(map[int]openapi.Response{204: {}}, 403, 404),
+		Security:  []string{sessionAuth},
+	})
+
+	api.Handle("GET /password/change", auth.AuthMiddleware(s.db, http.HandlerFunc(s.PasswordChangeStatusHandler)), openapi.Operation{
+		Summary:   "Report whether the logged-in user must change an expired password",
+		Tags:      []string{"account"},
+		Responses: errorResponses(map[int]openapi.Response{200: {Body: passwordChangeStatus{}}}, 401),
+		Security:  []string{sessionAuth},
+	})
+
+	api.Handle("POST /password/change", s.ownerOnly(s.PasswordChangeHandler), openapi.Operation{
+		Summary: "Change the password of the logged-in user",
+		Tags:    []string{"account"},
+		Request: passwordChangeRequest{},
+		Responses: errorResponses(map[int]openapi.Response{
+			204: {},
+			422: {Body: auth.PasswordPolicyError{}},
+		}, 400, 401, 403),
+		Security: []string{sessionAuth},
+	})
+
+	mux.Handle("GET /me/identities", auth.AuthMiddleware(s.db, http.HandlerFunc(s.IdentitiesHandler)))
+
+	mux.Handle("POST /me/identities/{provider}", s.sensitive(s.IdentityLinkHandler))
+
+	mux.Handle("DELETE /me/identities/{provider}", s.ownerOnly(s.IdentityUnlinkHandler))
+
+	mux.Handle("POST /reauth", s.ownerOnly(s.ReauthHandler))
+
+	// Register passwordless login routes
+	mux.HandleFunc("POST /login/magic", s.MagicLinkRequestHandler)
+
+	mux.HandleFunc("GET /login/magic", s.MagicLinkLoginHandler)
+
+	// Register passkey routes
+	mux.HandleFunc("POST /webauthn/login/begin", s.PasskeyLoginBeginHandler)
+
+	mux.HandleFunc("POST /webauthn/login/finish", s.PasskeyLoginFinishHandler)
+
+	mux.Handle("POST /webauthn/register/begin", s.sensitive(s.PasskeyRegisterBeginHandler))
+
+	mux.Handle("POST /webauthn/register/finish", s.sensitive(s.PasskeyRegisterFinishHandler))
+
+	// Register API key management routes
+	api.Handle("GET /apikeys", auth.AuthMiddleware(s.db, http.HandlerFunc(s.APIKeysHandler)), withSecurity(apiKeysOperation, sessionAuth))
+
+	api.Handle("POST /apikeys", s.sensitive(s.APIKeyCreateHandler), openapi.Operation{
+		Summary:     "Issue a new API key",
+		Description: "The key is only returned in this response. Requires a recent authentication.",
+		Tags:        []string{"api keys"},
+		Request:     apiKeyRequest{},
+		Responses:   errorResponses(map[int]openapi.Response{201: {Body: apiKeyResponse{}}}, 400, 401, 403),
+		Security:    []string{sessionAuth},
+	})
+
+	api.Handle("DELETE /apikeys/{id}", s.ownerOnly(s.APIKeyRevokeHandler), withSecurity(apiKeyRevokeOperation, sessionAuth))
+
+	// Register user, role and permission management routes, restricted to admins
+	mux.Handle("GET /admin/users", s.adminOnly(s.AdminUsersHandler))
+
+	mux.Handle("POST /admin/users/{username}/disable", s.adminOnly(s.AdminUserDisableHandler))
+
+	mux.Handle("POST /admin/users/{username}/ban", s.adminOnly(s.AdminUserBanHandler))
+
+	mux.Handle("POST /admin/users/{username}/enable", s.adminOnly(s.AdminUserEnableHandler))
+
+	mux.Handle("POST /admin/users/{username}/password-reset", s.adminOnly(s.AdminUserPasswordResetHandler))
+
+	mux.Handle("DELETE /admin/users/{username}", s.adminOnly(s.AdminUserDeleteHandler))
+
+	mux.Handle("POST /admin/users/{username}/restore", s.adminOnly(s.AdminUserRestoreHandler))
+
+	mux.Handle("POST /admin/users/{username}/purge", s.adminOnly(s.AdminUserPurgeHandler))
+
+	mux.Handle("GET /admin/users/{username}/roles", s.adminOnly(s.UserRolesHandler))
+
+	mux.Handle("PUT /admin/users/{username}/roles/{role}", s.adminOnly(s.UserRoleAssignHandler))
+
+	mux.Handle("DELETE /admin/users/{username}/roles/{role}", s.adminOnly(s.UserRoleRemoveHandler))
+
+	mux.Handle("GET /admin/roles/{role}/permissions", s.adminOnly(s.RolePermissionsHandler))
+
+	mux.Handle("PUT /admin/roles/{role}/permissions/{action}/{resource}", s.adminOnly(s.RolePermissionGrantHandler))
+
+	mux.Handle("DELETE /admin/roles/{role}/permissions/{action}/{resource}", s.adminOnly(s.RolePermissionRevokeHandler))
+
+	mux.Handle("GET /admin/auth-events", s.adminOnly(s.AuthEventsHandler))
+
+	mux.Handle("POST /admin/invitations", s.adminOnly(s.InvitationCreateHandler))
+
+	mux.Handle("POST /admin/oauth/clients", s.adminOnly(s.OAuthClientCreateHandler))
+
+	mux.Handle("GET /admin/backup", s.adminOnly(s.BackupHandler))
+
+	// Register impersonation routes
+	mux.Handle("POST /admin/users/{username}/impersonate", s.adminOnly(s.ImpersonateHandler))
+
+	mux.Handle("POST /impersonate/stop", auth.AuthMiddleware(s.db, http.HandlerFunc(s.ImpersonateStopHandler)))
+
 	// Register private routes with Auth Middleware
 	mux.Handle("/protected", auth.AuthMiddleware(s.db, http.HandlerFunc(s.ProtectedHandler)))
 
-	// Wrap the mux with CORS middleware, Sessions middleware
-	return s.corsMiddleware(s.sm.SessionMiddleware(mux))
-}
+	mux.Handle("/protected/verified", auth.AuthMiddleware(s.db, auth.RequireVerified(s.db, http.HandlerFunc(s.ProtectedHandler))))
 
-func (s *Server) corsMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Set CORS headers
-		w.Header().Set("Access-Control-Allow-Origin", "http://localhost:5173") // Replace "*" with specific origins if needed
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS, PATCH")
-		w.Header().Set("Access-Control-Allow-Headers", "Accept, Authorization, Content-Type, X-CSRF-Token")
-		w.Header().Set("Access-Control-Allow-Credentials", "true") // Set to "true" if credentials are required
+	mux.Handle("/protected/token", auth.JWTMiddleware(s.tokens, http.HandlerFunc(s.TokenProtectedHandler)))
 
-		// Handle preflight OPTIONS requests
-		if r.Method == http.MethodOptions {
-			w.WriteHeader(http.StatusNoContent)
-			return
-		}
+	api.Handle("/protected/bearer", auth.BearerMiddleware(
+		s.bearerValidator(),
+		http.HandlerFunc(s.BearerProtectedHandler),
+	), openapi.Operation{
+		Summary:   "Example route accepting access tokens and API keys as bearer tokens",
+		Tags:      []string{"examples"},
+		Responses: errorResponses(map[int]openapi.Response{200: {Description: "Plain text greeting"}}, 401),
+		Security:  []string{bearerAuth},
+	})
+
+	mux.Handle("/protected/scoped", auth.BearerMiddleware(
+		s.bearerValidator(),
+		auth.RequireScope("users:read", http.HandlerFunc(s.BearerProtectedHandler)),
+	))
 
-		// Proceed with the next handler
-		next.ServeHTTP(w, r)
+	api.Handle("/protected/apikey", auth.APIKeyMiddleware(s.db, http.HandlerFunc(s.APIKeyProtectedHandler)), openapi.Operation{
+		Summary:   "Example route accepting API keys",
+		Tags:      []string{"examples"},
+		Responses: errorResponses(map[int]openapi.Response{200: {Description: "Plain text greeting"}}, 401),
+		Security:  []string{apiKeyAuth},
 	})
+
+	mux.Handle("/protected/admin", s.adminOnly(s.ProtectedHandler))
+
+	// Register the versioned API routes, under their own middleware stack
+	v1 := s.registerAPIV1(api)
+
+	// Sessions with an expired password can only change it or log out
+	handler := auth.RequirePasswordChange("/password/change", "/logout", "/csrf-token")(s.rateLimitRoutes(mux))
+	v1Handler := auth.RequirePasswordChange("/password/change", apiPrefix+"health")(s.rateLimitRoutes(v1))
+
+	// Static assets need neither a tenant nor a session, the API routes
+	// have their own middleware stack and are not redirected to pages
+	root := http.NewServeMux()
+	root.Handle("GET /static/", s.static)
+	root.Handle(apiPrefix, apiMiddleware(s.tenantMiddleware(s.sm.SessionMiddleware(annotateRequestLog(v1Handler)))))
+	root.Handle("/", s.tenantMiddleware(s.sm.SessionMiddleware(annotateRequestLog(handler))))
+
+	// Wrap the routes with request IDs, request logging, CORS middleware, rate limiting, and the others with tenant middleware, Sessions middleware
+	return requestid.Middleware(s.logRequests(s.corsMiddleware(s.rateLimit(root))))
+}
+
+// registerAPIV1 registers the versioned API routes on their own mux,
+// documented by api. Scoped tokens must grant the scope of the route.
+func (s *Server) registerAPIV1(api *openapi.Registry) *http.ServeMux {
+	v1 := http.NewServeMux()
+	apiV1 := api.WithMux(v1)
+
+	apiV1.HandleFunc("GET "+apiPrefix+"health", s.HealthHandler, healthOperation)
+
+	apiV1.HandleFunc("POST "+apiPrefix+"token", s.TokenHandler, tokenOperation)
+
+	apiV1.HandleFunc("POST "+apiPrefix+"token/refresh", s.TokenRefreshHandler, tokenRefreshOperation)
+
+	apiV1.HandleFunc("POST "+apiPrefix+"token/revoke", s.TokenRevokeHandler, tokenRevokeOperation)
+
+	apiV1.Handle("GET "+apiPrefix+"me", s.apiAuth(auth.RequireScope("users:read", http.HandlerFunc(s.MeHandler))), withSecurity(meOperation, sessionAuth, bearerAuth))
+
+	apiV1.Handle("GET "+apiPrefix+"apikeys", s.apiAuth(auth.RequireScope("apikeys:read", http.HandlerFunc(s.APIKeysHandler))), withSecurity(apiKeysOperation, sessionAuth, bearerAuth))
+
+	apiV1.Handle("DELETE "+apiPrefix+"apikeys/{id}", s.apiAuth(auth.RequireScope("apikeys:write", auth.DenyImpersonation(http.HandlerFunc(s.APIKeyRevokeHandler)))), withSecurity(apiKeyRevokeOperation, sessionAuth, bearerAuth))
+
+	return v1
 }
 
 // HelloWorldHandler returns a simple hello world message.
@@ -66,20 +331,25 @@ func (s *Server) HelloWorldHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	w.Header().Set("Content-Type", "application/json")
 	if _, err := w.Write(jsonResp); err != nil {
-		log.Printf("Failed to write response: %v", err)
+		s.log().ErrorContext(r.Context(), "Failed to write response", "err", err)
 	}
 }
 
-// HealthHandler returns a map of health status information for the database service.
+// HealthHandler returns the health status of the database service, with 503
+// Service Unavailable when it is down so load balancers stop routing to it.
 func (s *Server) HealthHandler(w http.ResponseWriter, r *http.Request) {
-	resp, err := json.Marshal(s.db.Health())
+	health := s.db.Health(r.Context())
+	resp, err := json.Marshal(health)
 	if err != nil {
 		http.Error(w, "Failed to marshal health check response", http.StatusInternalServerError)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
+	if health.Status == database.HealthDown {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
 	if _, err := w.Write(resp); err != nil {
-		log.Printf("Failed to write response: %v", err)
+		s.log().ErrorContext(r.Context(), "Failed to write response", "err", err)
 	}
 }
 
@@ -100,7 +370,7 @@ func (s *Server) HomeHandler(w http.ResponseWriter, r *http.Request) {
 
 	fmt.Fprintf(w, "Welcome! Your session ID is: %s\n", session.ID)
 	fmt.Fprintf(w, "User ID from session: %v\n", username)
-	fmt.Fprintf(w, "Session CSRF token: %s\n", session.Get("csrf_token"))
+	fmt.Fprintf(w, "Session CSRF token: %s\n", session.CSRFToken())
 	fmt.Fprintf(w, "Session created at: %s\n", session.CreatedAt.Format(time.RFC3339))
 	fmt.Fprintf(w, "Session last active: %s\n", session.LastActive.Format(time.RFC3339))
 
@@ -113,6 +383,72 @@ func (s *Server) HomeHandler(w http.ResponseWriter, r *http.Request) {
 	fmt.Fprintf(w, "You have visited this page %d times in this session.\n", session.Get("visits").(int))
 }
 
+// SessionTouchHandler extends the idle expiration of the current session without
+// modifying its data, so SPAs can keep a session alive while the user is idle in the UI.
+func (s *Server) SessionTouchHandler(w http.ResponseWriter, r *http.Request) {
+	session := sm.GetSession(r)
+	s.sm.Renew(session)
+
+	expiresAt := s.sm.ExpiresAt(session)
+	writeJSON(w, http.StatusOK, map[string]string{"expires_at": expiresAt.Format(time.RFC3339)})
+}
+
+// adminOnly wraps a handler with the AuthMiddleware and the admin role requirement.
+func (s *Server) adminOnly(handler http.HandlerFunc) http.Handler {
+	return auth.AuthMiddleware(s.db, auth.RequireRole(s.db, auth.RoleAdmin, handler))
+}
+
+// internalOnly guards internal endpoints with a client certificate when
+// CLIENT_CERT_USERS is configured, and with HTTP Basic auth when INTERNAL_USERS
+// is. With both, requests presenting a certificate are authenticated by it.
+func (s *Server) internalOnly(handler http.HandlerFunc) http.Handler {
+	switch {
+	case len(s.certUsers) > 0 && len(s.internalUsers) > 0:
+		cert := auth.ClientCertAuth(s.certUsers)(handler)
+		basic := auth.BasicAuth(s.internalUsers)(handler)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if auth.ClientCertificate(r) != nil {
+				cert.ServeHTTP(w, r)
+				return
+			}
+			basic.ServeHTTP(w, r)
+		})
+	case len(s.certUsers) > 0:
+		return auth.ClientCertAuth(s.certUsers)(handler)
+	case len(s.internalUsers) > 0:
+		return auth.BasicAuth(s.internalUsers)(handler)
+	}
+	return handler
+}
+
+// ownerOnly wraps a handler with the AuthMiddleware and rejects impersonation
+// sessions, for changes to the credentials and account of the user.
+func (s *Server) ownerOnly(handler http.HandlerFunc) http.Handler {
+	return auth.AuthMiddleware(s.db, auth.DenyImpersonation(handler))
+}
+
+// sensitive wraps a handler like ownerOnly and also requires the user to have
+// authenticated recently, for actions granting new ways to access the account.
+// Routes that verify the password themselves do not need it.
+func (s *Server) sensitive(handler http.HandlerFunc) http.Handler {
+	return auth.AuthMiddleware(s.db, auth.DenyImpersonation(auth.RequireRecentAuth(s.recentAuthMaxAge)(handler)))
+}
+
+// CSRFTokenHandler returns the CSRF token of the current session, so API clients
+// can obtain it before making state-changing requests. Sessions waiting for
+// consent are not stored, their requests are checked by origin instead.
+func (s *Server) CSRFTokenHandler(w http.ResponseWriter, r *http.Request) {
+	session := sm.GetSession(r)
+	writeJSON(w, http.StatusOK, map[string]string{"csrf_token": session.CSRFToken()})
+}
+
+// ConsentHandler records the consent of the visitor to cookies, so its session
+// is stored from now on, and returns the CSRF token of the session.
+func (s *Server) ConsentHandler(w http.ResponseWriter, r *http.Request) {
+	s.sm.GrantConsent(w, r)
+	writeJSON(w, http.StatusOK, map[string]string{"csrf_token": sm.GetSession(r).CSRFToken()})
+}
+
 // ProtectedHandler is a simple route that will be wrapped with the AuthMiddleware.
 func (s *Server) ProtectedHandler(w http.ResponseWriter, r *http.Request) {
 	session := sm.GetSession(r)
@@ -125,6 +461,9 @@ func (s *Server) LogoutHandler(w http.ResponseWriter, r *http.Request) {
 	// Signal to the SessionResponseWriter that the session has been destroyed.
 	// This ensures the session cookie is cleared correctly by the middleware.
 	if srw, ok := w.(*sm.SessionResponseWriter); ok {
+		if username, _ := sm.GetSession(r).Get("username").(string); username != "" && username != "guest" {
+			auth.RecordEvent(r, s.db, auth.EventLogout, username, "")
+		}
 		err := auth.Logout(r, srw)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -134,7 +473,15 @@ func (s *Server) LogoutHandler(w http.ResponseWriter, r *http.Request) {
 		srw.ResponseWriter.Header().Set("Location", "http://localhost:"+strconv.Itoa(s.port)+"/")
 	}
 
-	log.Printf("Logged out successfully! Session destroyed.\n")
+	s.log().InfoContext(r.Context(), "Logged out, session destroyed")
+}
+
+// MetricsHandler exposes the database metrics to Prometheus.
+func (s *Server) MetricsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if err := s.db.WriteMetrics(w); err != nil {
+		s.log().ErrorContext(r.Context(), "Failed to write metrics", "err", err)
+	}
 }
 
 // DebugSessionHandler for inspecting raw session data (for debugging only).
@@ -158,59 +505,158 @@ func (s *Server) DebugSessionHandler(w http.ResponseWriter, r *http.Request) {
 	w.Write(jsonBytes)
 }
 
+// loginRequest is the JSON body of the login endpoint.
+type loginRequest struct {
+	Username string `json:"username" validate:"required,max=254"` // Username or email address
+	Password string `json:"password" validate:"required,max=1024"`
+}
+
+// registerRequest is the JSON body of the registration endpoint. The password
+// requirements are checked by the password policy.
+type registerRequest struct {
+	Username string `json:"username" validate:"required,min=3,max=32,regexp=^[A-Za-z0-9_.-]+$"`
+	Email    string `json:"email" validate:"required,email,max=254"`
+	Password string `json:"password" validate:"required,max=1024"`
+}
+
 // loginHandler simulates a user login and migrates the session.
 func (s *Server) LoginHandler(w http.ResponseWriter, r *http.Request) {
 	session := sm.GetSession(r)
 
-	// In a real application, you'd get the user from a the client.
-	// For example purposes, we'll just set a dummy user.
+	// Clients send their credentials as JSON, for example purposes
+	// requests without a body log in a dummy user.
 	user := auth.User{Username: "user123", Password: []byte("general123")}
+	if hasJSONBody(r) {
+		var req loginRequest
+		if !decodeValid(w, r, &req) {
+			return
+		}
+		user = auth.User{Username: req.Username, Password: []byte(req.Password)}
+	}
 
-	//err := auth.VerifyCredentials(s.db.GetClient(), user)
-	err := auth.VerifyCredentials(s.db, user)
+	// Throttle attempts per client IP and account before checking the password
+	key, err := auth.LoginKey(r.Context(), s.db, user.Username)
 	if err != nil {
-		log.Println(err)
+		s.log().ErrorContext(r.Context(), "Failed to check login attempts", "err", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	err = s.loginLimiter.Check(r.Context(), r, key)
+	if auth.WriteTooManyAttempts(w, err) {
+		return
+	}
+	if err != nil {
+		s.log().ErrorContext(r.Context(), "Failed to check login attempts", "err", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Accounts with repeated failed attempts must also solve a CAPTCHA
+	if s.captcha != nil {
+		required, err := s.loginLimiter.NeedsChallenge(r.Context(), key)
+		if err != nil {
+			s.log().ErrorContext(r.Context(), "Failed to check login attempts", "err", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if required && !s.verifyCaptcha(w, r) {
+			return
+		}
+	}
+
+	// The login may be the username or the email address of the user
+	//err := auth.VerifyCredentials(s.db.GetClient(), user)
+	username, err := auth.VerifyCredentials(r.Context(), s.db, user)
+	if err != nil {
+		s.log().InfoContext(r.Context(), "Login failed", "username", user.Username, "err", err)
+		auth.RecordEvent(r, s.db, auth.EventLoginFailure, user.Username, "password")
+		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
+		return
+	}
+	if err := s.loginLimiter.Succeeded(r.Context(), key); err != nil {
+		s.log().ErrorContext(r.Context(), "Failed to reset login attempts", "username", user.Username, "err", err)
+	}
+	user.Username = username
 
 	if srw, ok := w.(*sm.SessionResponseWriter); ok {
 		if session.Get("username") != "guest" {
-			log.Printf("%s already logged in", session.Get("username"))
+			s.log().InfoContext(r.Context(), "User already logged in", "username", session.Get("username"))
 			srw.StatusCode = http.StatusFound
 			srw.ResponseWriter.Header().Set("Location", "http://localhost:"+strconv.Itoa(s.port)+"/")
 			return
 		}
-		err := auth.Login(r, srw, user)
+
+		// Users with two-factor authentication must confirm a code on /2fa/verify
+		if s.beginSecondFactor(w, r, user, "password") {
+			return
+		}
+
+		err = auth.Login(r, srw, s.db, user)
 		if err != nil {
-			log.Println(err)
+			s.log().ErrorContext(r.Context(), "Failed to log in", "username", user.Username, "err", err)
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
+		if _, err := auth.CheckPasswordExpiry(r.Context(), srw.Session, s.db, s.passwordPolicy, user.Username); err != nil {
+			s.log().ErrorContext(r.Context(), "Failed to check password expiry", "username", user.Username, "err", err)
+		}
 		srw.StatusCode = http.StatusSeeOther
 		srw.ResponseWriter.Header().Set("Location", "http://localhost:"+strconv.Itoa(s.port)+"/")
 	}
 
-	log.Printf("User logged in successfully! Session updated for user: %s\n", user.Username)
+	auth.RecordEvent(r, s.db, auth.EventLoginSuccess, user.Username, "password")
+	s.log().InfoContext(r.Context(), "User logged in", "username", user.Username)
 }
 
 // RegisterHandler simulates registering a new user.
 func (s *Server) RegisterHandler(w http.ResponseWriter, r *http.Request) {
-	user := auth.User{Username: "user123", Password: []byte("general123")}
-	_, err := auth.Register(s.db, user)
+	// Clients send the new user as JSON, for example purposes requests
+	// without a body register a dummy user.
+	user := auth.User{Username: "user123", Email: "user123@example.com", Password: []byte("general123")}
+	if hasJSONBody(r) {
+		var req registerRequest
+		if !decodeValid(w, r, &req) {
+			return
+		}
+		user = auth.User{Username: req.Username, Email: req.Email, Password: []byte(req.Password)}
+	}
+	// Invitation links pass the code in the query string
+	user.InviteCode = r.FormValue("invite")
+
+	if s.captcha != nil && !s.verifyCaptcha(w, r) {
+		return
+	}
+
+	_, err := auth.Register(r.Context(), s.db, s.registration, s.passwordPolicy, user)
+	var policyErr *auth.PasswordPolicyError
+	if errors.As(err, &policyErr) {
+		writeJSON(w, http.StatusUnprocessableEntity, policyErr)
+		return
+	}
+	if errors.Is(err, auth.ErrInvitationRequired) || errors.Is(err, auth.ErrInvalidInvitation) {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
 	if err != nil {
-		log.Println(err)
+		s.log().ErrorContext(r.Context(), "Failed to register user", "username", user.Username, "err", err)
 		w.Header().Set("Location", "http://localhost:"+strconv.Itoa(s.port)+"/")
 		w.WriteHeader(http.StatusSeeOther)
 		return
 	}
 
+	auth.RecordEvent(r, s.db, auth.EventRegister, user.Username, "")
+
+	// Registration succeeds even if the email cannot be sent, a new link can be requested later
+	if err := auth.RequestEmailVerification(r.Context(), s.db, s.mailer, user, s.baseURL()); err != nil {
+		s.log().ErrorContext(r.Context(), "Failed to send verification email", "username", user.Username, "err", err)
+	}
+
 	session := sm.GetSession(r)
 	session.Put("username", user.Username)
 
 	if srw, ok := w.(*sm.SessionResponseWriter); ok {
 		srw.Session = session
-		err := auth.Login(r, srw, user)
+		err := auth.Login(r, srw, s.db, user)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
@@ -219,3 +665,19 @@ func (s *Server) RegisterHandler(w http.ResponseWriter, r *http.Request) {
 		srw.ResponseWriter.Header().Set("Location", "http://localhost:"+strconv.Itoa(s.port)+"/")
 	}
 }
+
+// VerifyEmailHandler marks the email of a user as verified using the token from the verification link.
+func (s *Server) VerifyEmailHandler(w http.ResponseWriter, r *http.Request) {
+	username, err := auth.VerifyEmail(r.Context(), s.db, r.URL.Query().Get("token"))
+	if errors.Is(err, auth.ErrInvalidVerificationToken) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		s.log().ErrorContext(r.Context(), "Failed to verify email", "err", err)
+		http.Error(w, "Failed to verify email", http.StatusInternalServerError)
+		return
+	}
+
+	fmt.Fprintf(w, "Email verified for user: %s\n", username)
+}
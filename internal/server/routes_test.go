@@ -1,10 +1,29 @@
 package server
 
 import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
 	"io"
+	"log/slog"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/raziel-aleman/go-starter/internal/auth"
+	"github.com/raziel-aleman/go-starter/internal/auth/oauthserver"
+	"github.com/raziel-aleman/go-starter/internal/database"
+	"github.com/raziel-aleman/go-starter/internal/database/databasetest"
+	"github.com/raziel-aleman/go-starter/internal/jwt"
+	"github.com/raziel-aleman/go-starter/internal/ratelimit"
+	"github.com/raziel-aleman/go-starter/internal/requestid"
+	"github.com/raziel-aleman/go-starter/internal/session"
+	"github.com/raziel-aleman/go-starter/internal/sse"
+	"github.com/raziel-aleman/go-starter/internal/store"
 )
 
 func TestHandler(t *testing.T) {
@@ -29,3 +48,559 @@ func TestHandler(t *testing.T) {
 		t.Errorf("expected response body to be %v; got %v", expected, string(body))
 	}
 }
+
+func TestCSRFTokenHandler(t *testing.T) {
+	s := &Server{sm: session.NewSessionManager(store.NewInMemorySessionStore(), "GOSESSID", time.Minute, time.Hour)}
+	server := httptest.NewServer(s.sm.SessionMiddleware(http.HandlerFunc(s.CSRFTokenHandler)))
+	defer server.Close()
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatalf("error making request to server. Err: %v", err)
+	}
+	defer resp.Body.Close()
+	// Assertions
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected status OK; got %v", resp.Status)
+	}
+	var body map[string]string
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatalf("error decoding response body. Err: %v", err)
+	}
+	if len(body["csrf_token"]) != 86 {
+		t.Errorf("expected an 86-character masked csrf token; got %q", body["csrf_token"])
+	}
+}
+
+func TestSessionTouchHandler(t *testing.T) {
+	st := store.NewInMemorySessionStore()
+	s := &Server{sm: session.NewSessionManager(st, "GOSESSID", time.Minute, time.Hour)}
+	defer s.sm.Close()
+	// Only the touch extends the session
+	s.sm.TouchOnRead = false
+	s.sm.CSRFMethods = nil
+	ctx := context.Background()
+	sess, err := session.NewSession()
+	if err != nil {
+		t.Fatalf("error creating session. Err: %v", err)
+	}
+	lastActive := time.Now().Add(-30 * time.Second)
+	sess.LastActive = lastActive
+	if err := st.Write(ctx, sess); err != nil {
+		t.Fatalf("error storing session. Err: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/session/touch", nil)
+	req.AddCookie(&http.Cookie{Name: "GOSESSID", Value: sess.ID})
+	rr := httptest.NewRecorder()
+	s.sm.SessionMiddleware(http.HandlerFunc(s.SessionTouchHandler)).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status OK; got %d", rr.Code)
+	}
+	var body map[string]string
+	if err := json.NewDecoder(rr.Body).Decode(&body); err != nil {
+		t.Fatalf("error decoding response body. Err: %v", err)
+	}
+	expiresAt, err := time.Parse(time.RFC3339, body["expires_at"])
+	if err != nil {
+		t.Fatalf("error parsing expiration. Err: %v", err)
+	}
+	if expiresAt.Before(time.Now().Add(50 * time.Second)) {
+		t.Errorf("expected the idle expiration to be extended; got %v", expiresAt)
+	}
+	stored, err := st.Read(ctx, sess.ID)
+	if err != nil {
+		t.Fatalf("error reading session. Err: %v", err)
+	}
+	if !stored.LastActive.After(lastActive) {
+		t.Errorf("expected the stored session to be renewed; last active %v", stored.LastActive)
+	}
+}
+
+func TestHealthHandler(t *testing.T) {
+	s := &Server{db: databasetest.New(t)}
+	server := httptest.NewServer(http.HandlerFunc(s.HealthHandler))
+	defer server.Close()
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatalf("error making request to server. Err: %v", err)
+	}
+	defer resp.Body.Close()
+	// Assertions
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected status OK; got %v", resp.Status)
+	}
+	var health database.HealthStatus
+	if err := json.NewDecoder(resp.Body).Decode(&health); err != nil {
+		t.Fatalf("error decoding response body. Err: %v", err)
+	}
+	if health.Checks["ping"].Status != database.HealthUp {
+		t.Errorf("expected the database to answer pings; got %+v", health)
+	}
+}
+
+func TestCORSMiddleware(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	tests := []struct {
+		name        string
+		cors        corsConfig
+		method      string
+		origin      string
+		allowOrigin string
+		status      int
+	}{
+		{"allowed origin", corsConfig{Origins: []string{"https://app.example.com"}, Credentials: true}, http.MethodGet, "https://app.example.com", "https://app.example.com", http.StatusOK},
+		{"other origin", corsConfig{Origins: []string{"https://app.example.com"}, Credentials: true}, http.MethodGet, "https://evil.example.com", "", http.StatusOK},
+		{"wildcard", corsConfig{Origins: []string{"*"}}, http.MethodGet, "https://evil.example.com", "*", http.StatusOK},
+		{"wildcard with credentials", corsConfig{Origins: []string{"*"}, Credentials: true}, http.MethodGet, "https://app.example.com", "https://app.example.com", http.StatusOK},
+		{"preflight", corsConfig{Origins: []string{"https://app.example.com"}, Methods: []string{"GET", "POST"}, Headers: []string{"X-CSRF-Token"}, MaxAge: 10 * time.Minute}, http.MethodOptions, "https://app.example.com", "https://app.example.com", http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Server{cors: tt.cors}
+			req := httptest.NewRequest(tt.method, "/", nil)
+			req.Header.Set("Origin", tt.origin)
+			rr := httptest.NewRecorder()
+			s.corsMiddleware(next).ServeHTTP(rr, req)
+
+			if rr.Code != tt.status {
+				t.Errorf("expected status %d; got %d", tt.status, rr.Code)
+			}
+			if got := rr.Header().Get("Access-Control-Allow-Origin"); got != tt.allowOrigin {
+				t.Errorf("expected Access-Control-Allow-Origin %q; got %q", tt.allowOrigin, got)
+			}
+			credentials := tt.allowOrigin != "" && tt.cors.Credentials
+			if got := rr.Header().Get("Access-Control-Allow-Credentials") == "true"; got != credentials {
+				t.Errorf("expected credentials allowed to be %v; got %v", credentials, got)
+			}
+			if tt.method == http.MethodOptions {
+				if rr.Header().Get("Access-Control-Allow-Methods") != "GET, POST" || rr.Header().Get("Access-Control-Allow-Headers") != "X-CSRF-Token" || rr.Header().Get("Access-Control-Max-Age") != "600" {
+					t.Errorf("unexpected preflight headers %v", rr.Header())
+				}
+			}
+		})
+	}
+}
+
+func TestLogRequests(t *testing.T) {
+	var buf bytes.Buffer
+	s := &Server{
+		logger: slog.New(slog.NewJSONHandler(&buf, nil)),
+		sm:     session.NewSessionManager(store.NewInMemorySessionStore(), "GOSESSID", time.Minute, time.Hour),
+	}
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		session.GetSession(r).Put("username", "alice")
+		w.WriteHeader(http.StatusCreated)
+	})
+	rr := httptest.NewRecorder()
+	s.logRequests(s.sm.SessionMiddleware(annotateRequestLog(handler))).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/profile?tab=1", nil))
+
+	var entry map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("error decoding log entry %q. Err: %v", buf.String(), err)
+	}
+	if entry["msg"] != "Request" || entry["method"] != "GET" || entry["path"] != "/profile" || entry["status"] != float64(http.StatusCreated) || entry["user"] != "alice" {
+		t.Errorf("unexpected log entry %v", entry)
+	}
+	if session, _ := entry["session"].(string); len(session) != 12 {
+		t.Errorf("expected a 12-character session digest; got %v", entry["session"])
+	}
+	if _, ok := entry["duration"]; !ok {
+		t.Errorf("expected the duration in the log entry %v", entry)
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	s := &Server{requestLimiter: ratelimit.NewTokenBucket(ratelimit.NewMemoryStore(), "requests:", 0.5, 1)}
+	handler := s.rateLimit(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected the first request to be allowed; got %d", rr.Code)
+	}
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusTooManyRequests || rr.Header().Get("Retry-After") != "2" {
+		t.Errorf("expected 429 with Retry-After 2; got %d, %q", rr.Code, rr.Header().Get("Retry-After"))
+	}
+}
+
+func TestRateLimitRoutes(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/home", func(w http.ResponseWriter, r *http.Request) {})
+	mux.HandleFunc("POST /token", func(w http.ResponseWriter, r *http.Request) {})
+	s := &Server{routeLimiters: map[string]*ratelimit.TokenBucket{
+		"POST /token": ratelimit.NewTokenBucket(ratelimit.NewMemoryStore(), "route:", 0.5, 1),
+	}}
+	handler := s.rateLimitRoutes(mux)
+
+	for i, expected := range []int{http.StatusOK, http.StatusTooManyRequests} {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/token", nil))
+		if rr.Code != expected {
+			t.Errorf("expected status %d for token request %d; got %d", expected, i+1, rr.Code)
+		}
+	}
+	for range 3 {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/home", nil))
+		if rr.Code != http.StatusOK {
+			t.Errorf("expected routes without a limit to be allowed; got %d", rr.Code)
+		}
+	}
+}
+
+func TestDecodeValid(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{"valid", `{"username":"alice","email":"alice@example.com","password":"correct horse"}`, http.StatusOK},
+		{"malformed", `{"username":`, http.StatusBadRequest},
+		{"unknown field", `{"username":"alice","admin":true}`, http.StatusBadRequest},
+		{"invalid fields", `{"username":"a!","email":"alice"}`, http.StatusUnprocessableEntity},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/register", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			rr := httptest.NewRecorder()
+			var body registerRequest
+			if decodeValid(rr, req, &body) {
+				rr.WriteHeader(http.StatusOK)
+			}
+			if rr.Code != tt.status {
+				t.Fatalf("expected status %d; got %d", tt.status, rr.Code)
+			}
+			if tt.status != http.StatusUnprocessableEntity {
+				return
+			}
+
+			var resp struct {
+				Errors map[string][]string `json:"errors"`
+			}
+			if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("error unmarshaling response. Err: %v", err)
+			}
+			for _, field := range []string{"username", "email", "password"} {
+				if len(resp.Errors[field]) == 0 {
+					t.Errorf("expected errors for %s; got %v", field, resp.Errors)
+				}
+			}
+		})
+	}
+}
+
+func TestAPIMiddleware(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v1/ok", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	})
+	handler := requestid.Middleware(apiMiddleware(mux))
+
+	tests := []struct {
+		name   string
+		path   string
+		accept string
+		status int
+		error  string
+	}{
+		{"json", "/api/v1/ok", "application/json", http.StatusOK, ""},
+		{"any", "/api/v1/ok", "", http.StatusOK, ""},
+		{"html only", "/api/v1/ok", "text/html", http.StatusNotAcceptable, "The API only answers application/json"},
+		{"unknown route", "/api/v1/missing", "application/json", http.StatusNotFound, "404 page not found"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			req.Header.Set("Accept", tt.accept)
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tt.status {
+				t.Fatalf("expected status %d; got %d", tt.status, rr.Code)
+			}
+			if rr.Header().Get("Content-Type") != "application/json" {
+				t.Errorf("expected a JSON response; got %q", rr.Header().Get("Content-Type"))
+			}
+			if tt.error == "" {
+				return
+			}
+			var body apiError
+			if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+				t.Fatalf("error decoding error body %q. Err: %v", rr.Body.String(), err)
+			}
+			if body.Error != tt.error || body.RequestID != rr.Header().Get(requestid.Header) {
+				t.Errorf("unexpected error body %+v", body)
+			}
+		})
+	}
+}
+
+func TestAPIAuth(t *testing.T) {
+	s := &Server{
+		sm:     session.NewSessionManager(store.NewInMemorySessionStore(), "GOSESSID", time.Minute, time.Hour),
+		tokens: jwt.NewManager([]byte("secret"), time.Minute, time.Hour, jwt.NewInMemoryRefreshStore()),
+		db:     databasetest.New(t, databasetest.User("alice", "password")),
+	}
+	oauthTokens := jwt.NewManager([]byte("secret"), time.Minute, time.Hour, jwt.NewInMemoryRefreshStore())
+	oauthTokens.Audience = oauthAudience
+	s.oauthServer = oauthserver.New(oauthserver.NewInMemoryStore(), oauthTokens)
+	handler := s.sm.SessionMiddleware(s.apiAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(callerName(r)))
+	})))
+	pair, err := s.tokens.Issue(context.Background(), "alice")
+	if err != nil {
+		t.Fatalf("error issuing tokens. Err: %v", err)
+	}
+	client, err := oauthTokens.IssueClient(context.Background(), "app", "alice", "users:read")
+	if err != nil {
+		t.Fatalf("error issuing tokens. Err: %v", err)
+	}
+
+	tests := []struct {
+		name          string
+		authorization string
+		status        int
+	}{
+		{"access token", "Bearer " + pair.AccessToken, http.StatusOK},
+		{"oauth client token", "Bearer " + client.AccessToken, http.StatusOK},
+		{"invalid token", "Bearer invalid", http.StatusUnauthorized},
+		{"guest session", "", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/me", nil)
+			req.Header.Set("Authorization", tt.authorization)
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tt.status {
+				t.Fatalf("expected status %d; got %d", tt.status, rr.Code)
+			}
+			if tt.status == http.StatusOK && rr.Body.String() != "alice" {
+				t.Errorf("expected the token subject; got %q", rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestAPIScopes(t *testing.T) {
+	s := &Server{
+		sm:     session.NewSessionManager(store.NewInMemorySessionStore(), "GOSESSID", time.Minute, time.Hour),
+		tokens: jwt.NewManager([]byte("secret"), time.Minute, time.Hour, jwt.NewInMemoryRefreshStore()),
+		db:     databasetest.New(t, databasetest.User("alice", "password")),
+	}
+	s.oauthServer = oauthserver.New(oauthserver.NewInMemoryStore(), jwt.NewManager([]byte("secret"), time.Minute, time.Hour, jwt.NewInMemoryRefreshStore()))
+	handler := s.sm.SessionMiddleware(s.registerAPIV1(s.newAPIRegistry(http.NewServeMux())))
+	issue := func(scopes ...string) string {
+		pair, err := s.tokens.Issue(context.Background(), "alice", scopes...)
+		if err != nil {
+			t.Fatalf("error issuing tokens. Err: %v", err)
+		}
+		return pair.AccessToken
+	}
+	unscoped, profile, keys := issue(), issue("users:read"), issue("apikeys:read")
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		status int
+	}{
+		{"profile with users:read", http.MethodGet, "/api/v1/me", profile, http.StatusOK},
+		{"profile without users:read", http.MethodGet, "/api/v1/me", keys, http.StatusForbidden},
+		{"api keys with apikeys:read", http.MethodGet, "/api/v1/apikeys", keys, http.StatusOK},
+		{"api keys without apikeys:read", http.MethodGet, "/api/v1/apikeys", profile, http.StatusForbidden},
+		{"revoke without apikeys:write", http.MethodDelete, "/api/v1/apikeys/1", keys, http.StatusForbidden},
+		{"unscoped token", http.MethodGet, "/api/v1/apikeys", unscoped, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tt.status {
+				t.Errorf("expected status %d; got %d", tt.status, rr.Code)
+			}
+		})
+	}
+}
+
+func TestTenantIsolation(t *testing.T) {
+	tenants, err := newTenantResolver(TenantByHeader, "", "X-Tenant-ID")
+	if err != nil {
+		t.Fatalf("error creating tenant resolver. Err: %v", err)
+	}
+	s := &Server{
+		sm:           session.NewSessionManager(store.NewInMemorySessionStore(), "GOSESSID", time.Minute, time.Hour),
+		tokens:       jwt.NewManager([]byte("secret"), time.Minute, time.Hour, jwt.NewInMemoryRefreshStore()),
+		db:           databasetest.New(t, databasetest.InTenant("acme", databasetest.User("alice", "password"))),
+		loginLimiter: auth.NewLoginLimiter(ratelimit.NewMemoryStore(), 20, 5, time.Minute),
+		tenants:      tenants,
+	}
+	s.sm.CSRFExemptPaths = []string{apiPrefix + "token"}
+	handler := s.tenantMiddleware(s.sm.SessionMiddleware(http.HandlerFunc(s.TokenHandler)))
+
+	tests := []struct {
+		name   string
+		tenant string
+		status int
+	}{
+		{"same tenant", "acme", http.StatusOK},
+		{"other tenant", "beta", http.StatusUnauthorized},
+		{"default tenant", "", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/token", strings.NewReader(`{"username":"alice","password":"password"}`))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("X-Tenant-ID", tt.tenant)
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tt.status {
+				t.Errorf("expected status %d; got %d", tt.status, rr.Code)
+			}
+		})
+	}
+}
+
+func TestLoginHandlerInvalidCredentials(t *testing.T) {
+	s := &Server{
+		sm:           session.NewSessionManager(store.NewInMemorySessionStore(), "GOSESSID", time.Minute, time.Hour),
+		db:           databasetest.New(t, databasetest.User("alice", "password", "alice@example.com")),
+		loginLimiter: auth.NewLoginLimiter(ratelimit.NewMemoryStore(), 20, 5, time.Minute),
+	}
+	s.sm.CSRFMethods = nil
+	handler := s.sm.SessionMiddleware(http.HandlerFunc(s.LoginHandler))
+
+	// Unknown logins and wrong passwords are rejected alike, so responses do
+	// not reveal which usernames and emails are registered
+	var bodies []string
+	for _, body := range []string{
+		`{"username":"alice","password":"wrong"}`,
+		`{"username":"alice@example.com","password":"wrong"}`,
+		`{"username":"nobody","password":"wrong"}`,
+		`{"username":"nobody@example.com","password":"wrong"}`,
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusUnauthorized {
+			t.Errorf("expected status %d for %s; got %d", http.StatusUnauthorized, body, rr.Code)
+		}
+		bodies = append(bodies, rr.Body.String())
+	}
+	for _, body := range bodies[1:] {
+		if body != bodies[0] {
+			t.Errorf("expected identical responses; got %q and %q", bodies[0], body)
+		}
+	}
+}
+
+func TestWebSocketSession(t *testing.T) {
+	s := &Server{sm: session.NewSessionManager(store.NewInMemorySessionStore(), "GOSESSID", time.Minute, time.Hour)}
+	s.hub = s.newHub()
+	server := httptest.NewServer(s.sm.SessionMiddleware(s.hub))
+	defer server.Close()
+	defer s.hub.Close()
+
+	sess, _ := session.NewSession()
+	sess.Put("username", "alice")
+	if err := s.sm.Store.Write(context.Background(), sess); err != nil {
+		t.Fatalf("error writing session. Err: %v", err)
+	}
+
+	conn, err := net.Dial("tcp", strings.TrimPrefix(server.URL, "http://"))
+	if err != nil {
+		t.Fatalf("error dialing server. Err: %v", err)
+	}
+	defer conn.Close()
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/ws", nil)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+	req.AddCookie(&http.Cookie{Name: "GOSESSID", Value: sess.ID})
+	req.Write(conn)
+	resp, err := http.ReadResponse(bufio.NewReader(conn), req)
+	if err != nil {
+		t.Fatalf("error reading handshake response. Err: %v", err)
+	}
+
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("expected status %d; got %d", http.StatusSwitchingProtocols, resp.StatusCode)
+	}
+	// The session is saved and its cookie renewed with the handshake
+	if len(resp.Cookies()) != 1 || resp.Cookies()[0].Value != sess.ID {
+		t.Errorf("expected the session cookie; got %v", resp.Cookies())
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for !s.hub.Connected("alice") && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !s.hub.Connected("alice") {
+		t.Errorf("expected alice to be connected")
+	}
+}
+
+func TestEventStreamSession(t *testing.T) {
+	s := &Server{sm: session.NewSessionManager(store.NewInMemorySessionStore(), "GOSESSID", time.Minute, time.Hour)}
+	s.events = s.newBroker()
+	server := httptest.NewServer(s.sm.SessionMiddleware(s.events))
+	defer server.Close()
+	defer s.events.Close()
+
+	sess, _ := session.NewSession()
+	sess.Put("username", "alice")
+	if err := s.sm.Store.Write(context.Background(), sess); err != nil {
+		t.Fatalf("error writing session. Err: %v", err)
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/events", nil)
+	req.AddCookie(&http.Cookie{Name: "GOSESSID", Value: sess.ID})
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("error opening event stream. Err: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("expected Content-Type text/event-stream; got %q", ct)
+	}
+	// The headers, with the session cookie, are flushed before any event
+	if len(resp.Cookies()) != 1 || resp.Cookies()[0].Value != sess.ID {
+		t.Errorf("expected the session cookie; got %v", resp.Cookies())
+	}
+	br := bufio.NewReader(resp.Body)
+	if line, _ := br.ReadString('\n'); line != "retry: 3000\n" {
+		t.Errorf("expected the retry field; got %q", line)
+	}
+	br.ReadString('\n')
+
+	s.events.Publish("alice", sse.Event{Name: "greeting", Data: "hello"})
+	var event strings.Builder
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			t.Fatalf("error reading event. Err: %v", err)
+		}
+		if line == "\n" {
+			break
+		}
+		event.WriteString(line)
+	}
+	if got := event.String(); got != "id: 1\nevent: greeting\ndata: hello\n" {
+		t.Errorf("expected the event to be flushed; got %q", got)
+	}
+}
@@ -0,0 +1,128 @@
+package server
+
+import (
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/raziel-aleman/go-starter/internal/auth"
+	"github.com/raziel-aleman/go-starter/internal/auth/saml"
+)
+
+// SAMLMetadataHandler serves the service provider metadata to register at the identity provider.
+func (s *Server) SAMLMetadataHandler(w http.ResponseWriter, r *http.Request) {
+	if s.saml == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	metadata, err := s.saml.Metadata()
+	if err != nil {
+		s.log().ErrorContext(r.Context(), "Failed to generate metadata", "err", err)
+		http.Error(w, "Failed to generate metadata", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/samlmetadata+xml")
+	w.Write(metadata)
+}
+
+// SAMLLoginHandler redirects the user to the identity provider.
+func (s *Server) SAMLLoginHandler(w http.ResponseWriter, r *http.Request) {
+	if s.saml == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	loginURL, err := s.saml.LoginURL()
+	if err != nil {
+		s.log().ErrorContext(r.Context(), "Failed to start login", "err", err)
+		http.Error(w, "Failed to start login", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, loginURL, http.StatusFound)
+}
+
+// SAMLACSHandler is the assertion consumer service. It validates the response
+// posted by the identity provider, provisions the local user if needed, and
+// migrates the session.
+func (s *Server) SAMLACSHandler(w http.ResponseWriter, r *http.Request) {
+	if s.saml == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	assertion, err := s.saml.ParseResponse(r.PostFormValue("SAMLResponse"), r.PostFormValue("RelayState"))
+	if err != nil {
+		s.log().InfoContext(r.Context(), "Invalid SAML response", "err", err)
+		auth.RecordEvent(r, s.db, auth.EventLoginFailure, "", "saml")
+		http.Error(w, "Login failed", http.StatusUnauthorized)
+		return
+	}
+
+	user, err := auth.ProvisionSAMLUser(r.Context(), s.db, assertion, s.samlAttributes)
+	if errors.Is(err, auth.ErrAccountDisabled) {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		s.log().ErrorContext(r.Context(), "Failed to provision SAML user", "err", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	s.completeExternalLogin(w, r, user, "saml")
+}
+
+// newServiceProvider enables SAML login when SAML_IDP_SSO_URL is set. The
+// certificate of the identity provider is read from SAML_IDP_CERT, either a
+// PEM block or the path of a PEM file.
+func newServiceProvider(port int) (*saml.ServiceProvider, error) {
+	ssoURL := os.Getenv("SAML_IDP_SSO_URL")
+	if ssoURL == "" {
+		return nil, nil
+	}
+
+	cert, err := loadCertificate(os.Getenv("SAML_IDP_CERT"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid SAML_IDP_CERT: %v", err)
+	}
+
+	// The relay state only has to survive a single login
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+
+	baseURL := envOr("SAML_BASE_URL", fmt.Sprintf("http://localhost:%d", port))
+	return saml.New(saml.Config{
+		EntityID:       baseURL + "/saml/metadata",
+		ACSURL:         baseURL + "/saml/acs",
+		IdPEntityID:    os.Getenv("SAML_IDP_ENTITY_ID"),
+		IdPSSOURL:      ssoURL,
+		IdPCertificate: cert,
+		Key:            key,
+	})
+}
+
+// loadCertificate parses a PEM encoded certificate, or the file holding it.
+func loadCertificate(value string) (*x509.Certificate, error) {
+	data := []byte(value)
+	if !strings.Contains(value, "-----BEGIN") {
+		var err error
+		if data, err = os.ReadFile(value); err != nil {
+			return nil, err
+		}
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, errors.New("no PEM certificate found")
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
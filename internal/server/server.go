@@ -1,53 +1,567 @@
 package server
 
 import (
+	"context"
+	"crypto/rand"
 	"fmt"
+	"io"
+	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	_ "github.com/joho/godotenv/autoload"
+	"github.com/quic-go/quic-go/http3"
 
+	"github.com/raziel-aleman/go-starter/internal/auth"
+	"github.com/raziel-aleman/go-starter/internal/auth/captcha"
+	"github.com/raziel-aleman/go-starter/internal/auth/oauth"
+	"github.com/raziel-aleman/go-starter/internal/auth/oauthserver"
+	"github.com/raziel-aleman/go-starter/internal/auth/saml"
+	"github.com/raziel-aleman/go-starter/internal/auth/webauthn"
+	"github.com/raziel-aleman/go-starter/internal/autotls"
 	"github.com/raziel-aleman/go-starter/internal/database"
+	"github.com/raziel-aleman/go-starter/internal/jwt"
+	"github.com/raziel-aleman/go-starter/internal/mail"
+	"github.com/raziel-aleman/go-starter/internal/ratelimit"
+	"github.com/raziel-aleman/go-starter/internal/requestid"
 	"github.com/raziel-aleman/go-starter/internal/session"
+	"github.com/raziel-aleman/go-starter/internal/sse"
+	"github.com/raziel-aleman/go-starter/internal/static"
 	"github.com/raziel-aleman/go-starter/internal/store"
+	"github.com/raziel-aleman/go-starter/internal/ws"
 )
 
 type Server struct {
-	port int
-	db   database.Service
-	sm   *session.SessionManager
+	logger *slog.Logger
+	port   int
+	db     database.Service
+	sm     *session.SessionManager
+	tokens *jwt.Manager
+	oauth  oauth.Registry
+	// Authorization server issuing codes and tokens to third-party clients
+	oauthServer *oauthserver.Server
+	mailer      mail.Mailer
+	// Relying party for passkey registration and login
+	webauthn *webauthn.RelyingParty
+	// Login attempt throttling per client IP and username
+	loginLimiter *auth.LoginLimiter
+	// Request rate limit per client IP, nil if disabled
+	requestLimiter *ratelimit.TokenBucket
+	// Stricter rate limits per client IP of some routes, by mux pattern
+	routeLimiters map[string]*ratelimit.TokenBucket
+	// Requirements for new passwords
+	passwordPolicy auth.PasswordPolicy
+	// Whether anyone can register or only users with an invitation
+	registration auth.RegistrationMode
+	// How long after authenticating users can take sensitive actions without reauthenticating
+	recentAuthMaxAge time.Duration
+	// SAML service provider, nil unless an identity provider is configured
+	saml *saml.ServiceProvider
+	// Assertion attributes mapped to the provisioned SAML users
+	samlAttributes auth.SAMLAttributes
+	// Basic auth credentials guarding internal endpoints, by username
+	internalUsers map[string][]byte
+	// Usernames of the client certificates allowed on internal endpoints, by certificate identity
+	certUsers map[string]string
+	// CAPTCHA required on registration and, after failures, on login; nil if disabled
+	captcha captcha.Challenge
+	// Resolves the tenant scoping the database queries of a request; nil if single-tenant
+	tenants tenantResolver
+	// Request header naming the tenant when tenants are resolved by header
+	tenantHeader string
+	// Cross-origin requests allowed from browsers
+	cors corsConfig
+	// CSS, JavaScript and images embedded in the binary, served under /static/
+	static *static.Assets
+	// WebSocket connections of logged-in users, to push messages to them
+	hub *ws.Hub
+	// Server-Sent Event streams of logged-in users, to push events to them
+	events *sse.Broker
+	// Plain HTTP listener answering ACME challenges; nil unless certificates are obtained automatically
+	challengeServer *http.Server
+	// QUIC listener serving HTTP/3 on the UDP port of the server; nil unless enabled by HTTP_PROTOCOLS
+	http3Server *http3.Server
 }
 
-func NewServer() *http.Server {
+// NewServer configures the HTTP server and the services its handlers use.
+// The returned Closer releases those services, once the HTTP server is shut down.
+func NewServer() (*http.Server, io.Closer) {
+	// Structured logs, also receiving the output of the log package
+	logger, err := newLogger()
+	if err != nil {
+		log.Fatal(err)
+	}
+	slog.SetDefault(logger)
+
 	port, _ := strconv.Atoi(os.Getenv("PORT"))
 
 	// Initialize the session store (using in-memory for this example)
-	store := store.NewInMemorySessionStore()
+	sessionStore := store.NewInMemorySessionStore()
 
 	// Configure session manager parameters
 	sessionManager := session.NewSessionManager(
-		store,
+		sessionStore,
 		"GOSESSID",     // Name of the session cookie
 		30*time.Minute, // Idle expiration: session expires after 30 minutes of inactivity
 		24*time.Hour,   // Absolute expiration: session expires after 24 hours regardless of activity
 	)
+	sessionManager.Logger = logger
+	// Read-only requests extend the idle expiration unless disabled
+	sessionManager.TouchOnRead = os.Getenv("SESSION_TOUCH_ON_READ") != "false"
+
+	// Expiration policy: sliding (default), fixed, or hybrid with a renewal threshold
+	policy, err := session.ParseExpirationPolicy(os.Getenv("SESSION_EXPIRATION_POLICY"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	sessionManager.ExpirationPolicy = policy
+	sessionManager.RenewalThreshold = 10 * time.Minute
+	if threshold, err := time.ParseDuration(os.Getenv("SESSION_RENEWAL_THRESHOLD")); err == nil {
+		sessionManager.RenewalThreshold = threshold
+	}
+
+	// Do not set cookies for anonymous visitors until they consent
+	sessionManager.RequireConsent = os.Getenv("SESSION_REQUIRE_CONSENT") == "true"
+
+	// Paths skipping CSRF verification: token endpoints and e.g. webhook receivers
+	sessionManager.CSRFExemptPaths = []string{"/token", "/oauth/token", apiPrefix + "token"}
+	sessionManager.CSRFExemptFuncs = append(sessionManager.CSRFExemptFuncs, isAPIBearerRequest)
+	if paths := os.Getenv("CSRF_EXEMPT_PATHS"); paths != "" {
+		sessionManager.CSRFExemptPaths = append(sessionManager.CSRFExemptPaths, strings.Split(paths, ",")...)
+	}
+
+	// SAML login through an identity provider
+	serviceProvider, err := newServiceProvider(port)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if serviceProvider != nil {
+		// Responses are posted cross-site by the identity provider and are signed
+		sessionManager.CSRFExemptPaths = append(sessionManager.CSRFExemptPaths, "/saml/acs")
+	}
+
+	// Origins allowed to send state-changing requests, checked against Origin/Referer
+	if origins := os.Getenv("CSRF_TRUSTED_ORIGINS"); origins != "" {
+		sessionManager.CSRFTrustedOrigins = strings.Split(origins, ",")
+	}
+
+	// Token-authenticated API requests carry no ambient credentials
+	sessionManager.SkipCSRFForBearer = os.Getenv("CSRF_SKIP_BEARER") == "true"
+
+	// Cost of password hashes, existing hashes are upgraded on login
+	if cost := os.Getenv("BCRYPT_COST"); cost != "" {
+		n, err := strconv.Atoi(cost)
+		if err != nil {
+			log.Fatalf("invalid BCRYPT_COST: %v", err)
+		}
+		if err := auth.SetBcryptCost(n); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	db, err := database.New()
+	if err != nil {
+		log.Fatal(err)
+	}
+	// Sessions are kept in memory unless SESSION_STORE=sql shares them through the database
+	if os.Getenv("SESSION_STORE") == "sql" {
+		codec, err := newSessionCodec()
+		if err != nil {
+			log.Fatal(err)
+		}
+		sqlStore := store.NewSQLSessionStore(db, codec)
+		// Each row records when the session expires, under its own timeouts
+		sqlStore.ExpiresAt = sessionManager.ExpiresAt
+		sessionManager.Store = sqlStore
+	}
+
+	// Login attempt throttling, and CAPTCHA after CAPTCHA_LOGIN_AFTER attempts of an account
+	rateLimitStore := newRateLimitStore()
+	loginLimiter := auth.NewLoginLimiter(
+		rateLimitStore,
+		20,             // Attempts per client IP
+		5,              // Attempts per username
+		15*time.Minute, // Window
+	)
+	requestLimiter, err := newRequestLimiter(rateLimitStore)
+	if err != nil {
+		log.Fatal(err)
+	}
+	routeLimiters, err := newRouteLimiters(rateLimitStore)
+	if err != nil {
+		log.Fatal(err)
+	}
+	challenge := newChallenge()
+	if n, err := strconv.Atoi(os.Getenv("CAPTCHA_LOGIN_AFTER")); err == nil && challenge != nil {
+		loginLimiter.ChallengeAfter = ratelimit.NewLimiter(rateLimitStore, "login:captcha:", n, 15*time.Minute)
+	}
+
+	// Token manager for the JWT authentication mode
+	secret := []byte(os.Getenv("JWT_SECRET"))
+	if len(secret) == 0 {
+		logger.Warn("JWT_SECRET not set, using a random secret: tokens will not survive restarts")
+		secret = make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			log.Fatal(err)
+		}
+	}
+	tokens := jwt.NewManager(
+		secret,
+		15*time.Minute, // Access tokens are short-lived
+		7*24*time.Hour, // Refresh tokens are rotated on every use
+		jwt.NewDatabaseRefreshStore(db),
+	)
+	// Disabled and banned users cannot refresh their tokens
+	tokens.Authorize = auth.EnsureEnabled(db)
+	tenantHeader := envOr("TENANT_HEADER", "X-Tenant-ID")
+	tenants, err := newTenantResolver(os.Getenv("TENANT_MODE"), os.Getenv("TENANT_BASE_DOMAIN"), tenantHeader)
+	if err != nil {
+		log.Fatal(err)
+	}
+	corsHeaders := []string{sessionManager.CSRFHeaderName, requestid.Header}
+	if tenants != nil {
+		corsHeaders = append(corsHeaders, tenantHeader)
+	}
+	cors, err := newCORSConfig(corsHeaders...)
+	if err != nil {
+		log.Fatal(err)
+	}
+	assets, err := static.Embedded("/static/")
+	if err != nil {
+		log.Fatal(err)
+	}
+	// Tokens issued to OAuth clients have an audience of their own, so they
+	// are only accepted by the routes checking scopes, never as first-party tokens
+	oauthTokens := jwt.NewManager(secret, 15*time.Minute, 7*24*time.Hour, jwt.NewDatabaseRefreshStore(db))
+	oauthTokens.Audience = oauthAudience
+	oauthTokens.Authorize = auth.EnsureEnabled(db)
+	oauthServer := oauthserver.New(oauthserver.NewDatabaseStore(db), oauthTokens)
+	oauthServer.CSRFFieldName = sessionManager.CSRFFieldName
 
 	NewServer := &Server{
-		port: port,
-		db:   database.New(),
-		sm:   sessionManager,
+		logger:      logger,
+		port:        port,
+		db:          db,
+		sm:          sessionManager,
+		tokens:      tokens,
+		oauth:       newOAuthRegistry(port),
+		oauthServer: oauthServer,
+		mailer:      newMailer(),
+		webauthn: webauthn.New(webauthn.Config{
+			RPID:    envOr("WEBAUTHN_RP_ID", "localhost"),
+			RPName:  "go-starter",
+			Origins: strings.Split(envOr("WEBAUTHN_RP_ORIGINS", fmt.Sprintf("http://localhost:5173,http://localhost:%d", port)), ","),
+		}),
+		loginLimiter:     loginLimiter,
+		requestLimiter:   requestLimiter,
+		routeLimiters:    routeLimiters,
+		passwordPolicy:   newPasswordPolicy(),
+		registration:     newRegistrationMode(),
+		recentAuthMaxAge: 10 * time.Minute,
+		saml:             serviceProvider,
+		samlAttributes: auth.SAMLAttributes{
+			Username:    os.Getenv("SAML_USERNAME_ATTRIBUTE"),
+			Email:       envOr("SAML_EMAIL_ATTRIBUTE", "email"),
+			DisplayName: envOr("SAML_NAME_ATTRIBUTE", "displayName"),
+		},
+		internalUsers: parseInternalUsers(os.Getenv("INTERNAL_USERS")),
+		certUsers:     parseCertUsers(os.Getenv("CLIENT_CERT_USERS")),
+		captcha:       challenge,
+		tenants:       tenants,
+		tenantHeader:  tenantHeader,
+		cors:          cors,
+		static:        assets,
+	}
+
+	NewServer.hub = NewServer.newHub()
+	NewServer.events = NewServer.newBroker()
+
+	if maxAge, err := time.ParseDuration(os.Getenv("REAUTH_MAX_AGE")); err == nil {
+		NewServer.recentAuthMaxAge = maxAge
+	}
+
+	// Grant the admin role to the bootstrap users, which must already be registered
+	if admins := os.Getenv("ADMIN_USERS"); admins != "" {
+		for _, username := range strings.Split(admins, ",") {
+			if canonical, err := NewServer.db.CanonicalUsername(context.Background(), username); err == nil {
+				username = canonical
+			}
+			if err := auth.AssignRole(context.Background(), NewServer.db, username, auth.RoleAdmin); err != nil {
+				slog.Error("Failed to grant the admin role", "username", username, "err", err)
+			}
+		}
 	}
 
 	// Declare Server config
+	protocols, serveHTTP3 := newProtocols(os.Getenv("HTTP_PROTOCOLS"))
 	server := &http.Server{
 		Addr:         fmt.Sprintf(":%d", NewServer.port),
 		Handler:      NewServer.RegisterRoutes(),
 		IdleTimeout:  time.Minute,
 		ReadTimeout:  10 * time.Second,
 		WriteTimeout: 30 * time.Second,
+		Protocols:    protocols,
+	}
+	// Shutting down waits for the requests in flight, event streams included
+	server.RegisterOnShutdown(NewServer.events.Close)
+
+	// Serve HTTPS when a certificate file is configured, verifying client
+	// certificates against TLS_CLIENT_CA_FILE if set
+	if certFile, keyFile := os.Getenv("TLS_CERT_FILE"), os.Getenv("TLS_KEY_FILE"); certFile != "" && keyFile != "" {
+		server.TLSConfig, err = auth.NewServerTLSConfig(certFile, keyFile, os.Getenv("TLS_CLIENT_CA_FILE"))
+		if err != nil {
+			log.Fatal(err)
+		}
+	} else if hosts := os.Getenv("TLS_AUTOCERT_HOSTS"); hosts != "" {
+		// Or obtain certificates for TLS_AUTOCERT_HOSTS from Let's Encrypt, or
+		// another ACME certificate authority, answering its challenges on port 80
+		manager := autotls.New(envOr("TLS_AUTOCERT_CACHE_DIR", "certs"), os.Getenv("TLS_AUTOCERT_EMAIL"), strings.Split(hosts, ","))
+		if url := os.Getenv("TLS_AUTOCERT_DIRECTORY_URL"); url != "" {
+			manager.DirectoryURL = url
+		}
+		server.TLSConfig = manager.TLSConfig()
+		NewServer.challengeServer = &http.Server{
+			Addr:         envOr("TLS_AUTOCERT_HTTP_ADDR", ":80"),
+			Handler:      manager.HTTPHandler(nil),
+			ReadTimeout:  10 * time.Second,
+			WriteTimeout: 10 * time.Second,
+		}
+		go func() {
+			if err := NewServer.challengeServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Fatalf("ACME challenge listener error: %v", err)
+			}
+		}()
+	}
+
+	// HTTP/3 is served with the certificates of the HTTPS server, once the
+	// handler and TLS configuration are final
+	if serveHTTP3 {
+		if server.TLSConfig == nil {
+			log.Fatal("HTTP/3 requires TLS: set TLS_CERT_FILE and TLS_KEY_FILE, or TLS_AUTOCERT_HOSTS")
+		}
+		NewServer.http3Server = newHTTP3Server(server)
+		go func() {
+			if err := NewServer.http3Server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Fatalf("HTTP/3 listener error: %v", err)
+			}
+		}()
+	}
+
+	return server, NewServer
+}
+
+// Close stops the ACME challenge and HTTP/3 listeners and the session
+// garbage collection, and closes the database.
+func (s *Server) Close() error {
+	if s.challengeServer != nil {
+		s.challengeServer.Close()
+	}
+	if s.http3Server != nil {
+		s.http3Server.Close()
+	}
+	// Shutting down the HTTP server leaves the WebSocket connections open
+	s.hub.Close()
+	s.events.Close()
+	s.sm.Close()
+	return s.db.Close()
+}
+
+// envOr returns the value of the environment variable, or fallback if it is unset.
+func envOr(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// baseURL returns the public URL of the server, used to build links and redirects.
+func (s *Server) baseURL() string {
+	return "http://localhost:" + strconv.Itoa(s.port)
+}
+
+// parseInternalUsers parses a comma-separated list of "username:password"
+// credentials for the internal endpoints.
+func parseInternalUsers(value string) map[string][]byte {
+	users := map[string][]byte{}
+	for _, credentials := range strings.Split(value, ",") {
+		username, password, ok := strings.Cut(strings.TrimSpace(credentials), ":")
+		if !ok || username == "" || password == "" {
+			continue
+		}
+		users[username] = []byte(password)
+	}
+	return users
+}
+
+// parseCertUsers parses a comma-separated list of "identity=username" pairs
+// mapping client certificate identities, a SAN or common name, to users.
+func parseCertUsers(value string) map[string]string {
+	users := map[string]string{}
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		// Identities like URIs may contain "=", usernames do not
+		i := strings.LastIndex(pair, "=")
+		if i <= 0 || i == len(pair)-1 {
+			continue
+		}
+		users[pair[:i]] = pair[i+1:]
+	}
+	return users
+}
+
+// newProtocols reads HTTP_PROTOCOLS, a comma-separated list of http1, http2
+// (over TLS), h2c, HTTP/2 over cleartext connections for load balancers
+// speaking it to their backends, e.g. for gRPC, and http3, an experimental
+// HTTP/3 listener on the UDP port of the HTTPS server. Defaults to
+// http1,http2. It returns the protocols of the TCP server, and whether HTTP/3
+// is enabled.
+func newProtocols(value string) (*http.Protocols, bool) {
+	protocols := &http.Protocols{}
+	serveHTTP3 := false
+	if value == "" {
+		value = "http1,http2"
+	}
+	for _, name := range strings.Split(value, ",") {
+		switch strings.TrimSpace(name) {
+		case "http1":
+			protocols.SetHTTP1(true)
+		case "http2":
+			protocols.SetHTTP2(true)
+		case "h2c":
+			protocols.SetUnencryptedHTTP2(true)
+		case "h3", "http3":
+			serveHTTP3 = true
+		default:
+			log.Fatalf("invalid HTTP_PROTOCOLS: %s", value)
+		}
+	}
+	return protocols, serveHTTP3
+}
+
+// newMailer sends email through SMTP when SMTP_HOST is set, and to the log otherwise.
+func newMailer() mail.Mailer {
+	host := os.Getenv("SMTP_HOST")
+	if host == "" {
+		return mail.LogMailer{}
+	}
+	return mail.NewSMTPMailer(
+		host+":"+envOr("SMTP_PORT", "587"),
+		envOr("MAIL_FROM", "no-reply@localhost"),
+		os.Getenv("SMTP_USERNAME"),
+		os.Getenv("SMTP_PASSWORD"),
+	)
+}
+
+// newPasswordPolicy customizes the default password policy with PASSWORD_MIN_LENGTH,
+// PASSWORD_REQUIRE, a comma-separated list of upper, lower, digit, and symbol,
+// and PASSWORD_BREACH_CHECK.
+func newPasswordPolicy() auth.PasswordPolicy {
+	policy := auth.DefaultPasswordPolicy
+	if n, err := strconv.Atoi(os.Getenv("PASSWORD_MIN_LENGTH")); err == nil {
+		policy.MinLength = n
+	}
+	for _, class := range strings.Split(os.Getenv("PASSWORD_REQUIRE"), ",") {
+		switch strings.TrimSpace(class) {
+		case "upper":
+			policy.RequireUpper = true
+		case "lower":
+			policy.RequireLower = true
+		case "digit":
+			policy.RequireDigit = true
+		case "symbol":
+			policy.RequireSymbol = true
+		}
 	}
 
-	return server
+	// Check passwords against known breaches: "reject" or "warn"
+	switch os.Getenv("PASSWORD_BREACH_CHECK") {
+	case "reject":
+		policy.Breaches = auth.NewBreachChecker(true)
+	case "warn":
+		policy.Breaches = auth.NewBreachChecker(false)
+	}
+
+	// Passwords older than PASSWORD_MAX_AGE, e.g. 2160h, must be changed on login
+	if maxAge, err := time.ParseDuration(os.Getenv("PASSWORD_MAX_AGE")); err == nil {
+		policy.MaxAge = maxAge
+	}
+	return policy
+}
+
+// newRegistrationMode reads REGISTRATION_MODE, either open (default) or invite.
+func newRegistrationMode() auth.RegistrationMode {
+	switch mode := envOr("REGISTRATION_MODE", "open"); mode {
+	case "open":
+		return auth.OpenRegistration
+	case "invite":
+		return auth.InviteOnlyRegistration
+	default:
+		log.Fatalf("invalid REGISTRATION_MODE: %s", mode)
+		return auth.OpenRegistration
+	}
+}
+
+// newChallenge enables CAPTCHA verification with CAPTCHA_PROVIDER, one of
+// hcaptcha, turnstile, or recaptcha, and CAPTCHA_SECRET.
+func newChallenge() captcha.Challenge {
+	secret := os.Getenv("CAPTCHA_SECRET")
+	switch os.Getenv("CAPTCHA_PROVIDER") {
+	case "hcaptcha":
+		return captcha.NewHCaptcha(secret)
+	case "turnstile":
+		return captcha.NewTurnstile(secret)
+	case "recaptcha":
+		minScore, err := strconv.ParseFloat(envOr("CAPTCHA_MIN_SCORE", "0.5"), 64)
+		if err != nil {
+			log.Fatalf("invalid CAPTCHA_MIN_SCORE: %v", err)
+		}
+		return captcha.NewReCAPTCHA(secret, minScore)
+	}
+	return nil
+}
+
+// newRateLimitStore shares rate limits through Redis when RATE_LIMIT_REDIS_ADDR
+// is set, and keeps them in memory otherwise.
+func newRateLimitStore() rateLimitStore {
+	addr := os.Getenv("RATE_LIMIT_REDIS_ADDR")
+	if addr == "" {
+		return ratelimit.NewMemoryStore()
+	}
+	return ratelimit.NewRedisStore(addr, os.Getenv("RATE_LIMIT_REDIS_PASSWORD"))
+}
+
+// newSessionCodec encodes the sessions of the SQL store with gob, gzipping
+// those of at least SESSION_COMPRESS_THRESHOLD bytes when it is set. Changing
+// it makes the stored sessions unreadable, so their users log in again.
+func newSessionCodec() (session.Codec, error) {
+	value := os.Getenv("SESSION_COMPRESS_THRESHOLD")
+	if value == "" {
+		return session.GobCodec{}, nil
+	}
+	threshold, err := strconv.Atoi(value)
+	if err != nil || threshold < 0 {
+		return nil, fmt.Errorf("invalid SESSION_COMPRESS_THRESHOLD %q", value)
+	}
+	return session.NewCompressedCodec(session.GobCodec{}, threshold), nil
+}
+
+// newOAuthRegistry enables the identity providers whose client credentials are set.
+func newOAuthRegistry(port int) oauth.Registry {
+	baseURL := os.Getenv("OAUTH_REDIRECT_BASE_URL")
+	if baseURL == "" {
+		baseURL = fmt.Sprintf("http://localhost:%d", port)
+	}
+
+	var providers []oauth.Provider
+	if id := os.Getenv("OAUTH_GOOGLE_CLIENT_ID"); id != "" {
+		providers = append(providers, oauth.NewGoogle(id, os.Getenv("OAUTH_GOOGLE_CLIENT_SECRET"), baseURL+"/auth/google/callback"))
+	}
+	if id := os.Getenv("OAUTH_GITHUB_CLIENT_ID"); id != "" {
+		providers = append(providers, oauth.NewGitHub(id, os.Getenv("OAUTH_GITHUB_CLIENT_SECRET"), baseURL+"/auth/github/callback"))
+	}
+	return oauth.NewRegistry(providers...)
 }
@@ -0,0 +1,43 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/raziel-aleman/go-starter/internal/auth"
+	sm "github.com/raziel-aleman/go-starter/internal/session"
+)
+
+// MeSessionsHandler lists the active sessions of the logged-in user.
+func (s *Server) MeSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	sessions, err := auth.ListSessions(r, s.sm)
+	if err != nil {
+		s.log().ErrorContext(r.Context(), "Failed to list sessions", "err", err)
+		http.Error(w, "Failed to list sessions", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, sessions)
+}
+
+// MeSessionRevokeHandler logs out another session of the logged-in user.
+func (s *Server) MeSessionRevokeHandler(w http.ResponseWriter, r *http.Request) {
+	err := auth.RevokeSession(r, s.sm, r.PathValue("id"))
+	if errors.Is(err, auth.ErrSessionNotFound) {
+		http.NotFound(w, r)
+		return
+	}
+	if errors.Is(err, auth.ErrCurrentSession) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		s.log().ErrorContext(r.Context(), "Failed to revoke session", "err", err)
+		http.Error(w, "Failed to revoke session", http.StatusInternalServerError)
+		return
+	}
+
+	username, _ := sm.GetSession(r).Get("username").(string)
+	auth.RecordEvent(r, s.db, auth.EventSessionRevoked, username, "by user")
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,23 @@
+package server
+
+import (
+	"os"
+	"time"
+
+	"github.com/raziel-aleman/go-starter/internal/sse"
+)
+
+// newBroker returns the broker of the Server-Sent Event streams of logged-in
+// users. SSE_HEARTBEAT and SSE_RETRY override the interval between heartbeats
+// and the reconnection delay advised to clients.
+func (s *Server) newBroker() *sse.Broker {
+	broker := sse.NewBroker(callerName)
+	broker.Logger = s.log()
+	if heartbeat, err := time.ParseDuration(os.Getenv("SSE_HEARTBEAT")); err == nil && heartbeat > 0 {
+		broker.Heartbeat = heartbeat
+	}
+	if retry, err := time.ParseDuration(os.Getenv("SSE_RETRY")); err == nil && retry >= 0 {
+		broker.Retry = retry
+	}
+	return broker
+}
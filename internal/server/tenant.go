@@ -0,0 +1,80 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/raziel-aleman/go-starter/internal/database"
+)
+
+// Tenant resolution modes, selected with TENANT_MODE.
+const (
+	TenantBySubdomain = "subdomain" // acme.example.com is tenant acme of TENANT_BASE_DOMAIN example.com
+	TenantByHeader    = "header"    // The TENANT_HEADER request header, X-Tenant-ID by default
+)
+
+// errUnknownTenant is returned for requests naming an invalid tenant.
+var errUnknownTenant = errors.New("unknown tenant")
+
+// tenantID matches valid tenant ids, usable as DNS labels.
+var tenantID = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$`)
+
+// tenantResolver returns the tenant of a request, "" for the default tenant.
+type tenantResolver func(r *http.Request) (string, error)
+
+// newTenantResolver returns the resolver of a mode, nil if mode is empty.
+func newTenantResolver(mode string, baseDomain string, header string) (tenantResolver, error) {
+	switch mode {
+	case "":
+		return nil, nil
+	case TenantBySubdomain:
+		if baseDomain == "" {
+			return nil, errors.New("TENANT_BASE_DOMAIN is required to resolve tenants by subdomain")
+		}
+		baseDomain = strings.ToLower(baseDomain)
+		return func(r *http.Request) (string, error) {
+			host := r.Host
+			if h, _, err := net.SplitHostPort(host); err == nil {
+				host = h
+			}
+			host = strings.ToLower(host)
+			if host == baseDomain {
+				return "", nil
+			}
+			tenant, ok := strings.CutSuffix(host, "."+baseDomain)
+			if !ok || !tenantID.MatchString(tenant) {
+				return "", errUnknownTenant
+			}
+			return tenant, nil
+		}, nil
+	case TenantByHeader:
+		return func(r *http.Request) (string, error) {
+			tenant := r.Header.Get(header)
+			if tenant != "" && !tenantID.MatchString(tenant) {
+				return "", errUnknownTenant
+			}
+			return tenant, nil
+		}, nil
+	}
+	return nil, fmt.Errorf("unsupported TENANT_MODE %q, use %s or %s", mode, TenantBySubdomain, TenantByHeader)
+}
+
+// tenantMiddleware scopes the database queries of each request to its
+// tenant, so users and sessions of other tenants do not exist for it.
+func (s *Server) tenantMiddleware(next http.Handler) http.Handler {
+	if s.tenants == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tenant, err := s.tenants(r)
+		if err != nil {
+			http.Error(w, "Unknown tenant", http.StatusNotFound)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(database.WithTenant(r.Context(), tenant)))
+	})
+}
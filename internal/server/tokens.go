@@ -0,0 +1,127 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/raziel-aleman/go-starter/internal/auth"
+	"github.com/raziel-aleman/go-starter/internal/jwt"
+)
+
+// tokenRequest is the body of the token login endpoint.
+type tokenRequest struct {
+	Username string `json:"username" validate:"required,max=254"`
+	Password string `json:"password" validate:"required,max=1024"`
+	Code     string `json:"code,omitempty"`  // Two-factor code, if enabled
+	Scope    string `json:"scope,omitempty"` // Space-separated scopes restricting the tokens
+}
+
+// refreshRequest is the body of the refresh and revoke endpoints.
+type refreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// TokenHandler exchanges user credentials for an access and refresh token pair.
+func (s *Server) TokenHandler(w http.ResponseWriter, r *http.Request) {
+	var req tokenRequest
+	if !decodeValid(w, r, &req) {
+		return
+	}
+
+	key, err := auth.LoginKey(r.Context(), s.db, req.Username)
+	if err != nil {
+		s.log().ErrorContext(r.Context(), "Failed to check login attempts", "err", err)
+		http.Error(w, "Failed to check login attempts", http.StatusInternalServerError)
+		return
+	}
+	err = s.loginLimiter.Check(r.Context(), r, key)
+	if auth.WriteTooManyAttempts(w, err) {
+		return
+	}
+	if err != nil {
+		s.log().ErrorContext(r.Context(), "Failed to check login attempts", "err", err)
+		http.Error(w, "Failed to check login attempts", http.StatusInternalServerError)
+		return
+	}
+
+	user := auth.User{Username: req.Username, Password: []byte(req.Password)}
+	pair, err := auth.TokenLogin(r.Context(), s.db, s.tokens, s.passwordPolicy, user, req.Code, strings.Fields(req.Scope))
+	if errors.Is(err, auth.ErrInvalidScope) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, auth.ErrPasswordExpired) {
+		http.Error(w, "Password expired, change it to continue", http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		s.log().InfoContext(r.Context(), "Token login failed", "username", req.Username, "err", err)
+		auth.RecordEvent(r, s.db, auth.EventLoginFailure, req.Username, "token")
+		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
+		return
+	}
+	if err := s.loginLimiter.Succeeded(r.Context(), key); err != nil {
+		s.log().ErrorContext(r.Context(), "Failed to reset login attempts", "username", req.Username, "err", err)
+	}
+	auth.RecordEvent(r, s.db, auth.EventLoginSuccess, req.Username, "token")
+
+	writeJSON(w, http.StatusOK, pair)
+}
+
+// TokenRefreshHandler rotates a refresh token, returning a new token pair.
+func (s *Server) TokenRefreshHandler(w http.ResponseWriter, r *http.Request) {
+	var req refreshRequest
+	if err := readJSON(r, &req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	pair, err := s.tokens.Refresh(r.Context(), req.RefreshToken)
+	if errors.Is(err, jwt.ErrRefreshTokenReused) {
+		s.log().WarnContext(r.Context(), "Refresh token reused, token family revoked", "err", err)
+		auth.RecordEvent(r, s.db, auth.EventSessionRevoked, "", "refresh token reuse")
+	}
+	if errors.Is(err, jwt.ErrInvalidRefreshToken) {
+		http.Error(w, "Invalid refresh token", http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		s.log().ErrorContext(r.Context(), "Failed to refresh token", "err", err)
+		http.Error(w, "Failed to refresh token", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, pair)
+}
+
+// TokenRevokeHandler invalidates a refresh token and the tokens rotated from it.
+func (s *Server) TokenRevokeHandler(w http.ResponseWriter, r *http.Request) {
+	var req refreshRequest
+	if err := readJSON(r, &req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.tokens.Revoke(r.Context(), req.RefreshToken); err != nil {
+		s.log().ErrorContext(r.Context(), "Failed to revoke token", "err", err)
+		http.Error(w, "Failed to revoke token", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// TokenProtectedHandler is a simple route that will be wrapped with the JWTMiddleware.
+func (s *Server) TokenProtectedHandler(w http.ResponseWriter, r *http.Request) {
+	claims, _ := auth.ClaimsFromContext(r.Context())
+	fmt.Fprintf(w, "Welcome, %s! This is a token protected area.\n", claims.Subject)
+}
+
+// BearerProtectedHandler is a simple route that will be wrapped with the
+// BearerMiddleware, accepting access tokens and API keys.
+func (s *Server) BearerProtectedHandler(w http.ResponseWriter, r *http.Request) {
+	principal, _ := auth.PrincipalFromContext(r.Context())
+	fmt.Fprintf(w, "Welcome, %s! This area is protected by a %s bearer token.\n", principal.Username, principal.Method)
+}
@@ -0,0 +1,121 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/raziel-aleman/go-starter/internal/auth"
+	sm "github.com/raziel-aleman/go-starter/internal/session"
+)
+
+// totpIssuer is the issuer name shown in authenticator apps.
+const totpIssuer = "go-starter"
+
+// twoFactorRequest is the body of the 2FA endpoints.
+type twoFactorRequest struct {
+	Code string `json:"code"`
+	// Current TOTP or recovery code, required to re-enroll with 2FA enabled
+	CurrentCode string `json:"current_code"`
+}
+
+// TwoFactorEnableHandler enrolls the logged-in user in TOTP two-factor authentication.
+// Without a code it provisions a new secret; with a code from the authenticator
+// app it enables 2FA and returns the recovery codes. Re-enrolling while 2FA is
+// enabled requires a current code.
+func (s *Server) TwoFactorEnableHandler(w http.ResponseWriter, r *http.Request) {
+	var req twoFactorRequest
+	if err := readJSON(r, &req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	username, _ := sm.GetSession(r).Get("username").(string)
+
+	if req.Code == "" {
+		secret, otpauthURL, err := auth.BeginTOTPEnrollment(r.Context(), s.db, username, totpIssuer, req.CurrentCode)
+		if errors.Is(err, auth.ErrInvalidTwoFactorCode) {
+			http.Error(w, "A current two-factor code is required to re-enroll", http.StatusForbidden)
+			return
+		}
+		if err != nil {
+			s.log().ErrorContext(r.Context(), "Failed to provision two-factor secret", "err", err)
+			http.Error(w, "Failed to provision two-factor secret", http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]string{"secret": secret, "otpauth_url": otpauthURL})
+		return
+	}
+
+	codes, err := auth.EnableTOTP(r.Context(), s.db, username, req.Code)
+	if errors.Is(err, auth.ErrInvalidTwoFactorCode) {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	if err != nil {
+		s.log().ErrorContext(r.Context(), "Failed to enable two-factor authentication", "err", err)
+		http.Error(w, "Failed to enable two-factor authentication", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string][]string{"recovery_codes": codes})
+}
+
+// TwoFactorVerifyHandler completes a pending login with a TOTP or recovery code.
+func (s *Server) TwoFactorVerifyHandler(w http.ResponseWriter, r *http.Request) {
+	var req twoFactorRequest
+	if err := readJSON(r, &req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	srw, ok := w.(*sm.SessionResponseWriter)
+	if !ok {
+		http.Error(w, "Session not found", http.StatusInternalServerError)
+		return
+	}
+
+	username, method := auth.PendingLoginUser(r), auth.PendingLoginMethod(r)
+	user, err := auth.CompletePendingLogin(r, srw, s.db, s.loginLimiter, req.Code)
+	if errors.Is(err, auth.ErrInvalidTwoFactorCode) {
+		auth.RecordEvent(r, s.db, auth.EventLoginFailure, username, "two_factor")
+	}
+	if auth.WriteTooManyAttempts(w, err) {
+		return
+	}
+	if errors.Is(err, auth.ErrNoPendingLogin) || errors.Is(err, auth.ErrInvalidTwoFactorCode) {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		s.log().ErrorContext(r.Context(), "Failed to complete two-factor login", "err", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// Users who entered their password must change it once expired
+	if method == "password" {
+		if _, err := auth.CheckPasswordExpiry(r.Context(), srw.Session, s.db, s.passwordPolicy, user.Username); err != nil {
+			s.log().ErrorContext(r.Context(), "Failed to check password expiry", "username", user.Username, "err", err)
+		}
+	}
+
+	auth.RecordEvent(r, s.db, auth.EventLoginSuccess, user.Username, "two_factor")
+	s.log().InfoContext(r.Context(), "User completed two-factor login", "username", user.Username)
+	writeJSON(w, http.StatusOK, user)
+}
+
+// beginSecondFactor starts a pending login instead of logging the user in if
+// they have two-factor authentication enabled, and responds that a code must
+// be confirmed on /2fa/verify. It reports whether it wrote the response.
+func (s *Server) beginSecondFactor(w http.ResponseWriter, r *http.Request, user auth.User, method string) bool {
+	required, err := auth.TwoFactorRequired(r.Context(), s.db, user.Username)
+	if err != nil {
+		s.log().ErrorContext(r.Context(), "Failed to check two-factor authentication", "username", user.Username, "err", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return true
+	}
+	if !required {
+		return false
+	}
+	auth.BeginPendingLogin(r, user, method)
+	writeJSON(w, http.StatusAccepted, map[string]string{"status": "two_factor_required"})
+	return true
+}
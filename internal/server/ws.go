@@ -0,0 +1,30 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/raziel-aleman/go-starter/internal/ws"
+)
+
+// newHub returns the hub of the WebSocket connections of logged-in users.
+// Handshakes are accepted from the origin of the server and from the origins
+// allowed by the CORS policy, except the "*" wildcard: browsers send the
+// session cookie with cross-site handshakes, which CORS does not apply to.
+func (s *Server) newHub() *ws.Hub {
+	hub := ws.NewHub(callerName)
+	hub.Logger = s.log()
+	hub.Upgrader.CheckOrigin = func(r *http.Request) bool {
+		if ws.SameOrigin(r) {
+			return true
+		}
+		origin := r.Header.Get("Origin")
+		for _, allowed := range s.cors.Origins {
+			if allowed != "*" && strings.EqualFold(allowed, origin) {
+				return true
+			}
+		}
+		return false
+	}
+	return hub
+}
@@ -0,0 +1,144 @@
+package session
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Codec serializes sessions for stores that persist them outside the process,
+// such as Redis or a SQL table.
+type Codec interface {
+	Encode(session *Session) ([]byte, error)
+	Decode(data []byte) (*Session, error)
+}
+
+// sessionRecord is the serialized form of a Session, without its lock and change tracking.
+type sessionRecord struct {
+	ID              string
+	CreatedAt       time.Time
+	LastActive      time.Time
+	Data            map[string]any
+	Version         int64
+	IdleTimeout     time.Duration
+	AbsoluteTimeout time.Duration
+}
+
+// GobCodec encodes sessions with encoding/gob, which preserves the Go types of
+// data values. Custom types stored in sessions must be registered with gob.Register.
+type GobCodec struct{}
+
+// Encode serializes a session.
+func (GobCodec) Encode(session *Session) ([]byte, error) {
+	session.RLock()
+	record := sessionRecord{
+		ID:              session.ID,
+		CreatedAt:       session.CreatedAt,
+		LastActive:      session.LastActive,
+		Data:            session.Data,
+		Version:         session.Version,
+		IdleTimeout:     session.IdleTimeout,
+		AbsoluteTimeout: session.AbsoluteTimeout,
+	}
+	var buf bytes.Buffer
+	err := gob.NewEncoder(&buf).Encode(record)
+	session.RUnlock()
+	if err != nil {
+		return nil, fmt.Errorf("error encoding session %s: %w", session.ID, err)
+	}
+	return buf.Bytes(), nil
+}
+
+// Decode deserializes a session.
+func (GobCodec) Decode(data []byte) (*Session, error) {
+	var record sessionRecord
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&record); err != nil {
+		return nil, fmt.Errorf("error decoding session: %w", err)
+	}
+	if record.Data == nil {
+		record.Data = make(map[string]any)
+	}
+	return &Session{
+		ID:              record.ID,
+		CreatedAt:       record.CreatedAt,
+		LastActive:      record.LastActive,
+		Data:            record.Data,
+		Version:         record.Version,
+		IdleTimeout:     record.IdleTimeout,
+		AbsoluteTimeout: record.AbsoluteTimeout,
+	}, nil
+}
+
+// Payload headers written by CompressedCodec.
+const (
+	payloadRaw  byte = 0
+	payloadGzip byte = 1
+)
+
+// CompressedCodec wraps another codec and gzips payloads larger than Threshold
+// bytes. A one-byte header records whether the payload is compressed, so small
+// and large sessions decode transparently.
+type CompressedCodec struct {
+	Codec     Codec
+	Threshold int // Minimum encoded size in bytes before compressing
+	Level     int // gzip compression level, gzip.DefaultCompression if zero
+}
+
+// NewCompressedCodec creates a CompressedCodec using the default gzip level.
+func NewCompressedCodec(codec Codec, threshold int) *CompressedCodec {
+	return &CompressedCodec{Codec: codec, Threshold: threshold, Level: gzip.DefaultCompression}
+}
+
+// Encode serializes a session, compressing it if it exceeds the threshold.
+func (c *CompressedCodec) Encode(session *Session) ([]byte, error) {
+	data, err := c.Codec.Encode(session)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < c.Threshold {
+		return append([]byte{payloadRaw}, data...), nil
+	}
+
+	level := c.Level
+	if level == 0 {
+		level = gzip.DefaultCompression
+	}
+	buf := bytes.NewBuffer([]byte{payloadGzip})
+	zw, err := gzip.NewWriterLevel(buf, level)
+	if err != nil {
+		return nil, fmt.Errorf("error creating gzip writer: %w", err)
+	}
+	if _, err := zw.Write(data); err != nil {
+		return nil, fmt.Errorf("error compressing session %s: %w", session.ID, err)
+	}
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("error compressing session %s: %w", session.ID, err)
+	}
+	return buf.Bytes(), nil
+}
+
+// Decode decompresses the payload if needed and deserializes the session.
+func (c *CompressedCodec) Decode(data []byte) (*Session, error) {
+	if len(data) == 0 {
+		return nil, fmt.Errorf("error decoding session: empty payload")
+	}
+	switch data[0] {
+	case payloadRaw:
+		return c.Codec.Decode(data[1:])
+	case payloadGzip:
+		zr, err := gzip.NewReader(bytes.NewReader(data[1:]))
+		if err != nil {
+			return nil, fmt.Errorf("error decompressing session: %w", err)
+		}
+		defer zr.Close()
+		raw, err := io.ReadAll(zr)
+		if err != nil {
+			return nil, fmt.Errorf("error decompressing session: %w", err)
+		}
+		return c.Codec.Decode(raw)
+	}
+	return nil, fmt.Errorf("error decoding session: unknown payload header %d", data[0])
+}
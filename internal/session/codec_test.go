@@ -0,0 +1,45 @@
+package session
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCompressedCodecRoundTrip(t *testing.T) {
+	codec := NewCompressedCodec(GobCodec{}, 512)
+
+	for name, value := range map[string]string{
+		"small": "tiny",
+		"large": strings.Repeat("bulky cart item ", 500),
+	} {
+		session, err := NewSession()
+		if err != nil {
+			t.Fatalf("error creating session. Err: %v", err)
+		}
+		session.Put("payload", value)
+		session.Put("visits", 3)
+
+		data, err := codec.Encode(session)
+		if err != nil {
+			t.Fatalf("%s: error encoding session. Err: %v", name, err)
+		}
+		compressed := data[0] == payloadGzip
+		if compressed != (name == "large") {
+			t.Errorf("%s: expected compression %v; got %v", name, name == "large", compressed)
+		}
+
+		decoded, err := codec.Decode(data)
+		if err != nil {
+			t.Fatalf("%s: error decoding session. Err: %v", name, err)
+		}
+		if decoded.ID != session.ID {
+			t.Errorf("%s: expected id %s; got %s", name, session.ID, decoded.ID)
+		}
+		if decoded.Get("payload") != value {
+			t.Errorf("%s: payload was not preserved", name)
+		}
+		if decoded.Get("visits") != 3 {
+			t.Errorf("%s: expected visits to stay an int 3; got %v", name, decoded.Get("visits"))
+		}
+	}
+}
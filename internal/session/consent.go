@@ -0,0 +1,47 @@
+package session
+
+import (
+	"net/http"
+	"time"
+)
+
+// consentMaxAge is how long the consent cookie set by GrantConsent is kept.
+const consentMaxAge = 365 * 24 * time.Hour
+
+// HasConsent reports whether the request carries the consent cookie.
+func (sm *SessionManager) HasConsent(r *http.Request) bool {
+	_, err := r.Cookie(sm.ConsentCookieName)
+	return err == nil
+}
+
+// GrantConsent records the visitor's consent with a cookie and upgrades the
+// current session, so it is stored and its cookie set with this response.
+// It must be called before the response headers are written.
+func (sm *SessionManager) GrantConsent(w http.ResponseWriter, r *http.Request) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     sm.ConsentCookieName,
+		Value:    "1",
+		Path:     "/",
+		MaxAge:   int(consentMaxAge.Seconds()),
+		HttpOnly: true,
+		Secure:   secure,
+		SameSite: http.SameSiteLaxMode,
+	})
+	GetSession(r).Persist()
+}
+
+// Persist upgrades an ephemeral session so it is stored and its cookie set,
+// e.g. when an anonymous visitor performs an action requiring state.
+// It must be called before the response headers are written.
+func (s *Session) Persist() {
+	s.Lock()
+	defer s.Unlock()
+	s.ephemeral = false
+}
+
+// Ephemeral reports whether the session is waiting for consent and will not be persisted.
+func (s *Session) Ephemeral() bool {
+	s.RLock()
+	defer s.RUnlock()
+	return s.ephemeral
+}
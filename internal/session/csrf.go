@@ -0,0 +1,191 @@
+package session
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// genrateCSRFToken generates a 42-character base64 string with 256 bits of randomness CSRF token
+func generateCSRFToken() string {
+	id := make([]byte, 32)
+
+	_, err := io.ReadFull(rand.Reader, id)
+	if err != nil {
+		panic("failed to generate CSRF token")
+	}
+
+	return base64.RawURLEncoding.EncodeToString(id)
+}
+
+// CSRFToken returns the CSRF token of the session, masked with a fresh random pad.
+// Every call returns a different string, so the secret is never reflected verbatim
+// in responses and compression side channels such as BREACH cannot recover it.
+func (s *Session) CSRFToken() string {
+	token, _ := s.Get("csrf_token").(string)
+	return maskCSRFToken(token)
+}
+
+// CSRFToken returns the masked CSRF token of the request session, for use in forms and templates.
+func CSRFToken(r *http.Request) string {
+	return GetSession(r).CSRFToken()
+}
+
+// RotateCSRFToken replaces the CSRF token of the session and returns the new one, masked.
+func (s *Session) RotateCSRFToken() string {
+	token := generateCSRFToken()
+	s.Put("csrf_token", token)
+	return maskCSRFToken(token)
+}
+
+// maskCSRFToken returns base64(pad || pad XOR token) for a random pad of the token length.
+func maskCSRFToken(token string) string {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil || len(raw) == 0 {
+		return ""
+	}
+	masked := make([]byte, 2*len(raw))
+	pad := masked[:len(raw)]
+	if _, err := io.ReadFull(rand.Reader, pad); err != nil {
+		panic("failed to generate CSRF token mask")
+	}
+	subtle.XORBytes(masked[len(raw):], pad, raw)
+	return base64.RawURLEncoding.EncodeToString(masked)
+}
+
+// unmaskCSRFToken reverses maskCSRFToken. Unmasked tokens of the session token
+// length are accepted as is, for clients that still send the raw token.
+func unmaskCSRFToken(token string, size int) []byte {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil
+	}
+	switch len(raw) {
+	case size:
+		return raw
+	case 2 * size:
+		unmasked := make([]byte, size)
+		subtle.XORBytes(unmasked, raw[:size], raw[size:])
+		return unmasked
+	}
+	return nil
+}
+
+// verifyCSRFToken extracts the CSRF token from a given session and validates
+// it against the configured form field or, if absent, the configured header.
+func (m *SessionManager) verifyCSRFToken(r *http.Request, session *Session) bool {
+	if len(m.CSRFTrustedOrigins) > 0 && !m.verifyOrigin(r) {
+		return false
+	}
+
+	sToken, ok := session.Get("csrf_token").(string)
+	if !ok {
+		return false
+	}
+	expected, err := base64.RawURLEncoding.DecodeString(sToken)
+	if err != nil {
+		return false
+	}
+
+	token := r.FormValue(m.CSRFFieldName)
+
+	if token == "" {
+		token = r.Header.Get(m.CSRFHeaderName)
+	}
+
+	return subtle.ConstantTimeCompare(unmaskCSRFToken(token, len(expected)), expected) == 1
+}
+
+// verifyOrigin checks the Origin header, or the Referer header as a fallback,
+// against the request host and the trusted origins.
+func (m *SessionManager) verifyOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" || origin == "null" {
+		referer, err := url.Parse(r.Header.Get("Referer"))
+		if err != nil || referer.Host == "" {
+			return false
+		}
+		origin = referer.Scheme + "://" + referer.Host
+	}
+
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	if u.Host == r.Host {
+		return true
+	}
+	return slices.Contains(m.CSRFTrustedOrigins, u.Scheme+"://"+u.Host)
+}
+
+// csrfRequired reports whether the request method is protected and the request
+// is not exempted by path prefix or matcher.
+func (sm *SessionManager) csrfRequired(r *http.Request) bool {
+	if !slices.Contains(sm.CSRFMethods, r.Method) {
+		return false
+	}
+	for _, prefix := range sm.CSRFExemptPaths {
+		if underPath(r.URL.Path, prefix) {
+			return false
+		}
+	}
+	if sm.SkipCSRFForBearer && isBearerOnly(r, sm.CookieName) {
+		return false
+	}
+	for _, exempt := range sm.CSRFExemptFuncs {
+		if exempt(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// underPath reports whether path is prefix or a path below it: "/token"
+// matches "/token" and "/token/refresh" but not "/tokens". Prefixes ending
+// with a slash match every path starting with them.
+func underPath(path, prefix string) bool {
+	rest, ok := strings.CutPrefix(path, prefix)
+	return ok && (rest == "" || rest[0] == '/' || strings.HasSuffix(prefix, "/"))
+}
+
+// isBearerOnly reports whether the request carries a bearer token or an API key
+// and no session cookie.
+func isBearerOnly(r *http.Request, cookieName string) bool {
+	scheme, _, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || (!strings.EqualFold(scheme, "Bearer") && !strings.EqualFold(scheme, "ApiKey")) {
+		return false
+	}
+	_, err := r.Cookie(cookieName)
+	return err != nil
+}
+
+// checkCSRF enforces CSRF protection on state-changing requests. It writes the
+// error response and returns false if the request must not proceed.
+// Ephemeral sessions have no stored token to compare, their requests must
+// come from the request host or a trusted origin instead.
+func (sm *SessionManager) checkCSRF(srw *SessionResponseWriter, r *http.Request, session *Session) bool {
+	if !sm.csrfRequired(r) {
+		return true
+	}
+
+	ephemeral := session.Ephemeral()
+	verified := ephemeral && sm.verifyOrigin(r) || !ephemeral && sm.verifyCSRFToken(r, session)
+	if !verified {
+		if sm.CSRFFailureHandler != nil {
+			sm.CSRFFailureHandler.ServeHTTP(srw, r)
+		} else {
+			http.Error(srw, "CSRF token mismatch", http.StatusForbidden)
+		}
+		return false
+	}
+
+	if sm.RotateCSRFPerRequest && !ephemeral {
+		srw.Header().Set(sm.CSRFHeaderName, session.RotateCSRFToken())
+	}
+	return true
+}
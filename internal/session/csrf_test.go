@@ -0,0 +1,127 @@
+package session
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestManager() *SessionManager {
+	return &SessionManager{
+		CookieName:         "GOSESSID",
+		IdleExpiration:     time.Minute,
+		AbsoluteExpiration: time.Hour,
+		CSRFHeaderName:     "X-CSRF-Token",
+		CSRFFieldName:      "csrf_token",
+	}
+}
+
+func TestVerifyCSRFToken(t *testing.T) {
+	sm := newTestManager()
+	session, err := NewSession()
+	if err != nil {
+		t.Fatalf("error creating session. Err: %v", err)
+	}
+	raw := session.Get("csrf_token").(string)
+	masked := session.CSRFToken()
+	if masked == session.CSRFToken() {
+		t.Errorf("expected masked tokens to differ between calls")
+	}
+
+	tests := map[string]struct {
+		token string
+		want  bool
+	}{
+		"masked":  {masked, true},
+		"raw":     {raw, true},
+		"empty":   {"", false},
+		"garbage": {"not-a-token", false},
+		"other":   {(&Session{Data: map[string]any{"csrf_token": generateCSRFToken()}}).CSRFToken(), false},
+	}
+	for name, tc := range tests {
+		form := url.Values{"csrf_token": {tc.token}}
+		r := httptest.NewRequest("POST", "/", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if got := sm.verifyCSRFToken(r, session); got != tc.want {
+			t.Errorf("%s: expected %v; got %v", name, tc.want, got)
+		}
+	}
+}
+
+func TestVerifyOrigin(t *testing.T) {
+	sm := newTestManager()
+	sm.CSRFTrustedOrigins = []string{"https://app.example.com"}
+
+	tests := map[string]struct {
+		origin, referer string
+		want            bool
+	}{
+		"same host":       {"http://example.com", "", true},
+		"trusted origin":  {"https://app.example.com", "", true},
+		"foreign origin":  {"https://evil.example.net", "", false},
+		"trusted referer": {"", "https://app.example.com/form", true},
+		"missing":         {"", "", false},
+	}
+	for name, tc := range tests {
+		r := httptest.NewRequest("POST", "http://example.com/", nil)
+		if tc.origin != "" {
+			r.Header.Set("Origin", tc.origin)
+		}
+		if tc.referer != "" {
+			r.Header.Set("Referer", tc.referer)
+		}
+		if got := sm.verifyOrigin(r); got != tc.want {
+			t.Errorf("%s: expected %v; got %v", name, tc.want, got)
+		}
+	}
+}
+
+func TestActionToken(t *testing.T) {
+	session, err := NewSession()
+	if err != nil {
+		t.Fatalf("error creating session. Err: %v", err)
+	}
+	token := session.ActionToken("POST /password/change", time.Minute)
+
+	if !session.VerifyActionToken("POST /password/change", token) {
+		t.Errorf("expected token to be valid for its action")
+	}
+	if session.VerifyActionToken("DELETE /me", token) {
+		t.Errorf("expected token to be rejected for another action")
+	}
+	if session.VerifyActionToken("POST /password/change", session.ActionToken("POST /password/change", -time.Minute)) {
+		t.Errorf("expected expired token to be rejected")
+	}
+	session.RotateCSRFToken()
+	if session.VerifyActionToken("POST /password/change", token) {
+		t.Errorf("expected token to be rejected after CSRF rotation")
+	}
+}
+
+func TestCSRFRequired(t *testing.T) {
+	sm := newTestManager()
+	sm.CSRFMethods = []string{"POST"}
+	sm.CSRFExemptPaths = []string{"/token", "/hooks/"}
+
+	tests := map[string]struct {
+		method, path string
+		want         bool
+	}{
+		"safe method":       {"GET", "/profile", false},
+		"protected path":    {"POST", "/profile", true},
+		"exempt path":       {"POST", "/token", false},
+		"below exempt path": {"POST", "/token/refresh", false},
+		"sibling path":      {"POST", "/tokens", true},
+		"longer path":       {"POST", "/token-admin/delete", true},
+		"exempt directory":  {"POST", "/hooks/github", false},
+		"directory itself":  {"POST", "/hooks", true},
+	}
+	for name, tc := range tests {
+		r := httptest.NewRequest(tc.method, tc.path, nil)
+		if got := sm.csrfRequired(r); got != tc.want {
+			t.Errorf("%s: expected %v; got %v", name, tc.want, got)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package session
+
+import (
+	"sort"
+	"strings"
+)
+
+// namespaceSeparator joins a namespace and a key in the session data.
+const namespaceSeparator = ":"
+
+// Namespace is a scoped view of session data. Keys are stored in the session as
+// "<namespace>:<key>", so features such as auth, cart, and preferences can share
+// a session without colliding.
+type Namespace struct {
+	session *Session
+	prefix  string
+}
+
+// Namespace returns a scoped accessor for the named bucket of session data.
+func (s *Session) Namespace(name string) *Namespace {
+	return &Namespace{session: s, prefix: name + namespaceSeparator}
+}
+
+// Get retrieves a value from the namespace.
+func (n *Namespace) Get(key string) any {
+	return n.session.Get(n.prefix + key)
+}
+
+// Put sets a value in the namespace.
+func (n *Namespace) Put(key string, value any) {
+	n.session.Put(n.prefix+key, value)
+}
+
+// Delete removes a value from the namespace.
+func (n *Namespace) Delete(key string) {
+	n.session.Delete(n.prefix + key)
+}
+
+// Keys returns the sorted keys stored in the namespace, without the prefix.
+func (n *Namespace) Keys() []string {
+	n.session.RLock()
+	defer n.session.RUnlock()
+	var keys []string
+	for k := range n.session.Data {
+		if key, ok := strings.CutPrefix(k, n.prefix); ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Clear removes every value in the namespace.
+func (n *Namespace) Clear() {
+	n.session.Lock()
+	defer n.session.Unlock()
+	for k := range n.session.Data {
+		if strings.HasPrefix(k, n.prefix) {
+			delete(n.session.Data, k)
+			n.session.track(k, false)
+		}
+	}
+}
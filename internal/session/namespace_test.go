@@ -0,0 +1,77 @@
+package session
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNamespace(t *testing.T) {
+	session, err := NewSession()
+	if err != nil {
+		t.Fatalf("error creating session. Err: %v", err)
+	}
+	session.ResetChanges()
+	cart := session.Namespace("cart")
+	prefs := session.Namespace("prefs")
+
+	cart.Put("items", 3)
+	cart.Put("coupon", "SAVE10")
+	prefs.Put("items", "grid")
+
+	if got := cart.Get("items"); got != 3 {
+		t.Errorf("expected 3 cart items; got %v", got)
+	}
+	if got := prefs.Get("items"); got != "grid" {
+		t.Errorf("expected the prefs value to be separate; got %v", got)
+	}
+	if got := session.Get("cart:items"); got != 3 {
+		t.Errorf("expected the value stored under the prefixed key; got %v", got)
+	}
+	if keys := cart.Keys(); !reflect.DeepEqual(keys, []string{"coupon", "items"}) {
+		t.Errorf("expected sorted cart keys; got %v", keys)
+	}
+
+	cart.Delete("coupon")
+	if got := cart.Get("coupon"); got != nil {
+		t.Errorf("expected the coupon to be deleted; got %v", got)
+	}
+
+	cart.Clear()
+	if keys := cart.Keys(); len(keys) != 0 {
+		t.Errorf("expected an empty cart after Clear; got %v", keys)
+	}
+	if got := prefs.Get("items"); got != "grid" {
+		t.Errorf("expected other namespaces to survive Clear; got %v", got)
+	}
+	if session.Get("csrf_token") == nil {
+		t.Errorf("expected the session keys to survive Clear")
+	}
+
+	// Cleared keys are tracked, so stores merging writes delete them
+	if put, ok := session.changes["cart:items"]; !ok || put {
+		t.Errorf("expected the cleared key to be tracked as deleted; got %v, %v", put, ok)
+	}
+}
+
+func TestNamespaceMerge(t *testing.T) {
+	stored, err := NewSession()
+	if err != nil {
+		t.Fatalf("error creating session. Err: %v", err)
+	}
+	stored.Namespace("cart").Put("items", 3)
+	stored.Namespace("prefs").Put("theme", "dark")
+	stored.ResetChanges()
+
+	// A concurrent request clears the cart while another one changed the prefs
+	request := stored.Clone()
+	request.Namespace("cart").Clear()
+	stored.Namespace("prefs").Put("theme", "light")
+
+	stored.Merge(request)
+	if got := stored.Namespace("cart").Keys(); len(got) != 0 {
+		t.Errorf("expected the cleared cart to be merged; got %v", got)
+	}
+	if got := stored.Namespace("prefs").Get("theme"); got != "light" {
+		t.Errorf("expected the concurrent prefs change to be kept; got %v", got)
+	}
+}
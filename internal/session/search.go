@@ -0,0 +1,63 @@
+package session
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrStoreNotSearchable is returned by operations that need to enumerate
+// sessions when the store does not implement SearchableStore.
+var ErrStoreNotSearchable = errors.New("session store cannot enumerate sessions")
+
+// SearchableStore is implemented by stores able to enumerate their sessions,
+// e.g. to list or revoke all the sessions of a user.
+type SearchableStore interface {
+	SessionStore
+	// Find returns copies of the stored sessions matching the predicate.
+	Find(ctx context.Context, match func(*Session) bool) ([]*Session, error)
+}
+
+// UserIndexedStore is implemented by stores keeping an index of the sessions
+// of each user, by the "username" session value, to look them up without
+// scanning every session.
+type UserIndexedStore interface {
+	SessionStore
+	// FindByUser returns copies of the stored sessions of a user.
+	FindByUser(ctx context.Context, username string) ([]*Session, error)
+}
+
+// Find returns the stored sessions matching the predicate.
+func (sm *SessionManager) Find(ctx context.Context, match func(*Session) bool) ([]*Session, error) {
+	store, ok := sm.Store.(SearchableStore)
+	if !ok {
+		return nil, ErrStoreNotSearchable
+	}
+	return store.Find(ctx, match)
+}
+
+// DestroyWhere destroys the stored sessions matching the predicate and
+// returns how many were destroyed.
+func (sm *SessionManager) DestroyWhere(ctx context.Context, match func(*Session) bool) (int, error) {
+	sessions, err := sm.Find(ctx, match)
+	if err != nil {
+		return 0, err
+	}
+	for i, s := range sessions {
+		if err := sm.Store.Destroy(ctx, s.ID); err != nil {
+			return i, err
+		}
+	}
+	return len(sessions), nil
+}
+
+// UserSessions returns the stored sessions of a user, through the index of the
+// store if it has one.
+func (sm *SessionManager) UserSessions(ctx context.Context, username string) ([]*Session, error) {
+	if store, ok := sm.Store.(UserIndexedStore); ok {
+		return store.FindByUser(ctx, username)
+	}
+	return sm.Find(ctx, func(s *Session) bool {
+		owner, _ := s.Get("username").(string)
+		return owner == username
+	})
+}
@@ -1,12 +1,14 @@
 package session
 
 import (
+	"bufio"
 	"context"
 	"crypto/rand"
 	"encoding/base64"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
+	"net"
 	"net/http"
 	"sync"
 	"time"
@@ -16,11 +18,19 @@ const secure = true
 
 // Session represents a user session.
 type Session struct {
-	ID           string         `json:"id"`
-	CreatedAt    time.Time      `json:"created_at"`
-	LastActive   time.Time      `json:"last_active"`
-	Data         map[string]any `json:"data"`
-	sync.RWMutex                // For concurrent access to session data
+	ID         string         `json:"id"`
+	CreatedAt  time.Time      `json:"created_at"`
+	LastActive time.Time      `json:"last_active"`
+	Data       map[string]any `json:"data"`
+	Version    int64          `json:"version"` // Incremented by the store on every write
+	// Per-session timeouts overriding the manager values when non-zero
+	IdleTimeout     time.Duration   `json:"idle_timeout,omitempty"`
+	AbsoluteTimeout time.Duration   `json:"absolute_timeout,omitempty"`
+	changes         map[string]bool // Keys modified since read: true for put, false for delete
+	timeoutsChanged bool            // SetTimeouts was called since read
+	renewed         bool            // LastActive was extended since read, see Renew
+	ephemeral       bool            // Not persisted nor sent as a cookie until consent, see Persist
+	sync.RWMutex                    // For concurrent access to session data
 }
 
 // NewSession creates a new session with a unique ID.
@@ -49,7 +59,7 @@ func (s *Session) Put(key string, value any) {
 	s.Lock()
 	defer s.Unlock()
 	s.Data[key] = value
-	s.LastActive = time.Now() // Update last active time on data change
+	s.track(key, true)
 }
 
 // Delete removes a value from the session data.
@@ -57,23 +67,261 @@ func (s *Session) Delete(key string) {
 	s.Lock()
 	defer s.Unlock()
 	delete(s.Data, key)
-	s.LastActive = time.Now() // Update last active time on data change
+	s.track(key, false)
+}
+
+// SetTimeouts overrides the manager idle and absolute expiration for this session,
+// e.g. a short idle timeout for admin sessions or a long one for kiosk accounts.
+// A zero duration falls back to the manager value.
+func (s *Session) SetTimeouts(idle, absolute time.Duration) {
+	s.Lock()
+	defer s.Unlock()
+	s.IdleTimeout = idle
+	s.AbsoluteTimeout = absolute
+	s.timeoutsChanged = true
+}
+
+// Modified reports whether the session data changed since it was read.
+func (s *Session) Modified() bool {
+	s.RLock()
+	defer s.RUnlock()
+	return len(s.changes) > 0 || s.timeoutsChanged
+}
+
+// needsWrite reports whether the session must be written to the store: it
+// was never stored, or was modified or renewed since read.
+func (s *Session) needsWrite() bool {
+	s.RLock()
+	defer s.RUnlock()
+	return s.Version == 0 || len(s.changes) > 0 || s.timeoutsChanged || s.renewed
+}
+
+// track records a key modification so the store can merge it on write.
+// The caller must hold the write lock.
+func (s *Session) track(key string, put bool) {
+	if s.changes == nil {
+		s.changes = make(map[string]bool)
+	}
+	s.changes[key] = put
+}
+
+// Clone returns a copy of the session with its own data map and no pending changes.
+// Stores hand out clones so concurrent requests never share the same map.
+func (s *Session) Clone() *Session {
+	s.RLock()
+	defer s.RUnlock()
+	data := make(map[string]any, len(s.Data))
+	for k, v := range s.Data {
+		data[k] = v
+	}
+	return &Session{
+		ID:              s.ID,
+		CreatedAt:       s.CreatedAt,
+		LastActive:      s.LastActive,
+		Data:            data,
+		Version:         s.Version,
+		IdleTimeout:     s.IdleTimeout,
+		AbsoluteTimeout: s.AbsoluteTimeout,
+	}
+}
+
+// Merge applies the pending changes of src on top of s, so keys untouched by src
+// keep the value written by a concurrent request. The most recent activity wins.
+func (s *Session) Merge(src *Session) {
+	src.RLock()
+	defer src.RUnlock()
+	s.Lock()
+	defer s.Unlock()
+	for k, put := range src.changes {
+		if put {
+			s.Data[k] = src.Data[k]
+		} else {
+			delete(s.Data, k)
+		}
+	}
+	if src.timeoutsChanged {
+		s.IdleTimeout = src.IdleTimeout
+		s.AbsoluteTimeout = src.AbsoluteTimeout
+	}
+	if src.LastActive.After(s.LastActive) {
+		s.LastActive = src.LastActive
+	}
+}
+
+// ResetChanges clears the pending changes, typically after the session was written.
+func (s *Session) ResetChanges() {
+	s.Lock()
+	defer s.Unlock()
+	s.changes = nil
+	s.timeoutsChanged = false
+	s.renewed = false
+}
+
+// ExpiresAt returns the moment the session expires for the given default idle and
+// absolute timeouts. Timeouts set on the session itself take precedence.
+func (s *Session) ExpiresAt(idleTimeout, absoluteTimeout time.Duration) time.Time {
+	idle := s.LastActive.Add(s.idleTimeout(idleTimeout))
+	absolute := s.CreatedAt.Add(s.absoluteTimeout(absoluteTimeout))
+	if idle.Before(absolute) {
+		return idle
+	}
+	return absolute
+}
+
+// idleTimeout returns the session idle timeout, or the default if not overridden.
+func (s *Session) idleTimeout(fallback time.Duration) time.Duration {
+	if s.IdleTimeout > 0 {
+		return s.IdleTimeout
+	}
+	return fallback
+}
+
+// absoluteTimeout returns the session absolute timeout, or the default if not overridden.
+func (s *Session) absoluteTimeout(fallback time.Duration) time.Duration {
+	if s.AbsoluteTimeout > 0 {
+		return s.AbsoluteTimeout
+	}
+	return fallback
 }
 
 // SessionStore defines the interface for storing and retrieving sessions.
+// The context carries the request deadline and cancellation, so network or
+// database backed stores can abort slow operations.
 type SessionStore interface {
+	Read(ctx context.Context, id string) (*Session, error)
+	Write(ctx context.Context, session *Session) error
+	Destroy(ctx context.Context, id string) error
+	GarbageCollect(ctx context.Context, idleTimeout, absoluteTimeout time.Duration) error
+}
+
+// LegacySessionStore is the context-free store interface used by older implementations.
+type LegacySessionStore interface {
 	Read(id string) (*Session, error)
 	Write(session *Session) error
 	Destroy(id string) error
 	GarbageCollect(idleTimeout, absoluteTimeout time.Duration) error
 }
 
+// legacyStoreAdapter turns a LegacySessionStore into a SessionStore.
+type legacyStoreAdapter struct {
+	store LegacySessionStore
+}
+
+// AdaptLegacyStore wraps a LegacySessionStore so it can be used as a SessionStore.
+// The wrapped store cannot be interrupted, so the context is only checked before each call.
+func AdaptLegacyStore(store LegacySessionStore) SessionStore {
+	return &legacyStoreAdapter{store: store}
+}
+
+func (a *legacyStoreAdapter) Read(ctx context.Context, id string) (*Session, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return a.store.Read(id)
+}
+
+func (a *legacyStoreAdapter) Write(ctx context.Context, session *Session) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return a.store.Write(session)
+}
+
+func (a *legacyStoreAdapter) Destroy(ctx context.Context, id string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return a.store.Destroy(id)
+}
+
+func (a *legacyStoreAdapter) GarbageCollect(ctx context.Context, idleTimeout, absoluteTimeout time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return a.store.GarbageCollect(idleTimeout, absoluteTimeout)
+}
+
+// ExpirationPolicy controls how activity extends the lifetime of a session.
+type ExpirationPolicy int
+
+const (
+	// SlidingExpiration extends the idle expiration on every activity,
+	// up to the absolute expiration.
+	SlidingExpiration ExpirationPolicy = iota
+	// FixedExpiration never extends a session: it expires AbsoluteExpiration
+	// after creation regardless of activity, and IdleExpiration is ignored.
+	// A per-session idle timeout is then measured from creation.
+	FixedExpiration
+	// HybridExpiration extends the idle expiration only once less than
+	// RenewalThreshold of it remains. Requests leaving the session data
+	// unchanged are then not written to the store until that point.
+	HybridExpiration
+)
+
+// ParseExpirationPolicy converts "sliding", "fixed", or "hybrid" to an ExpirationPolicy.
+func ParseExpirationPolicy(name string) (ExpirationPolicy, error) {
+	switch name {
+	case "", "sliding":
+		return SlidingExpiration, nil
+	case "fixed":
+		return FixedExpiration, nil
+	case "hybrid":
+		return HybridExpiration, nil
+	}
+	return SlidingExpiration, fmt.Errorf("unknown session expiration policy %q", name)
+}
+
 // SessionManager manages sessions, including their lifecycle and interaction with the store.
 type SessionManager struct {
 	Store              SessionStore
 	CookieName         string
 	IdleExpiration     time.Duration
 	AbsoluteExpiration time.Duration
+	// TouchOnRead extends the idle expiration on every request. When false, only
+	// requests that modify the session data or call Renew keep it alive.
+	TouchOnRead bool
+	// ExpirationPolicy selects how activity extends the idle expiration.
+	ExpirationPolicy ExpirationPolicy
+	// RenewalThreshold is the remaining idle time below which HybridExpiration renews a session.
+	RenewalThreshold time.Duration
+	// RequireConsent keeps sessions of anonymous visitors ephemeral: they are not
+	// stored and no cookie is set until the visitor sends the consent cookie or
+	// the session is upgraded with Persist. Their state-changing requests are
+	// checked against the Origin header rather than a CSRF token.
+	RequireConsent bool
+	// ConsentCookieName is the cookie signalling the visitor consented to cookies.
+	ConsentCookieName string
+	// RotateCSRFPerRequest issues a new CSRF token after every verified
+	// state-changing request. The new token is returned in the CSRFHeaderName header.
+	RotateCSRFPerRequest bool
+	// CSRFMethods lists the methods requiring a CSRF token.
+	CSRFMethods []string
+	// CSRFExemptPaths lists paths skipping CSRF verification, with the paths
+	// below them, e.g. webhook receivers. "/hooks" exempts "/hooks/github"
+	// but not "/hooksmith".
+	CSRFExemptPaths []string
+	// CSRFExemptFuncs are matchers: a request matching any of them skips CSRF verification.
+	CSRFExemptFuncs []func(*http.Request) bool
+	// CSRFTrustedOrigins enables Origin/Referer validation of state-changing requests.
+	// Entries are origins such as "https://app.example.com"; the request's own host
+	// is always trusted. Requests with neither header are rejected.
+	CSRFTrustedOrigins []string
+	// CSRFHeaderName is the request header carrying the CSRF token.
+	CSRFHeaderName string
+	// CSRFFieldName is the form field carrying the CSRF token.
+	CSRFFieldName string
+	// CSRFFailureHandler handles requests failing CSRF verification.
+	// Defaults to a plain 403 Forbidden response.
+	CSRFFailureHandler http.Handler
+	// SkipCSRFForBearer skips CSRF verification for requests authenticated with an
+	// "Authorization: Bearer" header and carrying no session cookie, since no
+	// ambient credentials are involved.
+	SkipCSRFForBearer bool
+	// Logger receives the errors of the manager and its store operations.
+	// Defaults to slog.Default().
+	Logger *slog.Logger
+
+	stopGC context.CancelFunc // Stops the garbage collection goroutine
 }
 
 // NewSessionManager creates a new SessionManager.
@@ -87,59 +335,64 @@ func NewSessionManager(
 		CookieName:         cookieName,
 		IdleExpiration:     idleExpiration,
 		AbsoluteExpiration: absoluteExpiration,
+		TouchOnRead:        true,
+		Logger:             slog.Default(),
+		ConsentCookieName:  "cookie_consent",
+		CSRFHeaderName:     "X-CSRF-Token",
+		CSRFFieldName:      "csrf_token",
+		CSRFMethods: []string{
+			http.MethodPost,
+			http.MethodPut,
+			http.MethodPatch,
+			http.MethodDelete,
+		},
 	}
-	// Start garbage collection in a goroutine
-	go sm.startGarbageCollection()
+	// Start garbage collection in a goroutine, until Close
+	ctx, cancel := context.WithCancel(context.Background())
+	sm.stopGC = cancel
+	go sm.startGarbageCollection(ctx)
 	return sm
 }
 
-// startGarbageCollection runs garbage collection periodically.
-func (sm *SessionManager) startGarbageCollection() {
+// startGarbageCollection runs garbage collection periodically until ctx is canceled.
+func (sm *SessionManager) startGarbageCollection(ctx context.Context) {
 	ticker := time.NewTicker(sm.IdleExpiration / 2) // Run GC more frequently than idle expiration
 	defer ticker.Stop()
-	for range ticker.C {
-		if err := sm.Store.GarbageCollect(sm.IdleExpiration, sm.AbsoluteExpiration); err != nil {
-			log.Printf("Error during session garbage collection: %v", err)
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+		if err := sm.Store.GarbageCollect(ctx, sm.idleTimeout(), sm.AbsoluteExpiration); err != nil && ctx.Err() == nil {
+			sm.logger().Error("Session garbage collection failed", "err", err)
 		}
 	}
 }
 
-// generateSessionID generates a secure, random session ID.
-func generateSessionID() (string, error) {
-	b := make([]byte, 32) // 32 bytes for a secure ID
-	if _, err := io.ReadFull(rand.Reader, b); err != nil {
-		return "", err
+// logger returns the Logger of the manager, or the default logger if unset.
+func (sm *SessionManager) logger() *slog.Logger {
+	if sm.Logger == nil {
+		return slog.Default()
 	}
-	return base64.RawURLEncoding.EncodeToString(b), nil
+	return sm.Logger
 }
 
-// genrateCSRFToken generates a 42-character base64 string with 256 bits of randomness CSRF token
-func generateCSRFToken() string {
-	id := make([]byte, 32)
-
-	_, err := io.ReadFull(rand.Reader, id)
-	if err != nil {
-		panic("failed to generate CSRF token")
+// Close stops the garbage collection of the manager, interrupting a run in
+// progress. Sessions are still served; call it once the server is shut down.
+func (sm *SessionManager) Close() {
+	if sm.stopGC != nil {
+		sm.stopGC()
 	}
-
-	return base64.RawURLEncoding.EncodeToString(id)
 }
 
-// verifyCSRFToken extracts the CSRF token from a given session and validates
-// it against the csrf_token form value or the X-CSRF-Token header.
-func (m *SessionManager) verifyCSRFToken(r *http.Request, session *Session) bool {
-	sToken, ok := session.Get("csrf_token").(string)
-	if !ok {
-		return false
-	}
-
-	token := r.FormValue("csrf_token")
-
-	if token == "" {
-		token = r.Header.Get("X-XSRF-Token")
+// generateSessionID generates a secure, random session ID.
+func generateSessionID() (string, error) {
+	b := make([]byte, 32) // 32 bytes for a secure ID
+	if _, err := io.ReadFull(rand.Reader, b); err != nil {
+		return "", err
 	}
-
-	return token == sToken
+	return base64.RawURLEncoding.EncodeToString(b), nil
 }
 
 // sessionContextKey is a type for context keys to avoid collisions.
@@ -166,10 +419,10 @@ func (sm *SessionManager) SessionMiddleware(next http.Handler) http.Handler {
 
 		if err == nil {
 			// Cookie found, try to read session from store
-			session, err = sm.Store.Read(sessionID.Value)
-			if err != nil || !sm.isValid(session) {
+			session, err = sm.Store.Read(r.Context(), sessionID.Value)
+			if err != nil || !sm.isValid(r.Context(), session) {
 				// Session not found or invalid, create a new one
-				log.Printf("Existing session invalid or not found, creating new.")
+				sm.logger().InfoContext(r.Context(), "Existing session invalid or not found, creating new")
 				session, _ = NewSession() // Error handling for NewSession ignored for brevity in this example
 			}
 		} else {
@@ -177,6 +430,11 @@ func (sm *SessionManager) SessionMiddleware(next http.Handler) http.Handler {
 			session, _ = NewSession() // Error handling for NewSession ignored for brevity in this example
 		}
 
+		// Anonymous visitors without consent get a session that lives only for this request
+		if session.Version == 0 && sm.RequireConsent && !sm.HasConsent(r) {
+			session.ephemeral = true
+		}
+
 		// Attach the session to the request context
 		ctx := context.WithValue(r.Context(), sessionKey, session)
 		r = r.WithContext(ctx)
@@ -186,6 +444,7 @@ func (sm *SessionManager) SessionMiddleware(next http.Handler) http.Handler {
 			ResponseWriter:   w,
 			Session:          session,
 			Manager:          sm,
+			ctx:              r.Context(),
 			HeaderWritten:    false,
 			SessionDestroyed: false,
 			StatusCode:       http.StatusOK, // Initialize with default 200 OK
@@ -194,14 +453,8 @@ func (sm *SessionManager) SessionMiddleware(next http.Handler) http.Handler {
 		w.Header().Add("Vary", "Cookie")
 		w.Header().Add("Cache-Control", `no-cache="Set-Cookie"`)
 
-		if r.Method == http.MethodPost ||
-			r.Method == http.MethodPut ||
-			r.Method == http.MethodPatch ||
-			r.Method == http.MethodDelete {
-			if !sm.verifyCSRFToken(r, session) {
-				http.Error(srw, "CSRF token mismatch", http.StatusForbidden)
-				return
-			}
+		if !sm.checkCSRF(srw, r, session) {
+			return
 		}
 
 		// This defer ensures WriteHeader is called at the end if the handler
@@ -217,21 +470,55 @@ func (sm *SessionManager) SessionMiddleware(next http.Handler) http.Handler {
 }
 
 // isValid checks if a session is still valid based on expiration times.
-func (sm *SessionManager) isValid(session *Session) bool {
+func (sm *SessionManager) isValid(ctx context.Context, session *Session) bool {
 	if session == nil {
 		return false
 	}
-	now := time.Now()
-	if now.Sub(session.LastActive) > sm.IdleExpiration || now.Sub(session.CreatedAt) > sm.AbsoluteExpiration {
+	if time.Now().After(sm.ExpiresAt(session)) {
 		// Session expired
-		sm.Store.Destroy(session.ID) // Destroy expired session
+		sm.Store.Destroy(ctx, session.ID) // Destroy expired session
 		return false
 	}
 	return true
 }
 
-// Migrate updates session from unauthenticated user to authenticated user
-func (sm *SessionManager) Migrate(session *Session) (*Session, error) {
+// idleTimeout returns the idle expiration in effect for the current policy.
+// Fixed sessions are never extended, so only the absolute expiration applies.
+func (sm *SessionManager) idleTimeout() time.Duration {
+	if sm.ExpirationPolicy == FixedExpiration {
+		return sm.AbsoluteExpiration
+	}
+	return sm.IdleExpiration
+}
+
+// ExpiresAt returns the moment the session expires under the manager's policy.
+func (sm *SessionManager) ExpiresAt(session *Session) time.Time {
+	session.RLock()
+	defer session.RUnlock()
+	return session.ExpiresAt(sm.idleTimeout(), sm.AbsoluteExpiration)
+}
+
+// Renew records activity on the session, extending its idle expiration
+// according to the manager's expiration policy.
+func (sm *SessionManager) Renew(session *Session) {
+	session.Lock()
+	defer session.Unlock()
+	now := time.Now()
+	switch sm.ExpirationPolicy {
+	case FixedExpiration:
+		return
+	case HybridExpiration:
+		if session.LastActive.Add(session.idleTimeout(sm.IdleExpiration)).Sub(now) > sm.RenewalThreshold {
+			return
+		}
+	}
+	session.LastActive = now
+	session.renewed = true
+}
+
+// Migrate updates session from unauthenticated user to authenticated user.
+// The new session gets a new ID and a new CSRF token.
+func (sm *SessionManager) Migrate(ctx context.Context, session *Session) (*Session, error) {
 	session.Lock()
 	defer session.Unlock()
 
@@ -242,8 +529,13 @@ func (sm *SessionManager) Migrate(session *Session) (*Session, error) {
 		}
 		newSession.Put(k, v)
 	}
+	// Privilege changes always get a fresh CSRF token
+	newSession.RotateCSRFToken()
+	if session.IdleTimeout > 0 || session.AbsoluteTimeout > 0 {
+		newSession.SetTimeouts(session.IdleTimeout, session.AbsoluteTimeout)
+	}
 
-	err := sm.Store.Destroy(session.ID)
+	err := sm.Store.Destroy(ctx, session.ID)
 	if err != nil {
 		return session, err
 	}
@@ -256,6 +548,7 @@ type SessionResponseWriter struct {
 	http.ResponseWriter
 	Session          *Session
 	Manager          *SessionManager
+	ctx              context.Context // Request context, used for store operations
 	HeaderWritten    bool
 	SessionDestroyed bool // NEW: Flag to indicate if the session has been destroyed
 	StatusCode       int  // Stores the status code to be written
@@ -264,7 +557,7 @@ type SessionResponseWriter struct {
 // WriteHeader captures the status code and manages header writing.
 func (srw *SessionResponseWriter) WriteHeader(statusCode int) {
 	if srw.HeaderWritten {
-		log.Println("Warning: WriteHeader called multiple times (superfluous).")
+		srw.Manager.logger().WarnContext(srw.context(), "WriteHeader called multiple times (superfluous)")
 		return // Ignore subsequent calls
 	}
 
@@ -284,11 +577,57 @@ func (srw *SessionResponseWriter) Write(b []byte) (int, error) {
 	return srw.ResponseWriter.Write(b)
 }
 
+// FlushError writes the headers, with the session cookie, if not already
+// written, and flushes the buffered body to the client, e.g. for streamed
+// responses. http.ResponseController calls it to flush.
+func (srw *SessionResponseWriter) FlushError() error {
+	if !srw.HeaderWritten {
+		srw.WriteHeader(http.StatusOK)
+	}
+	return http.NewResponseController(srw.ResponseWriter).Flush()
+}
+
+// Flush implements http.Flusher for the handlers flushing without a
+// ResponseController.
+func (srw *SessionResponseWriter) Flush() {
+	srw.FlushError()
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer, e.g. to
+// set deadlines.
+func (srw *SessionResponseWriter) Unwrap() http.ResponseWriter {
+	return srw.ResponseWriter
+}
+
+// Hijack saves the session, adding its cookie to the headers, and lets the
+// handler take over the connection, e.g. for a WebSocket. The headers are
+// then for the handler to write.
+func (srw *SessionResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := http.NewResponseController(srw.ResponseWriter).Hijack()
+	if err != nil {
+		return nil, nil, err
+	}
+	if !srw.HeaderWritten {
+		srw.writeCookieIfNecessary()
+		srw.HeaderWritten = true
+	}
+	return conn, rw, nil
+}
+
+// context returns the request context, or a background context if the writer
+// was not created by SessionMiddleware.
+func (srw *SessionResponseWriter) context() context.Context {
+	if srw.ctx == nil {
+		return context.Background()
+	}
+	return srw.ctx
+}
+
 // writeCookieIfNecessary adds the Set-Cookie header but does NOT call WriteHeader.
 func (srw *SessionResponseWriter) writeCookieIfNecessary() {
 	var cookie *http.Cookie
 	if srw.SessionDestroyed {
-		log.Println("Session destroyed, preparing clear cookie.")
+		srw.Manager.logger().DebugContext(srw.context(), "Session destroyed, preparing clear cookie")
 		cookie = &http.Cookie{
 			Name:     srw.Manager.CookieName,
 			Value:    "",
@@ -298,10 +637,15 @@ func (srw *SessionResponseWriter) writeCookieIfNecessary() {
 			Secure:   secure,
 			SameSite: http.SameSiteLaxMode,
 		}
-	} else if srw.Session != nil {
-		srw.Session.LastActive = time.Now()
-		if err := srw.Manager.Store.Write(srw.Session); err != nil {
-			log.Printf("Error saving session %s: %v", srw.Session.ID, err)
+	} else if srw.Session != nil && !srw.Session.Ephemeral() {
+		if srw.Manager.TouchOnRead || srw.Session.Modified() {
+			srw.Manager.Renew(srw.Session)
+		}
+		// Stored sessions neither modified nor renewed are not written again
+		if srw.Session.needsWrite() {
+			if err := srw.Manager.Store.Write(srw.context(), srw.Session); err != nil {
+				srw.Manager.logger().ErrorContext(srw.context(), "Failed to save session", "err", err)
+			}
 		}
 		cookie = &http.Cookie{
 			Name:     srw.Manager.CookieName,
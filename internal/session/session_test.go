@@ -0,0 +1,436 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memoryStore is a minimal SessionStore, the store package depends on this one.
+type memoryStore struct {
+	mu       sync.Mutex
+	sessions map[string]*Session
+	writes   int
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{sessions: map[string]*Session{}}
+}
+
+func (s *memoryStore) Read(_ context.Context, id string) (*Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	session, ok := s.sessions[id]
+	if !ok {
+		return nil, errors.New("session not found")
+	}
+	return session.Clone(), nil
+}
+
+func (s *memoryStore) Write(_ context.Context, session *Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.writes++
+	stored := session.Clone()
+	stored.Version++
+	s.sessions[session.ID] = stored
+	return nil
+}
+
+func (s *memoryStore) Destroy(_ context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.sessions, id)
+	return nil
+}
+
+func (s *memoryStore) GarbageCollect(context.Context, time.Duration, time.Duration) error {
+	return nil
+}
+
+// cookie returns the cookie named name set by the response, if any.
+func cookie(rr *httptest.ResponseRecorder, name string) *http.Cookie {
+	for _, c := range rr.Result().Cookies() {
+		if c.Name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+func TestConsentRequired(t *testing.T) {
+	st := newMemoryStore()
+	sm := NewSessionManager(st, "GOSESSID", time.Minute, time.Hour)
+	defer sm.Close()
+	sm.RequireConsent = true
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /", func(w http.ResponseWriter, r *http.Request) {})
+	mux.HandleFunc("POST /login", func(w http.ResponseWriter, r *http.Request) {
+		srw := w.(*SessionResponseWriter)
+		session, err := sm.Migrate(r.Context(), GetSession(r))
+		if err != nil {
+			t.Fatalf("error migrating session. Err: %v", err)
+		}
+		session.Put("username", "alice")
+		srw.Session = session
+	})
+	mux.HandleFunc("POST /consent", sm.GrantConsent)
+	handler := sm.SessionMiddleware(mux)
+
+	t.Run("anonymous visit", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+
+		if c := cookie(rr, "GOSESSID"); c != nil {
+			t.Errorf("expected no session cookie; got %v", c)
+		}
+		if len(st.sessions) != 0 {
+			t.Errorf("expected no stored session; got %d", len(st.sessions))
+		}
+	})
+
+	tests := []struct {
+		name   string
+		path   string
+		origin string
+		status int
+		cookie string
+	}{
+		{"login from the same origin", "/login", "http://example.com", http.StatusOK, "GOSESSID"},
+		{"login from a foreign origin", "/login", "https://evil.example.net", http.StatusForbidden, ""},
+		{"login without origin", "/login", "", http.StatusForbidden, ""},
+		{"consent", "/consent", "http://example.com", http.StatusOK, "cookie_consent"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, tt.path, nil)
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tt.status {
+				t.Fatalf("expected status %d; got %d", tt.status, rr.Code)
+			}
+			if tt.cookie == "" {
+				return
+			}
+			if cookie(rr, tt.cookie) == nil {
+				t.Errorf("expected the %s cookie to be set", tt.cookie)
+			}
+			session := cookie(rr, "GOSESSID")
+			if session == nil {
+				t.Fatalf("expected the session cookie to be set")
+			}
+			if _, err := st.Read(context.Background(), session.Value); err != nil {
+				t.Errorf("expected the session to be stored. Err: %v", err)
+			}
+		})
+	}
+}
+
+func TestRenew(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  ExpirationPolicy
+		idle    time.Duration // Time since the last activity
+		renewed bool
+	}{
+		{"sliding", SlidingExpiration, time.Second, true},
+		{"fixed", FixedExpiration, 50 * time.Second, false},
+		{"hybrid above threshold", HybridExpiration, time.Second, false},
+		{"hybrid below threshold", HybridExpiration, 50 * time.Second, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sm := &SessionManager{
+				IdleExpiration:     time.Minute,
+				AbsoluteExpiration: time.Hour,
+				ExpirationPolicy:   tt.policy,
+				RenewalThreshold:   15 * time.Second,
+			}
+			session, err := NewSession()
+			if err != nil {
+				t.Fatalf("error creating session. Err: %v", err)
+			}
+			lastActive := time.Now().Add(-tt.idle)
+			session.LastActive = lastActive
+
+			sm.Renew(session)
+			if renewed := session.LastActive.After(lastActive); renewed != tt.renewed {
+				t.Errorf("expected renewed %v; got %v", tt.renewed, renewed)
+			}
+		})
+	}
+}
+
+func TestExpiresAtPolicies(t *testing.T) {
+	session, err := NewSession()
+	if err != nil {
+		t.Fatalf("error creating session. Err: %v", err)
+	}
+	session.CreatedAt = time.Now().Add(-time.Minute)
+	session.LastActive = time.Now()
+
+	sliding := &SessionManager{IdleExpiration: time.Minute, AbsoluteExpiration: time.Hour}
+	if got, want := sliding.ExpiresAt(session), session.LastActive.Add(time.Minute); !got.Equal(want) {
+		t.Errorf("expected sliding expiration at %v; got %v", want, got)
+	}
+	fixed := &SessionManager{IdleExpiration: time.Minute, AbsoluteExpiration: time.Hour, ExpirationPolicy: FixedExpiration}
+	if got, want := fixed.ExpiresAt(session), session.CreatedAt.Add(time.Hour); !got.Equal(want) {
+		t.Errorf("expected fixed expiration at %v; got %v", want, got)
+	}
+}
+
+func TestHybridExpirationWrites(t *testing.T) {
+	st := newMemoryStore()
+	sm := NewSessionManager(st, "GOSESSID", time.Minute, time.Hour)
+	defer sm.Close()
+	sm.ExpirationPolicy = HybridExpiration
+	sm.RenewalThreshold = 15 * time.Second
+
+	put := false
+	handler := sm.SessionMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if put {
+			GetSession(r).Put("visited", true)
+		}
+	}))
+	request := func(id string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if id != "" {
+			req.AddCookie(&http.Cookie{Name: "GOSESSID", Value: id})
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	c := cookie(request(""), "GOSESSID")
+	if c == nil || st.writes != 1 {
+		t.Fatalf("expected the new session to be written once; got %d writes", st.writes)
+	}
+
+	request(c.Value)
+	if st.writes != 1 {
+		t.Errorf("expected no write above the renewal threshold; got %d writes", st.writes)
+	}
+
+	put = true
+	request(c.Value)
+	if st.writes != 2 {
+		t.Errorf("expected a write for modified data; got %d writes", st.writes)
+	}
+
+	put = false
+	st.mu.Lock()
+	st.sessions[c.Value].LastActive = time.Now().Add(-50 * time.Second)
+	st.mu.Unlock()
+	request(c.Value)
+	if st.writes != 3 {
+		t.Errorf("expected a write below the renewal threshold; got %d writes", st.writes)
+	}
+	if s, _ := st.Read(context.Background(), c.Value); time.Since(s.LastActive) > time.Second {
+		t.Errorf("expected the session to be renewed; last active %v", s.LastActive)
+	}
+}
+
+// legacyStore is a LegacySessionStore counting its calls.
+type legacyStore struct {
+	store *memoryStore
+	calls int
+}
+
+func (s *legacyStore) Read(id string) (*Session, error) {
+	s.calls++
+	return s.store.Read(context.Background(), id)
+}
+
+func (s *legacyStore) Write(session *Session) error {
+	s.calls++
+	return s.store.Write(context.Background(), session)
+}
+
+func (s *legacyStore) Destroy(id string) error {
+	s.calls++
+	return s.store.Destroy(context.Background(), id)
+}
+
+func (s *legacyStore) GarbageCollect(idleTimeout, absoluteTimeout time.Duration) error {
+	s.calls++
+	return nil
+}
+
+func TestAdaptLegacyStore(t *testing.T) {
+	legacy := &legacyStore{store: newMemoryStore()}
+	st := AdaptLegacyStore(legacy)
+	ctx := context.Background()
+	session, err := NewSession()
+	if err != nil {
+		t.Fatalf("error creating session. Err: %v", err)
+	}
+
+	if err := st.Write(ctx, session); err != nil {
+		t.Fatalf("error writing session. Err: %v", err)
+	}
+	read, err := st.Read(ctx, session.ID)
+	if err != nil || read.ID != session.ID {
+		t.Fatalf("expected to read the written session; got %v, %v", read, err)
+	}
+	if err := st.GarbageCollect(ctx, time.Minute, time.Hour); err != nil {
+		t.Fatalf("error collecting sessions. Err: %v", err)
+	}
+	if err := st.Destroy(ctx, session.ID); err != nil {
+		t.Fatalf("error destroying session. Err: %v", err)
+	}
+	if _, err := st.Read(ctx, session.ID); err == nil {
+		t.Errorf("expected the destroyed session to be gone")
+	}
+	if legacy.calls != 5 {
+		t.Errorf("expected 5 calls to the legacy store; got %d", legacy.calls)
+	}
+
+	// Canceled contexts fail before reaching the legacy store
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	legacy.calls = 0
+	if _, err := st.Read(canceled, session.ID); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled from Read; got %v", err)
+	}
+	if err := st.Write(canceled, session); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled from Write; got %v", err)
+	}
+	if err := st.Destroy(canceled, session.ID); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled from Destroy; got %v", err)
+	}
+	if err := st.GarbageCollect(canceled, time.Minute, time.Hour); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled from GarbageCollect; got %v", err)
+	}
+	if legacy.calls != 0 {
+		t.Errorf("expected no call to the legacy store; got %d", legacy.calls)
+	}
+}
+
+func TestTouchOnRead(t *testing.T) {
+	tests := []struct {
+		name    string
+		touch   bool
+		renewed bool
+	}{
+		{"touch on read", true, true},
+		{"no touch on read", false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st := newMemoryStore()
+			sm := NewSessionManager(st, "GOSESSID", time.Minute, time.Hour)
+			defer sm.Close()
+			sm.TouchOnRead = tt.touch
+
+			session, err := NewSession()
+			if err != nil {
+				t.Fatalf("error creating session. Err: %v", err)
+			}
+			lastActive := time.Now().Add(-30 * time.Second)
+			session.LastActive = lastActive
+			st.Write(context.Background(), session)
+
+			handler := sm.SessionMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.AddCookie(&http.Cookie{Name: "GOSESSID", Value: session.ID})
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			stored, err := st.Read(context.Background(), session.ID)
+			if err != nil {
+				t.Fatalf("error reading session. Err: %v", err)
+			}
+			if renewed := stored.LastActive.After(lastActive); renewed != tt.renewed {
+				t.Errorf("expected renewed %v; got %v", tt.renewed, renewed)
+			}
+		})
+	}
+}
+
+func TestSessionTimeouts(t *testing.T) {
+	sm := &SessionManager{IdleExpiration: time.Minute, AbsoluteExpiration: time.Hour, Store: newMemoryStore()}
+	session, err := NewSession()
+	if err != nil {
+		t.Fatalf("error creating session. Err: %v", err)
+	}
+	session.ResetChanges()
+
+	if got, want := sm.ExpiresAt(session), session.LastActive.Add(time.Minute); !got.Equal(want) {
+		t.Errorf("expected the manager idle expiration %v; got %v", want, got)
+	}
+
+	session.SetTimeouts(10*time.Second, 0)
+	if !session.Modified() {
+		t.Errorf("expected SetTimeouts to modify the session")
+	}
+	if got, want := sm.ExpiresAt(session), session.LastActive.Add(10*time.Second); !got.Equal(want) {
+		t.Errorf("expected the session idle expiration %v; got %v", want, got)
+	}
+
+	session.SetTimeouts(time.Hour, 30*time.Minute)
+	if got, want := sm.ExpiresAt(session), session.CreatedAt.Add(30*time.Minute); !got.Equal(want) {
+		t.Errorf("expected the session absolute expiration %v; got %v", want, got)
+	}
+
+	// Migrated sessions keep their timeouts
+	migrated, err := sm.Migrate(context.Background(), session)
+	if err != nil {
+		t.Fatalf("error migrating session. Err: %v", err)
+	}
+	if migrated.IdleTimeout != time.Hour || migrated.AbsoluteTimeout != 30*time.Minute {
+		t.Errorf("expected the migrated session to keep its timeouts; got %v, %v", migrated.IdleTimeout, migrated.AbsoluteTimeout)
+	}
+}
+
+func TestSessionIdleTimeoutExpires(t *testing.T) {
+	st := newMemoryStore()
+	sm := NewSessionManager(st, "GOSESSID", time.Minute, time.Hour)
+	defer sm.Close()
+	ctx := context.Background()
+
+	tests := []struct {
+		name  string
+		idle  time.Duration
+		valid bool
+	}{
+		{"manager timeout", 0, true},
+		{"shorter session timeout", 10 * time.Second, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			session, err := NewSession()
+			if err != nil {
+				t.Fatalf("error creating session. Err: %v", err)
+			}
+			session.SetTimeouts(tt.idle, 0)
+			session.LastActive = time.Now().Add(-20 * time.Second)
+			st.Write(ctx, session)
+
+			handler := sm.SessionMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.AddCookie(&http.Cookie{Name: "GOSESSID", Value: session.ID})
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			c := cookie(rr, "GOSESSID")
+			if c == nil {
+				t.Fatalf("expected the session cookie to be set")
+			}
+			if valid := c.Value == session.ID; valid != tt.valid {
+				t.Errorf("expected the session to be kept %v; got %v", tt.valid, valid)
+			}
+			if _, err := st.Read(ctx, session.ID); (err == nil) != tt.valid {
+				t.Errorf("expected the stored session to be kept %v. Err: %v", tt.valid, err)
+			}
+		})
+	}
+}
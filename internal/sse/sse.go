@@ -0,0 +1,264 @@
+// Package sse streams Server-Sent Events to logged-in users. A Broker
+// delivers the events published for a user to every stream of that user,
+// and broadcast events to every stream. Clients reconnecting with the ID of
+// the last event they received get the recent events they missed.
+package sse
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Event is a Server-Sent Event.
+type Event struct {
+	// ID of the event, assigned by the broker when published
+	ID string
+	// Name of the event, dispatched by EventSource to its listeners; "message" if empty
+	Name string
+	// Data of the event, possibly on several lines
+	Data string
+}
+
+// writeTo writes the event in the text/event-stream format.
+func (e Event) writeTo(w io.Writer) error {
+	var b strings.Builder
+	if e.ID != "" {
+		fmt.Fprintf(&b, "id: %s\n", e.ID)
+	}
+	if e.Name != "" {
+		fmt.Fprintf(&b, "event: %s\n", e.Name)
+	}
+	for _, line := range strings.Split(strings.ReplaceAll(e.Data, "\r\n", "\n"), "\n") {
+		fmt.Fprintf(&b, "data: %s\n", line)
+	}
+	b.WriteString("\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// published is an event kept for replay, with the user it was published for.
+type published struct {
+	seq      uint64
+	username string // "" for broadcast events
+	event    Event
+}
+
+// subscriber is an open stream.
+type subscriber struct {
+	username string
+	events   chan published
+	done     chan struct{}
+	once     sync.Once
+}
+
+func (s *subscriber) close() {
+	s.once.Do(func() { close(s.done) })
+}
+
+// Broker delivers published events to the streams of the users.
+type Broker struct {
+	// Username returns the authenticated user of a request, or "" if it is
+	// not authenticated. The request is then rejected.
+	Username func(r *http.Request) string
+	// Heartbeat is the interval between the comments keeping streams open
+	// through proxies that close idle connections.
+	Heartbeat time.Duration
+	// Retry is the reconnection delay advised to clients, zero for theirs.
+	Retry time.Duration
+	// Buffer is the number of events queued per stream. Streams too slow to
+	// keep up are closed, their clients reconnect and replay what they missed.
+	Buffer int
+	// History is the number of recent events kept for reconnecting clients.
+	History int
+	Logger  *slog.Logger
+
+	mu          sync.Mutex
+	seq         uint64
+	history     []published
+	subscribers map[*subscriber]struct{}
+	closed      bool
+}
+
+// NewBroker returns a broker authenticating users with the username function.
+func NewBroker(username func(r *http.Request) string) *Broker {
+	return &Broker{
+		Username:    username,
+		Heartbeat:   15 * time.Second,
+		Retry:       3 * time.Second,
+		Buffer:      16,
+		History:     100,
+		subscribers: map[*subscriber]struct{}{},
+	}
+}
+
+func (b *Broker) logger() *slog.Logger {
+	if b.Logger == nil {
+		return slog.Default()
+	}
+	return b.Logger
+}
+
+// Publish sends an event to the streams of a user and returns its ID.
+func (b *Broker) Publish(username string, event Event) string {
+	if username == "" {
+		return ""
+	}
+	return b.publish(username, event)
+}
+
+// Broadcast sends an event to every stream and returns its ID.
+func (b *Broker) Broadcast(event Event) string {
+	return b.publish("", event)
+}
+
+func (b *Broker) publish(username string, event Event) string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.seq++
+	event.ID = strconv.FormatUint(b.seq, 10)
+	p := published{seq: b.seq, username: username, event: event}
+	if b.History > 0 {
+		if len(b.history) >= b.History {
+			b.history = b.history[1:]
+		}
+		b.history = append(b.history, p)
+	}
+
+	for s := range b.subscribers {
+		if username != "" && s.username != username {
+			continue
+		}
+		select {
+		case s.events <- p:
+		default:
+			delete(b.subscribers, s)
+			s.close()
+		}
+	}
+	return event.ID
+}
+
+// subscribe registers a stream and returns the recent events of the user
+// published after the event with ID lastID, if any.
+func (b *Broker) subscribe(username, lastID string) (*subscriber, []published) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return nil, nil
+	}
+	s := &subscriber{username: username, events: make(chan published, b.Buffer), done: make(chan struct{})}
+	b.subscribers[s] = struct{}{}
+
+	after, err := strconv.ParseUint(lastID, 10, 64)
+	if err != nil {
+		return s, nil
+	}
+	var missed []published
+	for _, p := range b.history {
+		if p.seq > after && (p.username == "" || p.username == username) {
+			missed = append(missed, p)
+		}
+	}
+	return s, missed
+}
+
+func (b *Broker) unsubscribe(s *subscriber) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.subscribers, s)
+	s.close()
+}
+
+// ServeHTTP streams the events of the authenticated user until the client
+// disconnects. The stream is flushed after every event, through the
+// response writers wrapping w.
+func (b *Broker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	username := b.Username(r)
+	if username == "" {
+		http.Error(w, "Unauthenticated", http.StatusUnauthorized)
+		return
+	}
+
+	lastID := r.Header.Get("Last-Event-ID")
+	s, missed := b.subscribe(username, lastID)
+	if s == nil {
+		http.Error(w, "Shutting down", http.StatusServiceUnavailable)
+		return
+	}
+	defer b.unsubscribe(s)
+
+	rc := http.NewResponseController(w)
+	// Streams outlive the write timeout of the server
+	rc.SetWriteDeadline(time.Time{})
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no") // Disable the buffering of nginx
+	w.WriteHeader(http.StatusOK)
+	if b.Retry > 0 {
+		fmt.Fprintf(w, "retry: %d\n\n", b.Retry.Milliseconds())
+	}
+	if err := rc.Flush(); err != nil {
+		b.logger().ErrorContext(r.Context(), "Failed to flush event stream", "err", err)
+		return
+	}
+
+	var sent uint64
+	send := func(p published) error {
+		// Replayed events may also have been queued
+		if p.seq <= sent {
+			return nil
+		}
+		sent = p.seq
+		if err := p.event.writeTo(w); err != nil {
+			return err
+		}
+		return rc.Flush()
+	}
+	for _, p := range missed {
+		if err := send(p); err != nil {
+			return
+		}
+	}
+
+	heartbeat := time.NewTicker(b.Heartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case p := <-s.events:
+			if err := send(p); err != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if _, err := io.WriteString(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+			if err := rc.Flush(); err != nil {
+				return
+			}
+		case <-s.done:
+			return
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// Close ends every stream and rejects new ones. Clients reconnect to
+// another instance, or once the server is back.
+func (b *Broker) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	for s := range b.subscribers {
+		delete(b.subscribers, s)
+		s.close()
+	}
+}
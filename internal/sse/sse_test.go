@@ -0,0 +1,118 @@
+package sse
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestBroker(t *testing.T) (*Broker, *httptest.Server) {
+	broker := NewBroker(func(r *http.Request) string { return r.Header.Get("X-User") })
+	server := httptest.NewServer(broker)
+	t.Cleanup(func() {
+		broker.Close()
+		server.Close()
+	})
+	return broker, server
+}
+
+// open opens a stream and reads past the retry field.
+func open(t *testing.T, url string, header http.Header) *bufio.Reader {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodGet, url, nil)
+	req.Header = header
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("error opening stream. Err: %v", err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status %d; got %d", http.StatusOK, resp.StatusCode)
+	}
+	br := bufio.NewReader(resp.Body)
+	if got := next(t, br); got != "retry: 3000\n" {
+		t.Fatalf("expected the retry field; got %q", got)
+	}
+	return br
+}
+
+// next reads the next event or comment of a stream.
+func next(t *testing.T, br *bufio.Reader) string {
+	t.Helper()
+	var b strings.Builder
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			t.Fatalf("error reading stream. Err: %v", err)
+		}
+		if line == "\n" {
+			return b.String()
+		}
+		b.WriteString(line)
+	}
+}
+
+func TestEventFormat(t *testing.T) {
+	var b strings.Builder
+	Event{ID: "7", Name: "update", Data: "line 1\r\nline 2"}.writeTo(&b)
+	if got, want := b.String(), "id: 7\nevent: update\ndata: line 1\ndata: line 2\n\n"; got != want {
+		t.Errorf("expected %q; got %q", want, got)
+	}
+}
+
+func TestBroker(t *testing.T) {
+	broker, server := newTestBroker(t)
+
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatalf("error opening stream. Err: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected status %d; got %d", http.StatusUnauthorized, resp.StatusCode)
+	}
+
+	alice := open(t, server.URL, http.Header{"X-User": {"alice"}})
+	bob := open(t, server.URL, http.Header{"X-User": {"bob"}})
+
+	// Events published for a user only reach the streams of that user
+	broker.Publish("alice", Event{Data: "for alice"})
+	broker.Broadcast(Event{Name: "news", Data: "for everyone"})
+	if got := next(t, alice); got != "id: 1\ndata: for alice\n" {
+		t.Errorf("expected the event for alice; got %q", got)
+	}
+	for _, br := range []*bufio.Reader{alice, bob} {
+		if got := next(t, br); got != "id: 2\nevent: news\ndata: for everyone\n" {
+			t.Errorf("expected the broadcast event; got %q", got)
+		}
+	}
+
+	// Reconnecting clients get the events they missed
+	broker.Publish("bob", Event{Data: "missed"})
+	broker.Publish("alice", Event{Data: "not for bob"})
+	replay := open(t, server.URL, http.Header{"X-User": {"bob"}, "Last-Event-Id": {"2"}})
+	if got := next(t, replay); got != "id: 3\ndata: missed\n" {
+		t.Errorf("expected the missed event; got %q", got)
+	}
+}
+
+func TestHeartbeat(t *testing.T) {
+	broker, server := newTestBroker(t)
+	broker.Heartbeat = 10 * time.Millisecond
+
+	br := open(t, server.URL, http.Header{"X-User": {"alice"}})
+	if got := next(t, br); got != ": heartbeat\n" {
+		t.Errorf("expected a heartbeat; got %q", got)
+	}
+
+	// Closing the broker ends the streams
+	broker.Close()
+	for {
+		if _, err := br.ReadString('\n'); err != nil {
+			break
+		}
+	}
+}
@@ -0,0 +1,5 @@
+// Scripts of the pages rendered by the server. Requests changing state must
+// send the CSRF token, read from the meta tag the page renders it in.
+export function csrfToken() {
+  return document.querySelector('meta[name="csrf-token"]')?.content ?? "";
+}
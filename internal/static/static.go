@@ -0,0 +1,139 @@
+// Package static serves the CSS, JavaScript and images embedded in the
+// binary, so the starter ships them without an external web server.
+//
+// Every file is served under two names: its own, revalidated on every use,
+// and one with a digest of its content, e.g. css/app.3f2a9c1b.css, cached
+// for a year since a new content gets a new name. Pages reference the
+// latter through Assets.Path.
+package static
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+)
+
+//go:embed assets
+var embedded embed.FS
+
+// contentTypes complements the MIME types known to the mime package, which
+// depend on the system for anything but the most common extensions.
+var contentTypes = map[string]string{
+	".css":   "text/css; charset=utf-8",
+	".js":    "text/javascript; charset=utf-8",
+	".mjs":   "text/javascript; charset=utf-8",
+	".map":   "application/json",
+	".svg":   "image/svg+xml",
+	".ico":   "image/x-icon",
+	".woff":  "font/woff",
+	".woff2": "font/woff2",
+	".txt":   "text/plain; charset=utf-8",
+}
+
+// file is an asset held in memory.
+type file struct {
+	name    string // Path relative to the asset root
+	content []byte
+	digest  string // Hex prefix of the SHA-256 of the content
+}
+
+// Assets serves the files of a file system under a URL prefix.
+type Assets struct {
+	prefix  string
+	files   map[string]*file // By path relative to the root, hashed or not
+	hashed  map[string]string
+	modTime time.Time
+}
+
+// Embedded returns the assets embedded in the binary, served under prefix.
+func Embedded(prefix string) (*Assets, error) {
+	root, err := fs.Sub(embedded, "assets")
+	if err != nil {
+		return nil, err
+	}
+	return New(root, prefix)
+}
+
+// New reads the files of fsys, to serve them under prefix, e.g. "/static/".
+func New(fsys fs.FS, prefix string) (*Assets, error) {
+	a := &Assets{
+		prefix:  strings.TrimSuffix(prefix, "/") + "/",
+		files:   map[string]*file{},
+		hashed:  map[string]string{},
+		modTime: time.Now(),
+	}
+	err := fs.WalkDir(fsys, ".", func(name string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		content, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return err
+		}
+		sum := sha256.Sum256(content)
+		f := &file{name: name, content: content, digest: hex.EncodeToString(sum[:4])}
+
+		ext := path.Ext(name)
+		hashedName := strings.TrimSuffix(name, ext) + "." + f.digest + ext
+		a.files[name] = f
+		a.files[hashedName] = f
+		a.hashed[name] = hashedName
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error reading static assets: %v", err)
+	}
+	return a, nil
+}
+
+// Path returns the URL of an asset with the digest of its content, e.g.
+// /static/css/app.3f2a9c1b.css for css/app.css. It panics if there is no
+// such asset, since pages must not reference missing ones.
+func (a *Assets) Path(name string) string {
+	hashedName, ok := a.hashed[strings.TrimPrefix(name, "/")]
+	if !ok {
+		panic("static: no asset " + name)
+	}
+	return a.prefix + hashedName
+}
+
+// ServeHTTP serves the asset named by the request path after the prefix.
+func (a *Assets) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, a.prefix)
+	f, ok := a.files[name]
+	if !ok || name == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	if name == f.name {
+		// Unversioned names may change content: caches must revalidate
+		w.Header().Set("Cache-Control", "no-cache")
+	} else {
+		w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	}
+	w.Header().Set("ETag", `"`+f.digest+`"`)
+	w.Header().Set("Content-Type", contentType(f.name))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	http.ServeContent(w, r, f.name, a.modTime, bytes.NewReader(f.content))
+}
+
+// contentType returns the MIME type of a file by its extension.
+func contentType(name string) string {
+	ext := strings.ToLower(path.Ext(name))
+	if t, ok := contentTypes[ext]; ok {
+		return t
+	}
+	if t := mime.TypeByExtension(ext); t != "" {
+		return t
+	}
+	return "application/octet-stream"
+}
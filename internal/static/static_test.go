@@ -0,0 +1,79 @@
+package static
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestAssets(t *testing.T) {
+	assets, err := New(fstest.MapFS{
+		"css/app.css":       {Data: []byte("body { margin: 0 }")},
+		"fonts/inter.woff2": {Data: []byte("wOF2")},
+	}, "/static")
+	if err != nil {
+		t.Fatalf("error creating assets. Err: %v", err)
+	}
+
+	hashed := assets.Path("css/app.css")
+	if !strings.HasPrefix(hashed, "/static/css/app.") || !strings.HasSuffix(hashed, ".css") || hashed == "/static/css/app.css" {
+		t.Fatalf("expected a hashed path; got %q", hashed)
+	}
+
+	tests := []struct {
+		path         string
+		status       int
+		contentType  string
+		cacheControl string
+	}{
+		{hashed, http.StatusOK, "text/css; charset=utf-8", "public, max-age=31536000, immutable"},
+		{"/static/css/app.css", http.StatusOK, "text/css; charset=utf-8", "no-cache"},
+		{assets.Path("fonts/inter.woff2"), http.StatusOK, "font/woff2", "public, max-age=31536000, immutable"},
+		{"/static/css/app.00000000.css", http.StatusNotFound, "", ""},
+		{"/static/", http.StatusNotFound, "", ""},
+	}
+	for _, tt := range tests {
+		rr := httptest.NewRecorder()
+		assets.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, tt.path, nil))
+		if rr.Code != tt.status {
+			t.Errorf("%s: expected status %d; got %d", tt.path, tt.status, rr.Code)
+			continue
+		}
+		if tt.status != http.StatusOK {
+			continue
+		}
+		if got := rr.Header().Get("Content-Type"); got != tt.contentType {
+			t.Errorf("%s: expected content type %q; got %q", tt.path, tt.contentType, got)
+		}
+		if got := rr.Header().Get("Cache-Control"); got != tt.cacheControl {
+			t.Errorf("%s: expected cache control %q; got %q", tt.path, tt.cacheControl, got)
+		}
+	}
+
+	// Unversioned names are revalidated with the ETag
+	req := httptest.NewRequest(http.MethodGet, "/static/css/app.css", nil)
+	rr := httptest.NewRecorder()
+	assets.ServeHTTP(rr, req)
+	req.Header.Set("If-None-Match", rr.Header().Get("ETag"))
+	rr = httptest.NewRecorder()
+	assets.ServeHTTP(rr, req)
+	if rr.Code != http.StatusNotModified {
+		t.Errorf("expected status %d; got %d", http.StatusNotModified, rr.Code)
+	}
+}
+
+func TestEmbedded(t *testing.T) {
+	assets, err := Embedded("/static/")
+	if err != nil {
+		t.Fatalf("error reading embedded assets. Err: %v", err)
+	}
+	for _, name := range []string{"css/app.css", "js/app.js", "favicon.svg"} {
+		rr := httptest.NewRecorder()
+		assets.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, assets.Path(name), nil))
+		if rr.Code != http.StatusOK {
+			t.Errorf("%s: expected status %d; got %d", name, http.StatusOK, rr.Code)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package store
+
+import (
+	"container/heap"
+	"time"
+)
+
+// expiryEntry tracks when a single session is due for garbage collection.
+type expiryEntry struct {
+	id       string
+	deadline time.Time
+	index    int // Position in the heap, maintained by heap.Interface
+}
+
+// expiryIndex is a min-heap of sessions ordered by deadline, with a lookup
+// table so entries can be updated or removed when a session is written or destroyed.
+type expiryIndex struct {
+	entries []*expiryEntry
+	byID    map[string]*expiryEntry
+}
+
+func newExpiryIndex() *expiryIndex {
+	return &expiryIndex{byID: make(map[string]*expiryEntry)}
+}
+
+func (x *expiryIndex) Len() int { return len(x.entries) }
+
+func (x *expiryIndex) Less(i, j int) bool {
+	return x.entries[i].deadline.Before(x.entries[j].deadline)
+}
+
+func (x *expiryIndex) Swap(i, j int) {
+	x.entries[i], x.entries[j] = x.entries[j], x.entries[i]
+	x.entries[i].index = i
+	x.entries[j].index = j
+}
+
+func (x *expiryIndex) Push(v any) {
+	entry := v.(*expiryEntry)
+	entry.index = len(x.entries)
+	x.entries = append(x.entries, entry)
+}
+
+func (x *expiryIndex) Pop() any {
+	old := x.entries
+	n := len(old)
+	entry := old[n-1]
+	old[n-1] = nil
+	x.entries = old[:n-1]
+	return entry
+}
+
+// set inserts or moves the entry for a session.
+func (x *expiryIndex) set(id string, deadline time.Time) {
+	if entry, ok := x.byID[id]; ok {
+		entry.deadline = deadline
+		heap.Fix(x, entry.index)
+		return
+	}
+	entry := &expiryEntry{id: id, deadline: deadline}
+	x.byID[id] = entry
+	heap.Push(x, entry)
+}
+
+// remove drops the entry for a session, if any.
+func (x *expiryIndex) remove(id string) {
+	if entry, ok := x.byID[id]; ok {
+		heap.Remove(x, entry.index)
+		delete(x.byID, id)
+	}
+}
+
+// popExpired removes and returns the ids of all sessions due at or before now.
+func (x *expiryIndex) popExpired(now time.Time) []string {
+	var ids []string
+	for len(x.entries) > 0 && !x.entries[0].deadline.After(now) {
+		entry := heap.Pop(x).(*expiryEntry)
+		delete(x.byID, entry.id)
+		ids = append(ids, entry.id)
+	}
+	return ids
+}
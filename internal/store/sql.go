@@ -0,0 +1,144 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/raziel-aleman/go-starter/internal/database"
+	sm "github.com/raziel-aleman/go-starter/internal/session"
+)
+
+// Ensure SQLSessionStore satisfies the session store interfaces.
+var (
+	_ sm.SessionStore     = (*SQLSessionStore)(nil)
+	_ sm.UserIndexedStore = (*SQLSessionStore)(nil)
+)
+
+// maxWriteAttempts bounds the merges of a write racing other requests.
+const maxWriteAttempts = 5
+
+// SQLSessionStore keeps sessions in the sessions table of the database,
+// encoded by a codec, so they survive restarts and are shared by replicas of
+// the application.
+type SQLSessionStore struct {
+	sessions database.SessionRepository
+	codec    sm.Codec
+	// ExpiresAt computes the expiry recorded with each session, usually
+	// SessionManager.ExpiresAt. Sessions written without it are collected
+	// once idle for the idle timeout of the garbage collection.
+	ExpiresAt func(*sm.Session) time.Time
+}
+
+// NewSQLSessionStore creates a SQLSessionStore encoding sessions with codec,
+// or with gob if codec is nil.
+func NewSQLSessionStore(sessions database.SessionRepository, codec sm.Codec) *SQLSessionStore {
+	if codec == nil {
+		codec = sm.GobCodec{}
+	}
+	return &SQLSessionStore{sessions: sessions, codec: codec}
+}
+
+// Read retrieves a session from the database, at its stored version.
+func (s *SQLSessionStore) Read(ctx context.Context, id string) (*sm.Session, error) {
+	stored, err := s.sessions.FindSession(ctx, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, http.ErrNoCookie // Or a custom error for session not found
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s.decode(stored)
+}
+
+// decode returns a stored session at its stored version.
+func (s *SQLSessionStore) decode(stored database.StoredSession) (*sm.Session, error) {
+	session, err := s.codec.Decode(stored.Data)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding session %s: %v", stored.ID, err)
+	}
+	session.Version = stored.Version
+	return session, nil
+}
+
+// Write saves a session if it is still stored at the version it was read at.
+// If another request wrote the session since, only the keys changed by this
+// request are merged on top of the stored version, like InMemorySessionStore
+// does, and the write is retried.
+func (s *SQLSessionStore) Write(ctx context.Context, session *sm.Session) error {
+	next := session
+	for range maxWriteAttempts {
+		data, err := s.codec.Encode(next)
+		if err != nil {
+			return fmt.Errorf("error encoding session %s: %v", session.ID, err)
+		}
+		username, _ := next.Get("username").(string)
+		var expiresAt time.Time
+		if s.ExpiresAt != nil {
+			expiresAt = s.ExpiresAt(next)
+		}
+		err = s.sessions.SaveSession(ctx, database.StoredSession{
+			ID:         next.ID,
+			CreatedAt:  next.CreatedAt,
+			LastActive: next.LastActive,
+			Data:       data,
+			Version:    next.Version,
+			Username:   username,
+			ExpiresAt:  expiresAt,
+		})
+		if err == nil {
+			// The caller's snapshot is now in sync with the stored version
+			session.Version = next.Version + 1
+			session.ResetChanges()
+			return nil
+		}
+		if !errors.Is(err, database.ErrSessionConflict) {
+			return err
+		}
+
+		slog.InfoContext(ctx, "Session modified concurrently, merging changes")
+		if next, err = s.Read(ctx, session.ID); err != nil {
+			return err
+		}
+		next.Merge(session)
+	}
+	return fmt.Errorf("error writing session %s: %w", session.ID, database.ErrSessionConflict)
+}
+
+// Destroy removes a session from the database.
+func (s *SQLSessionStore) Destroy(ctx context.Context, id string) error {
+	return s.sessions.DeleteSession(ctx, id)
+}
+
+// FindByUser returns the stored sessions of a user.
+func (s *SQLSessionStore) FindByUser(ctx context.Context, username string) ([]*sm.Session, error) {
+	stored, err := s.sessions.FindUserSessions(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+	var found []*sm.Session
+	for _, session := range stored {
+		decoded, err := s.decode(session)
+		if err != nil {
+			return nil, err
+		}
+		found = append(found, decoded)
+	}
+	return found, nil
+}
+
+// GarbageCollect removes the sessions past the expiry recorded when they were
+// written, which accounts for their own idle and absolute timeouts. Sessions
+// written without an expiry are removed once idle for longer than idleTimeout.
+func (s *SQLSessionStore) GarbageCollect(ctx context.Context, idleTimeout, absoluteTimeout time.Duration) error {
+	now := time.Now()
+	inactiveSince := now.Add(-idleTimeout)
+	if idleTimeout <= 0 {
+		inactiveSince = time.Time{} // Keep them: their expiry is unknown
+	}
+	return s.sessions.DeleteExpiredSessions(ctx, now, inactiveSince)
+}
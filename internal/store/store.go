@@ -1,7 +1,8 @@
 package store
 
 import (
-	"log"
+	"context"
+	"log/slog"
 	"net/http"
 	"sync"
 	"time"
@@ -9,10 +10,23 @@ import (
 	sm "github.com/raziel-aleman/go-starter/internal/session"
 )
 
+// Ensure InMemorySessionStore satisfies the session store interfaces.
+var (
+	_ sm.SessionStore     = (*InMemorySessionStore)(nil)
+	_ sm.SearchableStore  = (*InMemorySessionStore)(nil)
+	_ sm.UserIndexedStore = (*InMemorySessionStore)(nil)
+)
+
 // InMemorySessionStore is a simple in-memory implementation of SessionStore.
 // NOT suitable for production due to lack of persistence and scalability.
 type InMemorySessionStore struct {
 	sessions map[string]*sm.Session
+	expiry   *expiryIndex
+	byUser   map[string]map[string]bool // Session IDs by username
+	// Timeouts from the last garbage collection, used to compute deadlines on write.
+	// The index is rebuilt whenever they change.
+	idleTimeout     time.Duration
+	absoluteTimeout time.Duration
 	sync.RWMutex
 }
 
@@ -20,46 +34,149 @@ type InMemorySessionStore struct {
 func NewInMemorySessionStore() *InMemorySessionStore {
 	return &InMemorySessionStore{
 		sessions: make(map[string]*sm.Session),
+		expiry:   newExpiryIndex(),
+		byUser:   make(map[string]map[string]bool),
 	}
 }
 
-// Read retrieves a session from the store.
-func (s *InMemorySessionStore) Read(id string) (*sm.Session, error) {
+// Read retrieves a copy of a session from the store, so each request works
+// on its own snapshot instead of sharing the stored data map.
+func (s *InMemorySessionStore) Read(_ context.Context, id string) (*sm.Session, error) {
 	s.RLock()
 	defer s.RUnlock()
 	session, ok := s.sessions[id]
 	if !ok {
 		return nil, http.ErrNoCookie // Or a custom error for session not found
 	}
-	return session, nil
+	return session.Clone(), nil
 }
 
-// Write saves a session to the store.
-func (s *InMemorySessionStore) Write(session *sm.Session) error {
+// Write saves a copy of a session to the store. If another request wrote the
+// session after this snapshot was read, only the keys changed by this request
+// are merged on top of the stored version instead of overwriting it.
+func (s *InMemorySessionStore) Write(ctx context.Context, session *sm.Session) error {
 	s.Lock()
 	defer s.Unlock()
-	s.sessions[session.ID] = session
+
+	var next *sm.Session
+	stored, ok := s.sessions[session.ID]
+	if ok && stored.Version != session.Version {
+		slog.InfoContext(ctx, "Session modified concurrently, merging changes")
+		next = stored.Clone()
+		next.Merge(session)
+	} else {
+		next = session.Clone()
+	}
+	next.Version++
+	if ok {
+		s.unindexUser(stored)
+	}
+	s.sessions[session.ID] = next
+	s.index(next)
+	s.indexUser(next)
+
+	// The caller's snapshot is now in sync with the stored version
+	session.Version = next.Version
+	session.ResetChanges()
 	return nil
 }
 
 // Destroy removes a session from the store.
-func (s *InMemorySessionStore) Destroy(id string) error {
+func (s *InMemorySessionStore) Destroy(_ context.Context, id string) error {
 	s.Lock()
 	defer s.Unlock()
+	if session, ok := s.sessions[id]; ok {
+		s.unindexUser(session)
+	}
 	delete(s.sessions, id)
+	s.expiry.remove(id)
 	return nil
 }
 
-// GarbageCollect removes expired sessions.
-func (s *InMemorySessionStore) GarbageCollect(idleTimeout, absoluteTimeout time.Duration) error {
+// Find returns copies of the stored sessions matching the predicate.
+func (s *InMemorySessionStore) Find(_ context.Context, match func(*sm.Session) bool) ([]*sm.Session, error) {
+	s.RLock()
+	defer s.RUnlock()
+	var found []*sm.Session
+	for _, session := range s.sessions {
+		if clone := session.Clone(); match(clone) {
+			found = append(found, clone)
+		}
+	}
+	return found, nil
+}
+
+// FindByUser returns copies of the stored sessions of a user.
+func (s *InMemorySessionStore) FindByUser(_ context.Context, username string) ([]*sm.Session, error) {
+	s.RLock()
+	defer s.RUnlock()
+	var found []*sm.Session
+	for id := range s.byUser[username] {
+		found = append(found, s.sessions[id].Clone())
+	}
+	return found, nil
+}
+
+// GarbageCollect removes expired sessions. Only sessions whose deadline has
+// passed are touched, so the write lock is held for as little time as possible.
+func (s *InMemorySessionStore) GarbageCollect(_ context.Context, idleTimeout, absoluteTimeout time.Duration) error {
 	s.Lock()
 	defer s.Unlock()
-	now := time.Now()
-	for id, session := range s.sessions {
-		if now.Sub(session.LastActive) > idleTimeout || now.Sub(session.CreatedAt) > absoluteTimeout {
-			delete(s.sessions, id)
-			log.Printf("Garbage collected session: %s", id)
+	if idleTimeout != s.idleTimeout || absoluteTimeout != s.absoluteTimeout {
+		s.idleTimeout = idleTimeout
+		s.absoluteTimeout = absoluteTimeout
+		s.rebuildIndex()
+	}
+	expired := s.expiry.popExpired(time.Now())
+	for _, id := range expired {
+		if session, ok := s.sessions[id]; ok {
+			s.unindexUser(session)
 		}
+		delete(s.sessions, id)
+	}
+	if len(expired) > 0 {
+		slog.Info("Garbage collected sessions", "count", len(expired))
 	}
 	return nil
 }
+
+// index records the deadline of a stored session. Until the first garbage
+// collection the timeouts are unknown, so the index is built lazily then.
+// The caller must hold the write lock.
+func (s *InMemorySessionStore) index(session *sm.Session) {
+	if s.idleTimeout == 0 && s.absoluteTimeout == 0 {
+		return
+	}
+	s.expiry.set(session.ID, session.ExpiresAt(s.idleTimeout, s.absoluteTimeout))
+}
+
+// rebuildIndex recomputes every deadline. The caller must hold the write lock.
+func (s *InMemorySessionStore) rebuildIndex() {
+	s.expiry = newExpiryIndex()
+	for _, session := range s.sessions {
+		s.index(session)
+	}
+}
+
+// indexUser adds a stored session to the index of its user. The caller must
+// hold the write lock.
+func (s *InMemorySessionStore) indexUser(session *sm.Session) {
+	username, _ := session.Data["username"].(string)
+	if username == "" {
+		return
+	}
+	if s.byUser[username] == nil {
+		s.byUser[username] = make(map[string]bool)
+	}
+	s.byUser[username][session.ID] = true
+}
+
+// unindexUser removes a stored session from the index of its user. The caller
+// must hold the write lock.
+func (s *InMemorySessionStore) unindexUser(session *sm.Session) {
+	username, _ := session.Data["username"].(string)
+	delete(s.byUser[username], session.ID)
+	if len(s.byUser[username]) == 0 {
+		delete(s.byUser, username)
+	}
+}
@@ -0,0 +1,258 @@
+package store
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/raziel-aleman/go-starter/internal/database/databasetest"
+	"github.com/raziel-aleman/go-starter/internal/database/fake"
+	sm "github.com/raziel-aleman/go-starter/internal/session"
+)
+
+func TestConcurrentWritesAreMerged(t *testing.T) {
+	ctx := context.Background()
+	store := NewInMemorySessionStore()
+	session, err := sm.NewSession()
+	if err != nil {
+		t.Fatalf("error creating session. Err: %v", err)
+	}
+	if err := store.Write(ctx, session); err != nil {
+		t.Fatalf("error writing session. Err: %v", err)
+	}
+
+	// Two requests read the same session
+	first, err := store.Read(ctx, session.ID)
+	if err != nil {
+		t.Fatalf("error reading session. Err: %v", err)
+	}
+	second, err := store.Read(ctx, session.ID)
+	if err != nil {
+		t.Fatalf("error reading session. Err: %v", err)
+	}
+
+	first.Put("cart", 3)
+	if second.Get("cart") != nil {
+		t.Errorf("expected snapshots to be isolated; got cart %v", second.Get("cart"))
+	}
+	second.Put("theme", "dark")
+
+	if err := store.Write(ctx, first); err != nil {
+		t.Fatalf("error writing session. Err: %v", err)
+	}
+	if err := store.Write(ctx, second); err != nil {
+		t.Fatalf("error writing session. Err: %v", err)
+	}
+
+	merged, err := store.Read(ctx, session.ID)
+	if err != nil {
+		t.Fatalf("error reading session. Err: %v", err)
+	}
+	if merged.Get("cart") != 3 {
+		t.Errorf("expected cart to be 3; got %v", merged.Get("cart"))
+	}
+	if merged.Get("theme") != "dark" {
+		t.Errorf("expected theme to be dark; got %v", merged.Get("theme"))
+	}
+	if merged.Version != 3 {
+		t.Errorf("expected version 3; got %d", merged.Version)
+	}
+}
+
+func TestGarbageCollectRemovesOnlyExpired(t *testing.T) {
+	ctx := context.Background()
+	store := NewInMemorySessionStore()
+
+	stale, _ := sm.NewSession()
+	stale.LastActive = time.Now().Add(-time.Hour)
+	fresh, _ := sm.NewSession()
+	for _, session := range []*sm.Session{stale, fresh} {
+		if err := store.Write(ctx, session); err != nil {
+			t.Fatalf("error writing session. Err: %v", err)
+		}
+	}
+
+	if err := store.GarbageCollect(ctx, 30*time.Minute, 24*time.Hour); err != nil {
+		t.Fatalf("error collecting sessions. Err: %v", err)
+	}
+	if _, err := store.Read(ctx, stale.ID); err == nil {
+		t.Errorf("expected stale session to be collected")
+	}
+	if _, err := store.Read(ctx, fresh.ID); err != nil {
+		t.Errorf("expected fresh session to be kept; got %v", err)
+	}
+
+	// Sessions written after the first collection are indexed on write
+	fresh.LastActive = time.Now().Add(-time.Hour)
+	if err := store.Write(ctx, fresh); err != nil {
+		t.Fatalf("error writing session. Err: %v", err)
+	}
+	if err := store.GarbageCollect(ctx, 30*time.Minute, 24*time.Hour); err != nil {
+		t.Fatalf("error collecting sessions. Err: %v", err)
+	}
+	if _, err := store.Read(ctx, fresh.ID); err == nil {
+		t.Errorf("expected rewritten stale session to be collected")
+	}
+}
+
+func TestFindByUser(t *testing.T) {
+	ctx := context.Background()
+	store := NewInMemorySessionStore()
+
+	var sessions []*sm.Session
+	for _, username := range []string{"alice", "alice", "bob"} {
+		session, err := sm.NewSession()
+		if err != nil {
+			t.Fatalf("error creating session. Err: %v", err)
+		}
+		session.Put("username", username)
+		if err := store.Write(ctx, session); err != nil {
+			t.Fatalf("error writing session. Err: %v", err)
+		}
+		sessions = append(sessions, session)
+	}
+
+	found, err := store.FindByUser(ctx, "alice")
+	if err != nil {
+		t.Fatalf("error finding sessions. Err: %v", err)
+	}
+	if len(found) != 2 {
+		t.Errorf("expected 2 sessions for alice; got %d", len(found))
+	}
+
+	// Changing the user of a session moves it in the index
+	sessions[1].Put("username", "bob")
+	if err := store.Write(ctx, sessions[1]); err != nil {
+		t.Fatalf("error writing session. Err: %v", err)
+	}
+	if err := store.Destroy(ctx, sessions[0].ID); err != nil {
+		t.Fatalf("error destroying session. Err: %v", err)
+	}
+
+	found, _ = store.FindByUser(ctx, "alice")
+	if len(found) != 0 {
+		t.Errorf("expected no sessions for alice; got %d", len(found))
+	}
+	found, _ = store.FindByUser(ctx, "bob")
+	if len(found) != 2 {
+		t.Errorf("expected 2 sessions for bob; got %d", len(found))
+	}
+}
+
+func TestSQLConcurrentWritesAreMerged(t *testing.T) {
+	ctx := context.Background()
+	store := NewSQLSessionStore(fake.New(), nil)
+	session, err := sm.NewSession()
+	if err != nil {
+		t.Fatalf("error creating session. Err: %v", err)
+	}
+	if err := store.Write(ctx, session); err != nil {
+		t.Fatalf("error writing session. Err: %v", err)
+	}
+
+	// Two requests read the same session
+	first, err := store.Read(ctx, session.ID)
+	if err != nil {
+		t.Fatalf("error reading session. Err: %v", err)
+	}
+	second, err := store.Read(ctx, session.ID)
+	if err != nil {
+		t.Fatalf("error reading session. Err: %v", err)
+	}
+	first.Put("cart", 3)
+	second.Put("theme", "dark")
+
+	if err := store.Write(ctx, first); err != nil {
+		t.Fatalf("error writing session. Err: %v", err)
+	}
+	if err := store.Write(ctx, second); err != nil {
+		t.Fatalf("error writing session. Err: %v", err)
+	}
+
+	merged, err := store.Read(ctx, session.ID)
+	if err != nil {
+		t.Fatalf("error reading session. Err: %v", err)
+	}
+	if merged.Get("cart") != 3 || merged.Get("theme") != "dark" {
+		t.Errorf("expected both writes to be kept; got %v", merged.Data)
+	}
+	if merged.Version != 3 || second.Version != 3 {
+		t.Errorf("expected version 3; got %d stored, %d written", merged.Version, second.Version)
+	}
+}
+
+func TestSQLGarbageCollectUsesSessionTimeouts(t *testing.T) {
+	ctx := context.Background()
+	store := NewSQLSessionStore(databasetest.New(t), nil)
+	store.ExpiresAt = func(s *sm.Session) time.Time { return s.ExpiresAt(30*time.Minute, 24*time.Hour) }
+
+	// Idle for an hour, past the global idle timeout but not its own
+	remembered, _ := sm.NewSession()
+	remembered.IdleTimeout = 7 * 24 * time.Hour
+	remembered.AbsoluteTimeout = 30 * 24 * time.Hour
+	remembered.LastActive = time.Now().Add(-time.Hour)
+	// Active, but past its own absolute timeout
+	capped, _ := sm.NewSession()
+	capped.AbsoluteTimeout = time.Hour
+	capped.CreatedAt = time.Now().Add(-2 * time.Hour)
+	stale, _ := sm.NewSession()
+	stale.LastActive = time.Now().Add(-time.Hour)
+	for _, session := range []*sm.Session{remembered, capped, stale} {
+		if err := store.Write(ctx, session); err != nil {
+			t.Fatalf("error writing session. Err: %v", err)
+		}
+	}
+
+	if err := store.GarbageCollect(ctx, 30*time.Minute, 24*time.Hour); err != nil {
+		t.Fatalf("error collecting sessions. Err: %v", err)
+	}
+	if _, err := store.Read(ctx, remembered.ID); err != nil {
+		t.Errorf("expected the session with a longer idle timeout to be kept; got %v", err)
+	}
+	if _, err := store.Read(ctx, capped.ID); err == nil {
+		t.Errorf("expected the session past its absolute timeout to be collected")
+	}
+	if _, err := store.Read(ctx, stale.ID); err == nil {
+		t.Errorf("expected the stale session to be collected")
+	}
+}
+
+func TestSQLCompressedCodec(t *testing.T) {
+	ctx := context.Background()
+	db := databasetest.New(t)
+	store := NewSQLSessionStore(db, sm.NewCompressedCodec(sm.GobCodec{}, 1024))
+
+	small, _ := sm.NewSession()
+	small.Put("theme", "dark")
+	large, _ := sm.NewSession()
+	large.Put("cart", strings.Repeat("item ", 1000))
+	for _, session := range []*sm.Session{small, large} {
+		if err := store.Write(ctx, session); err != nil {
+			t.Fatalf("error writing session. Err: %v", err)
+		}
+	}
+
+	// Only the large session is stored compressed, both read back the same
+	stored, err := db.FindSession(ctx, large.ID)
+	if err != nil {
+		t.Fatalf("error finding session. Err: %v", err)
+	}
+	if len(stored.Data) >= 1000 || stored.Data[0] != 1 {
+		t.Errorf("expected the large session to be stored compressed; got %d bytes with header %d", len(stored.Data), stored.Data[0])
+	}
+	if stored, _ := db.FindSession(ctx, small.ID); len(stored.Data) == 0 || stored.Data[0] != 0 {
+		t.Errorf("expected the small session to be stored uncompressed")
+	}
+	for _, session := range []*sm.Session{small, large} {
+		read, err := store.Read(ctx, session.ID)
+		if err != nil {
+			t.Fatalf("error reading session. Err: %v", err)
+		}
+		for key, value := range session.Data {
+			if read.Get(key) != value {
+				t.Errorf("expected %s to round trip; got %v", key, read.Get(key))
+			}
+		}
+	}
+}
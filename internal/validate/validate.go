@@ -0,0 +1,220 @@
+// Package validate checks request bodies against the rules declared in the
+// validate tag of their fields, reporting every invalid field at once:
+//
+//	type registerRequest struct {
+//		Username string `json:"username" validate:"required,min=3,max=32,regexp=^[a-z0-9_]+$"`
+//		Email    string `json:"email" validate:"required,email"`
+//	}
+//
+// The rules are required, min and max, counting the characters of strings
+// and the elements of slices and maps, email and regexp. The regexp rule
+// takes the rest of the tag, so it may contain commas and must come last.
+// Fields are reported by their JSON name.
+package validate
+
+import (
+	"fmt"
+	"net/mail"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// Errors lists the messages of each invalid field, by JSON field name.
+type Errors struct {
+	Fields map[string][]string `json:"errors"`
+}
+
+func (e *Errors) Error() string {
+	names := make([]string, 0, len(e.Fields))
+	for name := range e.Fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	parts := make([]string, len(names))
+	for i, name := range names {
+		parts[i] = name + " " + strings.Join(e.Fields[name], ", ")
+	}
+	return "invalid fields: " + strings.Join(parts, "; ")
+}
+
+// Add records a message for a field, for checks that tags cannot express.
+func (e *Errors) Add(field, message string) {
+	if e.Fields == nil {
+		e.Fields = map[string][]string{}
+	}
+	e.Fields[field] = append(e.Fields[field], message)
+}
+
+// Err returns e if it has any message, nil otherwise.
+func (e *Errors) Err() error {
+	if len(e.Fields) == 0 {
+		return nil
+	}
+	return e
+}
+
+// rule checks a field value, returning a message if it is invalid.
+type rule func(v reflect.Value) (string, bool)
+
+// field is a struct field with validation rules.
+type field struct {
+	index    int
+	name     string
+	required bool
+	rules    []rule
+}
+
+// fieldsCache holds the parsed fields of each struct type.
+var fieldsCache sync.Map // map[reflect.Type][]field
+
+// Struct validates the fields of a struct, or of the struct a pointer points
+// to. It returns *Errors if any field is invalid, and panics on malformed tags.
+func Struct(v any) error {
+	rv := reflect.Indirect(reflect.ValueOf(v))
+	if rv.Kind() != reflect.Struct {
+		panic(fmt.Sprintf("validate: %T is not a struct", v))
+	}
+
+	var errs Errors
+	for _, f := range fieldsOf(rv.Type()) {
+		value := rv.Field(f.index)
+		if value.IsZero() {
+			if f.required {
+				errs.Add(f.name, "is required")
+			}
+			// Optional fields are only checked when set
+			continue
+		}
+		for _, check := range f.rules {
+			if message, ok := check(value); !ok {
+				errs.Add(f.name, message)
+			}
+		}
+	}
+	return errs.Err()
+}
+
+// fieldsOf returns the fields of a struct type with rules, parsing them once.
+func fieldsOf(t reflect.Type) []field {
+	if cached, ok := fieldsCache.Load(t); ok {
+		return cached.([]field)
+	}
+
+	var fields []field
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag, ok := sf.Tag.Lookup("validate")
+		if !ok || tag == "" {
+			continue
+		}
+		f, err := parseField(sf, tag)
+		if err != nil {
+			panic(fmt.Sprintf("validate: %s.%s: %v", t.Name(), sf.Name, err))
+		}
+		f.index = i
+		fields = append(fields, f)
+	}
+	fieldsCache.Store(t, fields)
+	return fields
+}
+
+// parseField parses the rules of the validate tag of a struct field.
+func parseField(sf reflect.StructField, tag string) (field, error) {
+	f := field{name: jsonName(sf)}
+	for tag != "" {
+		var item string
+		if strings.HasPrefix(tag, "regexp=") {
+			item, tag = tag, ""
+		} else {
+			item, tag, _ = strings.Cut(tag, ",")
+		}
+		name, arg, _ := strings.Cut(item, "=")
+
+		switch name {
+		case "required":
+			f.required = true
+		case "min", "max":
+			n, err := strconv.Atoi(arg)
+			if err != nil || n < 0 {
+				return f, fmt.Errorf("invalid %s %q", name, arg)
+			}
+			f.rules = append(f.rules, lengthRule(name, n))
+		case "email":
+			f.rules = append(f.rules, emailRule)
+		case "regexp":
+			re, err := regexp.Compile(arg)
+			if err != nil {
+				return f, fmt.Errorf("invalid regexp %q: %v", arg, err)
+			}
+			f.rules = append(f.rules, regexpRule(re))
+		default:
+			return f, fmt.Errorf("unknown rule %q", name)
+		}
+	}
+	return f, nil
+}
+
+// jsonName returns the name of a field in JSON documents.
+func jsonName(sf reflect.StructField) string {
+	name, _, _ := strings.Cut(sf.Tag.Get("json"), ",")
+	if name == "" || name == "-" {
+		return sf.Name
+	}
+	return name
+}
+
+// length returns the number of characters of a string, or elements of a
+// slice, array or map.
+func length(v reflect.Value) int {
+	if v.Kind() == reflect.String {
+		return utf8.RuneCountInString(v.String())
+	}
+	return v.Len()
+}
+
+func lengthRule(name string, n int) rule {
+	return func(v reflect.Value) (string, bool) {
+		switch v.Kind() {
+		case reflect.String, reflect.Slice, reflect.Array, reflect.Map:
+		default:
+			return fmt.Sprintf("cannot be checked for %s length", name), false
+		}
+		unit := "characters long"
+		if v.Kind() != reflect.String {
+			unit = "elements"
+		}
+		if name == "min" && length(v) < n {
+			return fmt.Sprintf("must be at least %d %s", n, unit), false
+		}
+		if name == "max" && length(v) > n {
+			return fmt.Sprintf("must be at most %d %s", n, unit), false
+		}
+		return "", true
+	}
+}
+
+// emailRule accepts a bare address, without a display name or angle brackets.
+func emailRule(v reflect.Value) (string, bool) {
+	if v.Kind() == reflect.String {
+		addr, err := mail.ParseAddress(v.String())
+		if err == nil && addr.Name == "" && addr.Address == v.String() {
+			return "", true
+		}
+	}
+	return "must be a valid email address", false
+}
+
+func regexpRule(re *regexp.Regexp) rule {
+	return func(v reflect.Value) (string, bool) {
+		if v.Kind() != reflect.String || !re.MatchString(v.String()) {
+			return "has an invalid format", false
+		}
+		return "", true
+	}
+}
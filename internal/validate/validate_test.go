@@ -0,0 +1,64 @@
+package validate
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+type signup struct {
+	Username string   `json:"username" validate:"required,min=3,max=8,regexp=^[a-z]{1,8}$"`
+	Email    string   `json:"email,omitempty" validate:"email"`
+	Tags     []string `json:"tags" validate:"max=2"`
+	Note     string
+}
+
+func TestStruct(t *testing.T) {
+	tests := []struct {
+		name   string
+		value  signup
+		fields map[string][]string
+	}{
+		{"valid", signup{Username: "alice", Email: "alice@example.com"}, nil},
+		{"missing required", signup{}, map[string][]string{"username": {"is required"}}},
+		{"too short", signup{Username: "al"}, map[string][]string{"username": {"must be at least 3 characters long"}}},
+		{"too long and invalid format", signup{Username: "alice_smith"}, map[string][]string{
+			"username": {"must be at most 8 characters long", "has an invalid format"},
+		}},
+		{"invalid email", signup{Username: "alice", Email: "Alice <alice@example.com>"}, map[string][]string{
+			"email": {"must be a valid email address"},
+		}},
+		{"too many elements", signup{Username: "alice", Tags: []string{"a", "b", "c"}}, map[string][]string{
+			"tags": {"must be at most 2 elements"},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Struct(&tt.value)
+			if tt.fields == nil {
+				if err != nil {
+					t.Fatalf("expected no error; got %v", err)
+				}
+				return
+			}
+			var errs *Errors
+			if !errors.As(err, &errs) {
+				t.Fatalf("expected *Errors; got %v", err)
+			}
+			if !reflect.DeepEqual(errs.Fields, tt.fields) {
+				t.Errorf("expected %v; got %v", tt.fields, errs.Fields)
+			}
+		})
+	}
+}
+
+func TestMalformedTag(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expected a panic on an unknown rule")
+		}
+	}()
+	Struct(struct {
+		Name string `validate:"requird"`
+	}{})
+}
@@ -0,0 +1,392 @@
+// Package ws implements the server side of the WebSocket protocol (RFC 6455)
+// and a hub keeping track of the connections of each user, so features can
+// push messages to users in real time.
+//
+// Extensions, such as compression, and subprotocols are not negotiated.
+package ws
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Message types, the opcodes of their frames.
+const (
+	TextMessage   = 1
+	BinaryMessage = 2
+	CloseMessage  = 8
+	PingMessage   = 9
+	PongMessage   = 10
+)
+
+// Close codes used by the server.
+const (
+	CloseNormal          = 1000
+	CloseGoingAway       = 1001
+	CloseProtocolError   = 1002
+	CloseInvalidPayload  = 1007
+	ClosePolicyViolation = 1008
+	CloseTooLarge        = 1009
+	CloseNoStatus        = 1005
+)
+
+// acceptGUID is appended to the key of the handshake to compute its accept value.
+const acceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// DefaultReadLimit bounds the size of the messages read by connections.
+const DefaultReadLimit = 64 << 10
+
+// ErrBadHandshake is returned by Upgrade for requests that are not valid
+// WebSocket handshakes. The response has been written.
+var ErrBadHandshake = errors.New("ws: bad handshake")
+
+// CloseError is returned by ReadMessage when the peer closed the connection.
+type CloseError struct {
+	Code int
+	Text string
+}
+
+func (e *CloseError) Error() string {
+	return fmt.Sprintf("ws: connection closed with code %d %s", e.Code, e.Text)
+}
+
+// Upgrader upgrades HTTP requests to WebSocket connections.
+type Upgrader struct {
+	// CheckOrigin reports whether the handshake may be accepted from the
+	// Origin of the request. Browsers send cookies along with cross-site
+	// handshakes, so by default only the host of the request is allowed.
+	CheckOrigin func(r *http.Request) bool
+	// ReadLimit bounds the size of the messages read, DefaultReadLimit if zero.
+	ReadLimit int64
+}
+
+// Upgrade completes the WebSocket handshake of the request and takes over
+// its connection. Headers set on w, e.g. cookies, are sent with the handshake
+// response. When the request is not a valid handshake, Upgrade responds with
+// an error and returns ErrBadHandshake.
+func (u *Upgrader) Upgrade(w http.ResponseWriter, r *http.Request) (*Conn, error) {
+	if r.Method != http.MethodGet ||
+		!headerContains(r.Header, "Connection", "upgrade") ||
+		!headerContains(r.Header, "Upgrade", "websocket") {
+		w.Header().Set("Upgrade", "websocket")
+		http.Error(w, "WebSocket handshake expected", http.StatusUpgradeRequired)
+		return nil, ErrBadHandshake
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "Unsupported WebSocket version", http.StatusUpgradeRequired)
+		return nil, ErrBadHandshake
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if decoded, err := base64.StdEncoding.DecodeString(key); err != nil || len(decoded) != 16 {
+		http.Error(w, "Invalid WebSocket key", http.StatusBadRequest)
+		return nil, ErrBadHandshake
+	}
+	checkOrigin := u.CheckOrigin
+	if checkOrigin == nil {
+		checkOrigin = SameOrigin
+	}
+	if !checkOrigin(r) {
+		http.Error(w, "Origin not allowed", http.StatusForbidden)
+		return nil, ErrBadHandshake
+	}
+
+	netConn, rw, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		http.Error(w, "WebSocket not supported", http.StatusInternalServerError)
+		return nil, fmt.Errorf("ws: error hijacking connection: %w", err)
+	}
+	// Deadlines set by the HTTP server no longer apply
+	netConn.SetDeadline(time.Time{})
+
+	// Writers may add headers when the connection is taken over, e.g. cookies
+	header := w.Header().Clone()
+	header.Del("Content-Type")
+	header.Del("Content-Length")
+	header.Set("Upgrade", "websocket")
+	header.Set("Connection", "Upgrade")
+	header.Set("Sec-WebSocket-Accept", acceptKey(key))
+	rw.WriteString("HTTP/1.1 101 Switching Protocols\r\n")
+	header.Write(rw)
+	rw.WriteString("\r\n")
+	if err := rw.Flush(); err != nil {
+		netConn.Close()
+		return nil, fmt.Errorf("ws: error writing handshake: %w", err)
+	}
+
+	limit := u.ReadLimit
+	if limit == 0 {
+		limit = DefaultReadLimit
+	}
+	return &Conn{conn: netConn, br: rw.Reader, readLimit: limit}, nil
+}
+
+// SameOrigin reports whether the request has no Origin header, as non-browser
+// clients do, or one with the host of the request.
+func SameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, r.Host)
+}
+
+// acceptKey computes the Sec-WebSocket-Accept value of a handshake key.
+func acceptKey(key string) string {
+	sum := sha1.Sum([]byte(key + acceptGUID))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// headerContains reports whether a comma-separated header has the token.
+func headerContains(h http.Header, name, token string) bool {
+	for _, value := range h.Values(name) {
+		for _, item := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(item), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Conn is a WebSocket connection. One goroutine may read from it while
+// others write to it.
+type Conn struct {
+	conn      net.Conn
+	br        *bufio.Reader
+	readLimit int64
+
+	// PongHandler is called with the payload of the pongs received, e.g. to
+	// extend the read deadline. It runs on the reading goroutine.
+	PongHandler func(data []byte)
+
+	writeMu   sync.Mutex
+	closeSent bool
+}
+
+// SetReadDeadline sets the deadline of the reads from the connection.
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	return c.conn.SetReadDeadline(t)
+}
+
+// RemoteAddr returns the address of the peer.
+func (c *Conn) RemoteAddr() net.Addr {
+	return c.conn.RemoteAddr()
+}
+
+// ReadMessage reads the next text or binary message, answering the pings
+// and close frames received meanwhile. It returns a *CloseError once the
+// peer closed the connection.
+func (c *Conn) ReadMessage() (messageType int, data []byte, err error) {
+	for {
+		fin, opcode, payload, err := c.readFrame()
+		if err != nil {
+			return 0, nil, err
+		}
+
+		switch opcode {
+		case PingMessage:
+			if err := c.WriteControl(PongMessage, payload, time.Now().Add(5*time.Second)); err != nil {
+				return 0, nil, err
+			}
+			continue
+		case PongMessage:
+			if c.PongHandler != nil {
+				c.PongHandler(payload)
+			}
+			continue
+		case CloseMessage:
+			return 0, nil, c.handleClose(payload)
+		case TextMessage, BinaryMessage:
+		default:
+			// Continuation frames must follow a fragmented message
+			return 0, nil, c.fail(CloseProtocolError, "unexpected frame")
+		}
+
+		messageType, data = opcode, payload
+		for !fin {
+			// Control frames may come between the fragments, they do not end the message
+			last, opcode, payload, err := c.readFrame()
+			if err != nil {
+				return 0, nil, err
+			}
+			switch opcode {
+			case 0:
+				fin = last
+				if int64(len(data)+len(payload)) > c.readLimit {
+					return 0, nil, c.fail(CloseTooLarge, "message too large")
+				}
+				data = append(data, payload...)
+			case PingMessage:
+				if err := c.WriteControl(PongMessage, payload, time.Now().Add(5*time.Second)); err != nil {
+					return 0, nil, err
+				}
+			case PongMessage:
+				if c.PongHandler != nil {
+					c.PongHandler(payload)
+				}
+			case CloseMessage:
+				return 0, nil, c.handleClose(payload)
+			default:
+				return 0, nil, c.fail(CloseProtocolError, "unexpected frame")
+			}
+		}
+
+		if messageType == TextMessage && !utf8.Valid(data) {
+			return 0, nil, c.fail(CloseInvalidPayload, "invalid UTF-8")
+		}
+		return messageType, data, nil
+	}
+}
+
+// readFrame reads a frame and unmasks its payload.
+func (c *Conn) readFrame() (fin bool, opcode int, payload []byte, err error) {
+	var head [2]byte
+	if _, err := io.ReadFull(c.br, head[:]); err != nil {
+		return false, 0, nil, err
+	}
+	fin = head[0]&0x80 != 0
+	opcode = int(head[0] & 0x0f)
+	masked := head[1]&0x80 != 0
+	length := int64(head[1] & 0x7f)
+
+	if head[0]&0x70 != 0 {
+		return false, 0, nil, c.fail(CloseProtocolError, "unexpected extension")
+	}
+	// Clients must mask their frames
+	if !masked {
+		return false, 0, nil, c.fail(CloseProtocolError, "unmasked frame")
+	}
+	control := opcode >= CloseMessage
+	if control && (!fin || length > 125) {
+		return false, 0, nil, c.fail(CloseProtocolError, "invalid control frame")
+	}
+
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = int64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = int64(binary.BigEndian.Uint64(ext[:]))
+	}
+	if length < 0 || length > c.readLimit {
+		return false, 0, nil, c.fail(CloseTooLarge, "message too large")
+	}
+
+	var mask [4]byte
+	if _, err := io.ReadFull(c.br, mask[:]); err != nil {
+		return false, 0, nil, err
+	}
+	payload = make([]byte, length)
+	if _, err := io.ReadFull(c.br, payload); err != nil {
+		return false, 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return fin, opcode, payload, nil
+}
+
+// handleClose answers a close frame and returns the matching *CloseError.
+func (c *Conn) handleClose(payload []byte) error {
+	closeErr := &CloseError{Code: CloseNoStatus}
+	if len(payload) >= 2 {
+		closeErr.Code = int(binary.BigEndian.Uint16(payload))
+		closeErr.Text = string(payload[2:])
+	}
+	echo := closeErr.Code
+	if echo == CloseNoStatus {
+		echo = CloseNormal
+	}
+	c.WriteControl(CloseMessage, FormatClose(echo, ""), time.Now().Add(5*time.Second))
+	c.conn.Close()
+	return closeErr
+}
+
+// fail closes the connection with a close code, after a protocol violation
+// by the peer, and returns the error describing it.
+func (c *Conn) fail(code int, reason string) error {
+	c.WriteControl(CloseMessage, FormatClose(code, reason), time.Now().Add(5*time.Second))
+	c.conn.Close()
+	return &CloseError{Code: code, Text: reason}
+}
+
+// FormatClose returns the payload of a close frame.
+func FormatClose(code int, text string) []byte {
+	payload := make([]byte, 2, 2+len(text))
+	binary.BigEndian.PutUint16(payload, uint16(code))
+	return append(payload, text...)
+}
+
+// WriteMessage writes a text or binary message.
+func (c *Conn) WriteMessage(messageType int, data []byte, deadline time.Time) error {
+	if messageType != TextMessage && messageType != BinaryMessage {
+		return fmt.Errorf("ws: invalid message type %d", messageType)
+	}
+	return c.writeFrame(messageType, data, deadline)
+}
+
+// WriteControl writes a ping, pong or close frame. No frame is written after
+// a close frame.
+func (c *Conn) WriteControl(messageType int, data []byte, deadline time.Time) error {
+	if messageType < CloseMessage || len(data) > 125 {
+		return fmt.Errorf("ws: invalid control frame %d", messageType)
+	}
+	return c.writeFrame(messageType, data, deadline)
+}
+
+// writeFrame writes a whole message in a single unmasked frame.
+func (c *Conn) writeFrame(opcode int, data []byte, deadline time.Time) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if c.closeSent {
+		return net.ErrClosed
+	}
+	if opcode == CloseMessage {
+		c.closeSent = true
+	}
+
+	frame := make([]byte, 0, 10+len(data))
+	frame = append(frame, 0x80|byte(opcode))
+	switch n := len(data); {
+	case n <= 125:
+		frame = append(frame, byte(n))
+	case n <= 0xffff:
+		frame = append(frame, 126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(n))
+	default:
+		frame = append(frame, 127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(n))
+	}
+	frame = append(frame, data...)
+
+	c.conn.SetWriteDeadline(deadline)
+	_, err := c.conn.Write(frame)
+	return err
+}
+
+// Close sends a close frame with the code and closes the connection.
+func (c *Conn) Close(code int, reason string) error {
+	c.WriteControl(CloseMessage, FormatClose(code, reason), time.Now().Add(time.Second))
+	return c.conn.Close()
+}
@@ -0,0 +1,262 @@
+package ws
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Message is a text or binary message.
+type Message struct {
+	Type int
+	Data []byte
+}
+
+// Client is the connection of a user to the hub.
+type Client struct {
+	// Username of the authenticated user owning the connection
+	Username string
+
+	conn *Conn
+	hub  *Hub
+	send chan Message
+	done chan struct{}
+	once sync.Once
+}
+
+// Send queues a message for the client. It reports false if the client is
+// gone or too slow to keep up, in which case it is disconnected.
+func (c *Client) Send(msg Message) bool {
+	select {
+	case <-c.done:
+		return false
+	default:
+	}
+	select {
+	case c.send <- msg:
+		return true
+	default:
+		c.close(ClosePolicyViolation, "too slow")
+		return false
+	}
+}
+
+// close disconnects the client from the hub, once.
+func (c *Client) close(code int, reason string) {
+	c.once.Do(func() {
+		c.hub.remove(c)
+		close(c.done)
+		c.conn.Close(code, reason)
+	})
+}
+
+// Hub accepts the WebSocket connections of authenticated users and routes
+// messages to and from them. A user may have several connections, e.g. one
+// per browser tab.
+type Hub struct {
+	Upgrader Upgrader
+	// Username returns the authenticated user of a handshake request, or ""
+	// if it is not authenticated. The handshake is then rejected.
+	Username func(r *http.Request) string
+	// OnMessage handles the messages received from clients, nil discards them.
+	// It runs on the reading goroutine of the client.
+	OnMessage func(ctx context.Context, c *Client, msg Message)
+	// PingInterval is the interval between pings keeping connections alive.
+	// Connections silent for twice as long are closed.
+	PingInterval time.Duration
+	// SendBuffer is the number of messages queued per client.
+	SendBuffer int
+	Logger     *slog.Logger
+
+	mu      sync.Mutex
+	clients map[string]map[*Client]struct{} // By username
+	closed  bool
+}
+
+// NewHub returns a hub authenticating users with the username function.
+func NewHub(username func(r *http.Request) string) *Hub {
+	return &Hub{
+		Username:     username,
+		PingInterval: 30 * time.Second,
+		SendBuffer:   16,
+		clients:      map[string]map[*Client]struct{}{},
+	}
+}
+
+func (h *Hub) logger() *slog.Logger {
+	if h.Logger == nil {
+		return slog.Default()
+	}
+	return h.Logger
+}
+
+// ServeHTTP upgrades the request of an authenticated user and serves the
+// connection until it is closed.
+func (h *Hub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	username := h.Username(r)
+	if username == "" {
+		http.Error(w, "Unauthenticated", http.StatusUnauthorized)
+		return
+	}
+
+	conn, err := h.Upgrader.Upgrade(w, r)
+	if errors.Is(err, ErrBadHandshake) {
+		return
+	}
+	if err != nil {
+		h.logger().ErrorContext(r.Context(), "Failed to upgrade WebSocket connection", "username", username, "err", err)
+		return
+	}
+
+	c := &Client{
+		Username: username,
+		conn:     conn,
+		hub:      h,
+		send:     make(chan Message, h.SendBuffer),
+		done:     make(chan struct{}),
+	}
+	if !h.add(c) {
+		conn.Close(CloseGoingAway, "shutting down")
+		return
+	}
+	h.logger().InfoContext(r.Context(), "WebSocket connected", "username", username)
+
+	// The request context ends with the handler, not with the connection
+	ctx := context.WithoutCancel(r.Context())
+	go h.writeLoop(c)
+	h.readLoop(ctx, c)
+	h.logger().InfoContext(ctx, "WebSocket disconnected", "username", username)
+}
+
+// readLoop reads the messages of a client until it disconnects.
+func (h *Hub) readLoop(ctx context.Context, c *Client) {
+	defer c.close(CloseNormal, "")
+
+	extend := func([]byte) { c.conn.SetReadDeadline(time.Now().Add(2 * h.PingInterval)) }
+	c.conn.PongHandler = extend
+	extend(nil)
+	for {
+		messageType, data, err := c.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		extend(nil)
+		if h.OnMessage != nil {
+			h.OnMessage(ctx, c, Message{Type: messageType, Data: data})
+		}
+	}
+}
+
+// writeLoop writes the queued messages of a client and pings it.
+func (h *Hub) writeLoop(c *Client) {
+	ticker := time.NewTicker(h.PingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case msg := <-c.send:
+			if err := c.conn.WriteMessage(msg.Type, msg.Data, time.Now().Add(10*time.Second)); err != nil {
+				c.close(CloseGoingAway, "")
+				return
+			}
+		case <-ticker.C:
+			if err := c.conn.WriteControl(PingMessage, nil, time.Now().Add(10*time.Second)); err != nil {
+				c.close(CloseGoingAway, "")
+				return
+			}
+		case <-c.done:
+			return
+		}
+	}
+}
+
+func (h *Hub) add(c *Client) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		return false
+	}
+	if h.clients[c.Username] == nil {
+		h.clients[c.Username] = map[*Client]struct{}{}
+	}
+	h.clients[c.Username][c] = struct{}{}
+	return true
+}
+
+func (h *Hub) remove(c *Client) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.clients[c.Username], c)
+	if len(h.clients[c.Username]) == 0 {
+		delete(h.clients, c.Username)
+	}
+}
+
+// clientsOf returns the connections of a user, or of every user if username is "".
+func (h *Hub) clientsOf(username string) []*Client {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var clients []*Client
+	for name, set := range h.clients {
+		if username != "" && name != username {
+			continue
+		}
+		for c := range set {
+			clients = append(clients, c)
+		}
+	}
+	return clients
+}
+
+// SendToUser queues a message for every connection of a user and returns
+// the number of connections it was queued for.
+func (h *Hub) SendToUser(username string, msg Message) int {
+	if username == "" {
+		return 0
+	}
+	sent := 0
+	for _, c := range h.clientsOf(username) {
+		if c.Send(msg) {
+			sent++
+		}
+	}
+	return sent
+}
+
+// Broadcast queues a message for every connection.
+func (h *Hub) Broadcast(msg Message) {
+	for _, c := range h.clientsOf("") {
+		c.Send(msg)
+	}
+}
+
+// Connected reports whether a user has any connection.
+func (h *Hub) Connected(username string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.clients[username]) > 0
+}
+
+// Disconnect closes the connections of a user, e.g. on logout.
+func (h *Hub) Disconnect(username string) {
+	if username == "" {
+		return
+	}
+	for _, c := range h.clientsOf(username) {
+		c.close(ClosePolicyViolation, "logged out")
+	}
+}
+
+// Close closes every connection and rejects new ones. Connections taken
+// over from the HTTP server are not closed by its shutdown.
+func (h *Hub) Close() {
+	h.mu.Lock()
+	h.closed = true
+	h.mu.Unlock()
+	for _, c := range h.clientsOf("") {
+		c.close(CloseGoingAway, "shutting down")
+	}
+}
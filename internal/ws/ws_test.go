@@ -0,0 +1,183 @@
+package ws
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testClient is a minimal client side of the protocol.
+type testClient struct {
+	conn net.Conn
+	br   *bufio.Reader
+}
+
+func dial(t *testing.T, url string, header http.Header) (*testClient, *http.Response) {
+	t.Helper()
+	conn, err := net.Dial("tcp", strings.TrimPrefix(url, "http://"))
+	if err != nil {
+		t.Fatalf("error dialing server. Err: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	req, _ := http.NewRequest(http.MethodGet, url+"/ws", nil)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	if err := req.Write(conn); err != nil {
+		t.Fatalf("error writing handshake. Err: %v", err)
+	}
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		t.Fatalf("error reading handshake response. Err: %v", err)
+	}
+	return &testClient{conn: conn, br: br}, resp
+}
+
+func (c *testClient) write(t *testing.T, fin bool, opcode int, payload []byte) {
+	t.Helper()
+	b0 := byte(opcode)
+	if fin {
+		b0 |= 0x80
+	}
+	frame := []byte{b0, 0x80 | byte(len(payload)), 1, 2, 3, 4}
+	for i, b := range payload {
+		frame = append(frame, b^frame[2+i%4])
+	}
+	if _, err := c.conn.Write(frame); err != nil {
+		t.Fatalf("error writing frame. Err: %v", err)
+	}
+}
+
+func (c *testClient) read(t *testing.T) (int, []byte) {
+	t.Helper()
+	c.conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var head [2]byte
+	if _, err := io.ReadFull(c.br, head[:]); err != nil {
+		t.Fatalf("error reading frame. Err: %v", err)
+	}
+	length := int(head[1] & 0x7f)
+	if length == 126 {
+		var ext [2]byte
+		io.ReadFull(c.br, ext[:])
+		length = int(binary.BigEndian.Uint16(ext[:]))
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(c.br, payload); err != nil {
+		t.Fatalf("error reading payload. Err: %v", err)
+	}
+	return int(head[0] & 0x0f), payload
+}
+
+func newTestHub(t *testing.T) (*Hub, *httptest.Server) {
+	hub := NewHub(func(r *http.Request) string { return r.Header.Get("X-User") })
+	hub.OnMessage = func(ctx context.Context, c *Client, msg Message) {
+		// Echo to every connection of the user
+		hub.SendToUser(c.Username, Message{Type: msg.Type, Data: append([]byte(c.Username+": "), msg.Data...)})
+	}
+	server := httptest.NewServer(hub)
+	t.Cleanup(func() {
+		hub.Close()
+		server.Close()
+	})
+	return hub, server
+}
+
+func TestHandshake(t *testing.T) {
+	_, server := newTestHub(t)
+
+	_, resp := dial(t, server.URL, http.Header{"X-User": {"alice"}})
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("expected status %d; got %d", http.StatusSwitchingProtocols, resp.StatusCode)
+	}
+	// Example from RFC 6455, section 1.3
+	if got := resp.Header.Get("Sec-WebSocket-Accept"); got != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Errorf("unexpected Sec-WebSocket-Accept %q", got)
+	}
+
+	tests := []struct {
+		name   string
+		header http.Header
+		status int
+	}{
+		{"unauthenticated", http.Header{}, http.StatusUnauthorized},
+		{"other origin", http.Header{"X-User": {"alice"}, "Origin": {"https://evil.example.com"}}, http.StatusForbidden},
+		{"old version", http.Header{"X-User": {"alice"}, "Sec-Websocket-Version": {"8"}}, http.StatusUpgradeRequired},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, resp := dial(t, server.URL, tt.header)
+			if resp.StatusCode != tt.status {
+				t.Errorf("expected status %d; got %d", tt.status, resp.StatusCode)
+			}
+		})
+	}
+}
+
+func TestHub(t *testing.T) {
+	hub, server := newTestHub(t)
+	tab1, _ := dial(t, server.URL, http.Header{"X-User": {"alice"}})
+	tab2, _ := dial(t, server.URL, http.Header{"X-User": {"alice"}})
+	bob, _ := dial(t, server.URL, http.Header{"X-User": {"bob"}})
+
+	// Messages reach every connection of the user, fragmented or not
+	tab1.write(t, false, TextMessage, []byte("hel"))
+	tab1.write(t, true, PingMessage, []byte("p"))
+	tab1.write(t, true, 0, []byte("lo"))
+	if opcode, payload := tab1.read(t); opcode != PongMessage || string(payload) != "p" {
+		t.Errorf("expected a pong; got %d %q", opcode, payload)
+	}
+	for _, c := range []*testClient{tab1, tab2} {
+		if opcode, payload := c.read(t); opcode != TextMessage || string(payload) != "alice: hello" {
+			t.Errorf("expected the echo; got %d %q", opcode, payload)
+		}
+	}
+
+	if sent := hub.SendToUser("bob", Message{Type: TextMessage, Data: []byte("hi bob")}); sent != 1 {
+		t.Errorf("expected the message to be sent to 1 connection; got %d", sent)
+	}
+	if _, payload := bob.read(t); string(payload) != "hi bob" {
+		t.Errorf("expected the message for bob; got %q", payload)
+	}
+
+	// Closing is acknowledged and the connection is forgotten
+	bob.write(t, true, CloseMessage, FormatClose(CloseNormal, "bye"))
+	if opcode, payload := bob.read(t); opcode != CloseMessage || binary.BigEndian.Uint16(payload) != CloseNormal {
+		t.Errorf("expected a close frame; got %d %q", opcode, payload)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for hub.Connected("bob") && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if hub.Connected("bob") {
+		t.Errorf("expected bob to be disconnected")
+	}
+}
+
+func TestProtocolErrors(t *testing.T) {
+	_, server := newTestHub(t)
+	c, _ := dial(t, server.URL, http.Header{"X-User": {"alice"}})
+
+	// Clients must mask their frames
+	c.conn.Write([]byte{0x80 | TextMessage, 2, 'h', 'i'})
+	opcode, payload := c.read(t)
+	if opcode != CloseMessage || binary.BigEndian.Uint16(payload) != CloseProtocolError {
+		t.Errorf("expected a protocol error close frame; got %d %q", opcode, payload)
+	}
+	if _, err := c.br.ReadByte(); !errors.Is(err, io.EOF) {
+		t.Errorf("expected the connection to be closed; got %v", err)
+	}
+}